@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+type batchOptions struct {
+	socket   string
+	failFast bool
+}
+
+func (o *batchOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.socket, "socket", defaultSocketPath(), "Server socket path")
+	fs.BoolVar(&o.failFast, "fail-fast", false, "Stop at the first response with an error")
+}
+
+// runBatch sends newline-delimited messages from a file or stdin over one
+// connection and prints the array of responses (batch). It exits 1 if the
+// connection fails or any response has an error.
+func runBatch(args []string) int {
+	var opts batchOptions
+	fs := flag.NewFlagSet("batch", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine batch [--fail-fast] [file|-]")
+		return 1
+	}
+	socketPath = opts.socket
+
+	in := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "" && name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		in = file
+	}
+	msgs, err := readMessages(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	responses, err := sendBatch(msgs, opts.failFast)
+	output, _ := json.MarshalIndent(responses, "", "  ")
+	fmt.Println(string(output))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, resp := range responses {
+		if resp.Error != "" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// readMessages parses one protocol message per non-blank line, so a bad line
+// is reported before anything is sent.
+func readMessages(r io.Reader) ([]*protocol.Message, error) {
+	var msgs []*protocol.Message
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var msg protocol.Message
+		if err := json.Unmarshal(text, &msg); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, jsonError(err))
+		}
+		if msg.Type == "" {
+			return nil, fmt.Errorf("line %d: message has no type", line)
+		}
+		msgs = append(msgs, &msg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// sendBatch sends the messages over one connection and returns the responses
+// received. It stops at a connection error, or with failFast at the first
+// response with an error.
+func sendBatch(msgs []*protocol.Message, failFast bool) ([]*protocol.Response, error) {
+	responses := []*protocol.Response{}
+	conn, err := dialServer()
+	if err != nil {
+		return responses, err
+	}
+	defer conn.Close()
+	for i, msg := range msgs {
+		resp, err := exchange(conn, msg)
+		if err != nil {
+			return responses, fmt.Errorf("message %d: %w", i+1, err)
+		}
+		responses = append(responses, resp)
+		if failFast && resp.Error != "" {
+			return responses, fmt.Errorf("message %d: %s", i+1, resp.Error)
+		}
+	}
+	return responses, nil
+}
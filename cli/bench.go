@@ -0,0 +1,350 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// benchVarID is the ID each bench session uses for its test variable, well clear of app IDs.
+const benchVarID = 1000000
+
+// benchGrace is how long to wait for outstanding notifications after the run ends.
+const benchGrace = 2 * time.Second
+
+// benchResult is the report printed by `ui-engine bench`.
+type benchResult struct {
+	Sessions       int          `json:"sessions"`
+	Connected      int          `json:"connected"`
+	DurationSec    float64      `json:"durationSec"`
+	Sent           int64        `json:"sent"`
+	Received       int64        `json:"received"`
+	Lost           int64        `json:"lost"`
+	Errors         int64        `json:"errors"`
+	SentPerSec     float64      `json:"sentPerSec"`
+	ReceivedPerSec float64      `json:"receivedPerSec"`
+	LatencyMs      benchLatency `json:"latencyMs"`
+}
+
+type benchLatency struct {
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P95  float64 `json:"p95"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// bench collects measurements from all sessions.
+type bench struct {
+	baseURL   string
+	rate      int
+	duration  time.Duration
+	sent      atomic.Int64
+	received  atomic.Int64
+	lost      atomic.Int64
+	errors    atomic.Int64
+	connected atomic.Int64
+	latencies []time.Duration
+	mu        sync.Mutex
+}
+
+type benchOptions struct {
+	url      string
+	sessions int
+	rate     int
+	duration time.Duration
+	jsonOut  bool
+}
+
+func (o *benchOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.IntVar(&o.sessions, "sessions", 10, "Number of concurrent sessions")
+	fs.IntVar(&o.rate, "updates-per-sec", 10, "Updates per second sent by each session")
+	fs.DurationVar(&o.duration, "duration", 10*time.Second, "How long to send updates")
+	fs.BoolVar(&o.jsonOut, "json", false, "Print the report as JSON")
+}
+
+// runBench drives a running server with synthetic sessions and reports update round-trip latency.
+func runBench(args []string) int {
+	var opts benchOptions
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.sessions < 1 || opts.rate < 1 || opts.duration <= 0 {
+		fmt.Fprintln(os.Stderr, "Error: --sessions, --updates-per-sec and --duration must be positive")
+		return 1
+	}
+
+	b := &bench{baseURL: strings.TrimSuffix(opts.url, "/"), rate: opts.rate, duration: opts.duration}
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < opts.sessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := b.runSession(); err != nil {
+				b.errors.Add(1)
+				fmt.Fprintf(os.Stderr, "Warning: session failed: %v\n", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := b.result(opts.sessions, time.Since(start))
+	if opts.jsonOut {
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+	} else {
+		printBenchResult(result)
+	}
+	if result.Connected == 0 {
+		return 1
+	}
+	return 0
+}
+
+// runSession creates a session, watches variable 1 and a bench variable, and sends
+// updates at the configured rate until the duration ends.
+func (b *bench) runSession() error {
+	sessionID, err := b.createSession()
+	if err != nil {
+		return err
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL(b.baseURL)+"/ws/"+sessionID, nil)
+	if err != nil {
+		return fmt.Errorf("websocket connect: %w", err)
+	}
+	defer conn.Close()
+	b.connected.Add(1)
+
+	setup := []protocol.Message{
+		benchMessage(protocol.MsgWatch, protocol.WatchMessage{VarID: 1}),
+		benchMessage(protocol.MsgCreate, protocol.CreateMessage{
+			ID:         benchVarID,
+			Properties: map[string]string{protocol.BenchProperty: "true"},
+		}),
+	}
+	if err := conn.WriteJSON(protocol.BatchWrapper{UserEvent: true, Messages: setup}); err != nil {
+		return fmt.Errorf("setup: %w", err)
+	}
+
+	// pending maps sequence numbers to send times
+	pending := make(map[int64]time.Time)
+	var pendingMu sync.Mutex
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		b.readLoop(conn, pending, &pendingMu)
+	}()
+
+	ticker := time.NewTicker(time.Second / time.Duration(b.rate))
+	defer ticker.Stop()
+	deadline := time.After(b.duration)
+	var seq int64
+send:
+	for {
+		select {
+		case <-deadline:
+			break send
+		case <-readerDone:
+			return errors.New("connection closed by server")
+		case <-ticker.C:
+			seq++
+			pendingMu.Lock()
+			pending[seq] = time.Now()
+			pendingMu.Unlock()
+			update := benchMessage(protocol.MsgUpdate, protocol.UpdateMessage{
+				VarID:      benchVarID,
+				Properties: map[string]string{"seq": strconv.FormatInt(seq, 10)},
+			})
+			if err := conn.WriteJSON(protocol.BatchWrapper{UserEvent: true, Messages: []protocol.Message{update}}); err != nil {
+				return fmt.Errorf("send: %w", err)
+			}
+			b.sent.Add(1)
+		}
+	}
+
+	// Wait for outstanding notifications, then count the rest as lost
+	graceEnd := time.Now().Add(benchGrace)
+	for time.Now().Before(graceEnd) {
+		pendingMu.Lock()
+		n := len(pending)
+		pendingMu.Unlock()
+		if n == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	pendingMu.Lock()
+	b.lost.Add(int64(len(pending)))
+	pendingMu.Unlock()
+	return nil
+}
+
+// readLoop matches bench variable notifications to pending updates.
+// Updates coalesced into one notification all complete when it arrives.
+func (b *bench) readLoop(conn *websocket.Conn, pending map[int64]time.Time, pendingMu *sync.Mutex) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		now := time.Now()
+		var resp protocol.Response
+		if json.Unmarshal(data, &resp) == nil && resp.Error != "" {
+			b.errors.Add(1)
+			continue
+		}
+		msgs, _, err := protocol.ParseMessages(data)
+		if err != nil {
+			b.errors.Add(1)
+			continue
+		}
+		for _, msg := range msgs {
+			switch msg.Type {
+			case protocol.MsgError:
+				b.errors.Add(1)
+			case protocol.MsgUpdate:
+				var update protocol.UpdateMessage
+				if json.Unmarshal(msg.Data, &update) != nil || update.VarID != benchVarID {
+					continue
+				}
+				seq, err := strconv.ParseInt(update.Properties["seq"], 10, 64)
+				if err != nil {
+					continue
+				}
+				var done []time.Duration
+				pendingMu.Lock()
+				for s, sentAt := range pending {
+					if s <= seq {
+						done = append(done, now.Sub(sentAt))
+						delete(pending, s)
+					}
+				}
+				pendingMu.Unlock()
+				b.received.Add(int64(len(done)))
+				b.mu.Lock()
+				b.latencies = append(b.latencies, done...)
+				b.mu.Unlock()
+			}
+		}
+	}
+}
+
+// createSession asks the server for a new session and returns its ID.
+func (b *bench) createSession() (string, error) {
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Get(b.baseURL + "/")
+	if err != nil {
+		return "", fmt.Errorf("create session: %w", err)
+	}
+	resp.Body.Close()
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+		return "", fmt.Errorf("create session: unexpected HTTP %d", resp.StatusCode)
+	}
+	id := strings.Trim(location, "/")
+	if i := strings.IndexAny(id, "/?#"); i >= 0 {
+		id = id[:i]
+	}
+	return id, nil
+}
+
+func (b *bench) result(sessions int, elapsed time.Duration) benchResult {
+	b.mu.Lock()
+	latencies := append([]time.Duration(nil), b.latencies...)
+	b.mu.Unlock()
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+
+	secs := b.duration.Seconds()
+	r := benchResult{
+		Sessions:       sessions,
+		Connected:      int(b.connected.Load()),
+		DurationSec:    elapsed.Seconds(),
+		Sent:           b.sent.Load(),
+		Received:       b.received.Load(),
+		Lost:           b.lost.Load(),
+		Errors:         b.errors.Load(),
+		SentPerSec:     float64(b.sent.Load()) / secs,
+		ReceivedPerSec: float64(b.received.Load()) / secs,
+	}
+	if len(latencies) > 0 {
+		var total time.Duration
+		for _, l := range latencies {
+			total += l
+		}
+		r.LatencyMs = benchLatency{
+			Mean: ms(total / time.Duration(len(latencies))),
+			P50:  ms(percentile(latencies, 50)),
+			P95:  ms(percentile(latencies, 95)),
+			P99:  ms(percentile(latencies, 99)),
+			Max:  ms(latencies[len(latencies)-1]),
+		}
+	}
+	return r
+}
+
+// percentile returns the p-th percentile of sorted durations (nearest rank).
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted)*p + 99) / 100
+	if i < 1 {
+		i = 1
+	}
+	return sorted[i-1]
+}
+
+func printBenchResult(r benchResult) {
+	fmt.Printf("Sessions:     %d (%d connected)\n", r.Sessions, r.Connected)
+	fmt.Printf("Duration:     %.1fs\n", r.DurationSec)
+	fmt.Printf("Updates sent: %d (%.1f/s)\n", r.Sent, r.SentPerSec)
+	fmt.Printf("Notified:     %d (%.1f/s)\n", r.Received, r.ReceivedPerSec)
+	fmt.Printf("Lost:         %d\n", r.Lost)
+	fmt.Printf("Errors:       %d\n", r.Errors)
+	fmt.Println()
+	fmt.Printf("%-8s %10s\n", "LATENCY", "MS")
+	fmt.Printf("%-8s %10.2f\n", "mean", r.LatencyMs.Mean)
+	fmt.Printf("%-8s %10.2f\n", "p50", r.LatencyMs.P50)
+	fmt.Printf("%-8s %10.2f\n", "p95", r.LatencyMs.P95)
+	fmt.Printf("%-8s %10.2f\n", "p99", r.LatencyMs.P99)
+	fmt.Printf("%-8s %10.2f\n", "max", r.LatencyMs.Max)
+}
+
+func benchMessage(msgType protocol.MessageType, data any) protocol.Message {
+	raw, _ := json.Marshal(data)
+	return protocol.Message{Type: msgType, Data: raw}
+}
+
+// wsURL converts an http(s) base URL to ws(s).
+func wsURL(base string) string {
+	if rest, ok := strings.CutPrefix(base, "https://"); ok {
+		return "wss://" + rest
+	}
+	if rest, ok := strings.CutPrefix(base, "http://"); ok {
+		return "ws://" + rest
+	}
+	return base
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+type bundleCacheOptions struct {
+	cacheDir string
+	maxAge   time.Duration
+}
+
+func (o *bundleCacheOptions) bind(fs *flag.FlagSet, prune bool) {
+	fs.StringVar(&o.cacheDir, "cache-dir", bundle.DefaultChunkCacheDir, "Bundle chunk cache directory")
+	if prune {
+		fs.DurationVar(&o.maxAge, "max-age", bundle.DefaultChunkMaxAge, "Remove chunks unused for longer than this")
+	}
+}
+
+// runBundleCacheStats prints the chunk cache's size and hit rate (bundle cache-stats).
+func runBundleCacheStats(args []string) int {
+	var opts bundleCacheOptions
+	fs := flag.NewFlagSet("bundle cache-stats", flag.ContinueOnError)
+	opts.bind(fs, false)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	stats, err := bundle.NewChunkCache(opts.cacheDir).Stats()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Entries: %d\n", stats.Entries)
+	fmt.Printf("Size: %d bytes\n", stats.Size)
+	fmt.Printf("Hit rate: %.1f%% (%d hits, %d misses)\n", stats.HitRate()*100, stats.Hits, stats.Misses)
+	return 0
+}
+
+// runBundleCachePrune removes chunks unused for longer than --max-age (bundle cache-prune).
+func runBundleCachePrune(args []string) int {
+	var opts bundleCacheOptions
+	fs := flag.NewFlagSet("bundle cache-prune", flag.ContinueOnError)
+	opts.bind(fs, true)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	removed, freed, err := bundle.NewChunkCache(opts.cacheDir).Prune(opts.maxAge)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Removed %d chunks (%d bytes)\n", removed, freed)
+	return 0
+}
@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+type bundleDiffOptions struct {
+	format  string
+	json    bool
+	summary bool
+}
+
+func (o *bundleDiffOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.format, "format", "text", "Output format: text or json")
+	fs.BoolVar(&o.json, "json", false, "Same as --format json")
+	fs.BoolVar(&o.summary, "summary", false, "Print only the counts of added, removed and modified files and the size change")
+}
+
+// runBundleDiff compares two sites (bundle diff): with one path, the bundled
+// site and that directory; with two, each a bundled binary, a ZIP file or a
+// site directory. Like diff(1), it exits 0 when they match, 1 when they
+// differ and 2 on error.
+func runBundleDiff(args []string) int {
+	var opts bundleDiffOptions
+	fs := flag.NewFlagSet("bundle diff", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if opts.json {
+		opts.format = "json"
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 || (opts.format != "text" && opts.format != "json") {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine bundle diff [--summary] [--format text|json] <dir>")
+		fmt.Fprintln(os.Stderr, "       ui-engine bundle diff [--summary] [--format text|json] <binary-or-zip> <binary-zip-or-dir>")
+		return 2
+	}
+
+	var report *bundle.DiffReport
+	var err error
+	oldName, newName := "bundle", fs.Arg(0)
+	if fs.NArg() == 1 {
+		if info, statErr := os.Stat(newName); statErr != nil || !info.IsDir() {
+			fmt.Fprintf(os.Stderr, "Error: directory %s does not exist\n", newName)
+			return 2
+		}
+		report, err = bundle.Diff(newName)
+	} else {
+		oldName, newName = fs.Arg(0), fs.Arg(1)
+		report, err = bundle.DiffPaths(oldName, newName)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to compare bundle: %v\n", err)
+		return 2
+	}
+
+	switch {
+	case opts.format == "json" && opts.summary:
+		printJSON(report.Summary())
+	case opts.format == "json":
+		printJSON(report)
+	case opts.summary:
+		s := report.Summary()
+		fmt.Printf("%d added, %d removed, %d modified, %+d bytes\n", s.Added, s.Removed, s.Modified, s.SizeDelta)
+	case !report.Empty():
+		fmt.Printf("--- %s\n", oldName)
+		fmt.Printf("+++ %s\n", newName)
+		for _, file := range report.Removed {
+			fmt.Printf("-%s (%d bytes)\n", file.Name, file.OldSize)
+		}
+		for _, file := range report.Added {
+			fmt.Printf("+%s (%d bytes)\n", file.Name, file.NewSize)
+		}
+		for _, file := range report.Modified {
+			fmt.Printf("~%s (%d -> %d bytes, %+d)\n", file.Name, file.OldSize, file.NewSize, file.SizeDelta())
+		}
+	}
+	if !report.Empty() {
+		return 1
+	}
+	return 0
+}
+
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
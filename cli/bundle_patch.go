@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+type bundlePatchOptions struct {
+	output string
+	source string
+	dir    string
+	add    bool
+}
+
+func (o *bundlePatchOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "Output path for the patched binary (required)")
+	fs.StringVar(&o.source, "src", "", "Bundled binary to patch (default: current executable)")
+	fs.StringVar(&o.dir, "dir", ".", "Site directory the changed files are relative to")
+	fs.BoolVar(&o.add, "add", false, "Allow files that are not in the bundle yet")
+}
+
+// runBundlePatch replaces changed files in a bundled binary (bundle patch)
+// without rebuilding the rest of the bundle.
+func runBundlePatch(args []string) int {
+	var opts bundlePatchOptions
+	fs := flag.NewFlagSet("bundle patch", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.output == "" || fs.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine bundle patch [-src <binary>] [--dir <site-dir>] [--add] -o <output> <changed-files...>")
+		return 1
+	}
+
+	return patchBundle(opts.source, opts.output, opts.dir, fs.Args(), opts.add)
+}
+
+// patchBundle patches the bundle of sourcePath (the current executable when
+// empty) and prints which files it replaced and added.
+func patchBundle(sourcePath, output, dir string, files []string, add bool) int {
+	if sourcePath == "" {
+		var err error
+		sourcePath, err = os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to get executable path: %v\n", err)
+			return 1
+		}
+	}
+
+	report, err := bundle.PatchBundle(sourcePath, output, dir, files, add)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to patch bundle: %v\n", err)
+		return 1
+	}
+	for _, name := range report.Replaced {
+		fmt.Printf("Replaced %s\n", name)
+	}
+	for _, name := range report.Added {
+		fmt.Printf("Added %s\n", name)
+	}
+	fmt.Printf("Created patched binary: %s\n", output)
+	return 0
+}
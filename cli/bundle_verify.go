@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+// runBundleVerify checks a binary's bundle against its manifest (verify, bundle
+// verify), printing PASS or FAIL for each file. Without a binary it checks this one.
+func runBundleVerify(args []string) int {
+	if len(args) > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine verify [binary]")
+		return 1
+	}
+	binary := ""
+	if len(args) == 1 {
+		binary = args[0]
+	}
+	checks, err := bundle.VerifyFiles(binary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	failed := 0
+	for _, check := range checks {
+		if check.Passed() {
+			fmt.Printf("PASS  %s\n", check.Name)
+		} else {
+			failed++
+			fmt.Printf("FAIL  %s (%s)\n", check.Name, check.Problem)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("%d of %d files failed\n", failed, len(checks))
+		return 1
+	}
+	fmt.Printf("Bundle verified: %d files\n", len(checks))
+	return 0
+}
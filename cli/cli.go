@@ -5,6 +5,8 @@ package cli
 import (
 	"fmt"
 	"os"
+
+	"github.com/zot/ui-engine/internal/config"
 )
 
 // Hooks allows extending the CLI with additional commands.
@@ -42,22 +44,18 @@ func RunWithHooks(args []string, hooks *Hooks) int {
 		}
 	}
 
+	if cmd := lookupCommand(command); cmd != nil {
+		return cmd.run(cmdArgs)
+	}
+
 	switch command {
-	case "serve":
-		return runServe(cmdArgs)
-	case "bundle":
-		return runBundle(cmdArgs)
-	case "extract":
-		return runExtract(cmdArgs)
-	case "ls":
-		return runLs(cmdArgs)
-	case "cat":
-		return runCat(cmdArgs)
-	case "cp":
-		return runCp(cmdArgs)
-	case "create", "destroy", "update", "watch", "unwatch", "get", "getObjects", "poll":
-		return runProtocolCommand(command, cmdArgs)
+	case completeCommand:
+		return runComplete(cmdArgs)
 	case "help", "-h", "--help":
+		if len(cmdArgs) > 0 && cmdArgs[0] == "logging" {
+			printLoggingHelp()
+			return 0
+		}
 		printHelp(hooks)
 		return 0
 	case "version", "-v", "--version":
@@ -75,43 +73,31 @@ func RunWithHooks(args []string, hooks *Hooks) int {
 }
 
 func printHelp(hooks *Hooks) {
-	fmt.Println(`UI Engine Server
+	fmt.Print(`UI Engine Server
 
 Usage: ui-engine [command] [options]
 
-Server Commands:
-  serve           Start the UI server (default)
-
-Site Management:
-  bundle          Create binary with custom site bundled
-  extract         Extract bundled site to filesystem
-  ls              List files in bundled site
-  cat             Display contents of a bundled file
-  cp              Copy files from bundled site
-
-Protocol Commands:
-  create          Create a new variable
-  destroy         Destroy a variable
-  update          Update a variable
-  watch           Watch a variable
-  unwatch         Stop watching a variable
-  get             Get variable values
-  getObjects      Get object values
-  poll            Poll for pending responses
-
-Server Options:
+`)
+	printCommands(os.Stdout)
+	fmt.Println(`Server Options:
   --host          Browser listen address (default: 0.0.0.0)
   --port          Browser listen port (default: 8080)
   --socket        Backend API socket path
+  --metrics       Record handler timing, served at /metrics
   --lua           Enable Lua backend (default: true)
   --lua-path      Lua scripts directory
   --session-timeout    Session expiration (default: 24h, 0=never)
-  --log-level     Log level: debug, info, warn, error
+  --log-level     Log level, or component verbosities (see: ui-engine help logging)
+  --log-max-value Max bytes of a logged value (default: 512, 0=unlimited)
+  --log-redact    Comma-separated property names/paths to redact in logs
   --dir           Serve from directory instead of embedded site
+  --demo          Serve the built-in demo when there is no bundle or --dir: on or off (default: on)
 
 Site Management Examples:
   ui-engine bundle site/ -o my-app        Create bundled binary
   ui-engine extract extracted/            Extract bundled site
+  ui-engine extract --include 'lua/*' x/  Extract part of the bundled site (re-run to resume)
+  ui-engine extract --demo myapp/         Extract the demo site as a starter template
   ui-engine ls                            List bundled files
   ui-engine cat index.html                Show file contents
   ui-engine cp '*.js' lib/                Copy matching files
@@ -119,18 +105,49 @@ Site Management Examples:
 Server Examples:
   ui-engine serve --port 8080
   ui-engine serve --dir my-site/
+  ui-engine status --verbose --url http://127.0.0.1:8080
+  ui-engine sessions --group wall1 --destroy
+  ui-engine viewdefs ls --stats
+  source <(ui-engine completion bash)
 
 Protocol Examples:
   ui-engine create --parent 1 --value '{"name": "Alice"}' --props 'type=Person'
   ui-engine update --id 5 --value '{"name": "Bob"}'
+  ui-engine update --id 5 --remove-prop inactive
+  ui-engine update --strict --id 5 --props label=Hi
+  ui-engine update --session 1 --id 5 --value '"Bob"'
   ui-engine get 1 2 3
-  ui-engine poll --wait 30s`)
+  ui-engine poll --wait 30s --max-wait 10m
+  ui-engine flush 1
+  ui-engine getRoots 1`)
 
 	if hooks != nil && hooks.CustomHelp != nil {
 		fmt.Println(hooks.CustomHelp())
 	}
 }
 
+func printLoggingHelp() {
+	fmt.Print(`Logging
+
+Verbosity (-v to -vvvv, UI_VERBOSITY, logging.verbosity):
+  0  errors and warnings
+  1  connections and hot loading
+  2  messages
+  3  variables
+  4  values
+
+Components can have their own verbosity; the rest use the global one:
+  --log-level protocol=2,viewdef=4,lua=1,server=1
+  UI_LOG_LEVEL=viewdef=4
+  [logging.components] in config.toml, e.g. viewdef = 4
+
+Components:
+`)
+	for _, c := range config.LogComponents {
+		fmt.Printf("  %-9s %s\n", c.Name, c.Summary)
+	}
+}
+
 func printVersion(hooks *Hooks) {
 	fmt.Println("UI Engine v0.1.0")
 	if hooks != nil && hooks.CustomVersion != nil {
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// valueKind says how a flag value or positional argument is completed.
+// Files and directories are completed by the shell; other kinds are answered
+// at completion time by the hidden "__complete <kind>" command.
+type valueKind string
+
+const (
+	noValue         valueKind = ""
+	fileValue       valueKind = "file"
+	dirValue        valueKind = "dir"
+	sessionValue    valueKind = "session"     // live session IDs
+	groupValue      valueKind = "group"       // live session group names
+	bundleFileValue valueKind = "bundle-file" // files in the bundled site
+	shellValue      valueKind = "shell"       // completion shells
+)
+
+// command describes one subcommand: dispatch, help and shell completion all
+// read it, so a command is added in one place.
+type command struct {
+	name    string
+	section string
+	summary string
+	// flags defines the command's flags on fs; the command's run parses with the
+	// same definitions, so completion always matches what is accepted.
+	flags  func(fs *flag.FlagSet)
+	values map[string]valueKind // flag name -> how its value completes
+	args   []valueKind          // positional arguments; the last one repeats
+	run    func(args []string) int
+}
+
+// Help sections, in display order
+const (
+	serverSection   = "Server Commands"
+	siteSection     = "Site Management"
+	protocolSection = "Protocol Commands"
+	shellSection    = "Shell Integration"
+)
+
+var helpSections = []string{serverSection, siteSection, protocolSection, shellSection}
+
+// commands lists every subcommand. It is filled in init to break the
+// initialization cycle with runCompletion, which reads it.
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "serve", section: serverSection, summary: "Start the UI server (default)",
+			flags:  config.DefineFlags,
+			values: map[string]valueKind{"dir": dirValue, "lua-path": dirValue, "socket": fileValue},
+			run:    runServe},
+		{name: "status", section: serverSection, summary: "Show handler metrics of a running server",
+			flags: (&statusOptions{}).bind, run: runStatus},
+		{name: "doctor", section: serverSection, summary: "Check a running server (--live) or site Lua code (--lint)",
+			flags: (&doctorOptions{}).bind, values: map[string]valueKind{"lint": dirValue}, run: runDoctor},
+		{name: "sessions", section: serverSection, summary: "List a running server's sessions and groups (--group, --destroy, --routes)",
+			flags: (&sessionsOptions{}).bind, values: map[string]valueKind{"group": groupValue}, run: runSessions},
+		{name: "drain-session", section: serverSection, summary: "Show a banner in a session, then end it after --grace",
+			flags: (&drainOptions{}).bind, args: []valueKind{sessionValue}, run: runDrainSession},
+		{name: "gc", section: serverSection, summary: "Collect a session's unreachable objects and show before/after counts",
+			flags: (&gcOptions{}).bind, values: map[string]valueKind{"session": sessionValue}, run: runGC},
+		{name: "viewdefs", section: serverSection, summary: "List a running server's viewdefs (ls [--stats [--since]])",
+			flags: (&viewdefsOptions{}).bind, run: runViewdefs},
+		{name: "headless", section: serverSection, summary: "Run a Lua script in a session with no frontend and print or check its state (run [--assert-state])",
+			flags:  (&headlessOptions{}).bind,
+			values: map[string]valueKind{"dir": dirValue, "assert-state": fileValue, "o": fileValue},
+			args:   []valueKind{fileValue}, run: runHeadless},
+		{name: "bench", section: serverSection, summary: "Load test a running server over WebSockets",
+			flags: (&benchOptions{}).bind, run: runBench},
+
+		{name: "bundle", section: siteSection, summary: "Create binary with custom site bundled (diff [old] <new> compares, patch <files> replaces, verify [binary] checks, cache-stats/cache-prune manage the chunk cache)",
+			flags:  (&bundleOptions{}).bind,
+			values: map[string]valueKind{"o": fileValue, "src": fileValue, "cache-dir": dirValue},
+			args:   []valueKind{dirValue}, run: runBundle},
+		{name: "extract", section: siteSection, summary: "Extract bundled site (or --demo) to filesystem",
+			flags: (&extractOptions{}).bind, args: []valueKind{dirValue}, run: runExtract},
+		{name: "ls", section: siteSection, summary: "List files in bundled site", run: runLs},
+		{name: "cat", section: siteSection, summary: "Display contents of a bundled file",
+			args: []valueKind{bundleFileValue}, run: runCat},
+		{name: "cp", section: siteSection, summary: "Copy files from bundled site",
+			args: []valueKind{bundleFileValue, dirValue}, run: runCp},
+		{name: "verify", section: siteSection, summary: "Check a bundled binary (this one by default) against its manifest, file by file",
+			args: []valueKind{fileValue}, run: runBundleVerify},
+		{name: "rm", section: siteSection, summary: "Remove files from bundled site (in place, or to -o)",
+			flags:  (&rmOptions{}).bind,
+			values: map[string]valueKind{"o": fileValue, "src": fileValue},
+			args:   []valueKind{bundleFileValue}, run: runRm},
+
+		protocolCommand("create", "Create a new variable", nil),
+		protocolCommand("destroy", "Destroy a variable", nil),
+		protocolCommand("update", "Update a variable", nil),
+		protocolCommand("watch", "Watch a variable", nil),
+		protocolCommand("unwatch", "Stop watching a variable", nil),
+		protocolCommand("get", "Get variable values", nil),
+		protocolCommand("getObjects", "Get object values", nil),
+		protocolCommand("poll", "Poll for pending responses", nil),
+		protocolCommand("flush", "Wait until a session's queued work and updates settle", []valueKind{sessionValue}),
+		protocolCommand("getRoots", "List a session's named root variables", []valueKind{sessionValue}),
+		{name: "trace", section: protocolSection, summary: "Log one session's messages in full for a while (--session, --on/--off, --duration, --file)",
+			flags:  (&protocolOptions{}).binder("trace"),
+			values: map[string]valueKind{"socket": fileValue, "session": sessionValue},
+			run:    func(args []string) int { return runProtocolCommand("trace", args) }},
+		{name: "batch", section: protocolSection, summary: "Send newline-delimited messages over one connection (--fail-fast)",
+			flags:  (&batchOptions{}).bind,
+			values: map[string]valueKind{"socket": fileValue},
+			args:   []valueKind{fileValue}, run: runBatch},
+		{name: "gen-test", section: protocolSection, summary: "Convert a recorded session (NDJSON) into a Go test",
+			flags:  (&genTestOptions{}).bind,
+			values: map[string]valueKind{"o": fileValue, "site": dirValue},
+			args:   []valueKind{fileValue}, run: runGenTest},
+
+		{name: "completion", section: shellSection, summary: "Print a shell completion script (bash, zsh or fish)",
+			args: []valueKind{shellValue}, run: runCompletion},
+	}
+}
+
+// protocolCommand describes a command that sends one protocol message over the socket.
+func protocolCommand(name, summary string, args []valueKind) *command {
+	return &command{
+		name:    name,
+		section: protocolSection,
+		summary: summary,
+		flags:   (&protocolOptions{}).binder(name),
+		values:  map[string]valueKind{"socket": fileValue},
+		args:    args,
+		run:     func(args []string) int { return runProtocolCommand(name, args) },
+	}
+}
+
+// lookupCommand finds a subcommand by name.
+func lookupCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// flagSet returns the command's flags, for introspection.
+func (c *command) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	if c.flags != nil {
+		c.flags(fs)
+	}
+	return fs
+}
+
+// argKind returns how positional argument i completes.
+func (c *command) argKind(i int) valueKind {
+	if len(c.args) == 0 {
+		return noValue
+	}
+	return c.args[min(i, len(c.args)-1)]
+}
+
+// printCommands writes the command list of the help text, grouped by section.
+func printCommands(w io.Writer) {
+	for _, section := range helpSections {
+		fmt.Fprintf(w, "%s:\n", section)
+		for _, cmd := range commands {
+			if cmd.section == section {
+				fmt.Fprintf(w, "  %-15s %s\n", cmd.name, cmd.summary)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// isBoolFlag reports whether a flag takes no value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// dashed returns a flag as typed: "-o" for one-letter flags, "--name" otherwise.
+func dashed(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// flagNames returns each of the command's flags as typed, sorted.
+func (c *command) flagNames() []string {
+	var names []string
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		names = append(names, dashed(f.Name))
+	})
+	return names
+}
+
+// valueFlags returns the names of the command's flags that take a value, sorted.
+func (c *command) valueFlags() []string {
+	var names []string
+	c.flagSet().VisitAll(func(f *flag.Flag) {
+		if !isBoolFlag(f) {
+			names = append(names, f.Name)
+		}
+	})
+	return names
+}
+
+// describe returns a flag's usage text on one line.
+func describe(usage string) string {
+	return strings.Join(strings.Fields(usage), " ")
+}
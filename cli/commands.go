@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"bytes"
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -13,10 +15,12 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/demo"
 	"github.com/zot/ui-engine/internal/protocol"
 	"github.com/zot/ui-engine/internal/server"
 )
@@ -31,16 +35,30 @@ func runServe(args []string) int {
 	// Ensure logs always go to Stderr to keep Stdout clean for protocol data
 	log.SetOutput(os.Stderr)
 
+	for _, problem := range cfg.Validate() {
+		log.Printf("Config %s", problem)
+	}
+
+	if cfg.Server.VerifyBundle {
+		if err := bundle.Verify(); err != nil {
+			log.Printf("Refusing to start: %v", err)
+			return 1
+		}
+	}
+
 	srv := server.New(cfg)
+	defer srv.RecoverCrash("main")
 
 	// Start cleanup worker
 	srv.StartCleanupWorker(time.Hour)
+	srv.StartObjectCollector()
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
+		defer srv.RecoverCrash("shutdown")
 		<-sigChan
 		log.Println("Shutting down...")
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -49,6 +67,18 @@ func runServe(args []string) int {
 		os.Exit(0)
 	}()
 
+	// Reload the bundle on SIGHUP, after a new site was bundled over this binary
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		defer srv.RecoverCrash("bundle reload")
+		for range hupChan {
+			if _, err := srv.ReloadBundle(); err != nil {
+				log.Printf("Bundle reload failed: %v", err)
+			}
+		}
+	}()
+
 	// Start server
 	if err := srv.Start(); err != nil {
 		log.Printf("Server error: %v", err)
@@ -60,52 +90,214 @@ func runServe(args []string) int {
 // Global socket path for protocol commands
 var socketPath string
 
-func runProtocolCommand(command string, args []string) int {
-	// Parse --socket flag from args
-	fs := flag.NewFlagSet(command, flag.ContinueOnError)
-	socket := fs.String("socket", defaultSocketPath(), "Server socket path")
-
-	// Parse known flags, leaving positional args
-	var filteredArgs []string
-	for i := 0; i < len(args); i++ {
-		if args[i] == "--socket" && i+1 < len(args) {
-			socketPath = args[i+1]
-			i++ // skip next arg
-		} else {
-			filteredArgs = append(filteredArgs, args[i])
+// protocolOptions holds the flags of the protocol commands; each command binds
+// the ones it uses.
+type protocolOptions struct {
+	socket      string
+	id          int64
+	parent      int64
+	value       string
+	valueFile   string
+	props       string
+	propsFile   string
+	remove      propNames
+	nowatch     bool
+	unbound     bool
+	wait        string
+	maxWait     string
+	maxMessages int
+	maxBytes    int
+	strict      bool
+	follow      bool
+	timeout     time.Duration
+	session     string
+	on          bool
+	off         bool
+	duration    time.Duration
+	traceFile   bool
+}
+
+// binder returns the flag definitions of a protocol command.
+func (o *protocolOptions) binder(command string) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.StringVar(&o.socket, "socket", defaultSocketPath(), "Server socket path")
+		fs.BoolVar(&o.strict, "strict", false, "Check the message strictly, even if the server is not strict")
+		switch command {
+		case "create":
+			fs.Int64Var(&o.parent, "parent", 0, "Parent variable ID")
+			fs.StringVar(&o.value, "value", "", "Initial value (JSON, or - to read stdin)")
+			fs.StringVar(&o.valueFile, "value-file", "", "File holding the initial value (JSON)")
+			fs.StringVar(&o.props, "props", "", "Properties (JSON object or key=value,...)")
+			fs.StringVar(&o.propsFile, "props-file", "", "File holding the properties (JSON object)")
+			fs.BoolVar(&o.nowatch, "nowatch", false, "Do not watch the new variable")
+			fs.BoolVar(&o.unbound, "unbound", false, "Store the variable in the UI server only")
+		case "update":
+			fs.Int64Var(&o.id, "id", 0, "Variable ID")
+			fs.StringVar(&o.value, "value", "", "New value (JSON, or - to read stdin)")
+			fs.StringVar(&o.valueFile, "value-file", "", "File holding the new value (JSON)")
+			fs.StringVar(&o.props, "props", "", "Properties (JSON object or key=value,...)")
+			fs.StringVar(&o.propsFile, "props-file", "", "File holding the properties (JSON object)")
+			fs.Var(&o.remove, "remove-prop", "Property to remove (repeatable)")
+			fs.StringVar(&o.session, "session", "", "Session to update (vended ID), for Lua-bound variables")
+		case "destroy", "watch", "unwatch":
+			fs.Int64Var(&o.id, "id", 0, "Variable ID (or pass it as an argument)")
+			if command == "watch" {
+				fs.BoolVar(&o.follow, "follow", false, "Keep the connection open and print each message as a JSON line")
+				fs.DurationVar(&o.timeout, "timeout", 0, "Stop following after this long (0 = until interrupted)")
+			}
+		case "trace":
+			fs.StringVar(&o.session, "session", "", "Session to trace (vended ID)")
+			fs.BoolVar(&o.on, "on", false, "Start tracing")
+			fs.BoolVar(&o.off, "off", false, "Stop tracing")
+			fs.DurationVar(&o.duration, "duration", protocol.DefaultTraceDuration, "Stop tracing after this long")
+			fs.BoolVar(&o.traceFile, "file", false, "Also write the trace to a file under logging.trace_dir")
+		case "poll":
+			fs.StringVar(&o.wait, "wait", "", "Long-poll duration")
+			fs.StringVar(&o.maxWait, "max-wait", "", "Longest wait the client accepts as a hint")
+			fs.IntVar(&o.maxMessages, "max-messages", 0, "Most messages to return (0=server default)")
+			fs.IntVar(&o.maxBytes, "max-bytes", 0, "Most message bytes to return (0=server default)")
 		}
 	}
-	if socketPath == "" {
-		socketPath = *socket
+}
+
+// propNames implements flag.Value for a repeated flag (property names, include globs).
+type propNames []string
+
+func (p *propNames) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *propNames) Set(name string) error {
+	*p = append(*p, name)
+	return nil
+}
+
+// properties parses --props as a JSON object, falling back to key=value pairs,
+// or reads --props-file as a JSON object.
+func (o *protocolOptions) properties() (map[string]string, error) {
+	if o.propsFile != "" {
+		if o.props != "" {
+			return nil, fmt.Errorf("use either --props or --props-file")
+		}
+		data, err := os.ReadFile(o.propsFile)
+		if err != nil {
+			return nil, err
+		}
+		var props map[string]string
+		if err := json.Unmarshal(data, &props); err != nil {
+			return nil, fmt.Errorf("--props-file %s: %w", o.propsFile, jsonError(err))
+		}
+		return props, nil
+	}
+	if o.props == "" {
+		return nil, nil
+	}
+	var props map[string]string
+	if err := json.Unmarshal([]byte(o.props), &props); err != nil {
+		props = parseKeyValueProps(o.props)
+	}
+	return props, nil
+}
+
+// valueJSON returns the value from --value, stdin (--value -) or --value-file,
+// or nil if none is given. It must be valid JSON.
+func (o *protocolOptions) valueJSON(stdin io.Reader) (json.RawMessage, error) {
+	var data []byte
+	var source string
+	switch {
+	case o.valueFile != "" && o.value != "":
+		return nil, fmt.Errorf("use either --value or --value-file")
+	case o.valueFile != "":
+		var err error
+		if data, err = os.ReadFile(o.valueFile); err != nil {
+			return nil, err
+		}
+		source = "--value-file " + o.valueFile
+	case o.value == "-":
+		var err error
+		if data, err = io.ReadAll(stdin); err != nil {
+			return nil, fmt.Errorf("failed to read stdin: %w", err)
+		}
+		source = "stdin"
+	case o.value != "":
+		data, source = []byte(o.value), "--value"
+	default:
+		return nil, nil
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("%s: %w", source, jsonError(err))
+	}
+	return json.RawMessage(bytes.TrimSpace(data)), nil
+}
+
+// jsonError adds the byte offset of a JSON parse failure to its message.
+func jsonError(err error) error {
+	var syntax *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntax):
+		return fmt.Errorf("invalid JSON at byte %d: %w", syntax.Offset, err)
+	case errors.As(err, &typeErr):
+		return fmt.Errorf("invalid JSON at byte %d: %w", typeErr.Offset, err)
+	}
+	return fmt.Errorf("invalid JSON: %w", err)
+}
+
+// varID returns --id, or the first argument when --id is not given.
+func (o *protocolOptions) varID(args []string) int64 {
+	if o.id == 0 && len(args) > 0 {
+		fmt.Sscanf(args[0], "%d", &o.id)
+	}
+	return o.id
+}
+
+func runProtocolCommand(command string, args []string) int {
+	var opts protocolOptions
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	opts.binder(command)(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
 	}
-	args = filteredArgs
+	socketPath = opts.socket
+	args = fs.Args()
 
 	var msg *protocol.Message
 	var err error
 
 	switch command {
 	case "create":
-		msg, err = buildCreateMessage(args)
+		msg, err = buildCreateMessage(&opts)
 	case "destroy":
-		msg, err = buildDestroyMessage(args)
+		msg, err = buildDestroyMessage(&opts, args)
 	case "update":
-		msg, err = buildUpdateMessage(args)
+		msg, err = buildUpdateMessage(&opts)
 	case "watch":
-		msg, err = buildWatchMessage(args)
+		msg, err = buildWatchMessage(&opts, args)
 	case "unwatch":
-		msg, err = buildUnwatchMessage(args)
+		msg, err = buildUnwatchMessage(&opts, args)
 	case "get":
 		msg, err = buildGetMessage(args)
 	case "getObjects":
 		msg, err = buildGetObjectsMessage(args)
 	case "poll":
-		msg, err = buildPollMessage(args)
+		msg, err = buildPollMessage(&opts)
+	case "flush":
+		msg, err = buildFlushMessage(args)
+	case "getRoots":
+		msg, err = buildGetRootsMessage(args)
+	case "trace":
+		msg, err = buildTraceMessage(&opts, args)
 	}
 
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		return 1
 	}
+	msg.Strict = opts.strict
+	if opts.follow {
+		return followWatch(msg, opts.timeout)
+	}
 
 	// Send to server and print response
 	resp, err := sendToServer(msg)
@@ -127,120 +319,59 @@ func defaultSocketPath() string {
 	return "/tmp/ui.sock"
 }
 
-func buildCreateMessage(args []string) (*protocol.Message, error) {
-	// Parse --parent, --value, --props, --nowatch, --unbound flags
-	var parentID int64
-	var value json.RawMessage
-	var props map[string]string
-	var nowatch, unbound bool
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--parent":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--parent requires a value")
-			}
-			i++
-			fmt.Sscanf(args[i], "%d", &parentID)
-		case "--value":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--value requires a value")
-			}
-			i++
-			value = json.RawMessage(args[i])
-		case "--props":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--props requires a value")
-			}
-			i++
-			if err := json.Unmarshal([]byte(args[i]), &props); err != nil {
-				// Try key=value format
-				props = parseKeyValueProps(args[i])
-			}
-		case "--nowatch":
-			nowatch = true
-		case "--unbound":
-			unbound = true
-		}
+func buildCreateMessage(opts *protocolOptions) (*protocol.Message, error) {
+	value, err := opts.valueJSON(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	props, err := opts.properties()
+	if err != nil {
+		return nil, err
 	}
-
 	return protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{
-		ParentID:   parentID,
+		ParentID:   opts.parent,
 		Value:      value,
 		Properties: props,
-		NoWatch:    nowatch,
-		Unbound:    unbound,
+		NoWatch:    opts.nowatch,
+		Unbound:    opts.unbound,
 	})
 }
 
-func buildDestroyMessage(args []string) (*protocol.Message, error) {
-	if len(args) < 1 {
+func buildDestroyMessage(opts *protocolOptions, args []string) (*protocol.Message, error) {
+	varID := opts.varID(args)
+	if varID == 0 {
 		return nil, fmt.Errorf("destroy requires a variable ID")
 	}
 
-	var varID int64
-	if args[0] == "--id" && len(args) > 1 {
-		fmt.Sscanf(args[1], "%d", &varID)
-	} else {
-		fmt.Sscanf(args[0], "%d", &varID)
-	}
-
 	return protocol.NewMessage(protocol.MsgDestroy, protocol.DestroyMessage{
 		VarID: varID,
 	})
 }
 
-func buildUpdateMessage(args []string) (*protocol.Message, error) {
-	var varID int64
-	var value json.RawMessage
-	var props map[string]string
-
-	for i := 0; i < len(args); i++ {
-		switch args[i] {
-		case "--id":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--id requires a value")
-			}
-			i++
-			fmt.Sscanf(args[i], "%d", &varID)
-		case "--value":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--value requires a value")
-			}
-			i++
-			value = json.RawMessage(args[i])
-		case "--props":
-			if i+1 >= len(args) {
-				return nil, fmt.Errorf("--props requires a value")
-			}
-			i++
-			if err := json.Unmarshal([]byte(args[i]), &props); err != nil {
-				props = parseKeyValueProps(args[i])
-			}
-		}
-	}
-
-	if varID == 0 {
+func buildUpdateMessage(opts *protocolOptions) (*protocol.Message, error) {
+	if opts.id == 0 {
 		return nil, fmt.Errorf("--id is required")
 	}
 
+	value, err := opts.valueJSON(os.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	props, err := opts.properties()
+	if err != nil {
+		return nil, err
+	}
 	return protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{
-		VarID:      varID,
-		Value:      value,
-		Properties: props,
+		Session:          opts.session,
+		VarID:            opts.id,
+		Value:            value,
+		Properties:       props,
+		RemoveProperties: opts.remove,
 	})
 }
 
-func buildWatchMessage(args []string) (*protocol.Message, error) {
-	var varID int64
-	if len(args) > 0 {
-		if args[0] == "--id" && len(args) > 1 {
-			fmt.Sscanf(args[1], "%d", &varID)
-		} else {
-			fmt.Sscanf(args[0], "%d", &varID)
-		}
-	}
-
+func buildWatchMessage(opts *protocolOptions, args []string) (*protocol.Message, error) {
+	varID := opts.varID(args)
 	if varID == 0 {
 		return nil, fmt.Errorf("variable ID is required")
 	}
@@ -250,16 +381,8 @@ func buildWatchMessage(args []string) (*protocol.Message, error) {
 	})
 }
 
-func buildUnwatchMessage(args []string) (*protocol.Message, error) {
-	var varID int64
-	if len(args) > 0 {
-		if args[0] == "--id" && len(args) > 1 {
-			fmt.Sscanf(args[1], "%d", &varID)
-		} else {
-			fmt.Sscanf(args[0], "%d", &varID)
-		}
-	}
-
+func buildUnwatchMessage(opts *protocolOptions, args []string) (*protocol.Message, error) {
+	varID := opts.varID(args)
 	if varID == 0 {
 		return nil, fmt.Errorf("variable ID is required")
 	}
@@ -307,17 +430,50 @@ func buildGetObjectsMessage(args []string) (*protocol.Message, error) {
 	})
 }
 
-func buildPollMessage(args []string) (*protocol.Message, error) {
-	var wait string
-	for i := 0; i < len(args); i++ {
-		if args[i] == "--wait" && i+1 < len(args) {
-			wait = args[i+1]
-			break
-		}
+func buildPollMessage(opts *protocolOptions) (*protocol.Message, error) {
+	return protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{
+		Wait:        opts.wait,
+		MaxWait:     opts.maxWait,
+		MaxMessages: opts.maxMessages,
+		MaxBytes:    opts.maxBytes,
+	})
+}
+
+func buildFlushMessage(args []string) (*protocol.Message, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("flush requires a session ID")
 	}
 
-	return protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{
-		Wait: wait,
+	return protocol.NewMessage(protocol.MsgFlush, protocol.FlushMessage{
+		Session: args[0],
+	})
+}
+
+func buildGetRootsMessage(args []string) (*protocol.Message, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("getRoots requires a session ID")
+	}
+
+	return protocol.NewMessage(protocol.MsgGetRoots, protocol.GetRootsMessage{
+		Session: args[0],
+	})
+}
+
+func buildTraceMessage(opts *protocolOptions, args []string) (*protocol.Message, error) {
+	if opts.session == "" && len(args) > 0 {
+		opts.session = args[0]
+	}
+	if opts.session == "" {
+		return nil, fmt.Errorf("trace requires --session")
+	}
+	if opts.on == opts.off {
+		return nil, fmt.Errorf("trace requires --on or --off")
+	}
+	return protocol.NewMessage(protocol.MsgTrace, protocol.TraceMessage{
+		Session:  opts.session,
+		On:       opts.on,
+		Duration: opts.duration.String(),
+		File:     opts.traceFile,
 	})
 }
 
@@ -366,7 +522,16 @@ func splitProps(s string) []string {
 }
 
 func sendToServer(msg *protocol.Message) (*protocol.Response, error) {
-	// Connect to the backend socket using packet protocol
+	conn, err := dialServer()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return exchange(conn, msg)
+}
+
+// dialServer connects to the backend socket using packet protocol.
+func dialServer() (net.Conn, error) {
 	var conn net.Conn
 	var err error
 
@@ -380,7 +545,17 @@ func sendToServer(msg *protocol.Message) (*protocol.Response, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to server at %s: %w", socketPath, err)
 	}
-	defer conn.Close()
+	return conn, nil
+}
+
+// exchange sends a message on an open connection and reads its response.
+func exchange(conn net.Conn, msg *protocol.Message) (*protocol.Response, error) {
+	// Identify the CLI in the server's connection list and session events
+	if host, err := os.Hostname(); err == nil {
+		msg.Client = "cli@" + host
+	} else {
+		msg.Client = "cli"
+	}
 
 	// Encode message
 	data, err := msg.Encode()
@@ -398,14 +573,8 @@ func sendToServer(msg *protocol.Message) (*protocol.Response, error) {
 		return nil, fmt.Errorf("failed to write message: %w", err)
 	}
 
-	// Read response with length prefix
-	if _, err := io.ReadFull(conn, lenBuf); err != nil {
-		return nil, fmt.Errorf("failed to read response length: %w", err)
-	}
-	respLen := binary.BigEndian.Uint32(lenBuf)
-
-	respData := make([]byte, respLen)
-	if _, err := io.ReadFull(conn, respData); err != nil {
+	respData, err := readPacket(conn)
+	if err != nil {
 		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
 
@@ -418,24 +587,124 @@ func sendToServer(msg *protocol.Message) (*protocol.Response, error) {
 	return &resp, nil
 }
 
+// readPacket reads one length-prefixed packet.
+func readPacket(r io.Reader) ([]byte, error) {
+	lenBuf := make([]byte, 4)
+	if _, err := io.ReadFull(r, lenBuf); err != nil {
+		return nil, err
+	}
+	data := make([]byte, binary.BigEndian.Uint32(lenBuf))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// followWatch sends a watch and keeps the connection open, printing the
+// response and each message the server sends as a JSON line. It returns 0
+// when timeout (if not 0) passes and 1 if the server closes the connection.
+func followWatch(msg *protocol.Message, timeout time.Duration) int {
+	conn, err := dialServer()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer conn.Close()
+	resp, err := exchange(conn, msg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	line, _ := json.Marshal(resp)
+	fmt.Println(string(line))
+	if resp.Error != "" {
+		return 1
+	}
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	}
+	for {
+		data, err := readPacket(conn)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return 0
+			}
+			fmt.Fprintln(os.Stderr, "Error: server closed the connection")
+			return 1
+		}
+		var compact bytes.Buffer
+		if json.Compact(&compact, data) != nil {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring malformed message: %q\n", data)
+			continue
+		}
+		fmt.Println(compact.String())
+	}
+}
+
 // Site management commands
 
+type bundleOptions struct {
+	output      string
+	source      string
+	strictLint  bool
+	add         bool
+	cacheDir    string
+	compression string
+	fingerprint bool
+}
+
+func (o *bundleOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "Output path for bundled binary (required)")
+	fs.StringVar(&o.source, "src", "", "Source binary to bundle (default: current executable)")
+	fs.BoolVar(&o.strictLint, "strict-lint", false, "Treat Lua lint warnings as errors")
+	fs.StringVar(&o.cacheDir, "cache-dir", bundle.DefaultChunkCacheDir, "Directory of compressed files reused across bundles (\"\" disables)")
+	fs.BoolVar(&o.add, "add", false, "Add or replace the given files (relative to the current directory) in the source's bundle")
+	fs.StringVar(&o.compression, "compression", "default", "Compression for text files: none, fast, default or best (images and fonts are stored)")
+	fs.BoolVar(&o.fingerprint, "fingerprint", false, "Rename html/ scripts, styles, images and fonts to include a content hash and rewrite references to them")
+}
+
 func runBundle(args []string) int {
+	if len(args) > 0 && args[0] == "diff" {
+		return runBundleDiff(args[1:])
+	}
+	if len(args) > 0 && args[0] == "patch" {
+		return runBundlePatch(args[1:])
+	}
+	if len(args) > 0 && args[0] == "verify" {
+		return runBundleVerify(args[1:])
+	}
+	if len(args) > 0 && args[0] == "cache-stats" {
+		return runBundleCacheStats(args[1:])
+	}
+	if len(args) > 0 && args[0] == "cache-prune" {
+		return runBundleCachePrune(args[1:])
+	}
+	var opts bundleOptions
 	fs := flag.NewFlagSet("bundle", flag.ExitOnError)
-	output := fs.String("o", "", "Output path for bundled binary (required)")
-	source := fs.String("src", "", "Source binary to bundle (default: current executable)")
+	opts.bind(fs)
 	fs.Parse(args)
 
-	if *output == "" {
+	if opts.output == "" {
 		fmt.Fprintln(os.Stderr, "Error: -o output path is required")
-		fmt.Fprintln(os.Stderr, "Usage: remote-ui bundle [-src <binary>] -o <output> <site-dir>")
+		fmt.Fprintln(os.Stderr, "Usage: remote-ui bundle [-src <binary>] [--strict-lint] [--fingerprint] -o <output> <site-dir>")
+		fmt.Fprintln(os.Stderr, "       remote-ui bundle [-src <binary>] --add -o <output> <files...>")
 		return 1
 	}
 
+	if opts.add {
+		if fs.NArg() == 0 {
+			fmt.Fprintln(os.Stderr, "Error: --add needs the files to add")
+			return 1
+		}
+		return patchBundle(opts.source, opts.output, ".", fs.Args(), true)
+	}
+
 	siteDir := fs.Arg(0)
 	if siteDir == "" {
 		fmt.Fprintln(os.Stderr, "Error: site directory is required")
-		fmt.Fprintln(os.Stderr, "Usage: remote-ui bundle [-src <binary>] -o <output> <site-dir>")
+		fmt.Fprintln(os.Stderr, "Usage: remote-ui bundle [-src <binary>] [--strict-lint] [--fingerprint] -o <output> <site-dir>")
+		fmt.Fprintln(os.Stderr, "       remote-ui bundle [-src <binary>] --add -o <output> <files...>")
 		return 1
 	}
 
@@ -445,8 +714,13 @@ func runBundle(args []string) int {
 		return 1
 	}
 
+	if !lintSite(siteDir, opts.strictLint) {
+		fmt.Fprintln(os.Stderr, "Error: Lua lint failed, bundle not created")
+		return 1
+	}
+
 	// Get source binary path
-	sourcePath := *source
+	sourcePath := opts.source
 	if sourcePath == "" {
 		// Default to current executable
 		var err error
@@ -464,19 +738,58 @@ func runBundle(args []string) int {
 	}
 
 	// Create bundle
-	if err := bundle.CreateBundle(sourcePath, siteDir, *output); err != nil {
+	compression, err := bundle.ParseCompression(opts.compression)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var chunks *bundle.ChunkCache
+	if opts.cacheDir != "" {
+		chunks = bundle.NewChunkCache(opts.cacheDir)
+	}
+	if err := bundle.CreateBundleWithOptions(sourcePath, siteDir, opts.output, bundle.Options{Chunks: chunks, Compression: compression, Fingerprint: opts.fingerprint}); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to create bundle: %v\n", err)
 		return 1
 	}
+	if chunks != nil {
+		fmt.Printf("Reused %d of %d compressed files from %s\n", chunks.Hits(), chunks.Hits()+chunks.Misses(), opts.cacheDir)
+	}
 
-	fmt.Printf("Created bundled binary: %s\n", *output)
+	fmt.Printf("Created bundled binary: %s\n", opts.output)
 	return 0
 }
 
+type extractOptions struct {
+	demo    bool
+	force   bool
+	include propNames
+}
+
+func (o *extractOptions) bind(fs *flag.FlagSet) {
+	fs.BoolVar(&o.demo, "demo", false, "Extract the built-in demo site, a starter template for new sites")
+	fs.BoolVar(&o.force, "force", false, "Extract even if the disk looks too full")
+	fs.Var(&o.include, "include", "Extract only bundle paths matching this glob, or files under matching directories (repeatable)")
+}
+
 func runExtract(args []string) int {
+	var opts extractOptions
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
 	targetDir := "."
-	if len(args) > 0 {
-		targetDir = args[0]
+	if fs.NArg() > 0 {
+		targetDir = fs.Arg(0)
+	}
+
+	if opts.demo {
+		if err := demo.Extract(targetDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to extract demo site: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Extracted demo site to: %s\nRun it with: ui-engine serve --dir %s --hotload\n", targetDir, targetDir)
+		return 0
 	}
 
 	// Check if bundled
@@ -491,9 +804,32 @@ func runExtract(args []string) int {
 		return 1
 	}
 
-	// Extract
-	if err := bundle.ExtractBundle(targetDir); err != nil {
+	// Extract, with progress on stderr so stdout stays scriptable
+	lastPercent := -1
+	progress := func(p bundle.ExtractProgress) {
+		percent := 100
+		if p.TotalBytes > 0 {
+			percent = int(p.Bytes * 100 / p.TotalBytes)
+		}
+		if percent == lastPercent && p.Files < p.TotalFiles {
+			return
+		}
+		lastPercent = percent
+		fmt.Fprintf(os.Stderr, "\rExtracting: %d/%d files, %s/%s (%d%%)", p.Files, p.TotalFiles, formatBytes(p.Bytes), formatBytes(p.TotalBytes), percent)
+	}
+	err = bundle.ExtractBundleWithOptions(targetDir, bundle.ExtractOptions{Include: opts.include, Force: opts.force, Progress: progress})
+	if lastPercent >= 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+	var space *bundle.InsufficientSpaceError
+	if errors.As(err, &space) {
+		fmt.Fprintf(os.Stderr, "Error: not enough disk space in %s: need %s, %s available (use --force to extract anyway)\n", space.Dir, formatBytes(space.Need), formatBytes(space.Available))
+		return 1
+	} else if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: failed to extract bundle: %v\n", err)
+		if _, statErr := os.Stat(filepath.Join(targetDir, bundle.ExtractStateName)); statErr == nil {
+			fmt.Fprintln(os.Stderr, "Run extract again to resume")
+		}
 		return 1
 	}
 
@@ -501,6 +837,20 @@ func runExtract(args []string) int {
 	return 0
 }
 
+// formatBytes formats a byte count with a binary unit (e.g. "1.5 MiB").
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
 func runLs(args []string) int {
 	// Check if bundled
 	bundled, err := bundle.IsBundled()
@@ -561,6 +911,16 @@ func runCat(args []string) int {
 	return 0
 }
 
+// matchBundlePattern reports whether a bundle name matches a glob pattern,
+// against its basename first, then its full path (cp, rm).
+func matchBundlePattern(pattern, name string) bool {
+	if matched, _ := filepath.Match(pattern, filepath.Base(name)); matched {
+		return true
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
 func runCp(args []string) int {
 	if len(args) < 2 {
 		fmt.Fprintln(os.Stderr, "Error: source and destination are required")
@@ -592,12 +952,7 @@ func runCp(args []string) int {
 
 	copied := 0
 	for _, file := range files {
-		// Match against basename first, then full path
-		matched, _ := filepath.Match(pattern, filepath.Base(file.Name))
-		if !matched {
-			matched, _ = filepath.Match(pattern, file.Name)
-		}
-		if !matched {
+		if !matchBundlePattern(pattern, file.Name) {
 			continue
 		}
 
@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// fakeServer answers one packet on a unix socket with an empty response,
+// sends the given messages and then closes the connection unless hold is set.
+func fakeServer(t *testing.T, messages []string, hold bool) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	path := filepath.Join(dir, "ui.sock")
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := readPacket(conn); err != nil {
+			return
+		}
+		for _, msg := range append([]string{`{}`}, messages...) {
+			lenBuf := make([]byte, 4)
+			binary.BigEndian.PutUint32(lenBuf, uint32(len(msg)))
+			conn.Write(lenBuf)
+			conn.Write([]byte(msg))
+		}
+		if hold {
+			io.Copy(io.Discard, conn)
+		}
+	}()
+	return path
+}
+
+// captureStdout returns what fn prints to stdout.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	return string(out)
+}
+
+// TestFollowWatch verifies watch --follow prints each message as a JSON line,
+// fails when the server closes the connection and stops cleanly at --timeout
+func TestFollowWatch(t *testing.T) {
+	watch, _ := protocol.NewMessage(protocol.MsgWatch, protocol.WatchMessage{VarID: 1})
+
+	socketPath = fakeServer(t, []string{`{"type": "update", "data": {"varId": 1}}`, `{"type":"update","data":{"varId":1,"value":2}}`}, false)
+	var status int
+	out := captureStdout(t, func() { status = followWatch(watch, 0) })
+	if status != 1 {
+		t.Errorf("closed connection exited %d, want 1", status)
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 3 || lines[1] != `{"type":"update","data":{"varId":1}}` {
+		t.Errorf("printed %q, want the response and two compact messages", lines)
+	}
+
+	socketPath = fakeServer(t, []string{`{"type":"update","data":{"varId":1}}`}, true)
+	start := time.Now()
+	captureStdout(t, func() { status = followWatch(watch, 100*time.Millisecond) })
+	if status != 0 || time.Since(start) > 5*time.Second {
+		t.Errorf("timeout exited %d after %v, want 0 after the timeout", status, time.Since(start))
+	}
+}
+
+// TestValueSources verifies create and update values come from --value,
+// stdin or --value-file, and properties from --props-file, and that invalid
+// JSON is refused with its byte offset
+func TestValueSources(t *testing.T) {
+	dir := t.TempDir()
+	valueFile := filepath.Join(dir, "value.json")
+	os.WriteFile(valueFile, []byte(`{"name": "Alice"}`+"\n"), 0644)
+	badFile := filepath.Join(dir, "bad.json")
+	os.WriteFile(badFile, []byte(`{"name": "Alice",}`), 0644)
+	propsFile := filepath.Join(dir, "props.json")
+	os.WriteFile(propsFile, []byte(`{"type": "Person"}`), 0644)
+
+	tests := []struct {
+		name    string
+		opts    protocolOptions
+		stdin   string
+		want    string
+		wantErr string
+	}{
+		{"inline", protocolOptions{value: `[1, 2]`}, "", `[1, 2]`, ""},
+		{"stdin", protocolOptions{value: "-"}, ` {"n": 1} `, `{"n": 1}`, ""},
+		{"file", protocolOptions{valueFile: valueFile}, "", `{"name": "Alice"}`, ""},
+		{"none", protocolOptions{}, "", "", ""},
+		{"bad file", protocolOptions{valueFile: badFile}, "", "", "at byte 18"},
+		{"bad stdin", protocolOptions{value: "-"}, `{"n": }`, "", "stdin: invalid JSON at byte 7"},
+		{"both", protocolOptions{value: "1", valueFile: valueFile}, "", "", "either"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.opts.valueJSON(strings.NewReader(tt.stdin))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || string(value) != tt.want {
+				t.Errorf("value = %s, %v; want %s", value, err, tt.want)
+			}
+		})
+	}
+
+	opts := protocolOptions{propsFile: propsFile}
+	if props, err := opts.properties(); err != nil || props["type"] != "Person" {
+		t.Errorf("--props-file gave %v, %v", props, err)
+	}
+	opts = protocolOptions{propsFile: badFile}
+	if _, err := opts.properties(); err == nil || !strings.Contains(err.Error(), "at byte") {
+		t.Errorf("bad --props-file gave %v, want an error with its offset", err)
+	}
+}
+
+// TestBatch verifies batch sends every message over one connection, keeps
+// going past error responses unless --fail-fast is set, and rejects bad lines
+// before sending anything
+func TestBatch(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ui")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socketPath = filepath.Join(dir, "ui.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var connections atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connections.Add(1)
+			go func() {
+				defer conn.Close()
+				for {
+					data, err := readPacket(conn)
+					if err != nil {
+						return
+					}
+					var msg protocol.Message
+					json.Unmarshal(data, &msg)
+					resp := `{"result":"` + string(msg.Type) + `"}`
+					if msg.Type == protocol.MsgDestroy {
+						resp = `{"error":"no such variable"}`
+					}
+					lenBuf := make([]byte, 4)
+					binary.BigEndian.PutUint32(lenBuf, uint32(len(resp)))
+					conn.Write(append(lenBuf, resp...))
+				}
+			}()
+		}
+	}()
+
+	msgs, err := readMessages(strings.NewReader(`{"type":"get","data":{"ids":[1]}}
+
+{"type":"destroy","data":{"varId":9}}
+{"type":"update","data":{"varId":1,"value":2}}
+`))
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("readMessages returned %d messages, %v", len(msgs), err)
+	}
+	responses, err := sendBatch(msgs, false)
+	if err != nil || len(responses) != 3 || responses[1].Error == "" || responses[2].Result != "update" {
+		t.Errorf("batch returned %+v, %v", responses, err)
+	}
+	if n := connections.Load(); n != 1 {
+		t.Errorf("batch used %d connections, want 1", n)
+	}
+	responses, err = sendBatch(msgs, true)
+	if err == nil || len(responses) != 2 {
+		t.Errorf("--fail-fast returned %d responses, %v; want 2 and an error", len(responses), err)
+	}
+
+	for _, bad := range []string{`{"type":"get"}` + "\n" + `{"type":`, `{"data":{}}`} {
+		if _, err := readMessages(strings.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "line") {
+			t.Errorf("readMessages(%q) error = %v, want one naming the line", bad, err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/server"
+)
+
+// completeCommand is the hidden command the completion scripts call for
+// dynamic values; it is not listed in help.
+const completeCommand = "__complete"
+
+// completionServerURL is the server asked for session and group names
+const completionServerURL = "http://127.0.0.1:8080"
+
+// builtinCommands are handled by the dispatcher itself rather than the command table
+var builtinCommands = [][2]string{
+	{"help", "Show help"},
+	{"version", "Show version"},
+}
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// completionWriters maps a shell to its script generator
+var completionWriters = map[string]func(w io.Writer, prog string){
+	"bash": writeBashCompletion,
+	"zsh":  writeZshCompletion,
+	"fish": writeFishCompletion,
+}
+
+// runCompletion prints the completion script for a shell.
+func runCompletion(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine completion bash|zsh|fish")
+		return 1
+	}
+	write, ok := completionWriters[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Error: unsupported shell %q (want bash, zsh or fish)\n", args[0])
+		return 1
+	}
+	write(os.Stdout, filepath.Base(os.Args[0]))
+	return 0
+}
+
+// runComplete prints the current values of one valueKind, one per line.
+// Failures print nothing so the shell just offers no candidates.
+func runComplete(args []string) int {
+	if len(args) != 1 {
+		return 1
+	}
+	values, err := completionValues(valueKind(args[0]))
+	if err != nil {
+		return 1
+	}
+	for _, value := range values {
+		fmt.Println(value)
+	}
+	return 0
+}
+
+func completionValues(kind valueKind) ([]string, error) {
+	switch kind {
+	case sessionValue, groupValue:
+		return liveSessionValues(kind)
+	case bundleFileValue:
+		bundled, err := bundle.IsBundled()
+		if err != nil || !bundled {
+			return nil, err
+		}
+		return bundle.ListFiles()
+	case shellValue:
+		return completionShells, nil
+	}
+	return nil, fmt.Errorf("unknown value kind %q", kind)
+}
+
+// liveSessionValues asks a running server for its session IDs or group names.
+func liveSessionValues(kind valueKind) ([]string, error) {
+	client := &http.Client{Timeout: time.Second}
+	resp, err := client.Get(completionServerURL + "/api/debug/sessions")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	var infos []server.SessionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		return nil, err
+	}
+	var values []string
+	seen := make(map[string]bool)
+	for _, info := range infos {
+		value := info.ID
+		if kind == groupValue {
+			value = info.Group
+		}
+		if value != "" && !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// shellIdent turns a program name into a shell function name fragment.
+func shellIdent(prog string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, prog)
+}
+
+// commandNames returns every command name, including the builtins.
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	for _, builtin := range builtinCommands {
+		names = append(names, builtin[0])
+	}
+	return names
+}
+
+func writeBashCompletion(w io.Writer, prog string) {
+	fn := "_" + shellIdent(prog)
+	fmt.Fprintf(w, "# bash completion for %[1]s\n# Load with: source <(%[1]s completion bash)\n\n", prog)
+	fmt.Fprintf(w, `%[1]s_values() {
+    case "$1" in
+        file) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        dir) COMPREPLY=($(compgen -d -- "$cur")) ;;
+        "") COMPREPLY=() ;;
+        *) COMPREPLY=($(compgen -W "$(%[2]s %[3]s "$1" 2>/dev/null)" -- "$cur")) ;;
+    esac
+}
+
+%[1]s() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "%[4]s" -- "$cur"))
+        return
+    fi
+    local cmd="${COMP_WORDS[1]}" flags="" valueflags="" kinds=()
+    case "$cmd" in
+`, fn, prog, completeCommand, strings.Join(commandNames(), " "))
+	var flagKinds []string
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        %s)\n", cmd.name)
+		if names := cmd.flagNames(); len(names) > 0 {
+			fmt.Fprintf(w, "            flags=%q\n", strings.Join(names, " "))
+		}
+		if names := cmd.valueFlags(); len(names) > 0 {
+			fmt.Fprintf(w, "            valueflags=%q\n", strings.Join(names, " "))
+			for _, name := range names {
+				if kind := cmd.values[name]; kind != noValue {
+					flagKinds = append(flagKinds, fmt.Sprintf("        \"%s %s\") %s_values %s ;;\n", cmd.name, name, fn, kind))
+				}
+			}
+		}
+		if len(cmd.args) > 0 {
+			kinds := make([]string, len(cmd.args))
+			for i, kind := range cmd.args {
+				kinds[i] = string(kind)
+			}
+			fmt.Fprintf(w, "            kinds=(%s)\n", strings.Join(kinds, " "))
+		}
+		fmt.Fprintln(w, "            ;;")
+	}
+	fmt.Fprintf(w, `    esac
+    local p="${prev#-}"
+    p="${p#-}"
+    if [[ $prev == -* && " $valueflags " == *" $p "* ]]; then
+        case "$cmd $p" in
+%s        esac
+        return
+    fi
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+    local i w n=0
+    for ((i = 2; i < COMP_CWORD; i++)); do
+        w="${COMP_WORDS[i]}"
+        if [[ $w == -* ]]; then
+            w="${w#-}"
+            w="${w#-}"
+            [[ $w != *=* && " $valueflags " == *" $w "* ]] && ((i++))
+        else
+            ((n++))
+        fi
+    done
+    if ((${#kinds[@]})); then
+        ((n >= ${#kinds[@]})) && n=$((${#kinds[@]} - 1))
+        %[2]s_values "${kinds[n]}"
+    fi
+}
+
+complete -F %[2]s %[3]s
+`, strings.Join(flagKinds, ""), fn, prog)
+}
+
+// zshQuote escapes text for a single-quoted _arguments spec.
+func zshQuote(s string) string {
+	return strings.NewReplacer("'", `'\''`, "[", `\[`, "]", `\]`).Replace(describe(s))
+}
+
+// zshAction returns the _arguments action that completes a valueKind.
+func zshAction(fn string, kind valueKind) string {
+	switch kind {
+	case noValue:
+		return " "
+	case fileValue:
+		return "_files"
+	case dirValue:
+		return "_files -/"
+	}
+	return fmt.Sprintf("%s_values %s", fn, kind)
+}
+
+func writeZshCompletion(w io.Writer, prog string) {
+	fn := "_" + shellIdent(prog)
+	fmt.Fprintf(w, "#compdef %[1]s\n# zsh completion for %[1]s\n# Load with: source <(%[1]s completion zsh)\n\n", prog)
+	fmt.Fprintf(w, `%[1]s_values() {
+    local -a values
+    values=(${(f)"$(%[2]s %[3]s $1 2>/dev/null)"})
+    compadd -a values
+}
+
+%[1]s() {
+    local -a commands
+    commands=(
+`, fn, prog, completeCommand)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "        '%s:%s'\n", cmd.name, zshQuote(cmd.summary))
+	}
+	for _, builtin := range builtinCommands {
+		fmt.Fprintf(w, "        '%s:%s'\n", builtin[0], zshQuote(builtin[1]))
+	}
+	fmt.Fprintf(w, `    )
+    local state
+    _arguments -C '1: :->command' '*:: :->args'
+    case $state in
+        command)
+            _describe -t commands '%s command' commands
+            ;;
+        args)
+            case $words[1] in
+`, prog)
+	for _, cmd := range commands {
+		var specs []string
+		cmd.flagSet().VisitAll(func(f *flag.Flag) {
+			if isBoolFlag(f) {
+				specs = append(specs, fmt.Sprintf("'%s[%s]'", dashed(f.Name), zshQuote(f.Usage)))
+				return
+			}
+			specs = append(specs, fmt.Sprintf("'%s=[%s]:%s:%s'", dashed(f.Name), zshQuote(f.Usage), f.Name, zshAction(fn, cmd.values[f.Name])))
+		})
+		for i, kind := range cmd.args {
+			pos := fmt.Sprint(i + 1)
+			if i == len(cmd.args)-1 {
+				pos = "*"
+			}
+			specs = append(specs, fmt.Sprintf("'%s:%s:%s'", pos, kind, zshAction(fn, kind)))
+		}
+		if len(specs) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "                %s)\n                    _arguments \\\n                        %s\n                    ;;\n",
+			cmd.name, strings.Join(specs, " \\\n                        "))
+	}
+	fmt.Fprintf(w, `            esac
+            ;;
+    esac
+}
+
+if [ "$funcstack[1]" = "%[1]s" ]; then
+    %[1]s "$@"
+else
+    compdef %[1]s %[2]s
+fi
+`, fn, prog)
+}
+
+// fishQuote quotes text for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, "'", `\'`).Replace(describe(s)) + "'"
+}
+
+// fishAction returns the complete options that offer a valueKind.
+func fishAction(prog string, kind valueKind) string {
+	switch kind {
+	case noValue:
+		return ""
+	case fileValue:
+		return " -F"
+	case dirValue:
+		return " -a '(__fish_complete_directories)'"
+	}
+	return fmt.Sprintf(" -a '(%s %s %s)'", prog, completeCommand, kind)
+}
+
+func writeFishCompletion(w io.Writer, prog string) {
+	fn := "__" + shellIdent(prog)
+	fmt.Fprintf(w, "# fish completion for %[1]s\n# Load with: %[1]s completion fish | source\n\n", prog)
+	fmt.Fprintf(w, `# Prints how many positional arguments follow the command
+function %s_args
+    set -l n 0
+    for t in (commandline -opc)[3..-1]
+        string match -q -- '-*' $t; or set n (math $n + 1)
+    end
+    echo $n
+end
+
+complete -c %s -f
+`, fn, prog)
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", prog, cmd.name, fishQuote(cmd.summary))
+	}
+	for _, builtin := range builtinCommands {
+		fmt.Fprintf(w, "complete -c %s -n __fish_use_subcommand -a %s -d %s\n", prog, builtin[0], fishQuote(builtin[1]))
+	}
+	for _, cmd := range commands {
+		seen := fmt.Sprintf("'__fish_seen_subcommand_from %s'", cmd.name)
+		cmd.flagSet().VisitAll(func(f *flag.Flag) {
+			value := ""
+			if !isBoolFlag(f) {
+				value = " -r" + fishAction(prog, cmd.values[f.Name])
+			}
+			option := "-l"
+			if len(f.Name) == 1 {
+				option = "-s"
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s %s %s%s -d %s\n", prog, seen, option, f.Name, value, fishQuote(f.Usage))
+		})
+		for i, kind := range cmd.args {
+			cond := seen
+			if len(cmd.args) > 1 {
+				op := "-eq"
+				if i == len(cmd.args)-1 {
+					op = "-ge"
+				}
+				cond = fmt.Sprintf("'__fish_seen_subcommand_from %s; and test (%s_args) %s %d'", cmd.name, fn, op, i)
+			}
+			fmt.Fprintf(w, "complete -c %s -n %s%s\n", prog, cond, fishAction(prog, kind))
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the completion golden files")
+
+// TestCompletionGolden compares each shell's script with testdata/completion.<shell>.
+// Run with -update after changing a command or flag.
+func TestCompletionGolden(t *testing.T) {
+	for _, shell := range completionShells {
+		t.Run(shell, func(t *testing.T) {
+			var buf bytes.Buffer
+			completionWriters[shell](&buf, "ui-engine")
+			golden := filepath.Join("testdata", "completion."+shell)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("%s completion differs from %s; rerun with -update if the change is intended", shell, golden)
+			}
+		})
+	}
+}
+
+// TestCompletionCoversCommands verifies every dispatchable command appears in each script
+func TestCompletionCoversCommands(t *testing.T) {
+	for _, shell := range completionShells {
+		var buf bytes.Buffer
+		completionWriters[shell](&buf, "ui-engine")
+		for _, name := range commandNames() {
+			if !bytes.Contains(buf.Bytes(), []byte(name)) {
+				t.Errorf("%s completion is missing command %s", shell, name)
+			}
+		}
+	}
+}
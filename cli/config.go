@@ -20,5 +20,6 @@ type (
 var (
 	DefaultConfig        = config.DefaultConfig
 	Load                 = config.Load
+	ParseConfig          = config.Parse
 	ExpandVerbosityFlags = config.ExpandVerbosityFlags
 )
@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type doctorOptions struct {
+	url        string
+	live       bool
+	repair     bool
+	lint       string
+	strictLint bool
+	crashDir   string
+	unused     time.Duration
+	config     bool
+}
+
+func (o *doctorOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.BoolVar(&o.live, "live", false, "Check the live server's watch tables")
+	fs.BoolVar(&o.repair, "repair", false, "Remove orphaned watch entries (with --live)")
+	fs.StringVar(&o.lint, "lint", "", "Lint the Lua code of a site directory")
+	fs.BoolVar(&o.strictLint, "strict-lint", false, "Treat Lua lint warnings as errors (with --lint)")
+	fs.StringVar(&o.crashDir, "crash-dir", "", "Crash bundle directory (default: $UI_CRASH_DIR or the server default)")
+	fs.BoolVar(&o.config, "config", false, "Check the serve configuration (config file, UI_* variables, and serve flags after --)")
+	fs.DurationVar(&o.unused, "unused-after", 30*24*time.Hour, "Flag viewdef types unused for this long (with --live)")
+}
+
+// runDoctor runs consistency checks against a running server or a site's Lua code.
+func runDoctor(args []string) int {
+	var opts doctorOptions
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	foundCrashes := reportCrashBundles(opts.crashDir)
+	if !opts.live && opts.lint == "" && !opts.config {
+		if foundCrashes {
+			return 0
+		}
+		fmt.Fprintln(os.Stderr, "Error: no checks selected")
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine doctor [--live [--repair] [--url <server>]] [--lint <site-dir> [--strict-lint]] [--config [-- <serve-flags>]]")
+		return 1
+	}
+
+	status := 0
+	if opts.config && !checkConfig(fs.Args()) {
+		status = 1
+	}
+	if opts.lint != "" {
+		if lintSite(opts.lint, opts.strictLint) {
+			fmt.Println("lint: OK")
+		} else {
+			status = 1
+		}
+	}
+	if !opts.live {
+		return status
+	}
+	reportUnusedViewdefs(opts.url, opts.unused)
+
+	endpoint := opts.url + "/api/debug/watches"
+	if opts.repair {
+		endpoint += "?repair=1"
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to reach server at %s: %v\n", opts.url, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: watch check unavailable (HTTP %d)\n", resp.StatusCode)
+		return 1
+	}
+
+	var reports []server.WatchCheckReport
+	if err := json.NewDecoder(resp.Body).Decode(&reports); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to parse response: %v\n", err)
+		return 1
+	}
+
+	if len(reports) == 0 {
+		fmt.Println("watches: OK (no orphaned watches)")
+		return status
+	}
+	for _, report := range reports {
+		action := "found"
+		if report.Repaired {
+			action = "repaired"
+		}
+		fmt.Printf("watches: session %s: %d orphaned watches %s %v\n", report.Session, len(report.Orphans), action, report.Orphans)
+	}
+	if opts.repair {
+		return status
+	}
+	return 1
+}
+
+// checkConfig prints the problems Validate finds in the configuration serve
+// would load with args, returning false if any is an error.
+func checkConfig(args []string) bool {
+	cfg, err := config.Parse(args)
+	if err != nil {
+		fmt.Printf("config: %v\n", err)
+		return false
+	}
+	problems := cfg.Validate()
+	if len(problems) == 0 {
+		fmt.Println("config: OK")
+		return true
+	}
+	for _, problem := range problems {
+		fmt.Printf("config: %s\n", problem)
+	}
+	return config.ProblemsError(problems) == nil
+}
+
+// reportUnusedViewdefs flags viewdef types with no sends or creations within
+// horizon. Dead templates are a cleanup hint, not a failure.
+func reportUnusedViewdefs(baseURL string, horizon time.Duration) {
+	list, err := fetchViewdefs(baseURL, false)
+	if err != nil {
+		fmt.Printf("viewdefs: usage unavailable: %v\n", err)
+		return
+	}
+	unused := list.Usage.Unused(time.Now(), horizon)
+	switch {
+	case time.Since(list.Usage.Since) < horizon:
+		fmt.Printf("viewdefs: usage counted for %s, under --unused-after %s\n", time.Since(list.Usage.Since).Round(time.Second), horizon)
+	case len(unused) == 0:
+		fmt.Println("viewdefs: OK (every type used)")
+	default:
+		slices.Sort(unused)
+		fmt.Printf("viewdefs: %d types unused for %s: %v\n", len(unused), horizon, unused)
+	}
+}
+
+// reportCrashBundles mentions crash bundles left by earlier server crashes.
+// Returns true if there are any.
+func reportCrashBundles(dir string) bool {
+	if dir == "" {
+		dir = os.Getenv("UI_CRASH_DIR")
+	}
+	if dir == "" {
+		dir = config.DefaultCrashDir()
+	}
+	paths, err := server.ListCrashBundles(dir)
+	if err != nil || len(paths) == 0 {
+		return false
+	}
+	fmt.Printf("crash: %d crash bundles in %s, newest %s\n", len(paths), dir, filepath.Base(paths[0]))
+	return true
+}
@@ -5,7 +5,9 @@ package cli
 import (
 	changetracker "github.com/zot/change-tracker"
 	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
 	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
 	"github.com/zot/ui-engine/internal/server"
 	"github.com/zot/ui-engine/internal/viewdef"
 )
@@ -15,6 +17,7 @@ type (
 	Server         = server.Server
 	LuaRuntime     = lua.LuaSession
 	ViewdefManager = viewdef.ViewdefManager
+	A11yFinding    = viewdef.A11yFinding
 	// Change-tracker types for variable inspection
 	Variable = changetracker.Variable
 	Tracker  = changetracker.Tracker
@@ -22,14 +25,64 @@ type (
 	DebugVariable = server.DebugVariable
 )
 
-// Re-export server constructor
+// Re-export MCP capability types; tool handlers enforce them through Server.RunMCPTool
+type (
+	MCPCapability      = config.MCPCapability
+	MCPCapabilityError = config.MCPCapabilityError
+)
+
+const (
+	MCPRun            = config.MCPRun
+	MCPStateWrite     = config.MCPStateWrite
+	MCPViewdefWrite   = config.MCPViewdefWrite
+	MCPSessionControl = config.MCPSessionControl
+)
+
+// Re-export telemetry types; embedders install hooks with Server.SetTelemetry
+type (
+	TelemetryHook   = protocol.TelemetryHook
+	NopTelemetry    = protocol.NopTelemetry
+	NDJSONTelemetry = protocol.NDJSONTelemetry
+	MessageType     = protocol.MessageType
+)
+
+var (
+	MultiTelemetry     = protocol.MultiTelemetry
+	NewNDJSONTelemetry = protocol.NewNDJSONTelemetry
+)
+
+// Re-export server constructors
+var (
+	NewServer            = server.New
+	NewServerWithOptions = server.NewWithOptions
+)
+
+// Re-export server options; each replaces a component built from config
+type (
+	ServerOption    = server.Option
+	SessionManager  = server.SessionManager
+	PersistentStore = server.PersistentStore
+	WrapperRegistry = lua.WrapperRegistry
+	AuthFunc        = server.AuthFunc
+)
+
 var (
-	NewServer = server.New
+	WithSessionManager  = server.WithSessionManager
+	WithViewdefManager  = server.WithViewdefManager
+	WithStore           = server.WithStore
+	WithWrapperRegistry = server.WithWrapperRegistry
+	WithTelemetry       = server.WithTelemetry
+	WithAuthFunc        = server.WithAuthFunc
+	WithSiteFS          = server.WithSiteFS
+	NewSessionManager   = server.NewSessionManager
+	NewViewdefManager   = viewdef.NewViewdefManager
+	NewWrapperRegistry  = lua.NewWrapperRegistry
 )
 
 // Re-export bundle functions for MCP integration
 var (
 	IsBundled                = bundle.IsBundled
+	BundleFS                 = bundle.FS
 	BundleListFiles          = bundle.ListFilesInDir
 	BundleListFilesRecursive = bundle.ListFilesInDirRecursive
 	BundleListFilesWithInfo  = bundle.ListFilesWithInfo
@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type gcOptions struct {
+	url     string
+	session string
+}
+
+func (o *gcOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.StringVar(&o.session, "session", "", "Session to collect (vended ID)")
+}
+
+// runGC collects a session's unreachable objects on a running server.
+func runGC(args []string) int {
+	var opts gcOptions
+	fs := flag.NewFlagSet("gc", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.session == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine gc --session <id> [--url <server>]")
+		return 1
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(opts.url+"/api/debug/gc?session="+url.QueryEscape(opts.session), "", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to reach server at %s: %v\n", opts.url, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: collection failed (HTTP %d): %s\n", resp.StatusCode, strings.TrimSpace(string(body)))
+		return 1
+	}
+
+	var stats server.ObjectGCStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to parse response: %v\n", err)
+		return 1
+	}
+	fmt.Printf("session %s: objects %d -> %d, object IDs %d -> %d, %d stale variables (%v)\n", stats.Session,
+		stats.ObjectsBefore, stats.ObjectsAfter, stats.IdentitiesBefore, stats.IdentitiesAfter,
+		stats.VariablesPruned, stats.Duration.Round(time.Microsecond))
+	return 0
+}
@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type genTestOptions struct {
+	output  string
+	pkg     string
+	name    string
+	site    string
+	ignore  string
+	session string
+}
+
+func (o *genTestOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "Output file (default: stdout)")
+	fs.StringVar(&o.pkg, "package", "", "Package of the test (default: the output directory's name + _test)")
+	fs.StringVar(&o.name, "name", "", "Test function name (default: from the recording's name)")
+	fs.StringVar(&o.site, "site", "", "Site directory the test serves (default: an empty app)")
+	fs.StringVar(&o.ignore, "ignore", "", "Comma-separated JSON paths to skip when matching, e.g. result.*.time")
+	fs.StringVar(&o.session, "session", "", "Recorded session ID to normalize (default: from a start record)")
+}
+
+// record is one line of a recording. Its time, if any, is not used.
+type record struct {
+	Dir     string          `json:"dir"` // start, in, resp or out
+	Session string          `json:"session,omitempty"`
+	Msg     json.RawMessage `json:"msg,omitempty"`
+}
+
+// genStep is one inbound message with the response and updates that followed it.
+type genStep struct {
+	send     string
+	response string
+	updates  []string
+}
+
+// runGenTest converts a recorded session into a Go test (gen-test).
+func runGenTest(args []string) int {
+	var opts genTestOptions
+	fs := flag.NewFlagSet("gen-test", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine gen-test [-o file_test.go] [--ignore paths] <recording.ndjson>")
+		return 1
+	}
+	recording := fs.Arg(0)
+	file, err := os.Open(recording)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	defer file.Close()
+	if opts.name == "" {
+		opts.name = testName(recording)
+	}
+	if opts.pkg == "" {
+		opts.pkg = "scenario_test"
+		if opts.output != "" {
+			if abs, err := filepath.Abs(opts.output); err == nil {
+				opts.pkg = identifier(filepath.Base(filepath.Dir(abs)), "scenario") + "_test"
+			}
+		}
+	}
+	src, err := genTest(file, filepath.Base(recording), opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s: %v\n", recording, err)
+		return 1
+	}
+	if opts.output == "" {
+		os.Stdout.Write(src)
+		return 0
+	}
+	if err := os.WriteFile(opts.output, src, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Created test: %s\n", opts.output)
+	return 0
+}
+
+// genTest reads a recording and returns the gofmt'ed source of a test that
+// replays it with the uitest harness.
+func genTest(r io.Reader, source string, opts genTestOptions) ([]byte, error) {
+	steps, session, err := readRecording(r)
+	if err != nil {
+		return nil, err
+	}
+	if opts.session != "" {
+		session = opts.session
+	}
+	normalize := func(data json.RawMessage) string {
+		var buf bytes.Buffer
+		json.Compact(&buf, data)
+		if session == "" {
+			return buf.String()
+		}
+		return strings.ReplaceAll(buf.String(), session, "$session")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by ui-engine gen-test from %s. Edit freely.\n\n", source)
+	fmt.Fprintf(&b, "package %s\n\n", opts.pkg)
+	b.WriteString("import (\n\"testing\"\n\n\"github.com/zot/ui-engine/internal/uitest\"\n)\n\n")
+	fmt.Fprintf(&b, "func %s(t *testing.T) {\n", opts.name)
+	fmt.Fprintf(&b, "h := uitest.New(t, %s)\n", strconv.Quote(opts.site))
+	b.WriteString("h.Replay([]uitest.Step{\n")
+	for _, step := range steps {
+		fmt.Fprintf(&b, "{\nSend: %s,\n", goString(normalize(json.RawMessage(step.send))))
+		if step.response != "" {
+			fmt.Fprintf(&b, "Response: %s,\n", goString(normalize(json.RawMessage(step.response))))
+		}
+		if len(step.updates) > 0 {
+			b.WriteString("Updates: []string{\n")
+			for _, update := range step.updates {
+				fmt.Fprintf(&b, "%s,\n", goString(normalize(json.RawMessage(update))))
+			}
+			b.WriteString("},\n")
+		}
+		b.WriteString("},\n")
+	}
+	b.WriteString("}")
+	for path := range strings.SplitSeq(opts.ignore, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			fmt.Fprintf(&b, ", %s", strconv.Quote(path))
+		}
+	}
+	b.WriteString(")\n}\n")
+	return format.Source(b.Bytes())
+}
+
+// readRecording groups a recording's records into steps and returns the
+// session ID from its start record, if any.
+func readRecording(r io.Reader) ([]genStep, string, error) {
+	var steps []genStep
+	var session string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(text, &rec); err != nil {
+			return nil, "", fmt.Errorf("line %d: %w", line, err)
+		}
+		if rec.Dir != "start" && len(rec.Msg) == 0 {
+			return nil, "", fmt.Errorf("line %d: %s record has no msg", line, rec.Dir)
+		}
+		switch rec.Dir {
+		case "start":
+			session = rec.Session
+		case "in":
+			steps = append(steps, genStep{send: string(rec.Msg)})
+		case "resp", "out":
+			if len(steps) == 0 {
+				return nil, "", fmt.Errorf("line %d: %s record before any in record", line, rec.Dir)
+			}
+			step := &steps[len(steps)-1]
+			if rec.Dir == "resp" {
+				step.response = string(rec.Msg)
+			} else {
+				step.updates = append(step.updates, string(rec.Msg))
+			}
+		default:
+			return nil, "", fmt.Errorf("line %d: unknown dir %q", line, rec.Dir)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if len(steps) == 0 {
+		return nil, "", fmt.Errorf("no in records")
+	}
+	return steps, session, nil
+}
+
+// goString returns a Go literal for s, raw when possible so JSON stays readable.
+func goString(s string) string {
+	if strconv.CanBackquote(s) {
+		return "`" + s + "`"
+	}
+	return strconv.Quote(s)
+}
+
+// testName derives a test function name from a recording's file name, e.g.
+// checkout-bug.ndjson -> TestCheckoutBug.
+func testName(path string) string {
+	base := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	var b strings.Builder
+	b.WriteString("Test")
+	upper := true
+	for _, r := range base {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	if b.Len() == len("Test") {
+		b.WriteString("Recording")
+	}
+	return b.String()
+}
+
+// identifier returns name with the characters Go identifiers can't hold
+// removed, or fallback if nothing is left.
+func identifier(name, fallback string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		return fallback
+	}
+	return name
+}
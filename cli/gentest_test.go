@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"go/format"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestGenTest verifies a recording becomes a gofmt'ed test that compiles and
+// passes against the server, with the session ID normalized, record times
+// dropped and ignored paths skipped
+func TestGenTest(t *testing.T) {
+	site := t.TempDir()
+	os.MkdirAll(filepath.Join(site, "lua"), 0755)
+	os.WriteFile(filepath.Join(site, "lua", "main.lua"), []byte(`
+		app = {name = "Ada"}
+		session:createAppVariable(app)
+	`), 0644)
+	recording := strings.Join([]string{
+		`{"dir":"start","session":"f00d","time":"2026-01-02T03:04:05Z"}`,
+		`{"dir":"in","time":"2026-01-02T03:04:06Z","msg":{"type":"create","data":{"id":2,"parentId":1,"properties":{"path":"name"}}}}`,
+		`{"dir":"resp","msg":{}}`,
+		`{"dir":"out","msg":{"type":"update","data":{"varId":2,"value":"Ada"}}}`,
+		`{"dir":"in","msg":{"type":"update","data":{"varId":2,"value":"Bob` + "`" + `"}}}`,
+		`{"dir":"resp","msg":{"result":"f00d-42"}}`,
+	}, "\n")
+
+	src, err := genTest(strings.NewReader(recording), "demo.ndjson", genTestOptions{
+		pkg: "uitest_test", name: "TestGeneratedScenario", site: site, ignore: "result"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted, err := format.Source(src); err != nil || !bytes.Equal(formatted, src) {
+		t.Fatalf("generated code is not gofmt'ed (%v):\n%s", err, src)
+	}
+	for _, want := range []string{"$session-42", `"result"`, "Bob`", `uitest.New(t, "` + site} {
+		if !strings.Contains(string(src), want) {
+			t.Errorf("generated code lacks %s:\n%s", want, src)
+		}
+	}
+	if strings.Contains(string(src), "f00d") || strings.Contains(string(src), "2026") {
+		t.Errorf("generated code holds the recorded session ID or times:\n%s", src)
+	}
+
+	if testing.Short() {
+		t.Skip("skipping running the generated test in short mode")
+	}
+	// Overlay the test into the uitest package so it can import internal packages
+	root, err := filepath.Abs("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	generated := filepath.Join(dir, "scenario_test.go")
+	os.WriteFile(generated, src, 0644)
+	overlay, _ := json.Marshal(map[string]any{"Replace": map[string]string{
+		filepath.Join(root, "internal", "uitest", "zz_scenario_test.go"): generated}})
+	overlayFile := filepath.Join(dir, "overlay.json")
+	os.WriteFile(overlayFile, overlay, 0644)
+	cmd := exec.Command("go", "test", "-overlay", overlayFile, "-run", "^TestGeneratedScenario$", "./internal/uitest")
+	cmd.Dir = root
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generated test failed: %v\n%s\n%s", err, out, src)
+	}
+}
+
+// TestReadRecordingErrors verifies malformed recordings are rejected with their line
+func TestReadRecordingErrors(t *testing.T) {
+	tests := []struct {
+		recording string
+		want      string
+	}{
+		{`{"dir":"resp","msg":{}}`, "line 1: resp record before any in record"},
+		{"\n" + `{"dir":"sideways","msg":{}}`, `line 2: unknown dir "sideways"`},
+		{`{"dir":"in"}`, "line 1: in record has no msg"},
+		{`{"dir":"start","session":"x"}`, "no in records"},
+		{`not json`, "line 1:"},
+	}
+	for _, tt := range tests {
+		_, _, err := readRecording(strings.NewReader(tt.recording))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("readRecording(%q) error = %v, want %q", tt.recording, err, tt.want)
+		}
+	}
+}
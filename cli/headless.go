@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type headlessOptions struct {
+	dir         string
+	assertState string
+	output      string
+}
+
+func (o *headlessOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.dir, "dir", "", "Site directory (default: the bundled site)")
+	fs.StringVar(&o.assertState, "assert-state", "", "JSON file the final app state must match")
+	fs.StringVar(&o.output, "o", "", "Write the final app state to a file (default: stdout, unless --assert-state)")
+}
+
+// runHeadless runs a Lua script in a session with no frontend and checks or
+// prints the resulting app state (headless run).
+func runHeadless(args []string) int {
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+	var opts headlessOptions
+	fs := flag.NewFlagSet("headless", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	// Flags may also follow the script
+	script := fs.Arg(0)
+	if fs.NArg() > 0 {
+		if err := fs.Parse(fs.Args()[1:]); err != nil {
+			return 1
+		}
+	}
+	if script == "" || fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine headless run [--dir site] [--assert-state expected.json] [-o state.json] <script.lua>")
+		return 1
+	}
+	code, err := os.ReadFile(script)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	var want any
+	if opts.assertState != "" {
+		data, err := os.ReadFile(opts.assertState)
+		if err == nil {
+			err = json.Unmarshal(data, &want)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %s: %v\n", opts.assertState, err)
+			return 1
+		}
+	}
+
+	var configArgs []string
+	if opts.dir != "" {
+		configArgs = []string{"--dir", opts.dir}
+	}
+	cfg, err := Load(configArgs)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	log.SetOutput(os.Stderr)
+	srv := server.New(cfg)
+	defer srv.Shutdown(context.Background())
+
+	state, err := headlessRun(srv, filepath.Base(script), string(code))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if opts.output != "" || opts.assertState == "" {
+		if err := writeOutput(opts.output, append(indentJSON(state), '\n')); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+	}
+	if opts.assertState == "" {
+		return 0
+	}
+	var got any
+	if err := json.Unmarshal(state, &got); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: state: %v\n", err)
+		return 1
+	}
+	diffs := diffState("", got, want)
+	if len(diffs) > 0 {
+		fmt.Printf("State does not match %s (%d differences):\n", opts.assertState, len(diffs))
+		for _, d := range diffs {
+			fmt.Printf("  %s\n", d)
+		}
+		return 1
+	}
+	fmt.Printf("State matches %s\n", opts.assertState)
+	return 0
+}
+
+// headlessRun runs code in a new headless session, waits for it to settle and
+// returns the session's app state.
+func headlessRun(srv *server.Server, name, code string) (json.RawMessage, error) {
+	h, err := srv.CreateHeadlessSession()
+	if err != nil {
+		return nil, err
+	}
+	defer h.Close()
+	if err := h.Flush(); err != nil {
+		return nil, err
+	}
+	if _, err := h.Run(name, code); err != nil {
+		return nil, err
+	}
+	if err := h.Flush(); err != nil {
+		return nil, err
+	}
+	return h.State()
+}
+
+// indentJSON indents data, or returns it unchanged if it is not valid JSON.
+func indentJSON(data []byte) []byte {
+	var v any
+	if json.Unmarshal(data, &v) != nil {
+		return data
+	}
+	out, _ := json.MarshalIndent(v, "", "  ")
+	return out
+}
+
+// writeOutput writes data to path, or to stdout if path is empty.
+func writeOutput(path string, data []byte) error {
+	if path == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// diffState lists every difference between decoded JSON values, one per
+// line, as "path: got X, want Y". Object keys are compared in sorted order.
+func diffState(path string, got, want any) []string {
+	at := path
+	if at == "" {
+		at = "(root)"
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			break
+		}
+		var diffs []string
+		for _, key := range slices.Sorted(maps.Keys(w)) {
+			child := joinPath(path, key)
+			if gv, ok := g[key]; ok {
+				diffs = append(diffs, diffState(child, gv, w[key])...)
+			} else {
+				diffs = append(diffs, fmt.Sprintf("%s: missing, want %s", child, compactJSON(w[key])))
+			}
+		}
+		for _, key := range slices.Sorted(maps.Keys(g)) {
+			if _, ok := w[key]; !ok {
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", joinPath(path, key), compactJSON(g[key])))
+			}
+		}
+		return diffs
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			break
+		}
+		var diffs []string
+		for i := range max(len(g), len(w)) {
+			child := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(g):
+				diffs = append(diffs, fmt.Sprintf("%s: missing, want %s", child, compactJSON(w[i])))
+			case i >= len(w):
+				diffs = append(diffs, fmt.Sprintf("%s: unexpected %s", child, compactJSON(g[i])))
+			default:
+				diffs = append(diffs, diffState(child, g[i], w[i])...)
+			}
+		}
+		return diffs
+	}
+	if compactJSON(got) == compactJSON(want) {
+		return nil
+	}
+	return []string{fmt.Sprintf("%s: got %s, want %s", at, compactJSON(got), compactJSON(want))}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func compactJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
@@ -0,0 +1,27 @@
+package cli
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// TestDiffState verifies every difference is reported with its path
+func TestDiffState(t *testing.T) {
+	var got, want any
+	json.Unmarshal([]byte(`{"count":3,"items":[1,2],"name":"a","extra":true}`), &got)
+	json.Unmarshal([]byte(`{"count":4,"items":[1],"name":"a","title":"x"}`), &want)
+	diffs := diffState("", got, want)
+	expected := []string{
+		`count: got 3, want 4`,
+		`items[1]: unexpected 2`,
+		`title: missing, want "x"`,
+		`extra: unexpected true`,
+	}
+	if !slices.Equal(diffs, expected) {
+		t.Errorf("diffs = %q, want %q", diffs, expected)
+	}
+	if diffs := diffState("", got, got); len(diffs) != 0 {
+		t.Errorf("equal states differ: %q", diffs)
+	}
+}
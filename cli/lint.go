@@ -0,0 +1,26 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/zot/ui-engine/internal/lua"
+)
+
+// lintSite prints lint issues for a site's Lua code and reports whether it passes.
+// Errors always fail; warnings fail only when strict is set.
+func lintSite(siteDir string, strict bool) bool {
+	issues, err := lua.LintSite(siteDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to lint %s: %v\n", siteDir, err)
+		return false
+	}
+	ok := true
+	for _, issue := range issues {
+		fmt.Fprintln(os.Stderr, issue)
+		if issue.Severity == lua.LintError || strict {
+			ok = false
+		}
+	}
+	return ok
+}
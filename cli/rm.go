@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+type rmOptions struct {
+	output string
+	source string
+}
+
+func (o *rmOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.output, "o", "", "Output path for the new binary (default: rewrite the source in place)")
+	fs.StringVar(&o.source, "src", "", "Bundled binary to remove files from (default: current executable)")
+}
+
+// runRm removes the bundled files matching a pattern, as cp matches them (rm).
+// It exits 1 when nothing matches.
+func runRm(args []string) int {
+	var opts rmOptions
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine rm [-src <binary>] [-o <output>] <pattern>")
+		return 1
+	}
+	pattern := fs.Arg(0)
+
+	sourcePath := opts.source
+	if sourcePath == "" {
+		var err error
+		sourcePath, err = os.Executable()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to get executable path: %v\n", err)
+			return 1
+		}
+	}
+
+	removed, err := bundle.RemoveFiles(sourcePath, opts.output, func(name string) bool {
+		return matchBundlePattern(pattern, name)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to remove files: %v\n", err)
+		return 1
+	}
+	if len(removed) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no bundled files match %s\n", pattern)
+		return 1
+	}
+	for _, name := range removed {
+		fmt.Printf("Removed: %s\n", name)
+	}
+	return 0
+}
@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type sessionsOptions struct {
+	url     string
+	group   string
+	destroy bool
+	routes  bool
+	vars    bool
+}
+
+func (o *sessionsOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.StringVar(&o.group, "group", "", "Only show sessions in this group")
+	fs.BoolVar(&o.destroy, "destroy", false, "Destroy every session in --group")
+	fs.BoolVar(&o.routes, "routes", false, "Also list each session's registered URL paths")
+	fs.BoolVar(&o.vars, "variables", false, "Also count each session's variables")
+}
+
+// runSessions lists a running server's sessions, or destroys a session group.
+func runSessions(args []string) int {
+	var opts sessionsOptions
+	fs := flag.NewFlagSet("sessions", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if opts.destroy && opts.group == "" {
+		fmt.Fprintln(os.Stderr, "Error: --destroy requires --group")
+		return 1
+	}
+
+	query := url.Values{}
+	if opts.group != "" {
+		query.Set("group", opts.group)
+	}
+	if opts.routes {
+		query.Set("routes", "1")
+	}
+	if opts.vars {
+		query.Set("variables", "1")
+	}
+	endpoint := opts.url + "/api/debug/sessions"
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+	method := http.MethodGet
+	if opts.destroy {
+		method = http.MethodDelete
+	}
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to reach server at %s: %v\n", opts.url, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Error: session list unavailable (HTTP %d)\n", resp.StatusCode)
+		return 1
+	}
+
+	if opts.destroy {
+		var result struct {
+			Destroyed int `json:"destroyed"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to parse response: %v\n", err)
+			return 1
+		}
+		fmt.Printf("group %s: destroyed %d sessions\n", opts.group, result.Destroyed)
+		return 0
+	}
+
+	var infos []server.SessionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&infos); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to parse response: %v\n", err)
+		return 1
+	}
+	varsHeader := ""
+	if opts.vars {
+		varsHeader = fmt.Sprintf(" %5s", "VARS")
+	}
+	fmt.Printf("%-8s %-16s %5s%s %-20s %-20s %-12s %s\n", "SESSION", "GROUP", "CONNS", varsHeader, "CREATED", "LAST ACTIVITY", "DRAINING", "TRACE")
+	for _, info := range infos {
+		group := info.Group
+		if group == "" {
+			group = "-"
+		}
+		vars := ""
+		if opts.vars {
+			vars = fmt.Sprintf(" %5d", info.Variables)
+		}
+		fmt.Printf("%-8s %-16s %5d%s %-20s %-20s %-12s %s\n", info.ID, group, info.Connections, vars,
+			info.Created.Local().Format(time.DateTime), info.LastActivity.Local().Format(time.DateTime), drainState(info), traceState(info))
+		for _, route := range info.Routes {
+			fmt.Printf("  %-30s -> variable %d\n", route.Path, route.VariableID)
+		}
+	}
+	return 0
+}
+
+// drainState describes a session's drain: "-", the grace time left, or "ending".
+func drainState(info server.SessionInfo) string {
+	if info.DrainUntil.IsZero() {
+		return "-"
+	}
+	if left := time.Until(info.DrainUntil); left > 0 {
+		return left.Round(time.Second).String() + " left"
+	}
+	return "ending"
+}
+
+// traceState describes a session's trace: "-" or the time left.
+func traceState(info server.SessionInfo) string {
+	if left := time.Until(info.TraceUntil); !info.TraceUntil.IsZero() && left > 0 {
+		return left.Round(time.Second).String() + " left"
+	}
+	return "-"
+}
+
+type drainOptions struct {
+	url     string
+	message string
+	grace   time.Duration
+}
+
+func (o *drainOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.StringVar(&o.message, "message", "", "Banner shown in the session's pages")
+	fs.DurationVar(&o.grace, "grace", 5*time.Minute, "Time before new variables are refused and the session is destroyed")
+}
+
+// runDrainSession starts draining one session of a running server.
+func runDrainSession(args []string) int {
+	var opts drainOptions
+	fs := flag.NewFlagSet("drain-session", flag.ContinueOnError)
+	opts.bind(fs)
+	// The session ID may come before the flags
+	var session string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		session, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if session == "" && fs.NArg() > 0 {
+		session = fs.Arg(0)
+	}
+	if session == "" || fs.NArg() > 1 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine drain-session <session> [--message <text>] [--grace 5m] [--url <server>]")
+		return 1
+	}
+
+	query := url.Values{"session": {session}, "grace": {opts.grace.String()}}
+	if opts.message != "" {
+		query.Set("message", opts.message)
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Post(opts.url+"/api/debug/drain?"+query.Encode(), "", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to reach server at %s: %v\n", opts.url, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Fprintf(os.Stderr, "Error: drain failed (HTTP %d): %s\n", resp.StatusCode, strings.TrimSpace(string(body)))
+		return 1
+	}
+	var info server.SessionInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: failed to parse response: %v\n", err)
+		return 1
+	}
+	fmt.Printf("session %s: draining, ends at %s\n", info.ID, info.DrainUntil.Local().Format(time.DateTime))
+	return 0
+}
@@ -0,0 +1,161 @@
+package cli
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/protocol"
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type statusOptions struct {
+	url         string
+	verbose     bool
+	connections bool
+}
+
+func (o *statusOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.BoolVar(&o.verbose, "verbose", false, "Show per-message-type timing")
+	fs.BoolVar(&o.connections, "connections", false, "List backend socket connections")
+}
+
+// runStatus queries a running server's /readyz and /metrics endpoints.
+func runStatus(args []string) int {
+	var opts statusOptions
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+
+	fmt.Printf("Server: %s\n", opts.url)
+	if readiness, err := fetchReadiness(opts.url); err == nil {
+		printReadiness(readiness)
+	}
+	if opts.connections {
+		backends, err := fetchConnections(opts.url)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		printConnections(backends)
+	}
+
+	snap, err := fetchMetrics(opts.url)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	var total, errors int64
+	for _, st := range snap.Messages {
+		total += st.Count
+		errors += st.Errors
+	}
+	fmt.Printf("Messages: %d handled, %d errors\n", total, errors)
+
+	if opts.verbose {
+		types := make([]string, 0, len(snap.Messages))
+		for typ := range snap.Messages {
+			types = append(types, string(typ))
+		}
+		sort.Strings(types)
+
+		fmt.Printf("\n%-12s %8s %8s %10s %10s %10s\n", "TYPE", "COUNT", "ERRORS", "P50(ms)", "P95(ms)", "MAX(ms)")
+		for _, typ := range types {
+			st := snap.Messages[protocol.MessageType(typ)]
+			fmt.Printf("%-12s %8d %8d %10.3f %10.3f %10.3f\n", typ, st.Count, st.Errors, st.P50Ms, st.P95Ms, st.MaxMs)
+		}
+		fmt.Printf("\nUpdate breakdown:\n")
+		fmt.Printf("  %-8s p50=%.3fms p95=%.3fms\n", "lua", snap.Update.Lua.P50Ms, snap.Update.Lua.P95Ms)
+		fmt.Printf("  %-8s p50=%.3fms p95=%.3fms\n", "store", snap.Update.Store.P50Ms, snap.Update.Store.P95Ms)
+	}
+	return 0
+}
+
+// fetchMetrics retrieves the handler metrics snapshot from a running server.
+func fetchMetrics(baseURL string) (*protocol.MetricsSnapshot, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "/metrics")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach server at %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("metrics unavailable (HTTP %d); start the server with --metrics", resp.StatusCode)
+	}
+
+	var snap protocol.MetricsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+	return &snap, nil
+}
+
+// fetchReadiness retrieves a running server's readiness.
+func fetchReadiness(baseURL string) (*server.Readiness, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "/readyz")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var readiness server.Readiness
+	if err := json.NewDecoder(resp.Body).Decode(&readiness); err != nil {
+		return nil, fmt.Errorf("failed to parse readiness: %w", err)
+	}
+	return &readiness, nil
+}
+
+// fetchConnections retrieves a running server's backend socket connections.
+func fetchConnections(baseURL string) ([]server.BackendConnection, error) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(baseURL + "/api/debug/connections")
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach server at %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+
+	var list struct {
+		Backends []server.BackendConnection `json:"backends"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse connections: %w", err)
+	}
+	return list.Backends, nil
+}
+
+func printConnections(backends []server.BackendConnection) {
+	fmt.Printf("Backend connections: %d\n", len(backends))
+	if len(backends) == 0 {
+		return
+	}
+	fmt.Printf("  %-12s %-24s %-10s %-8s %s\n", "ID", "CLIENT", "AGE", "WATCHES", "SESSIONS")
+	for _, b := range backends {
+		client := cmp.Or(b.Client, "-")
+		age := time.Since(b.Connected).Round(time.Second)
+		fmt.Printf("  %-12s %-24s %-10s %-8d %s\n", b.ID, client, age, b.Watches, strings.Join(b.Sessions, ","))
+	}
+}
+
+func printReadiness(r *server.Readiness) {
+	switch {
+	case r.Draining:
+		fmt.Println("Ready: no (draining)")
+	case r.Ready:
+		fmt.Println("Ready: yes")
+	}
+	if r.LuaSourceUnavailableSince != nil {
+		fmt.Printf("Lua source unavailable since %s (serving cached code)\n", r.LuaSourceUnavailableSince.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,202 @@
+# bash completion for ui-engine
+# Load with: source <(ui-engine completion bash)
+
+_ui_engine_values() {
+    case "$1" in
+        file) COMPREPLY=($(compgen -f -- "$cur")) ;;
+        dir) COMPREPLY=($(compgen -d -- "$cur")) ;;
+        "") COMPREPLY=() ;;
+        *) COMPREPLY=($(compgen -W "$(ui-engine __complete "$1" 2>/dev/null)" -- "$cur")) ;;
+    esac
+}
+
+_ui_engine() {
+    local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+    if [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "serve status doctor sessions drain-session gc viewdefs headless bench bundle extract ls cat cp verify rm create destroy update watch unwatch get getObjects poll flush getRoots trace batch gen-test completion help version" -- "$cur"))
+        return
+    fi
+    local cmd="${COMP_WORDS[1]}" flags="" valueflags="" kinds=()
+    case "$cmd" in
+        serve)
+            flags="--a11y-audit --asset-dirs --crash-dir --crash-keep --csp --demo --dir --hibernate-dir --hibernate-retention --host --hotload --idle-action --key-style --log-error-window --log-level --log-max-value --log-redact --lua --lua-path --metrics --no-bundle-fallback --port --port-retry --session-timeout --socket --static-cache --strict -v --verify-bundle --ws-batch-window --ws-compression"
+            valueflags="asset-dirs crash-dir crash-keep csp demo dir hibernate-dir hibernate-retention host idle-action key-style log-error-window log-level log-max-value log-redact lua-path port port-retry session-timeout socket static-cache ws-batch-window"
+            ;;
+        status)
+            flags="--connections --url --verbose"
+            valueflags="url"
+            ;;
+        doctor)
+            flags="--config --crash-dir --lint --live --repair --strict-lint --unused-after --url"
+            valueflags="crash-dir lint unused-after url"
+            ;;
+        sessions)
+            flags="--destroy --group --routes --url --variables"
+            valueflags="group url"
+            ;;
+        drain-session)
+            flags="--grace --message --url"
+            valueflags="grace message url"
+            kinds=(session)
+            ;;
+        gc)
+            flags="--session --url"
+            valueflags="session url"
+            ;;
+        viewdefs)
+            flags="--since --stats --url"
+            valueflags="url"
+            ;;
+        headless)
+            flags="--assert-state --dir -o"
+            valueflags="assert-state dir o"
+            kinds=(file)
+            ;;
+        bench)
+            flags="--duration --json --sessions --updates-per-sec --url"
+            valueflags="duration sessions updates-per-sec url"
+            ;;
+        bundle)
+            flags="--add --cache-dir --compression --fingerprint -o --src --strict-lint"
+            valueflags="cache-dir compression o src"
+            kinds=(dir)
+            ;;
+        extract)
+            flags="--demo --force --include"
+            valueflags="include"
+            kinds=(dir)
+            ;;
+        ls)
+            ;;
+        cat)
+            kinds=(bundle-file)
+            ;;
+        cp)
+            kinds=(bundle-file dir)
+            ;;
+        verify)
+            kinds=(file)
+            ;;
+        rm)
+            flags="-o --src"
+            valueflags="o src"
+            kinds=(bundle-file)
+            ;;
+        create)
+            flags="--nowatch --parent --props --props-file --socket --strict --unbound --value --value-file"
+            valueflags="parent props props-file socket value value-file"
+            ;;
+        destroy)
+            flags="--id --socket --strict"
+            valueflags="id socket"
+            ;;
+        update)
+            flags="--id --props --props-file --remove-prop --session --socket --strict --value --value-file"
+            valueflags="id props props-file remove-prop session socket value value-file"
+            ;;
+        watch)
+            flags="--follow --id --socket --strict --timeout"
+            valueflags="id socket timeout"
+            ;;
+        unwatch)
+            flags="--id --socket --strict"
+            valueflags="id socket"
+            ;;
+        get)
+            flags="--socket --strict"
+            valueflags="socket"
+            ;;
+        getObjects)
+            flags="--socket --strict"
+            valueflags="socket"
+            ;;
+        poll)
+            flags="--max-bytes --max-messages --max-wait --socket --strict --wait"
+            valueflags="max-bytes max-messages max-wait socket wait"
+            ;;
+        flush)
+            flags="--socket --strict"
+            valueflags="socket"
+            kinds=(session)
+            ;;
+        getRoots)
+            flags="--socket --strict"
+            valueflags="socket"
+            kinds=(session)
+            ;;
+        trace)
+            flags="--duration --file --off --on --session --socket --strict"
+            valueflags="duration session socket"
+            ;;
+        batch)
+            flags="--fail-fast --socket"
+            valueflags="socket"
+            kinds=(file)
+            ;;
+        gen-test)
+            flags="--ignore --name -o --package --session --site"
+            valueflags="ignore name o package session site"
+            kinds=(file)
+            ;;
+        completion)
+            kinds=(shell)
+            ;;
+    esac
+    local p="${prev#-}"
+    p="${p#-}"
+    if [[ $prev == -* && " $valueflags " == *" $p "* ]]; then
+        case "$cmd $p" in
+        "serve dir") _ui_engine_values dir ;;
+        "serve lua-path") _ui_engine_values dir ;;
+        "serve socket") _ui_engine_values file ;;
+        "doctor lint") _ui_engine_values dir ;;
+        "sessions group") _ui_engine_values group ;;
+        "gc session") _ui_engine_values session ;;
+        "headless assert-state") _ui_engine_values file ;;
+        "headless dir") _ui_engine_values dir ;;
+        "headless o") _ui_engine_values file ;;
+        "bundle cache-dir") _ui_engine_values dir ;;
+        "bundle o") _ui_engine_values file ;;
+        "bundle src") _ui_engine_values file ;;
+        "rm o") _ui_engine_values file ;;
+        "rm src") _ui_engine_values file ;;
+        "create socket") _ui_engine_values file ;;
+        "destroy socket") _ui_engine_values file ;;
+        "update socket") _ui_engine_values file ;;
+        "watch socket") _ui_engine_values file ;;
+        "unwatch socket") _ui_engine_values file ;;
+        "get socket") _ui_engine_values file ;;
+        "getObjects socket") _ui_engine_values file ;;
+        "poll socket") _ui_engine_values file ;;
+        "flush socket") _ui_engine_values file ;;
+        "getRoots socket") _ui_engine_values file ;;
+        "trace session") _ui_engine_values session ;;
+        "trace socket") _ui_engine_values file ;;
+        "batch socket") _ui_engine_values file ;;
+        "gen-test o") _ui_engine_values file ;;
+        "gen-test site") _ui_engine_values dir ;;
+        esac
+        return
+    fi
+    if [[ $cur == -* ]]; then
+        COMPREPLY=($(compgen -W "$flags" -- "$cur"))
+        return
+    fi
+    local i w n=0
+    for ((i = 2; i < COMP_CWORD; i++)); do
+        w="${COMP_WORDS[i]}"
+        if [[ $w == -* ]]; then
+            w="${w#-}"
+            w="${w#-}"
+            [[ $w != *=* && " $valueflags " == *" $w "* ]] && ((i++))
+        else
+            ((n++))
+        fi
+    done
+    if ((${#kinds[@]})); then
+        ((n >= ${#kinds[@]})) && n=$((${#kinds[@]} - 1))
+        _ui_engine_values "${kinds[n]}"
+    fi
+}
+
+complete -F _ui_engine ui-engine
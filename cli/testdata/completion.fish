@@ -0,0 +1,192 @@
+# fish completion for ui-engine
+# Load with: ui-engine completion fish | source
+
+# Prints how many positional arguments follow the command
+function __ui_engine_args
+    set -l n 0
+    for t in (commandline -opc)[3..-1]
+        string match -q -- '-*' $t; or set n (math $n + 1)
+    end
+    echo $n
+end
+
+complete -c ui-engine -f
+complete -c ui-engine -n __fish_use_subcommand -a serve -d 'Start the UI server (default)'
+complete -c ui-engine -n __fish_use_subcommand -a status -d 'Show handler metrics of a running server'
+complete -c ui-engine -n __fish_use_subcommand -a doctor -d 'Check a running server (--live) or site Lua code (--lint)'
+complete -c ui-engine -n __fish_use_subcommand -a sessions -d 'List a running server\'s sessions and groups (--group, --destroy, --routes)'
+complete -c ui-engine -n __fish_use_subcommand -a drain-session -d 'Show a banner in a session, then end it after --grace'
+complete -c ui-engine -n __fish_use_subcommand -a gc -d 'Collect a session\'s unreachable objects and show before/after counts'
+complete -c ui-engine -n __fish_use_subcommand -a viewdefs -d 'List a running server\'s viewdefs (ls [--stats [--since]])'
+complete -c ui-engine -n __fish_use_subcommand -a headless -d 'Run a Lua script in a session with no frontend and print or check its state (run [--assert-state])'
+complete -c ui-engine -n __fish_use_subcommand -a bench -d 'Load test a running server over WebSockets'
+complete -c ui-engine -n __fish_use_subcommand -a bundle -d 'Create binary with custom site bundled (diff [old] <new> compares, patch <files> replaces, verify [binary] checks, cache-stats/cache-prune manage the chunk cache)'
+complete -c ui-engine -n __fish_use_subcommand -a extract -d 'Extract bundled site (or --demo) to filesystem'
+complete -c ui-engine -n __fish_use_subcommand -a ls -d 'List files in bundled site'
+complete -c ui-engine -n __fish_use_subcommand -a cat -d 'Display contents of a bundled file'
+complete -c ui-engine -n __fish_use_subcommand -a cp -d 'Copy files from bundled site'
+complete -c ui-engine -n __fish_use_subcommand -a verify -d 'Check a bundled binary (this one by default) against its manifest, file by file'
+complete -c ui-engine -n __fish_use_subcommand -a rm -d 'Remove files from bundled site (in place, or to -o)'
+complete -c ui-engine -n __fish_use_subcommand -a create -d 'Create a new variable'
+complete -c ui-engine -n __fish_use_subcommand -a destroy -d 'Destroy a variable'
+complete -c ui-engine -n __fish_use_subcommand -a update -d 'Update a variable'
+complete -c ui-engine -n __fish_use_subcommand -a watch -d 'Watch a variable'
+complete -c ui-engine -n __fish_use_subcommand -a unwatch -d 'Stop watching a variable'
+complete -c ui-engine -n __fish_use_subcommand -a get -d 'Get variable values'
+complete -c ui-engine -n __fish_use_subcommand -a getObjects -d 'Get object values'
+complete -c ui-engine -n __fish_use_subcommand -a poll -d 'Poll for pending responses'
+complete -c ui-engine -n __fish_use_subcommand -a flush -d 'Wait until a session\'s queued work and updates settle'
+complete -c ui-engine -n __fish_use_subcommand -a getRoots -d 'List a session\'s named root variables'
+complete -c ui-engine -n __fish_use_subcommand -a trace -d 'Log one session\'s messages in full for a while (--session, --on/--off, --duration, --file)'
+complete -c ui-engine -n __fish_use_subcommand -a batch -d 'Send newline-delimited messages over one connection (--fail-fast)'
+complete -c ui-engine -n __fish_use_subcommand -a gen-test -d 'Convert a recorded session (NDJSON) into a Go test'
+complete -c ui-engine -n __fish_use_subcommand -a completion -d 'Print a shell completion script (bash, zsh or fish)'
+complete -c ui-engine -n __fish_use_subcommand -a help -d 'Show help'
+complete -c ui-engine -n __fish_use_subcommand -a version -d 'Show version'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l a11y-audit -d 'Audit viewdefs for accessibility problems on load'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l asset-dirs -r -d 'Comma-separated top-level site directories served at /_bundle/'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l crash-dir -r -d 'Directory for crash bundles'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l crash-keep -r -d 'Number of crash bundles to keep'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l csp -r -d 'Content-Security-Policy for pages (script nonces are added)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l demo -r -d 'Serve the built-in demo site when there is no bundle or --dir: on or off'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l dir -r -a '(__fish_complete_directories)' -d 'Serve from directory instead of embedded site'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l hibernate-dir -r -d 'Directory for hibernated sessions'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l hibernate-retention -r -d 'How long hibernated sessions are kept'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l host -r -d 'Browser listen address'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l hotload -d 'Watch lua directory for changes'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l idle-action -r -d 'What happens to expired sessions: destroy or hibernate'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l key-style -r -d 'Map frontend path keys to Lua fields: camel'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l log-error-window -r -d 'Log a variable\'s repeated error once per window (0=log every one)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l log-level -r -d 'Log level (debug, info, warn, error) or component verbosities (protocol=2,viewdef=4)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l log-max-value -r -d 'Max bytes of a logged value (0=unlimited)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l log-redact -r -d 'Comma-separated property names/paths to redact in logs'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l lua -d 'Enable Lua backend'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l lua-path -r -a '(__fish_complete_directories)' -d 'Lua scripts directory'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l metrics -d 'Record handler timing, served at /metrics'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l no-bundle-fallback -d 'Serve only --dir, without falling back to the bundle for missing files'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l port -r -d 'Browser listen port'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l port-retry -r -d 'Try up to N following ports if the port is busy'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l session-timeout -r -d 'Session expiration (0=never)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l socket -r -F -d 'Backend API socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l static-cache -r -d 'Cache-Control for static files, e.g. max-age=3600 (default no-cache)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l strict -d 'Reject unknown message fields and warn about unknown properties'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -s v -d 'Verbosity level (use -v, -vv, or -vvv)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l verify-bundle -d 'Check the bundle against its manifest and refuse to start if it fails'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l ws-batch-window -r -d 'Send a WebSocket connection\'s messages together once this passes after the first (0=send each at once)'
+complete -c ui-engine -n '__fish_seen_subcommand_from serve' -l ws-compression -d 'Compress WebSocket messages with per-message deflate'
+complete -c ui-engine -n '__fish_seen_subcommand_from status' -l connections -d 'List backend socket connections'
+complete -c ui-engine -n '__fish_seen_subcommand_from status' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from status' -l verbose -d 'Show per-message-type timing'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l config -d 'Check the serve configuration (config file, UI_* variables, and serve flags after --)'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l crash-dir -r -d 'Crash bundle directory (default: $UI_CRASH_DIR or the server default)'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l lint -r -a '(__fish_complete_directories)' -d 'Lint the Lua code of a site directory'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l live -d 'Check the live server\'s watch tables'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l repair -d 'Remove orphaned watch entries (with --live)'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l strict-lint -d 'Treat Lua lint warnings as errors (with --lint)'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l unused-after -r -d 'Flag viewdef types unused for this long (with --live)'
+complete -c ui-engine -n '__fish_seen_subcommand_from doctor' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from sessions' -l destroy -d 'Destroy every session in --group'
+complete -c ui-engine -n '__fish_seen_subcommand_from sessions' -l group -r -a '(ui-engine __complete group)' -d 'Only show sessions in this group'
+complete -c ui-engine -n '__fish_seen_subcommand_from sessions' -l routes -d 'Also list each session\'s registered URL paths'
+complete -c ui-engine -n '__fish_seen_subcommand_from sessions' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from sessions' -l variables -d 'Also count each session\'s variables'
+complete -c ui-engine -n '__fish_seen_subcommand_from drain-session' -l grace -r -d 'Time before new variables are refused and the session is destroyed'
+complete -c ui-engine -n '__fish_seen_subcommand_from drain-session' -l message -r -d 'Banner shown in the session\'s pages'
+complete -c ui-engine -n '__fish_seen_subcommand_from drain-session' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from drain-session' -a '(ui-engine __complete session)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gc' -l session -r -a '(ui-engine __complete session)' -d 'Session to collect (vended ID)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gc' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from viewdefs' -l since -d 'Reset usage counters after listing, so later stats count from now'
+complete -c ui-engine -n '__fish_seen_subcommand_from viewdefs' -l stats -d 'Show per-type usage: viewdefs sent and variables created'
+complete -c ui-engine -n '__fish_seen_subcommand_from viewdefs' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from headless' -l assert-state -r -F -d 'JSON file the final app state must match'
+complete -c ui-engine -n '__fish_seen_subcommand_from headless' -l dir -r -a '(__fish_complete_directories)' -d 'Site directory (default: the bundled site)'
+complete -c ui-engine -n '__fish_seen_subcommand_from headless' -s o -r -F -d 'Write the final app state to a file (default: stdout, unless --assert-state)'
+complete -c ui-engine -n '__fish_seen_subcommand_from headless' -F
+complete -c ui-engine -n '__fish_seen_subcommand_from bench' -l duration -r -d 'How long to send updates'
+complete -c ui-engine -n '__fish_seen_subcommand_from bench' -l json -d 'Print the report as JSON'
+complete -c ui-engine -n '__fish_seen_subcommand_from bench' -l sessions -r -d 'Number of concurrent sessions'
+complete -c ui-engine -n '__fish_seen_subcommand_from bench' -l updates-per-sec -r -d 'Updates per second sent by each session'
+complete -c ui-engine -n '__fish_seen_subcommand_from bench' -l url -r -d 'Server base URL'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l add -d 'Add or replace the given files (relative to the current directory) in the source\'s bundle'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l cache-dir -r -a '(__fish_complete_directories)' -d 'Directory of compressed files reused across bundles ("" disables)'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l compression -r -d 'Compression for text files: none, fast, default or best (images and fonts are stored)'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l fingerprint -d 'Rename html/ scripts, styles, images and fonts to include a content hash and rewrite references to them'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -s o -r -F -d 'Output path for bundled binary (required)'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l src -r -F -d 'Source binary to bundle (default: current executable)'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -l strict-lint -d 'Treat Lua lint warnings as errors'
+complete -c ui-engine -n '__fish_seen_subcommand_from bundle' -a '(__fish_complete_directories)'
+complete -c ui-engine -n '__fish_seen_subcommand_from extract' -l demo -d 'Extract the built-in demo site, a starter template for new sites'
+complete -c ui-engine -n '__fish_seen_subcommand_from extract' -l force -d 'Extract even if the disk looks too full'
+complete -c ui-engine -n '__fish_seen_subcommand_from extract' -l include -r -d 'Extract only bundle paths matching this glob, or files under matching directories (repeatable)'
+complete -c ui-engine -n '__fish_seen_subcommand_from extract' -a '(__fish_complete_directories)'
+complete -c ui-engine -n '__fish_seen_subcommand_from cat' -a '(ui-engine __complete bundle-file)'
+complete -c ui-engine -n '__fish_seen_subcommand_from cp; and test (__ui_engine_args) -eq 0' -a '(ui-engine __complete bundle-file)'
+complete -c ui-engine -n '__fish_seen_subcommand_from cp; and test (__ui_engine_args) -ge 1' -a '(__fish_complete_directories)'
+complete -c ui-engine -n '__fish_seen_subcommand_from verify' -F
+complete -c ui-engine -n '__fish_seen_subcommand_from rm' -s o -r -F -d 'Output path for the new binary (default: rewrite the source in place)'
+complete -c ui-engine -n '__fish_seen_subcommand_from rm' -l src -r -F -d 'Bundled binary to remove files from (default: current executable)'
+complete -c ui-engine -n '__fish_seen_subcommand_from rm' -a '(ui-engine __complete bundle-file)'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l nowatch -d 'Do not watch the new variable'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l parent -r -d 'Parent variable ID'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l props -r -d 'Properties (JSON object or key=value,...)'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l props-file -r -d 'File holding the properties (JSON object)'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l unbound -d 'Store the variable in the UI server only'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l value -r -d 'Initial value (JSON, or - to read stdin)'
+complete -c ui-engine -n '__fish_seen_subcommand_from create' -l value-file -r -d 'File holding the initial value (JSON)'
+complete -c ui-engine -n '__fish_seen_subcommand_from destroy' -l id -r -d 'Variable ID (or pass it as an argument)'
+complete -c ui-engine -n '__fish_seen_subcommand_from destroy' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from destroy' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l id -r -d 'Variable ID'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l props -r -d 'Properties (JSON object or key=value,...)'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l props-file -r -d 'File holding the properties (JSON object)'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l remove-prop -r -d 'Property to remove (repeatable)'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l session -r -d 'Session to update (vended ID), for Lua-bound variables'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l value -r -d 'New value (JSON, or - to read stdin)'
+complete -c ui-engine -n '__fish_seen_subcommand_from update' -l value-file -r -d 'File holding the new value (JSON)'
+complete -c ui-engine -n '__fish_seen_subcommand_from watch' -l follow -d 'Keep the connection open and print each message as a JSON line'
+complete -c ui-engine -n '__fish_seen_subcommand_from watch' -l id -r -d 'Variable ID (or pass it as an argument)'
+complete -c ui-engine -n '__fish_seen_subcommand_from watch' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from watch' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from watch' -l timeout -r -d 'Stop following after this long (0 = until interrupted)'
+complete -c ui-engine -n '__fish_seen_subcommand_from unwatch' -l id -r -d 'Variable ID (or pass it as an argument)'
+complete -c ui-engine -n '__fish_seen_subcommand_from unwatch' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from unwatch' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from get' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from get' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from getObjects' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from getObjects' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l max-bytes -r -d 'Most message bytes to return (0=server default)'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l max-messages -r -d 'Most messages to return (0=server default)'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l max-wait -r -d 'Longest wait the client accepts as a hint'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from poll' -l wait -r -d 'Long-poll duration'
+complete -c ui-engine -n '__fish_seen_subcommand_from flush' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from flush' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from flush' -a '(ui-engine __complete session)'
+complete -c ui-engine -n '__fish_seen_subcommand_from getRoots' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from getRoots' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from getRoots' -a '(ui-engine __complete session)'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l duration -r -d 'Stop tracing after this long'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l file -d 'Also write the trace to a file under logging.trace_dir'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l off -d 'Stop tracing'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l on -d 'Start tracing'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l session -r -a '(ui-engine __complete session)' -d 'Session to trace (vended ID)'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from trace' -l strict -d 'Check the message strictly, even if the server is not strict'
+complete -c ui-engine -n '__fish_seen_subcommand_from batch' -l fail-fast -d 'Stop at the first response with an error'
+complete -c ui-engine -n '__fish_seen_subcommand_from batch' -l socket -r -F -d 'Server socket path'
+complete -c ui-engine -n '__fish_seen_subcommand_from batch' -F
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -l ignore -r -d 'Comma-separated JSON paths to skip when matching, e.g. result.*.time'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -l name -r -d 'Test function name (default: from the recording\'s name)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -s o -r -F -d 'Output file (default: stdout)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -l package -r -d 'Package of the test (default: the output directory\'s name + _test)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -l session -r -d 'Recorded session ID to normalize (default: from a start record)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -l site -r -a '(__fish_complete_directories)' -d 'Site directory the test serves (default: an empty app)'
+complete -c ui-engine -n '__fish_seen_subcommand_from gen-test' -F
+complete -c ui-engine -n '__fish_seen_subcommand_from completion' -a '(ui-engine __complete shell)'
@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/zot/ui-engine/internal/server"
+)
+
+type viewdefsOptions struct {
+	url   string
+	stats bool
+	since bool
+}
+
+func (o *viewdefsOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&o.url, "url", "http://127.0.0.1:8080", "Server base URL")
+	fs.BoolVar(&o.stats, "stats", false, "Show per-type usage: viewdefs sent and variables created")
+	fs.BoolVar(&o.since, "since", false, "Reset usage counters after listing, so later stats count from now")
+}
+
+// runViewdefs lists a running server's viewdefs and their usage (viewdefs ls).
+func runViewdefs(args []string) int {
+	if len(args) > 0 && args[0] == "ls" {
+		args = args[1:]
+	}
+	var opts viewdefsOptions
+	fs := flag.NewFlagSet("viewdefs", flag.ContinueOnError)
+	opts.bind(fs)
+	if err := fs.Parse(args); err != nil {
+		return 1
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: ui-engine viewdefs ls [--stats] [--since] [--url <server>]")
+		return 1
+	}
+
+	list, err := fetchViewdefs(opts.url, opts.since)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if !opts.stats {
+		for _, key := range list.Keys {
+			fmt.Println(key)
+		}
+	} else {
+		fmt.Printf("usage since %s\n", list.Usage.Since.Local().Format(time.DateTime))
+		fmt.Printf("%-30s %8s %8s %s\n", "TYPE", "SENT", "CREATED", "LAST USED")
+		for _, typ := range slices.Sorted(maps.Keys(list.Usage.Types)) {
+			u := list.Usage.Types[typ]
+			lastUsed := "never"
+			if !u.LastUsed.IsZero() {
+				lastUsed = u.LastUsed.Local().Format(time.DateTime)
+			}
+			fmt.Printf("%-30s %8d %8d %s\n", typ, u.Sent, u.Created, lastUsed)
+		}
+	}
+	if opts.since {
+		fmt.Println("usage counters reset")
+	}
+	return 0
+}
+
+// fetchViewdefs retrieves a running server's viewdefs and usage, resetting the
+// usage counters if reset is set.
+func fetchViewdefs(baseURL string, reset bool) (*server.ViewdefList, error) {
+	method := http.MethodGet
+	if reset {
+		method = http.MethodDelete
+	}
+	req, err := http.NewRequest(method, baseURL+"/api/debug/viewdefs", nil)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach server at %s: %w", baseURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("viewdef list unavailable (HTTP %d)", resp.StatusCode)
+	}
+	var list server.ViewdefList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return &list, nil
+}
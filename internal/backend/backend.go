@@ -65,6 +65,23 @@ type Backend interface {
 	// Returns the list of destroyed variable IDs (children before parents).
 	DestroyVariable(varID int64) []int64
 
+	// CreateUnbound stores a variable the UI server is the source of truth for.
+	// Unbound variables are never resolved against the tracker.
+	CreateUnbound(id, parentID int64, value json.RawMessage, properties map[string]string) error
+
+	// GetUnbound returns a copy of an unbound variable, or nil if varID is not unbound.
+	GetUnbound(varID int64) *UnboundVariable
+
+	// UpdateUnbound stores an update to an unbound variable; false if varID is not unbound.
+	UpdateUnbound(varID int64, value json.RawMessage, properties map[string]string, removed []string) bool
+
+	// DeferWatch remembers a watch on a variable that does not exist yet.
+	DeferWatch(varID int64)
+
+	// ResolveDeferredWatches queues full updates for deferred variables that now exist.
+	// Returns the resolved variable IDs.
+	ResolveDeferredWatches() []int64
+
 	// SetInactive marks a variable as inactive (updates not relayed).
 	SetInactive(varID int64, inactive bool)
 
@@ -0,0 +1,38 @@
+// CRC: crc-LuaBackend.md
+// Spec: protocol.md (Variable 1 pending)
+package backend
+
+// DeferWatch records a watch on a variable that does not exist yet, such as
+// variable 1 before a connected backend creates it. The watch itself is already
+// counted by Watch; this only remembers to send the value once it appears.
+func (lb *LuaBackend) DeferWatch(varID int64) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.deferred[varID] = struct{}{}
+}
+
+// ResolveDeferredWatches marks deferred variables that now exist as fully
+// changed so the next change detection sends them to their watchers.
+// Deferred watches that were unwatched in the meantime are dropped.
+// Returns the resolved variable IDs.
+func (lb *LuaBackend) ResolveDeferredWatches() []int64 {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	var resolved []int64
+	for varID := range lb.deferred {
+		if lb.watchCounts[varID] == 0 {
+			delete(lb.deferred, varID)
+			continue
+		}
+		v := lb.tracker.GetVariable(varID)
+		if v == nil {
+			continue
+		}
+		delete(lb.deferred, varID)
+		v.SetActive(true)
+		lb.tracker.ChangeAll(varID)
+		resolved = append(resolved, varID)
+	}
+	return resolved
+}
@@ -18,10 +18,13 @@ type LuaBackend struct {
 	config            *config.Config
 	sessionID         string
 	tracker           *changetracker.Tracker
-	watchCounts       map[int64]int      // variable ID -> observer count
-	watchers          map[int64][]string // variable ID -> connection IDs
-	inactiveVariables map[int64]struct{} // variable IDs marked inactive
-	varToSession      map[int64]struct{} // track variables owned by this session
+	watchCounts       map[int64]int              // variable ID -> observer count
+	watchers          map[int64][]string         // variable ID -> connection IDs
+	inactiveVariables map[int64]struct{}         // variable IDs marked inactive
+	varToSession      map[int64]struct{}         // track variables owned by this session
+	unbound           map[int64]*UnboundVariable // variables the UI server is the source of truth for
+	deferred          map[int64]struct{}         // watched variable IDs that do not exist yet
+	firstWatch        func(varID int64)          // called after a variable's first watch
 	mu                sync.RWMutex
 }
 
@@ -32,7 +35,7 @@ type LuaBackend struct {
 func NewLuaBackend(cfg *config.Config, sessionID string, resolver changetracker.Resolver) *LuaBackend {
 	tracker := changetracker.NewTracker()
 	tracker.Resolver = resolver
-	tracker.DiagLevel = cfg.Logging.Verbosity
+	tracker.DiagLevel = cfg.ComponentVerbosity(config.LogLua)
 
 	return &LuaBackend{
 		config:            cfg,
@@ -42,12 +45,14 @@ func NewLuaBackend(cfg *config.Config, sessionID string, resolver changetracker.
 		watchers:          make(map[int64][]string),
 		inactiveVariables: make(map[int64]struct{}),
 		varToSession:      make(map[int64]struct{}),
+		unbound:           make(map[int64]*UnboundVariable),
+		deferred:          make(map[int64]struct{}),
 	}
 }
 
 // Log logs a message via the config.
 func (lb *LuaBackend) Log(level int, format string, args ...interface{}) {
-	lb.config.Log(level, format, args...)
+	lb.config.Logger(config.LogLua).Log(level, format, args...)
 }
 
 // GetSessionID returns the session ID.
@@ -66,7 +71,6 @@ func (lb *LuaBackend) GetTracker() *changetracker.Tracker {
 // Sequence: seq-backend-watch.md
 func (lb *LuaBackend) Watch(varID int64, connectionID string) WatchResult {
 	lb.mu.Lock()
-	defer lb.mu.Unlock()
 
 	prevCount := lb.watchCounts[varID]
 	lb.watchCounts[varID] = prevCount + 1
@@ -92,6 +96,14 @@ func (lb *LuaBackend) Watch(varID int64, connectionID string) WatchResult {
 		}
 	}
 
+	firstWatch := lb.firstWatch
+	lb.mu.Unlock()
+
+	// Outside the lock: the hook may create variables (lazy presenters)
+	if prevCount == 0 && firstWatch != nil {
+		firstWatch(varID)
+	}
+
 	// For LuaBackend, we don't forward watch messages since we handle variables locally
 	// ShouldForward would be true for ProxiedBackend
 	return WatchResult{
@@ -100,6 +112,14 @@ func (lb *LuaBackend) Watch(varID int64, connectionID string) WatchResult {
 	}
 }
 
+// SetFirstWatchHook sets a function called, on the watching goroutine, after a
+// variable goes from zero to one watcher.
+func (lb *LuaBackend) SetFirstWatchHook(hook func(varID int64)) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.firstWatch = hook
+}
+
 // Unwatch removes an observer from a variable.
 // Returns UnwatchResult indicating if the unwatch should be forwarded (for bound variables).
 func (lb *LuaBackend) Unwatch(varID int64, connectionID string) UnwatchResult {
@@ -311,6 +331,8 @@ func (lb *LuaBackend) Shutdown() {
 	lb.watchers = nil
 	lb.inactiveVariables = nil
 	lb.varToSession = nil
+	lb.unbound = nil
+	lb.deferred = nil
 }
 
 // DestroyVariable removes a variable and all its descendants.
@@ -325,11 +347,19 @@ func (lb *LuaBackend) DestroyVariable(varID int64) []int64 {
 
 	collect = func(id int64) {
 		v := lb.tracker.GetVariable(id)
-		if v == nil {
+		_, unbound := lb.unbound[id]
+		if v == nil && !unbound {
 			return
 		}
-		for _, childID := range v.ChildIDs {
-			collect(childID)
+		if v != nil {
+			for _, childID := range v.ChildIDs {
+				collect(childID)
+			}
+		}
+		for childID, u := range lb.unbound {
+			if u.ParentID == id {
+				collect(childID)
+			}
 		}
 		destroyed = append(destroyed, id)
 	}
@@ -338,6 +368,7 @@ func (lb *LuaBackend) DestroyVariable(varID int64) []int64 {
 	// Remove all from tracker and maps
 	for _, id := range destroyed {
 		lb.tracker.DestroyVariable(id)
+		delete(lb.unbound, id)
 		delete(lb.varToSession, id)
 		delete(lb.watchCounts, id)
 		delete(lb.watchers, id)
@@ -348,6 +379,45 @@ func (lb *LuaBackend) DestroyVariable(varID int64) []int64 {
 	return destroyed
 }
 
+// CheckWatches compares watch entries against tracker and unbound variables.
+// Returns the IDs that are watched but no longer exist.
+// When repair is set, those watch entries are removed.
+func (lb *LuaBackend) CheckWatches(repair bool) []int64 {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	var orphans []int64
+	for varID := range lb.watchers {
+		if !lb.existsLocked(varID) {
+			orphans = append(orphans, varID)
+		}
+	}
+	for varID := range lb.watchCounts {
+		if _, listed := lb.watchers[varID]; !listed && !lb.existsLocked(varID) {
+			orphans = append(orphans, varID)
+		}
+	}
+	if repair {
+		for _, varID := range orphans {
+			delete(lb.watchers, varID)
+			delete(lb.watchCounts, varID)
+			delete(lb.inactiveVariables, varID)
+		}
+	}
+	if len(orphans) > 0 {
+		lb.Log(1, "Session %s: %d orphaned watches %v (repaired: %v)", lb.sessionID, len(orphans), orphans, repair)
+	}
+	return orphans
+}
+
+// existsLocked reports whether varID is a tracker or unbound variable.
+// Deferred watches count as existing; their variable is expected later.
+func (lb *LuaBackend) existsLocked(varID int64) bool {
+	_, unbound := lb.unbound[varID]
+	_, deferred := lb.deferred[varID]
+	return unbound || deferred || lb.tracker.GetVariable(varID) != nil
+}
+
 // ClearDescendants removes all descendant variables of the given root.
 // Used when a page reconnects to clear stale child variables.
 func (lb *LuaBackend) ClearDescendants(rootID int64) {
@@ -0,0 +1,73 @@
+// CRC: crc-LuaBackend.md
+// Spec: protocol.md (Source of truth responsibilities)
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+)
+
+// UnboundVariable is a variable the UI server is the source of truth for.
+// It is never resolved against the tracker, so it does not depend on the Lua session.
+type UnboundVariable struct {
+	ID         int64
+	ParentID   int64
+	Value      json.RawMessage
+	Properties map[string]string
+}
+
+// CreateUnbound stores a new unbound variable.
+// Returns an error if the ID is already used by a tracker or unbound variable.
+func (lb *LuaBackend) CreateUnbound(id, parentID int64, value json.RawMessage, properties map[string]string) error {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if _, exists := lb.unbound[id]; exists || lb.tracker.GetVariable(id) != nil {
+		return fmt.Errorf("variable ID %d already in use", id)
+	}
+	lb.unbound[id] = &UnboundVariable{
+		ID:         id,
+		ParentID:   parentID,
+		Value:      value,
+		Properties: maps.Clone(properties),
+	}
+	lb.varToSession[id] = struct{}{}
+	return nil
+}
+
+// GetUnbound returns a copy of an unbound variable, or nil if varID is not unbound.
+func (lb *LuaBackend) GetUnbound(varID int64) *UnboundVariable {
+	lb.mu.RLock()
+	defer lb.mu.RUnlock()
+
+	v := lb.unbound[varID]
+	if v == nil {
+		return nil
+	}
+	return &UnboundVariable{ID: v.ID, ParentID: v.ParentID, Value: v.Value, Properties: maps.Clone(v.Properties)}
+}
+
+// UpdateUnbound stores an update to an unbound variable.
+// A nil value leaves the value unchanged; properties are merged, then removed ones deleted.
+// Returns false if varID is not unbound.
+func (lb *LuaBackend) UpdateUnbound(varID int64, value json.RawMessage, properties map[string]string, removed []string) bool {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	v := lb.unbound[varID]
+	if v == nil {
+		return false
+	}
+	if value != nil {
+		v.Value = value
+	}
+	if len(properties) > 0 && v.Properties == nil {
+		v.Properties = make(map[string]string)
+	}
+	maps.Copy(v.Properties, properties)
+	for _, name := range removed {
+		delete(v.Properties, name)
+	}
+	return true
+}
@@ -6,7 +6,10 @@ package bundle
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"io/fs"
@@ -15,6 +18,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 const (
@@ -26,6 +30,21 @@ const (
 
 var IGNORE_FILES = regexp.MustCompile(`^(|.*/)((#|\.#)[^/]*|[^/]*~)$`)
 
+// executable returns the path of the binary whose bundle is read; tests replace it
+var executable = os.Executable
+
+// fallback is used as the bundle when the binary carries none (see SetFallback)
+var fallback atomic.Pointer[zip.Reader]
+
+// SetFallback sets content to use as the bundle when the binary carries none,
+// such as the built-in demo site. Pass nil to remove it.
+func SetFallback(reader *zip.Reader) {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	fallback.Store(reader)
+	current.Store(nil)
+}
+
 // Footer contains metadata about the bundled ZIP
 type Footer struct {
 	Magic  [8]byte // "UISERVER"
@@ -38,6 +57,35 @@ type Footer struct {
 // siteDir: directory containing site files
 // outputPath: path for the bundled binary
 func CreateBundle(sourceBinary, siteDir, outputPath string) error {
+	return CreateBundleWithOptions(sourceBinary, siteDir, outputPath, Options{})
+}
+
+// CreateBundleCached creates a bundled binary like CreateBundle, taking the
+// compressed contents of files from chunks when it has them and adding the
+// rest. A nil chunks compresses every file.
+func CreateBundleCached(sourceBinary, siteDir, outputPath string, chunks *ChunkCache) error {
+	return CreateBundleWithOptions(sourceBinary, siteDir, outputPath, Options{Chunks: chunks})
+}
+
+// Options controls how CreateBundleWithOptions builds a bundle.
+type Options struct {
+	Chunks      *ChunkCache // Reused compressed files (nil compresses every file)
+	Compression Compression
+	Fingerprint bool // Rename html/ assets to include their content hash (see fingerprintSite)
+}
+
+// CreateBundleWithOptions creates a bundled binary like CreateBundle, as opts says.
+func CreateBundleWithOptions(sourceBinary, siteDir, outputPath string, opts Options) error {
+	chunks := opts.Chunks
+	if opts.Fingerprint {
+		dir, err := fingerprintSite(siteDir)
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint assets: %w", err)
+		}
+		defer os.RemoveAll(dir)
+		siteDir = dir
+	}
+
 	// Get the size of the executable portion (excluding any existing bundle)
 	binarySize, err := GetBinarySize(sourceBinary)
 	if err != nil {
@@ -51,12 +99,17 @@ func CreateBundle(sourceBinary, siteDir, outputPath string) error {
 	}
 	defer srcFile.Close()
 
-	// Create output file
-	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	// Write beside the output and rename over it once complete, so a server
+	// running from outputPath keeps its file until it reloads the bundle
+	outFile, err := os.CreateTemp(filepath.Dir(outputPath), "."+filepath.Base(outputPath)+"-*")
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
+	defer os.Remove(outFile.Name())
 	defer outFile.Close()
+	if err := outFile.Chmod(0755); err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
 
 	// Copy only the executable portion (without any existing bundle)
 	if _, err := io.CopyN(outFile, srcFile, binarySize); err != nil {
@@ -66,13 +119,24 @@ func CreateBundle(sourceBinary, siteDir, outputPath string) error {
 	// Create ZIP in memory
 	var zipBuf bytes.Buffer
 	zipWriter := zip.NewWriter(&zipBuf)
+	opts.Compression.register(zipWriter)
 
 	// Add site files to ZIP
-	if err := addDirToZip(zipWriter, siteDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, siteDir, "", chunks, opts.Compression); err != nil {
 		zipWriter.Close()
 		return fmt.Errorf("failed to add files to ZIP: %w", err)
 	}
 
+	// Add the manifest Verify checks the files against
+	sums, err := dirChecksums(siteDir)
+	if err == nil {
+		err = writeManifest(zipWriter, sums, opts.Compression.method(ManifestName))
+	}
+	if err != nil {
+		zipWriter.Close()
+		return fmt.Errorf("failed to add %s: %w", ManifestName, err)
+	}
+
 	if err := zipWriter.Close(); err != nil {
 		return fmt.Errorf("failed to close ZIP writer: %w", err)
 	}
@@ -86,27 +150,25 @@ func CreateBundle(sourceBinary, siteDir, outputPath string) error {
 	}
 
 	// Write footer
-	footer := Footer{
-		Offset: binarySize,
-		Size:   zipSize,
+	if err := writeFooter(outFile, binarySize, zipSize); err != nil {
+		return err
 	}
-	copy(footer.Magic[:], MagicMarker)
-
-	if err := binary.Write(outFile, binary.LittleEndian, footer.Offset); err != nil {
-		return fmt.Errorf("failed to write offset: %w", err)
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
 	}
-	if err := binary.Write(outFile, binary.LittleEndian, footer.Size); err != nil {
-		return fmt.Errorf("failed to write size: %w", err)
+	if err := os.Rename(outFile.Name(), outputPath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", outputPath, err)
 	}
-	if _, err := outFile.Write(footer.Magic[:]); err != nil {
-		return fmt.Errorf("failed to write magic: %w", err)
+	if chunks != nil {
+		return chunks.saveStats()
 	}
-
 	return nil
 }
 
-// addDirToZip recursively adds directory contents to ZIP, preserving relative symlinks
-func addDirToZip(zipWriter *zip.Writer, sourceDir, basePath string) error {
+// addDirToZip recursively adds directory contents to ZIP, preserving relative symlinks.
+// Regular files are compressed as compression says, deflated ones through
+// chunks when it is not nil.
+func addDirToZip(zipWriter *zip.Writer, sourceDir, basePath string, chunks *ChunkCache, compression Compression) error {
 	absSourceDir, err := filepath.Abs(sourceDir)
 	if err != nil {
 		return fmt.Errorf("failed to get absolute path of source: %w", err)
@@ -131,6 +193,9 @@ func addDirToZip(zipWriter *zip.Writer, sourceDir, basePath string) error {
 		// Create ZIP path with forward slashes
 		zipPath := filepath.Join(basePath, relPath)
 		zipPath = filepath.ToSlash(zipPath)
+		if zipPath == ManifestName {
+			return nil // Generated by CreateBundle
+		}
 
 		// Check if this is a symlink
 		linfo, err := os.Lstat(filePath)
@@ -143,15 +208,19 @@ func addDirToZip(zipWriter *zip.Writer, sourceDir, basePath string) error {
 		}
 
 		// Regular file - preserve mode
-		return addRegularFileToZip(zipWriter, filePath, zipPath, linfo.Mode())
+		method := compression.method(zipPath)
+		if chunks != nil && method == zip.Deflate {
+			return chunks.addFile(zipWriter, filePath, zipPath, linfo.Mode(), compression.level())
+		}
+		return addRegularFileToZip(zipWriter, filePath, zipPath, linfo.Mode(), method)
 	})
 }
 
 // addRegularFileToZip adds a regular file to the ZIP archive with mode preservation
-func addRegularFileToZip(zipWriter *zip.Writer, filePath, zipPath string, mode fs.FileMode) error {
+func addRegularFileToZip(zipWriter *zip.Writer, filePath, zipPath string, mode fs.FileMode, method uint16) error {
 	header := &zip.FileHeader{
 		Name:   zipPath,
-		Method: zip.Deflate,
+		Method: method,
 	}
 	header.SetMode(mode)
 
@@ -275,52 +344,25 @@ func GetBinarySize(binaryPath string) (int64, error) {
 	return fileSize, nil
 }
 
-// IsBundled checks if the current binary has bundled content.
+// IsBundled checks if the current binary has bundled content, or a fallback is set.
 func IsBundled() (bool, error) {
-	exePath, err := os.Executable()
-	if err != nil {
-		return false, err
-	}
-
-	file, err := os.Open(exePath)
-	if err != nil {
-		return false, err
-	}
-	defer file.Close()
+	reader, err := GetBundleReader()
+	return reader != nil, err
+}
 
-	info, err := file.Stat()
+// GetBundleReader returns a zip.Reader for the bundled content, or the fallback.
+// Returns nil if the binary is not bundled and there is no fallback.
+func GetBundleReader() (*zip.Reader, error) {
+	idx, err := loadIndex()
 	if err != nil {
-		return false, err
-	}
-
-	fileSize := info.Size()
-	if fileSize < FooterSize {
-		return false, nil
-	}
-
-	// Read footer
-	if _, err := file.Seek(fileSize-FooterSize, 0); err != nil {
-		return false, err
-	}
-
-	var footer Footer
-	if err := binary.Read(file, binary.LittleEndian, &footer.Offset); err != nil {
-		return false, nil
-	}
-	if err := binary.Read(file, binary.LittleEndian, &footer.Size); err != nil {
-		return false, nil
-	}
-	if _, err := file.Read(footer.Magic[:]); err != nil {
-		return false, nil
+		return nil, err
 	}
-
-	return bytes.Equal(footer.Magic[:], []byte(MagicMarker)), nil
+	return idx.reader, nil
 }
 
-// GetBundleReader returns a zip.Reader for the bundled content.
-// Returns nil if the binary is not bundled.
-func GetBundleReader() (*zip.Reader, error) {
-	exePath, err := os.Executable()
+// readBundle returns a zip.Reader for the binary's bundle, or nil if it has none.
+func readBundle() (*zip.Reader, error) {
+	exePath, err := executable()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get executable path: %w", err)
 	}
@@ -329,7 +371,14 @@ func GetBundleReader() (*zip.Reader, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to open executable: %w", err)
 	}
-	defer file.Close()
+	// The executable stays open while its bundle is in use, so files are read
+	// from it on demand rather than held in memory
+	keep := false
+	defer func() {
+		if !keep {
+			file.Close()
+		}
+	}()
 
 	info, err := file.Stat()
 	if err != nil {
@@ -362,82 +411,84 @@ func GetBundleReader() (*zip.Reader, error) {
 		return nil, nil
 	}
 
-	// Read ZIP data
-	if _, err := file.Seek(footer.Offset, 0); err != nil {
-		return nil, fmt.Errorf("failed to seek to ZIP data: %w", err)
-	}
-
-	zipData := make([]byte, footer.Size)
-	if _, err := io.ReadFull(file, zipData); err != nil {
-		return nil, fmt.Errorf("failed to read ZIP data: %w", err)
+	if footer.Offset < 0 || footer.Size < 0 || footer.Offset+footer.Size > fileSize-FooterSize {
+		return nil, fmt.Errorf("bundle footer points outside the executable")
 	}
 
-	// Open ZIP reader
-	zipReader, err := zip.NewReader(bytes.NewReader(zipData), footer.Size)
+	// Open ZIP reader over the bundle's part of the executable
+	zipReader, err := zip.NewReader(io.NewSectionReader(file, footer.Offset, footer.Size), footer.Size)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open ZIP reader: %w", err)
 	}
-
+	keep = true
 	return zipReader, nil
 }
 
 // ExtractBundle extracts bundled content to a directory.
 func ExtractBundle(targetDir string) error {
-	zipReader, err := GetBundleReader()
-	if err != nil {
-		return err
-	}
-	if zipReader == nil {
-		return fmt.Errorf("binary is not bundled")
-	}
-
-	for _, f := range zipReader.File {
-		if err := extractZipFile(f, targetDir); err != nil {
-			return fmt.Errorf("failed to extract %s: %w", f.Name, err)
-		}
-	}
-
-	return nil
+	return ExtractBundleWithOptions(targetDir, ExtractOptions{})
 }
 
 // extractZipFile extracts a single file or symlink from ZIP
 func extractZipFile(f *zip.File, targetDir string) error {
+	_, err := extractEntry(f, targetDir)
+	return err
+}
+
+// extractEntry extracts a single file or symlink from ZIP, returning a file's
+// SHA-256 ("" for a symlink).
+func extractEntry(f *zip.File, targetDir string) (string, error) {
 	targetPath := filepath.Join(targetDir, f.Name)
 
 	absTargetDir, err := filepath.Abs(targetDir)
 	if err != nil {
-		return err
+		return "", err
 	}
 	absTargetPath, err := filepath.Abs(targetPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if !isWithinDir(absTargetPath, absTargetDir) {
-		return fmt.Errorf("zip entry escapes target directory: %s", f.Name)
+		return "", fmt.Errorf("zip entry escapes target directory: %s", f.Name)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-		return err
+		return "", err
 	}
 
 	if f.Mode()&os.ModeSymlink != 0 {
-		return extractSymlink(f, targetPath, absTargetDir)
+		return "", extractSymlink(f, targetPath, absTargetDir)
 	}
+	return writeZipFile(f, targetPath)
+}
 
+// writeZipFile writes a file through a temporary file renamed into place once
+// complete, so a failure leaves no partial file behind. Returns its SHA-256.
+func writeZipFile(f *zip.File, targetPath string) (string, error) {
 	rc, err := f.Open()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer rc.Close()
 
-	outFile, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
+	tmpPath := targetPath + ".ui-extract-tmp"
+	outFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
 	if err != nil {
-		return err
+		return "", err
 	}
-	defer outFile.Close()
-
-	_, err = io.Copy(outFile, rc)
-	return err
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(outFile, h), rc)
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, targetPath)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
 }
 
 // extractSymlink extracts a symlink from ZIP
@@ -536,13 +587,14 @@ func readSymlinkTarget(f *zip.File) string {
 	return string(targetBytes)
 }
 
-// ReadFile reads a file from the bundle.
+// ReadFile reads a file from the bundle. Small files are served from a cache
+// after their first read (see SetCacheSize).
 func ReadFile(name string) ([]byte, error) {
-	zipReader, err := GetBundleReader()
+	idx, err := loadIndex()
 	if err != nil {
 		return nil, err
 	}
-	if zipReader == nil {
+	if idx.reader == nil {
 		return nil, fmt.Errorf("binary is not bundled")
 	}
 
@@ -550,18 +602,11 @@ func ReadFile(name string) ([]byte, error) {
 	name = path.Clean(name)
 	name = strings.TrimPrefix(name, "/")
 
-	for _, f := range zipReader.File {
-		if f.Name == name {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, err
-			}
-			defer rc.Close()
-			return io.ReadAll(rc)
-		}
+	data, found, err := idx.read(name)
+	if !found {
+		return nil, fmt.Errorf("file not found: %s", name)
 	}
-
-	return nil, fmt.Errorf("file not found: %s", name)
+	return data, err
 }
 
 // ListFilesInDir returns files in a subdirectory of the bundle (non-recursive).
@@ -574,126 +619,212 @@ func ListFilesInDirRecursive(dir string) ([]string, error) {
 	return listFilesInDir(dir, true)
 }
 
-// listFilesInDir is the shared implementation for directory listing.
+// listFilesInDir lists a bundle directory through FS, returning bundle paths.
+// A missing directory has no files.
 func listFilesInDir(dir string, recursive bool) ([]string, error) {
-	zipReader, err := GetBundleReader()
+	dir = strings.Trim(path.Clean(dir), "/")
+	fsys, err := FS(dir)
 	if err != nil {
 		return nil, err
 	}
-	if zipReader == nil {
-		return nil, fmt.Errorf("binary is not bundled")
-	}
-
-	dir = normalizeDirPath(dir)
 
 	var files []string
-	for _, f := range zipReader.File {
-		if !strings.HasPrefix(f.Name, dir) || f.FileInfo().IsDir() {
-			continue
-		}
-		if recursive {
-			files = append(files, f.Name)
-			continue
+	err = fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
 		}
-		// Non-recursive: only include files directly in this directory
-		relPath := strings.TrimPrefix(f.Name, dir)
-		if relPath != "" && !strings.Contains(relPath, "/") {
-			files = append(files, f.Name)
+		if !d.IsDir() {
+			files = append(files, path.Join(dir, name))
+		} else if name != "." && !recursive {
+			return fs.SkipDir
 		}
+		return nil
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
 	}
-	return files, nil
+	return files, err
 }
 
-// normalizeDirPath cleans and normalizes a directory path for bundle lookup.
-func normalizeDirPath(dir string) string {
-	dir = path.Clean(dir)
-	dir = strings.TrimPrefix(dir, "/")
-	if dir != "" && !strings.HasSuffix(dir, "/") {
-		dir += "/"
+// FS returns a read-only filesystem rooted at prefix inside the bundle, or at
+// the bundle's top for "". It implements fs.ReadDirFS and fs.StatFS, so
+// fs.ReadDir, fs.Stat and fs.WalkDir work on it.
+func FS(prefix string) (fs.FS, error) {
+	zipReader, err := GetBundleReader()
+	if err != nil {
+		return nil, err
+	}
+	if zipReader == nil {
+		return nil, fmt.Errorf("binary is not bundled")
 	}
-	return dir
+	return NewZipFileSystemWithPrefix(zipReader, prefix), nil
 }
 
 // ZipFileSystem implements fs.FS for serving files from a ZIP archive.
 // Files are served from the html/ subdirectory within the ZIP.
 type ZipFileSystem struct {
 	reader *zip.Reader
-	prefix string // Subdirectory prefix (e.g., "html")
+	prefix string               // Subdirectory prefix (e.g., "html")
+	files  map[string]*zip.File // Entries by name
 }
 
 // NewZipFileSystem creates a new ZipFileSystem from a zip.Reader.
 // Files are served from the html/ subdirectory.
 func NewZipFileSystem(reader *zip.Reader) *ZipFileSystem {
-	return &ZipFileSystem{reader: reader, prefix: "html"}
+	return NewZipFileSystemWithPrefix(reader, "html")
 }
 
 // NewZipFileSystemWithPrefix creates a ZipFileSystem with a custom prefix.
 func NewZipFileSystemWithPrefix(reader *zip.Reader, prefix string) *ZipFileSystem {
-	return &ZipFileSystem{reader: reader, prefix: prefix}
+	files := make(map[string]*zip.File, len(reader.File))
+	for _, f := range reader.File {
+		if _, ok := files[f.Name]; !ok {
+			files[f.Name] = f
+		}
+	}
+	return &ZipFileSystem{reader: reader, prefix: prefix, files: files}
 }
 
-// Open implements fs.FS interface.
+// Open implements fs.FS interface. Files stream from the ZIP rather than
+// being read into memory, and seek, as http.FileServer needs; directories
+// implement fs.ReadDirFile.
 func (zfs *ZipFileSystem) Open(name string) (fs.File, error) {
-	// Clean the path and remove leading slash
-	name = strings.TrimPrefix(path.Clean(name), "/")
-	if name == "." {
-		name = ""
-	}
-
-	// Build target path with prefix (e.g., "html/index.html")
-	targetPath := name
-	if zfs.prefix != "" {
-		if name == "" {
-			targetPath = zfs.prefix
-		} else {
-			targetPath = zfs.prefix + "/" + name
-		}
+	target, err := zfs.bundlePath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := zfs.reader.Open(target)
+	if err != nil {
+		return nil, renamePathError(err, name)
+	}
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		return f, err
+	}
+	f.Close()
+	entry := zfs.files[target]
+	if entry == nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
 	}
+	return openZipFile(entry, info)
+}
 
-	// Find the file in ZIP
-	for _, f := range zfs.reader.File {
-		if f.Name == targetPath && !f.FileInfo().IsDir() {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, err
-			}
-
-			// Read entire file content
-			content, err := io.ReadAll(rc)
-			rc.Close()
-			if err != nil {
-				return nil, err
-			}
-
-			return &zipFile{
-				name:    filepath.Base(name),
-				content: content,
-				reader:  bytes.NewReader(content),
-				info:    f.FileInfo(),
-			}, nil
-		}
+// ReadDir implements fs.ReadDirFS.
+func (zfs *ZipFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	target, err := zfs.bundlePath("readdir", name)
+	if err != nil {
+		return nil, err
 	}
+	entries, err := fs.ReadDir(zfs.reader, target)
+	return entries, renamePathError(err, name)
+}
 
-	return nil, fs.ErrNotExist
+// Stat implements fs.StatFS.
+func (zfs *ZipFileSystem) Stat(name string) (fs.FileInfo, error) {
+	target, err := zfs.bundlePath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(zfs.reader, target)
+	return info, renamePathError(err, name)
+}
+
+// bundlePath maps name to its path in the ZIP, rejecting names that are not
+// valid fs.FS paths (so none can leave the root).
+func (zfs *ZipFileSystem) bundlePath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	return path.Join(zfs.prefix, name), nil
+}
+
+// renamePathError reports a path error under the caller's name rather than the
+// prefixed one.
+func renamePathError(err error, name string) error {
+	if pathErr, ok := err.(*fs.PathError); ok {
+		return &fs.PathError{Op: pathErr.Op, Path: name, Err: pathErr.Err}
+	}
+	return err
 }
 
-// zipFile implements fs.File interface
+// zipFile is an open bundle file. A stored entry reads and seeks through its
+// section of the bundle; a compressed one streams from the ZIP reader and
+// seeks by restarting the stream and skipping ahead, so neither is held in
+// memory.
 type zipFile struct {
-	name    string
-	content []byte
-	reader  *bytes.Reader
-	info    fs.FileInfo
+	entry  *zip.File
+	info   fs.FileInfo
+	stored io.ReadSeeker // The entry's data, for stored entries
+	stream io.ReadCloser // Decompressing reader, for other entries
+	pos    int64         // Offset of stream
+}
+
+// openZipFile opens entry for reading.
+func openZipFile(entry *zip.File, info fs.FileInfo) (*zipFile, error) {
+	zf := &zipFile{entry: entry, info: info}
+	if entry.Method == zip.Store {
+		raw, err := entry.OpenRaw()
+		if err != nil {
+			return nil, err
+		}
+		if stored, ok := raw.(io.ReadSeeker); ok {
+			zf.stored = stored
+			return zf, nil
+		}
+	}
+	stream, err := entry.Open()
+	if err != nil {
+		return nil, err
+	}
+	zf.stream = stream
+	return zf, nil
 }
 
 func (zf *zipFile) Read(p []byte) (int, error) {
-	return zf.reader.Read(p)
+	if zf.stored != nil {
+		return zf.stored.Read(p)
+	}
+	n, err := zf.stream.Read(p)
+	zf.pos += int64(n)
+	return n, err
 }
 
 func (zf *zipFile) Seek(offset int64, whence int) (int64, error) {
-	return zf.reader.Seek(offset, whence)
+	if zf.stored != nil {
+		return zf.stored.Seek(offset, whence)
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += zf.pos
+	case io.SeekEnd:
+		offset += zf.info.Size()
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: zf.entry.Name, Err: fs.ErrInvalid}
+	}
+	if offset < zf.pos {
+		stream, err := zf.entry.Open()
+		if err != nil {
+			return 0, err
+		}
+		zf.stream.Close()
+		zf.stream, zf.pos = stream, 0
+	}
+	if skip := min(offset, zf.info.Size()) - zf.pos; skip > 0 {
+		n, err := io.CopyN(io.Discard, zf.stream, skip)
+		zf.pos += n
+		if err != nil {
+			return zf.pos, err
+		}
+	}
+	zf.pos = offset
+	return offset, nil
 }
 
 func (zf *zipFile) Close() error {
+	if zf.stream != nil {
+		return zf.stream.Close()
+	}
 	return nil
 }
 
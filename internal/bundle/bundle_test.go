@@ -4,10 +4,22 @@ package bundle
 import (
 	"archive/zip"
 	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 )
 
 func TestAddDirToZip_RegularFiles(t *testing.T) {
@@ -29,7 +41,7 @@ func TestAddDirToZip_RegularFiles(t *testing.T) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	if err := addDirToZip(zipWriter, tmpDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, tmpDir, "", nil, CompressionDefault); err != nil {
 		t.Fatalf("addDirToZip failed: %v", err)
 	}
 	zipWriter.Close()
@@ -80,7 +92,7 @@ func TestAddDirToZip_RelativeSymlink(t *testing.T) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	if err := addDirToZip(zipWriter, tmpDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, tmpDir, "", nil, CompressionDefault); err != nil {
 		t.Fatalf("addDirToZip failed: %v", err)
 	}
 	zipWriter.Close()
@@ -148,7 +160,7 @@ func TestAddDirToZip_AbsoluteSymlink_Rejected(t *testing.T) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	err := addDirToZip(zipWriter, tmpDir, "")
+	err := addDirToZip(zipWriter, tmpDir, "", nil, CompressionDefault)
 	if err == nil {
 		t.Fatal("expected error for absolute symlink, got nil")
 	}
@@ -174,7 +186,7 @@ func TestAddDirToZip_EscapingSymlink_Rejected(t *testing.T) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	err := addDirToZip(zipWriter, tmpDir, "")
+	err := addDirToZip(zipWriter, tmpDir, "", nil, CompressionDefault)
 	if err == nil {
 		t.Fatal("expected error for escaping symlink, got nil")
 	}
@@ -208,7 +220,7 @@ func TestExtractBundle_WithSymlinks(t *testing.T) {
 	// Create ZIP in memory
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
-	if err := addDirToZip(zipWriter, srcDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, srcDir, "", nil, CompressionDefault); err != nil {
 		t.Fatal(err)
 	}
 	zipWriter.Close()
@@ -395,7 +407,7 @@ func TestAddDirToZip_PreservesExecutableBit(t *testing.T) {
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
 
-	if err := addDirToZip(zipWriter, tmpDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, tmpDir, "", nil, CompressionDefault); err != nil {
 		t.Fatalf("addDirToZip failed: %v", err)
 	}
 	zipWriter.Close()
@@ -439,7 +451,7 @@ func TestExtractBundle_PreservesExecutableBit(t *testing.T) {
 	// Create ZIP in memory
 	var buf bytes.Buffer
 	zipWriter := zip.NewWriter(&buf)
-	if err := addDirToZip(zipWriter, srcDir, ""); err != nil {
+	if err := addDirToZip(zipWriter, srcDir, "", nil, CompressionDefault); err != nil {
 		t.Fatal(err)
 	}
 	zipWriter.Close()
@@ -574,3 +586,934 @@ func TestValidateSymlinkTarget(t *testing.T) {
 		})
 	}
 }
+
+// zipOf returns a zip.Reader holding the given files.
+func zipOf(t testing.TB, files map[string]string) *zip.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return reader
+}
+
+// TestReadFileCache verifies ReadFile serves repeat reads from the cache,
+// evicts least recently used contents past the cache size, hands out copies,
+// and sees new content after SetFallback replaces the bundle
+func TestReadFileCache(t *testing.T) {
+	t.Cleanup(func() {
+		SetFallback(nil)
+		SetCacheSize(DefaultCacheSize)
+	})
+	SetCacheSize(800)
+	SetFallback(zipOf(t, map[string]string{
+		"lua/a.lua": strings.Repeat("a", 100),
+		"lua/b.lua": strings.Repeat("b", 100),
+		"big.txt":   strings.Repeat("x", 200),
+	}))
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, name := range []string{"lua/a.lua", "/lua/b.lua", "big.txt"} {
+				if _, err := ReadFile(name); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	idx, _ := loadIndex()
+	if _, ok := idx.cache.get("lua/a.lua"); !ok {
+		t.Error("lua/a.lua not cached")
+	}
+	if _, ok := idx.cache.get("big.txt"); ok {
+		t.Error("a file over an eighth of the cache size was cached")
+	}
+	if _, err := ReadFile("lua/missing.lua"); err == nil {
+		t.Error("reading a missing file succeeded")
+	}
+
+	data, _ := ReadFile("lua/a.lua")
+	data[0] = 'z'
+	if again, _ := ReadFile("lua/a.lua"); again[0] != 'a' {
+		t.Error("changing returned content changed the cache")
+	}
+
+	files := map[string]string{"lua/a.lua": "new a"}
+	for i := range 9 {
+		files[fmt.Sprintf("f%d", i)] = strings.Repeat("f", 200)
+	}
+	SetCacheSize(1600) // Room for eight 200-byte files
+	SetFallback(zipOf(t, files))
+	if data, _ := ReadFile("lua/a.lua"); string(data) != "new a" {
+		t.Errorf("after SetFallback read %q, want the new content", data)
+	}
+	for i := range 8 {
+		ReadFile(fmt.Sprintf("f%d", i))
+	}
+	ReadFile("f0")
+	ReadFile("f8") // Over the size, so f1, the least recently used, goes
+	idx, _ = loadIndex()
+	if _, ok := idx.cache.get("f1"); ok {
+		t.Error("least recently used content was not evicted")
+	}
+	if _, ok := idx.cache.get("f0"); !ok {
+		t.Error("recently used content was evicted")
+	}
+}
+
+// TestDiff verifies Diff reports files only in the bundle, only in the
+// directory, and in both with different content, and skips ignored files
+func TestDiff(t *testing.T) {
+	t.Cleanup(func() { SetFallback(nil) })
+	SetFallback(zipOf(t, map[string]string{
+		"html/index.html": "<html></html>",
+		"lua/main.lua":    "x = 1",
+		"lua/old.lua":     "old",
+	}))
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "html"), 0755)
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "html", "index.html"), []byte("<html></html>"), 0644)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte("x = 2"), 0644)
+	os.WriteFile(filepath.Join(dir, "lua", "new.lua"), []byte("new"), 0644)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua~"), []byte("backup"), 0644)
+
+	report, err := Diff(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Name != "lua/old.lua" {
+		t.Errorf("only in bundle: %+v", report.Removed)
+	}
+	if len(report.Added) != 1 || report.Added[0].Name != "lua/new.lua" {
+		t.Errorf("only in dir: %+v", report.Added)
+	}
+	if len(report.Modified) != 1 || report.Modified[0].Name != "lua/main.lua" || report.Modified[0].OldSum == report.Modified[0].NewSum {
+		t.Errorf("changed: %+v", report.Modified)
+	}
+
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte("x = 1"), 0644)
+	os.WriteFile(filepath.Join(dir, "lua", "old.lua"), []byte("old"), 0644)
+	os.Remove(filepath.Join(dir, "lua", "new.lua"))
+	if report, err := Diff(dir); err != nil || !report.Empty() {
+		t.Errorf("matching directory reported %+v, %v", report, err)
+	}
+}
+
+// TestDiffPaths verifies bundled binaries, plain ZIP files and site
+// directories compare by content with size deltas, a manifest supplying a
+// ZIP's sums when present
+func TestDiffPaths(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	writeSiteFile(t, site, "html/index.html", "<html></html>")
+	writeSiteFile(t, site, "lua/main.lua", "x = 1")
+	writeSiteFile(t, site, "lua/old.lua", "old")
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	bundled := filepath.Join(tmp, "bundled")
+	if err := CreateBundle(source, site, bundled); err != nil {
+		t.Fatal(err)
+	}
+
+	// A plain ZIP without a manifest is hashed on the fly
+	plain := filepath.Join(tmp, "plain.zip")
+	writeZip(t, plain, map[string]string{
+		"html/index.html": "<html></html>",
+		"lua/main.lua":    "x = 100",
+		"lua/new.lua":     "new",
+	})
+	report, err := DiffPaths(bundled, plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Name != "lua/old.lua" || report.Removed[0].OldSize != 3 {
+		t.Errorf("removed: %+v", report.Removed)
+	}
+	if len(report.Added) != 1 || report.Added[0].Name != "lua/new.lua" || report.Added[0].NewSize != 3 {
+		t.Errorf("added: %+v", report.Added)
+	}
+	if len(report.Modified) != 1 || report.Modified[0].Name != "lua/main.lua" || report.Modified[0].SizeDelta() != 2 {
+		t.Errorf("modified: %+v", report.Modified)
+	}
+	if s := report.Summary(); s != (DiffSummary{Added: 1, Removed: 1, Modified: 1, SizeDelta: 2}) {
+		t.Errorf("summary: %+v", s)
+	}
+
+	// The site itself matches its bundle; ignored files are skipped
+	writeSiteFile(t, site, "lua/main.lua~", "backup")
+	if report, err := DiffPaths(bundled, site); err != nil || !report.Empty() {
+		t.Errorf("bundle against its own site reported %+v, %v", report, err)
+	}
+
+	// A manifest's sums are used as given, without reading the files
+	manifested := filepath.Join(tmp, "manifested.zip")
+	writeZip(t, manifested, map[string]string{
+		"lua/main.lua": "tampered",
+		ManifestName:   fmt.Sprintf("%x  lua/main.lua\n", sha256.Sum256([]byte("x = 1"))),
+	})
+	sums, err := SiteSums(manifested)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256([]byte("x = 1"))); sums["lua/main.lua"].Sum != want || len(sums) != 1 {
+		t.Errorf("manifest sums = %+v", sums)
+	}
+
+	if _, err := DiffPaths(source, site); err == nil {
+		t.Error("an unbundled binary compared without error")
+	}
+}
+
+// writeZip writes a plain ZIP file of files.
+func writeZip(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestPatchBundle verifies patching replaces only the listed files, copies
+// the rest, refuses files not in the bundle without allowAdd, reports what
+// it replaced and added, and leaves a binary whose bundle reads back with
+// the expected checksums and verifies
+func TestPatchBundle(t *testing.T) {
+	original := map[string]string{
+		"html/index.html": "<html></html>",
+		"html/main.js":    "console.log(1)",
+		"lua/main.lua":    "x = 1",
+	}
+	tests := []struct {
+		name     string
+		changes  map[string]string // Site files written before patching
+		files    []string
+		allowAdd bool
+		want     map[string]string // Bundle content after patching; nil = error
+	}{
+		{"replace one", map[string]string{"html/main.js": "console.log(2)"}, []string{"html/main.js"}, false,
+			map[string]string{"html/index.html": "<html></html>", "html/main.js": "console.log(2)", "lua/main.lua": "x = 1"}},
+		{"replace two", map[string]string{"html/main.js": "js", "lua/main.lua": "x = 2"}, []string{"html/main.js", "lua/main.lua"}, false,
+			map[string]string{"html/index.html": "<html></html>", "html/main.js": "js", "lua/main.lua": "x = 2"}},
+		{"add refused", map[string]string{"lua/new.lua": "new"}, []string{"lua/new.lua"}, false, nil},
+		{"add allowed", map[string]string{"lua/new.lua": "new"}, []string{"lua/new.lua"}, true,
+			map[string]string{"html/index.html": "<html></html>", "html/main.js": "console.log(1)", "lua/main.lua": "x = 1", "lua/new.lua": "new"}},
+		{"outside site", nil, []string{"../escape.txt"}, true, nil},
+		{"missing file", nil, []string{"html/gone.js"}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmp := t.TempDir()
+			site := filepath.Join(tmp, "site")
+			for name, content := range original {
+				writeSiteFile(t, site, name, content)
+			}
+			source := filepath.Join(tmp, "binary")
+			os.WriteFile(source, []byte("executable part"), 0755)
+			bundled := filepath.Join(tmp, "bundled")
+			if err := CreateBundle(source, site, bundled); err != nil {
+				t.Fatal(err)
+			}
+			for name, content := range tt.changes {
+				writeSiteFile(t, site, name, content)
+			}
+
+			patched := filepath.Join(tmp, "patched")
+			report, err := PatchBundle(bundled, patched, site, tt.files, tt.allowAdd)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatal("patch succeeded, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.files {
+				_, existed := original[name]
+				if slices.Contains(report.Replaced, name) != existed || slices.Contains(report.Added, name) == existed {
+					t.Errorf("%s reported in %+v, existed %v", name, report, existed)
+				}
+			}
+			if size, _ := GetBinarySize(patched); size != int64(len("executable part")) {
+				t.Errorf("executable part is %d bytes, want %d", size, len("executable part"))
+			}
+			reader, file, err := openBundleFile(patched)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+			if err := verifyReader(reader); err != nil {
+				t.Errorf("patched bundle does not verify: %v", err)
+			}
+			got := make(map[string][32]byte)
+			for _, f := range reader.File {
+				if f.Name == ManifestName {
+					continue
+				}
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ := io.ReadAll(rc)
+				rc.Close()
+				got[f.Name] = sha256.Sum256(data)
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("bundle has %d files, want %d", len(got), len(tt.want))
+			}
+			for name, content := range tt.want {
+				if got[name] != sha256.Sum256([]byte(content)) {
+					t.Errorf("%s checksum differs from %q", name, content)
+				}
+			}
+		})
+	}
+}
+
+func writeSiteFile(t *testing.T, site, name, content string) {
+	t.Helper()
+	path := filepath.Join(site, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestVerify verifies a created bundle passes file by file, and that altered,
+// removed and added entries and a missing manifest are each reported
+func TestVerify(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	writeSiteFile(t, site, "html/index.html", "<html></html>")
+	writeSiteFile(t, site, "lua/main.lua", "x = 1")
+	writeSiteFile(t, site, ManifestName, "stale") // Replaced by the generated one
+	if err := os.Symlink("main.lua", filepath.Join(site, "lua", "app.lua")); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	bundled := filepath.Join(tmp, "bundled")
+	if err := CreateBundle(source, site, bundled); err != nil {
+		t.Fatal(err)
+	}
+	reader, file, err := openBundleFile(bundled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := verifyReader(reader); err != nil {
+		t.Fatalf("fresh bundle failed verification: %v", err)
+	}
+	checks, err := VerifyFiles(bundled)
+	if err != nil || len(checks) != 3 || checks[0].Name != "html/index.html" || !checks[0].Passed() {
+		t.Fatalf("VerifyFiles = %+v, %v; want 3 passing files by name", checks, err)
+	}
+	if _, err := VerifyFiles(source); err == nil || !strings.Contains(err.Error(), "not bundled") {
+		t.Errorf("VerifyFiles on an unbundled binary = %v", err)
+	}
+
+	// Rebuild the bundle with changes, keeping its manifest
+	rebuild := func(edit func(files map[string]string)) *zip.Reader {
+		files := make(map[string]string)
+		for _, f := range reader.File {
+			rc, _ := f.Open()
+			data, _ := io.ReadAll(rc)
+			rc.Close()
+			files[f.Name] = string(data)
+		}
+		edit(files)
+		return zipOf(t, files)
+	}
+	tests := []struct {
+		name string
+		edit func(files map[string]string)
+		want string
+	}{
+		{"corrupt", func(f map[string]string) { f["lua/main.lua"] = "x = 666" }, "corrupt: lua/main.lua"},
+		{"missing", func(f map[string]string) { delete(f, "html/index.html") }, "missing: html/index.html"},
+		{"unlisted", func(f map[string]string) { f["lua/evil.lua"] = "os.exit()" }, "not in manifest: lua/evil.lua"},
+		{"no manifest", func(f map[string]string) { delete(f, ManifestName) }, "has no " + ManifestName},
+	}
+	for _, tt := range tests {
+		err := verifyReader(rebuild(tt.edit))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Verify error = %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// TestFS verifies FS roots a read-only filesystem at a bundle directory that
+// lists, stats and opens directories, keeps names inside the root, and backs
+// ListFilesInDir
+func TestFS(t *testing.T) {
+	t.Cleanup(func() { SetFallback(nil) })
+	SetFallback(zipOf(t, map[string]string{
+		"html/index.html":           "<html></html>",
+		"lua/main.lua":              "x = 1",
+		"lua/lib/util.lua":          "return {}",
+		"viewdefs/App.DEFAULT.html": "<div></div>",
+	}))
+
+	lua, err := FS("lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(lua, "main.lua", "lib/util.lua"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fs.ReadDir(lua, ".")
+	if err != nil || len(entries) != 2 || entries[0].Name() != "lib" || !entries[0].IsDir() {
+		t.Fatalf("ReadDir(.) = %v, %v", entries, err)
+	}
+	if info, err := fs.Stat(lua, "lib/util.lua"); err != nil || info.Size() != 9 {
+		t.Errorf("Stat(lib/util.lua) = %v, %v", info, err)
+	}
+	if _, err := fs.Stat(lua, "../html/index.html"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Stat outside the root: %v, want fs.ErrInvalid", err)
+	}
+	if _, err := lua.Open("index.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(index.html) under lua: %v, want fs.ErrNotExist", err)
+	}
+	if f, err := NewZipFileSystem(mustReader(t)).Open("index.html"); err != nil {
+		t.Errorf("Open(index.html) from html: %v", err)
+	} else if _, ok := f.(io.Seeker); !ok {
+		t.Error("opened file cannot seek")
+	}
+
+	if files, err := ListFilesInDir("lua"); err != nil || fmt.Sprint(files) != "[lua/main.lua]" {
+		t.Errorf("ListFilesInDir(lua) = %v, %v", files, err)
+	}
+	if files, err := ListFilesInDirRecursive("/lua/"); err != nil || fmt.Sprint(files) != "[lua/lib/util.lua lua/main.lua]" {
+		t.Errorf("ListFilesInDirRecursive(/lua/) = %v, %v", files, err)
+	}
+	if files, err := ListFilesInDir("missing"); err != nil || files != nil {
+		t.Errorf("ListFilesInDir(missing) = %v, %v", files, err)
+	}
+}
+
+// TestOverlayFS verifies files come from the first layer that has them and
+// directories merge every layer's entries
+func TestOverlayFS(t *testing.T) {
+	dir := fstest.MapFS{
+		"html/index.html": {Data: []byte("mine")},
+		"lua/main.lua":    {Data: []byte("x = 2")},
+	}
+	zipFS := NewZipFileSystemWithPrefix(zipOf(t, map[string]string{
+		"html/index.html": "bundled",
+		"html/app.css":    "body {}",
+		"lua/session.lua": "return {}",
+	}), "")
+	overlay := OverlayFS{dir, zipFS}
+
+	if err := fstest.TestFS(overlay, "html/index.html", "html/app.css", "lua/main.lua", "lua/session.lua"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := fs.ReadFile(overlay, "html/index.html"); err != nil || string(data) != "mine" {
+		t.Errorf("index.html = %q, %v, want the directory's", data, err)
+	}
+	if data, err := fs.ReadFile(overlay, "html/app.css"); err != nil || string(data) != "body {}" {
+		t.Errorf("app.css = %q, %v, want the bundle's", data, err)
+	}
+	if _, err := overlay.Open("missing.html"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Open(missing.html): %v, want fs.ErrNotExist", err)
+	}
+}
+
+func mustReader(t testing.TB) *zip.Reader {
+	t.Helper()
+	reader, err := GetBundleReader()
+	if err != nil || reader == nil {
+		t.Fatalf("no bundle reader: %v", err)
+	}
+	return reader
+}
+
+// TestRemoveFiles verifies removing drops only matching files, copies the
+// rest byte for byte with a manifest that still verifies, rewrites in place
+// without an output, and writes nothing when no file matches
+func TestRemoveFiles(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	for name, content := range map[string]string{
+		"html/index.html":         "<html></html>",
+		"viewdefs/A.DEFAULT.html": "<div>a</div>",
+		"viewdefs/B.DEFAULT.html": "<div>b</div>",
+		"lua/main.lua":            "x = 1",
+	} {
+		writeSiteFile(t, site, name, content)
+	}
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	bundled := filepath.Join(tmp, "bundled")
+	if err := CreateBundle(source, site, bundled); err != nil {
+		t.Fatal(err)
+	}
+	rawEntries := func(path string) map[string][]byte {
+		t.Helper()
+		reader, file, err := openBundleFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := verifyReader(reader); err != nil {
+			t.Errorf("%s does not verify: %v", path, err)
+		}
+		entries := make(map[string][]byte)
+		for _, f := range reader.File {
+			if f.Name == ManifestName {
+				continue
+			}
+			r, err := f.OpenRaw()
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries[f.Name], _ = io.ReadAll(r)
+		}
+		return entries
+	}
+	before := rawEntries(bundled)
+
+	out := filepath.Join(tmp, "out")
+	removed, err := RemoveFiles(bundled, out, func(name string) bool { return strings.HasPrefix(name, "viewdefs/") })
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(removed)
+	if fmt.Sprint(removed) != "[viewdefs/A.DEFAULT.html viewdefs/B.DEFAULT.html]" {
+		t.Errorf("removed %v", removed)
+	}
+	after := rawEntries(out)
+	if len(after) != 2 {
+		t.Errorf("output has %d files, want 2", len(after))
+	}
+	for name, raw := range after {
+		if !bytes.Equal(raw, before[name]) {
+			t.Errorf("%s changed", name)
+		}
+	}
+
+	if removed, err := RemoveFiles(bundled, filepath.Join(tmp, "none"), func(string) bool { return false }); err != nil || removed != nil {
+		t.Errorf("no match = %v, %v", removed, err)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "none")); err == nil {
+		t.Error("output written when nothing matched")
+	}
+
+	if _, err := RemoveFiles(bundled, "", func(name string) bool { return name == "lua/main.lua" }); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rawEntries(bundled)["lua/main.lua"]; ok {
+		t.Error("in-place removal left lua/main.lua")
+	}
+	if info, err := os.Stat(bundled); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("in-place binary mode = %v, %v", info, err)
+	}
+}
+
+// TestChunkCache verifies bundling reuses cached compressed files, recompresses
+// changed or damaged ones, produces bundles that read back and verify, keeps
+// hit counts across runs, and prunes chunks unused past the age limit
+func TestChunkCache(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	writeSiteFile(t, site, "html/index.html", strings.Repeat("<p>hello</p>", 100))
+	writeSiteFile(t, site, "lua/main.lua", "x = 1")
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	cacheDir := filepath.Join(tmp, "cache")
+
+	build := func(wantHits, wantMisses int64) {
+		t.Helper()
+		chunks := NewChunkCache(cacheDir)
+		out := filepath.Join(tmp, "bundled")
+		if err := CreateBundleCached(source, site, out, chunks); err != nil {
+			t.Fatal(err)
+		}
+		if chunks.Hits() != wantHits || chunks.Misses() != wantMisses {
+			t.Errorf("hits/misses = %d/%d, want %d/%d", chunks.Hits(), chunks.Misses(), wantHits, wantMisses)
+		}
+		reader, file, err := openBundleFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if err := verifyReader(reader); err != nil {
+			t.Errorf("cached bundle does not verify: %v", err)
+		}
+	}
+	build(0, 2)
+	build(2, 0)
+	writeSiteFile(t, site, "lua/main.lua", "x = 2")
+	build(1, 1)
+	sum := sha256.Sum256([]byte(strings.Repeat("<p>hello</p>", 100)))
+	damaged := filepath.Join(cacheDir, fmt.Sprintf("%x", sum)+chunkSuffix)
+	os.WriteFile(damaged, []byte("not deflate"), 0644)
+	build(1, 1)
+
+	stats, err := NewChunkCache(cacheDir).Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 3 || stats.Hits != 4 || stats.Misses != 4 || stats.HitRate() != 0.5 {
+		t.Errorf("stats = %+v", stats)
+	}
+
+	old := time.Now().Add(-DefaultChunkMaxAge - time.Hour)
+	os.Chtimes(damaged, old, old)
+	removed, freed, err := NewChunkCache(cacheDir).Prune(DefaultChunkMaxAge)
+	if err != nil || removed != 1 || freed == 0 {
+		t.Errorf("Prune = %d, %d, %v, want 1 chunk removed", removed, freed, err)
+	}
+	if stats, _ := NewChunkCache(filepath.Join(tmp, "missing")).Stats(); stats != (ChunkStats{}) {
+		t.Errorf("missing cache stats = %+v", stats)
+	}
+}
+
+// TestBundleCompression verifies stored bundles serve through ZipFileSystem,
+// already-compressed assets are stored, and best beats the default level
+func TestBundleCompression(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	var text strings.Builder
+	for i := range 2000 {
+		fmt.Fprintf(&text, "<li class=\"item-%d\">entry %d of the list</li>\n", i%37, i*7919%1000)
+	}
+	writeSiteFile(t, site, "html/index.html", text.String())
+	writeSiteFile(t, site, "html/logo.png", strings.Repeat("png", 100))
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+
+	build := func(compression Compression) (*zip.Reader, int64) {
+		t.Helper()
+		out := filepath.Join(tmp, string(compression))
+		if err := CreateBundleWithOptions(source, site, out, Options{Compression: compression}); err != nil {
+			t.Fatal(err)
+		}
+		reader, file, err := openBundleFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { file.Close() })
+		var size int64
+		for _, f := range reader.File {
+			if f.Name == "html/logo.png" && f.Method != zip.Store {
+				t.Errorf("%s: logo.png method = %d, want stored", compression, f.Method)
+			}
+			size += int64(f.CompressedSize64)
+		}
+		return reader, size
+	}
+
+	stored, storedSize := build(CompressionNone)
+	for _, f := range stored.File {
+		if f.Method != zip.Store {
+			t.Errorf("none: %s method = %d, want stored", f.Name, f.Method)
+		}
+	}
+	data, err := fs.ReadFile(NewZipFileSystemWithPrefix(stored, "html"), "index.html")
+	if err != nil || string(data) != text.String() {
+		t.Errorf("stored index.html = %d bytes, %v", len(data), err)
+	}
+	_, defaultSize := build(CompressionDefault)
+	_, bestSize := build(CompressionBest)
+	if !(bestSize < defaultSize && defaultSize < storedSize) {
+		t.Errorf("sizes best/default/none = %d/%d/%d", bestSize, defaultSize, storedSize)
+	}
+	if _, err := ParseCompression("max"); err == nil {
+		t.Error("ParseCompression accepted max")
+	}
+}
+
+// bundleWith builds a bundle holding html/<name> = content, compressed as
+// compression, and returns its site filesystem.
+func bundleWith(t testing.TB, name string, content []byte, compression Compression) *ZipFileSystem {
+	t.Helper()
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	os.MkdirAll(filepath.Join(site, "html"), 0755)
+	if err := os.WriteFile(filepath.Join(site, "html", name), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	out := filepath.Join(tmp, "bundled")
+	if err := CreateBundleWithOptions(source, site, out, Options{Compression: compression}); err != nil {
+		t.Fatal(err)
+	}
+	reader, file, err := openBundleFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return NewZipFileSystem(reader)
+}
+
+// TestZipFileStreaming verifies stored and deflated bundle files seek
+// correctly and answer HTTP range requests, stored ones straight from the
+// bundle's section of the file
+func TestZipFileStreaming(t *testing.T) {
+	content := make([]byte, 100_000)
+	for i := range content {
+		content[i] = byte('a' + i*7%26)
+	}
+	for _, compression := range []Compression{CompressionNone, CompressionDefault} {
+		zfs := bundleWith(t, "data.txt", content, compression)
+		if err := fstest.TestFS(zfs, "data.txt"); err != nil {
+			t.Errorf("%s: %v", compression, err)
+		}
+		f, err := zfs.Open("data.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored := f.(*zipFile).stored != nil; stored != (compression == CompressionNone) {
+			t.Errorf("%s: served from the bundle section = %v", compression, stored)
+		}
+		f.Close()
+
+		server := http.FileServer(http.FS(zfs))
+		req := httptest.NewRequest("GET", "/data.txt", nil)
+		req.Header.Set("Range", "bytes=50000-50099")
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != http.StatusPartialContent || !bytes.Equal(rec.Body.Bytes(), content[50000:50100]) {
+			t.Errorf("%s: range request = %d, %q", compression, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+// discardResponse is a ResponseWriter that drops the body, so serving does
+// not buffer it.
+type discardResponse struct{ header http.Header }
+
+func (d *discardResponse) Header() http.Header         { return d.header }
+func (d *discardResponse) Write(p []byte) (int, error) { return len(p), nil }
+func (d *discardResponse) WriteHeader(int)             {}
+
+// BenchmarkServeLargeStoredEntry serves a 64 MB stored entry and a range of
+// it; B/op stays near the copy buffer size rather than the entry's size
+func BenchmarkServeLargeStoredEntry(b *testing.B) {
+	const size = 64 << 20
+	server := http.FileServer(http.FS(bundleWith(b, "video.mp4", make([]byte, size), CompressionNone)))
+	full := httptest.NewRequest("GET", "/video.mp4", nil)
+	ranged := httptest.NewRequest("GET", "/video.mp4", nil)
+	ranged.Header.Set("Range", "bytes=33554432-34603007")
+	b.SetBytes(size)
+	b.ReportAllocs()
+	for b.Loop() {
+		server.ServeHTTP(&discardResponse{header: http.Header{}}, full)
+		server.ServeHTTP(&discardResponse{header: http.Header{}}, ranged)
+	}
+}
+
+// TestReload verifies Reload picks up a site bundled over the executable,
+// while a filesystem opened on the old bundle still reads the old content
+func TestReload(t *testing.T) {
+	tmp := t.TempDir()
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	exe := filepath.Join(tmp, "app")
+	bundleSite := func(content string) {
+		site := filepath.Join(tmp, "site-"+content)
+		writeSiteFile(t, site, "html/index.html", content)
+		if err := CreateBundle(source, site, exe); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		indexMu.Lock()
+		executable, exeBundle = os.Executable, sync.OnceValues(readBundle)
+		indexMu.Unlock()
+		Invalidate()
+	})
+	indexMu.Lock()
+	executable = func() (string, error) { return exe, nil }
+	indexMu.Unlock()
+
+	os.WriteFile(exe, []byte("unbundled"), 0755)
+	if _, err := Reload(); err == nil || !strings.Contains(err.Error(), "not bundled") {
+		t.Fatalf("Reload of an unbundled binary = %v", err)
+	}
+
+	bundleSite("v1")
+	reader, err := Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := NewZipFileSystem(reader)
+	if data, _ := ReadFile("html/index.html"); string(data) != "v1" {
+		t.Fatalf("after first reload read %q", data)
+	}
+
+	bundleSite("v2")
+	if _, err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ReadFile("html/index.html"); string(data) != "v2" {
+		t.Errorf("after second reload read %q, want v2", data)
+	}
+	if data, err := fs.ReadFile(old, "index.html"); err != nil || string(data) != "v1" {
+		t.Errorf("old bundle read %q, %v; want v1", data, err)
+	}
+}
+
+// TestFingerprint verifies --fingerprint renames html/ assets by content hash,
+// rewrites HTML, CSS and viewdef references to them, leaves lua/ and
+// viewdefs/ names alone, and publishes the manifest through AssetManifest
+func TestFingerprint(t *testing.T) {
+	tmp := t.TempDir()
+	site := filepath.Join(tmp, "site")
+	writeSiteFile(t, site, "html/index.html", `<link href="/css/app.css"><script src="app.js?v=1"></script><a href="https://x.test/app.js">`)
+	writeSiteFile(t, site, "html/app.js", "console.log(1)")
+	writeSiteFile(t, site, "html/css/app.css", `body { background: url("../img/bg.png") }`)
+	writeSiteFile(t, site, "html/img/bg.png", "png")
+	writeSiteFile(t, site, "viewdefs/App.DEFAULT.html", `<template><img src="/img/bg.png"></template>`)
+	writeSiteFile(t, site, "lua/main.js", "not an asset")
+	source := filepath.Join(tmp, "binary")
+	os.WriteFile(source, []byte("executable part"), 0755)
+	out := filepath.Join(tmp, "bundled")
+	if err := CreateBundleWithOptions(source, site, out, Options{Fingerprint: true}); err != nil {
+		t.Fatal(err)
+	}
+	reader, file, err := openBundleFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := verifyReader(reader); err != nil {
+		t.Fatalf("fingerprinted bundle failed verification: %v", err)
+	}
+	t.Cleanup(func() { SetFallback(nil) })
+	SetFallback(reader)
+
+	manifest, err := AssetManifest()
+	if err != nil || len(manifest) != 3 {
+		t.Fatalf("AssetManifest = %v, %v; want 3 assets", manifest, err)
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := ReadFile(name)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return string(data)
+	}
+	png, js, css := manifest["img/bg.png"], manifest["app.js"], manifest["css/app.css"]
+	if !strings.HasPrefix(png, "img/bg.") || read("html/"+png) != "png" || !Fingerprinted(png) || Fingerprinted("img/bg.png") {
+		t.Errorf("bg.png fingerprinted as %q", png)
+	}
+	if got, want := read("html/"+css), `body { background: url("../`+png+`") }`; got != want {
+		t.Errorf("css = %q, want %q", got, want)
+	}
+	want := `<link href="/` + css + `"><script src="` + js + `?v=1"></script><a href="https://x.test/app.js">`
+	if got := read("html/index.html"); got != want {
+		t.Errorf("index.html = %q, want %q", got, want)
+	}
+	if got := read("viewdefs/App.DEFAULT.html"); got != `<template><img src="/`+png+`"></template>` {
+		t.Errorf("viewdef = %q", got)
+	}
+	if _, err := ReadFile("html/app.js"); err == nil {
+		t.Error("original app.js is still bundled")
+	}
+	if read("lua/main.js") != "not an asset" {
+		t.Error("lua/main.js was renamed")
+	}
+}
+
+// TestExtractResume verifies --include selects files, a re-run skips files an
+// unfinished run extracted intact, and a failed file leaves no partial copy
+func TestExtractResume(t *testing.T) {
+	files := map[string]string{
+		"html/index.html":  "<html></html>",
+		"lua/main.lua":     "x = 1",
+		"lua/lib/util.lua": "return {}",
+	}
+	var manifest strings.Builder
+	for _, name := range []string{"html/index.html", "lua/lib/util.lua", "lua/main.lua"} {
+		fmt.Fprintf(&manifest, "%x  %s\n", sha256.Sum256([]byte(files[name])), name)
+	}
+	files[ManifestName] = manifest.String()
+	reader := zipOf(t, files)
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, ExtractStateName)
+
+	if err := extractReader(reader, dir, ExtractOptions{Include: []string{"lua"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lua", "lib", "util.lua")); err != nil {
+		t.Error("lua/lib/util.lua not extracted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "html", "index.html")); err == nil {
+		t.Error("html/index.html extracted though not included")
+	}
+	if _, err := os.Stat(statePath); err == nil {
+		t.Error("finished extraction left its state file")
+	}
+	if err := extractReader(reader, dir, ExtractOptions{Include: []string{"css/*"}}); err == nil {
+		t.Error("include matching nothing did not fail")
+	}
+
+	// An unfinished run wrote main.lua intact and util.lua, since tampered with
+	os.WriteFile(filepath.Join(dir, "lua", "lib", "util.lua"), []byte("tampered"), 0644)
+	os.WriteFile(statePath, []byte(fmt.Sprintf("%x  lua/main.lua\n%x  lua/lib/util.lua\n",
+		sha256.Sum256([]byte("x = 1")), sha256.Sum256([]byte("return {}")))), 0644)
+	// A directory in the way of html/index.html makes it fail
+	os.MkdirAll(filepath.Join(dir, "html", "index.html", "x"), 0755)
+	var last ExtractProgress
+	err := extractReader(reader, dir, ExtractOptions{Progress: func(p ExtractProgress) { last = p }})
+	if err == nil || !strings.Contains(err.Error(), "html/index.html") {
+		t.Fatalf("extract over a directory = %v", err)
+	}
+	if last.Resumed != 1 {
+		t.Errorf("resumed %d files, want 1 (main.lua)", last.Resumed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "html", "index.html.ui-extract-tmp")); err == nil {
+		t.Error("failed file left its temporary file")
+	}
+	if _, err := os.Stat(statePath); err != nil {
+		t.Error("failed extraction removed its state file")
+	}
+
+	os.RemoveAll(filepath.Join(dir, "html", "index.html"))
+	if err := extractReader(reader, dir, ExtractOptions{Progress: func(p ExtractProgress) { last = p }}); err != nil {
+		t.Fatal(err)
+	}
+	if last.Files != 4 || last.Resumed < 1 || last.Bytes != last.TotalBytes {
+		t.Errorf("resumed run progress = %+v", last)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "lua", "lib", "util.lua")); string(data) != "return {}" {
+		t.Errorf("tampered file not extracted again: %q", data)
+	}
+	if _, err := os.Stat(statePath); err == nil {
+		t.Error("finished extraction left its state file")
+	}
+}
@@ -0,0 +1,172 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Cache)
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCacheSize is the default total size of cached file contents.
+const DefaultCacheSize = 8 << 20
+
+// index is the bundle in use: its reader, its entries by name, and the
+// contents read from it. Invalidate replaces it, dropping both.
+type index struct {
+	reader *zip.Reader // nil when there is no bundle
+	files  map[string]*zip.File
+	cache  *contentCache
+	assets func() (*assetManifest, error) // Parses the asset manifest once
+}
+
+var (
+	indexMu   sync.Mutex // Serializes building and replacing the index
+	current   atomic.Pointer[index]
+	cacheSize atomic.Int64
+	// exeBundle reads the executable's bundle once; Reload replaces it when a
+	// new site was bundled over the running binary
+	exeBundle = sync.OnceValues(readBundle)
+)
+
+func init() {
+	cacheSize.Store(DefaultCacheSize)
+}
+
+// SetCacheSize sets the total size of cached file contents (0 = no caching)
+// and empties the cache.
+func SetCacheSize(size int64) {
+	cacheSize.Store(size)
+	Invalidate()
+}
+
+// Invalidate drops the bundle index and cached contents, so the next read
+// sees the bundle's current content. Call it after replacing the bundle.
+func Invalidate() {
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	current.Store(nil)
+}
+
+// Reload re-reads the executable's bundle, for when a new site was bundled
+// over the running binary, and replaces the index with one for it. Readers
+// of the old bundle keep working; its file closes once they drop it. If the
+// executable carries no bundle now, the current one stays in use.
+func Reload() (*zip.Reader, error) {
+	reader, err := readBundle()
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		return nil, fmt.Errorf("binary is not bundled")
+	}
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	exeBundle = func() (*zip.Reader, error) { return reader, nil }
+	current.Store(nil)
+	return reader, nil
+}
+
+// loadIndex returns the index of the current bundle, building it on first use.
+func loadIndex() (*index, error) {
+	if idx := current.Load(); idx != nil {
+		return idx, nil
+	}
+	indexMu.Lock()
+	defer indexMu.Unlock()
+	if idx := current.Load(); idx != nil {
+		return idx, nil
+	}
+	reader, err := exeBundle()
+	if err != nil {
+		return nil, err
+	}
+	if reader == nil {
+		reader = fallback.Load()
+	}
+	idx := &index{reader: reader, files: make(map[string]*zip.File), cache: newContentCache(cacheSize.Load())}
+	idx.assets = sync.OnceValues(idx.readAssetManifest)
+	if reader != nil {
+		for _, f := range reader.File {
+			idx.files[f.Name] = f
+		}
+	}
+	current.Store(idx)
+	return idx, nil
+}
+
+// read returns a file's content, from the cache when it holds it.
+func (idx *index) read(name string) ([]byte, bool, error) {
+	if data, ok := idx.cache.get(name); ok {
+		return bytes.Clone(data), true, nil
+	}
+	f := idx.files[name]
+	if f == nil {
+		return nil, false, nil
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, true, err
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, true, err
+	}
+	idx.cache.put(name, bytes.Clone(data))
+	return data, true, nil
+}
+
+// contentCache holds recently read file contents up to a total size, evicting
+// the least recently used. Files over an eighth of the total are not kept.
+type contentCache struct {
+	mu      sync.Mutex
+	max     int64
+	size    int64
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	name string
+	data []byte
+}
+
+func newContentCache(max int64) *contentCache {
+	return &contentCache{max: max, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *contentCache) get(name string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).data, true
+}
+
+func (c *contentCache) put(name string, data []byte) {
+	size := int64(len(data))
+	if size > c.max/8 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[name]; ok {
+		return
+	}
+	c.entries[name] = c.order.PushFront(&cacheEntry{name: name, data: data})
+	c.size += size
+	for c.size > c.max {
+		oldest := c.order.Back()
+		entry := c.order.Remove(oldest).(*cacheEntry)
+		delete(c.entries, entry.name)
+		c.size -= int64(len(entry.data))
+	}
+}
@@ -0,0 +1,256 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Chunk Cache)
+package bundle
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultChunkCacheDir is where bundle keeps compressed files between runs.
+const DefaultChunkCacheDir = ".ui-bundle-cache"
+
+// DefaultChunkMaxAge is how long a chunk may go unused before pruning removes it.
+const DefaultChunkMaxAge = 30 * 24 * time.Hour
+
+const (
+	chunkSuffix    = ".deflate"
+	chunkStatsName = "stats.json"
+)
+
+// ChunkCache stores deflated file contents in a directory, keyed by the
+// SHA-256 of the content, so re-bundling a site compresses only the files
+// that changed. Using a chunk refreshes its modification time for pruning.
+type ChunkCache struct {
+	dir   string
+	stats chunkCounts // This run's hits and misses
+}
+
+// chunkCounts are the hits and misses kept in the cache's stats file.
+type chunkCounts struct {
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// ChunkStats describes a chunk cache.
+type ChunkStats struct {
+	Entries int
+	Size    int64 // Bytes of compressed chunks
+	Hits    int64 // Files taken from the cache, over all runs
+	Misses  int64 // Files compressed and added, over all runs
+}
+
+// HitRate returns the fraction of files taken from the cache, or 0 before any use.
+func (s ChunkStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// NewChunkCache returns the chunk cache in dir, which is created on first write.
+func NewChunkCache(dir string) *ChunkCache {
+	return &ChunkCache{dir: dir}
+}
+
+// Hits returns how many files this run took from the cache.
+func (c *ChunkCache) Hits() int64 {
+	return c.stats.Hits
+}
+
+// Misses returns how many files this run compressed.
+func (c *ChunkCache) Misses() int64 {
+	return c.stats.Misses
+}
+
+// addFile adds a regular file like addRegularFileToZip, writing its
+// compressed content from the cache when it is there and intact. Chunks of
+// other levels than the default carry the level in their name.
+func (c *ChunkCache) addFile(zipWriter *zip.Writer, filePath, zipPath string, mode fs.FileMode, level int) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	name := hex.EncodeToString(sum[:])
+	if level != flate.DefaultCompression {
+		name += "-" + strconv.Itoa(level)
+	}
+	chunkPath := filepath.Join(c.dir, name+chunkSuffix)
+	crc := crc32.ChecksumIEEE(content)
+
+	raw, err := os.ReadFile(chunkPath)
+	if err == nil && chunkMatches(raw, content) {
+		c.stats.Hits++
+		now := time.Now()
+		os.Chtimes(chunkPath, now, now)
+	} else {
+		c.stats.Misses++
+		if raw, err = deflate(content, level); err != nil {
+			return err
+		}
+		// The cache only saves time, so failing to fill it does not fail the bundle
+		c.store(chunkPath, raw)
+	}
+
+	header := &zip.FileHeader{
+		Name:               zipPath,
+		Method:             zip.Deflate,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(raw)),
+		UncompressedSize64: uint64(len(content)),
+	}
+	header.SetMode(mode)
+	writer, err := zipWriter.CreateRaw(header)
+	if err != nil {
+		return err
+	}
+	_, err = writer.Write(raw)
+	return err
+}
+
+// chunkMatches reports whether raw inflates to content, so a damaged chunk
+// is compressed again rather than bundled.
+func chunkMatches(raw, content []byte) bool {
+	inflated, err := io.ReadAll(flate.NewReader(bytes.NewReader(raw)))
+	return err == nil && bytes.Equal(inflated, content)
+}
+
+func deflate(content []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(content); err != nil {
+		return nil, err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// store writes a chunk through a temporary file, so readers never see part of one.
+func (c *ChunkCache) store(chunkPath string, raw []byte) error {
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, ".chunk-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), chunkPath)
+}
+
+// saveStats adds this run's hits and misses to the stats file.
+func (c *ChunkCache) saveStats() error {
+	if c.stats == (chunkCounts{}) {
+		return nil
+	}
+	total, err := c.readCounts()
+	if err != nil {
+		return err
+	}
+	total.Hits += c.stats.Hits
+	total.Misses += c.stats.Misses
+	data, err := json.Marshal(total)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.dir, chunkStatsName), data, 0644)
+}
+
+func (c *ChunkCache) readCounts() (chunkCounts, error) {
+	var counts chunkCounts
+	data, err := os.ReadFile(filepath.Join(c.dir, chunkStatsName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return counts, nil
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &counts)
+	}
+	return counts, err
+}
+
+// Stats counts the cache's chunks and reads its hit and miss totals. A
+// missing cache directory is an empty cache.
+func (c *ChunkCache) Stats() (ChunkStats, error) {
+	counts, err := c.readCounts()
+	if err != nil {
+		return ChunkStats{}, err
+	}
+	stats := ChunkStats{Hits: counts.Hits, Misses: counts.Misses}
+	err = c.eachChunk(func(_ string, info fs.FileInfo) error {
+		stats.Entries++
+		stats.Size += info.Size()
+		return nil
+	})
+	return stats, err
+}
+
+// Prune removes chunks unused for longer than maxAge, returning how many it
+// removed and their size.
+func (c *ChunkCache) Prune(maxAge time.Duration) (int, int64, error) {
+	cutoff := time.Now().Add(-maxAge)
+	removed, freed := 0, int64(0)
+	err := c.eachChunk(func(path string, info fs.FileInfo) error {
+		if !info.ModTime().Before(cutoff) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		freed += info.Size()
+		return nil
+	})
+	return removed, freed, err
+}
+
+func (c *ChunkCache) eachChunk(fn func(path string, info fs.FileInfo) error) error {
+	entries, err := os.ReadDir(c.dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), chunkSuffix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		if err := fn(filepath.Join(c.dir, entry.Name()), info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Compression)
+package bundle
+
+import (
+	"archive/zip"
+	"compress/flate"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Compression names how a bundle's files are compressed. The zero value is
+// CompressionDefault.
+type Compression string
+
+const (
+	CompressionNone    Compression = "none"    // Store every file
+	CompressionFast    Compression = "fast"    // Deflate at flate.BestSpeed
+	CompressionDefault Compression = "default" // Deflate at flate.DefaultCompression
+	CompressionBest    Compression = "best"    // Deflate at flate.BestCompression
+)
+
+// storedExtensions are formats that are already compressed, so deflating
+// them only costs time; they are always stored.
+var storedExtensions = map[string]bool{
+	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	".woff": true, ".woff2": true, ".gz": true, ".zip": true,
+}
+
+// ParseCompression returns the compression with the given name.
+func ParseCompression(name string) (Compression, error) {
+	switch c := Compression(name); c {
+	case "":
+		return CompressionDefault, nil
+	case CompressionNone, CompressionFast, CompressionDefault, CompressionBest:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q (want none, fast, default or best)", name)
+}
+
+// level returns the deflate level for text files.
+func (c Compression) level() int {
+	switch c {
+	case CompressionFast:
+		return flate.BestSpeed
+	case CompressionBest:
+		return flate.BestCompression
+	}
+	return flate.DefaultCompression
+}
+
+// method returns the ZIP method for the file at zipPath.
+func (c Compression) method(zipPath string) uint16 {
+	if c == CompressionNone || storedExtensions[strings.ToLower(path.Ext(zipPath))] {
+		return zip.Store
+	}
+	return zip.Deflate
+}
+
+// register makes zipWriter deflate at the compression's level.
+func (c Compression) register(zipWriter *zip.Writer) {
+	level := c.level()
+	zipWriter.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+}
@@ -0,0 +1,261 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Diff)
+package bundle
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FileSum is a bundle file's hex SHA-256 and uncompressed size. A symlink's
+// content is its target.
+type FileSum struct {
+	Sum  string
+	Size int64
+}
+
+// DiffReport lists how one site (old) differs from another (new). Names are
+// bundle paths, sorted.
+type DiffReport struct {
+	Added    []DiffFile `json:"added"`    // Only in new
+	Removed  []DiffFile `json:"removed"`  // Only in old
+	Modified []DiffFile `json:"modified"` // In both with different content
+}
+
+// DiffFile is one file of a DiffReport. Sums are hex SHA-256; the side a file
+// is missing from has no sum and a zero size.
+type DiffFile struct {
+	Name    string `json:"name"`
+	OldSum  string `json:"oldSha256,omitempty"`
+	NewSum  string `json:"newSha256,omitempty"`
+	OldSize int64  `json:"oldSize"`
+	NewSize int64  `json:"newSize"`
+}
+
+// SizeDelta returns how many bytes the file grew from old to new.
+func (f DiffFile) SizeDelta() int64 {
+	return f.NewSize - f.OldSize
+}
+
+// DiffSummary counts a DiffReport's files, for `bundle diff --summary`.
+type DiffSummary struct {
+	Added     int   `json:"added"`
+	Removed   int   `json:"removed"`
+	Modified  int   `json:"modified"`
+	SizeDelta int64 `json:"sizeDelta"`
+}
+
+// Empty reports whether the two sites match.
+func (d *DiffReport) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Modified) == 0
+}
+
+// Summary counts the report's files and their total size change.
+func (d *DiffReport) Summary() DiffSummary {
+	summary := DiffSummary{Added: len(d.Added), Removed: len(d.Removed), Modified: len(d.Modified)}
+	for _, files := range [][]DiffFile{d.Added, d.Removed, d.Modified} {
+		for _, file := range files {
+			summary.SizeDelta += file.SizeDelta()
+		}
+	}
+	return summary
+}
+
+// Diff compares the bundled site (old) with a directory (new), skipping the
+// files bundling skips.
+func Diff(dir string) (*DiffReport, error) {
+	zipReader, err := GetBundleReader()
+	if err != nil {
+		return nil, err
+	}
+	if zipReader == nil {
+		return nil, fmt.Errorf("binary is not bundled")
+	}
+	oldSums, err := zipFileSums(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	newSums, err := dirFileSums(dir)
+	if err != nil {
+		return nil, err
+	}
+	return DiffSums(oldSums, newSums), nil
+}
+
+// DiffPaths compares two sites, each a bundled binary, a ZIP file or a site
+// directory (see SiteSums).
+func DiffPaths(oldPath, newPath string) (*DiffReport, error) {
+	oldSums, err := SiteSums(oldPath)
+	if err != nil {
+		return nil, err
+	}
+	newSums, err := SiteSums(newPath)
+	if err != nil {
+		return nil, err
+	}
+	return DiffSums(oldSums, newSums), nil
+}
+
+// DiffSums compares two sites' files by SHA-256.
+func DiffSums(oldSums, newSums map[string]FileSum) *DiffReport {
+	report := &DiffReport{Added: []DiffFile{}, Removed: []DiffFile{}, Modified: []DiffFile{}}
+	for name, old := range oldSums {
+		if cur, ok := newSums[name]; !ok {
+			report.Removed = append(report.Removed, DiffFile{Name: name, OldSum: old.Sum, OldSize: old.Size})
+		} else if cur.Sum != old.Sum {
+			report.Modified = append(report.Modified, DiffFile{Name: name, OldSum: old.Sum, NewSum: cur.Sum, OldSize: old.Size, NewSize: cur.Size})
+		}
+	}
+	for name, cur := range newSums {
+		if _, ok := oldSums[name]; !ok {
+			report.Added = append(report.Added, DiffFile{Name: name, NewSum: cur.Sum, NewSize: cur.Size})
+		}
+	}
+	byName := func(a, b DiffFile) int { return strings.Compare(a.Name, b.Name) }
+	slices.SortFunc(report.Added, byName)
+	slices.SortFunc(report.Removed, byName)
+	slices.SortFunc(report.Modified, byName)
+	return report
+}
+
+// SiteSums returns the files of a bundled binary, a ZIP file or a site
+// directory by bundle name. A bundle's manifest supplies the sums when it
+// has one; otherwise its files are hashed. A directory holds what bundling
+// it would: ignored files and a top-level manifest are skipped.
+func SiteSums(path string) (map[string]FileSum, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return dirFileSums(path)
+	}
+	zipReader, closer, err := openZipOrBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return zipFileSums(zipReader)
+}
+
+// openZipOrBundle opens a bundled binary's bundle, or else a plain ZIP file.
+func openZipOrBundle(path string) (*zip.Reader, io.Closer, error) {
+	zipReader, file, err := openBundleFile(path)
+	if err == nil {
+		return zipReader, file, nil
+	}
+	archive, zipErr := zip.OpenReader(path)
+	if zipErr != nil {
+		return nil, nil, fmt.Errorf("%s is neither a bundled binary nor a ZIP file", path)
+	}
+	return &archive.Reader, archive, nil
+}
+
+// zipFileSums returns a bundle's files other than the manifest, taking sums
+// from the manifest when it lists them and hashing the rest.
+func zipFileSums(zipReader *zip.Reader) (map[string]FileSum, error) {
+	manifest, err := readManifest(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]FileSum, len(zipReader.File))
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() || f.Name == ManifestName {
+			continue
+		}
+		sum, ok := manifest[f.Name]
+		if !ok {
+			if sum, err = entryChecksum(f); err != nil {
+				return nil, err
+			}
+		}
+		sums[f.Name] = FileSum{Sum: sum, Size: int64(f.UncompressedSize64)}
+	}
+	return sums, nil
+}
+
+// dirChecksums hashes the files a bundle of dir would hold, by bundle path.
+func dirChecksums(dir string) (map[string]string, error) {
+	files, err := dirFileSums(dir)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(files))
+	for name, file := range files {
+		sums[name] = file.Sum
+	}
+	return sums, nil
+}
+
+// dirFileSums hashes the files a bundle of dir would hold, by bundle path.
+func dirFileSums(dir string) (map[string]FileSum, error) {
+	sums := make(map[string]FileSum)
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || IGNORE_FILES.MatchString(filePath) {
+			return nil
+		}
+		relPath, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if name == ManifestName {
+			return nil
+		}
+		sums[name], err = fileSum(filePath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sums, nil
+}
+
+// fileChecksum hashes a site file the way its bundle entry holds it: a
+// symlink's content is its target.
+func fileChecksum(filePath string) (string, error) {
+	sum, err := fileSum(filePath)
+	return sum.Sum, err
+}
+
+// fileSum hashes and sizes a site file the way its bundle entry holds it.
+func fileSum(filePath string) (FileSum, error) {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return FileSum{}, err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(filePath)
+		if err != nil {
+			return FileSum{}, fmt.Errorf("failed to read symlink %s: %w", filePath, err)
+		}
+		target = filepath.ToSlash(target)
+		sum, err := checksum(strings.NewReader(target))
+		return FileSum{Sum: sum, Size: int64(len(target))}, err
+	}
+	file, err := os.Open(filePath)
+	if err != nil {
+		return FileSum{}, err
+	}
+	defer file.Close()
+	sum, err := checksum(file)
+	return FileSum{Sum: sum, Size: info.Size()}, err
+}
+
+func checksum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
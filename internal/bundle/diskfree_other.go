@@ -0,0 +1,10 @@
+//go:build !(linux || darwin || freebsd)
+
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Extraction)
+package bundle
+
+// diskFree reports that free space is unknown, so extraction is not checked.
+func diskFree(dir string) (int64, bool) {
+	return 0, false
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Extraction)
+package bundle
+
+import "syscall"
+
+// diskFree returns the bytes available to this user on dir's filesystem.
+func diskFree(dir string) (int64, bool) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, false
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), true
+}
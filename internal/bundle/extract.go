@@ -0,0 +1,180 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Extraction)
+package bundle
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ExtractStateName is the progress file an unfinished extraction leaves in the
+// target directory, in sha256sum format: one line per file written. A re-run
+// skips the files it lists that still match, and a finished one removes it.
+const ExtractStateName = ".ui-extract-state"
+
+// ExtractOptions control ExtractBundleWithOptions.
+type ExtractOptions struct {
+	Include  []string              // Globs selecting bundle paths, or their directories (empty = all)
+	Force    bool                  // Extract even when the disk looks too full
+	Progress func(ExtractProgress) // Called after each file (nil = none)
+}
+
+// ExtractProgress counts the files and bytes of an extraction done so far,
+// including those an earlier run already extracted.
+type ExtractProgress struct {
+	Files, TotalFiles int
+	Bytes, TotalBytes int64
+	Resumed           int // Files skipped because an earlier run extracted them
+}
+
+// InsufficientSpaceError refuses an extraction that would not fit on the disk.
+type InsufficientSpaceError struct {
+	Dir             string
+	Need, Available int64
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space in %s: need %d bytes, %d available", e.Dir, e.Need, e.Available)
+}
+
+// ExtractBundleWithOptions extracts the bundled files opts selects to a
+// directory, resuming an earlier extraction that failed part way.
+func ExtractBundleWithOptions(targetDir string, opts ExtractOptions) error {
+	zipReader, err := GetBundleReader()
+	if err != nil {
+		return err
+	}
+	if zipReader == nil {
+		return fmt.Errorf("binary is not bundled")
+	}
+	return extractReader(zipReader, targetDir, opts)
+}
+
+func extractReader(zipReader *zip.Reader, targetDir string, opts ExtractOptions) error {
+	for _, pattern := range opts.Include {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("bad include pattern %q: %w", pattern, err)
+		}
+	}
+	manifest, err := readManifest(zipReader)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+	statePath := filepath.Join(targetDir, ExtractStateName)
+	done, err := readExtractState(statePath)
+	if err != nil {
+		return err
+	}
+
+	var progress ExtractProgress
+	var todo []*zip.File
+	var need int64
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() || !includes(opts.Include, f.Name) {
+			continue
+		}
+		size := int64(f.UncompressedSize64)
+		progress.TotalFiles++
+		progress.TotalBytes += size
+		if sum := done[f.Name]; sum != "" && (manifest == nil || manifest[f.Name] == sum) && fileMatches(filepath.Join(targetDir, f.Name), sum) {
+			progress.Files++
+			progress.Bytes += size
+			progress.Resumed++
+			continue
+		}
+		todo = append(todo, f)
+		need += size
+	}
+	if progress.TotalFiles == 0 && len(opts.Include) > 0 {
+		return fmt.Errorf("no bundled files match %s", strings.Join(opts.Include, ", "))
+	}
+	if available, ok := diskFree(targetDir); ok && need > available && !opts.Force {
+		return &InsufficientSpaceError{Dir: targetDir, Need: need, Available: available}
+	}
+	if opts.Progress != nil && progress.Resumed > 0 {
+		opts.Progress(progress)
+	}
+
+	state, err := os.OpenFile(statePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	for _, f := range todo {
+		sum, err := extractEntry(f, targetDir)
+		if err != nil {
+			state.Close()
+			return fmt.Errorf("failed to extract %s: %w", f.Name, err)
+		}
+		if sum != "" {
+			if _, err := fmt.Fprintf(state, "%s  %s\n", sum, f.Name); err != nil {
+				state.Close()
+				return err
+			}
+		}
+		progress.Files++
+		progress.Bytes += int64(f.UncompressedSize64)
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+	if err := state.Close(); err != nil {
+		return err
+	}
+	return os.Remove(statePath)
+}
+
+// includes reports whether name, or a directory holding it, matches one of
+// the patterns. No patterns include everything.
+func includes(patterns []string, name string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		for p := name; p != "." && p != "/"; p = path.Dir(p) {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readExtractState parses an unfinished extraction's progress file into
+// bundle name -> SHA-256. Returns an empty map if there is none.
+func readExtractState(statePath string) (map[string]string, error) {
+	done := make(map[string]string)
+	file, err := os.Open(statePath)
+	if os.IsNotExist(err) {
+		return done, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// A line cut short by a crash is ignored: its file is extracted again
+		if sum, name, ok := strings.Cut(scanner.Text(), "  "); ok && len(sum) == 64 && name != "" {
+			done[name] = sum
+		}
+	}
+	return done, scanner.Err()
+}
+
+// fileMatches reports whether the file at filePath has the given SHA-256.
+func fileMatches(filePath, sum string) bool {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	got, err := checksum(file)
+	return err == nil && got == sum
+}
@@ -0,0 +1,240 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Asset Fingerprinting)
+package bundle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// AssetManifestName is the bundle entry a fingerprinted bundle maps its
+// renamed assets in: a JSON object of original to hashed name, both relative
+// to html/.
+const AssetManifestName = "manifest.json"
+
+// fingerprintExts are the html/ files bundling --fingerprint renames.
+var fingerprintExts = []string{
+	".js", ".mjs", ".css",
+	".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico",
+	".woff", ".woff2", ".ttf", ".otf",
+}
+
+var (
+	htmlRefPattern = regexp.MustCompile(`(?i)\b(?:src|href)\s*=\s*["']([^"']+)["']`)
+	cssRefPattern  = regexp.MustCompile(`url\(\s*["']?([^"')]+?)["']?\s*\)`)
+)
+
+// assetManifest is a bundle's parsed asset manifest.
+type assetManifest struct {
+	names  map[string]string // original -> hashed
+	hashed map[string]bool
+}
+
+// AssetManifest returns the bundle's map of original to fingerprinted asset
+// names, relative to html/ (e.g. "app.js" -> "app.ab12cd34.js"). It is empty
+// when the bundle was not fingerprinted.
+func AssetManifest() (map[string]string, error) {
+	idx, err := loadIndex()
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := idx.assets()
+	if err != nil {
+		return nil, err
+	}
+	return maps.Clone(manifest.names), nil
+}
+
+// Fingerprinted reports whether name, relative to html/, is an asset the
+// bundle renamed to include its content hash.
+func Fingerprinted(name string) bool {
+	idx, err := loadIndex()
+	if err != nil {
+		return false
+	}
+	manifest, err := idx.assets()
+	return err == nil && manifest.hashed[name]
+}
+
+// readAssetManifest parses the index's asset manifest, if it has one.
+func (idx *index) readAssetManifest() (*assetManifest, error) {
+	manifest := &assetManifest{names: map[string]string{}, hashed: map[string]bool{}}
+	data, found, err := idx.read(AssetManifestName)
+	if err != nil || !found {
+		return manifest, err
+	}
+	if err := json.Unmarshal(data, &manifest.names); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", AssetManifestName, err)
+	}
+	for _, hashed := range manifest.names {
+		manifest.hashed[hashed] = true
+	}
+	return manifest, nil
+}
+
+// fingerprintSite copies siteDir to a temporary directory with its html/
+// assets renamed to include a hash of their content, references to them in
+// HTML (html/ and viewdefs/) and CSS rewritten, and the asset manifest at the
+// top. lua/ and viewdefs/ files keep their names. The caller removes the
+// directory.
+func fingerprintSite(siteDir string) (string, error) {
+	if _, err := os.Lstat(filepath.Join(siteDir, AssetManifestName)); err == nil {
+		return "", fmt.Errorf("site already has a top-level %s", AssetManifestName)
+	}
+	var files []string
+	err := filepath.Walk(siteDir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || IGNORE_FILES.MatchString(filePath) {
+			return err
+		}
+		rel, err := filepath.Rel(siteDir, filePath)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// Assets other than CSS first, so CSS can refer to their new names
+	// before it is hashed itself; HTML is rewritten but keeps its name
+	contents := make(map[string][]byte)
+	names := make(map[string]string)
+	for _, cssPass := range []bool{false, true} {
+		for _, name := range files {
+			ext := strings.ToLower(path.Ext(name))
+			if !strings.HasPrefix(name, "html/") || !slices.Contains(fingerprintExts, ext) || (ext == ".css") != cssPass {
+				continue
+			}
+			info, err := os.Lstat(filepath.Join(siteDir, name))
+			if err != nil {
+				return "", err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(siteDir, name))
+			if err != nil {
+				return "", err
+			}
+			if cssPass {
+				data = rewriteRefs(data, cssRefPattern, path.Dir(name), names)
+			}
+			sum := sha256.Sum256(data)
+			names[name] = strings.TrimSuffix(name, path.Ext(name)) + "." + hex.EncodeToString(sum[:4]) + path.Ext(name)
+			contents[name] = data
+		}
+	}
+
+	dir, err := os.MkdirTemp("", "ui-bundle-fingerprint-")
+	if err != nil {
+		return "", err
+	}
+	for _, name := range files {
+		if err := copyFingerprinted(siteDir, dir, name, names, contents); err != nil {
+			os.RemoveAll(dir)
+			return "", err
+		}
+	}
+	manifest := make(map[string]string, len(names))
+	for name, hashed := range names {
+		manifest[strings.TrimPrefix(name, "html/")] = strings.TrimPrefix(hashed, "html/")
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err == nil {
+		err = os.WriteFile(filepath.Join(dir, AssetManifestName), append(data, '\n'), 0644)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// copyFingerprinted copies one site file into dir under its bundled name,
+// rewriting references in HTML. Symlinks are copied as they are.
+func copyFingerprinted(siteDir, dir, name string, names map[string]string, contents map[string][]byte) error {
+	src := filepath.Join(siteDir, name)
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if hashed, ok := names[name]; ok {
+		dst = filepath.Join(dir, filepath.FromSlash(hashed))
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	data, ok := contents[name]
+	if !ok {
+		if data, err = os.ReadFile(src); err != nil {
+			return err
+		}
+		isHTML := strings.EqualFold(path.Ext(name), ".html")
+		switch {
+		case isHTML && strings.HasPrefix(name, "html/"):
+			data = rewriteRefs(data, htmlRefPattern, path.Dir(name), names)
+		case isHTML && strings.HasPrefix(name, "viewdefs/"):
+			// Viewdefs render into pages served from the site root
+			data = rewriteRefs(data, htmlRefPattern, "html", names)
+		}
+	}
+	return os.WriteFile(dst, data, info.Mode().Perm())
+}
+
+// rewriteRefs replaces the references pattern's first group matches in data
+// that name a renamed asset, resolved from dir (or html/ for "/" paths), with
+// its hashed name. URLs with a scheme and fragments are left alone.
+func rewriteRefs(data []byte, pattern *regexp.Regexp, dir string, names map[string]string) []byte {
+	var out []byte
+	last := 0
+	for _, m := range pattern.FindAllSubmatchIndex(data, -1) {
+		ref := string(data[m[2]:m[3]])
+		if hashed, ok := renamedRef(ref, dir, names); ok {
+			out = append(out, data[last:m[2]]...)
+			out = append(out, hashed...)
+			last = m[3]
+		}
+	}
+	if out == nil {
+		return data
+	}
+	return append(out, data[last:]...)
+}
+
+// renamedRef returns ref pointing at its asset's hashed name, if it names one.
+func renamedRef(ref, dir string, names map[string]string) (string, bool) {
+	if strings.Contains(ref, ":") || strings.HasPrefix(ref, "//") || strings.HasPrefix(ref, "#") {
+		return "", false
+	}
+	target, suffix := ref, ""
+	if i := strings.IndexAny(ref, "?#"); i >= 0 {
+		target, suffix = ref[:i], ref[i:]
+	}
+	if strings.HasPrefix(target, "/") {
+		target = path.Join("html", target)
+	} else {
+		target = path.Join(dir, target)
+	}
+	hashed, ok := names[target]
+	if !ok {
+		return "", false
+	}
+	prefix := ref[:strings.LastIndex(ref[:len(ref)-len(suffix)], "/")+1]
+	return prefix + path.Base(hashed) + suffix, true
+}
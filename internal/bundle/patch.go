@@ -0,0 +1,235 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Patch)
+package bundle
+
+import (
+	"archive/zip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PatchBundle writes outputPath as sourceBinary with the listed site files
+// replaced in its bundle. Files are paths relative to siteDir, which are also
+// their bundle names. Other entries are copied without recompressing them.
+// Every file must already be in the bundle unless allowAdd is set; added
+// files go after the existing entries. The manifest is rewritten to match.
+func PatchBundle(sourceBinary, outputPath, siteDir string, files []string, allowAdd bool) (*PatchReport, error) {
+	reader, src, err := openBundleFile(sourceBinary)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	absSiteDir, err := filepath.Abs(siteDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path of site: %w", err)
+	}
+	existing := make(map[string]bool, len(reader.File))
+	for _, f := range reader.File {
+		existing[f.Name] = true
+	}
+	changed := make(map[string]string, len(files)) // Bundle name -> file path
+	report := &PatchReport{}
+	var missing []string
+	for _, file := range files {
+		name, err := bundleName(absSiteDir, file)
+		if err != nil {
+			return nil, err
+		}
+		if name == ManifestName {
+			return nil, fmt.Errorf("%s is generated", ManifestName)
+		}
+		if _, err := os.Lstat(filepath.Join(siteDir, filepath.FromSlash(name))); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		if _, dup := changed[name]; dup {
+			continue
+		}
+		changed[name] = filepath.Join(siteDir, filepath.FromSlash(name))
+		if existing[name] {
+			report.Replaced = append(report.Replaced, name)
+		} else {
+			report.Added = append(report.Added, name)
+			missing = append(missing, file)
+		}
+	}
+	if len(missing) > 0 && !allowAdd {
+		return nil, fmt.Errorf("not in the bundle (use --add to add them): %s", strings.Join(missing, ", "))
+	}
+
+	// Keep the source's checksums for copied files, so patching does not vouch
+	// for entries that were altered since
+	sums, err := readManifest(reader)
+	if err == nil && sums == nil {
+		sums, err = zipChecksums(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name, path := range changed {
+		if sums[name], err = fileChecksum(path); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+	}
+
+	err = writeBundle(src, outputPath, func(zipWriter *zip.Writer) error {
+		for _, f := range reader.File {
+			if f.Name == ManifestName {
+				continue
+			}
+			var err error
+			if path, ok := changed[f.Name]; ok {
+				err = addFileToZip(zipWriter, path, f.Name, absSiteDir)
+			} else {
+				err = zipWriter.Copy(f)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to write %s: %w", f.Name, err)
+			}
+		}
+		for _, name := range report.Added {
+			if err := addFileToZip(zipWriter, changed[name], name, absSiteDir); err != nil {
+				return fmt.Errorf("failed to add %s: %w", name, err)
+			}
+		}
+		return nil
+	}, sums)
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// writeBundle writes outputPath as the executable part of src followed by a
+// bundle of the entries addEntries writes, a manifest of sums and a footer.
+func writeBundle(src *os.File, outputPath string, addEntries func(*zip.Writer) error, sums map[string]string) error {
+	binarySize, err := GetBinarySize(src.Name())
+	if err != nil {
+		return fmt.Errorf("failed to get binary size: %w", err)
+	}
+	if srcInfo, err := src.Stat(); err == nil {
+		if outInfo, err := os.Stat(outputPath); err == nil && os.SameFile(srcInfo, outInfo) {
+			return fmt.Errorf("output %s is the source binary", outputPath)
+		}
+	}
+	outFile, err := os.OpenFile(outputPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outFile.Close()
+	if _, err := io.Copy(outFile, io.NewSectionReader(src, 0, binarySize)); err != nil {
+		return fmt.Errorf("failed to copy binary: %w", err)
+	}
+
+	counter := &countingWriter{w: outFile}
+	zipWriter := zip.NewWriter(counter)
+	if err := addEntries(zipWriter); err != nil {
+		zipWriter.Close()
+		return err
+	}
+	if err := writeManifest(zipWriter, sums, zip.Deflate); err != nil {
+		zipWriter.Close()
+		return fmt.Errorf("failed to add %s: %w", ManifestName, err)
+	}
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to close ZIP writer: %w", err)
+	}
+	return writeFooter(outFile, binarySize, counter.n)
+}
+
+// PatchReport lists the bundle names a patch replaced and added, in the order
+// the files were given.
+type PatchReport struct {
+	Replaced []string
+	Added    []string
+}
+
+// openBundleFile opens a bundled binary and returns a reader of its bundle,
+// read in place. The caller closes the file.
+func openBundleFile(path string) (*zip.Reader, *os.File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open binary: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to stat binary: %w", err)
+	}
+	offset, err := GetBinarySize(path)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	size := info.Size() - FooterSize - offset
+	if offset == info.Size() || size < 0 {
+		file.Close()
+		return nil, nil, fmt.Errorf("%s is not bundled", path)
+	}
+	reader, err := zip.NewReader(io.NewSectionReader(file, offset, size), size)
+	if err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("failed to open ZIP reader: %w", err)
+	}
+	return reader, file, nil
+}
+
+// bundleName returns the bundle name of a file given relative to the site.
+func bundleName(absSiteDir, file string) (string, error) {
+	absFile := filepath.Clean(file)
+	if !filepath.IsAbs(file) {
+		absFile = filepath.Join(absSiteDir, file)
+	}
+	if !isWithinDir(absFile, absSiteDir) || absFile == absSiteDir {
+		return "", fmt.Errorf("%s is not in the site directory", file)
+	}
+	rel, err := filepath.Rel(absSiteDir, absFile)
+	if err != nil {
+		return "", err
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// addFileToZip adds a site file or symlink like addDirToZip does.
+func addFileToZip(zipWriter *zip.Writer, filePath, zipPath, absSiteDir string) error {
+	info, err := os.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		return addSymlinkToZip(zipWriter, filePath, zipPath, absSiteDir)
+	}
+	return addRegularFileToZip(zipWriter, filePath, zipPath, info.Mode(), CompressionDefault.method(zipPath))
+}
+
+// writeFooter writes the footer that locates the bundle's ZIP data.
+func writeFooter(w io.Writer, offset, size int64) error {
+	footer := Footer{Offset: offset, Size: size}
+	copy(footer.Magic[:], MagicMarker)
+	if err := binary.Write(w, binary.LittleEndian, footer.Offset); err != nil {
+		return fmt.Errorf("failed to write offset: %w", err)
+	}
+	if err := binary.Write(w, binary.LittleEndian, footer.Size); err != nil {
+		return fmt.Errorf("failed to write size: %w", err)
+	}
+	if _, err := w.Write(footer.Magic[:]); err != nil {
+		return fmt.Errorf("failed to write magic: %w", err)
+	}
+	return nil
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,81 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Removing Bundled Files)
+package bundle
+
+import (
+	"archive/zip"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// RemoveFiles writes outputPath as sourceBinary without the bundled files
+// match selects, copying the other entries unchanged, and returns the removed
+// names. An empty outputPath rewrites sourceBinary in place. Nothing is
+// written when no file matches. The manifest is rewritten, never removed.
+func RemoveFiles(sourceBinary, outputPath string, match func(name string) bool) ([]string, error) {
+	reader, src, err := openBundleFile(sourceBinary)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var removed []string
+	drop := make(map[string]bool)
+	for _, f := range reader.File {
+		if f.Name == ManifestName || f.FileInfo().IsDir() || !match(f.Name) {
+			continue
+		}
+		removed = append(removed, f.Name)
+		drop[f.Name] = true
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	sums, err := readManifest(reader)
+	if err == nil && sums == nil {
+		sums, err = zipChecksums(reader)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for name := range drop {
+		delete(sums, name)
+	}
+
+	// In place, write beside the source and rename over it once complete
+	target := outputPath
+	if outputPath == "" {
+		tmp, err := os.CreateTemp(filepath.Dir(sourceBinary), "."+filepath.Base(sourceBinary)+"-*")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		tmp.Close()
+		target = tmp.Name()
+		defer os.Remove(target)
+	}
+	err = writeBundle(src, target, func(zipWriter *zip.Writer) error {
+		for _, f := range reader.File {
+			if f.Name == ManifestName || drop[f.Name] {
+				continue
+			}
+			if err := zipWriter.Copy(f); err != nil {
+				return fmt.Errorf("failed to write %s: %w", f.Name, err)
+			}
+		}
+		return nil
+	}, sums)
+	if err != nil {
+		return nil, err
+	}
+	if outputPath == "" {
+		if info, err := src.Stat(); err == nil {
+			os.Chmod(target, info.Mode().Perm())
+		}
+		if err := os.Rename(target, sourceBinary); err != nil {
+			return nil, fmt.Errorf("failed to replace %s: %w", sourceBinary, err)
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,200 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Verification)
+package bundle
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// ManifestName is the bundle entry holding the SHA-256 of every other entry,
+// in sha256sum format. Bundling generates it, so a site file of that name at
+// the top of the site is skipped.
+const ManifestName = "MANIFEST.sha256"
+
+// FileCheck is one file's result from checking a bundle against its manifest.
+type FileCheck struct {
+	Name    string
+	Problem string // "" if the file passed, else "corrupt", "missing" or "not in manifest"
+}
+
+// Passed reports whether the file matched the manifest.
+func (c FileCheck) Passed() bool {
+	return c.Problem == ""
+}
+
+// Verify checks the bundle's files against its manifest, returning an error
+// naming the files that are corrupt, missing or not in the manifest.
+func Verify() error {
+	zipReader, err := GetBundleReader()
+	if err != nil {
+		return err
+	}
+	if zipReader == nil {
+		return fmt.Errorf("binary is not bundled")
+	}
+	return verifyReader(zipReader)
+}
+
+// VerifyFiles checks the bundle of the binary at binaryPath (this binary if
+// empty): its footer, its ZIP directory, and each file against the manifest.
+// It returns one result per file, sorted by name; the error reports a bundle
+// that could not be checked at all.
+func VerifyFiles(binaryPath string) ([]FileCheck, error) {
+	if binaryPath == "" {
+		zipReader, err := GetBundleReader()
+		if err != nil {
+			return nil, err
+		}
+		if zipReader == nil {
+			return nil, fmt.Errorf("binary is not bundled")
+		}
+		return checkFiles(zipReader)
+	}
+	zipReader, file, err := openBundleFile(binaryPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return checkFiles(zipReader)
+}
+
+func verifyReader(zipReader *zip.Reader) error {
+	checks, err := checkFiles(zipReader)
+	if err != nil {
+		return err
+	}
+	failed := make(map[string][]string)
+	for _, check := range checks {
+		if !check.Passed() {
+			failed[check.Problem] = append(failed[check.Problem], check.Name)
+		}
+	}
+	var problems []string
+	for _, problem := range []string{"corrupt", "missing", "not in manifest"} {
+		if names := failed[problem]; len(names) > 0 {
+			problems = append(problems, problem+": "+strings.Join(names, ", "))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("bundle verification failed: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkFiles compares the bundle's files with its manifest.
+func checkFiles(zipReader *zip.Reader) ([]FileCheck, error) {
+	manifest, err := readManifest(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", ManifestName)
+	}
+	sums, err := zipChecksums(zipReader)
+	if err != nil {
+		return nil, err
+	}
+	var checks []FileCheck
+	for name, want := range manifest {
+		if sum, ok := sums[name]; !ok {
+			checks = append(checks, FileCheck{Name: name, Problem: "missing"})
+		} else if sum != want {
+			checks = append(checks, FileCheck{Name: name, Problem: "corrupt"})
+		} else {
+			checks = append(checks, FileCheck{Name: name})
+		}
+	}
+	for name := range sums {
+		if _, ok := manifest[name]; !ok {
+			checks = append(checks, FileCheck{Name: name, Problem: "not in manifest"})
+		}
+	}
+	slices.SortFunc(checks, func(a, b FileCheck) int { return strings.Compare(a.Name, b.Name) })
+	return checks, nil
+}
+
+// readManifest parses the bundle's manifest into bundle name -> hex SHA-256.
+// Returns nil if the bundle has no manifest.
+func readManifest(zipReader *zip.Reader) (map[string]string, error) {
+	var entry *zip.File
+	for _, f := range zipReader.File {
+		if f.Name == ManifestName {
+			entry = f
+			break
+		}
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	rc, err := entry.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", ManifestName, err)
+	}
+	defer rc.Close()
+	manifest := make(map[string]string)
+	scanner := bufio.NewScanner(rc)
+	for line := 1; scanner.Scan(); line++ {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != 64 || name == "" {
+			return nil, fmt.Errorf("%s line %d is malformed", ManifestName, line)
+		}
+		manifest[name] = sum
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ManifestName, err)
+	}
+	return manifest, nil
+}
+
+// writeManifest adds the manifest for sums (bundle name -> hex SHA-256).
+func writeManifest(zipWriter *zip.Writer, sums map[string]string, method uint16) error {
+	writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: ManifestName, Method: method})
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if _, err := fmt.Fprintf(writer, "%s  %s\n", sums[name], name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipChecksums hashes a bundle's files other than the manifest, streaming them
+// rather than going through the content cache.
+func zipChecksums(zipReader *zip.Reader) (map[string]string, error) {
+	sums := make(map[string]string, len(zipReader.File))
+	for _, f := range zipReader.File {
+		if f.FileInfo().IsDir() || f.Name == ManifestName {
+			continue
+		}
+		sum, err := entryChecksum(f)
+		if err != nil {
+			return nil, err
+		}
+		sums[f.Name] = sum
+	}
+	return sums, nil
+}
+
+func entryChecksum(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", f.Name, err)
+	}
+	defer rc.Close()
+	sum, err := checksum(rc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", f.Name, err)
+	}
+	return sum, nil
+}
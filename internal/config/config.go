@@ -6,11 +6,12 @@ package config
 import (
 	"flag"
 	"fmt"
-	"log"
 	"os"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/BurntSushi/toml"
@@ -22,14 +23,48 @@ type Config struct {
 	Lua     LuaConfig     `toml:"lua"`
 	Session SessionConfig `toml:"session"`
 	Logging LoggingConfig `toml:"logging"`
+	Flags   FlagsConfig   `toml:"flags"`
+	MCP     MCPConfig     `toml:"mcp"`
+	Store   StoreConfig   `toml:"store"`
+
+	// Per-component verbosities set while running (nil = Logging.Components)
+	levels atomic.Pointer[map[string]int]
 }
 
 // ServerConfig holds server-related settings.
 type ServerConfig struct {
-	Host   string `toml:"host"`
-	Port   int    `toml:"port"`
-	Socket string `toml:"socket"`
-	Dir    string `toml:"-"` // Custom site directory (CLI only, not in config file)
+	Host      string `toml:"host"`
+	Port      int    `toml:"port"`
+	PortRetry int    `toml:"port_retry"` // Try up to N following ports when Port is busy (0 = fail)
+	Socket    string `toml:"socket"`
+	Dir       string `toml:"-"`          // Custom site directory (CLI only, not in config file)
+	Metrics   bool   `toml:"metrics"`    // Record handler timing, served at /metrics
+	CSP       string `toml:"csp"`        // Content-Security-Policy for pages; script nonces are added (empty = off)
+	A11yAudit bool   `toml:"a11y_audit"` // Audit viewdef HTML for accessibility problems on load
+	Strict    bool   `toml:"strict"`     // Reject unknown message fields and warn about unknown properties
+	Demo      string `toml:"demo"`       // "on" serves the built-in demo site when there is no bundle or Dir; "off"
+	// AssetDirs lists the top-level site directories served at /_bundle/ (empty = off)
+	AssetDirs []string `toml:"asset_dirs"`
+	CrashDir  string   `toml:"crash_dir"`  // Crash bundles are written here on an unrecovered panic (empty = off)
+	CrashKeep int      `toml:"crash_keep"` // Newest crash bundles kept; older ones are removed
+	// BundleCacheSize caps the bytes of bundled file contents kept in memory (0 = no cache)
+	BundleCacheSize int64 `toml:"bundle_cache_size"`
+	VerifyBundle    bool  `toml:"verify_bundle"` // Check the bundle against its manifest at startup; refuse to start if it fails
+	// NoBundleFallback serves only Dir; otherwise files missing from Dir come from the bundle
+	NoBundleFallback bool `toml:"no_bundle_fallback"`
+	// StaticCache is the Cache-Control for static files; index.html is always
+	// no-cache and hashed names immutable ("" = none)
+	StaticCache string `toml:"static_cache"`
+	// WSCompression offers per-message deflate on WebSocket connections
+	WSCompression bool `toml:"ws_compression"`
+	// WSBatchWindow holds a WebSocket connection's messages this long after the
+	// first, then sends them as one array frame (0 = send each at once)
+	WSBatchWindow Duration `toml:"ws_batch_window"`
+}
+
+// BundleFallback reports whether files missing from Dir are looked up in the bundle.
+func (s ServerConfig) BundleFallback() bool {
+	return s.Dir != "" && !s.NoBundleFallback
 }
 
 // LuaConfig holds Lua runtime settings.
@@ -37,17 +72,102 @@ type LuaConfig struct {
 	Enabled bool   `toml:"enabled"`
 	Path    string `toml:"path"`
 	Hotload bool   `toml:"hotload"` // Watch lua directory for changes
+	// KeyStyle "camel" maps camelCase frontend paths to snake_case Lua fields ("" = off)
+	KeyStyle string `toml:"key_style"`
+	// ReloadPolicy is what frontend messages get while a hot reload is queued or
+	// running: "wait" holds them until it finishes, "reject" answers retry ("" = wait)
+	ReloadPolicy string `toml:"reload_policy"`
+	// MaxConvertDepth and MaxConvertNodes bound converting Lua tables to JSON;
+	// past them values are truncated with a diag (0 = no limit)
+	MaxConvertDepth int           `toml:"max_convert_depth"`
+	MaxConvertNodes int           `toml:"max_convert_nodes"`
+	Sandbox         SandboxConfig `toml:"sandbox"`
+}
+
+// SandboxConfig limits each task a session's Lua executor runs (0 = no limit).
+type SandboxConfig struct {
+	MaxCallDepth      int     `toml:"max_call_depth"`      // Nested Lua calls
+	MaxMemoryMB       int     `toml:"max_memory_mb"`       // Megabytes allocated while one task runs
+	CPUTimeoutSeconds float64 `toml:"cpu_timeout_seconds"` // Time one task may run
+}
+
+// Enabled reports whether any limit is set.
+func (s SandboxConfig) Enabled() bool {
+	return s.MaxCallDepth > 0 || s.MaxMemoryMB > 0 || s.CPUTimeoutSeconds > 0
+}
+
+// StoreConfig limits the variables held by all sessions together (0 = no
+// limit). Past a limit, idle sessions with no connections are evicted, least
+// recently active first.
+type StoreConfig struct {
+	MaxVariables int `toml:"max_variables"`
+	MaxMemoryMB  int `toml:"max_memory_mb"` // Estimated megabytes of variable values and properties
+}
+
+// Enabled reports whether any limit is set.
+func (s StoreConfig) Enabled() bool {
+	return s.MaxVariables > 0 || s.MaxMemoryMB > 0
 }
 
 // SessionConfig holds session-related settings.
 type SessionConfig struct {
-	Timeout Duration `toml:"timeout"` // Session expiration (0 = never)
+	Timeout            Duration             `toml:"timeout"`             // Session expiration (0 = never)
+	RequestTimeout     Duration             `toml:"request_timeout"`     // Limit for ui.onSessionRequest (0 = none)
+	PollTimeout        Duration             `toml:"poll_timeout"`        // Polling connections expire after this long without a request
+	PollMemoryLimit    int64                `toml:"poll_memory_limit"`   // Queued poll bytes that cut long-polls short (0 = no limit)
+	ObjectGCInterval   Duration             `toml:"object_gc_interval"`  // How often sessions are checked for object collection (0 = never)
+	ObjectGCThreshold  int64                `toml:"object_gc_threshold"` // Objects registered since the last collection that trigger one
+	IdleAction         string               `toml:"idle_action"`         // What Timeout does: "destroy" or "hibernate"
+	HibernateDir       string               `toml:"hibernate_dir"`       // Where hibernated sessions are saved
+	HibernateRetention Duration             `toml:"hibernate_retention"` // Hibernated sessions are dropped after this (0 = never)
+	ErrorHistory       int                  `toml:"error_history"`       // Recent protocol errors kept per connection for getErrors (0 = none)
+	Quota              QuotaConfig          `toml:"quota"`
+	Properties         PropertyLimitsConfig `toml:"properties"`
+}
+
+// Values of PropertyLimitsConfig.InvalidUTF8.
+const (
+	InvalidUTF8Reject  = "reject"
+	InvalidUTF8Replace = "replace"
+)
+
+// PropertyLimitsConfig bounds variable property values, from frontends and
+// from Lua, in bytes (0 = unlimited).
+type PropertyLimitsConfig struct {
+	MaxSize         int64  `toml:"max_size"`          // One property value
+	MaxViewdefsSize int64  `toml:"max_viewdefs_size"` // The viewdefs property, instead of MaxSize
+	MaxTotal        int64  `toml:"max_total"`         // All of one variable's property values
+	InvalidUTF8     string `toml:"invalid_utf8"`      // "reject" or "replace" (with U+FFFD)
+}
+
+// QuotaConfig holds per-session transfer limits in bytes (0 = unlimited).
+type QuotaConfig struct {
+	UploadBytes   int64    `toml:"upload_bytes"`
+	DownloadBytes int64    `toml:"download_bytes"`
+	FetchBytes    int64    `toml:"fetch_bytes"`
+	Reset         Duration `toml:"reset"` // Counters reset this often (0 = never)
+}
+
+// FlagsConfig holds session feature flag settings.
+type FlagsConfig struct {
+	Defaults   map[string]any `toml:"defaults"`    // Flag defaults (override the site's flags.json)
+	AllowQuery bool           `toml:"allow_query"` // Dev only: allow ?flag.NAME=value overrides
 }
 
 // LoggingConfig holds logging settings.
 type LoggingConfig struct {
 	Level     string `toml:"level"`     // "debug", "info", "warn", "error"
 	Verbosity int    `toml:"verbosity"` // 0=none, 1=connections, 2=messages, 3=variables, 4=values
+	// MaxValueLength caps logged values in bytes (0 = unlimited)
+	MaxValueLength int `toml:"max_value_length"`
+	// Redact lists property names or dotted paths whose logged values are hidden
+	Redact []string `toml:"redact"`
+	// ErrorWindow collapses repeats of a variable's error into one summary per window (0 = log every one)
+	ErrorWindow Duration `toml:"error_window"`
+	// TraceDir holds per-session trace files (see the trace message)
+	TraceDir string `toml:"trace_dir"`
+	// Components sets verbosities for log components; others use Verbosity
+	Components map[string]int `toml:"components"`
 }
 
 // verbosityCounter implements flag.Value for counting -v flags.
@@ -121,24 +241,77 @@ func (d Duration) String() string {
 func DefaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Host:   "0.0.0.0",
-			Port:   8080,
-			Socket: defaultSocketPath(),
+			Host:            "0.0.0.0",
+			Port:            8080,
+			Socket:          defaultSocketPath(),
+			CrashDir:        DefaultCrashDir(),
+			CrashKeep:       5,
+			Demo:            DemoOn,
+			BundleCacheSize: 8 << 20,
+			StaticCache:     "no-cache",
+			WSCompression:   true,
+			WSBatchWindow:   Duration(5 * time.Millisecond),
 		},
 		Lua: LuaConfig{
-			Enabled: true,
-			Path:    "lua/",
+			Enabled:         true,
+			Path:            "lua/",
+			MaxConvertDepth: 64,
+			MaxConvertNodes: 100000,
 		},
 		Session: SessionConfig{
-			Timeout: Duration(24 * time.Hour),
+			Timeout:            Duration(24 * time.Hour),
+			RequestTimeout:     Duration(2 * time.Second),
+			PollTimeout:        Duration(2 * time.Minute),
+			PollMemoryLimit:    64 << 20,
+			ObjectGCInterval:   Duration(time.Minute),
+			ObjectGCThreshold:  10000,
+			IdleAction:         IdleDestroy,
+			HibernateDir:       DefaultHibernateDir(),
+			HibernateRetention: Duration(7 * 24 * time.Hour),
+			ErrorHistory:       50,
+			Properties: PropertyLimitsConfig{
+				MaxSize:     256 << 10,
+				MaxTotal:    1 << 20,
+				InvalidUTF8: InvalidUTF8Reject,
+			},
 		},
 		Logging: LoggingConfig{
-			Level:     "info",
-			Verbosity: 0,
+			Level:          "info",
+			Verbosity:      0,
+			MaxValueLength: DefaultMaxLogValue,
+			ErrorWindow:    Duration(time.Minute),
+			TraceDir:       DefaultTraceDir(),
 		},
 	}
 }
 
+// DefaultCrashDir returns where crash bundles go unless configured otherwise.
+func DefaultCrashDir() string {
+	return filepath.Join(os.TempDir(), "ui-engine-crashes")
+}
+
+// DefaultTraceDir returns where session trace files go unless configured otherwise.
+func DefaultTraceDir() string {
+	return filepath.Join(os.TempDir(), "ui-engine-traces")
+}
+
+// Demo site settings (ServerConfig.Demo).
+const (
+	DemoOn  = "on"
+	DemoOff = "off"
+)
+
+// Session idle actions (SessionConfig.IdleAction).
+const (
+	IdleDestroy   = "destroy"
+	IdleHibernate = "hibernate"
+)
+
+// DefaultHibernateDir returns where hibernated sessions go unless configured otherwise.
+func DefaultHibernateDir() string {
+	return filepath.Join(os.TempDir(), "ui-engine-hibernate")
+}
+
 // defaultSocketPath returns the platform-specific default socket path.
 func defaultSocketPath() string {
 	if runtime.GOOS == "windows" {
@@ -147,44 +320,124 @@ func defaultSocketPath() string {
 	return "/tmp/ui.sock"
 }
 
-// Load loads configuration from CLI flags, environment variables, and TOML file.
-// Priority: CLI flags > env vars > TOML file > defaults
-func Load(args []string) (*Config, error) {
-	cfg := DefaultConfig()
-
-	// Preprocess args to expand -vvv into -v -v -v
-	args = ExpandVerbosityFlags(args)
+// cliFlags holds the values of the serve command's flags.
+type cliFlags struct {
+	dir            string
+	host           string
+	port           int
+	portRetry      int
+	socket         string
+	metrics        bool
+	csp            string
+	staticCache    string
+	wsCompression  bool
+	wsBatchWindow  time.Duration
+	a11yAudit      bool
+	strict         bool
+	demo           string
+	assetDirs      string
+	crashDir       string
+	crashKeep      int
+	verifyBundle   bool
+	noFallback     bool
+	lua            bool
+	luaPath        string
+	hotload        bool
+	keyStyle       string
+	sessionTimeout time.Duration
+	idleAction     string
+	hibernateDir   string
+	hibernateKeep  time.Duration
+	logLevel       string
+	logMaxValue    int
+	logRedact      string
+	logErrorWindow time.Duration
+	verbosity      verbosityCounter
+}
 
-	// Parse CLI flags first to get --dir if specified
-	fs := flag.NewFlagSet("remote-ui", flag.ContinueOnError)
-	dir := fs.String("dir", "", "Serve from directory instead of embedded site")
+// bindFlags defines the server flags on fs.
+func bindFlags(fs *flag.FlagSet) *cliFlags {
+	f := &cliFlags{}
+	fs.StringVar(&f.dir, "dir", "", "Serve from directory instead of embedded site")
 
 	// Server flags
-	host := fs.String("host", "", "Browser listen address")
-	port := fs.Int("port", 0, "Browser listen port")
-	socket := fs.String("socket", "", "Backend API socket path")
+	fs.StringVar(&f.host, "host", "", "Browser listen address")
+	fs.IntVar(&f.port, "port", 0, "Browser listen port")
+	fs.IntVar(&f.portRetry, "port-retry", 0, "Try up to N following ports if the port is busy")
+	fs.StringVar(&f.socket, "socket", "", "Backend API socket path")
+	fs.BoolVar(&f.metrics, "metrics", false, "Record handler timing, served at /metrics")
+	fs.StringVar(&f.csp, "csp", "", "Content-Security-Policy for pages (script nonces are added)")
+	fs.StringVar(&f.staticCache, "static-cache", "", "Cache-Control for static files, e.g. max-age=3600 (default no-cache)")
+	fs.BoolVar(&f.wsCompression, "ws-compression", true, "Compress WebSocket messages with per-message deflate")
+	fs.DurationVar(&f.wsBatchWindow, "ws-batch-window", -1, "Send a WebSocket connection's messages together once this passes after the first (0=send each at once)")
+	fs.BoolVar(&f.a11yAudit, "a11y-audit", false, "Audit viewdefs for accessibility problems on load")
+	fs.BoolVar(&f.strict, "strict", false, "Reject unknown message fields and warn about unknown properties")
+	fs.StringVar(&f.demo, "demo", "", "Serve the built-in demo site when there is no bundle or --dir: on or off")
+	fs.StringVar(&f.assetDirs, "asset-dirs", "", "Comma-separated top-level site directories served at /_bundle/")
+	fs.StringVar(&f.crashDir, "crash-dir", "", "Directory for crash bundles")
+	fs.IntVar(&f.crashKeep, "crash-keep", 0, "Number of crash bundles to keep")
+	fs.BoolVar(&f.verifyBundle, "verify-bundle", false, "Check the bundle against its manifest and refuse to start if it fails")
+	fs.BoolVar(&f.noFallback, "no-bundle-fallback", false, "Serve only --dir, without falling back to the bundle for missing files")
 
 	// Lua flags
-	lua := fs.Bool("lua", true, "Enable Lua backend")
-	luaPath := fs.String("lua-path", "", "Lua scripts directory")
-	hotload := fs.Bool("hotload", false, "Watch lua directory for changes")
+	fs.BoolVar(&f.lua, "lua", true, "Enable Lua backend")
+	fs.StringVar(&f.luaPath, "lua-path", "", "Lua scripts directory")
+	fs.BoolVar(&f.hotload, "hotload", false, "Watch lua directory for changes")
+	fs.StringVar(&f.keyStyle, "key-style", "", "Map frontend path keys to Lua fields: camel")
 
 	// Session flags
-	sessionTimeout := fs.Duration("session-timeout", 0, "Session expiration (0=never)")
+	fs.DurationVar(&f.sessionTimeout, "session-timeout", 0, "Session expiration (0=never)")
+	fs.StringVar(&f.idleAction, "idle-action", "", "What happens to expired sessions: destroy or hibernate")
+	fs.StringVar(&f.hibernateDir, "hibernate-dir", "", "Directory for hibernated sessions")
+	fs.DurationVar(&f.hibernateKeep, "hibernate-retention", 0, "How long hibernated sessions are kept")
 
 	// Logging flags
-	logLevel := fs.String("log-level", "", "Log level: debug, info, warn, error")
-	var verbosity verbosityCounter
-	fs.Var(&verbosity, "v", "Verbosity level (use -v, -vv, or -vvv)")
+	fs.StringVar(&f.logLevel, "log-level", "", "Log level (debug, info, warn, error) or component verbosities (protocol=2,viewdef=4)")
+	fs.IntVar(&f.logMaxValue, "log-max-value", -1, "Max bytes of a logged value (0=unlimited)")
+	fs.StringVar(&f.logRedact, "log-redact", "", "Comma-separated property names/paths to redact in logs")
+	fs.DurationVar(&f.logErrorWindow, "log-error-window", -1, "Log a variable's repeated error once per window (0=log every one)")
+	fs.Var(&f.verbosity, "v", "Verbosity level (use -v, -vv, or -vvv)")
 
+	return f
+}
+
+// DefineFlags defines the server flags on fs, e.g. for shell completion.
+func DefineFlags(fs *flag.FlagSet) {
+	bindFlags(fs)
+}
+
+// Load loads configuration from CLI flags, environment variables, and TOML file,
+// failing if Validate finds errors. Its warnings are left to the caller.
+// Priority: CLI flags > env vars > TOML file > defaults
+func Load(args []string) (*Config, error) {
+	cfg, err := Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if err := ProblemsError(cfg.Validate()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Parse loads configuration like Load without validating it.
+func Parse(args []string) (*Config, error) {
+	cfg := DefaultConfig()
+
+	// Preprocess args to expand -vvv into -v -v -v
+	args = ExpandVerbosityFlags(args)
+
+	// Parse CLI flags first to get --dir if specified
+	fs := flag.NewFlagSet("remote-ui", flag.ContinueOnError)
+	f := bindFlags(fs)
 	if err := fs.Parse(args); err != nil {
 		return nil, err
 	}
 
 	// Load TOML config if exists (from config/ subdirectory)
 	configPath := "config/config.toml"
-	if *dir != "" {
-		configPath = *dir + "/config/config.toml"
+	if f.dir != "" {
+		configPath = f.dir + "/config/config.toml"
 	}
 	if err := cfg.loadTOML(configPath); err != nil && !os.IsNotExist(err) {
 		return nil, err
@@ -194,36 +447,101 @@ func Load(args []string) (*Config, error) {
 	cfg.applyEnv()
 
 	// Apply CLI flags (highest priority)
-	if *host != "" {
-		cfg.Server.Host = *host
+	if f.host != "" {
+		cfg.Server.Host = f.host
+	}
+	if f.port != 0 {
+		cfg.Server.Port = f.port
+	}
+	if f.portRetry != 0 {
+		cfg.Server.PortRetry = f.portRetry
+	}
+	if f.socket != "" {
+		cfg.Server.Socket = f.socket
+	}
+	if f.metrics {
+		cfg.Server.Metrics = true
+	}
+	if f.csp != "" {
+		cfg.Server.CSP = f.csp
+	}
+	if f.staticCache != "" {
+		cfg.Server.StaticCache = f.staticCache
+	}
+	if fs.Lookup("ws-compression").Value.String() != "true" {
+		cfg.Server.WSCompression = f.wsCompression
+	}
+	if f.wsBatchWindow >= 0 {
+		cfg.Server.WSBatchWindow = Duration(f.wsBatchWindow)
 	}
-	if *port != 0 {
-		cfg.Server.Port = *port
+	if f.a11yAudit {
+		cfg.Server.A11yAudit = true
 	}
-	if *socket != "" {
-		cfg.Server.Socket = *socket
+	if f.strict {
+		cfg.Server.Strict = true
+	}
+	if f.demo != "" {
+		cfg.Server.Demo = f.demo
+	}
+	if f.assetDirs != "" {
+		cfg.Server.AssetDirs = splitList(f.assetDirs)
+	}
+	if f.crashDir != "" {
+		cfg.Server.CrashDir = f.crashDir
+	}
+	if f.crashKeep != 0 {
+		cfg.Server.CrashKeep = f.crashKeep
+	}
+	if f.verifyBundle {
+		cfg.Server.VerifyBundle = true
+	}
+	if f.noFallback {
+		cfg.Server.NoBundleFallback = true
 	}
 	if fs.Lookup("lua").Value.String() != "true" {
-		cfg.Lua.Enabled = *lua
+		cfg.Lua.Enabled = f.lua
 	}
-	if *luaPath != "" {
-		cfg.Lua.Path = *luaPath
+	if f.luaPath != "" {
+		cfg.Lua.Path = f.luaPath
 	}
-	if *hotload {
+	if f.hotload {
 		cfg.Lua.Hotload = true
 	}
-	if *sessionTimeout != 0 {
-		cfg.Session.Timeout = Duration(*sessionTimeout)
+	if f.keyStyle != "" {
+		cfg.Lua.KeyStyle = f.keyStyle
+	}
+	if f.sessionTimeout != 0 {
+		cfg.Session.Timeout = Duration(f.sessionTimeout)
 	}
-	if *logLevel != "" {
-		cfg.Logging.Level = *logLevel
+	if f.idleAction != "" {
+		cfg.Session.IdleAction = f.idleAction
 	}
-	if verbosity > 0 {
-		cfg.Logging.Verbosity = int(verbosity)
+	if f.hibernateDir != "" {
+		cfg.Session.HibernateDir = f.hibernateDir
+	}
+	if f.hibernateKeep != 0 {
+		cfg.Session.HibernateRetention = Duration(f.hibernateKeep)
+	}
+	if f.logLevel != "" {
+		if err := cfg.setLogLevel(f.logLevel); err != nil {
+			return nil, err
+		}
+	}
+	if f.verbosity > 0 {
+		cfg.Logging.Verbosity = int(f.verbosity)
+	}
+	if f.logMaxValue >= 0 {
+		cfg.Logging.MaxValueLength = f.logMaxValue
+	}
+	if f.logRedact != "" {
+		cfg.Logging.Redact = splitList(f.logRedact)
+	}
+	if f.logErrorWindow >= 0 {
+		cfg.Logging.ErrorWindow = Duration(f.logErrorWindow)
 	}
 
 	// Store dir in config (not from TOML, only CLI)
-	cfg.Server.Dir = *dir
+	cfg.Server.Dir = f.dir
 
 	return cfg, nil
 }
@@ -245,9 +563,62 @@ func (c *Config) applyEnv() {
 			c.Server.Port = port
 		}
 	}
+	if v := os.Getenv("UI_PORT_RETRY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.PortRetry = n
+		}
+	}
 	if v := os.Getenv("UI_SOCKET"); v != "" {
 		c.Server.Socket = v
 	}
+	if v := os.Getenv("UI_METRICS"); v != "" {
+		c.Server.Metrics = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_CSP"); v != "" {
+		c.Server.CSP = v
+	}
+	if v := os.Getenv("UI_STATIC_CACHE"); v != "" {
+		c.Server.StaticCache = v
+	}
+	if v := os.Getenv("UI_WS_COMPRESSION"); v != "" {
+		c.Server.WSCompression = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_WS_BATCH_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Server.WSBatchWindow = Duration(d)
+		}
+	}
+	if v := os.Getenv("UI_A11Y_AUDIT"); v != "" {
+		c.Server.A11yAudit = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_STRICT"); v != "" {
+		c.Server.Strict = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_DEMO"); v != "" {
+		c.Server.Demo = v
+	}
+	if v := os.Getenv("UI_ASSET_DIRS"); v != "" {
+		c.Server.AssetDirs = splitList(v)
+	}
+	if v := os.Getenv("UI_CRASH_DIR"); v != "" {
+		c.Server.CrashDir = v
+	}
+	if v := os.Getenv("UI_CRASH_KEEP"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Server.CrashKeep = n
+		}
+	}
+	if v := os.Getenv("UI_VERIFY_BUNDLE"); v != "" {
+		c.Server.VerifyBundle = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_NO_BUNDLE_FALLBACK"); v != "" {
+		c.Server.NoBundleFallback = v == "true" || v == "1"
+	}
+	if v := os.Getenv("UI_BUNDLE_CACHE_SIZE"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.Server.BundleCacheSize = n
+		}
+	}
 	if v := os.Getenv("UI_LUA"); v != "" {
 		c.Lua.Enabled = v == "true" || v == "1"
 	}
@@ -257,19 +628,139 @@ func (c *Config) applyEnv() {
 	if v := os.Getenv("UI_HOTLOAD"); v != "" {
 		c.Lua.Hotload = v == "true" || v == "1"
 	}
+	if v := os.Getenv("UI_KEY_STYLE"); v != "" {
+		c.Lua.KeyStyle = v
+	}
+	if v := os.Getenv("UI_RELOAD_POLICY"); v != "" {
+		c.Lua.ReloadPolicy = v
+	}
+	if v := os.Getenv("UI_LUA_MAX_CONVERT_DEPTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Lua.MaxConvertDepth = n
+		}
+	}
+	if v := os.Getenv("UI_LUA_MAX_CONVERT_NODES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Lua.MaxConvertNodes = n
+		}
+	}
+	if v := os.Getenv("UI_LUA_SANDBOX_MAX_CALL_DEPTH"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Lua.Sandbox.MaxCallDepth = n
+		}
+	}
+	if v := os.Getenv("UI_LUA_SANDBOX_MAX_MEMORY_MB"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Lua.Sandbox.MaxMemoryMB = n
+		}
+	}
+	if v := os.Getenv("UI_LUA_SANDBOX_CPU_TIMEOUT_SECONDS"); v != "" {
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			c.Lua.Sandbox.CPUTimeoutSeconds = n
+		}
+	}
+	if v := os.Getenv("UI_STORE_MAX_VARIABLES"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Store.MaxVariables = n
+		}
+	}
+	if v := os.Getenv("UI_STORE_MAX_MEMORY_MB"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Store.MaxMemoryMB = n
+		}
+	}
 	if v := os.Getenv("UI_SESSION_TIMEOUT"); v != "" {
 		if d, err := time.ParseDuration(v); err == nil {
 			c.Session.Timeout = Duration(d)
 		}
 	}
+	if v := os.Getenv("UI_SESSION_REQUEST_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Session.RequestTimeout = Duration(d)
+		}
+	}
+	if v := os.Getenv("UI_SESSION_POLL_TIMEOUT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Session.PollTimeout = Duration(d)
+		}
+	}
+	if v := os.Getenv("UI_SESSION_POLL_MEMORY_LIMIT"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.Session.PollMemoryLimit = n
+		}
+	}
+	if v := os.Getenv("UI_SESSION_OBJECT_GC_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Session.ObjectGCInterval = Duration(d)
+		}
+	}
+	if v := os.Getenv("UI_SESSION_OBJECT_GC_THRESHOLD"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			c.Session.ObjectGCThreshold = n
+		}
+	}
+	if v := os.Getenv("UI_SESSION_ERROR_HISTORY"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Session.ErrorHistory = n
+		}
+	}
+	if v := os.Getenv("UI_SESSION_IDLE_ACTION"); v != "" {
+		c.Session.IdleAction = v
+	}
+	if v := os.Getenv("UI_SESSION_HIBERNATE_DIR"); v != "" {
+		c.Session.HibernateDir = v
+	}
+	if v := os.Getenv("UI_SESSION_HIBERNATE_RETENTION"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Session.HibernateRetention = Duration(d)
+		}
+	}
+	for capability, name := range map[MCPCapability]string{
+		MCPRun:            "UI_MCP_ALLOW_RUN",
+		MCPStateWrite:     "UI_MCP_ALLOW_STATE_WRITE",
+		MCPViewdefWrite:   "UI_MCP_ALLOW_VIEWDEF_WRITE",
+		MCPSessionControl: "UI_MCP_ALLOW_SESSION_CONTROL",
+	} {
+		if v := os.Getenv(name); v != "" {
+			allowed := v == "true" || v == "1"
+			*c.MCP.setting(capability) = &allowed
+		}
+	}
 	if v := os.Getenv("UI_LOG_LEVEL"); v != "" {
-		c.Logging.Level = v
+		c.setLogLevel(v)
 	}
 	if v := os.Getenv("UI_VERBOSITY"); v != "" {
 		if verbosity, err := strconv.Atoi(v); err == nil {
 			c.Logging.Verbosity = verbosity
 		}
 	}
+	if v := os.Getenv("UI_LOG_MAX_VALUE"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			c.Logging.MaxValueLength = n
+		}
+	}
+	if v := os.Getenv("UI_LOG_REDACT"); v != "" {
+		c.Logging.Redact = splitList(v)
+	}
+	if v := os.Getenv("UI_LOG_ERROR_WINDOW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			c.Logging.ErrorWindow = Duration(d)
+		}
+	}
+	if v := os.Getenv("UI_LOG_TRACE_DIR"); v != "" {
+		c.Logging.TraceDir = v
+	}
+}
+
+// splitList splits a comma-separated list, dropping empty entries.
+func splitList(s string) []string {
+	var result []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
 
 // parseEnvInt parses an environment variable as an integer.
@@ -291,9 +782,9 @@ func (c *Config) Verbosity() int {
 }
 
 // Log logs a message if the configured verbosity level is greater than or equal to the required level.
+// Component code logs through Logger instead, so its verbosity can be set separately.
 func (c *Config) Log(level int, format string, args ...interface{}) {
 	if c.Logging.Verbosity >= level {
-		indent := strings.Repeat(" ", level)
-		log.Printf("[v%d]%s "+format, append([]interface{}{level, indent}, args...)...)
+		c.logf(level, "", format, args...)
 	}
 }
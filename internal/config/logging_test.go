@@ -0,0 +1,51 @@
+// CRC: crc-Config.md
+// Spec: deployment.md (Logging)
+package config
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+// TestComponentLogLevels verifies --log-level sets per-component verbosities,
+// others fall back to the global one, lines carry the component tag, and the
+// levels can be replaced while running
+func TestComponentLogLevels(t *testing.T) {
+	cfg, err := Load([]string{"-v", "--log-level", "protocol=0,viewdef=4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(&out)
+
+	cfg.Logger(LogProtocol).Log(1, "protocol message")
+	cfg.Logger(LogViewdef).Log(4, "viewdef delivery")
+	cfg.Logger(LogLua).Log(1, "lua at global verbosity")
+	cfg.Logger(LogLua).Log(2, "lua above global verbosity")
+	got := out.String()
+	if strings.Contains(got, "protocol message") || strings.Contains(got, "above global") {
+		t.Errorf("logged a line above its component's verbosity:\n%s", got)
+	}
+	if !strings.Contains(got, "[v4 viewdef]") || !strings.Contains(got, "[v1 lua]") {
+		t.Errorf("missing component lines:\n%s", got)
+	}
+
+	if err := cfg.SetLogLevels("protocol=2"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ComponentVerbosity(LogProtocol) != 2 || cfg.ComponentVerbosity(LogViewdef) != 1 {
+		t.Errorf("after SetLogLevels protocol=%d viewdef=%d, want 2 and the global 1",
+			cfg.ComponentVerbosity(LogProtocol), cfg.ComponentVerbosity(LogViewdef))
+	}
+	for _, bad := range []string{"protocol", "protocol=x", "network=2"} {
+		if err := cfg.SetLogLevels(bad); err == nil {
+			t.Errorf("SetLogLevels(%q) succeeded", bad)
+		}
+	}
+	if cfg.ComponentVerbosity(LogProtocol) != 2 {
+		t.Error("a rejected SetLogLevels changed the levels")
+	}
+}
@@ -0,0 +1,69 @@
+// CRC: crc-Config.md
+// Spec: deployment.md
+package config
+
+import (
+	"fmt"
+)
+
+// MCPCapability names a class of MCP tool operations that can be granted or withheld.
+// Read-only tools (state_get, viewdef_list) need no capability.
+type MCPCapability string
+
+const (
+	MCPRun            MCPCapability = "run"             // Execute Lua code
+	MCPStateWrite     MCPCapability = "state_write"     // Modify session state
+	MCPViewdefWrite   MCPCapability = "viewdef_write"   // Install or change viewdefs
+	MCPSessionControl MCPCapability = "session_control" // Create, destroy or reconfigure sessions
+)
+
+// MCPConfig grants capabilities to the MCP server's tools.
+// A nil field takes the default: allowed in development, denied in a bundled binary.
+type MCPConfig struct {
+	AllowRun            *bool `toml:"allow_run"`
+	AllowStateWrite     *bool `toml:"allow_state_write"`
+	AllowViewdefWrite   *bool `toml:"allow_viewdef_write"`
+	AllowSessionControl *bool `toml:"allow_session_control"`
+}
+
+// MCPCapabilityError reports a tool call refused because its capability is disabled.
+type MCPCapabilityError struct {
+	Capability MCPCapability
+}
+
+func (e *MCPCapabilityError) Error() string {
+	return fmt.Sprintf("MCP capability %q disabled (set mcp.allow_%s = true to enable)", e.Capability, e.Capability)
+}
+
+// CheckMCP returns an *MCPCapabilityError if capability is not granted.
+// bundled selects the default for unset capabilities.
+func (c *Config) CheckMCP(capability MCPCapability, bundled bool) error {
+	if capability == "" {
+		return nil
+	}
+	allowed := !bundled
+	if setting := c.MCP.setting(capability); setting == nil {
+		return &MCPCapabilityError{Capability: capability}
+	} else if *setting != nil {
+		allowed = **setting
+	}
+	if !allowed {
+		return &MCPCapabilityError{Capability: capability}
+	}
+	return nil
+}
+
+// setting returns the config field for a capability, or nil for an unknown capability.
+func (m *MCPConfig) setting(capability MCPCapability) **bool {
+	switch capability {
+	case MCPRun:
+		return &m.AllowRun
+	case MCPStateWrite:
+		return &m.AllowStateWrite
+	case MCPViewdefWrite:
+		return &m.AllowViewdefWrite
+	case MCPSessionControl:
+		return &m.AllowSessionControl
+	}
+	return nil
+}
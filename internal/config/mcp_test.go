@@ -0,0 +1,50 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// TestCheckMCPCapabilities verifies each capability gate and the bundled read-only default
+func TestCheckMCPCapabilities(t *testing.T) {
+	on, off := true, false
+	caps := []MCPCapability{MCPRun, MCPStateWrite, MCPViewdefWrite, MCPSessionControl}
+
+	for _, capability := range caps {
+		t.Run(string(capability), func(t *testing.T) {
+			cfg := DefaultConfig()
+			if err := cfg.CheckMCP(capability, false); err != nil {
+				t.Errorf("development default should allow: %v", err)
+			}
+			var denied *MCPCapabilityError
+			if err := cfg.CheckMCP(capability, true); !errors.As(err, &denied) || denied.Capability != capability {
+				t.Errorf("bundled default should deny, got %v", err)
+			}
+
+			// Explicit settings override the default either way
+			*cfg.MCP.setting(capability) = &on
+			if err := cfg.CheckMCP(capability, true); err != nil {
+				t.Errorf("widened bundled capability denied: %v", err)
+			}
+			*cfg.MCP.setting(capability) = &off
+			if err := cfg.CheckMCP(capability, false); err == nil {
+				t.Error("disabled capability allowed")
+			}
+
+			// Other capabilities are unaffected
+			for _, other := range caps {
+				if other != capability && cfg.CheckMCP(other, false) != nil {
+					t.Errorf("disabling %s affected %s", capability, other)
+				}
+			}
+		})
+	}
+
+	cfg := DefaultConfig()
+	if err := cfg.CheckMCP("", true); err != nil {
+		t.Errorf("read-only tools should always be allowed: %v", err)
+	}
+	if err := cfg.CheckMCP("unknown", false); err == nil {
+		t.Error("unknown capability allowed")
+	}
+}
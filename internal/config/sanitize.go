@@ -0,0 +1,97 @@
+// CRC: crc-Config.md
+// Spec: deployment.md
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactedMarker replaces the values of redacted properties in logs.
+const RedactedMarker = "«redacted»"
+
+// DefaultMaxLogValue is the default maximum number of bytes of a value written to the log.
+const DefaultMaxLogValue = 512
+
+// Sanitize prepares a logged value using the configured redaction and truncation settings.
+// JSON input has redacted keys replaced before truncation; other input is only truncated.
+func (c *Config) Sanitize(value string) string {
+	return TruncateValue(RedactJSON(value, c.Logging.Redact), c.Logging.MaxValueLength)
+}
+
+// TruncateValue shortens s to at most max bytes without splitting a rune,
+// appending an ellipsis and the original length. A max <= 0 disables truncation.
+func TruncateValue(s string, max int) string {
+	if max <= 0 || len(s) <= max {
+		return s
+	}
+	cut := max
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… (%d bytes)", s[:cut], len(s))
+}
+
+// RedactJSON replaces the values of the named keys in a JSON document with RedactedMarker.
+// A name without dots matches that key at any depth; a dotted name ("properties.email")
+// matches the key path from the root, ignoring array indices.
+// Input that is not JSON is returned unchanged.
+func RedactJSON(data string, names []string) string {
+	if len(names) == 0 || data == "" {
+		return data
+	}
+	var doc any
+	if err := json.Unmarshal([]byte(data), &doc); err != nil {
+		return data
+	}
+	if !redactValue(doc, "", names) {
+		return data
+	}
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return data
+	}
+	return string(out)
+}
+
+// redactValue walks a decoded JSON value in place and reports whether anything was redacted.
+func redactValue(v any, path string, names []string) bool {
+	redacted := false
+	switch val := v.(type) {
+	case map[string]any:
+		for key, child := range val {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			if matchesRedaction(key, childPath, names) {
+				val[key] = RedactedMarker
+				redacted = true
+			} else if redactValue(child, childPath, names) {
+				redacted = true
+			}
+		}
+	case []any:
+		for _, child := range val {
+			if redactValue(child, path, names) {
+				redacted = true
+			}
+		}
+	}
+	return redacted
+}
+
+func matchesRedaction(key, path string, names []string) bool {
+	for _, name := range names {
+		if strings.Contains(name, ".") {
+			if name == path {
+				return true
+			}
+		} else if name == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+// CRC: crc-Config.md
+// Spec: deployment.md
+package config
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// TestTruncateValueShort verifies values under the limit are unchanged
+func TestTruncateValueShort(t *testing.T) {
+	if got := TruncateValue("hello", 10); got != "hello" {
+		t.Errorf("TruncateValue = %q, want hello", got)
+	}
+	if got := TruncateValue(strings.Repeat("x", 100), 0); len(got) != 100 {
+		t.Errorf("max 0 should disable truncation, got %d bytes", len(got))
+	}
+}
+
+// TestTruncateValueReportsLength verifies the ellipsis and original length
+func TestTruncateValueReportsLength(t *testing.T) {
+	got := TruncateValue(strings.Repeat("a", 600), 512)
+	want := strings.Repeat("a", 512) + "… (600 bytes)"
+	if got != want {
+		t.Errorf("TruncateValue = %q, want %q", got, want)
+	}
+}
+
+// TestTruncateValueRuneBoundaries verifies multibyte runes are never split
+func TestTruncateValueRuneBoundaries(t *testing.T) {
+	inputs := []string{
+		"héllo wörld",
+		"日本語のテキスト",
+		"emoji 😀😀😀 end",
+		"👩‍👩‍👧‍👦 family",
+	}
+	for _, input := range inputs {
+		for max := 1; max < len(input); max++ {
+			got := TruncateValue(input, max)
+			if !utf8.ValidString(got) {
+				t.Errorf("TruncateValue(%q, %d) produced invalid UTF-8: %q", input, max, got)
+			}
+			prefix := strings.SplitN(got, "…", 2)[0]
+			if len(prefix) > max {
+				t.Errorf("TruncateValue(%q, %d) kept %d bytes", input, max, len(prefix))
+			}
+		}
+	}
+}
+
+// TestRedactJSONByName verifies property names are redacted at any depth
+func TestRedactJSONByName(t *testing.T) {
+	data := `{"varId":3,"properties":{"email":"a@b.c","type":"Person"}}`
+	got := RedactJSON(data, []string{"email"})
+	if strings.Contains(got, "a@b.c") {
+		t.Errorf("email not redacted: %s", got)
+	}
+	if !strings.Contains(got, RedactedMarker) || !strings.Contains(got, "Person") {
+		t.Errorf("unexpected redaction result: %s", got)
+	}
+}
+
+// TestRedactJSONByPath verifies dotted paths only match from the root
+func TestRedactJSONByPath(t *testing.T) {
+	data := `{"properties":{"token":"secret"},"value":{"token":"keep"}}`
+	got := RedactJSON(data, []string{"properties.token"})
+	if strings.Contains(got, "secret") {
+		t.Errorf("properties.token not redacted: %s", got)
+	}
+	if !strings.Contains(got, "keep") {
+		t.Errorf("value.token should not be redacted: %s", got)
+	}
+}
+
+// TestRedactJSONNonJSON verifies non-JSON input is returned unchanged
+func TestRedactJSONNonJSON(t *testing.T) {
+	if got := RedactJSON("not json", []string{"x"}); got != "not json" {
+		t.Errorf("RedactJSON = %q", got)
+	}
+}
+
+// TestSanitizeRedactsBeforeTruncating verifies redaction applies to values past the limit
+func TestSanitizeRedactsBeforeTruncating(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Logging.MaxValueLength = 40
+	cfg.Logging.Redact = []string{"ssn"}
+	data := `{"padding":"` + strings.Repeat("p", 50) + `","ssn":"123-45-6789"}`
+	got := cfg.Sanitize(data)
+	if strings.Contains(got, "123-45") {
+		t.Errorf("ssn leaked: %s", got)
+	}
+	if !strings.Contains(got, "bytes)") {
+		t.Errorf("expected truncation marker: %s", got)
+	}
+}
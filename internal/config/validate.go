@@ -0,0 +1,155 @@
+// CRC: crc-Config.md
+// Spec: deployment.md (Configuration Validation)
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Problem is a conflict between configured options found by Validate.
+type Problem struct {
+	Fatal   bool     // The server refuses to start with it
+	Options []string // Config keys involved, e.g. "lua.path"
+	Message string
+}
+
+func (p Problem) String() string {
+	kind := "warning"
+	if p.Fatal {
+		kind = "error"
+	}
+	return fmt.Sprintf("%s: %s", kind, p.Message)
+}
+
+// Validate cross-checks options that depend on each other. Errors are values
+// the server would misread; warnings are options overridden or ignored
+// because of another, named as "X overridden by Y" or "X ignored: ...".
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	fail := func(message string, options ...string) {
+		problems = append(problems, Problem{Fatal: true, Options: options, Message: message})
+	}
+	warn := func(message string, options ...string) {
+		problems = append(problems, Problem{Options: options, Message: message})
+	}
+	defaults := DefaultConfig()
+
+	if c.Server.Port < 0 || c.Server.Port > 65535 {
+		fail(fmt.Sprintf("server.port %d is not a port number", c.Server.Port), "server.port")
+	}
+	if c.Server.PortRetry < 0 {
+		fail(fmt.Sprintf("server.port_retry %d is negative", c.Server.PortRetry), "server.port_retry")
+	} else if c.Server.PortRetry > 0 && c.Server.Port == 0 {
+		warn("server.port_retry ignored: server.port 0 picks a free port", "server.port_retry", "server.port")
+	}
+	if c.Server.Demo != DemoOn && c.Server.Demo != DemoOff {
+		fail(fmt.Sprintf("server.demo %q must be %q or %q", c.Server.Demo, DemoOn, DemoOff), "server.demo")
+	}
+	if c.Server.Dir != "" && c.Server.NoBundleFallback && c.Server.VerifyBundle {
+		warn("server.verify_bundle checks the bundle, but --dir with no_bundle_fallback serves the site instead", "server.verify_bundle", "dir")
+	}
+	if c.Server.Dir == "" && c.Server.NoBundleFallback {
+		warn("server.no_bundle_fallback ignored: only --dir falls back to the bundle", "server.no_bundle_fallback", "dir")
+	}
+	if c.Server.CrashDir == "" && c.Server.CrashKeep != defaults.Server.CrashKeep {
+		warn("server.crash_keep ignored: server.crash_dir is empty, so crash bundles are off", "server.crash_keep", "server.crash_dir")
+	}
+	if c.Server.CrashKeep < 0 {
+		fail(fmt.Sprintf("server.crash_keep %d is negative", c.Server.CrashKeep), "server.crash_keep")
+	}
+	for _, dir := range c.Server.AssetDirs {
+		if !fs.ValidPath(dir) || dir == "." || strings.Contains(dir, "/") {
+			fail(fmt.Sprintf("server.asset_dirs entry %q is not a top-level directory name", dir), "server.asset_dirs")
+		}
+	}
+	if c.Server.BundleCacheSize < 0 {
+		fail(fmt.Sprintf("server.bundle_cache_size %d is negative", c.Server.BundleCacheSize), "server.bundle_cache_size")
+	}
+
+	if c.Server.Dir != "" && path.Clean(filepath.ToSlash(c.Lua.Path)) != path.Clean(defaults.Lua.Path) {
+		siteLua := filepath.Join(c.Server.Dir, "lua")
+		if filepath.Clean(c.Lua.Path) != siteLua {
+			warn(fmt.Sprintf("lua.path %s overridden by --dir (using %s)", c.Lua.Path, siteLua), "lua.path", "dir")
+		}
+	}
+	if c.Lua.KeyStyle != "" && c.Lua.KeyStyle != "camel" {
+		fail(fmt.Sprintf("lua.key_style %q must be \"camel\" or empty", c.Lua.KeyStyle), "lua.key_style")
+	}
+	if c.Lua.ReloadPolicy != "" && c.Lua.ReloadPolicy != "wait" && c.Lua.ReloadPolicy != "reject" {
+		fail(fmt.Sprintf("lua.reload_policy %q must be \"wait\" or \"reject\"", c.Lua.ReloadPolicy), "lua.reload_policy")
+	}
+	if sb := c.Lua.Sandbox; sb.MaxCallDepth < 0 || sb.MaxMemoryMB < 0 || sb.CPUTimeoutSeconds < 0 {
+		fail("lua.sandbox limits must not be negative", "lua.sandbox")
+	}
+	if c.Store.MaxVariables < 0 || c.Store.MaxMemoryMB < 0 {
+		fail("store limits must not be negative", "store")
+	}
+	if !c.Lua.Enabled {
+		if c.Lua.KeyStyle != "" {
+			warn("lua.key_style ignored: Lua is disabled", "lua.key_style", "lua.enabled")
+		}
+		if c.MCP.AllowRun != nil && *c.MCP.AllowRun {
+			warn("mcp.allow_run ignored: Lua is disabled, so MCP has no Lua to run", "mcp.allow_run", "lua.enabled")
+		}
+	}
+
+	switch c.Session.IdleAction {
+	case IdleDestroy, "":
+		if c.Session.HibernateDir != defaults.Session.HibernateDir {
+			warn("session.hibernate_dir ignored: session.idle_action is not hibernate", "session.hibernate_dir", "session.idle_action")
+		}
+		if c.Session.HibernateRetention != defaults.Session.HibernateRetention {
+			warn("session.hibernate_retention ignored: session.idle_action is not hibernate", "session.hibernate_retention", "session.idle_action")
+		}
+	case IdleHibernate:
+		if c.Session.Timeout == 0 {
+			warn("session.idle_action hibernate ignored: session.timeout 0 never expires sessions", "session.idle_action", "session.timeout")
+		}
+		if c.Session.HibernateDir == "" {
+			fail("session.idle_action hibernate needs session.hibernate_dir", "session.idle_action", "session.hibernate_dir")
+		}
+	default:
+		fail(fmt.Sprintf("session.idle_action %q must be %q or %q", c.Session.IdleAction, IdleDestroy, IdleHibernate), "session.idle_action")
+	}
+	if c.Session.ObjectGCInterval == 0 && c.Session.ObjectGCThreshold != defaults.Session.ObjectGCThreshold {
+		warn("session.object_gc_threshold ignored: session.object_gc_interval 0 turns collection off", "session.object_gc_threshold", "session.object_gc_interval")
+	}
+	if c.Session.ErrorHistory < 0 {
+		fail(fmt.Sprintf("session.error_history %d is negative", c.Session.ErrorHistory), "session.error_history")
+	}
+	limits := c.Session.Properties
+	switch limits.InvalidUTF8 {
+	case InvalidUTF8Reject, InvalidUTF8Replace, "":
+	default:
+		fail(fmt.Sprintf("session.properties.invalid_utf8 %q must be %q or %q", limits.InvalidUTF8, InvalidUTF8Reject, InvalidUTF8Replace), "session.properties.invalid_utf8")
+	}
+	for _, limit := range []struct {
+		key  string
+		size int64
+	}{{"max_size", limits.MaxSize}, {"max_viewdefs_size", limits.MaxViewdefsSize}, {"max_total", limits.MaxTotal}} {
+		if limit.size < 0 {
+			fail(fmt.Sprintf("session.properties.%s %d is negative", limit.key, limit.size), "session.properties."+limit.key)
+		}
+	}
+	if limits.MaxTotal > 0 && limits.MaxSize > limits.MaxTotal {
+		warn(fmt.Sprintf("session.properties.max_size %d exceeds max_total %d, so max_total limits single values", limits.MaxSize, limits.MaxTotal), "session.properties.max_size", "session.properties.max_total")
+	}
+	return problems
+}
+
+// ProblemsError joins the fatal problems into one error, or returns nil if
+// there are none.
+func ProblemsError(problems []Problem) error {
+	var errs []error
+	for _, p := range problems {
+		if p.Fatal {
+			errs = append(errs, errors.New(p.Message))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidate verifies conflicting options produce the expected errors and
+// warnings, and consistent ones none
+func TestValidate(t *testing.T) {
+	on := true
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   string // "" = no problems; otherwise "error: ..." or "warning: ..." prefix of the only problem
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"dir alone", func(c *Config) { c.Server.Dir = "site" }, ""},
+		{"dir with default lua path", func(c *Config) { c.Server.Dir = "site"; c.Lua.Path = "lua" }, ""},
+		{"dir with its own lua path", func(c *Config) { c.Server.Dir = "site"; c.Lua.Path = "site/lua/" }, ""},
+		{"dir overrides lua path", func(c *Config) { c.Server.Dir = "site"; c.Lua.Path = "other/lua" },
+			"warning: lua.path other/lua overridden by --dir"},
+		{"lua path without dir", func(c *Config) { c.Lua.Path = "other/lua" }, ""},
+		{"bad port", func(c *Config) { c.Server.Port = 70000 }, "error: server.port 70000"},
+		{"negative port retry", func(c *Config) { c.Server.PortRetry = -1 }, "error: server.port_retry -1"},
+		{"port retry with port 0", func(c *Config) { c.Server.Port = 0; c.Server.PortRetry = 3 }, "warning: server.port_retry ignored"},
+		{"unknown demo", func(c *Config) { c.Server.Demo = "yes" }, `error: server.demo "yes"`},
+		{"demo off", func(c *Config) { c.Server.Demo = DemoOff }, ""},
+		{"verify bundle with dir only", func(c *Config) { c.Server.Dir = "site"; c.Server.NoBundleFallback = true; c.Server.VerifyBundle = true }, "warning: server.verify_bundle"},
+		{"verify bundle under dir", func(c *Config) { c.Server.Dir = "site"; c.Server.VerifyBundle = true }, ""},
+		{"no bundle fallback without dir", func(c *Config) { c.Server.NoBundleFallback = true }, "warning: server.no_bundle_fallback ignored"},
+		{"verify bundle alone", func(c *Config) { c.Server.VerifyBundle = true }, ""},
+		{"crash keep without crash dir", func(c *Config) { c.Server.CrashDir = ""; c.Server.CrashKeep = 9 }, "warning: server.crash_keep ignored"},
+		{"crash dir off", func(c *Config) { c.Server.CrashDir = "" }, ""},
+		{"nested asset dir", func(c *Config) { c.Server.AssetDirs = []string{"assets", "i18n/en"} }, `error: server.asset_dirs entry "i18n/en"`},
+		{"escaping asset dir", func(c *Config) { c.Server.AssetDirs = []string{".."} }, `error: server.asset_dirs entry ".."`},
+		{"negative bundle cache", func(c *Config) { c.Server.BundleCacheSize = -1 }, "error: server.bundle_cache_size"},
+		{"negative error history", func(c *Config) { c.Session.ErrorHistory = -1 }, "error: session.error_history"},
+		{"unknown invalid_utf8", func(c *Config) { c.Session.Properties.InvalidUTF8 = "drop" }, "error: session.properties.invalid_utf8"},
+		{"negative property limit", func(c *Config) { c.Session.Properties.MaxTotal = -1 }, "error: session.properties.max_total"},
+		{"property size over total", func(c *Config) { c.Session.Properties.MaxSize = 2 << 20 }, "warning: session.properties.max_size"},
+		{"negative sandbox limit", func(c *Config) { c.Lua.Sandbox.CPUTimeoutSeconds = -1 }, "error: lua.sandbox"},
+		{"unknown key style", func(c *Config) { c.Lua.KeyStyle = "snake" }, `error: lua.key_style "snake"`},
+		{"key style without lua", func(c *Config) { c.Lua.Enabled = false; c.Lua.KeyStyle = "camel" }, "warning: lua.key_style ignored"},
+		{"unknown reload policy", func(c *Config) { c.Lua.ReloadPolicy = "drop" }, `error: lua.reload_policy "drop"`},
+		{"reject reload policy", func(c *Config) { c.Lua.ReloadPolicy = "reject" }, ""},
+		{"mcp run without lua", func(c *Config) { c.Lua.Enabled = false; c.MCP.AllowRun = &on }, "warning: mcp.allow_run ignored"},
+		{"lua disabled", func(c *Config) { c.Lua.Enabled = false }, ""},
+		{"unknown idle action", func(c *Config) { c.Session.IdleAction = "sleep" }, `error: session.idle_action "sleep"`},
+		{"hibernate", func(c *Config) { c.Session.IdleAction = IdleHibernate }, ""},
+		{"hibernate without timeout", func(c *Config) { c.Session.IdleAction = IdleHibernate; c.Session.Timeout = 0 },
+			"warning: session.idle_action hibernate ignored"},
+		{"hibernate without dir", func(c *Config) { c.Session.IdleAction = IdleHibernate; c.Session.HibernateDir = "" },
+			"error: session.idle_action hibernate needs"},
+		{"hibernate dir while destroying", func(c *Config) { c.Session.HibernateDir = "/var/ui" }, "warning: session.hibernate_dir ignored"},
+		{"hibernate retention while destroying", func(c *Config) { c.Session.HibernateRetention = Duration(time.Hour) },
+			"warning: session.hibernate_retention ignored"},
+		{"gc threshold without gc", func(c *Config) { c.Session.ObjectGCInterval = 0; c.Session.ObjectGCThreshold = 5 },
+			"warning: session.object_gc_threshold ignored"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.change(cfg)
+			problems := cfg.Validate()
+			if tt.want == "" {
+				if len(problems) != 0 {
+					t.Errorf("problems = %v, want none", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.HasPrefix(problems[0].String(), tt.want) {
+				t.Errorf("problems = %v, want one starting %q", problems, tt.want)
+			}
+			if err := ProblemsError(problems); (err != nil) != strings.HasPrefix(tt.want, "error:") {
+				t.Errorf("ProblemsError = %v", err)
+			}
+		})
+	}
+}
+
+// TestLoadRejectsErrors verifies Load fails on validation errors, keeps
+// warnings for the caller, and Parse skips validation
+func TestLoadRejectsErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if _, err := Load([]string{"--idle-action", "sleep"}); err == nil || !strings.Contains(err.Error(), "session.idle_action") {
+		t.Errorf("Load error = %v, want the idle action error", err)
+	}
+	if _, err := Parse([]string{"--idle-action", "sleep"}); err != nil {
+		t.Errorf("Parse error = %v", err)
+	}
+	cfg, err := Load([]string{"--dir", "site", "--lua-path", "other/lua"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := cfg.Validate(); len(problems) != 1 || problems[0].Fatal {
+		t.Errorf("problems = %v, want one warning", problems)
+	}
+}
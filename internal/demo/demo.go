@@ -0,0 +1,54 @@
+// Package demo embeds a small example site, served when the binary has no
+// bundle and no --dir is given.
+// Spec: deployment.md (Demo Site)
+// CRC: crc-Bundle.md
+package demo
+
+import (
+	"archive/zip"
+	"bytes"
+	"embed"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+//go:embed site
+var files embed.FS
+
+// FS returns the demo site, laid out like a site directory (html/, lua/, viewdefs/).
+func FS() fs.FS {
+	site, _ := fs.Sub(files, "site")
+	return site
+}
+
+// Zip returns the demo site as a zip archive, the form a bundle takes.
+func Zip() (*zip.Reader, error) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	if err := w.AddFS(FS()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+}
+
+// Extract writes the demo site to dir, as a starting point for a new site.
+func Extract(dir string) error {
+	return fs.WalkDir(FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dir, filepath.FromSlash(path))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := fs.ReadFile(FS(), path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+}
@@ -0,0 +1,35 @@
+// Spec: deployment.md (Demo Site)
+// CRC: crc-Bundle.md
+package demo
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestExtract verifies the demo site extracts as a site directory, and that it
+// stays small enough not to matter to the binary's size
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	if err := Extract(dir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"html/index.html", "lua/main.lua", "viewdefs/Counter.DEFAULT.html"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("extracted site is missing %s", name)
+		}
+	}
+
+	var size int64
+	fs.WalkDir(FS(), ".", func(path string, d fs.DirEntry, err error) error {
+		if info, err := d.Info(); err == nil && !d.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	if size > 50*1024 {
+		t.Errorf("demo site is %d bytes, over the 50KB budget", size)
+	}
+}
@@ -0,0 +1,5 @@
+var Y=Object.defineProperty;var G=(o,e,t)=>e in o?Y(o,e,{enumerable:!0,configurable:!0,writable:!0,value:t}):o[e]=t;var a=(o,e,t)=>G(o,typeof e!="symbol"?e+"":e,t);(function(){const e=document.createElement("link").relList;if(e&&e.supports&&e.supports("modulepreload"))return;for(const i of document.querySelectorAll('link[rel="modulepreload"]'))s(i);new MutationObserver(i=>{for(const n of i)if(n.type==="childList")for(const r of n.addedNodes)r.tagName==="LINK"&&r.rel==="modulepreload"&&s(r)}).observe(document,{childList:!0,subtree:!0});function t(i){const n={};return i.integrity&&(n.integrity=i.integrity),i.referrerPolicy&&(n.referrerPolicy=i.referrerPolicy),i.crossOrigin==="use-credentials"?n.credentials="include":i.crossOrigin==="anonymous"?n.credentials="omit":n.credentials="same-origin",n}function s(i){if(i.ep)return;i.ep=!0;const n=t(i);fetch(i.href,n)}})();const z={high:0,medium:1,low:2};class J{constructor(e){a(this,"pendingMessages",[]);a(this,"debounceTimer",null);a(this,"insertionOrder",0);a(this,"userEvent",!1);a(this,"sendFn");a(this,"batchStartTime",0);a(this,"debounceInterval",10);a(this,"maxBatchWait",200);this.sendFn=e}enqueue(e,t="medium"){this.pendingMessages.length===0&&(this.batchStartTime=performance.now()),this.pendingMessages.push({message:e,priority:t,order:this.insertionOrder++}),this.startDebounce()}enqueueAndFlush(e,t="high"){this.pendingMessages.push({message:e,priority:t,order:this.insertionOrder++}),this.userEvent=!0,this.flushNow()}flush(){if(this.pendingMessages.length===0){this.userEvent=!1;return}this.pendingMessages.sort((s,i)=>{const n=z[s.priority]-z[i.priority];return n!==0?n:s.order-i.order});const e=this.pendingMessages.map(s=>s.message),t={userEvent:this.userEvent,messages:e};this.pendingMessages=[],this.insertionOrder=0,this.userEvent=!1,this.batchStartTime=0,this.sendFn(JSON.stringify(t))}createDebounceTimer(){return setTimeout(()=>{this.debounceTimer=null,this.flush()},this.debounceInterval)}startDebounce(){if(this.batchStartTime>0&&performance.now()-this.batchStartTime>=this.maxBatchWait){this.flushNow();return}this.cancelDebounce(),this.debounceTimer=this.createDebounceTimer()}ensureDebounceStarted(){this.debounceTimer===null&&(this.debounceTimer=this.createDebounceTimer())}cancelDebounce(){this.debounceTimer!==null&&(clearTimeout(this.debounceTimer),this.debounceTimer=null)}flushNow(){this.cancelDebounce(),this.flush()}get pendingCount(){return this.pendingMessages.length}}class X{constructor(e){a(this,"ws",null);a(this,"sessionId");a(this,"reconnectAttempts",0);a(this,"maxReconnectAttempts",5);a(this,"reconnectDelay",1e3);a(this,"messageHandlers",[]);a(this,"errorHandlers",[]);a(this,"connectHandlers",[]);a(this,"disconnectHandlers",[]);a(this,"nextVarId",2);a(this,"batcher");this.sessionId=e,this.batcher=new J(t=>this.sendRaw(t))}connect(){return new Promise((e,t)=>{const i=`${window.location.protocol==="https:"?"wss:":"ws:"}//${window.location.host}/ws/${this.sessionId}`;this.ws=new WebSocket(i),this.ws.onopen=()=>{this.reconnectAttempts=0,this.connectHandlers.forEach(n=>n()),e()},this.ws.onmessage=n=>{try{const r=JSON.parse(n.data);if(this.batcher.ensureDebounceStarted(),Array.isArray(r)){console.log("RECEIVED BATCH",r.length,"messages");for(const l of r)this.processIncomingItem(l)}else this.processIncomingItem(r)}catch(r){console.error("Failed to parse message:",r)}},this.ws.onerror=n=>{console.error("WebSocket error:",n),t(new Error("WebSocket connection failed"))},this.ws.onclose=()=>{this.disconnectHandlers.forEach(n=>n()),this.attemptReconnect()}})}attemptReconnect(){if(this.reconnectAttempts>=this.maxReconnectAttempts){this.errorHandlers.forEach(t=>t("Max reconnection attempts reached"));return}this.reconnectAttempts++;const e=this.reconnectDelay*Math.pow(2,this.reconnectAttempts-1);setTimeout(()=>{this.connect().catch(()=>{})},e)}processIncomingItem(e){!e||typeof e!="object"||this.handleMessage(e)}handleMessage(e){this.messageHandlers.forEach(t=>t(e))}createVarId(){return this.nextVarId++}sendRaw(e){this.ws&&this.ws.readyState===WebSocket.OPEN?this.ws.send(e):console.error("WebSocket not connected")}send(e,t="medium",s=!1){if(!this.ws||this.ws.readyState!==WebSocket.OPEN){console.error("WebSocket not connected");return}s?this.batcher.enqueueAndFlush(e,t):this.batcher.enqueue(e,t)}onMessage(e){return this.messageHandlers.push(e),()=>{const t=this.messageHandlers.indexOf(e);t>=0&&this.messageHandlers.splice(t,1)}}onError(e){return this.errorHandlers.push(e),()=>{const t=this.errorHandlers.indexOf(e);t>=0&&this.errorHandlers.splice(t,1)}}onConnect(e){return this.connectHandlers.push(e),()=>{const t=this.connectHandlers.indexOf(e);t>=0&&this.connectHandlers.splice(t,1)}}onDisconnect(e){return this.disconnectHandlers.push(e),()=>{const t=this.disconnectHandlers.indexOf(e);t>=0&&this.disconnectHandlers.splice(t,1)}}disconnect(){this.batcher.flushNow(),this.ws&&(this.ws.close(),this.ws=null)}isConnected(){return this.ws!==null&&this.ws.readyState===WebSocket.OPEN}}class Q{constructor(e){a(this,"variables",new Map);a(this,"errors",new Map);a(this,"watchers",new Map);a(this,"errorWatchers",new Map);a(this,"connection");this.connection=e,e.onMessage(t=>{if(t.type==="update"){const s=t.data;this.handleUpdate(s.varId,s.value,s.properties)}else if(t.type==="destroy"){const s=t.data;this.handleDestroy(s.varId)}else if(t.type==="error"){const s=t.data;s.varId!==void 0&&this.handleError(s.varId,s.code,s.description)}})}handleUpdate(e,t,s,i){let n=this.variables.get(e);n||(n={varId:e,value:void 0,properties:{}},i!==void 0&&(n.parentId=i),this.variables.set(e,n)),console.log("handleUpdate varId",e,"parentId",n.parentId),t!==void 0&&(n.value=t),s&&(n.properties={...n.properties,...s}),this.errors.has(e)&&(this.errors.delete(e),this.notifyErrorWatchers(e,null));const r=this.watchers.get(e);r&&r.forEach(l=>l(n,t,s))}handleError(e,t,s){const i={code:t,description:s};this.errors.set(e,i),this.notifyErrorWatchers(e,i)}notifyErrorWatchers(e,t){const s=this.errorWatchers.get(e);s&&s.forEach(i=>i(t))}handleDestroy(e){this.variables.delete(e),this.watchers.delete(e),this.errors.delete(e)}watch(e,t,s){let i=this.watchers.get(e);return i||(i=new Set,this.watchers.set(e,i),s&&this.connection.send({type:"watch",data:{varId:e}})),i.add(t),()=>{i.delete(t),i.size===0&&(this.watchers.delete(e),this.connection.send({type:"unwatch",data:{varId:e}}))}}watchErrors(e,t){let s=this.errorWatchers.get(e);s||(s=new Set,this.errorWatchers.set(e,s)),s.add(t);const i=this.errors.get(e)??null;return t(i),()=>{s.delete(t),s.size===0&&this.errorWatchers.delete(e)}}getError(e){return this.errors.get(e)??null}get(e){return this.variables.get(e)}create(e){const t=this.connection.createVarId(),s={varId:t,value:void 0,properties:e.properties||{}};return e.parentId!==void 0&&(s.parentId=e.parentId),e.widget&&(s.widget=e.widget,s.properties.elementId||(s.properties.elementId=e.widget.elementId)),this.variables.set(t,s),console.log("SENDING CREATE id=",t),this.connection.send({type:"create",data:{id:t,...e}}),t}update(e,t,s){var l;const i=this.variables.get(e),n=(l=i==null?void 0:i.properties)==null?void 0:l.access,r=n==="action";i&&t!==void 0&&!(r||n==="w")&&i.value===t||(i&&(t!==void 0&&(i.value=t),s&&(i.properties={...i.properties,...s})),this.connection.send({type:"update",data:{varId:e,value:t,properties:s}},"medium",r))}destroy(e){this.connection.send({type:"destroy",data:{varId:e}})}sendError(e,t,s){this.connection.send({type:"error",data:{varId:e,code:t,description:s}}),this.handleError(e,t,s)}}let Z=1;function F(){return`ui-${Z++}`}function M(o){return o.id||(o.id=F()),o.id}const ee={"SL-BADGE":!0},te=new Set(["SL-COPY-BUTTON","SL-OPTION","SL-PROGRESS-BAR","SL-PROGRESS-RING","SL-QR-CODE"]),se=new Set(["INPUT","TEXTAREA","SL-INPUT","SL-TEXTAREA"]);function ie(o){return!se.has(o.tagName)}function ne(o){return o instanceof HTMLElement&&o.nodeName.startsWith("SL-")}function L(o){const[e,t]=o.split("?"),s=e.split("."),i={};if(t){const n=new URLSearchParams(t),r=h=>{const c=n.get(h);return c===""?"true":c};n.has("create")&&(i.create=r("create")),n.has("wrapper")&&(i.wrapper=r("wrapper")),n.has("item")&&(i.item=r("item"));const l={};n.forEach((h,c)=>{c!=="create"&&c!=="wrapper"&&c!=="item"&&(l[c]=h===""?"true":h)}),Object.keys(l).length>0&&(i.props=l)}return{path:e,segments:s,options:i}}function N(o){const e={};return o.create&&(e.create=o.create),o.wrapper&&(e.wrapper=o.wrapper),o.item&&(e.item=o.item),o.props&&Object.assign(e,o.props),e}class q{constructor(e){a(this,"elementId");a(this,"variables",new Map);a(this,"unbindHandlers",new Map);a(this,"views",[]);a(this,"scrollOnOutput",!1);e.id||(e.id=M(e)),this.elementId=e.id}addView(e){this.views.includes(e)||this.views.push(e)}removeView(e){const t=this.views.indexOf(e);t>=0&&this.views.splice(t,1)}scrollToBottom(){const e=this.getElement();e&&e.scrollHeight>e.clientHeight&&(e.scrollTop=e.scrollHeight)}registerBinding(e,t,s){this.variables.set(e,t),this.unbindHandlers.set(e,s)}getVariableId(e){return this.variables.get(e)}hasBinding(e){return this.variables.has(e)}getElement(){return document.getElementById(this.elementId)}unbindAll(){var e,t;for(const s of this.unbindHandlers.values())s();this.unbindHandlers.clear(),this.variables.clear();for(let s=this.views.length-1;s>=0;s--)(t=(e=this.views[s]).onWidgetUnbind)==null||t.call(e);this.views=[]}}const k=class k{constructor(e){a(this,"store");a(this,"widgets",new Map);a(this,"pendingScrollNotifications",new Set);a(this,"scrollProcessingScheduled",!1);this.store=e}addScrollNotification(e){this.pendingScrollNotifications.add(e),this.scrollProcessingScheduled||(this.scrollProcessingScheduled=!0,queueMicrotask(()=>{this.scrollProcessingScheduled=!1,this.processScrollNotifications()}))}processScrollNotifications(){let e=new Set(this.pendingScrollNotifications);for(this.pendingScrollNotifications.clear();e.size>0;){const t=new Set;for(const s of e){const i=this.store.get(s);if(!i)continue;const n=i.properties.elementId;if(n){const r=this.widgets.get(n);if(r!=null&&r.scrollOnOutput){r.scrollToBottom();continue}}i.parentId&&t.add(i.parentId)}e=t}}getWidget(e){return this.widgets.get(e)}getView(e){const t=this.widgets.get(e);return t==null?void 0:t.views[0]}getOrCreateWidget(e){let t=this.widgets.get(e);if(!t){const s=document.getElementById(e);s&&(t=new q(s),this.widgets.set(e,t))}return t}setViewForElement(e,t){const s=this.getOrCreateWidget(e);s&&s.addView(t)}bindElement(e,t){let s=!1;const i=new q(e),n=e.getAttribute("ui-value");n&&(this.createValueBinding(e,t,n,i),s=!0);for(const c of Array.from(e.attributes))if(c.name.startsWith("ui-attr-")){const u=c.name.substring(8);this.createAttrBinding(t,c.value,u,i),s=!0}for(const c of Array.from(e.attributes))if(c.name.startsWith("ui-class-")){const u=c.name.substring(9);this.createClassBinding(t,c.value,u,i),s=!0}for(const c of Array.from(e.attributes))if(c.name.startsWith("ui-style-")){const u=c.name.substring(9);this.createStyleBinding(t,c.value,u,i),s=!0}for(const c of Array.from(e.attributes))if(c.name.startsWith("ui-event-")){const u=c.name.substring(9);this.createEventBinding(e,t,c.value,u,i),s=!0}const r=e.getAttribute("ui-action");r&&(this.createActionBinding(e,t,r,i),s=!0);const l=e.getAttribute("ui-code");l&&(this.createCodeBinding(t,l,i),s=!0);const h=e.getAttribute("ui-html");h&&(this.createHtmlBinding(t,h,i),s=!0),s&&this.widgets.set(i.elementId,i);for(const c of Array.from(e.children))this.bindElement(c,t)}unbindElement(e){const t=e.id;if(t){const s=this.widgets.get(t);s&&(s.unbindAll(),this.widgets.delete(t))}for(const s of Array.from(e.children))this.unbindElement(s)}createValueBinding(e,t,s,i){var P,K,U;const n=L(s),r=N(n.options);r.path=n.segments.join(".");const l=((P=n.options.props)==null?void 0:P.keypress)==="true",h=((K=n.options.props)==null?void 0:K.scrollOnOutput)==="true";h&&(i.scrollOnOutput=!0);let c=null,u=null,p=null;const g=!(e instanceof HTMLButtonElement)&&(e instanceof HTMLInputElement||e instanceof HTMLTextAreaElement||e instanceof HTMLSelectElement||ne(e)||"value"in e&&!(e.nodeName in ee)),f=i.elementId,I=()=>{if(h){const w=document.getElementById(f);w&&w.scrollHeight>w.clientHeight&&(w.scrollTop=w.scrollHeight)}},S=ie(e),V=g?w=>{const v=document.getElementById(f);if(!v)return;if(v.tagName.toLowerCase()==="sl-select"){const j=w==null?"":String(w);v.value=j,j===""&&setTimeout(()=>{v.displayLabel=""},0)}else typeof w=="number"?v.value=w:w==null||w===""?v.value="":v.value=w.toString();I(),S&&this.addScrollNotification(t)}:w=>{const v=document.getElementById(f);v&&(v.textContent=(w==null?void 0:w.toString())??"",I(),S&&this.addScrollNotification(t))},d=w=>{const v=document.getElementById(f);v&&(w?(v.classList.add("ui-error"),v.setAttribute("ui-error-code",w.code),v.setAttribute("ui-error-description",w.description)):(v.classList.remove("ui-error"),v.removeAttribute("ui-error-code"),v.removeAttribute("ui-error-description")))},O=w=>{if(c!==null){const v=w.target;this.store.update(c,v.value)}};if((U=n.segments[n.segments.length-1])==null?void 0:U.endsWith("()")){if(r.access===void 0)r.access="r";else if(r.access!=="r"&&r.access!=="action"&&r.access!=="rw"){console.error(`Invalid access '${r.access}' for method call path '${s}' - must be 'r', 'action', or 'rw'`);return}}else(!g&&r.access===void 0||te.has(e.nodeName)&&r.access===void 0)&&(r.access="r");const A=this.store.create({parentId:t,properties:r,widget:i});c=A,u=this.store.watch(A,(w,v)=>V(v)),p=this.store.watchErrors(A,d);const m=this.store.get(A);m&&V(m.value),i.registerBinding("ui-value",A,()=>{u&&u(),p&&p(),C&&e.removeEventListener(C,O),T&&e.removeEventListener(T,W),e.removeEventListener("ui-value-change",R),this.store.destroy(A),e.classList.remove("ui-error"),e.removeAttribute("ui-error-code"),e.removeAttribute("ui-error-description")});const b=e instanceof HTMLInputElement||e instanceof HTMLTextAreaElement||e instanceof HTMLSelectElement,E=e.tagName.toLowerCase(),B=E==="sl-input"||E==="sl-textarea"||E==="sl-select";let C=null,T=null;b&&(C=l?"input":"blur"),B&&(T=l?"sl-input":"sl-change"),C&&e.addEventListener(C,O);const W=w=>{if(c!==null){const v=w.target;this.store.update(c,v.value)}};T&&e.addEventListener(T,W);const R=w=>{const v=w;c!==null&&this.store.update(c,v.detail.value)};e.addEventListener("ui-value-change",R)}createAttrBinding(e,t,s,i){var y;const n=L(t),r=N(n.options);r.path=n.segments.join("."),((y=n.options.props)==null?void 0:y.scrollOnOutput)==="true"&&(i.scrollOnOutput=!0),r.access||(r.access="r");const l=i.elementId,h=g=>{const f=document.getElementById(l);f&&(g!=null&&g!==!1?f.setAttribute(s,g.toString()):f.removeAttribute(s))},c=this.store.create({parentId:e,properties:r,widget:i}),u=this.store.watch(c,(g,f)=>h(f)),p=this.store.get(c);p&&h(p.value),i.registerBinding(`ui-attr-${s}`,c,()=>{u(),this.store.destroy(c)})}createClassBinding(e,t,s,i){var y;const n=L(t),r=N(n.options);r.path=n.segments.join("."),((y=n.options.props)==null?void 0:y.scrollOnOutput)==="true"&&(i.scrollOnOutput=!0),r.access||(r.access="r");const l=i.elementId,h=g=>{const f=document.getElementById(l);f&&(g?f.classList.add(s):f.classList.remove(s))},c=this.store.create({parentId:e,properties:r,widget:i}),u=this.store.watch(c,(g,f)=>h(f)),p=this.store.get(c);p&&h(p.value),i.registerBinding(`ui-class-${s}`,c,()=>{u(),this.store.destroy(c)})}createStyleBinding(e,t,s,i){var y;const n=L(t),r=N(n.options);r.path=n.segments.join("."),((y=n.options.props)==null?void 0:y.scrollOnOutput)==="true"&&(i.scrollOnOutput=!0),r.access||(r.access="r");const l=i.elementId,h=g=>{const f=document.getElementById(l);f&&(g!=null?f.style.setProperty(s,g.toString()):f.style.removeProperty(s))},c=this.store.create({parentId:e,properties:r,widget:i}),u=this.store.watch(c,(g,f)=>h(f)),p=this.store.get(c);p&&h(p.value),i.registerBinding(`ui-style-${s}`,c,()=>{u(),this.store.destroy(c)})}createCodeBinding(e,t,s){var y;const i=L(t),n=N(i.options);n.path=i.segments.join("."),((y=i.options.props)==null?void 0:y.scrollOnOutput)==="true"&&(s.scrollOnOutput=!0),n.access||(n.access="r");const r=s.elementId;let l=null;const h=g=>{if(typeof g!="string"||!g)return;const f=document.getElementById(r);if(f)try{const I=new Function("element","value","variable","store",g),S=l!==null?this.store.get(l):null;I(f,S==null?void 0:S.value,S,this.store)}catch(I){console.error("Error executing ui-code:",I)}},c=this.store.create({parentId:e,properties:n,widget:s});l=c;const u=this.store.watch(c,(g,f)=>h(f)),p=this.store.get(c);p!=null&&p.value&&h(p.value),s.registerBinding("ui-code",c,()=>{u(),this.store.destroy(c)})}createHtmlBinding(e,t,s){var H,A;const i=L(t),n=N(i.options);n.path=i.segments.join("."),((H=i.options.props)==null?void 0:H.scrollOnOutput)==="true"&&(s.scrollOnOutput=!0),n.access||(n.access="r");const r=((A=i.options.props)==null?void 0:A.replace)==="true",l=s.elementId;let h=[l];function c(m){const b=document.createElement("div");return b.innerHTML=m,Array.from(b.childNodes)}function u(m){return m.map((b,E)=>(b.id=E===0?l:F(),b.id))}function p(){const m=document.createElement("span");return m.id=l,m.style.display="none",m}function y(m){const b=document.createElement("span");b.id=l;for(const E of m)b.appendChild(E);return b}function g(m,b,E){for(const B of b)m.insertBefore(B,E)}const S=r?m=>{var R;const b=(m??"").toString(),E=document.getElementById(h[0]);if(!(E!=null&&E.parentNode))return;const B=E.parentNode,C=E.nextSibling;for(const P of h)(R=document.getElementById(P))==null||R.remove();const T=c(b),W=T.filter(P=>P instanceof Element);T.length===0?(B.insertBefore(p(),C),h=[l]):W.length===0?(B.insertBefore(y(T),C),h=[l]):(h=u(W),g(B,T,C)),this.addScrollNotification(e)}:m=>{const b=document.getElementById(l);b&&(b.innerHTML=(m??"").toString(),this.addScrollNotification(e))},V=this.store.create({parentId:e,properties:n,widget:s}),d=this.store.watch(V,(m,b)=>S(b)),O=this.store.get(V);O&&S(O.value),s.registerBinding("ui-html",V,()=>{if(d(),this.store.destroy(V),r)for(const m of h){const b=document.getElementById(m);b&&b.remove()}})}normalizeKeyName(e){const t={enter:"Enter",escape:"Escape",left:"ArrowLeft",right:"ArrowRight",up:"ArrowUp",down:"ArrowDown",tab:"Tab",space:" "},s=e.toLowerCase();return t[s]??s}matchesTargetKey(e,t){const s=this.normalizeKeyName(t);return s.length===1?e.key.toLowerCase()===s.toLowerCase():e.key===s}parseKeypressAttribute(e){const t=e.toLowerCase().split("-"),s=new Set;let i="";for(const n of t)k.MODIFIER_KEYS.has(n)?s.add(n):i=n;return{modifiers:s,key:i}}matchesModifiers(e,t){const s=new Set;if(e.ctrlKey&&s.add("ctrl"),e.shiftKey&&s.add("shift"),e.altKey&&s.add("alt"),e.metaKey&&s.add("meta"),s.size!==t.size)return!1;for(const i of t)if(!s.has(i))return!1;return!0}syncValueBeforeEvent(e,t){const s=t.getVariableId("ui-value");if(s===void 0)return;const i=e.value;if(i===void 0)return;const n=this.store.get(s);n&&n.value!==i&&this.store.update(s,i)}createEventBinding(e,t,s,i,n){if(i.startsWith("keypress-")){this.createKeypressBinding(e,t,s,i,n);return}const r=L(s),l=r.segments.join("."),h=N(r.options);h.path=l,h.access||(h.access="action"),h.priority||(h.priority="low");const c=p=>{u!==null&&(this.syncValueBeforeEvent(e,n),this.store.update(u,null))},u=this.store.create({parentId:t,properties:h,widget:n});e.addEventListener(i,c),n.registerBinding(`ui-event-${i}`,u,()=>{e.removeEventListener(i,c),this.store.destroy(u)})}createKeypressBinding(e,t,s,i,n){const r=i.substring(9);if(!r){console.error("Invalid keypress binding - missing key name:",i);return}const{modifiers:l,key:h}=this.parseKeypressAttribute(r);if(!h){console.error("Invalid keypress binding - no key found:",i);return}const c=L(s),u=N(c.options),p=c.segments.join(".");u.path=p;const y=p.match(/\(\)$/),g=p.match(/\(_\)$/);(y||g)&&(u.access="action");const f=this.store.create({parentId:t,properties:u,widget:n}),I=S=>{const V=S;this.matchesTargetKey(V,h)&&this.matchesModifiers(V,l)&&(this.syncValueBeforeEvent(e,n),this.store.update(f,y?null:h.toLowerCase()))};e.addEventListener("keydown",I),n.registerBinding(`ui-event-${i}`,f,()=>{e.removeEventListener("keydown",I),this.store.destroy(f)})}createActionBinding(e,t,s,i){const n=L(s),r=n.segments.join("."),l=N(n.options);l.path=r,l.access||(l.access="action");const h=r.endsWith("(_)"),c=this.store.create({parentId:t,properties:l,widget:i}),u=p=>{p.preventDefault();const y=h?e.value??null:null;this.store.update(c,y)};e.addEventListener("click",u),i.registerBinding("ui-action",c,()=>{e.removeEventListener("click",u),this.store.destroy(c)})}};a(k,"MODIFIER_KEYS",new Set(["ctrl","shift","alt","meta"]));let D=k;function re(o){const e=o.indexOf(".");return e===-1?null:{type:o.substring(0,e),namespace:o.substring(e+1)}}function _(o,e){return`${o}.${e}`}function oe(o){const e=document.createElement("div");if(e.innerHTML=o.trim(),e.children.length!==1)return null;const t=e.children[0];return t instanceof HTMLTemplateElement?t:null}function ae(o,e){const t=re(o);if(!t)return null;const s=oe(e);return s?{key:o,type:t.type,namespace:t.namespace,template:s}:null}function ce(o){return o.template.content.cloneNode(!0)}function le(o){return Array.from(o.querySelectorAll("script"))}function de(o){for(const e of o){const t=document.createElement("script");t.type="text/javascript",t.textContent=e.textContent,e.id&&(t.id=e.id),t.className=e.className,e.replaceWith(t)}}class he{constructor(){a(this,"viewdefs",new Map);a(this,"pendingViews",new Map);a(this,"errorHandler");a(this,"viewLookup")}setErrorHandler(e){this.errorHandler=e}setViewLookup(e){this.viewLookup=e}store(e,t){const s=ae(e,t);return s?(this.viewdefs.set(e,s),!0):(this.errorHandler&&this.errorHandler(e,"Invalid viewdef: must be a single <template> element"),!1)}processViewdefs(e){const t=[];for(const[s,i]of Object.entries(e)){const n=this.viewdefs.has(s);this.store(s,i)&&n&&t.push(s)}this.processPendingViews();for(const s of t)this.rerenderViewsForKey(s)}rerenderViewsForKey(e){if(!this.viewLookup){console.warn("[ViewdefStore] Hot-reload: viewLookup not set, cannot re-render");return}const t=`[ui-viewdef="${e}"]`,s=document.querySelectorAll(t);console.log(`[ViewdefStore] Hot-reload: re-rendering ${s.length} views for ${e}`);for(const i of s)if(i instanceof HTMLElement&&i.id){const n=this.viewLookup(i.id);if(n)try{n.forceRender()}catch(r){console.error(`[ViewdefStore] Hot-reload: error re-rendering view ${i.id}:`,r)}else console.warn(`[ViewdefStore] Hot-reload: no view found for element ${i.id}`)}}get(e,t,s){if(t){const n=_(e,t),r=this.viewdefs.get(n);if(r)return r}if(s){const n=_(e,s),r=this.viewdefs.get(n);if(r)return r}const i=_(e,"DEFAULT");return this.viewdefs.get(i)}getByKey(e){return this.viewdefs.get(e)}has(e,t){return this.get(e,t)!==void 0}addPendingView(e){this.pendingViews.set(e.id,e)}removePendingView(e){this.pendingViews.delete(e)}processPendingViews(){const e=[];for(const[t,s]of this.pendingViews)s.render()&&e.push(t);for(const t of e)this.pendingViews.delete(t)}getPendingViewCount(){return this.pendingViews.size}getViewdefCount(){return this.viewdefs.size}getKeys(){return Array.from(this.viewdefs.keys())}clear(){this.viewdefs.clear()}}function ue(o){const e=L(o);return{path:e.path,wrapper:e.options.wrapper,item:e.options.item,props:e.options.props??{}}}class fe{constructor(e,t,s,i){a(this,"elementId");a(this,"itemWrapper");a(this,"variableId",null);a(this,"itemViews",[]);a(this,"exemplarHtml");a(this,"viewdefStore");a(this,"variableStore");a(this,"unwatch",null);a(this,"binding");a(this,"_scrollOnOutput",!1);a(this,"pathConfig",null);this.elementId=M(e),this.itemWrapper=e.getAttribute("ui-item-wrapper")||void 0,this.viewdefStore=t,this.variableStore=s,this.binding=i;const n=e.firstElementChild;n instanceof HTMLElement?(this.exemplarHtml=n.outerHTML,e.removeChild(n)):this.exemplarHtml="<div></div>"}getElement(){return document.getElementById(this.elementId)}setScrollOnOutput(e){this._scrollOnOutput=e}registerWidget(){if(!this.binding)return;this.binding.setViewForElement(this.elementId,{forceRender:()=>this.update()});const e=this.binding.getWidget(this.elementId);e&&this._scrollOnOutput&&(e.scrollOnOutput=!0)}notifyParentRendered(){if(!this.binding||this.variableId===null)return;const e=this.variableStore.get(this.variableId);e!=null&&e.parentId&&this.binding.addScrollNotification(e.parentId)}scrollToBottom(){if(!this.binding)return;const e=this.binding.getWidget(this.elementId);e!=null&&e.scrollOnOutput&&e.scrollToBottom()}setExemplar(e){this.exemplarHtml=e.outerHTML}setPathConfig(e){this.pathConfig=ue(e),(this.pathConfig.props.scrollOnOutput==="true"||this.pathConfig.props.scrollOnOutput==="")&&(this._scrollOnOutput=!0,delete this.pathConfig.props.scrollOnOutput)}getVariableProperties(){if(!this.pathConfig)return{};const e={...this.pathConfig.props};return this.pathConfig.item&&(e.item=this.pathConfig.item),e}getBasePath(){var e;return((e=this.pathConfig)==null?void 0:e.path)||""}resolveNamespace(e,t){const s=e.closest("[ui-namespace]"),i=this.getElement();return s&&(i!=null&&i.contains(s))?s.getAttribute("ui-namespace")||void 0:t.properties.namespace}setVariable(e){this.unwatch&&(this.unwatch(),this.unwatch=null),this.variableId=e,this.registerWidget(),this.unwatch=this.variableStore.watch(e,()=>{this.update()}),this.update()}update(){if(this.variableId===null)return;const e=this.variableStore.get(this.variableId);if(!e)return;const t=e.value;if(!Array.isArray(t)){this.clear();return}for(;this.itemViews.length<t.length;){const s=this.itemViews.length,i=this.createItemView();this.itemViews.push(i),this.createItemVariable(i,s,e)}for(;this.itemViews.length>t.length;)this.itemViews.pop().destroy();this.scrollToBottom(),this.notifyParentRendered()}createItemVariable(e,t,s){const i=s.parentId?this.variableStore.get(s.parentId):void 0,r={path:this.itemWrapper?`${t}?wrapper=${this.itemWrapper}`:String(t),elementId:e.elementId};i!=null&&i.properties.itemWrapper&&(r.wrapper=i.properties.itemWrapper);const l=e.getElement();if(l){const c=this.resolveNamespace(l,s);c&&(r.namespace=c)}s.properties.fallbackNamespace&&(r.fallbackNamespace=s.properties.fallbackNamespace);const h=this.variableStore.create({parentId:this.variableId,properties:r});e.setVariable(h)}createItemView(){var s;const e=document.createElement("template");e.innerHTML=this.exemplarHtml;const t=e.content.firstElementChild;return(s=this.getElement())==null||s.appendChild(t),new x(t,this.viewdefStore,this.variableStore,this.binding)}clear(){const e=this.getElement();e&&e.replaceChildren();for(const t of this.itemViews)t.destroy();this.itemViews=[]}getCount(){return this.itemViews.length}getViewElement(e){var t;return((t=this.itemViews[e])==null?void 0:t.getElement())??null}getViewIds(){return this.itemViews.map(e=>e.elementId)}destroy(){this.unwatch&&(this.unwatch(),this.unwatch=null),this.clear(),this.variableId!==null&&(this.variableStore.destroy(this.variableId),this.variableId=null)}}function pe(o,e,t,s){const i=new fe(o,e,t,s),n=o.getAttribute("ui-viewlist");return n&&i.setPathConfig(n),i}function ge(o,e,t){const s=o.closest("[ui-namespace]"),i=t.get(e),n=i==null?void 0:i.properties.namespace,r=i==null?void 0:i.properties.elementId,l=r?document.getElementById(r):null;if(s&&l&&n)return l.contains(s)?s.getAttribute("ui-namespace")||void 0:n;if(s)return s.getAttribute("ui-namespace")||void 0;if(n)return n}function me(o,e,t,s){const i=o.getAttribute("ui-namespace");if(i)t.namespace=i;else{const r=ge(o,e,s);r&&(t.namespace=r)}const n=s.get(e);!t.fallbackNamespace&&(n!=null&&n.properties.fallbackNamespace)&&(t.fallbackNamespace=n.properties.fallbackNamespace),t.access||(t.access="r")}const we=`
+.ui-new-view {
+  display: none !important;
+}
+`;(function(){if(document.getElementById("ui-no-flash-style"))return;const e=document.createElement("style");e.id="ui-no-flash-style",e.textContent=we,document.head.appendChild(e)})();const ve=new Set(["ui-new-view","ui-obsolete-view"]),be="ui-view-";let ye=1;class x{constructor(e,t,s,i){a(this,"elementId");a(this,"viewClass");a(this,"bufferTimeoutId");a(this,"valueType","");a(this,"variableId",null);a(this,"rendered",!1);a(this,"viewdefStore");a(this,"variableStore");a(this,"unwatch",null);a(this,"binding");a(this,"viewLists",[]);a(this,"childViews",[]);a(this,"_scrollOnOutput",!1);a(this,"viewUnbindHandlers",[]);a(this,"originalClass",null);a(this,"originalStyle",null);this.elementId=M(e),this.viewClass=`ui-view-${ye++}`;const n=e.getAttribute("class");this.originalClass=n&&n.split(/\s+/).filter(r=>r&&!r.startsWith(be)&&!ve.has(r)).join(" ")||null,this.originalStyle=e.getAttribute("style"),this.viewdefStore=t,this.variableStore=s,this.binding=i}getElement(){return document.getElementById(this.elementId)}getElements(){var t;const e=(t=document.getElementById(this.elementId))==null?void 0:t.parentElement;return e?[...e.querySelectorAll(`:scope > .${this.viewClass}`)]:[]}setScrollOnOutput(e){this._scrollOnOutput=e}notifyParentRendered(){if(!this.binding||this.variableId===null)return;const e=this.variableStore.get(this.variableId);e!=null&&e.parentId&&this.binding.addScrollNotification(e.parentId)}getNamespace(){if(this.variableId===null)return;const e=this.variableStore.get(this.variableId);return e==null?void 0:e.properties.namespace}getFallbackNamespace(){if(this.variableId===null)return;const e=this.variableStore.get(this.variableId);return e==null?void 0:e.properties.fallbackNamespace}setVariable(e,t){this.unwatch&&(this.unwatch(),this.unwatch=null),this.variableId=e,this.rendered=!1,this.unwatch=this.variableStore.watch(e,(s,i,n)=>{this.render()},t),this.render()}getViewdefKey(){if(this.variableId===null)return;const e=this.variableStore.get(this.variableId);if(!e)return;const t=e.properties.type;if(!t)return;const s=this.getNamespace(),i=this.getFallbackNamespace(),n=this.viewdefStore.get(t,s,i);return n==null?void 0:n.key}render(){var V;if(this.variableId===null)return!1;const e=this.variableStore.get(this.variableId);if(!e)return this.markPending(),!1;const t=e.properties.type;if(!t){if(this.rendered){const d=this.getElements(),O=document.createDocumentFragment(),H=d.length>0?d[0].parentNode:null,A=d.length>0?d[d.length-1].nextSibling:null;for(const m of d)O.appendChild(m);if(this.clearChildren(),this.binding)for(const m of Array.from(O.children))this.binding.unbindElement(m);if(H){const m=document.createElement("div");m.id=this.elementId,m.classList.add(this.viewClass),H.insertBefore(m,A)}this.rendered=!1,this.valueType="",this.variableStore.update(this.variableId,void 0,{viewdef:""})}return this.markPending(),!1}const s=this.getNamespace(),i=this.getFallbackNamespace(),n=this.viewdefStore.get(t,s,i);if(!n)return this.markPending(),!1;if(this.rendered&&t===this.valueType)return!1;const r=this.getElement();if(!r)return console.error("View element not found:",this.elementId),!1;const l=r.parentNode;if(!l)return console.error("View element has no parent:",this.elementId),!1;const h=l.closest(".ui-new-view")!==null;let c=this.getElements();c.length===0&&(c=[r]);const u=c[c.length-1].nextSibling;let p=[];if(this.binding){const d=this.binding.getWidget(this.elementId);if(d){const O=d.views.indexOf(this);O>=0&&(p=d.views.slice(O+1),d.views.length=O+1)}}const y=document.createDocumentFragment();for(const d of c)y.appendChild(d);if(this.clearChildren(),!h){for(const d of c)d.removeAttribute("id"),d.classList.add(this.viewClass,"ui-obsolete-view");l.insertBefore(y,u)}const g=ce(n),f=le(g),I=Array.from(g.children);if(I.length===0)return console.error("Viewdef has no root elements:",n.key),!1;I[0].id=this.elementId;for(let d=1;d<I.length;d++)I[d].id=F();const S=I.find(d=>d.tagName!=="SCRIPT"&&d.tagName!=="STYLE");if(S){if(this.originalClass)for(const d of this.originalClass.split(/\s+/))d&&S.classList.add(d);if(this.originalStyle){const d=S.getAttribute("style")||"",O=d?`${d}; ${this.originalStyle}`:this.originalStyle;S.setAttribute("style",O)}}for(const d of I)d.classList.add(this.viewClass),h||d.classList.add("ui-new-view");I[0].setAttribute("ui-viewdef",n.key),l.insertBefore(g,u);for(const d of I)this.processViewLists(d,this.variableId),this.processChildViews(d,this.variableId);if(this.binding)for(const d of I)this.binding.bindElement(d,this.variableId);for(const d of p)(V=d.onWidgetUnbind)==null||V.call(d);if(this.rendered=!0,this.valueType=t,this.variableStore.update(this.variableId,void 0,{viewdef:n.key}),this.binding&&this.binding.setViewForElement(this.elementId,this),this.removePending(),this._scrollOnOutput&&this.binding){const d=this.binding.getWidget(this.elementId);d&&this._scrollOnOutput&&(d.scrollOnOutput=!0)}return!h&&!this.bufferTimeoutId&&(this.bufferTimeoutId=window.setTimeout(()=>{if(document.querySelectorAll(`.${this.viewClass}.ui-obsolete-view`).forEach(d=>d.remove()),document.querySelectorAll(`.${this.viewClass}.ui-new-view`).forEach(d=>{d.classList.remove("ui-new-view")}),de(f),this._scrollOnOutput&&this.binding){const d=this.binding.getWidget(this.elementId);d!=null&&d.scrollOnOutput&&d.scrollToBottom()}this.notifyParentRendered(),this.bufferTimeoutId=void 0},100)),!0}processViewLists(e,t){this.processAttributeElements(e,"ui-viewlist",s=>{this.setupViewList(s,t)})}processAttributeElements(e,t,s){if(e instanceof HTMLElement&&e.hasAttribute(t)){s(e);return}for(const i of e.querySelectorAll(`[${t}]`))i instanceof HTMLElement&&s(i)}buildNamespaceProperties(e,t,s){me(e,t,s,this.variableStore)}setupViewList(e,t){const s=pe(e,this.viewdefStore,this.variableStore,this.binding);if(e.getAttribute("ui-viewlist")){const n=s.getBasePath(),r=M(e),l={path:n,elementId:r,...s.getVariableProperties()};this.buildNamespaceProperties(e,t,l);const h=this.variableStore.create({parentId:t,properties:l});s.setVariable(h)}this.viewLists.push(s)}processChildViews(e,t){this.processAttributeElements(e,"ui-view",s=>{this.setupChildView(s,t)})}setupChildView(e,t){const s=new x(e,this.viewdefStore,this.variableStore,this.binding),i=e.getAttribute("ui-view");if(i){const n=L(i),r=n.options.props??{};delete n.options.props,r.scrollOnOutput==="true"&&s.setScrollOnOutput(!0),delete r.scrollOnOutput;const l=M(e),h={path:n.path,elementId:l,...n.options,...r};this.buildNamespaceProperties(e,t,h);const c=this.variableStore.create({parentId:t,properties:h});s.setVariable(c)}this.childViews.push(s)}clearChildren(){for(const e of this.viewLists)e.destroy();this.viewLists=[];for(const e of this.childViews)e.destroy();this.childViews=[]}clear(){this.clearChildren();const e=this.getElements();for(const t of e)t.remove();this.rendered=!1}markPending(){this.viewdefStore.addPendingView({id:this.elementId,render:()=>this.render()})}removePending(){this.viewdefStore.removePendingView(this.elementId)}isRendered(){return this.rendered}forceRender(){this.rendered=!1,this.valueType="",this.render()}onWidgetUnbind(){for(const e of this.viewUnbindHandlers)e();this.viewUnbindHandlers=[]}getVariableId(){return this.variableId}destroy(){this.unwatch&&(this.unwatch(),this.unwatch=null),this.bufferTimeoutId&&(clearTimeout(this.bufferTimeoutId),this.bufferTimeoutId=void 0),this.removePending(),this.clear(),this.variableId!==null&&(this.variableStore.destroy(this.variableId),this.variableId=null)}}const Ie=1;class Se{constructor(e,t,s,i){a(this,"elementId");a(this,"variableId",Ie);a(this,"namespace");a(this,"view",null);a(this,"viewdefStore");a(this,"variableStore");a(this,"unwatch",null);a(this,"binding");this.elementId=M(e),this.namespace=e.getAttribute("ui-namespace")||"DEFAULT",this.viewdefStore=t,this.variableStore=s,this.binding=i}getElement(){return document.getElementById(this.elementId)}initialize(){const e=this.getElement();if(!e){console.error("AppView element not found:",this.elementId);return}this.view=new x(e,this.viewdefStore,this.variableStore,this.binding),this.view.setVariable(this.variableId,!0),this.unwatch=this.variableStore.watch(this.variableId,(t,s,i)=>{this.handleRootUpdate(s,i??{})},!1)}handleRootUpdate(e,t){console.log("handleRootUpdate called, props:",Object.keys(t));const s=t.viewdefs;if(s){console.log("Found viewdefs property, length:",s.length);try{const i=JSON.parse(s);typeof i=="object"&&i!==null&&(console.log("Parsed viewdefs, keys:",Object.keys(i)),this.viewdefStore.processViewdefs(i))}catch(i){console.error("Failed to parse viewdefs property:",i)}}else console.log("No viewdefs property found")}getView(){return this.view}isRendered(){var e;return((e=this.view)==null?void 0:e.isRendered())??!1}destroy(){this.unwatch&&(this.unwatch(),this.unwatch=null),this.view&&(this.view.destroy(),this.view=null)}}function $(){return document.querySelector("[ui-app]")}function Ee(o,e,t){const s=$();if(!s)return null;const i=new Se(s,o,e,t);return i.initialize(),i}function Oe(o){o=o.replace(/^\//,"");const e=o.indexOf("/");return e===-1?{sessionId:o,path:"/"}:{sessionId:o.substring(0,e),path:"/"+o.substring(e+1)}}function Ve(){const o=document.cookie.match(/(?:^|; )ui-session=([^;]*)/);return o?o[1]:""}function Ae(){const o=Ve();if(o)return o;const{sessionId:e}=Oe(window.location.pathname);if(!e)throw new Error("No session ID in URL or cookie");return e}class Le{constructor(){a(this,"connection");a(this,"store");a(this,"viewdefStore");a(this,"binding");a(this,"sessionId");a(this,"appView",null);this.sessionId=this.extractSessionId(),this.connection=new X(this.sessionId),this.store=new Q(this.connection),this.viewdefStore=new he,this.binding=new D(this.store),this.viewdefStore.setViewLookup(e=>this.binding.getView(e))}extractSessionId(){return Ae()}async initialize(){this.connection.onConnect(()=>{console.log("Connected to session:",this.sessionId)}),this.connection.onDisconnect(()=>{console.log("Disconnected from session")}),this.connection.onError(t=>{console.error("Connection error:",t)}),this.connection.onMessage(t=>{this.handleMessage(t)}),await this.connection.connect(),$()&&(this.appView=Ee(this.viewdefStore,this.store,this.binding))}handleMessage(e){switch(e.type){case"error":const t=e.data;console.error("Server error:",t.description);break}}navigateTo(e){window.history.pushState({},"",e),this.handleNavigation()}handleNavigation(){const s="/"+window.location.pathname.split("/").filter(Boolean).slice(1).join("/");this.store.update(1,void 0,{url:s})}getStore(){return this.store}getViewdefStore(){return this.viewdefStore}getConnection(){return this.connection}getAppView(){return this.appView}getBinding(){return this.binding}updateValue(e,t){const s=this.binding.getWidget(e);if(!s)return;const i=s.getVariableId("ui-value");if(i!==void 0){if(t===void 0){const n=document.getElementById(e);t=n==null?void 0:n.value}this.store.update(i,t)}}}function Te(){const o=new Le;return o.initialize().then(()=>o)}document.addEventListener("DOMContentLoaded",()=>{$()&&Te().then(e=>{window.uiApp=e,window.uiStore=e.getStore()}).catch(console.error)});
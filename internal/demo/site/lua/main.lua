@@ -0,0 +1,22 @@
+-- Counter demo, served when ui-engine has no bundle and no --dir.
+-- It exercises a watched value, action buttons, and a ViewList.
+
+Count = session:prototype("Count", {n = 0, value = 0})
+
+Counter = session:prototype("Counter", {count = 0, history = EMPTY})
+
+function Counter:increment()
+    self.count = self.count + 1
+end
+
+-- record adds the current count to the history list
+function Counter:record()
+    table.insert(self.history, session:create(Count, {n = #self.history + 1, value = self.count}))
+end
+
+function Counter:reset()
+    self.count = 0
+    self.history = {}
+end
+
+session:createAppVariable(session:create(Counter, {history = {}}))
@@ -0,0 +1,76 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md
+package lua
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// APISignature describes a function the runtime installs on the ui or session table.
+// Arities exclude the receiver for session methods.
+type APISignature struct {
+	Table   string // "ui" or "session"
+	Name    string
+	MinArgs int
+	MaxArgs int
+}
+
+// apiSignatures is the single list of runtime-provided ui and session functions.
+// Registration goes through setAPI, which refuses names missing here, and the
+// bundle-time linter checks calls against it, so the two cannot drift.
+var apiSignatures = []APISignature{
+	{"session", "createAppVariable", 1, 2},
+	{"session", "createRoot", 2, 3},
+	{"session", "getApp", 0, 0},
+	{"session", "createVariable", 2, 3},
+	{"session", "destroyVariable", 1, 1},
+	{"session", "newVersion", 0, 0},
+	{"session", "getVersion", 0, 0},
+	{"session", "needsMutation", 1, 1},
+	{"session", "prototype", 1, 3},
+	{"session", "create", 1, 2},
+	{"session", "removePrototype", 1, 2},
+	{"session", "unloadModule", 1, 1},
+	{"session", "unloadDirectory", 1, 1},
+	{"session", "setImmediate", 1, 1},
+	{"session", "setTimeout", 2, 2},
+	{"session", "setInterval", 2, 2},
+	{"session", "clearImmediate", 1, 1},
+	{"session", "clearTimeout", 1, 1},
+	{"session", "clearInterval", 1, 1},
+	{"session", "flag", 1, 2},
+	{"session", "present", 2, 2},
+	{"session", "computed", 4, 4},
+	{"session", "focus", 1, 1},
+	{"session", "shortcut", 1, 3},
+	{"ui", "registerPresenter", 2, 2},
+	{"ui", "log", 1, 2},
+	{"ui", "json_encode", 1, 1},
+	{"ui", "json_decode", 1, 1},
+	{"ui", "registerWrapper", 2, 2},
+	{"ui", "groupBroadcast", 2, 3},
+	{"ui", "priority", 1, 1},
+	{"ui", "timer", 2, 2},
+	{"ui", "interval", 2, 2},
+	{"ui", "asset", 1, 1},
+}
+
+// lookupAPI finds the signature of table.name.
+func lookupAPI(table, name string) (APISignature, bool) {
+	for _, sig := range apiSignatures {
+		if sig.Table == table && sig.Name == name {
+			return sig, true
+		}
+	}
+	return APISignature{}, false
+}
+
+// setAPI installs a runtime function listed in apiSignatures.
+func (r *LuaSession) setAPI(tbl *lua.LTable, table, name string, fn lua.LValue) {
+	if _, ok := lookupAPI(table, name); !ok {
+		panic(fmt.Sprintf("%s.%s is not in apiSignatures", table, name))
+	}
+	r.State.SetField(tbl, name, fn)
+}
@@ -0,0 +1,31 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Asset Fingerprinting)
+package lua
+
+import (
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+// addAssetAPI adds ui.asset(name), which returns the fingerprinted name of an
+// html/ asset ("/app.js" -> "/app.ab12cd34.js"), or name when the bundle did
+// not rename it.
+func (r *LuaSession) addAssetAPI(uiMod *lua.LTable) {
+	r.setAPI(uiMod, "ui", "asset", r.State.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(1)
+		manifest, err := bundle.AssetManifest()
+		if err != nil {
+			r.Log(1, "ui.asset: %v", err)
+		}
+		if hashed, ok := manifest[strings.TrimPrefix(name, "/")]; ok {
+			if strings.HasPrefix(name, "/") {
+				hashed = "/" + hashed
+			}
+			name = hashed
+		}
+		L.Push(lua.LString(name))
+		return 1
+	}))
+}
@@ -0,0 +1,145 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Computed Values)
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+)
+
+// computedValue is a value session:computed keeps on its parent's table,
+// recomputed only when one of its dependencies changes.
+type computedValue struct {
+	varID    int64
+	parentID int64
+	path     string
+	deps     [][]string // Dependency paths, split on "."
+	fn       *lua.LFunction
+	inputs   []string // Value JSON of each dependency at the last computation
+}
+
+// addComputedMethods adds session:computed(parent, path, deps, fn).
+func (r *LuaSession) addComputedMethods(session *lua.LTable, vendedID string) {
+	r.setAPI(session, "session", "computed", r.State.NewFunction(func(L *lua.LState) int {
+		parentID, err := r.parentVariableID(vendedID, L.Get(2))
+		if err != nil {
+			L.RaiseError("computed: %s", err.Error())
+			return 0
+		}
+		path := L.CheckString(3)
+		depsTable := L.CheckTable(4)
+		fn := L.CheckFunction(5)
+		c := &computedValue{parentID: parentID, path: path, fn: fn}
+		for i := 1; i <= depsTable.Len(); i++ {
+			dep := lua.LVAsString(depsTable.RawGetInt(i))
+			if dep == "" {
+				L.RaiseError("computed: dependency %d must be a field path", i)
+				return 0
+			}
+			c.deps = append(c.deps, strings.Split(dep, "."))
+		}
+		id, err := r.variableStore.CreateVariable(vendedID, parentID, nil, map[string]string{"path": path, "access": "r"})
+		if err != nil {
+			L.RaiseError("computed: %s", err.Error())
+			return 0
+		}
+		c.varID = id
+		if r.computed == nil {
+			r.computed = make(map[int64]*computedValue)
+		}
+		r.computed[id] = c
+		r.updateComputed(r.variableStore.GetTracker(vendedID), c)
+		L.Push(lua.LNumber(id))
+		return 1
+	}))
+}
+
+// parentVariableID returns the variable ID a Lua API was given: a number, or
+// the table of a root variable.
+func (r *LuaSession) parentVariableID(vendedID string, arg lua.LValue) (int64, error) {
+	switch p := arg.(type) {
+	case lua.LNumber:
+		return int64(p), nil
+	case *lua.LTable:
+		if tracker := r.variableStore.GetTracker(vendedID); tracker != nil {
+			for _, v := range tracker.RootVariables() {
+				if v.Value == p {
+					return v.ID, nil
+				}
+			}
+		}
+		return 0, fmt.Errorf("parent object not found in tracker")
+	default:
+		return 0, fmt.Errorf("parentId must be a number or table")
+	}
+}
+
+// updateComputedValues recomputes the computed values whose dependencies
+// changed since they last ran. AfterBatch calls it before detecting changes,
+// so a new result goes out in the same batch as the inputs that caused it.
+func (r *LuaSession) updateComputedValues(tracker *changetracker.Tracker) {
+	for id, c := range r.computed {
+		if tracker.GetVariable(id) == nil {
+			delete(r.computed, id)
+			continue
+		}
+		r.updateComputed(tracker, c)
+	}
+}
+
+// updateComputed runs a computed value's function if its dependencies
+// changed, storing the result at its path on the parent table. Errors are
+// kept as diags on its variable, which keeps its previous value.
+func (r *LuaSession) updateComputed(tracker *changetracker.Tracker, c *computedValue) {
+	parent := tracker.GetVariable(c.parentID)
+	if parent == nil {
+		return
+	}
+	obj, ok := parent.NavigationValue().(*lua.LTable)
+	if !ok {
+		return
+	}
+	inputs := make([]string, len(c.deps))
+	for i, dep := range c.deps {
+		inputs[i] = r.dependencyJSON(tracker, obj, dep)
+	}
+	if c.inputs != nil && slices.Equal(inputs, c.inputs) {
+		return
+	}
+	c.inputs = inputs
+	L := r.State
+	if err := L.CallByParam(lua.P{Fn: c.fn, NRet: 1, Protect: true}, obj); err != nil {
+		msg := fmt.Sprintf("computed %s: %v", c.path, err)
+		r.clearVariableDiags(c.varID)
+		r.AddVariableDiag(c.varID, msg)
+		if line, ok := r.errors.note(c.varID, msg); ok {
+			r.Log(1, "%s", line)
+		}
+		return
+	}
+	result := L.Get(-1)
+	L.Pop(1)
+	r.clearVariableDiags(c.varID)
+	L.SetField(obj, c.path, result)
+}
+
+// dependencyJSON returns the Value JSON at a dependency path, or "" if the
+// path does not resolve.
+func (r *LuaSession) dependencyJSON(tracker *changetracker.Tracker, obj any, path []string) string {
+	var err error
+	for _, elem := range path {
+		if obj == nil {
+			return ""
+		}
+		if obj, err = tracker.Resolver.Get(obj, elem); err != nil {
+			return ""
+		}
+	}
+	data, _ := json.Marshal(tracker.ToValueJSON(obj))
+	return string(data)
+}
@@ -0,0 +1,189 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Conversion Limits)
+package lua
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Default limits for converting Lua tables to Go.
+const (
+	DefaultMaxConvertDepth = 64
+	DefaultMaxConvertNodes = 100000
+)
+
+var maxConvertDepth, maxConvertNodes atomic.Int64
+
+func init() {
+	SetConvertLimits(DefaultMaxConvertDepth, DefaultMaxConvertNodes)
+}
+
+// SetConvertLimits sets how deep and how many values LuaToGo converts before
+// truncating (0 = no limit).
+func SetConvertLimits(depth, nodes int) {
+	maxConvertDepth.Store(int64(depth))
+	maxConvertNodes.Store(int64(nodes))
+}
+
+// cycleMarker stands in for a table inside itself.
+func cycleMarker() map[string]any {
+	return map[string]any{"$cycle": true}
+}
+
+// cycleObject is the marker in Value JSON, where the tracker registers it as
+// an object; one shared instance keeps its reference stable across changes.
+var cycleObject = cycleMarker()
+
+// LuaToGo converts a Lua value to Go.
+// Fields prefixed with "_" are skipped (internal/private fields).
+// A table inside itself becomes {"$cycle": true}; past the conversion limits
+// values are dropped.
+func LuaToGo(val lua.LValue) interface{} {
+	v, _ := luaToGo(val)
+	return v
+}
+
+// luaToGo converts like LuaToGo and also returns why the result was
+// truncated, or "" if it is complete.
+func luaToGo(val lua.LValue) (any, string) {
+	c := &luaConverter{
+		maxDepth: int(maxConvertDepth.Load()),
+		maxNodes: int(maxConvertNodes.Load()),
+		path:     make(map[*lua.LTable]bool),
+	}
+	v := c.convert(val, 0)
+	return v, strings.Join(c.issues, "; ")
+}
+
+// luaConverter holds one conversion's state.
+type luaConverter struct {
+	maxDepth int
+	maxNodes int
+	nodes    int
+	path     map[*lua.LTable]bool // Tables being converted, to find cycles
+	issues   []string
+}
+
+func (c *luaConverter) note(format string, args ...any) {
+	if issue := fmt.Sprintf(format, args...); !slices.Contains(c.issues, issue) {
+		c.issues = append(c.issues, issue)
+	}
+}
+
+// full reports whether the node limit is used up.
+func (c *luaConverter) full() bool {
+	return c.maxNodes > 0 && c.nodes >= c.maxNodes
+}
+
+func (c *luaConverter) convert(val lua.LValue, depth int) any {
+	if c.full() {
+		c.note("value truncated at %d values", c.maxNodes)
+		return nil
+	}
+	c.nodes++
+	switch v := val.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if c.path[v] {
+			c.note("table contains itself")
+			return cycleMarker()
+		}
+		if c.maxDepth > 0 && depth >= c.maxDepth {
+			c.note("value truncated at depth %d", c.maxDepth)
+			return nil
+		}
+		c.path[v] = true
+		defer delete(c.path, v)
+		return c.convertTable(v, depth)
+	case *lua.LNilType:
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (c *luaConverter) convertTable(v *lua.LTable, depth int) any {
+	// Count numeric and string keys to determine if array or map
+	hasNumericKeys := false
+	hasStringKeys := false
+	maxN := 0
+	v.ForEach(func(key, _ lua.LValue) {
+		if n, ok := key.(lua.LNumber); ok {
+			hasNumericKeys = true
+			if int(n) > maxN {
+				maxN = int(n)
+			}
+		} else if ks, ok := key.(lua.LString); ok {
+			// Skip internal fields
+			if !strings.HasPrefix(string(ks), "_") {
+				hasStringKeys = true
+			}
+		}
+	})
+
+	// Pure array (only numeric keys)
+	if hasNumericKeys && !hasStringKeys && maxN > 0 {
+		arr := make([]interface{}, 0, min(maxN, 1024))
+		for i := 1; i <= maxN && !c.full(); i++ {
+			arr = append(arr, c.convert(v.RawGetInt(i), depth+1))
+		}
+		if len(arr) < maxN {
+			c.note("value truncated at %d values", c.maxNodes)
+		}
+		return arr
+	}
+
+	// Object (string keys, possibly mixed with numeric)
+	m := make(map[string]interface{})
+	v.ForEach(func(key, value lua.LValue) {
+		if ks, ok := key.(lua.LString); ok {
+			keyStr := string(ks)
+			// Skip internal fields (prefixed with _)
+			if !strings.HasPrefix(keyStr, "_") {
+				if c.full() {
+					c.note("value truncated at %d values", c.maxNodes)
+					return
+				}
+				m[keyStr] = c.convert(value, depth+1)
+			}
+		}
+	})
+	return m
+}
+
+// arrayCycle reports whether an array table reaches itself through array
+// elements. Value JSON arrays hold no arrays, so the tracker would otherwise
+// recurse through such a table forever. Checks at most the node limit.
+func (s *LuaSession) arrayCycle(tbl *lua.LTable) bool {
+	limit := int(maxConvertNodes.Load())
+	seen := map[*lua.LTable]bool{tbl: true}
+	work := []*lua.LTable{tbl}
+	for len(work) > 0 && (limit <= 0 || len(seen) <= limit) {
+		next := work[len(work)-1]
+		work = work[:len(work)-1]
+		for i := 1; i <= next.Len(); i++ {
+			elem, ok := next.RawGetInt(i).(*lua.LTable)
+			if !ok || !s.isArray(elem) {
+				continue
+			}
+			if elem == tbl {
+				return true
+			}
+			if !seen[elem] {
+				seen[elem] = true
+				work = append(work, elem)
+			}
+		}
+	}
+	return false
+}
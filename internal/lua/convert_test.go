@@ -0,0 +1,62 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Conversion Limits)
+package lua
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// TestLuaToGoLimits verifies self-referencing tables become a $cycle marker
+// while shared tables do not, and that long chains and wide tables are
+// truncated at the limits with the reason reported
+func TestLuaToGoLimits(t *testing.T) {
+	defer SetConvertLimits(DefaultMaxConvertDepth, DefaultMaxConvertNodes)
+	L := lua.NewState()
+	defer L.Close()
+	if err := L.DoString(`
+		node = {name = "a"}
+		node.parent = node
+		shared = {n = 1}
+		pair = {left = shared, right = shared}
+		chain = {}
+		local c = chain
+		for i = 1, 40 do c.next = {}; c = c.next end
+		wide = {}
+		for i = 1, 200 do wide[i] = i end
+	`); err != nil {
+		t.Fatal(err)
+	}
+	convert := func(name string) (string, string) {
+		v, issue := luaToGo(L.GetGlobal(name))
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return string(data), issue
+	}
+
+	if got, issue := convert("node"); got != `{"name":"a","parent":{"$cycle":true}}` || issue != "table contains itself" {
+		t.Errorf("node = %s (%q)", got, issue)
+	}
+	if got, issue := convert("pair"); got != `{"left":{"n":1},"right":{"n":1}}` || issue != "" {
+		t.Errorf("shared table = %s (%q)", got, issue)
+	}
+	if _, issue := convert("chain"); issue != "" {
+		t.Errorf("40-deep chain truncated under the default limit: %q", issue)
+	}
+
+	SetConvertLimits(10, 50)
+	if got, issue := convert("chain"); strings.Count(got, "next") != 10 || issue != "value truncated at depth 10" {
+		t.Errorf("chain = %s (%q)", got, issue)
+	}
+	got, issue := convert("wide")
+	var arr []any
+	json.Unmarshal([]byte(got), &arr)
+	if len(arr) != 49 || issue != "value truncated at 50 values" {
+		t.Errorf("wide table kept %d values (%q)", len(arr), issue)
+	}
+}
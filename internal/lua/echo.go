@@ -0,0 +1,51 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Echo Suppression)
+package lua
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// frontendEcho records a value a frontend connection sent during the current batch.
+type frontendEcho struct {
+	connectionID string
+	value        json.RawMessage
+}
+
+// recordEcho remembers that connectionID set varID to value in this batch, so
+// AfterBatch does not send the same value back to it. The last update wins.
+func (r *LuaSession) recordEcho(connectionID string, varID int64, value json.RawMessage) {
+	if connectionID == "" {
+		return
+	}
+	if r.echoes == nil {
+		r.echoes = make(map[int64]frontendEcho)
+	}
+	r.echoes[varID] = frontendEcho{connectionID: connectionID, value: value}
+}
+
+// echoOrigin returns the connection an update would only echo back to: the one
+// that sent this variable's value in the batch, when the backend kept the value
+// unchanged. Returns "" when the value was transformed, so the echo is sent.
+func echoOrigin(echoes map[int64]frontendEcho, varID int64, value json.RawMessage) string {
+	echo, ok := echoes[varID]
+	if !ok || value == nil {
+		return ""
+	}
+	sent, sentErr := canonicalJSON(echo.value)
+	kept, keptErr := canonicalJSON(value)
+	if sentErr != nil || keptErr != nil || !bytes.Equal(sent, kept) {
+		return ""
+	}
+	return echo.connectionID
+}
+
+// canonicalJSON re-encodes JSON so equal values compare equal byte for byte.
+func canonicalJSON(data json.RawMessage) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
@@ -0,0 +1,104 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md
+package lua
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	changetracker "github.com/zot/change-tracker"
+)
+
+// largeValueSize is the estimated encoded size above which a value is encoded off the executor.
+var largeValueSize = 256 << 10
+
+// maxPooledBuffer keeps unusually large buffers out of the pool so one huge value
+// does not pin its memory for the life of the process.
+const maxPooledBuffer = 64 << 20
+
+var encodeBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// PendingValue is a large value being encoded on a worker goroutine.
+type PendingValue struct {
+	done  chan struct{}
+	value json.RawMessage
+	err   error
+}
+
+// Wait blocks until the value is encoded.
+func (p *PendingValue) Wait() (json.RawMessage, error) {
+	<-p.done
+	return p.value, p.err
+}
+
+// encodeValue serializes a changed variable value. The value is first snapshotted into
+// Go structures, which must happen on the executor because it reads Lua state. Small
+// snapshots are encoded inline; large ones are encoded on a worker goroutine so a big
+// table does not stall the executor, and are returned as a PendingValue.
+func encodeValue(tracker *changetracker.Tracker, val any) (json.RawMessage, *PendingValue, error) {
+	snapshot := tracker.ToValueJSON(val)
+	if !exceedsSize(snapshot, largeValueSize) {
+		data, err := json.Marshal(snapshot)
+		return data, nil, err
+	}
+	p := &PendingValue{done: make(chan struct{})}
+	go func() {
+		defer close(p.done)
+		p.value, p.err = encodePooled(snapshot)
+	}()
+	return nil, p, nil
+}
+
+// encodePooled encodes v into a pooled buffer and returns an exact-size copy.
+func encodePooled(v any) (json.RawMessage, error) {
+	buf := encodeBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer func() {
+		if buf.Cap() <= maxPooledBuffer {
+			encodeBuffers.Put(buf)
+		}
+	}()
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(bytes.TrimSuffix(buf.Bytes(), []byte("\n"))), nil
+}
+
+// exceedsSize estimates the encoded size of a Value JSON snapshot, stopping as soon as
+// it passes limit so the estimate itself stays cheap for very large values.
+func exceedsSize(v any, limit int) bool {
+	return valueSize(v, limit) > limit
+}
+
+// valueSize estimates the encoded size of a Value JSON snapshot, stopping once
+// it passes limit.
+func valueSize(v any, limit int) int {
+	size := 0
+	var walk func(v any) bool
+	walk = func(v any) bool {
+		switch x := v.(type) {
+		case string:
+			size += len(x) + 2
+		case []any:
+			size += len(x) + 2
+			for _, elem := range x {
+				if walk(elem) {
+					return true
+				}
+			}
+		case map[string]any:
+			for k, elem := range x {
+				size += len(k) + 4
+				if walk(elem) {
+					return true
+				}
+			}
+		default:
+			size += 8
+		}
+		return size > limit
+	}
+	walk(v)
+	return size
+}
@@ -0,0 +1,73 @@
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+)
+
+// largeDataset returns an imported-dataset-sized array of strings
+func largeDataset(n int) []any {
+	rows := make([]any, n)
+	for i := range rows {
+		rows[i] = fmt.Sprintf("row %d: the quick brown fox jumps over the lazy dog", i)
+	}
+	return rows
+}
+
+// TestEncodeValueOffloadsLargeValues verifies large values encode off the caller with identical output
+func TestEncodeValueOffloadsLargeValues(t *testing.T) {
+	tracker := changetracker.NewTracker()
+
+	small, pending, err := encodeValue(tracker, []any{"a", float64(1)})
+	if err != nil || pending != nil || string(small) != `["a",1]` {
+		t.Fatalf("small value = %s, pending %v, err %v", small, pending, err)
+	}
+
+	rows := largeDataset(20000)
+	value, pending, err := encodeValue(tracker, rows)
+	if err != nil || value != nil || pending == nil {
+		t.Fatalf("large value should be pending, got %d bytes, err %v", len(value), err)
+	}
+	got, err := pending.Wait()
+	want, _ := json.Marshal(rows)
+	if err != nil || string(got) != string(want) {
+		t.Errorf("pending encoding differs from json.Marshal (%d vs %d bytes, err %v)", len(got), len(want), err)
+	}
+
+	if exceedsSize("short", 100) || !exceedsSize(rows, 100) {
+		t.Error("size estimate is wrong")
+	}
+}
+
+// BenchmarkEncodeLargeValueStall measures how long AfterBatch's encoding occupies the
+// executor for a large value: "inline" is the previous behavior, "offloaded" the current one.
+func BenchmarkEncodeLargeValueStall(b *testing.B) {
+	tracker := changetracker.NewTracker()
+	rows := largeDataset(200000)
+	for _, bench := range []struct {
+		name      string
+		threshold int
+	}{
+		{"inline", math.MaxInt},
+		{"offloaded", 256 << 10},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			saved := largeValueSize
+			largeValueSize = bench.threshold
+			defer func() { largeValueSize = saved }()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_, pending, _ := encodeValue(tracker, rows)
+				if pending != nil {
+					b.StopTimer()
+					pending.Wait()
+					b.StartTimer()
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+// Package lua provides session-scoped feature flags.
+// CRC: crc-LuaSession.md
+// Spec: libraries.md
+package lua
+
+import (
+	"encoding/json"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Flags returns a copy of the session's effective feature flags.
+func (r *LuaSession) Flags() map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	result := make(map[string]any, len(r.flags))
+	for k, v := range r.flags {
+		result[k] = v
+	}
+	return result
+}
+
+// SetFlags replaces the session's feature flags.
+// When the session is running, this refreshes session.flags and the meta root's
+// flags property so the change reaches the frontend through the normal update path.
+// Must run on the session executor once the session is created.
+func (r *LuaSession) SetFlags(flags map[string]any) {
+	r.mu.Lock()
+	r.flags = flags
+	r.mu.Unlock()
+
+	if r.sessionTable != nil {
+		r.installFlags(r.sessionTable)
+	}
+	if r.variableStore == nil || r.ID == "" {
+		return
+	}
+	if tracker := r.variableStore.GetTracker(r.ID); tracker != nil {
+		if meta := tracker.GetVariable(r.metaRootID()); meta != nil {
+			meta.SetProperty("flags", r.flagsJSON())
+		}
+	}
+}
+
+// flagsJSON returns the flags encoded for the meta root's flags property.
+// Returns "" when there are no flags.
+func (r *LuaSession) flagsJSON() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.flags) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(r.flags)
+	if err != nil {
+		r.Log(0, "Warning: failed to marshal session flags: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// installFlags sets session.flags to a read-only view of the current flags.
+func (r *LuaSession) installFlags(session *lua.LTable) {
+	L := r.State
+	data := L.NewTable()
+	for k, v := range r.Flags() {
+		L.SetField(data, k, r.GoToLua(v))
+	}
+	proxy := L.NewTable()
+	mt := L.NewTable()
+	L.SetField(mt, "__index", data)
+	L.SetField(mt, "__newindex", L.NewFunction(func(L *lua.LState) int {
+		L.RaiseError("session.flags is read-only")
+		return 0
+	}))
+	L.SetField(mt, "__metatable", lua.LFalse)
+	L.SetMetatable(proxy, mt)
+	L.SetField(session, "flags", proxy)
+}
+
+// addFlagMethods adds session:flag(name, default) to the session table.
+func (r *LuaSession) addFlagMethods(session *lua.LTable) {
+	r.installFlags(session)
+
+	// flag(name, default) - returns the flag value, or default when unset
+	r.setAPI(session, "session", "flag", r.State.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(2)
+		def := L.Get(3)
+		r.mu.RLock()
+		val, ok := r.flags[name]
+		r.mu.RUnlock()
+		if !ok || val == nil {
+			L.Push(def)
+			return 1
+		}
+		L.Push(r.GoToLua(val))
+		return 1
+	}))
+}
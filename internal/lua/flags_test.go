@@ -0,0 +1,49 @@
+package lua
+
+import (
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestSessionFlags verifies session.flags and session:flag(name, default)
+func TestSessionFlags(t *testing.T) {
+	rt, err := NewRuntime(config.DefaultConfig(), "/tmp", nil)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	defer rt.Shutdown()
+
+	rt.SetVariableStore(newMockStore())
+	rt.SetFlags(map[string]any{"newNav": true, "limit": float64(5)})
+
+	if _, err := rt.CreateLuaSession("1"); err != nil {
+		t.Fatalf("Failed to create Lua session: %v", err)
+	}
+
+	_, err = rt.execute(func() (interface{}, error) {
+		return nil, rt.State.DoString(`
+			assert(session.flags.newNav == true, "expected newNav flag")
+			assert(session:flag("limit", 1) == 5, "expected limit 5")
+			assert(session:flag("missing", "dflt") == "dflt", "expected default")
+			assert(session:flag("missing") == nil, "expected nil without default")
+			local ok = pcall(function() session.flags.newNav = false end)
+			assert(not ok, "session.flags should be read-only")
+		`)
+	})
+	if err != nil {
+		t.Fatalf("Lua execution error: %v", err)
+	}
+
+	// Runtime changes replace the visible flags
+	_, err = rt.execute(func() (interface{}, error) {
+		rt.SetFlags(map[string]any{"limit": float64(9)})
+		return nil, rt.State.DoString(`
+			assert(session.flags.newNav == nil, "newNav should be gone")
+			assert(session:flag("limit", 1) == 9, "expected limit 9")
+		`)
+	})
+	if err != nil {
+		t.Fatalf("Lua execution error after SetFlags: %v", err)
+	}
+}
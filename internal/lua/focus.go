@@ -0,0 +1,227 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Focus and Shortcuts)
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// Variable 1 properties the stock frontend acts on.
+const (
+	FocusProperty     = "focus"     // Path of the element to focus, cleared once sent
+	ShortcutsProperty = "shortcuts" // JSON map of key combo to Shortcut
+)
+
+// Shortcut is the action a key combo runs: the frontend creates an action
+// variable for Path under variable Var and updates it, as ui-action does.
+type Shortcut struct {
+	Var  int64  `json:"var"`
+	Path string `json:"path"` // Method call path, e.g. "editor.save()"
+}
+
+var (
+	identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	shortcutModifiers = map[string]bool{"ctrl": true, "shift": true, "alt": true, "meta": true}
+)
+
+// addFocusMethods adds session:focus(path) and session:shortcut(combo, target,
+// method) to the session table.
+func (r *LuaSession) addFocusMethods(session *lua.LTable, vendedID string) {
+	// focus(path) - focus the element bound to path (relative to the app) once
+	r.setAPI(session, "session", "focus", r.State.NewFunction(func(L *lua.LState) int {
+		path := L.CheckString(2)
+		v1, err := r.appVariable(vendedID)
+		if err == nil && !validFocusPath(path) {
+			err = fmt.Errorf("invalid path %q", path)
+		}
+		if err != nil {
+			L.RaiseError("focus: %s", err.Error())
+			return 0
+		}
+		v1.SetProperty(FocusProperty, path)
+		r.MarkDirty()
+		return 0
+	}))
+
+	// shortcut(combo, target, method) - run target's method on a key combo;
+	// without a target the combo's shortcut is removed
+	r.setAPI(session, "session", "shortcut", r.State.NewFunction(func(L *lua.LState) int {
+		combo, err := normalizeCombo(L.CheckString(2))
+		var shortcut Shortcut
+		if err == nil && L.Get(3) != lua.LNil {
+			shortcut, err = r.resolveShortcut(vendedID, L.Get(3), L.CheckString(4))
+		}
+		var v1 *changetracker.Variable
+		if err == nil {
+			v1, err = r.appVariable(vendedID)
+		}
+		if err != nil {
+			L.RaiseError("shortcut: %s", err.Error())
+			return 0
+		}
+		if L.Get(3) == lua.LNil {
+			delete(r.shortcuts, combo)
+		} else {
+			if r.shortcuts == nil {
+				r.shortcuts = make(map[string]Shortcut)
+			}
+			r.shortcuts[combo] = shortcut
+		}
+		v1.SetProperty(ShortcutsProperty, r.shortcutsJSON())
+		r.MarkDirty()
+		return 0
+	}))
+}
+
+// appVariable returns variable 1, which carries the focus and shortcuts.
+func (r *LuaSession) appVariable(vendedID string) (*changetracker.Variable, error) {
+	if tracker := r.variableStore.GetTracker(vendedID); tracker != nil {
+		if v1 := tracker.GetVariable(1); v1 != nil {
+			return v1, nil
+		}
+	}
+	return nil, fmt.Errorf("no app variable; call session:createAppVariable first")
+}
+
+// validFocusPath reports whether path is a dotted field path, optionally
+// ending in a method call, as bindings use.
+func validFocusPath(path string) bool {
+	for _, field := range strings.Split(path, ".") {
+		if !identifierPattern.MatchString(strings.TrimSuffix(field, "()")) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkFrontendShortcuts refuses a frontend update that sets variable 1's
+// shortcuts: only session:shortcut declares them, after checking each target.
+func checkFrontendShortcuts(varID int64, properties map[string]string) error {
+	if varID != 1 {
+		return nil
+	}
+	for name := range properties {
+		if base, _ := protocol.ParsePrioritySuffix(name); base == ShortcutsProperty {
+			return fmt.Errorf("%s can only be set with session:shortcut", ShortcutsProperty)
+		}
+	}
+	return nil
+}
+
+// normalizeCombo checks a key combo in ui-event-keypress form (modifiers,
+// then one key: "ctrl-shift-s") and lowercases it.
+func normalizeCombo(combo string) (string, error) {
+	combo = strings.ToLower(combo)
+	parts := strings.Split(combo, "-")
+	seen := make(map[string]bool, len(parts))
+	for i, part := range parts {
+		switch {
+		case part == "":
+			return "", fmt.Errorf("invalid key combo %q", combo)
+		case i == len(parts)-1:
+			if shortcutModifiers[part] {
+				return "", fmt.Errorf("key combo %q has no key", combo)
+			}
+		case !shortcutModifiers[part] || seen[part]:
+			return "", fmt.Errorf("invalid modifier %q in key combo %q", part, combo)
+		}
+		seen[part] = true
+	}
+	return combo, nil
+}
+
+// resolveShortcut checks that method is a function of target, a path from the
+// app or a root variable (by ID or object), and returns the action to run.
+// Only a target's methods can be actions, so nothing else is reachable.
+func (r *LuaSession) resolveShortcut(vendedID string, target lua.LValue, method string) (Shortcut, error) {
+	if !identifierPattern.MatchString(method) {
+		return Shortcut{}, fmt.Errorf("invalid method name %q", method)
+	}
+	var shortcut Shortcut
+	var obj *lua.LTable
+	var err error
+	if path, ok := target.(lua.LString); ok {
+		shortcut = Shortcut{Var: 1, Path: method + "()"}
+		if path != "" {
+			shortcut.Path = string(path) + "." + shortcut.Path
+		}
+		obj, err = r.resolveAppPath(string(path))
+	} else {
+		shortcut.Path = method + "()"
+		if shortcut.Var, err = r.parentVariableID(vendedID, target); err == nil {
+			obj, err = r.rootObject(vendedID, shortcut.Var)
+		}
+	}
+	if err != nil {
+		return Shortcut{}, err
+	}
+	if _, ok := r.State.GetField(obj, method).(*lua.LFunction); !ok {
+		return Shortcut{}, fmt.Errorf("%s is not a method of the target", method)
+	}
+	return shortcut, nil
+}
+
+// resolveAppPath follows a dotted field path from the app object to a table.
+func (r *LuaSession) resolveAppPath(path string) (*lua.LTable, error) {
+	obj := r.appObject
+	if obj == nil {
+		return nil, fmt.Errorf("no app object")
+	}
+	if path == "" {
+		return obj, nil
+	}
+	for _, field := range strings.Split(path, ".") {
+		if !identifierPattern.MatchString(field) {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		next, ok := r.State.GetField(obj, field).(*lua.LTable)
+		if !ok {
+			return nil, fmt.Errorf("path %q does not lead to an object", path)
+		}
+		obj = next
+	}
+	return obj, nil
+}
+
+// rootObject returns a variable's Lua object.
+func (r *LuaSession) rootObject(vendedID string, id int64) (*lua.LTable, error) {
+	if tracker := r.variableStore.GetTracker(vendedID); tracker != nil {
+		if v := tracker.GetVariable(id); v != nil {
+			if obj, ok := v.Value.(*lua.LTable); ok {
+				return obj, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("variable %d is not an object", id)
+}
+
+// shortcutsJSON encodes the shortcuts for variable 1's shortcuts property.
+// Returns "" when there are none, which removes the property.
+func (r *LuaSession) shortcutsJSON() string {
+	if len(r.shortcuts) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(r.shortcuts)
+	if err != nil {
+		r.Log(0, "Warning: failed to marshal shortcuts: %v", err)
+		return ""
+	}
+	return string(data)
+}
+
+// clearSentFocus drops variable 1's focus once AfterBatch has sent it, without
+// recording a change, so it fires once and setting the same path again sends
+// it again (as viewdefs are dropped once sent).
+func (r *LuaSession) clearSentFocus(tracker *changetracker.Tracker) {
+	if v1 := tracker.GetVariable(1); v1 != nil {
+		delete(v1.Properties, FocusProperty)
+		delete(v1.PropertyPriorities, FocusProperty)
+	}
+}
@@ -0,0 +1,79 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Session Groups)
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// GroupBroadcaster sends a JSON payload to every session in a group and
+// returns how many sessions it was sent to.
+type GroupBroadcaster func(group, name string, payload []byte, from string) int
+
+// SetGroup sets the session's group name, exposed as session.group.
+// Must be called before CreateLuaSession.
+func (r *LuaSession) SetGroup(group string) {
+	r.group = group
+}
+
+// SetGroupBroadcaster sets the callback behind ui.groupBroadcast.
+// Called by Server during session setup to decouple LuaSession from Server.
+func (r *LuaSession) SetGroupBroadcaster(broadcast GroupBroadcaster) {
+	r.groupBroadcaster = broadcast
+}
+
+// installGroup sets session.group (nil when the session is not in a group).
+func (r *LuaSession) installGroup(session *lua.LTable) {
+	if r.group != "" {
+		r.State.SetField(session, "group", lua.LString(r.group))
+	}
+}
+
+// addGroupAPI adds ui.groupBroadcast(group, name, payload) to the ui table.
+// The payload is JSON-encoded here and decoded in each receiving session's own
+// Lua state. Returns the number of sessions the broadcast was sent to.
+func (r *LuaSession) addGroupAPI(uiMod *lua.LTable) {
+	r.setAPI(uiMod, "ui", "groupBroadcast", r.State.NewFunction(func(L *lua.LState) int {
+		group := L.CheckString(1)
+		name := L.CheckString(2)
+		payload, err := json.Marshal(LuaToGo(L.Get(3)))
+		if err != nil {
+			L.RaiseError("ui.groupBroadcast: payload is not JSON-serializable: %s", err.Error())
+			return 0
+		}
+		if r.groupBroadcaster == nil {
+			r.Log(1, "ui.groupBroadcast: session groups are not available")
+			L.Push(lua.LNumber(0))
+			return 1
+		}
+		L.Push(lua.LNumber(r.groupBroadcaster(group, name, payload, r.ID)))
+		return 1
+	}))
+}
+
+// DeliverGroupBroadcast calls ui.onGroupBroadcast(name, payload, from) if
+// main.lua defined it. Must run on the session executor.
+func (r *LuaSession) DeliverGroupBroadcast(name string, payload []byte, from string) error {
+	L := r.State
+	ui, ok := L.GetGlobal("ui").(*lua.LTable)
+	if !ok {
+		return nil
+	}
+	handler, ok := L.GetField(ui, "onGroupBroadcast").(*lua.LFunction)
+	if !ok {
+		r.Log(2, "Group broadcast %s from session %s: no ui.onGroupBroadcast", name, from)
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(payload, &value); err != nil {
+		return fmt.Errorf("group broadcast %s: %w", name, err)
+	}
+	err := L.CallByParam(lua.P{Fn: handler, NRet: 0, Protect: true}, lua.LString(name), r.GoToLua(value), lua.LString(from))
+	if err != nil {
+		return fmt.Errorf("ui.onGroupBroadcast(%s) failed: %w", name, err)
+	}
+	return nil
+}
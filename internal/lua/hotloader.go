@@ -11,53 +11,55 @@ import (
 	"sync"
 	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/watchcore"
 )
 
+const (
+	reloadBatchSize  = 8                     // Sessions a rollout reloads at once
+	reloadBatchPause = 10 * time.Millisecond // Between batches, so other work gets through
+)
+
+// rollout is a file's reload across sessions, in progress.
+type rollout struct {
+	cancel chan struct{} // Closed when a newer save replaces the rollout, or on Stop
+	done   chan struct{} // Closed when the rollout has stopped
+}
+
 // HotLoader watches the lua directory for file changes and reloads modified files.
+// File watching, symlink tracking and debouncing are handled by watchcore.
 // CRC: crc-LuaHotLoader.md
 type HotLoader struct {
-	config         *config.Config
-	luaDir         string
-	watcher        *fsnotify.Watcher
-	getSessions    func() []*LuaSession   // Callback to get active sessions
-	triggerRefresh func(sessionID string) // Callback to trigger session refresh (runs AfterBatch)
-
-	// Symlink tracking
-	symlinkTargets map[string]string // lua file path -> resolved target dir
-	watchedDirs    map[string]int    // dir path -> reference count
-	mu             sync.Mutex
-
-	// Debouncing
-	pendingReloads map[string]time.Time
-	debounceMu     sync.Mutex
-	debounceDelay  time.Duration
-
-	done chan struct{}
+	config      *config.Config
+	log         config.Logger
+	luaDir      string
+	core        *watchcore.Core
+	getSessions func() []*LuaSession                              // Callback to get active sessions
+	runReload   func(sessionID string, reload func() error) error // Runs a reload exclusively, then AfterBatch
+	sources     *SourceCache                                      // Told when the lua directory disappears (optional)
+	rolloutsMu  sync.Mutex
+	rollouts    map[string]*rollout // tracking key -> rollout in progress
+	running     sync.WaitGroup      // Rollout goroutines
 }
 
 // NewHotLoader creates a new hot loader for the given lua directory.
-// triggerRefresh is called after successful reload to run AfterBatch and push changes to browser.
-func NewHotLoader(cfg *config.Config, luaDir string, getSessions func() []*LuaSession, triggerRefresh func(sessionID string)) (*HotLoader, error) {
-	watcher, err := fsnotify.NewWatcher()
+// runReload runs a reload in a session with exclusive access, on its executor,
+// followed by AfterBatch to push changes to the browser. With nil, reloads run
+// on the Lua executor only.
+func NewHotLoader(cfg *config.Config, luaDir string, getSessions func() []*LuaSession, runReload func(sessionID string, reload func() error) error) (*HotLoader, error) {
+	h := &HotLoader{
+		config:      cfg,
+		log:         cfg.Logger(config.LogLua),
+		luaDir:      luaDir,
+		getSessions: getSessions,
+		runReload:   runReload,
+		rollouts:    make(map[string]*rollout),
+	}
+	core, err := watchcore.New(h.log, "HotLoader", luaDir, h)
 	if err != nil {
 		return nil, err
 	}
-
-	h := &HotLoader{
-		config:         cfg,
-		luaDir:         luaDir,
-		watcher:        watcher,
-		getSessions:    getSessions,
-		triggerRefresh: triggerRefresh,
-		symlinkTargets: make(map[string]string),
-		watchedDirs:    make(map[string]int),
-		pendingReloads: make(map[string]time.Time),
-		debounceDelay:  100 * time.Millisecond,
-		done:           make(chan struct{}),
-	}
-
+	h.core = core
 	return h, nil
 }
 
@@ -65,275 +67,90 @@ func NewHotLoader(cfg *config.Config, luaDir string, getSessions func() []*LuaSe
 // Watches lua/ directory and apps/ directory for changes.
 // CRC: crc-LuaHotLoader.md
 func (h *HotLoader) Start() error {
-	// Watch the main lua directory
-	if err := h.addWatch(h.luaDir); err != nil {
+	// Watch the main lua directory and its symlink targets
+	if err := h.core.Start(); err != nil {
 		return err
 	}
 
 	// Watch the apps directory if it exists
 	appsDir := filepath.Join(h.config.Server.Dir, "apps")
 	if info, err := os.Stat(appsDir); err == nil && info.IsDir() {
-		if err := h.addWatchRecursive(appsDir); err != nil {
-			h.config.Log(1, "HotLoader: error watching apps directory: %v", err)
+		if err := h.core.WatchRecursive(appsDir); err != nil {
+			h.log.Log(1, "HotLoader: error watching apps directory: %v", err)
 		}
 	}
 
-	// Scan for existing symlinks and watch their target directories
-	if err := h.scanSymlinks(); err != nil {
-		h.config.Log(1, "HotLoader: error scanning symlinks: %v", err)
-	}
-
-	// Start the event loop
-	go h.eventLoop()
-
-	// Start the debounce processor
-	go h.debounceLoop()
-
-	h.config.Log(1, "HotLoader: watching %s for changes", h.luaDir)
+	h.log.Log(1, "HotLoader: watching %s for changes", h.luaDir)
 	return nil
 }
 
-// addWatchRecursive adds a watch to a directory and all its subdirectories.
-func (h *HotLoader) addWatchRecursive(dir string) error {
-	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil // Skip directories we can't read
-		}
-		if info.IsDir() {
-			if err := h.addWatch(path); err != nil {
-				h.config.Log(2, "HotLoader: could not watch %s: %v", path, err)
-			}
-		}
-		return nil
-	})
-}
-
-// Stop stops the hot loader.
+// Stop stops the hot loader, ending rollouts in progress after their current
+// batch.
 func (h *HotLoader) Stop() error {
-	close(h.done)
-	return h.watcher.Close()
-}
-
-// CleanupModule removes tracking state for a module file.
-// Called when a module is unloaded via session:unloadModule().
-// Seq: seq-unload-module.md
-func (h *HotLoader) CleanupModule(trackingKey string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	// Remove symlink target if tracked
-	delete(h.symlinkTargets, trackingKey)
-
-	// Remove pending reload if queued
-	h.debounceMu.Lock()
-	delete(h.pendingReloads, trackingKey)
-	h.debounceMu.Unlock()
-}
-
-// CleanupDirectory removes tracking state for all files in a directory.
-// Called when a directory is unloaded via session:unloadDirectory().
-// Seq: seq-unload-module.md
-func (h *HotLoader) CleanupDirectory(dirPath string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	// Remove symlink targets for files in this directory
-	for key := range h.symlinkTargets {
-		if strings.HasPrefix(key, dirPath+"/") || key == dirPath {
-			delete(h.symlinkTargets, key)
-		}
-	}
-
-	// Remove pending reloads for files in this directory
-	h.debounceMu.Lock()
-	for key := range h.pendingReloads {
-		if strings.HasPrefix(key, dirPath+"/") || key == dirPath {
-			delete(h.pendingReloads, key)
-		}
-	}
-	h.debounceMu.Unlock()
-
-	// Remove watch if we're watching this specific directory
-	if h.watchedDirs[dirPath] > 0 {
-		h.removeWatchLocked(dirPath)
-	}
+	err := h.core.Stop()
+	h.rolloutsMu.Lock()
+	for key, ro := range h.rollouts {
+		close(ro.cancel)
+		delete(h.rollouts, key)
+	}
+	h.rolloutsMu.Unlock()
+	h.running.Wait()
+	return err
 }
 
-// scanSymlinks scans the lua directory for symlinks and watches their target directories.
-func (h *HotLoader) scanSymlinks() error {
-	entries, err := os.ReadDir(h.luaDir)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".lua") {
-			continue
-		}
-		filePath := filepath.Join(h.luaDir, entry.Name())
-		h.updateSymlinkWatch(filePath)
-	}
-
-	return nil
-}
-
-// updateSymlinkWatch checks if a file is a symlink and updates watches accordingly.
-func (h *HotLoader) updateSymlinkWatch(filePath string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	// Check if file is a symlink
-	info, err := os.Lstat(filePath)
-	if err != nil {
-		return
-	}
-
-	// Remove old watch if this file was previously a symlink
-	if oldTarget, ok := h.symlinkTargets[filePath]; ok {
-		h.removeWatchLocked(oldTarget)
-		delete(h.symlinkTargets, filePath)
-	}
-
-	// If it's a symlink, resolve and watch the target directory
-	if info.Mode()&os.ModeSymlink != 0 {
-		target, err := filepath.EvalSymlinks(filePath)
-		if err != nil {
-			h.config.Log(2, "HotLoader: cannot resolve symlink %s: %v", filePath, err)
+// SetSourceCache links the hot loader to the session source cache: removal of
+// the lua directory marks the source unavailable, and watching pauses until the
+// cache sees the directory come back.
+func (h *HotLoader) SetSourceCache(sources *SourceCache) {
+	h.sources = sources
+	sources.OnAvailabilityChange(func(available bool) {
+		if !available {
+			h.core.Pause()
 			return
 		}
-
-		targetDir := filepath.Dir(target)
-		h.symlinkTargets[filePath] = targetDir
-		h.addWatchLocked(targetDir)
-		h.config.Log(2, "HotLoader: watching symlink target dir %s for %s", targetDir, filePath)
-	}
-}
-
-// removeSymlinkWatch removes the watch for a symlink's target directory.
-func (h *HotLoader) removeSymlinkWatch(filePath string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if targetDir, ok := h.symlinkTargets[filePath]; ok {
-		h.removeWatchLocked(targetDir)
-		delete(h.symlinkTargets, filePath)
-	}
-}
-
-// addWatch adds a directory to the watch list.
-func (h *HotLoader) addWatch(dir string) error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	return h.addWatchLocked(dir)
-}
-
-func (h *HotLoader) addWatchLocked(dir string) error {
-	h.watchedDirs[dir]++
-	if h.watchedDirs[dir] == 1 {
-		if err := h.watcher.Add(dir); err != nil {
-			h.watchedDirs[dir]--
-			return err
-		}
-		h.config.Log(2, "HotLoader: added watch for %s", dir)
-	}
-	return nil
-}
-
-func (h *HotLoader) removeWatchLocked(dir string) {
-	h.watchedDirs[dir]--
-	if h.watchedDirs[dir] <= 0 {
-		h.watcher.Remove(dir)
-		delete(h.watchedDirs, dir)
-		h.config.Log(2, "HotLoader: removed watch for %s", dir)
-	}
-}
-
-// eventLoop processes file system events.
-func (h *HotLoader) eventLoop() {
-	for {
-		select {
-		case <-h.done:
+		if err := h.core.Resume(); err != nil {
+			h.log.Log(0, "HotLoader: could not resume watching %s: %v", h.luaDir, err)
 			return
-		case event, ok := <-h.watcher.Events:
-			if !ok {
-				return
-			}
-			h.handleEvent(event)
-		case err, ok := <-h.watcher.Errors:
-			if !ok {
-				return
-			}
-			h.config.Log(1, "HotLoader: watcher error: %v", err)
 		}
-	}
+		h.log.Log(1, "HotLoader: resumed watching %s", h.luaDir)
+	})
 }
 
-// handleEvent processes a single file system event.
-func (h *HotLoader) handleEvent(event fsnotify.Event) {
-	// Only care about .lua files
-	if !strings.HasSuffix(event.Name, ".lua") {
+// RootRemoved pauses hot loading when the lua directory disappears.
+// Implements watchcore.RootListener.
+func (h *HotLoader) RootRemoved() {
+	if h.sources != nil {
+		h.sources.MarkUnavailable()
 		return
 	}
-
-	h.config.Log(3, "HotLoader: event %s on %s", event.Op, event.Name)
-
-	// Handle symlink changes in the lua directory
-	if filepath.Dir(event.Name) == h.luaDir {
-		switch {
-		case event.Op&fsnotify.Create != 0:
-			h.updateSymlinkWatch(event.Name)
-		case event.Op&fsnotify.Remove != 0:
-			h.removeSymlinkWatch(event.Name)
-		case event.Op&fsnotify.Rename != 0:
-			// Rename is like remove + create elsewhere
-			h.removeSymlinkWatch(event.Name)
-		}
-	}
-
-	// Queue reload for write events
-	if event.Op&fsnotify.Write != 0 || event.Op&fsnotify.Create != 0 {
-		h.queueReload(event.Name)
-	}
+	h.log.Log(0, "HotLoader: %s disappeared; hot loading paused", h.luaDir)
+	h.core.Pause()
 }
 
-// queueReload queues a file for reload with debouncing.
-func (h *HotLoader) queueReload(filePath string) {
-	h.debounceMu.Lock()
-	h.pendingReloads[filePath] = time.Now()
-	h.debounceMu.Unlock()
+// WatchesFile reports whether a file is a Lua source file.
+// Implements watchcore.Listener.
+func (h *HotLoader) WatchesFile(name string) bool {
+	return strings.HasSuffix(name, ".lua")
 }
 
-// debounceLoop processes pending reloads after the debounce delay.
-func (h *HotLoader) debounceLoop() {
-	ticker := time.NewTicker(50 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-h.done:
-			return
-		case <-ticker.C:
-			h.processPendingReloads()
-		}
-	}
+// FileChanged reloads a changed Lua file.
+// Implements watchcore.Listener.
+func (h *HotLoader) FileChanged(path string) {
+	h.reloadFile(path)
 }
 
-// processPendingReloads reloads files that have been pending for longer than debounceDelay.
-func (h *HotLoader) processPendingReloads() {
-	h.debounceMu.Lock()
-	now := time.Now()
-	var toReload []string
-	for path, queuedAt := range h.pendingReloads {
-		if now.Sub(queuedAt) >= h.debounceDelay {
-			toReload = append(toReload, path)
-			delete(h.pendingReloads, path)
-		}
-	}
-	h.debounceMu.Unlock()
+// CleanupModule removes tracking state for a module file.
+// Called when a module is unloaded via session:unloadModule().
+// Seq: seq-unload-module.md
+func (h *HotLoader) CleanupModule(trackingKey string) {
+	h.core.Forget(trackingKey)
+}
 
-	for _, path := range toReload {
-		h.reloadFile(path)
-	}
+// CleanupDirectory removes tracking state for all files in a directory.
+// Called when a directory is unloaded via session:unloadDirectory().
+// Seq: seq-unload-module.md
+func (h *HotLoader) CleanupDirectory(dirPath string) {
+	h.core.ForgetDir(dirPath)
 }
 
 // reloadFile reloads a Lua file in all active sessions.
@@ -347,67 +164,126 @@ func (h *HotLoader) reloadFile(filePath string) {
 		return
 	}
 
-	h.config.Log(1, "HotLoader: reloading %s", reloadPath)
+	h.log.Log(1, "HotLoader: reloading %s", reloadPath)
 
 	// Read the file content
 	content, err := os.ReadFile(reloadPath)
 	if err != nil {
-		h.config.Log(1, "HotLoader: error reading %s: %v", reloadPath, err)
+		h.log.Log(1, "HotLoader: error reading %s: %v", reloadPath, err)
 		return
 	}
 
 	trackingKey, err := ComputeTrackingKey(h.config.Server.Dir, reloadPath)
 	if err != nil {
-		h.config.Log(1, "HotLoader: error computing tracking key for %s: %v", reloadPath, err)
+		h.log.Log(1, "HotLoader: error computing tracking key for %s: %v", reloadPath, err)
 		return
 	}
 
-	h.config.Log(2, "HotLoader: tracking key for %s is %s", reloadPath, trackingKey)
+	h.log.Log(2, "HotLoader: tracking key for %s is %s", reloadPath, trackingKey)
+	h.startRollout(trackingKey, string(content))
+}
+
+// startRollout reloads a file in the sessions that loaded it, off the watcher
+// goroutine. A rollout of the same file still in progress is cancelled, and
+// the new one starts once it has stopped.
+func (h *HotLoader) startRollout(trackingKey, content string) {
+	ro := &rollout{cancel: make(chan struct{}), done: make(chan struct{})}
+	h.rolloutsMu.Lock()
+	prev := h.rollouts[trackingKey]
+	if prev != nil {
+		close(prev.cancel)
+	}
+	h.rollouts[trackingKey] = ro
+	h.rolloutsMu.Unlock()
+
+	h.running.Add(1)
+	go func() {
+		defer h.running.Done()
+		defer close(ro.done)
+		if prev != nil {
+			<-prev.done
+		}
+		h.rollOut(ro, trackingKey, content)
+		h.rolloutsMu.Lock()
+		if h.rollouts[trackingKey] == ro {
+			delete(h.rollouts, trackingKey)
+		}
+		h.rolloutsMu.Unlock()
+	}()
+}
 
-	// Reload in all active sessions with panic recovery
-	sessions := h.getSessions()
-	for _, sess := range sessions {
-		h.reloadInSession(sess, trackingKey, string(content))
+// rollOut reloads a file in the sessions that loaded it, a few at a time
+// with a pause between batches, so interactive work in other sessions is not
+// starved. It stops early when cancelled.
+func (h *HotLoader) rollOut(ro *rollout, trackingKey, content string) {
+	var targets []*LuaSession
+	for _, sess := range h.getSessions() {
+		if sess.IsFileLoaded(trackingKey) {
+			targets = append(targets, sess)
+		} else {
+			h.log.Log(2, "HotLoader: skipping %s in session %s (not loaded)", trackingKey, sess.ID)
+		}
+	}
+	for start := 0; start < len(targets); start += reloadBatchSize {
+		if start > 0 {
+			select {
+			case <-ro.cancel:
+				h.log.Log(1, "HotLoader: %s changed again after %d/%d sessions, restarting", trackingKey, start, len(targets))
+				return
+			case <-time.After(reloadBatchPause):
+			}
+		}
+		batch := targets[start:min(start+reloadBatchSize, len(targets))]
+		var wg sync.WaitGroup
+		for _, sess := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				h.reloadInSession(sess, trackingKey, content)
+			}()
+		}
+		wg.Wait()
+		h.log.Log(1, "HotLoader: reloaded %s in %d/%d sessions", trackingKey, start+len(batch), len(targets))
 	}
 }
 
 // reloadInSession reloads code in a single session with panic recovery.
 // Only reloads files that have already been loaded by the session.
-// Sets session.reloading flag during reload.
+// Sets session.reloading flag during reload, which runs as one exclusive task,
+// then calls session:onReload() if the reload succeeded.
 // Seq: seq-lua-hotload.md
 func (h *HotLoader) reloadInSession(sess *LuaSession, trackingKey, content string) {
-	// Check if file has been loaded by this session (skip if not)
-	if !sess.IsFileLoaded(trackingKey) {
-		h.config.Log(2, "HotLoader: skipping %s in session %s (not loaded)", trackingKey, sess.ID)
-		return
-	}
-
 	// Panic recovery to prevent crashing the server
 	defer func() {
 		if r := recover(); r != nil {
-			h.config.Log(0, "HotLoader: PANIC reloading %s in session %s: %v", trackingKey, sess.ID, r)
+			h.log.Log(0, "HotLoader: PANIC reloading %s in session %s: %v", trackingKey, sess.ID, r)
 		}
 	}()
 
-	// Set reloading flag before reload
-	sess.SetReloading(true)
-	defer sess.SetReloading(false)
-
-	_, err := sess.LoadCode(trackingKey, content)
+	reload := func() error {
+		// Unloaded since the rollout started
+		if !sess.IsFileLoaded(trackingKey) {
+			return nil
+		}
+		if err := sess.ReloadDirect(trackingKey, content); err != nil {
+			return err
+		}
+		return sess.OnReloadDirect()
+	}
+	var err error
+	if h.runReload != nil {
+		err = h.runReload(sess.ID, reload)
+	} else {
+		_, err = sess.execute(func() (interface{}, error) {
+			return nil, reload()
+		})
+	}
 	if err != nil {
-		h.config.Log(1, "HotLoader: error reloading %s in session %s: %v", trackingKey, sess.ID, err)
+		h.log.Log(1, "HotLoader: error reloading %s in session %s: %v", trackingKey, sess.ID, err)
 		return
 	}
 
-	h.config.Log(2, "HotLoader: reloaded %s in session %s", trackingKey, sess.ID)
-
-	// Trigger session refresh to run AfterBatch and push changes to browser
-	if h.triggerRefresh != nil {
-		h.config.Log(1, "HotLoader: triggering refresh for session %s", sess.ID)
-		h.triggerRefresh(sess.ID)
-	} else {
-		h.config.Log(1, "HotLoader: triggerRefresh is nil, cannot refresh session %s", sess.ID)
-	}
+	h.log.Log(2, "HotLoader: reloaded %s in session %s", trackingKey, sess.ID)
 }
 
 // resolveReloadPath determines which file to reload based on the changed path.
@@ -430,21 +306,5 @@ func (h *HotLoader) resolveReloadPath(changedPath string) string {
 
 	// Otherwise, this is a change in a symlink target directory
 	// Find which lua file symlinks to this location
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	changedDir := filepath.Dir(changedPath)
-	changedBase := filepath.Base(changedPath)
-
-	for luaPath, targetDir := range h.symlinkTargets {
-		if targetDir == changedDir {
-			// Check if the symlink points to this specific file
-			target, err := filepath.EvalSymlinks(luaPath)
-			if err == nil && filepath.Base(target) == changedBase {
-				return luaPath
-			}
-		}
-	}
-
-	return ""
+	return h.core.SymlinkFor(changedPath)
 }
@@ -71,8 +71,8 @@ func TestNewHotLoader(t *testing.T) {
 	if h.luaDir != luaDir {
 		t.Errorf("luaDir = %q, want %q", h.luaDir, luaDir)
 	}
-	if h.watcher == nil {
-		t.Error("watcher is nil")
+	if h.core == nil {
+		t.Error("watcher core is nil")
 	}
 	if h.getSessions == nil {
 		t.Error("getSessions is nil")
@@ -96,8 +96,8 @@ func TestHotLoaderStart(t *testing.T) {
 	defer h.Stop()
 
 	// Verify lua directory is being watched
-	if h.watchedDirs[luaDir] != 1 {
-		t.Errorf("luaDir not in watchedDirs, got %v", h.watchedDirs)
+	if n := h.core.WatchCount(luaDir); n != 1 {
+		t.Errorf("luaDir watch count = %d, want 1", n)
 	}
 }
 
@@ -197,10 +197,8 @@ func TestScanExistingSymlinks(t *testing.T) {
 	defer h.Stop()
 
 	// Check symlink was detected
-	h.mu.Lock()
-	targetTracked := h.symlinkTargets[symlinkPath]
-	watchCount := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	targetTracked := h.core.SymlinkTarget(symlinkPath)
+	watchCount := h.core.WatchCount(targetDir)
 
 	if targetTracked != targetDir {
 		t.Errorf("symlinkTargets[%s] = %q, want %q", symlinkPath, targetTracked, targetDir)
@@ -234,9 +232,7 @@ func TestReferenceCountingForSharedTargets(t *testing.T) {
 	defer h.Stop()
 
 	// Both should point to same target dir
-	h.mu.Lock()
-	watchCount := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	watchCount := h.core.WatchCount(targetDir)
 
 	if watchCount != 2 {
 		t.Errorf("Watch count for shared target = %d, want 2", watchCount)
@@ -246,9 +242,7 @@ func TestReferenceCountingForSharedTargets(t *testing.T) {
 	os.Remove(symlinkA)
 	time.Sleep(100 * time.Millisecond)
 
-	h.mu.Lock()
-	watchCountAfter := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	watchCountAfter := h.core.WatchCount(targetDir)
 
 	if watchCountAfter != 1 {
 		t.Errorf("Watch count after remove = %d, want 1", watchCountAfter)
@@ -353,6 +347,50 @@ func TestReloadWithNoSessions(t *testing.T) {
 	// Test passes if no panic
 }
 
+// TestReloadRollout verifies a reload reaches every session that loaded the
+// file, in batches, and that a second save during the rollout restarts it so
+// every session ends up with the newer content
+func TestReloadRollout(t *testing.T) {
+	luaDir := createTempLuaDir(t)
+	defer os.RemoveAll(luaDir)
+	appFile := filepath.Join(luaDir, "app.lua")
+	os.WriteFile(appFile, []byte("version = 1"), 0644)
+
+	cfg := testConfig(luaDir)
+	var sessions []*LuaSession
+	for i := range 3*reloadBatchSize + 1 {
+		rt, err := NewRuntime(cfg, luaDir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rt.Shutdown()
+		if i%4 != 0 {
+			if err := rt.RequireLuaFile("app.lua"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sessions = append(sessions, rt)
+	}
+	h, _ := NewHotLoader(cfg, luaDir, func() []*LuaSession { return sessions }, nil)
+
+	for _, version := range []string{"2", "3"} {
+		os.WriteFile(appFile, []byte("version = "+version), 0644)
+		h.reloadFile(appFile)
+	}
+	h.running.Wait()
+
+	for i, rt := range sessions {
+		got, _ := rt.LoadCode("check", "return version")
+		var want interface{} = float64(3)
+		if i%4 == 0 {
+			want = nil
+		}
+		if got != want {
+			t.Errorf("session %d: version = %v, want %v", i, got, want)
+		}
+	}
+}
+
 // === Graceful Shutdown Tests ===
 
 func TestGracefulShutdown(t *testing.T) {
@@ -0,0 +1,133 @@
+// CRC: crc-LuaResolver.md
+// Spec: libraries.md
+package lua
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	lua "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+)
+
+// KeyStyleCamel maps camelCase frontend path keys to snake_case Lua fields.
+const KeyStyleCamel = "camel"
+
+// snakeKeys caches camelCase -> snake_case conversions; key names are few and reused.
+var snakeKeys sync.Map
+
+// snakeKey returns the snake_case form of a camelCase key. Keys without upper-case
+// letters, numeric keys and underscore-prefixed internals are returned unchanged.
+func snakeKey(name string) string {
+	if name == "" || name[0] == '_' || strings.IndexFunc(name, unicode.IsUpper) < 0 {
+		return name
+	}
+	if cached, ok := snakeKeys.Load(name); ok {
+		return cached.(string)
+	}
+	runes := []rune(name)
+	var b strings.Builder
+	for i, c := range runes {
+		if unicode.IsUpper(c) {
+			// Break before a word, keeping acronyms together: userIDCode -> user_id_code
+			if i > 0 && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			c = unicode.ToLower(c)
+		}
+		b.WriteRune(c)
+	}
+	snakeKeys.Store(name, b.String())
+	return b.String()
+}
+
+// camelKeys reports whether the session maps frontend keys to snake_case.
+func (r *LuaResolver) camelKeys() bool {
+	return r.Session != nil && r.Session.config != nil && r.Session.config.Lua.KeyStyle == KeyStyleCamel
+}
+
+// key returns the Lua field a frontend key refers to in tbl. A key the table
+// already has is used as-is; otherwise its snake_case form is.
+func (r *LuaResolver) key(tbl *lua.LTable, name string) string {
+	if !r.camelKeys() {
+		return name
+	}
+	return r.Session.styledKey(tbl, name)
+}
+
+func (s *LuaSession) styledKey(tbl *lua.LTable, name string) string {
+	snake := snakeKey(name)
+	if snake == name || s.State.GetField(tbl, name) != lua.LNil {
+		return name
+	}
+	return snake
+}
+
+// styledPath rewrites a frontend path for a variable whose keyStyle property is
+// camel, applying the resolver's key rule along the parent's value. Segments past
+// the point navigation stops fall back to their snake_case form.
+func (s *LuaSession) styledPath(parent any, path string) string {
+	pathPart, query, hasQuery := strings.Cut(path, "?")
+	segments := strings.Split(pathPart, ".")
+	current := parent
+	for i, seg := range segments {
+		tbl, _ := current.(*lua.LTable)
+		current = nil
+		name, call := seg, ""
+		if isMethodCall(seg) {
+			name, call, _ = strings.Cut(seg, "(")
+			call = "(" + call
+		}
+		if tbl == nil {
+			segments[i] = snakeKey(name) + call
+			continue
+		}
+		if index, err := strconv.Atoi(seg); err == nil {
+			current = s.State.RawGetInt(tbl, index+1) // Lua is 1-indexed
+			continue
+		}
+		name = s.styledKey(tbl, name)
+		segments[i] = name + call
+		if call == "" {
+			current = s.State.GetField(tbl, name)
+		}
+	}
+	styled := strings.Join(segments, ".")
+	if hasQuery {
+		styled += "?" + query
+	}
+	return styled
+}
+
+// applyKeyStyle maps a frontend-created variable's path when it, or the parent it
+// inherits from, has keyStyle=camel. The property is kept on the variable so its
+// own children inherit it. With the session-wide key style the resolver maps
+// keys as paths are navigated, so paths are left alone.
+func (s *LuaSession) applyKeyStyle(tracker *changetracker.Tracker, parentID int64, path string, properties map[string]string) string {
+	if s.config != nil && s.config.Lua.KeyStyle == KeyStyleCamel {
+		return path
+	}
+	parent := tracker.GetVariable(parentID)
+	style := properties["keyStyle"]
+	if _, query, ok := strings.Cut(path, "?"); ok {
+		for pair := range strings.SplitSeq(query, "&") {
+			if value, ok := strings.CutPrefix(pair, "keyStyle="); ok {
+				style = value
+			}
+		}
+	}
+	if style == "" && parent != nil {
+		style = parent.Properties["keyStyle"]
+	}
+	if style != KeyStyleCamel {
+		return path
+	}
+	properties["keyStyle"] = style
+	var value any
+	if parent != nil {
+		value = parent.NavigationValue()
+	}
+	return s.styledPath(value, path)
+}
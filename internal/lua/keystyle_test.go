@@ -0,0 +1,106 @@
+// CRC: crc-LuaResolver.md
+// Spec: libraries.md
+package lua
+
+import (
+	"testing"
+
+	golua "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+func TestSnakeKey(t *testing.T) {
+	tests := map[string]string{
+		"firstName":  "first_name",
+		"userIDCode": "user_id_code",
+		"pageURL":    "page_url",
+		"name":       "name",
+		"first_name": "first_name",
+		"_hiddenKey": "_hiddenKey",
+		"2":          "2",
+		"":           "",
+	}
+	for in, want := range tests {
+		if got := snakeKey(in); got != want {
+			t.Errorf("snakeKey(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// keyStyleFixture returns a tracker over a snake_case Lua object.
+func keyStyleFixture(t *testing.T, keyStyle string) (*LuaSession, *changetracker.Tracker, *golua.LTable) {
+	L := golua.NewState()
+	t.Cleanup(L.Close)
+	cfg := config.DefaultConfig()
+	cfg.Lua.KeyStyle = keyStyle
+	sess := &LuaSession{State: L, config: cfg}
+	err := L.DoString(`
+		person = {first_name = "Ada", displayName = "ada", address = {zip_code = "02139"}}
+		function person:full_name() return self.first_name .. " Lovelace" end
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := changetracker.NewTracker()
+	tracker.Resolver = &LuaResolver{Session: sess}
+	return sess, tracker, L.GetGlobal("person").(*golua.LTable)
+}
+
+// TestKeyStyleRoundTrip verifies camelCase paths read and write snake_case fields
+func TestKeyStyleRoundTrip(t *testing.T) {
+	_, tracker, person := keyStyleFixture(t, KeyStyleCamel)
+	root := tracker.CreateVariable(person, 0, "", nil)
+
+	for path, want := range map[string]any{
+		"firstName":       "Ada",
+		"displayName":     "ada", // already matches, left alone
+		"address.zipCode": "02139",
+		"fullName()":      "Ada Lovelace",
+	} {
+		v := tracker.CreateVariable(nil, root.ID, path, nil)
+		if got, err := v.Get(); err != nil || got != want {
+			t.Errorf("%s = %v (%v), want %v", path, got, err, want)
+		}
+	}
+
+	first := tracker.CreateVariable(nil, root.ID, "firstName", nil)
+	if err := first.Set("Grace"); err != nil {
+		t.Fatal(err)
+	}
+	if got := person.RawGetString("first_name"); got.String() != "Grace" {
+		t.Errorf("first_name = %v after Set, want Grace", got)
+	}
+	if got := person.RawGetString("firstName"); got != golua.LNil {
+		t.Errorf("Set created camelCase field %v", got)
+	}
+}
+
+// TestKeyStyleProperty verifies a keyStyle property maps a frontend path, and
+// that children inherit it
+func TestKeyStyleProperty(t *testing.T) {
+	sess, tracker, person := keyStyleFixture(t, "")
+	root := tracker.CreateVariable(person, 0, "", nil)
+
+	if got := sess.applyKeyStyle(tracker, root.ID, "firstName", map[string]string{}); got != "firstName" {
+		t.Errorf("path mapped without keyStyle: %s", got)
+	}
+
+	props := map[string]string{"keyStyle": KeyStyleCamel}
+	path := sess.applyKeyStyle(tracker, root.ID, "address?access=r", props)
+	address := tracker.CreateVariableWithId(100, nil, root.ID, path, props)
+
+	childProps := map[string]string{}
+	path = sess.applyKeyStyle(tracker, address.ID, "zipCode", childProps)
+	if path != "zip_code" || childProps["keyStyle"] != KeyStyleCamel {
+		t.Fatalf("child path %q props %v, want inherited mapping", path, childProps)
+	}
+	zip := tracker.CreateVariableWithId(101, nil, address.ID, path, childProps)
+	if got, _ := zip.Get(); got != "02139" {
+		t.Errorf("zipCode = %v, want 02139", got)
+	}
+
+	if got := sess.applyKeyStyle(tracker, root.ID, "displayName?keyStyle=camel", map[string]string{}); got != "displayName?keyStyle=camel" {
+		t.Errorf("existing key was mapped: %s", got)
+	}
+}
@@ -0,0 +1,402 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md
+package lua
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/gopher-lua/ast"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+// Lint severities
+const (
+	LintError   = "error"
+	LintWarning = "warning"
+)
+
+// LintIssue is one problem found by LintSite.
+type LintIssue struct {
+	File     string
+	Line     int
+	Severity string
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", i.File, i.Line, i.Severity, i.Message)
+}
+
+// apiCall is a ui or session call recorded during the walk and checked once
+// every file has been seen, so fields a site adds itself are not flagged.
+type apiCall struct {
+	file     string
+	line     int
+	table    string
+	name     string
+	nargs    int
+	variadic bool // last argument is a call or ..., so the count is a minimum
+	dot      bool // session.name(...) instead of session:name(...)
+}
+
+type globalRead struct {
+	file string
+	line int
+	name string
+}
+
+// linter walks the Lua files of one site.
+type linter struct {
+	siteDir  string
+	file     string
+	scopes   []map[string]bool
+	issues   []LintIssue
+	calls    []apiCall
+	reads    []globalRead
+	defined  map[string]bool // globals, prototypes and presenters the site defines
+	userAPIs map[string]bool // "ui.name" and "session.name" fields the site assigns
+}
+
+var luaIdent = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// LintSite checks a site directory's Lua code for misuse of the runtime API:
+// unknown or wrongly-called ui and session functions, presenter types used
+// by viewdefs that no Lua code defines, and require() of missing modules.
+// Files that fail to parse are reported as errors.
+func LintSite(siteDir string) ([]LintIssue, error) {
+	l := &linter{siteDir: siteDir, defined: map[string]bool{}, userAPIs: map[string]bool{}}
+	var files []string
+	err := filepath.WalkDir(siteDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".lua") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if err := l.lintFile(path); err != nil {
+			return nil, err
+		}
+	}
+	l.checkCalls()
+	l.checkReads(viewdefTypes(siteDir))
+	sort.SliceStable(l.issues, func(a, b int) bool {
+		if l.issues[a].File != l.issues[b].File {
+			return l.issues[a].File < l.issues[b].File
+		}
+		return l.issues[a].Line < l.issues[b].Line
+	})
+	return l.issues, nil
+}
+
+func (l *linter) lintFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	l.file, _ = filepath.Rel(l.siteDir, path)
+	chunk, err := parse.Parse(f, l.file)
+	if err != nil {
+		l.report(0, LintError, "%v", err)
+		return nil
+	}
+	l.scopes = nil
+	l.block(chunk)
+	return nil
+}
+
+func (l *linter) report(line int, severity, format string, args ...any) {
+	l.issues = append(l.issues, LintIssue{File: l.file, Line: line, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+func (l *linter) push() { l.scopes = append(l.scopes, map[string]bool{}) }
+func (l *linter) pop()  { l.scopes = l.scopes[:len(l.scopes)-1] }
+
+func (l *linter) declare(names ...string) {
+	for _, name := range names {
+		l.scopes[len(l.scopes)-1][name] = true
+	}
+}
+
+func (l *linter) isLocal(name string) bool {
+	for i := len(l.scopes) - 1; i >= 0; i-- {
+		if l.scopes[i][name] {
+			return true
+		}
+	}
+	return false
+}
+
+// global returns the name of e if it is a global variable reference.
+func (l *linter) global(e ast.Expr) (string, bool) {
+	id, ok := e.(*ast.IdentExpr)
+	if !ok || l.isLocal(id.Value) {
+		return "", false
+	}
+	return id.Value, true
+}
+
+func (l *linter) block(stmts []ast.Stmt) {
+	l.push()
+	for _, s := range stmts {
+		l.stmt(s)
+	}
+	l.pop()
+}
+
+func (l *linter) stmt(s ast.Stmt) {
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		l.exprs(s.Rhs)
+		for _, lhs := range s.Lhs {
+			l.assignTarget(lhs)
+		}
+	case *ast.LocalAssignStmt:
+		l.exprs(s.Exprs)
+		l.declare(s.Names...)
+	case *ast.FuncCallStmt:
+		l.expr(s.Expr)
+	case *ast.DoBlockStmt:
+		l.block(s.Stmts)
+	case *ast.WhileStmt:
+		l.expr(s.Condition)
+		l.block(s.Stmts)
+	case *ast.RepeatStmt:
+		l.push()
+		for _, st := range s.Stmts {
+			l.stmt(st)
+		}
+		l.expr(s.Condition)
+		l.pop()
+	case *ast.IfStmt:
+		l.expr(s.Condition)
+		l.block(s.Then)
+		l.block(s.Else)
+	case *ast.NumberForStmt:
+		l.exprs([]ast.Expr{s.Init, s.Limit, s.Step})
+		l.push()
+		l.declare(s.Name)
+		l.block(s.Stmts)
+		l.pop()
+	case *ast.GenericForStmt:
+		l.exprs(s.Exprs)
+		l.push()
+		l.declare(s.Names...)
+		l.block(s.Stmts)
+		l.pop()
+	case *ast.FuncDefStmt:
+		if s.Name.Func != nil {
+			l.assignTarget(s.Name.Func)
+			l.function(s.Func, false)
+		} else {
+			l.assignTarget(&ast.AttrGetExpr{Object: s.Name.Receiver, Key: &ast.StringExpr{Value: s.Name.Method}})
+			l.function(s.Func, true)
+		}
+	case *ast.ReturnStmt:
+		l.exprs(s.Exprs)
+	}
+}
+
+// assignTarget records globals and ui/session fields the site defines.
+func (l *linter) assignTarget(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.IdentExpr:
+		if name, ok := l.global(e); ok {
+			l.defined[name] = true
+		}
+	case *ast.AttrGetExpr:
+		if table, ok := l.global(e.Object); ok && (table == "ui" || table == "session") {
+			if key, ok := e.Key.(*ast.StringExpr); ok {
+				l.userAPIs[table+"."+key.Value] = true
+			}
+		}
+		l.expr(e.Object)
+		l.expr(e.Key)
+	default:
+		l.expr(e)
+	}
+}
+
+func (l *linter) function(f *ast.FunctionExpr, method bool) {
+	l.push()
+	if method {
+		l.declare("self")
+	}
+	if f.ParList != nil {
+		l.declare(f.ParList.Names...)
+	}
+	l.block(f.Stmts)
+	l.pop()
+}
+
+func (l *linter) exprs(es []ast.Expr) {
+	for _, e := range es {
+		if e != nil {
+			l.expr(e)
+		}
+	}
+}
+
+func (l *linter) expr(e ast.Expr) {
+	switch e := e.(type) {
+	case *ast.IdentExpr:
+		if name, ok := l.global(e); ok {
+			l.reads = append(l.reads, globalRead{l.file, e.Line(), name})
+		}
+	case *ast.AttrGetExpr:
+		l.expr(e.Object)
+		l.expr(e.Key)
+	case *ast.TableExpr:
+		for _, f := range e.Fields {
+			l.exprs([]ast.Expr{f.Key, f.Value})
+		}
+	case *ast.FuncCallExpr:
+		l.call(e)
+		l.exprs([]ast.Expr{e.Func, e.Receiver})
+		l.exprs(e.Args)
+	case *ast.LogicalOpExpr:
+		l.exprs([]ast.Expr{e.Lhs, e.Rhs})
+	case *ast.RelationalOpExpr:
+		l.exprs([]ast.Expr{e.Lhs, e.Rhs})
+	case *ast.StringConcatOpExpr:
+		l.exprs([]ast.Expr{e.Lhs, e.Rhs})
+	case *ast.ArithmeticOpExpr:
+		l.exprs([]ast.Expr{e.Lhs, e.Rhs})
+	case *ast.UnaryMinusOpExpr:
+		l.expr(e.Expr)
+	case *ast.UnaryNotOpExpr:
+		l.expr(e.Expr)
+	case *ast.UnaryLenOpExpr:
+		l.expr(e.Expr)
+	case *ast.FunctionExpr:
+		l.function(e, false)
+	}
+}
+
+// call records ui and session calls, names defined by session:prototype and
+// ui.registerPresenter, and checks require() targets.
+func (l *linter) call(e *ast.FuncCallExpr) {
+	c := apiCall{file: l.file, line: e.Line(), nargs: len(e.Args)}
+	if n := len(e.Args); n > 0 {
+		switch e.Args[n-1].(type) {
+		case *ast.FuncCallExpr, *ast.Comma3Expr:
+			c.variadic = true
+			c.nargs--
+		}
+	}
+	if e.Receiver != nil {
+		if table, ok := l.global(e.Receiver); ok && table == "session" {
+			c.table, c.name = table, e.Method
+		}
+	} else if attr, ok := e.Func.(*ast.AttrGetExpr); ok {
+		if table, ok := l.global(attr.Object); ok && (table == "ui" || table == "session") {
+			if key, ok := attr.Key.(*ast.StringExpr); ok {
+				c.table, c.name, c.dot = table, key.Value, table == "session"
+			}
+		}
+	} else if name, ok := l.global(e.Func); ok && name == "require" && len(e.Args) == 1 {
+		if mod, ok := e.Args[0].(*ast.StringExpr); ok {
+			l.checkRequire(e.Line(), mod.Value)
+		}
+	}
+	if c.table == "" {
+		return
+	}
+	l.calls = append(l.calls, c)
+	if (c.name == "prototype" && c.table == "session") || (c.name == "registerPresenter" && c.table == "ui") {
+		if len(e.Args) > 0 {
+			if name, ok := e.Args[0].(*ast.StringExpr); ok {
+				l.defined[name.Value] = true
+			}
+		}
+	}
+}
+
+// checkRequire reports modules that resolve to no file, mirroring the
+// runtime's lookup with the default package.path: each file in lua/ first,
+// then in the site.
+func (l *linter) checkRequire(line int, mod string) {
+	for _, rel := range ModulePaths(DefaultPackagePath, mod) {
+		for _, path := range []string{filepath.Join(l.siteDir, "lua", rel), filepath.Join(l.siteDir, rel)} {
+			if _, err := os.Stat(path); err == nil {
+				return
+			}
+		}
+	}
+	l.report(line, LintError, "require(%q): module not found in the site", mod)
+}
+
+func (l *linter) checkCalls() {
+	for _, c := range l.calls {
+		l.file = c.file
+		if l.userAPIs[c.table+"."+c.name] {
+			continue
+		}
+		sig, known := lookupAPI(c.table, c.name)
+		switch {
+		case !known && c.dot:
+			// session.foo on an unknown name is a field read, not necessarily a call mistake
+			continue
+		case !known:
+			l.report(c.line, LintError, "unknown function %s", apiName(c.table, c.name))
+			continue
+		case c.dot:
+			l.report(c.line, LintError, "session.%s called with '.'; use session:%s", c.name, c.name)
+			continue
+		}
+		if c.nargs < sig.MinArgs && !c.variadic {
+			l.report(c.line, LintError, "%s expects at least %d argument(s), got %d", apiName(c.table, c.name), sig.MinArgs, c.nargs)
+		} else if c.nargs > sig.MaxArgs {
+			l.report(c.line, LintWarning, "%s expects at most %d argument(s), got %d", apiName(c.table, c.name), sig.MaxArgs, c.nargs)
+		}
+	}
+}
+
+// checkReads warns about global reads of viewdef type names that no Lua code defines.
+func (l *linter) checkReads(types map[string]bool) {
+	seen := map[string]bool{}
+	for _, r := range l.reads {
+		if !types[r.name] || l.defined[r.name] || seen[r.file+"\x00"+r.name] {
+			continue
+		}
+		seen[r.file+"\x00"+r.name] = true
+		l.file = r.file
+		l.report(r.line, LintWarning, "%s has viewdefs but is never defined in the site's Lua code", r.name)
+	}
+}
+
+func apiName(table, name string) string {
+	if table == "session" {
+		return "session:" + name
+	}
+	return "ui." + name
+}
+
+// viewdefTypes returns the presenter type names of the site's viewdefs (TYPE.NAMESPACE.html).
+// Namespaced types such as lua.ViewList are skipped.
+func viewdefTypes(siteDir string) map[string]bool {
+	types := map[string]bool{}
+	entries, _ := os.ReadDir(filepath.Join(siteDir, "viewdefs"))
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".html")
+		if name == entry.Name() {
+			continue
+		}
+		if i := strings.LastIndex(name, "."); i > 0 && luaIdent.MatchString(name[:i]) {
+			types[name[:i]] = true
+		}
+	}
+	return types
+}
@@ -0,0 +1,107 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	golua "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestAPISignaturesRegistered verifies every linted signature is installed by the runtime
+func TestAPISignaturesRegistered(t *testing.T) {
+	rt, err := NewRuntime(config.DefaultConfig(), "/tmp", nil)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	defer rt.Shutdown()
+	rt.SetVariableStore(newMockStore())
+	sess, err := rt.CreateLuaSession("1")
+	if err != nil {
+		t.Fatalf("Failed to create Lua session: %v", err)
+	}
+
+	rt.execute(func() (interface{}, error) {
+		tables := map[string]*golua.LTable{
+			"session": sess.sessionTable,
+			"ui":      rt.State.GetGlobal("ui").(*golua.LTable),
+		}
+		for _, sig := range apiSignatures {
+			if fn := rt.State.GetField(tables[sig.Table], sig.Name); fn.Type() != golua.LTFunction {
+				t.Errorf("%s.%s is in apiSignatures but not registered", sig.Table, sig.Name)
+			}
+		}
+		return nil, nil
+	})
+}
+
+func writeSite(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLintSite(t *testing.T) {
+	dir := writeSite(t, map[string]string{
+		"viewdefs/App.DEFAULT.html":     "<div></div>",
+		"viewdefs/Missing.DEFAULT.html": "<div></div>",
+		"lua/util/strings.lua":          "return {}",
+		"lua/main.lua": `
+App = session:prototype("App", {})
+local s = require("util.strings")
+local gone = require("util.nope")
+session:createAppVariable(App:new(), "extra", "args")
+session:createAppVariable()
+session:createAppVariable(unpack({}))
+session:bogus(1)
+session.getApp()
+ui.log("a", 1)
+ui.frobnicate()
+function ui.onSessionRequest(req) return true end
+ui.onSessionRequest({})
+local m = Missing
+local function f(Missing) return Missing end
+`,
+	})
+	issues, err := LintSite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.String())
+	}
+	want := []string{
+		"lua/main.lua:4: error: require(\"util.nope\"): module not found in the site",
+		"lua/main.lua:5: warning: session:createAppVariable expects at most 2 argument(s), got 3",
+		"lua/main.lua:6: error: session:createAppVariable expects at least 1 argument(s), got 0",
+		"lua/main.lua:8: error: unknown function session:bogus",
+		"lua/main.lua:9: error: session.getApp called with '.'; use session:getApp",
+		"lua/main.lua:11: error: unknown function ui.frobnicate",
+		"lua/main.lua:14: warning: Missing has viewdefs but is never defined in the site's Lua code",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("issues:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestLintSiteParseError(t *testing.T) {
+	dir := writeSite(t, map[string]string{"lua/main.lua": "function ("})
+	issues, err := LintSite(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 1 || issues[0].Severity != LintError || issues[0].File != "lua/main.lua" {
+		t.Errorf("issues = %v", issues)
+	}
+}
@@ -0,0 +1,153 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Configuration Options)
+package lua
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	changetracker "github.com/zot/change-tracker"
+)
+
+// maxDedupEntries bounds a session's dedup state; past it the oldest entry is evicted.
+const maxDedupEntries = 256
+
+type dedupKey struct {
+	varID int64
+	msg   string
+}
+
+type dedupEntry struct {
+	start   time.Time // When the logged occurrence happened
+	repeats int       // Occurrences since, not logged
+}
+
+// errorDedup collapses repeated errors for a variable, like a getter that throws
+// on every batch. The first occurrence is logged; identical ones within the
+// window are only counted, and summarized once the window ends.
+type errorDedup struct {
+	mu      sync.Mutex
+	window  time.Duration // 0 logs every occurrence
+	entries map[dedupKey]*dedupEntry
+	now     func() time.Time
+}
+
+func newErrorDedup(window time.Duration) *errorDedup {
+	return &errorDedup{window: window, entries: make(map[dedupKey]*dedupEntry), now: time.Now}
+}
+
+// note records an occurrence of msg for a variable and returns the line to log,
+// if any. An occurrence after a window with repeats logs that window's summary.
+func (d *errorDedup) note(varID int64, msg string) (string, bool) {
+	if d.window <= 0 {
+		return msg, true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	key := dedupKey{varID, msg}
+	now := d.now()
+	e := d.entries[key]
+	switch {
+	case e == nil:
+		if len(d.entries) >= maxDedupEntries {
+			d.evictOldest()
+		}
+		d.entries[key] = &dedupEntry{start: now}
+		return msg, true
+	case now.Sub(e.start) < d.window:
+		e.repeats++
+		return "", false
+	}
+	line := msg
+	if e.repeats > 0 {
+		line = d.summary(key, e)
+	}
+	*e = dedupEntry{start: now}
+	return line, true
+}
+
+// summary describes an entry's window.
+func (d *errorDedup) summary(key dedupKey, e *dedupEntry) string {
+	return fmt.Sprintf("last error ×%d in %gs: %s", e.repeats+1, d.window.Seconds(), key.msg)
+}
+
+// evictOldest drops the entry whose window started first.
+func (d *errorDedup) evictOldest() {
+	var oldest dedupKey
+	var start time.Time
+	for key, e := range d.entries {
+		if start.IsZero() || e.start.Before(start) {
+			oldest, start = key, e.start
+		}
+	}
+	delete(d.entries, oldest)
+}
+
+// expired drops entries whose window has ended and returns a summary line for
+// each that had repeats, in variable order. It keeps summaries coming for
+// errors that stop occurring.
+func (d *errorDedup) expired() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	var ended []dedupKey
+	for key, e := range d.entries {
+		if now.Sub(e.start) >= d.window {
+			ended = append(ended, key)
+		}
+	}
+	slices.SortFunc(ended, func(a, b dedupKey) int {
+		return cmp.Or(cmp.Compare(a.varID, b.varID), strings.Compare(a.msg, b.msg))
+	})
+	var summaries []string
+	for _, key := range ended {
+		if e := d.entries[key]; e.repeats > 0 {
+			summaries = append(summaries, d.summary(key, e))
+		}
+		delete(d.entries, key)
+	}
+	return summaries
+}
+
+// logVarError logs an error for a variable unless it repeats one logged within
+// the window, and always adds it to the variable's diags.
+func (r *LuaSession) logVarError(level int, varID int64, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if tracker := r.variableStore.GetTracker(r.ID); tracker != nil {
+		if v := tracker.GetVariable(varID); v != nil {
+			addDiag(v, msg)
+		}
+	}
+	if line, ok := r.errors.note(varID, msg); ok {
+		r.Log(level, "%s", line)
+	}
+}
+
+// logComputeError logs an error from the variable being computed, if any.
+func (r *LuaSession) logComputeError(err error) {
+	if r.variableStore == nil {
+		return
+	}
+	if tracker := r.variableStore.GetTracker(r.ID); tracker != nil && tracker.ComputingVar != nil {
+		r.logVarError(1, tracker.ComputingVar.ID, "variable %d: %v", tracker.ComputingVar.ID, err)
+	}
+}
+
+// logErrorSummaries logs a summary of each error whose window ended with repeats.
+func (r *LuaSession) logErrorSummaries() {
+	for _, summary := range r.errors.expired() {
+		r.Log(1, "%s", summary)
+	}
+}
+
+// addDiag adds a diagnostic to a variable once. The tracker clears Diags when
+// the variable is recomputed.
+func addDiag(v *changetracker.Variable, diag string) {
+	if !slices.Contains(v.Diags, diag) {
+		v.Diags = append(v.Diags, diag)
+	}
+}
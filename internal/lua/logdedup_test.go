@@ -0,0 +1,66 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Configuration Options)
+package lua
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestErrorDedup verifies repeats of a variable's error within the window are
+// counted instead of logged, summarized once the window ends, and logged again
+// after it; other variables and messages are separate, and the state stays bounded
+func TestErrorDedup(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := newErrorDedup(time.Minute)
+	d.now = func() time.Time { return now }
+
+	logged := func(varID int64, msg string) bool {
+		_, ok := d.note(varID, msg)
+		return ok
+	}
+	if !logged(5, "boom") {
+		t.Fatal("first occurrence not logged")
+	}
+	for range 99 {
+		if logged(5, "boom") {
+			t.Fatal("repeat logged within the window")
+		}
+	}
+	if !logged(6, "boom") || !logged(5, "bang") {
+		t.Error("another variable or message was suppressed")
+	}
+	if summaries := d.expired(); summaries != nil {
+		t.Errorf("summaries before the window ended: %q", summaries)
+	}
+
+	now = now.Add(time.Minute)
+	want := []string{"last error ×100 in 60s: boom"}
+	if summaries := d.expired(); !slices.Equal(summaries, want) {
+		t.Errorf("summaries = %q, want %q", summaries, want)
+	}
+	if !logged(5, "boom") {
+		t.Error("occurrence after the window not logged")
+	}
+
+	// An occurrence that ends a window with repeats logs the window's summary
+	logged(5, "boom")
+	now = now.Add(time.Minute)
+	if line, _ := d.note(5, "boom"); line != "last error ×2 in 60s: boom" {
+		t.Errorf("occurrence after repeats logged %q, want the summary", line)
+	}
+
+	for i := range 2 * maxDedupEntries {
+		logged(int64(i), fmt.Sprint("error ", i))
+	}
+	if len(d.entries) > maxDedupEntries {
+		t.Errorf("%d entries kept, want at most %d", len(d.entries), maxDedupEntries)
+	}
+
+	d = newErrorDedup(0)
+	if !logged(5, "boom") || !logged(5, "boom") {
+		t.Error("a zero window suppressed a repeat")
+	}
+}
@@ -0,0 +1,50 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Object Collection)
+package lua
+
+import (
+	"strconv"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// PruneObjectIDs removes the session's _objectToId entries for tables keep
+// rejects, and its _variables cache entries for variables the tracker no
+// longer has. gopher-lua ignores __mode, so without this both tables only
+// grow. Returns the number of _objectToId entries before and after. Call it
+// on the session executor.
+func (r *LuaSession) PruneObjectIDs(keep func(obj *lua.LTable, varID int64) bool) (before, after int) {
+	if r.sessionTable == nil {
+		return 0, 0
+	}
+	if objectToID, ok := r.State.GetField(r.sessionTable, "_objectToId").(*lua.LTable); ok {
+		var drop []lua.LValue
+		objectToID.ForEach(func(k, v lua.LValue) {
+			obj, ok := k.(*lua.LTable)
+			if !ok {
+				return
+			}
+			before++
+			if id, _ := v.(lua.LNumber); !keep(obj, int64(id)) {
+				drop = append(drop, k)
+			}
+		})
+		for _, k := range drop {
+			objectToID.RawSet(k, lua.LNil)
+		}
+		after = before - len(drop)
+	}
+	tracker := r.GetTracker()
+	if variables, ok := r.State.GetField(r.sessionTable, "_variables").(*lua.LTable); ok && tracker != nil {
+		var drop []lua.LValue
+		variables.ForEach(func(k, _ lua.LValue) {
+			if id, err := strconv.ParseInt(k.String(), 10, 64); err == nil && tracker.GetVariable(id) == nil {
+				drop = append(drop, k)
+			}
+		})
+		for _, k := range drop {
+			variables.RawSet(k, lua.LNil)
+		}
+	}
+	return before, after
+}
@@ -0,0 +1,293 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Presenting Plain Data)
+package lua
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// WatchCounter is implemented by variable stores that know how many frontend
+// watches a variable has, so lazy presenters can tell whether their parent is watched.
+type WatchCounter interface {
+	WatcherCount(sessionID string, varID int64) int
+}
+
+// presentEntry is one field path of a session:present spec.
+type presentEntry struct {
+	typ      string // Presenter type (prototype name) for the field's table
+	itemType string // Presenter type for each element of an array field
+	lazy     bool   // Wait for the parent variable's first watch
+}
+
+// presentNode is the presenter for one field path, created or waiting to be.
+type presentNode struct {
+	entry presentEntry
+	obj   *lua.LTable // The presented table, nil while pending
+	varID int64       // 0 while pending
+}
+
+// presentation is the presenter tree session:present built for one data table.
+type presentation struct {
+	root   *lua.LTable
+	rootID int64
+	nodes  map[string]*presentNode // field path -> presenter, "" excluded
+}
+
+// addPresentMethods adds session:present(data, spec) to the session table.
+func (r *LuaSession) addPresentMethods(session *lua.LTable) {
+	r.setAPI(session, "session", "present", r.State.NewFunction(func(L *lua.LState) int {
+		data := L.CheckTable(2)
+		spec := L.CheckTable(3)
+		if err := r.present(data, spec); err != nil {
+			L.RaiseError("present: %s", err.Error())
+			return 0
+		}
+		L.Push(data)
+		return 1
+	}))
+}
+
+// parsePresentSpec reads a spec mapping field paths to a type name or to
+// {type=NAME, itemType=NAME, lazy=BOOL}. The empty path names the root.
+func (r *LuaSession) parsePresentSpec(spec *lua.LTable) (map[string]presentEntry, error) {
+	L := r.State
+	entries := make(map[string]presentEntry)
+	var err error
+	spec.ForEach(func(k, v lua.LValue) {
+		path, ok := k.(lua.LString)
+		if !ok || err != nil {
+			if err == nil {
+				err = fmt.Errorf("spec keys must be field paths, got %s", k.Type())
+			}
+			return
+		}
+		var entry presentEntry
+		switch val := v.(type) {
+		case lua.LString:
+			entry.typ = string(val)
+		case *lua.LTable:
+			entry.typ = lua.LVAsString(L.GetField(val, "type"))
+			entry.itemType = lua.LVAsString(L.GetField(val, "itemType"))
+			entry.lazy = lua.LVAsBool(L.GetField(val, "lazy"))
+		default:
+			err = fmt.Errorf("%q: want a type name or options table, got %s", string(path), v.Type())
+			return
+		}
+		for _, name := range []string{entry.typ, entry.itemType} {
+			if name != "" && r.prototypeRegistry[name] == nil {
+				err = fmt.Errorf("%q: unknown presenter type %q", string(path), name)
+				return
+			}
+		}
+		entries[string(path)] = entry
+	})
+	return entries, err
+}
+
+// present builds data's presenter tree, or re-diffs it against a changed spec:
+// presenters whose path, table, and parent are unchanged keep their variables,
+// changed types are applied in place, and removed paths are destroyed.
+func (r *LuaSession) present(data, spec *lua.LTable) error {
+	entries, err := r.parsePresentSpec(spec)
+	if err != nil {
+		return err
+	}
+	tracker := r.variableStore.GetTracker(r.ID)
+	if tracker == nil {
+		return fmt.Errorf("session %s tracker not found", r.ID)
+	}
+	p := r.presentations[data]
+	if p == nil {
+		p = &presentation{root: data, nodes: make(map[string]*presentNode)}
+	}
+	if v := tracker.GetVariable(p.rootID); v == nil || v.Value != data {
+		p.rootID = 0
+		for _, v := range tracker.RootVariables() {
+			if v.Value == data {
+				p.rootID = v.ID
+				break
+			}
+		}
+		if p.rootID == 0 {
+			return fmt.Errorf("data must be a root variable's value, e.g. the app object")
+		}
+	}
+	rootEntry := entries[""]
+	delete(entries, "")
+	r.instantiatePresenter(data, rootEntry)
+	if rootEntry.typ != "" {
+		tracker.GetVariable(p.rootID).SetProperty("type", rootEntry.typ)
+	}
+	if r.presentations == nil {
+		r.presentations = make(map[*lua.LTable]*presentation)
+	}
+	r.presentations[data] = p
+
+	// Removed paths, deepest first
+	paths := slices.Sorted(maps.Keys(p.nodes))
+	for _, path := range slices.Backward(paths) {
+		if _, ok := entries[path]; !ok {
+			r.destroyPresenter(p.nodes[path])
+			delete(p.nodes, path)
+		}
+	}
+
+	// Kept, retyped, and new paths, parents first
+	paths = slices.Sorted(maps.Keys(entries))
+	for _, path := range paths {
+		entry := entries[path]
+		obj, err := r.presentedValue(data, path)
+		if err != nil {
+			return err
+		}
+		node := p.nodes[path]
+		if node == nil {
+			p.nodes[path] = &presentNode{entry: entry}
+			continue
+		}
+		v := tracker.GetVariable(node.varID)
+		if parentID, _ := p.parent(path); node.varID != 0 && (v == nil || node.obj != obj || v.ParentID != parentID) {
+			r.destroyPresenter(node)
+		}
+		if node.varID != 0 && node.entry != entry {
+			r.instantiatePresenter(obj, entry)
+			if entry.typ != "" {
+				v.SetProperty("type", entry.typ)
+			}
+		}
+		node.entry = entry
+	}
+	return r.materialize(p)
+}
+
+// materialize creates every pending presenter whose parent exists and, if the
+// presenter is lazy, is watched. Parents are created before children.
+func (r *LuaSession) materialize(p *presentation) error {
+	paths := slices.Sorted(maps.Keys(p.nodes))
+	for _, path := range paths {
+		node := p.nodes[path]
+		parentID, relPath := p.parent(path)
+		if node.varID != 0 || parentID == 0 || (node.entry.lazy && !r.isWatched(parentID)) {
+			continue
+		}
+		obj, err := r.presentedValue(p.root, path)
+		if err != nil {
+			return err
+		}
+		if obj == nil {
+			continue // Created once the field holds a table and present runs again
+		}
+		r.instantiatePresenter(obj, node.entry)
+		props := map[string]string{"path": relPath}
+		if node.entry.typ != "" {
+			props["type"] = node.entry.typ
+		}
+		r.extractTypeProperty(obj, props)
+		id, err := r.variableStore.CreateVariable(r.ID, parentID, obj, props)
+		if err != nil {
+			return fmt.Errorf("%q: %w", path, err)
+		}
+		node.obj, node.varID = obj, id
+	}
+	return nil
+}
+
+// parent returns the variable of path's nearest presented ancestor, 0 while
+// that ancestor is pending, and path relative to it.
+func (p *presentation) parent(path string) (int64, string) {
+	for i := strings.LastIndexByte(path, '.'); i >= 0; i = strings.LastIndexByte(path[:i], '.') {
+		if node := p.nodes[path[:i]]; node != nil {
+			return node.varID, path[i+1:]
+		}
+	}
+	return p.rootID, path
+}
+
+// owns reports whether varID is one of p's presenter variables.
+func (p *presentation) owns(varID int64) bool {
+	if varID == p.rootID {
+		return true
+	}
+	for _, node := range p.nodes {
+		if node.varID == varID {
+			return true
+		}
+	}
+	return false
+}
+
+// presentedValue returns the table at a dotted field path below data, or nil
+// when a field along the way is nil.
+func (r *LuaSession) presentedValue(data *lua.LTable, path string) (*lua.LTable, error) {
+	cur := data
+	for _, field := range strings.Split(path, ".") {
+		switch v := r.State.GetField(cur, field).(type) {
+		case *lua.LTable:
+			cur = v
+		case *lua.LNilType:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%q: %s is a %s, not a table", path, field, v.Type())
+		}
+	}
+	return cur, nil
+}
+
+// instantiatePresenter gives obj its presenter type and each array element its
+// item type, leaving tables that already have the right prototype alone.
+func (r *LuaSession) instantiatePresenter(obj *lua.LTable, entry presentEntry) {
+	if obj == nil {
+		return
+	}
+	r.setPresenterType(obj, entry.typ)
+	if entry.itemType != "" {
+		for i := 1; i <= obj.Len(); i++ {
+			if item, ok := obj.RawGetInt(i).(*lua.LTable); ok {
+				r.setPresenterType(item, entry.itemType)
+			}
+		}
+	}
+}
+
+// setPresenterType makes obj an instance of the named prototype.
+func (r *LuaSession) setPresenterType(obj *lua.LTable, name string) {
+	info := r.prototypeRegistry[name]
+	if info == nil || r.State.GetMetatable(obj) == info.prototype {
+		return
+	}
+	r.createInstance(info.prototype, obj)
+}
+
+// destroyPresenter destroys node's variable (and its descendants) and marks it pending.
+func (r *LuaSession) destroyPresenter(node *presentNode) {
+	if node.varID != 0 {
+		if err := r.variableStore.Destroy(node.varID); err != nil {
+			r.Log(2, "LuaRuntime: present could not destroy variable %d: %v", node.varID, err)
+		}
+	}
+	node.obj, node.varID = nil, 0
+}
+
+// isWatched reports whether a frontend watches varID.
+func (r *LuaSession) isWatched(varID int64) bool {
+	counter, ok := r.variableStore.(WatchCounter)
+	return ok && counter.WatcherCount(r.ID, varID) > 0
+}
+
+// HandleFirstWatch creates the lazy presenters waiting for varID to be watched.
+// The backend calls it on a variable's first watch, on the session executor.
+func (r *LuaSession) HandleFirstWatch(varID int64) {
+	for _, p := range r.presentations {
+		if !p.owns(varID) {
+			continue
+		}
+		if err := r.materialize(p); err != nil {
+			r.Log(0, "LuaRuntime: lazy presenter for variable %d: %v", varID, err)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Priority Rules), libraries.md (Priority Rules)
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// SetGlobalPriorityRules sets the site-wide priority rules (types.json).
+// Rules declared with ui.priority in this session win over them.
+func (r *LuaSession) SetGlobalPriorityRules(rules *protocol.PriorityRules) {
+	r.globalPriorities = rules
+}
+
+// addPriorityAPI adds ui.priority{property=NAME | type=TYPE, priority="high"|"med"|"low"}.
+// Rules apply to this session only.
+func (r *LuaSession) addPriorityAPI(uiMod *lua.LTable) {
+	r.setAPI(uiMod, "ui", "priority", r.State.NewFunction(func(L *lua.LState) int {
+		spec := L.CheckTable(1)
+		property := lua.LVAsString(L.GetField(spec, "property"))
+		typ := lua.LVAsString(L.GetField(spec, "type"))
+		priority, err := protocol.ParsePriority(lua.LVAsString(L.GetField(spec, "priority")))
+		if err != nil {
+			L.RaiseError("ui.priority: %s", err.Error())
+			return 0
+		}
+		if property == "" && typ == "" {
+			L.RaiseError("ui.priority: property or type required")
+			return 0
+		}
+		if property != "" {
+			r.priorities.SetProperty(property, priority)
+		}
+		if typ != "" {
+			r.priorities.SetType(typ, priority)
+		}
+		return 0
+	}))
+}
+
+// notePrioritySuffixes records which properties a frontend set with an explicit
+// priority suffix, so rules do not override them (including :med).
+func (r *LuaSession) notePrioritySuffixes(varID int64, properties map[string]string) {
+	for name := range properties {
+		baseName, _ := protocol.ParsePrioritySuffix(name)
+		if baseName == name {
+			delete(r.suffixed[varID], name)
+			continue
+		}
+		if r.suffixed == nil {
+			r.suffixed = make(map[int64]map[string]bool)
+		}
+		if r.suffixed[varID] == nil {
+			r.suffixed[varID] = make(map[string]bool)
+		}
+		r.suffixed[varID][baseName] = true
+	}
+}
+
+// trackerPriority converts a protocol priority to the change tracker's scale.
+func trackerPriority(priority protocol.Priority) changetracker.Priority {
+	switch priority {
+	case protocol.PriorityHigh:
+		return changetracker.PriorityHigh
+	case protocol.PriorityLow:
+		return changetracker.PriorityLow
+	}
+	return changetracker.PriorityMedium
+}
+
+// applyPriorityRules regroups changes by the session and global priority rules.
+// Values and properties the tracker already holds at high or low priority, or
+// that were set with an explicit suffix, keep their priority. The result is
+// ordered high, medium, low, preserving the tracker's order within each level.
+func (r *LuaSession) applyPriorityRules(tracker *changetracker.Tracker, changes []changetracker.Change) []changetracker.Change {
+	if r.priorities.Empty() && r.globalPriorities.Empty() {
+		return changes
+	}
+	levels := [3][]changetracker.Change{} // high, medium, low
+	level := func(p changetracker.Priority) int { return 1 - int(p) }
+	for _, change := range changes {
+		v := tracker.GetVariable(change.VariableID)
+		if v == nil || change.Priority != changetracker.PriorityMedium {
+			levels[level(change.Priority)] = append(levels[level(change.Priority)], change)
+			continue
+		}
+		typ := v.Properties["type"]
+		var split [3]changetracker.Change
+		if change.ValueChanged {
+			p := changetracker.PriorityMedium
+			if v.Properties["priority"] == "" {
+				p = trackerPriority(protocol.ResolveTypePriority(typ, r.priorities, r.globalPriorities))
+			}
+			split[level(p)].ValueChanged = true
+		}
+		for _, prop := range change.PropertiesChanged {
+			p := changetracker.PriorityMedium
+			if !r.suffixed[change.VariableID][prop] {
+				p = trackerPriority(protocol.ResolvePropertyPriority(prop, typ, r.priorities, r.globalPriorities))
+			}
+			split[level(p)].PropertiesChanged = append(split[level(p)].PropertiesChanged, prop)
+		}
+		for i, part := range split {
+			if part.ValueChanged || len(part.PropertiesChanged) > 0 {
+				part.VariableID = change.VariableID
+				part.Priority = changetracker.Priority(1 - i)
+				levels[i] = append(levels[i], part)
+			}
+		}
+	}
+	return append(append(levels[0], levels[1]...), levels[2]...)
+}
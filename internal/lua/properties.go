@@ -0,0 +1,71 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Variable Protocol Messages)
+package lua
+
+import (
+	"slices"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// setProperty sets a variable property from the frontend. The tracker's
+// SetProperty deletes a property set to "", so empty values are stored directly.
+func setProperty(tracker *changetracker.Tracker, v *changetracker.Variable, name, value string) {
+	if value != "" {
+		v.SetProperty(name, value)
+		return
+	}
+	baseName, priority := protocol.ParsePrioritySuffix(name)
+	old, ok := v.Properties[baseName]
+	if ok && old == "" && v.PropertyPriorities[baseName] == trackerPriority(priority) {
+		return
+	}
+	v.Properties[baseName] = ""
+	v.PropertyPriorities[baseName] = trackerPriority(priority)
+	tracker.RecordPropertyChange(v.ID, baseName)
+}
+
+// removeProperty deletes a variable property and records the removal so
+// change detection reports it to watchers.
+func removeProperty(tracker *changetracker.Tracker, v *changetracker.Variable, name string) {
+	baseName, _ := protocol.ParsePrioritySuffix(name)
+	old, ok := v.Properties[baseName]
+	switch {
+	case !ok:
+		return
+	case old != "":
+		v.SetProperty(baseName, "") // Lets the tracker reset special properties
+	default:
+		delete(v.Properties, baseName)
+		delete(v.PropertyPriorities, baseName)
+		tracker.RecordPropertyChange(v.ID, baseName)
+	}
+}
+
+// AddVariableDiag keeps a diagnostic for a variable. Unlike the tracker's Diags,
+// which each recompute clears, it lasts until the variable ID is created again.
+func (r *LuaSession) AddVariableDiag(varID int64, diag string) {
+	r.diagsMu.Lock()
+	defer r.diagsMu.Unlock()
+	if slices.Contains(r.varDiags[varID], diag) {
+		return
+	}
+	if r.varDiags == nil {
+		r.varDiags = make(map[int64][]string)
+	}
+	r.varDiags[varID] = append(r.varDiags[varID], diag)
+}
+
+// VariableDiags returns the diagnostics kept for a variable.
+func (r *LuaSession) VariableDiags(varID int64) []string {
+	r.diagsMu.Lock()
+	defer r.diagsMu.Unlock()
+	return slices.Clone(r.varDiags[varID])
+}
+
+func (r *LuaSession) clearVariableDiags(varID int64) {
+	r.diagsMu.Lock()
+	defer r.diagsMu.Unlock()
+	delete(r.varDiags, varID)
+}
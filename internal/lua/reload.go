@@ -0,0 +1,59 @@
+// CRC: crc-LuaSession.md
+// Spec: main.md (Hot-Loading System)
+package lua
+
+import (
+	"fmt"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// ReloadSessionDirect re-runs main.lua with session.reloading set, then calls
+// session:onReload() if main.lua defines it. The app variable is kept, so
+// main.lua's usual guard (if not session:getApp()) keeps its state. If main.lua
+// fails, the app variable, load tracking and presenter types are left as they
+// were, so the session keeps running its previous code; Lua globals main.lua
+// set before failing stay set. Running it again with unchanged code has the
+// same effect as once.
+// MUST only be called from within an execute() context.
+func (r *LuaSession) ReloadSessionDirect() error {
+	appVariableID, appObject := r.appVariableID, r.appObject
+	loaded := map[lua.LValue]lua.LValue{}
+	r.loadedModules.ForEach(func(key, value lua.LValue) {
+		loaded[key] = value
+	})
+
+	err := r.reloadStaged("main.lua", func() error {
+		if err := r.loadMainLua(); err != nil {
+			return err
+		}
+		r.processMutationQueueDirect()
+		return nil
+	})
+	if err != nil {
+		r.appVariableID, r.appObject = appVariableID, appObject
+		for key, value := range loaded {
+			r.setLoaded(key.String(), value)
+		}
+		return err
+	}
+	return r.OnReloadDirect()
+}
+
+// OnReloadDirect calls session:onReload() if main.lua defined it, so an app
+// can refresh state that its reloaded code computes differently.
+// MUST only be called from within an execute() context.
+func (r *LuaSession) OnReloadDirect() error {
+	if r.sessionTable == nil {
+		return nil
+	}
+	L := r.State
+	hook, ok := L.GetField(r.sessionTable, "onReload").(*lua.LFunction)
+	if !ok {
+		return nil
+	}
+	if err := L.CallByParam(lua.P{Fn: hook, NRet: 0, Protect: true}, r.sessionTable); err != nil {
+		return fmt.Errorf("session:onReload failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package lua
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// BenchmarkRequireBundled measures require() of a 50-module bundled app:
+// "uncached" reads every module from the ZIP and rebuilds the bundle index
+// each time, the previous behavior; "cached" uses the bundle cache.
+func BenchmarkRequireBundled(b *testing.B) {
+	const modules = 50
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for i := range modules {
+		w, _ := zw.Create(fmt.Sprintf("lua/mod%d.lua", i))
+		fmt.Fprintf(w, "local M = {}\n%sreturn M\n", strings.Repeat(fmt.Sprintf("function M.f%d(x) return x + %d end\n", i, i), 3))
+	}
+	for i := range 500 { // The rest of the site
+		w, _ := zw.Create(fmt.Sprintf("html/asset%d.js", i))
+		w.Write(bytes.Repeat([]byte("x"), 1024))
+	}
+	zw.Close()
+	reader, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	bundle.SetFallback(reader)
+	defer bundle.SetFallback(nil)
+	defer bundle.SetCacheSize(bundle.DefaultCacheSize)
+
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = b.TempDir() // Nothing on disk, so modules come from the bundle
+	rt, err := NewRuntime(cfg, cfg.Server.Dir, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rt.Shutdown()
+	code := fmt.Sprintf(`for i = 0, %d do
+		package.loaded["mod" .. i] = nil
+		package.loaded["mod" .. i .. ".lua"] = nil
+		require("mod" .. i)
+	end`, modules-1)
+
+	for _, bench := range []struct {
+		name      string
+		cacheSize int64
+	}{
+		{"uncached", 0},
+		{"cached", bundle.DefaultCacheSize},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			bundle.SetCacheSize(bench.cacheSize)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if bench.cacheSize == 0 {
+					bundle.Invalidate()
+				}
+				if err := rt.State.DoString(code); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// TestRequireSubdirectories verifies require finds dotted module names in
+// subdirectories, and init.lua packages, from the lua directory and from the
+// bundle, follows additions to package.path, and names the files it tried
+func TestRequireSubdirectories(t *testing.T) {
+	check := func(t *testing.T, rt *LuaSession, code string) {
+		t.Helper()
+		if err := rt.State.DoString(code); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("filesystem", func(t *testing.T) {
+		cfg := config.DefaultConfig()
+		cfg.Server.Dir = t.TempDir()
+		luaDir := filepath.Join(cfg.Server.Dir, "lua")
+		for name, code := range map[string]string{
+			"lib/utils.lua":     `return {name = "utils"}`,
+			"lib/pkg/init.lua":  `return {name = "pkg"}`,
+			"vendor/extra.lua":  `return {name = "extra"}`,
+			"lib/deep/more.lua": `return {name = require("lib.utils").name .. "+more"}`,
+		} {
+			path := filepath.Join(luaDir, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			os.WriteFile(path, []byte(code), 0644)
+		}
+		rt, err := NewRuntime(cfg, luaDir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rt.Shutdown()
+		check(t, rt, `
+			assert(require("lib.utils").name == "utils")
+			assert(require("lib.pkg").name == "pkg")
+			assert(require("lib.deep.more").name == "utils+more")
+			assert(not pcall(require, "extra"))
+			package.path = package.path .. ";vendor/?.lua"
+			assert(require("extra").name == "extra")
+			local ok, err = pcall(require, "lib.missing")
+			assert(not ok and string.find(err, "lib/missing/init.lua", 1, true), err)
+		`)
+	})
+
+	t.Run("bundle", func(t *testing.T) {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		for name, code := range map[string]string{
+			"lua/lib/utils.lua":    `return {name = "bundled utils"}`,
+			"lua/lib/pkg/init.lua": `return {name = "bundled pkg"}`,
+		} {
+			w, _ := zw.Create(name)
+			w.Write([]byte(code))
+		}
+		zw.Close()
+		reader, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		bundle.SetFallback(reader)
+		defer bundle.SetFallback(nil)
+
+		cfg := config.DefaultConfig()
+		cfg.Server.Dir = t.TempDir() // Nothing on disk, so modules come from the bundle
+		rt, err := NewRuntime(cfg, cfg.Server.Dir, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rt.Shutdown()
+		check(t, rt, `
+			assert(require("lib.utils").name == "bundled utils")
+			assert(require("lib.pkg").name == "bundled pkg")
+		`)
+	})
+}
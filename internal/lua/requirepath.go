@@ -0,0 +1,66 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Lua Modules)
+package lua
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+// DefaultPackagePath is package.path's initial value: ";"-separated file
+// templates where "?" stands for the module name with dots as slashes.
+// Relative templates are looked up like RequireLuaFile's files: in the lua
+// directory, the site directory, then the bundle's lua/.
+const DefaultPackagePath = "?.lua;?/init.lua"
+
+// ModulePaths returns the files packagePath names for a module, in order.
+func ModulePaths(packagePath, modName string) []string {
+	modPath := strings.ReplaceAll(modName, ".", "/")
+	var paths []string
+	for _, template := range strings.Split(packagePath, ";") {
+		if template = strings.TrimSpace(template); template != "" {
+			paths = append(paths, filepath.FromSlash(strings.ReplaceAll(template, "?", modPath)))
+		}
+	}
+	return paths
+}
+
+// findModule returns the first file package.path names for a module that
+// exists, or "" and the files it tried.
+func (r *LuaSession) findModule(modName string) (string, []string) {
+	packagePath := DefaultPackagePath
+	if pkg, ok := r.State.GetGlobal("package").(*lua.LTable); ok {
+		if path, ok := r.State.GetField(pkg, "path").(lua.LString); ok {
+			packagePath = string(path)
+		}
+	}
+	paths := ModulePaths(packagePath, modName)
+	for _, filename := range paths {
+		if r.moduleExists(filename) {
+			return filename, nil
+		}
+	}
+	return "", paths
+}
+
+// moduleExists reports whether DirectRequireLuaFile would find filename.
+func (r *LuaSession) moduleExists(filename string) bool {
+	candidates := []string{filename}
+	if !filepath.IsAbs(filename) {
+		candidates = []string{filepath.Join(r.luaDir, filename), filepath.Join(r.config.Server.Dir, filename)}
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); (err == nil && !info.IsDir()) || r.sources.Has(path) {
+			return true
+		}
+	}
+	if filepath.IsAbs(filename) || (r.config.Server.Dir != "" && r.config.Server.NoBundleFallback) {
+		return false
+	}
+	_, err := bundle.ReadFile("lua/" + filepath.ToSlash(filename))
+	return err == nil
+}
@@ -6,6 +6,7 @@ package lua
 import (
 	"fmt"
 	"reflect"
+	"strconv"
 
 	lua "github.com/yuin/gopher-lua"
 	changetracker "github.com/zot/change-tracker"
@@ -27,6 +28,9 @@ func (r *LuaResolver) Get(obj any, pathElement any) (any, error) {
 		if prop, ok := pathElement.(string); ok && prop == "items" {
 			switch prop {
 			case "items":
+				if window, ok := r.window(vl); ok {
+					return window, nil
+				}
 				vl.mu.RLock()
 				defer vl.mu.RUnlock()
 				return r.luaValueToGo(vl.Items)
@@ -35,6 +39,15 @@ func (r *LuaResolver) Get(obj any, pathElement any) (any, error) {
 		return nil, fmt.Errorf("Unknown ViewList property: %v", pathElement)
 	}
 
+	// Handle a windowed ViewList's items, indexed by absolute position
+	if w, ok := obj.(*ViewListWindow); ok {
+		index, ok := pathElement.(int)
+		if !ok {
+			return nil, fmt.Errorf("ViewList window resolution only supports number indexes")
+		}
+		return w.item(index)
+	}
+
 	slice := reflect.ValueOf(obj)
 	// Handle []*ViewListItem slice
 	if slice.Kind() == reflect.Array || slice.Kind() == reflect.Slice {
@@ -80,7 +93,7 @@ func (r *LuaResolver) Get(obj any, pathElement any) (any, error) {
 		if isMethodCall(pe) {
 			return r.callMethod(tbl, pe)
 		}
-		val = r.Session.State.GetField(tbl, pe)
+		val = r.Session.State.GetField(tbl, r.key(tbl, pe))
 	case int:
 		val = r.Session.State.RawGetInt(tbl, pe+1) // Lua is 1-indexed
 	default:
@@ -96,6 +109,27 @@ func isMethodCall(s string) bool {
 		len(s) > 3 && s[len(s)-3:] == "(_)"
 }
 
+// window returns the window of a ViewList's items the variable being computed
+// asks for with its viewport properties, and reports the window's start and the
+// list's length on the variable.
+func (r *LuaResolver) window(vl *ViewList) (*ViewListWindow, bool) {
+	tracker := r.Session.variableStore.GetTracker(r.Session.ID)
+	if tracker == nil || tracker.ComputingVar == nil {
+		return nil, false
+	}
+	v := tracker.ComputingVar
+	window, total, ok := vl.Window(v.Properties)
+	if !ok {
+		return nil, false
+	}
+	for name, n := range map[string]int{WindowStartProp: window.Start, WindowTotalProp: total} {
+		if value := strconv.Itoa(n); v.Properties[name] != value {
+			v.SetProperty(name, value)
+		}
+	}
+	return window, true
+}
+
 // callMethod calls a method on a Lua table and returns the result.
 // Supports: method() - no args, method(_) - with value arg
 func (r *LuaResolver) callMethod(tbl *lua.LTable, methodCall string) (any, error) {
@@ -113,7 +147,7 @@ func (r *LuaResolver) callMethod(tbl *lua.LTable, methodCall string) (any, error
 	}
 
 	// Get the method from the table (checks metatable too)
-	method := r.Session.State.GetField(tbl, methodName)
+	method := r.Session.State.GetField(tbl, r.key(tbl, methodName))
 	if method == lua.LNil {
 		return nil, fmt.Errorf("method %s not found", methodName)
 	}
@@ -134,7 +168,9 @@ func (r *LuaResolver) callMethod(tbl *lua.LTable, methodCall string) (any, error
 	}
 
 	if err := r.Session.State.PCall(nargs, 1, nil); err != nil {
-		return nil, fmt.Errorf("method call failed: %w", err)
+		err = fmt.Errorf("method call failed: %w", err)
+		r.Session.logComputeError(err)
+		return nil, err
 	}
 
 	// Get the result
@@ -153,7 +189,7 @@ func (r *LuaResolver) Call(obj any, methodName string) (any, error) {
 	}
 
 	// Get the method from the table (checks metatable too)
-	method := r.Session.State.GetField(tbl, methodName)
+	method := r.Session.State.GetField(tbl, r.key(tbl, methodName))
 	if method == lua.LNil {
 		return nil, fmt.Errorf("method %s not found", methodName)
 	}
@@ -168,7 +204,9 @@ func (r *LuaResolver) Call(obj any, methodName string) (any, error) {
 	r.Session.State.Push(tbl) // self
 
 	if err := r.Session.State.PCall(1, 1, nil); err != nil {
-		return nil, fmt.Errorf("method call failed: %w", err)
+		err = fmt.Errorf("method call failed: %w", err)
+		r.Session.logComputeError(err)
+		return nil, err
 	}
 
 	// Get the result
@@ -187,7 +225,7 @@ func (r *LuaResolver) CallWith(obj any, methodName string, value any) error {
 	}
 
 	// Get the method from the table (checks metatable too)
-	method := r.Session.State.GetField(tbl, methodName)
+	method := r.Session.State.GetField(tbl, r.key(tbl, methodName))
 	if method == lua.LNil {
 		return fmt.Errorf("method %s not found", methodName)
 	}
@@ -220,7 +258,7 @@ func (r *LuaResolver) Set(obj any, pathElement any, value any) error {
 
 	switch pe := pathElement.(type) {
 	case string:
-		r.Session.State.SetField(tbl, pe, lval)
+		r.Session.State.SetField(tbl, r.key(tbl, pe), lval)
 	case int:
 		r.Session.State.RawSetInt(tbl, pe+1, lval) // Lua is 1-indexed
 	default:
@@ -476,11 +514,10 @@ func (r *LuaResolver) createLuaVariableWrapper(v *changetracker.Variable) *lua.L
 	// getProperty(name) - returns a property value
 	r.Session.State.SetField(wrapper, "getProperty", r.Session.State.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(1)
-		prop := v.GetProperty(name)
-		if prop == "" {
-			L.Push(lua.LNil)
-		} else {
+		if prop, ok := v.Properties[name]; ok {
 			L.Push(lua.LString(prop))
+		} else {
+			L.Push(lua.LNil)
 		}
 		return 1
 	}))
@@ -508,6 +545,9 @@ func (r *LuaResolver) goToLua(value any) lua.LValue {
 // ConvertToValueJSON implements the Resolver interface for Lua values.
 // Handles *lua.LTable specially: arrays become []any, objects become ObjectRef.
 func (r *LuaResolver) ConvertToValueJSON(tracker *changetracker.Tracker, value any) any {
+	if w, ok := value.(*ViewListWindow); ok {
+		return w.Items
+	}
 	tbl, ok := value.(*lua.LTable)
 	if !ok {
 		// Not a Lua table - return unchanged for tracker to handle
@@ -529,6 +569,11 @@ func (r *LuaResolver) ConvertToValueJSON(tracker *changetracker.Tracker, value a
 		result := make([]any, length)
 		for i := 1; i <= length; i++ {
 			elem := r.Session.State.RawGetInt(tbl, i)
+			if et, ok := elem.(*lua.LTable); ok && r.Session.isArray(et) && r.Session.arrayCycle(et) {
+				r.Session.convertIssue = "table contains itself"
+				result[i-1] = cycleObject
+				continue
+			}
 			result[i-1] = r.luaElementToGo(elem)
 		}
 		return result
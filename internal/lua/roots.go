@@ -0,0 +1,101 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Named Roots)
+package lua
+
+import (
+	"fmt"
+	"maps"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// AppRoot is the name of the root createAppVariable creates, always variable 1.
+const AppRoot = "app"
+
+// NamedRootStore is implemented by variable stores that can create root
+// variables besides variable 1. IDs must not collide with frontend-vended ones.
+type NamedRootStore interface {
+	CreateRootVariable(sessionID string, luaObject *lua.LTable, properties map[string]string) (int64, error)
+}
+
+// createRoot creates a root variable registered under name. The app root is
+// variable 1; other roots come from the store's NamedRootStore. The first root
+// created is the meta root, which carries viewdefs and flags for the session,
+// unless a backend created variable 1 first.
+func (r *LuaSession) createRoot(session *lua.LTable, vendedID, name string, luaObject *lua.LTable, props map[string]string) (int64, error) {
+	r.mu.RLock()
+	_, exists := r.roots[name]
+	r.mu.RUnlock()
+	if exists {
+		return 0, fmt.Errorf("root %q already exists", name)
+	}
+	// The meta root is taken once it exists, by an earlier root or a backend's variable 1
+	tracker := r.variableStore.GetTracker(vendedID)
+	meta := tracker == nil || tracker.GetVariable(r.metaRootID()) == nil
+
+	r.extractTypeProperty(luaObject, props)
+	if flags := r.flagsJSON(); meta && flags != "" {
+		props["flags"] = flags
+	}
+	var id int64
+	var err error
+	if store, ok := r.variableStore.(NamedRootStore); ok && name != AppRoot {
+		id, err = store.CreateRootVariable(vendedID, luaObject, props)
+	} else {
+		id, err = r.variableStore.CreateVariable(vendedID, 0, luaObject, props)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	if r.roots == nil {
+		r.roots = make(map[string]int64)
+	}
+	r.roots[name] = id
+	if meta {
+		r.metaRoot = id
+	}
+	r.mu.Unlock()
+
+	// Track in session's _objectToId
+	if objectToId := r.State.GetField(session, "_objectToId"); objectToId != lua.LNil {
+		r.State.SetField(objectToId.(*lua.LTable), "", lua.LNumber(id)) // weak key
+		r.State.RawSet(objectToId.(*lua.LTable), luaObject, lua.LNumber(id))
+	}
+	r.Log(2, "LuaRuntime: created root %q as variable %d for session %s", name, id, vendedID)
+	return id, nil
+}
+
+// Roots returns the session's named roots (name -> variable ID) and the meta root's ID.
+func (r *LuaSession) Roots() (map[string]int64, int64) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	roots := make(map[string]int64, len(r.roots))
+	maps.Copy(roots, r.roots)
+	return roots, r.metaRoot
+}
+
+// metaRootID returns the root carrying viewdefs and flags. Until Lua creates
+// a root it is variable 1, which a backend may create instead.
+func (r *LuaSession) metaRootID() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.metaRoot == 0 {
+		return 1
+	}
+	return r.metaRoot
+}
+
+// luaProps converts an optional Lua properties table to a string map.
+func luaProps(propsTable *lua.LTable) map[string]string {
+	props := make(map[string]string)
+	if propsTable != nil {
+		propsTable.ForEach(func(k, v lua.LValue) {
+			if ks, ok := k.(lua.LString); ok {
+				props[string(ks)] = lua.LVAsString(v)
+			}
+		})
+	}
+	return props
+}
@@ -8,6 +8,7 @@
 package lua
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -16,6 +17,7 @@ import (
 	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"weak"
 
@@ -23,6 +25,7 @@ import (
 	changetracker "github.com/zot/change-tracker"
 	"github.com/zot/ui-engine/internal/bundle"
 	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
 	"github.com/zot/ui-engine/internal/viewdef"
 )
 
@@ -45,28 +48,65 @@ type LuaSession struct {
 	// Lua VM state and execution
 	State          *lua.LState
 	loadedModules  *lua.LTable // Unified load tracker, keyed by baseDir-relative paths
+	loadedMu       sync.Mutex
+	loadedFiles    map[string]bool // loadedModules' keys, readable off the executor
 	presenterTypes map[string]*PresenterType
+	// Presenter types registered by a running hot reload, applied when it succeeds
+	reloadPresenters map[string]*PresenterType
 	luaDir         string
 	executorChan   chan WorkItem
 	done           chan struct{}
 	config         *config.Config
 	mu             sync.RWMutex
 	batchTriggered bool
+	dirty          atomic.Bool            // Work may have changed variables since the last AfterBatch
+	echoes         map[int64]frontendEcho // Values frontends sent in the current batch
+
+	// Priority rules for unsuffixed properties (see priority.go)
+	priorities       *protocol.PriorityRules   // Declared with ui.priority in this session
+	globalPriorities *protocol.PriorityRules   // Site-wide, from types.json
+	suffixed         map[int64]map[string]bool // Properties a frontend set with an explicit suffix
+
+	// Diagnostics kept across recomputes, e.g. strict mode warnings (see properties.go)
+	diagsMu  sync.Mutex
+	varDiags map[int64][]string
+	errors   *errorDedup // Collapses repeated variable errors in the log (see logdedup.go)
+	// convertIssue is why the last Value JSON conversion was truncated (see convert.go)
+	convertIssue string
+
+	// Named root variables (see roots.go)
+	roots    map[string]int64 // name -> variable ID, "app" is variable 1
+	metaRoot int64            // Root carrying viewdefs and flags, the first root created
+
+	// Presenter trees built by session:present (see present.go)
+	presentations map[*lua.LTable]*presentation // data table -> presenter tree
+
+	// Values declared with session:computed, by variable ID (see computed.go)
+	computed map[int64]*computedValue
+
+	// Keyboard shortcuts declared with session:shortcut, by key combo (see focus.go)
+	shortcuts map[string]Shortcut
 
 	// Variable management
 	variableStore   VariableStore
 	mainLuaCode     string
+	sources         *SourceCache // Shared Lua source cache (nil reads files directly)
 	wrapperRegistry *WrapperRegistry
 	viewdefManager  *viewdef.ViewdefManager
 
 	// Session identity and state
-	ID              string      // Vended session ID (e.g., "1", "2", "3")
-	sessionTable    *lua.LTable // The session object exposed to Lua
-	appVariableID   int64       // Variable 1 for this session (set by Lua code)
-	appObject       *lua.LTable // Reference to the app Lua object
-	McpState        *lua.LTable // Logical state root for MCP (defaults to appObject)
-	McpStateID      int64       // Variable ID of mcpState (if tracked)
-	mutationVersion int64       // Hot-loading mutation version for schema migrations (deprecated)
+	ID              string         // Vended session ID (e.g., "1", "2", "3")
+	sessionTable    *lua.LTable    // The session object exposed to Lua
+	appVariableID   int64          // Variable 1 for this session (set by Lua code)
+	appObject       *lua.LTable    // Reference to the app Lua object
+	McpState        *lua.LTable    // Logical state root for MCP (defaults to appObject)
+	McpStateID      int64          // Variable ID of mcpState (if tracked)
+	mutationVersion int64          // Hot-loading mutation version for schema migrations (deprecated)
+	flags           map[string]any // Effective feature flags (session.flags, meta root flags property)
+	group           string         // Session group name (session.group), "" if none
+
+	// Session groups (ui.groupBroadcast)
+	groupBroadcaster GroupBroadcaster
 
 	// Prototype management for hot-loading
 	prototypeRegistry map[string]*prototypeInfo      // name -> stored init copy for change detection
@@ -82,6 +122,7 @@ type LuaSession struct {
 	// Session timers (setImmediate/setTimeout/setInterval)
 	// Seq: seq-session-timer.md
 	onDefer         func(fn func() (interface{}, error)) // callback to Server.ExecuteInSessionAsync
+	onChange        ChangeScheduler                      // runs property watchers, then change detection
 	timerRegistry   map[int64]*timerEntry                // handle -> timer entry
 	nextTimerHandle int64                                // sequential counter for handle allocation
 }
@@ -112,10 +153,13 @@ type timerEntry struct {
 }
 
 // PresenterType represents a Lua-defined presenter type.
+// Instances share Metatable, so re-registering the name switches them to the new Table.
 type PresenterType struct {
-	Name    string
-	Methods map[string]*lua.LFunction
-	Table   *lua.LTable
+	Name      string
+	Methods   map[string]*lua.LFunction
+	Table     *lua.LTable
+	Metatable *lua.LTable
+	global    bool // Auto-discovered from a global table of the same name
 }
 
 // VariableStore interface for session operations.
@@ -137,14 +181,21 @@ type VariableStore interface {
 	GetChanges(sessionID string) []changetracker.Change
 }
 
+// EncodedValueCache is implemented by variable stores that keep the encoded JSON of
+// pooled values, so AfterBatch can send them without re-marshaling.
+type EncodedValueCache interface {
+	EncodedValue(sessionID string, varID int64) (json.RawMessage, bool)
+}
+
 // NewRuntime creates a new LuaSession with executor goroutine.
 func NewRuntime(cfg *config.Config, luaDir string, vdm *viewdef.ViewdefManager) (*LuaSession, error) {
-	L := lua.NewState()
+	L := lua.NewState(stateOptions(cfg)...)
 
 	s := &LuaSession{
 		config:            cfg,
 		State:             L,
 		loadedModules:     L.NewTable(), // Unified load tracker, keyed by baseDir-relative paths
+		loadedFiles:       make(map[string]bool),
 		presenterTypes:    make(map[string]*PresenterType),
 		luaDir:            luaDir,
 		executorChan:      make(chan WorkItem, 100),
@@ -155,6 +206,13 @@ func NewRuntime(cfg *config.Config, luaDir string, vdm *viewdef.ViewdefManager)
 		modules:           make(map[string]*Module),
 		moduleDirectories: make(map[string][]*Module),
 	}
+	s.dirty.Store(true) // The first AfterBatch sends the initial state
+	s.priorities = protocol.NewPriorityRules()
+	var window time.Duration
+	if cfg != nil {
+		window = time.Duration(cfg.Logging.ErrorWindow)
+	}
+	s.errors = newErrorDedup(window)
 
 	// Load standard libraries
 	lua.OpenBase(L)
@@ -229,7 +287,7 @@ func (r *LuaSession) registerDiagGlobal() {
 
 // Log logs a message via the config.
 func (r *LuaSession) Log(level int, format string, args ...interface{}) {
-	r.config.Log(level, format, args...)
+	r.config.Logger(config.LogLua).Log(level, format, args...)
 }
 
 // SetVariableStore sets the variable store for session operations.
@@ -264,6 +322,11 @@ func (r *LuaSession) SetMainLuaCode(code string) {
 	r.mainLuaCode = code
 }
 
+// SetSourceCache sets the cache that serves Lua files while the lua directory is unavailable.
+func (r *LuaSession) SetSourceCache(sources *SourceCache) {
+	r.sources = sources
+}
+
 // CreateLuaSession initializes this LuaSession for a frontend session.
 // vendedID is the compact session ID (e.g., "1", "2") for backend communication.
 // Loads and executes main.lua with a session global.
@@ -314,17 +377,17 @@ func (r *LuaSession) loadMainLua() error {
 	// Try cached bundle code first
 	if r.mainLuaCode != "" {
 		// Mark as loaded for hot-reload tracking
-		r.State.SetField(r.loadedModules, "main.lua", lua.LTrue)
+		r.setLoaded("main.lua", lua.LTrue)
 		if err := r.State.DoString(r.mainLuaCode); err != nil {
-			r.State.SetField(r.loadedModules, "main.lua", lua.LNil) // Unmark on error
+			r.setLoaded("main.lua", lua.LNil) // Unmark on error
 			return fmt.Errorf("failed to execute main.lua: %w", err)
 		}
 		return nil
 	}
 
-	// Try filesystem
+	// Try filesystem (or the source cache while the lua directory is unavailable)
 	mainPath := filepath.Join(r.luaDir, "main.lua")
-	if _, err := os.Stat(mainPath); err == nil {
+	if content, err := r.sources.Read(mainPath); err == nil {
 		// Compute tracking key for hot-reload (resolves symlinks)
 		trackingKey := "main.lua" // fallback
 		if r.config != nil && r.config.Server.Dir != "" {
@@ -333,14 +396,26 @@ func (r *LuaSession) loadMainLua() error {
 			}
 		}
 		// Mark as loaded for hot-reload tracking
-		r.State.SetField(r.loadedModules, trackingKey, lua.LTrue)
-		if err := r.State.DoFile(mainPath); err != nil {
-			r.State.SetField(r.loadedModules, trackingKey, lua.LNil) // Unmark on error
+		r.setLoaded(trackingKey, lua.LTrue)
+		if err := r.doSource(mainPath, content); err != nil {
+			r.setLoaded(trackingKey, lua.LNil) // Unmark on error
 			return fmt.Errorf("failed to load main.lua: %w", err)
 		}
 		return nil
 	}
 
+	// Under --dir, fall back to the bundle's main.lua
+	if r.config != nil && r.config.Server.BundleFallback() {
+		if content, err := bundle.ReadFile("lua/main.lua"); err == nil {
+			r.setLoaded("main.lua", lua.LTrue)
+			if err := r.State.DoString(string(content)); err != nil {
+				r.setLoaded("main.lua", lua.LNil) // Unmark on error
+				return fmt.Errorf("failed to execute bundled main.lua: %w", err)
+			}
+			return nil
+		}
+	}
+
 	// No main.lua found - this is OK for hybrid mode where backend creates variable 1
 	r.Log(2, "LuaRuntime: no main.lua found (hybrid mode or backend-only)")
 	return nil
@@ -508,7 +583,11 @@ func (r *LuaSession) injectSessionFunctions(session *lua.LTable, vendedID string
 
 			var jsonValue json.RawMessage
 			if value != lua.LNil {
-				goValue := LuaToGo(value)
+				goValue, issue := luaToGo(value)
+				if issue != "" {
+					r.AddVariableDiag(id, issue)
+					r.Log(1, "variable %d: %s", id, issue)
+				}
 				if goValue != nil {
 					data, _ := json.Marshal(goValue)
 					jsonValue = data
@@ -547,24 +626,25 @@ func (r *LuaSession) injectSessionFunctions(session *lua.LTable, vendedID string
 
 // addGoSessionMethods adds Go-specific methods that need access to Go structs.
 func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
-	// createAppVariable - creates variable 1 and stores reference in Go struct
-	r.State.SetField(session, "createAppVariable", r.State.NewFunction(func(L *lua.LState) int {
-		luaObject := L.CheckTable(2)
-		propsTable := L.OptTable(3, nil)
+	// flags / flag(name, default) - read-only feature flags
+	r.addFlagMethods(session)
 
-		props := make(map[string]string)
-		if propsTable != nil {
-			propsTable.ForEach(func(k, v lua.LValue) {
-				if ks, ok := k.(lua.LString); ok {
-					props[string(ks)] = lua.LVAsString(v)
-				}
-			})
-		}
+	// present(data, spec) - build a presenter tree from plain data
+	r.addPresentMethods(session)
 
-		r.extractTypeProperty(luaObject, props)
+	// computed(parent, path, deps, fn) - a value recomputed when its dependencies change
+	r.addComputedMethods(session, vendedID)
+
+	// focus(path) / shortcut(combo, target, method) - frontend focus and key bindings
+	r.addFocusMethods(session, vendedID)
+
+	// group - the session's group name, if any
+	r.installGroup(session)
 
-		// Create app variable (parentID 0)
-		id, err := r.variableStore.CreateVariable(vendedID, 0, luaObject, props)
+	// createAppVariable - creates the app root, variable 1, and stores reference in Go struct
+	r.setAPI(session, "session", "createAppVariable", r.State.NewFunction(func(L *lua.LState) int {
+		luaObject := L.CheckTable(2)
+		id, err := r.createRoot(session, vendedID, AppRoot, luaObject, luaProps(L.OptTable(3, nil)))
 		if err != nil {
 			L.RaiseError("failed to create app variable: %v", err)
 			return 0
@@ -582,21 +662,25 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 			}
 		}
 
-		// Track in session's _objectToId
-		objectToId := L.GetField(session, "_objectToId")
-		if objectToId != lua.LNil {
-			L.SetField(objectToId.(*lua.LTable), "", lua.LNumber(id)) // weak key
-			L.RawSet(objectToId.(*lua.LTable), luaObject, lua.LNumber(id))
-		}
-
-		r.Log(2, "LuaRuntime: created app variable %d for session %s", id, vendedID)
+		L.Push(lua.LNumber(id))
+		return 1
+	}))
 
+	// createRoot(name, obj, props) - creates a root variable the frontend finds by name
+	r.setAPI(session, "session", "createRoot", r.State.NewFunction(func(L *lua.LState) int {
+		name := L.CheckString(2)
+		luaObject := L.CheckTable(3)
+		id, err := r.createRoot(session, vendedID, name, luaObject, luaProps(L.OptTable(4, nil)))
+		if err != nil {
+			L.RaiseError("failed to create root: %v", err)
+			return 0
+		}
 		L.Push(lua.LNumber(id))
 		return 1
 	}))
 
 	// getApp - returns the Lua app object directly (not a wrapper)
-	r.State.SetField(session, "getApp", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "getApp", r.State.NewFunction(func(L *lua.LState) int {
 		luaSess, ok := r.GetLuaSession(vendedID)
 		if !ok || luaSess.appObject == nil {
 			L.Push(lua.LNil)
@@ -607,29 +691,10 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	}))
 
 	// Override createVariable to support parent lookup by object reference
-	r.State.SetField(session, "createVariable", r.State.NewFunction(func(L *lua.LState) int {
-		var parentID int64
-		parentArg := L.Get(2)
-		switch p := parentArg.(type) {
-		case lua.LNumber:
-			parentID = int64(p)
-		case *lua.LTable:
-			// Look up variable ID by object reference
-			tracker := r.variableStore.GetTracker(vendedID)
-			if tracker != nil {
-				for _, v := range tracker.RootVariables() {
-					if v.Value == p {
-						parentID = v.ID
-						break
-					}
-				}
-			}
-			if parentID == 0 {
-				L.RaiseError("parent object not found in tracker")
-				return 0
-			}
-		default:
-			L.RaiseError("createVariable: parentId must be a number or table")
+	r.setAPI(session, "session", "createVariable", r.State.NewFunction(func(L *lua.LState) int {
+		parentID, err := r.parentVariableID(vendedID, L.Get(2))
+		if err != nil {
+			L.RaiseError("createVariable: %s", err.Error())
 			return 0
 		}
 
@@ -664,7 +729,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	}))
 
 	// Override destroyVariable to support object reference lookup
-	r.State.SetField(session, "destroyVariable", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "destroyVariable", r.State.NewFunction(func(L *lua.LState) int {
 		var id int64
 		arg := L.Get(2)
 		switch v := arg.(type) {
@@ -700,7 +765,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	}))
 
 	// newVersion - increment mutation version for hot-loading schema migrations
-	r.State.SetField(session, "newVersion", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "newVersion", r.State.NewFunction(func(L *lua.LState) int {
 		luaSess, ok := r.GetLuaSession(vendedID)
 		if !ok {
 			L.Push(lua.LNumber(0))
@@ -712,7 +777,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	}))
 
 	// getVersion - get current mutation version
-	r.State.SetField(session, "getVersion", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "getVersion", r.State.NewFunction(func(L *lua.LState) int {
 		luaSess, ok := r.GetLuaSession(vendedID)
 		if !ok {
 			L.Push(lua.LNumber(0))
@@ -724,7 +789,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 
 	// needsMutation - check if object needs migration (obj._mutationVersion < session version)
 	// DEPRECATED: Use session:prototype() for automatic mutation instead
-	r.State.SetField(session, "needsMutation", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "needsMutation", r.State.NewFunction(func(L *lua.LState) int {
 		obj := L.CheckTable(2)
 
 		luaSess, ok := r.GetLuaSession(vendedID)
@@ -747,7 +812,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 
 	// prototype - declare/update a prototype with instance field tracking
 	// session:prototype(name, init, base) -> prototype table
-	r.State.SetField(session, "prototype", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "prototype", r.State.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(2)
 		var init *lua.LTable
 		if L.GetTop() >= 3 && L.Get(3) != lua.LNil {
@@ -771,7 +836,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 
 	// create - create a tracked instance with weak reference
 	// session:create(prototype, instance) -> instance table
-	r.State.SetField(session, "create", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "create", r.State.NewFunction(func(L *lua.LState) int {
 		prototype := L.CheckTable(2)
 		var instance *lua.LTable
 		if L.GetTop() >= 3 && L.Get(3) != lua.LNil {
@@ -794,7 +859,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// removePrototype - remove a prototype from the registry
 	// session:removePrototype(name, children) -> nil
 	// CRC: crc-LuaSession.md
-	r.State.SetField(session, "removePrototype", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "removePrototype", r.State.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(2)
 		children := false
 		if L.GetTop() >= 3 {
@@ -811,7 +876,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// unloadModule - remove all tracking related to a module
 	// session:unloadModule(moduleName) -> nil
 	// Seq: seq-unload-module.md
-	r.State.SetField(session, "unloadModule", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "unloadModule", r.State.NewFunction(func(L *lua.LState) int {
 		moduleName := L.CheckString(2)
 
 		luaSess, ok := r.GetLuaSession(vendedID)
@@ -824,7 +889,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// unloadDirectory - unload all modules in a directory
 	// session:unloadDirectory(dirPath) -> nil
 	// Seq: seq-unload-module.md
-	r.State.SetField(session, "unloadDirectory", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "unloadDirectory", r.State.NewFunction(func(L *lua.LState) int {
 		dirPath := L.CheckString(2)
 
 		luaSess, ok := r.GetLuaSession(vendedID)
@@ -837,7 +902,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// setImmediate - schedule function for next ChanSvc turn
 	// session:setImmediate(fn) -> handle
 	// CRC: crc-LuaSession.md | Seq: seq-session-timer.md
-	r.State.SetField(session, "setImmediate", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "setImmediate", r.State.NewFunction(func(L *lua.LState) int {
 		fn := L.CheckFunction(2)
 		luaSess, ok := r.GetLuaSession(vendedID)
 		if !ok || luaSess.onDefer == nil {
@@ -853,7 +918,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// setTimeout - schedule function after delay
 	// session:setTimeout(fn, ms) -> handle
 	// CRC: crc-LuaSession.md | Seq: seq-session-timer.md
-	r.State.SetField(session, "setTimeout", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "setTimeout", r.State.NewFunction(func(L *lua.LState) int {
 		fn := L.CheckFunction(2)
 		ms := L.CheckInt(3)
 		luaSess, ok := r.GetLuaSession(vendedID)
@@ -873,7 +938,7 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 	// setInterval - schedule repeating function
 	// session:setInterval(fn, ms) -> handle
 	// CRC: crc-LuaSession.md | Seq: seq-session-timer.md
-	r.State.SetField(session, "setInterval", r.State.NewFunction(func(L *lua.LState) int {
+	r.setAPI(session, "session", "setInterval", r.State.NewFunction(func(L *lua.LState) int {
 		fn := L.CheckFunction(2)
 		ms := L.CheckInt(3)
 		luaSess, ok := r.GetLuaSession(vendedID)
@@ -911,9 +976,9 @@ func (r *LuaSession) addGoSessionMethods(session *lua.LTable, vendedID string) {
 		}
 		return 0
 	})
-	r.State.SetField(session, "clearImmediate", clearFn)
-	r.State.SetField(session, "clearTimeout", clearFn)
-	r.State.SetField(session, "clearInterval", clearFn)
+	r.setAPI(session, "session", "clearImmediate", clearFn)
+	r.setAPI(session, "session", "clearTimeout", clearFn)
+	r.setAPI(session, "session", "clearInterval", clearFn)
 }
 
 // prototypeImpl implements session:prototype(name, init, base).
@@ -1232,9 +1297,11 @@ func (r *LuaSession) UnloadModule(moduleName string) {
 	}
 
 	// Remove presenter types registered by this module
+	r.mu.Lock()
 	for _, ptName := range module.PresenterTypes {
 		delete(r.presenterTypes, ptName)
 	}
+	r.mu.Unlock()
 
 	// Remove wrappers registered by this module
 	if r.wrapperRegistry != nil {
@@ -1244,7 +1311,7 @@ func (r *LuaSession) UnloadModule(moduleName string) {
 	}
 
 	// Remove from loadedModules
-	r.loadedModules.RawSetString(moduleName, lua.LNil)
+	r.setLoaded(moduleName, lua.LNil)
 
 	// Clean up HotLoader state
 	if r.hotLoaderCleanup != nil {
@@ -1323,27 +1390,65 @@ func (r *LuaSession) extractTypeProperty(obj any, props map[string]string) {
 	}
 }
 
+// ChangeScheduler runs fn on a session's executor, followed by change
+// detection. Without flush it returns at once and the change detection joins
+// one already pending; with flush it returns once the resulting updates have
+// been handed to the session's connections.
+type ChangeScheduler func(fn func(), flush bool) error
+
+// SetChangeScheduler sets the callback behind NotifyPropertyChange.
+// Called by Server during session setup to decouple LuaSession from Server.
+func (r *LuaSession) SetChangeScheduler(schedule ChangeScheduler) {
+	r.onChange = schedule
+}
+
 // NotifyPropertyChange notifies Lua watchers of a property change for a session.
-// Called by external code when a variable property changes.
+// Called by external code when a variable property changes. Once the watchers
+// run, the session is marked dirty and an AfterBatch is scheduled, so whatever
+// they changed reaches the frontend without waiting for another message.
 // vendedID is the compact session ID (e.g., "1", "2").
 func (r *LuaSession) NotifyPropertyChange(vendedID string, varID int64, property string, value interface{}) {
+	r.notifyPropertyChange(vendedID, varID, property, value, false)
+}
+
+// NotifyPropertyChangeAndFlush is NotifyPropertyChange for callers that need
+// synchronous completion: it returns once the watchers have run and the
+// updates they caused have been handed to the session's connections.
+func (r *LuaSession) NotifyPropertyChangeAndFlush(vendedID string, varID int64, property string, value interface{}) error {
+	return r.notifyPropertyChange(vendedID, varID, property, value, true)
+}
+
+func (r *LuaSession) notifyPropertyChange(vendedID string, varID int64, property string, value interface{}, flush bool) error {
 	if r.ID != vendedID || r.sessionTable == nil {
-		return
+		return nil
 	}
-
-	r.execute(func() (interface{}, error) {
-		r.notifyPropertyChangeInternal(varID, property, value)
-		return nil, nil
-	})
+	notify := func() {
+		r.execute(func() (interface{}, error) {
+			r.notifyPropertyChangeInternal(varID, property, value)
+			return nil, nil
+		})
+		r.MarkDirty()
+	}
+	if r.onChange == nil {
+		notify()
+		return nil
+	}
+	return r.onChange(notify, flush)
 }
 
 // notifyPropertyChangeInternal notifies watchers (must be called from executor).
 func (r *LuaSession) notifyPropertyChangeInternal(varID int64, property string, value interface{}) {
-	watchers := r.State.GetField(r.sessionTable, "_watchers").(*lua.LTable)
-	key := fmt.Sprintf("%d", varID)
+	watchers, ok := r.State.GetField(r.sessionTable, "_watchers").(*lua.LTable)
+	if !ok {
+		return
+	}
 
-	varWatchers := r.State.GetField(watchers, key)
+	// session.lua keys watchers by number, the fallback session table by string
+	varWatchers := watchers.RawGet(lua.LNumber(varID))
 	if varWatchers == lua.LNil {
+		varWatchers = r.State.GetField(watchers, fmt.Sprintf("%d", varID))
+	}
+	if _, ok := varWatchers.(*lua.LTable); !ok {
 		return
 	}
 
@@ -1385,15 +1490,21 @@ func (r *LuaSession) startExecutor() {
 			case <-r.done:
 				return
 			case work := <-r.executorChan:
-				result, err := work.fn()
+				result, err := r.runSandboxed(work.fn)
 				work.result <- WorkResult{Value: result, Err: err}
 			}
 		}
 	}()
 }
 
+// ExecutorQueueDepth returns the number of work items waiting for the executor.
+func (r *LuaSession) ExecutorQueueDepth() int {
+	return len(r.executorChan)
+}
+
 // execute queues a function on the executor and blocks until complete.
 func (r *LuaSession) execute(fn func() (interface{}, error)) (interface{}, error) {
+	r.dirty.Store(true)
 	result := make(chan WorkResult, 1)
 	r.executorChan <- WorkItem{fn: fn, result: result}
 	res := <-result
@@ -1480,16 +1591,58 @@ type VariableUpdate struct {
 	VarID      int64
 	Value      json.RawMessage
 	Properties map[string]string
+	Removed    []string      // Properties deleted since the last update
+	Pending    *PendingValue // Large value still being encoded; Value is set by Await
+	Origin     string        // Connection whose own update this only echoes; not sent back to it
+	Priority   changetracker.Priority
+}
+
+// Await waits for a pending value and stores it in Value.
+func (u *VariableUpdate) Await() error {
+	if u.Pending == nil {
+		return nil
+	}
+	value, err := u.Pending.Wait()
+	u.Value, u.Pending = value, nil
+	return err
+}
+
+// HasPending reports whether any update is still being encoded.
+func HasPending(updates []VariableUpdate) bool {
+	for _, u := range updates {
+		if u.Pending != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (r *LuaSession) TriggerBatch() {
 	r.batchTriggered = true
+	r.dirty.Store(true)
+}
+
+// MarkDirty records that the session may have changes to send, e.g. after a
+// frontend message changed its variables outside Lua.
+func (r *LuaSession) MarkDirty() {
+	r.dirty.Store(true)
+}
+
+// TakeDirty reports whether anything may have changed since the last call, and
+// clears the flag. Sessions that are not dirty can skip change detection.
+func (r *LuaSession) TakeDirty() bool {
+	return r.dirty.Swap(false)
 }
 
 // AfterBatch triggers change detection for a session after processing a message batch.
 // Returns a list of variable updates that need to be sent to the frontend.
 // vendedID is the compact session ID (e.g., "1", "2").
 func (r *LuaSession) AfterBatch(vendedID string) []VariableUpdate {
+	if len(r.computed) > 0 {
+		if tracker := r.variableStore.GetTracker(vendedID); tracker != nil {
+			r.updateComputedValues(tracker)
+		}
+	}
 	// Use tracker's DetectChanges
 	for range 4 {
 		if !r.variableStore.DetectChanges(vendedID) || !r.batchTriggered {
@@ -1497,61 +1650,93 @@ func (r *LuaSession) AfterBatch(vendedID string) []VariableUpdate {
 		}
 		r.batchTriggered = false
 	}
+	r.logErrorSummaries()
 	changes := r.variableStore.GetChanges(vendedID)
-
-	// Check for viewdef changes even if no variable changes (e.g., hot-reload)
-	// NOTE: GetChangedViewdefsForSession marks viewdefs as sent, so only call once
-	defs := r.viewdefManager.GetChangedViewdefsForSession(vendedID)
-	if len(changes) == 0 && len(defs) == 0 {
-		return nil
-	}
+	echoes := r.echoes
+	r.echoes = nil
 
 	tracker := r.variableStore.GetTracker(vendedID)
 	if tracker == nil {
 		return nil
 	}
 
-	v1 := tracker.GetVariable(1)
-	if v1 == nil {
-		return nil
-	}
-	var sending changetracker.Change
-
-	// Load viewdefs for any new types encountered
+	// Load viewdefs for any new types encountered, so they go out in this
+	// batch, ahead of the values that use them
 	for _, change := range changes {
 		if slices.Contains(change.PropertiesChanged, "type") {
 			if v := tracker.GetVariable(change.VariableID); v != nil {
-				typ := v.Properties["type"]
-				r.viewdefManager.LoadViewdefsForType(typ)
+				r.viewdefManager.LoadViewdefsForType(v.Properties["type"])
 			}
 		}
-		if change.VariableID == 1 && slices.Contains(change.PropertiesChanged, "viewdefs") {
+	}
+
+	// Check for viewdef changes even if no variable changes (e.g., hot-reload)
+	// NOTE: GetChangedViewdefsForSession marks viewdefs as sent, so only call once.
+	// Viewdefs ride on the meta root, so until Lua creates a root they stay unsent.
+	var defs map[string]string
+	var metas map[string]json.RawMessage
+	metaID := r.metaRootID()
+	meta := tracker.GetVariable(metaID)
+	if meta != nil {
+		defs = r.viewdefManager.GetChangedViewdefsForSession(vendedID)
+		metas = r.viewdefManager.GetChangedMetaForSession(vendedID)
+	} else if len(changes) > 0 {
+		r.Log(3, "AfterBatch: session %s has no root yet, deferring viewdefs", vendedID)
+	}
+	if len(changes) == 0 && len(defs) == 0 && len(metas) == 0 {
+		return nil
+	}
+	var sending changetracker.Change
+	for _, change := range changes {
+		if change.VariableID == metaID && slices.Contains(change.PropertiesChanged, "viewdefs") {
 			sending = change
 		}
 	}
 
-	// Handle viewdef changes (defs already loaded above)
+	// Handle viewdef changes
+	var metaProps []string
+	if len(metas) > 0 {
+		// Metadata goes first so re-rendered viewdefs see their new layout hints
+		if metaBytes, err := json.Marshal(metas); err != nil {
+			r.Log(0, "Error serializing viewdef metadata: %s", err.Error())
+		} else {
+			meta.Properties["viewdefMeta"] = string(metaBytes)
+			metaProps = append(metaProps, "viewdefMeta")
+		}
+	}
 	if len(defs) > 0 {
+		// The frontend applies the nonce to scripts it activates from the viewdefs
+		if nonce := r.viewdefManager.SessionNonce(vendedID); nonce != "" && meta.Properties["cspNonce"] != nonce {
+			meta.Properties["cspNonce"] = nonce
+			metaProps = append(metaProps, "cspNonce")
+		}
 		if defBytes, err := json.Marshal(defs); err != nil {
 			r.Log(0, "Error serializing viewdefs: %s", err.Error())
 		} else {
-			v1.Properties["viewdefs"] = string(defBytes)
-			r.Log(4, "SENDING VIEWDEFS: %s", v1.Properties["viewdefs"])
+			meta.Properties["viewdefs"] = string(defBytes)
+			if vlog := r.config.Logger(config.LogViewdef); vlog.Verbosity() >= 4 {
+				vlog.Log(4, "SENDING VIEWDEFS: %s", r.config.Sanitize(meta.Properties["viewdefs"]))
+			}
 			if sending.VariableID == 0 {
-				// need to insert a change for the viewdefs
-				new := make([]changetracker.Change, len(changes)+1)
-				new[0] = changetracker.Change{
-					VariableID:        1,
-					Priority:          changetracker.PriorityHigh,
-					ValueChanged:      false,
-					PropertiesChanged: []string{"viewdefs"},
-				}
-				copy(new[1:], changes)
-				changes = new
+				metaProps = append(metaProps, "viewdefs")
 			}
 		}
 	}
+	if len(metaProps) > 0 {
+		// need to insert a change for the viewdefs
+		new := make([]changetracker.Change, len(changes)+1)
+		new[0] = changetracker.Change{
+			VariableID:        metaID,
+			Priority:          changetracker.PriorityHigh,
+			ValueChanged:      false,
+			PropertiesChanged: metaProps,
+		}
+		copy(new[1:], changes)
+		changes = new
+	}
+	changes = r.applyPriorityRules(tracker, changes)
 
+	cache, _ := r.variableStore.(EncodedValueCache)
 	var updates []VariableUpdate
 	for _, change := range changes {
 		v := tracker.GetVariable(change.VariableID)
@@ -1559,40 +1744,66 @@ func (r *LuaSession) AfterBatch(vendedID string) []VariableUpdate {
 			continue
 		}
 		var value json.RawMessage
+		var pending *PendingValue
 		var props map[string]string
-		if change.ValueChanged {
+		var removed []string
+		if change.ValueChanged && v.WrapperValue == nil && cache != nil {
+			value, _ = cache.EncodedValue(vendedID, change.VariableID)
+		}
+		if change.ValueChanged && value == nil {
 			// Use wrapped value if present
-			val := v.NavigationValue()
-			jsonBytes, err := tracker.ToValueJSONBytes(val)
+			var err error
+			r.convertIssue = ""
+			value, pending, err = encodeValue(tracker, v.NavigationValue())
+			if r.convertIssue != "" {
+				r.AddVariableDiag(change.VariableID, r.convertIssue)
+				r.Log(1, "variable %d: %s", change.VariableID, r.convertIssue)
+			}
 			if err != nil {
-				r.Log(1, "ERROR: AfterBatch failed to marshal variable %d: %v", change.VariableID, err)
+				r.logVarError(1, change.VariableID, "ERROR: AfterBatch failed to marshal variable %d: %v", change.VariableID, err)
 				continue
 			}
-			value = json.RawMessage(jsonBytes)
 		}
-		if len(change.PropertiesChanged) > 0 {
-			props = make(map[string]string, len(change.PropertiesChanged))
-			for _, prop := range change.PropertiesChanged {
-				props[prop] = v.Properties[prop]
-			}
-			if props["viewdefs"] != "" {
-				r.Log(4, "ADDING VIEWDEFS TO UPDATES: %s", v1.Properties["viewdefs"])
+		// Properties no longer present were removed
+		for _, prop := range change.PropertiesChanged {
+			if val, ok := v.Properties[prop]; ok {
+				if props == nil {
+					props = make(map[string]string, len(change.PropertiesChanged))
+				}
+				props[prop] = val
+			} else {
+				removed = append(removed, prop)
 			}
 		}
+		if vlog := r.config.Logger(config.LogViewdef); props["viewdefs"] != "" && vlog.Verbosity() >= 4 {
+			vlog.Log(4, "ADDING VIEWDEFS TO UPDATES: %s", r.config.Sanitize(props["viewdefs"]))
+		}
 		r.Log(2, "AfterBatch: variable %d changed", change.VariableID)
+		var origin string
+		if props == nil && removed == nil {
+			origin = echoOrigin(echoes, change.VariableID, value)
+		}
 		updates = append(updates, VariableUpdate{
 			VarID:      change.VariableID,
 			Value:      value,
 			Properties: props,
+			Removed:    removed,
+			Pending:    pending,
+			Origin:     origin,
+			Priority:   change.Priority,
 		})
 
 		// Also update the variable store so watchers get notified
 		if err := r.variableStore.Update(change.VariableID, value, props); err != nil {
-			r.Log(1, "AfterBatch: failed to update store for variable %d: %v", change.VariableID, err)
+			r.logVarError(1, change.VariableID, "AfterBatch: failed to update store for variable %d: %v", change.VariableID, err)
 		}
 	}
 	// clear sent viewdefs
-	v1.Properties["viewdefs"] = ""
+	if meta != nil {
+		delete(meta.Properties, "viewdefs")
+		delete(meta.Properties, "viewdefMeta")
+	}
+	r.clearSentFocus(tracker)
 	return updates
 }
 
@@ -1616,12 +1827,20 @@ func (r *LuaSession) HandleFrontendCreate(sessionID string, id int64, parentID i
 	if tracker == nil {
 		return fmt.Errorf("session %s tracker not found", r.ID)
 	}
+	path = r.applyKeyStyle(tracker, parentID, path, properties)
+
 	// Create the child variable in the tracker with the frontend-provided ID.
 	// This automatically triggers Resolver.CreateWrapper if the property is set.
+	delete(r.suffixed, id) // IDs are frontend-vended and may be reused
+	r.clearVariableDiags(id)
+	r.notePrioritySuffixes(id, properties)
 	v := tracker.CreateVariableWithId(id, nil, parentID, path, properties)
 	if v == nil {
 		return fmt.Errorf("HandleFrontendCreate: variable ID %d already in use", id)
 	}
+	if r.viewdefManager != nil {
+		r.viewdefManager.CountCreated(v.Properties["type"])
+	}
 
 	// Nil out cached JSON so that when the auto-watch triggers ChangeAll,
 	// DetectChanges will see the value as changed (from nil to the actual value).
@@ -1646,9 +1865,11 @@ func WrapTrackerVariable(session *LuaSession, v *changetracker.Variable) *Tracke
 
 // HandleFrontendUpdate handles an update to a path-based variable from frontend.
 // Updates the backend object via the variable's path using v.Set().
+// connectionID is the sending connection, which AfterBatch does not echo the value back to.
+// Properties in removed are deleted after properties are applied.
 // CRC: crc-LuaRuntime.md
 // Sequence: seq-relay-message.md
-func (r *LuaSession) HandleFrontendUpdate(sessionID string, varID int64, value json.RawMessage, properties map[string]string) error {
+func (r *LuaSession) HandleFrontendUpdate(sessionID, connectionID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error {
 	tracker := r.variableStore.GetTracker(sessionID)
 	if tracker == nil {
 		return fmt.Errorf("session %s tracker not found", sessionID)
@@ -1659,9 +1880,18 @@ func (r *LuaSession) HandleFrontendUpdate(sessionID string, varID int64, value j
 		return fmt.Errorf("variable %d not found in tracker", varID)
 	}
 
+	if err := checkFrontendShortcuts(varID, properties); err != nil {
+		return err
+	}
+
 	// Apply frontend-sent properties to tracker variable
+	r.notePrioritySuffixes(varID, properties)
 	for k, val := range properties {
-		v.SetProperty(k, val)
+		setProperty(tracker, v, k, val)
+	}
+	for _, name := range removed {
+		removeProperty(tracker, v, name)
+		delete(r.suffixed[varID], name)
 	}
 
 	// Skip value update if no value sent (properties-only update)
@@ -1675,12 +1905,17 @@ func (r *LuaSession) HandleFrontendUpdate(sessionID string, varID int64, value j
 		return fmt.Errorf("failed to parse value: %w", err)
 	}
 
-	// Update the backend object via the variable's path
+	// Update the backend object via the variable's path. Set caches the sent value
+	// as the last known one; restore the old one so change detection still reports
+	// it to the variable's other watchers (AfterBatch keeps it from the sender).
+	previous := v.ValueJSON
 	if err := v.Set(goValue); err != nil {
-		r.Log(0, "HandleFrontendUpdate: Set failed for var %d: %v", varID, err)
+		r.logVarError(0, varID, "HandleFrontendUpdate: Set failed for var %d: %v", varID, err)
 		return err
 	}
+	v.ValueJSON = previous
 
+	r.recordEcho(connectionID, varID, value)
 	r.Log(2, "HandleFrontendUpdate: updated var %d with value %s", varID, string(value))
 
 	return nil
@@ -1704,23 +1939,27 @@ func (r *LuaSession) registerRequire() {
 			return 1
 		}
 
-		// Convert module name to filename (e.g., "foo.bar" -> "foo/bar.lua")
-		filename := strings.ReplaceAll(modName, ".", string(filepath.Separator)) + ".lua"
+		// Find the module's file through package.path (e.g., "foo.bar" -> "foo/bar.lua")
+		filename, tried := r.findModule(modName)
+		if filename == "" {
+			L.RaiseError("error loading module '%s': not found (tried %s)", modName, strings.Join(tried, ", "))
+			return 0
+		}
 
 		// Mark as loaded BEFORE executing (handles circular dependencies)
-		L.SetField(loaded, modName, lua.LTrue)
+		r.setLoaded(modName, lua.LTrue)
 
 		// Delegate to DirectRequireLuaFile for actual loading
 		result, err := r.DirectRequireLuaFile(filename)
 		if err != nil {
 			// Unmark on error (allows retry)
-			L.SetField(loaded, modName, lua.LNil)
+			r.setLoaded(modName, lua.LNil)
 			L.RaiseError("error loading module '%s': %v", modName, err)
 			return 0
 		}
 
 		// Also cache under module name for require("foo.bar") lookups
-		L.SetField(loaded, modName, result)
+		r.setLoaded(modName, result)
 		L.Push(result)
 		return 1
 	})
@@ -1728,9 +1967,10 @@ func (r *LuaSession) registerRequire() {
 	// Set as global require
 	L.SetGlobal("require", requireFn)
 
-	// Also expose package.loaded for compatibility
+	// Also expose package.loaded, and package.path for Lua code to extend
 	pkg := L.NewTable()
 	L.SetField(pkg, "loaded", loaded)
+	L.SetField(pkg, "path", lua.LString(DefaultPackagePath))
 	L.SetGlobal("package", pkg)
 }
 
@@ -1742,16 +1982,21 @@ func (r *LuaSession) registerUIModule() {
 	uiMod := L.NewTable()
 
 	// ui.registerPresenter(name, table)
-	L.SetField(uiMod, "registerPresenter", L.NewFunction(func(L *lua.LState) int {
+	r.setAPI(uiMod, "ui", "registerPresenter", L.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(1)
 		tbl := L.CheckTable(2)
 
 		r.mu.Lock()
-		r.presenterTypes[name] = &PresenterType{
+		pt := &PresenterType{
 			Name:    name,
 			Methods: make(map[string]*lua.LFunction),
 			Table:   tbl,
 		}
+		if r.reloadPresenters != nil {
+			r.reloadPresenters[name] = pt
+		} else {
+			r.putPresenterType(pt)
+		}
 		// Track presenter type in current module
 		if r.currentModule != nil {
 			r.currentModule.AddPresenterType(name)
@@ -1764,7 +2009,7 @@ func (r *LuaSession) registerUIModule() {
 	}))
 
 	// ui.log([level,] message)
-	L.SetField(uiMod, "log", L.NewFunction(func(L *lua.LState) int {
+	r.setAPI(uiMod, "ui", "log", L.NewFunction(func(L *lua.LState) int {
 		top := L.GetTop()
 		var level int
 		var msg string
@@ -1782,7 +2027,7 @@ func (r *LuaSession) registerUIModule() {
 	}))
 
 	// ui.json_encode(value)
-	L.SetField(uiMod, "json_encode", L.NewFunction(func(L *lua.LState) int {
+	r.setAPI(uiMod, "ui", "json_encode", L.NewFunction(func(L *lua.LState) int {
 		val := L.Get(1)
 		goVal := LuaToGo(val)
 		data, err := json.Marshal(goVal)
@@ -1796,7 +2041,7 @@ func (r *LuaSession) registerUIModule() {
 	}))
 
 	// ui.json_decode(string)
-	L.SetField(uiMod, "json_decode", L.NewFunction(func(L *lua.LState) int {
+	r.setAPI(uiMod, "ui", "json_decode", L.NewFunction(func(L *lua.LState) int {
 		str := L.CheckString(1)
 		var val interface{}
 		if err := json.Unmarshal([]byte(str), &val); err != nil {
@@ -1812,7 +2057,7 @@ func (r *LuaSession) registerUIModule() {
 	// Registers a Lua wrapper type for variable value transformation.
 	// The table must have: computeValue(self, rawValue) -> storedValue
 	// Optionally: destroy(self) for cleanup
-	L.SetField(uiMod, "registerWrapper", L.NewFunction(func(L *lua.LState) int {
+	r.setAPI(uiMod, "ui", "registerWrapper", L.NewFunction(func(L *lua.LState) int {
 		name := L.CheckString(1)
 		tbl := L.CheckTable(2)
 
@@ -1836,6 +2081,18 @@ func (r *LuaSession) registerUIModule() {
 		return 0
 	}))
 
+	// ui.groupBroadcast(group, name, payload)
+	r.addGroupAPI(uiMod)
+
+	// ui.priority{property=NAME | type=TYPE, priority=LEVEL}
+	r.addPriorityAPI(uiMod)
+
+	// ui.timer(delaySeconds, fn), ui.interval(delaySeconds, fn)
+	r.addTimerAPI(uiMod)
+
+	// ui.asset(name) - an html/ asset's fingerprinted name
+	r.addAssetAPI(uiMod)
+
 	L.SetGlobal("ui", uiMod)
 }
 
@@ -1867,12 +2124,12 @@ func (r *LuaSession) loadFileInternal(path string) error {
 	}
 
 	// Mark as loaded BEFORE executing (handles circular dependencies)
-	L.SetField(loaded, path, lua.LTrue)
+	r.setLoaded(path, lua.LTrue)
 
 	// Execute the file
 	if err := L.DoFile(path); err != nil {
 		// Unmark on error (allows retry)
-		L.SetField(loaded, path, lua.LNil)
+		r.setLoaded(path, lua.LNil)
 		return fmt.Errorf("failed to load %s: %w", path, err)
 	}
 
@@ -1881,15 +2138,26 @@ func (r *LuaSession) loadFileInternal(path string) error {
 
 // IsFileLoaded checks if a file has been loaded by this session.
 // The trackingKey should be a baseDir-relative path (e.g., "apps/myapp/app.lua").
-// Used by hot-loader to skip files not yet loaded.
+// Used by hot-loader to skip files not yet loaded. Safe off the executor: it
+// reads a copy of the tracker's keys, not the LState.
 // CRC: crc-LuaSession.md
 func (r *LuaSession) IsFileLoaded(trackingKey string) bool {
-	var loaded bool
-	r.execute(func() (interface{}, error) {
-		loaded = r.State.GetField(r.loadedModules, trackingKey) != lua.LNil
-		return nil, nil
-	})
-	return loaded
+	r.loadedMu.Lock()
+	defer r.loadedMu.Unlock()
+	return r.loadedFiles[trackingKey]
+}
+
+// setLoaded sets a key of the load tracker, keeping the copy IsFileLoaded
+// reads without a round trip through the executor in step.
+func (r *LuaSession) setLoaded(key string, value lua.LValue) {
+	r.State.SetField(r.loadedModules, key, value)
+	r.loadedMu.Lock()
+	defer r.loadedMu.Unlock()
+	if value == lua.LNil {
+		delete(r.loadedFiles, key)
+	} else {
+		r.loadedFiles[key] = true
+	}
 }
 
 // BaseDir returns the site root directory from config.
@@ -1922,7 +2190,7 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 	} else {
 		// Try relative to luaDir first (backward compatible)
 		absPath = filepath.Join(r.luaDir, filename)
-		if _, err := os.Stat(absPath); err != nil {
+		if _, err := os.Stat(absPath); err != nil && !r.sources.Has(absPath) {
 			// Try relative to baseDir
 			absPath = filepath.Join(r.config.Server.Dir, filename)
 		}
@@ -1931,8 +2199,8 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 	var code string
 	var trackingKey string
 
-	// Try filesystem first
-	content, fsErr := os.ReadFile(absPath)
+	// Try filesystem first (or the source cache while the lua directory is unavailable)
+	content, fsErr := r.sources.Read(absPath)
 	if fsErr == nil {
 		code = string(content)
 		// Compute tracking key for hot-reload (baseDir-relative path)
@@ -1941,8 +2209,10 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 				trackingKey = key
 			}
 		}
+	} else if r.config != nil && r.config.Server.Dir != "" && r.config.Server.NoBundleFallback {
+		return lua.LNil, fmt.Errorf("file not found: %s", absPath)
 	} else {
-		// Try bundle (works for bundled binaries)
+		// Try bundle (works for bundled binaries, and under --dir for files it lacks)
 		bundlePath := "lua/" + strings.ReplaceAll(filename, string(filepath.Separator), "/")
 		bundleContent, bundleErr := bundle.ReadFile(bundlePath)
 		if bundleErr == nil {
@@ -1959,7 +2229,7 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 	}
 
 	// Mark as loaded BEFORE executing (handles circular dependencies)
-	L.SetField(loaded, trackingKey, lua.LTrue)
+	r.setLoaded(trackingKey, lua.LTrue)
 
 	// Set current module for resource tracking
 	directory := filepath.Dir(trackingKey)
@@ -1969,7 +2239,7 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 	// Execute the code
 	if err := L.DoString(code); err != nil {
 		// Unmark on error (allows retry)
-		L.SetField(loaded, trackingKey, lua.LNil)
+		r.setLoaded(trackingKey, lua.LNil)
 		// Clean up module tracking on error
 		delete(r.modules, trackingKey)
 		if mods, ok := r.moduleDirectories[directory]; ok {
@@ -1990,11 +2260,21 @@ func (r *LuaSession) DirectRequireLuaFile(filename string) (lua.LValue, error) {
 	}
 
 	// Update cache with actual result
-	L.SetField(loaded, trackingKey, result)
+	r.setLoaded(trackingKey, result)
 
 	return result, nil
 }
 
+// doSource runs a Lua file's content, named by its path like DoFile.
+func (r *LuaSession) doSource(path string, content []byte) error {
+	fn, err := r.State.Load(bytes.NewReader(content), path)
+	if err != nil {
+		return err
+	}
+	r.State.Push(fn)
+	return r.State.PCall(0, lua.MultRet, nil)
+}
+
 // ComputeTrackingKey computes a baseDir-relative tracking key for a file.
 // Symlinks are resolved to get the actual target path.
 // This is a package-level function used by both LuaSession and HotLoader.
@@ -2015,20 +2295,82 @@ func ComputeTrackingKey(baseDir, absPath string) (string, error) {
 }
 
 // SetReloading sets the session.reloading flag.
-// Called by hot-loader before/after reloading files.
 func (r *LuaSession) SetReloading(reloading bool) {
 	r.execute(func() (interface{}, error) {
-		if r.sessionTable != nil {
-			if reloading {
-				r.State.SetField(r.sessionTable, "reloading", lua.LTrue)
-			} else {
-				r.State.SetField(r.sessionTable, "reloading", lua.LFalse)
-			}
-		}
+		r.setReloadingDirect(reloading)
 		return nil, nil
 	})
 }
 
+func (r *LuaSession) setReloadingDirect(reloading bool) {
+	if r.sessionTable != nil {
+		r.State.SetField(r.sessionTable, "reloading", lua.LBool(reloading))
+	}
+}
+
+// ReloadDirect re-runs a loaded file's new content with session.reloading set,
+// re-running its prototype registrations and queued mutations in one step.
+// The presenter types it registers replace the file's old ones together, under
+// the session lock, once it succeeds.
+// MUST only be called from within an execute() context.
+// Called by hot-loader.
+func (r *LuaSession) ReloadDirect(trackingKey, content string) error {
+	return r.reloadStaged(trackingKey, func() error {
+		_, err := r.LoadCodeDirect(trackingKey, content)
+		return err
+	})
+}
+
+// reloadStaged runs load with session.reloading set, staging the presenter
+// types it registers as trackingKey's until it succeeds (see ReloadDirect).
+func (r *LuaSession) reloadStaged(trackingKey string, load func() error) error {
+	r.setReloadingDirect(true)
+	defer r.setReloadingDirect(false)
+
+	reload := NewModule(trackingKey, "")
+	r.mu.Lock()
+	r.reloadPresenters = make(map[string]*PresenterType)
+	prev := r.currentModule
+	r.currentModule = reload
+	r.mu.Unlock()
+
+	err := load()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.currentModule = prev
+	staged := r.reloadPresenters
+	r.reloadPresenters = nil
+	if err != nil {
+		return err
+	}
+	if module := r.modules[trackingKey]; module != nil {
+		for _, name := range module.PresenterTypes {
+			if !slices.Contains(reload.PresenterTypes, name) {
+				delete(r.presenterTypes, name)
+			}
+		}
+		module.PresenterTypes = reload.PresenterTypes
+	}
+	for _, pt := range staged {
+		r.putPresenterType(pt)
+	}
+	return nil
+}
+
+// putPresenterType registers pt, keeping the metatable of the type it replaces
+// so existing instances see the new table.
+// Must be called with write lock held, from the executor.
+func (r *LuaSession) putPresenterType(pt *PresenterType) {
+	if old, ok := r.presenterTypes[pt.Name]; ok {
+		pt.Metatable = old.Metatable
+	} else {
+		pt.Metatable = r.State.NewTable()
+	}
+	r.State.SetField(pt.Metatable, "__index", pt.Table)
+	r.presenterTypes[pt.Name] = pt
+}
+
 // LoadCode loads and executes Lua code string via executor.
 // It returns the result of the execution (if any).
 // After execution, processes any queued prototype mutations.
@@ -2157,6 +2499,39 @@ func (r *LuaSession) CallMethod(instance *lua.LTable, method string, args ...int
 	})
 }
 
+// ExecuteFunction calls the Lua global function name with args via executor,
+// converting args with GoToLua and the first result with LuaToGo.
+// It must not be called from the executor goroutine.
+func (r *LuaSession) ExecuteFunction(name string, args ...interface{}) (interface{}, error) {
+	return r.execute(func() (interface{}, error) {
+		L := r.State
+
+		fn := L.GetGlobal(name)
+		if fn == lua.LNil {
+			return nil, fmt.Errorf("function %s not found", name)
+		}
+
+		lfn, ok := fn.(*lua.LFunction)
+		if !ok {
+			return nil, fmt.Errorf("%s is not a function", name)
+		}
+
+		L.Push(lfn)
+		for _, arg := range args {
+			L.Push(r.GoToLua(arg))
+		}
+
+		if err := L.PCall(len(args), 1, nil); err != nil {
+			return nil, err
+		}
+
+		result := L.Get(-1)
+		L.Pop(1)
+
+		return LuaToGo(result), nil
+	})
+}
+
 // CallLuaWrapperMethod invokes a method on a Lua wrapper table via executor.
 // Used by LuaWrapper to call computeValue and destroy methods.
 // The instance can be any interface{} but must be a *lua.LTable at runtime.
@@ -2228,10 +2603,8 @@ func (r *LuaSession) CreateInstance(typeName string, props map[string]interface{
 		// Create new instance table
 		instance := L.NewTable()
 
-		// Set metatable to inherit from presenter type
-		mt := L.NewTable()
-		L.SetField(mt, "__index", pt.Table)
-		L.SetMetatable(instance, mt)
+		// Inherit from presenter type
+		L.SetMetatable(instance, pt.Metatable)
 
 		// Set initial properties
 		for k, v := range props {
@@ -2259,6 +2632,34 @@ func (r *LuaSession) CreateInstance(typeName string, props map[string]interface{
 	return result.(*lua.LTable), nil
 }
 
+// itemWrapperType returns the registered presenter type, or auto-discovers a
+// global table of that name. A discovered type follows the global when a
+// reload replaces it. Must be called from the executor.
+func (r *LuaSession) itemWrapperType(typeName string) (*PresenterType, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pt, ok := r.presenterTypes[typeName]
+	if ok && !pt.global {
+		return pt, nil
+	}
+	tbl, isTable := r.State.GetGlobal(typeName).(*lua.LTable)
+	if !isTable {
+		return nil, fmt.Errorf("item wrapper type %s not found", typeName)
+	}
+	if ok && pt.Table == tbl {
+		return pt, nil
+	}
+	pt = &PresenterType{
+		Name:    typeName,
+		Methods: make(map[string]*lua.LFunction),
+		Table:   tbl,
+		global:  true,
+	}
+	r.putPresenterType(pt)
+	r.Log(2, "LuaRuntime: auto-discovered presenter type %s", typeName)
+	return pt, nil
+}
+
 // ItemWrapperInstance represents a created item wrapper (presenter).
 type ItemWrapperInstance struct {
 	instance *lua.LTable
@@ -2273,39 +2674,16 @@ func (r *LuaSession) CreateItemWrapper(typeName string, viewItem *ViewListItem)
 	}
 
 	result, err := r.execute(func() (interface{}, error) {
-		r.mu.RLock()
-		pt, ok := r.presenterTypes[typeName]
-		r.mu.RUnlock()
-
-		if !ok {
-			// Auto-discovery: Check if there's a global table with this name
-			L := r.State
-			val := L.GetGlobal(typeName)
-			if tbl, ok := val.(*lua.LTable); ok {
-				pt = &PresenterType{
-					Name:    typeName,
-					Methods: make(map[string]*lua.LFunction),
-					Table:   tbl,
-				}
-				r.mu.Lock()
-				r.presenterTypes[typeName] = pt
-				r.mu.Unlock()
-
-				r.Log(2, "LuaRuntime: auto-discovered presenter type %s", typeName)
-			} else {
-				return nil, fmt.Errorf("item wrapper type %s not found", typeName)
-			}
+		pt, err := r.itemWrapperType(typeName)
+		if err != nil {
+			return nil, err
 		}
 
 		L := r.State
 
-		// Create new instance table
+		// Create new instance table, inheriting from presenter type
 		instance := L.NewTable()
-
-		// Set metatable to inherit from presenter type
-		mt := L.NewTable()
-		L.SetField(mt, "__index", pt.Table)
-		L.SetMetatable(instance, mt)
+		L.SetMetatable(instance, pt.Metatable)
 
 		// Set ViewListItem properties on the instance
 		// The presenter can access: viewListItem.item, viewListItem.list, viewListItem.index
@@ -2581,60 +2959,3 @@ func (s *LuaSession) ArrayGetter(array any) (func(int) (any, error), int, error)
 		return v.Index(index).Interface(), nil
 	}, v.Len(), nil
 }
-
-// LuaToGo converts a Lua value to Go.
-// Fields prefixed with "_" are skipped (internal/private fields).
-func LuaToGo(val lua.LValue) interface{} {
-	switch v := val.(type) {
-	case lua.LBool:
-		return bool(v)
-	case lua.LNumber:
-		return float64(v)
-	case lua.LString:
-		return string(v)
-	case *lua.LTable:
-		// Count numeric and string keys to determine if array or map
-		hasNumericKeys := false
-		hasStringKeys := false
-		maxN := 0
-		v.ForEach(func(key, _ lua.LValue) {
-			if n, ok := key.(lua.LNumber); ok {
-				hasNumericKeys = true
-				if int(n) > maxN {
-					maxN = int(n)
-				}
-			} else if ks, ok := key.(lua.LString); ok {
-				// Skip internal fields
-				if !strings.HasPrefix(string(ks), "_") {
-					hasStringKeys = true
-				}
-			}
-		})
-
-		// Pure array (only numeric keys)
-		if hasNumericKeys && !hasStringKeys && maxN > 0 {
-			arr := make([]interface{}, maxN)
-			for i := 1; i <= maxN; i++ {
-				arr[i-1] = LuaToGo(v.RawGetInt(i))
-			}
-			return arr
-		}
-
-		// Object (string keys, possibly mixed with numeric)
-		m := make(map[string]interface{})
-		v.ForEach(func(key, value lua.LValue) {
-			if ks, ok := key.(lua.LString); ok {
-				keyStr := string(ks)
-				// Skip internal fields (prefixed with _)
-				if !strings.HasPrefix(keyStr, "_") {
-					m[keyStr] = LuaToGo(value)
-				}
-			}
-		})
-		return m
-	case *lua.LNilType:
-		return nil
-	default:
-		return nil
-	}
-}
@@ -3,6 +3,7 @@ package lua
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 
 	golua "github.com/yuin/gopher-lua"
@@ -1538,3 +1539,136 @@ func TestUnloadDirectory(t *testing.T) {
 		t.Error("Expected directory entry to be removed")
 	}
 }
+
+// newPresenterSession returns a Lua session for presenter type tests.
+func newPresenterSession(t *testing.T, id string) *LuaSession {
+	t.Helper()
+	rt, err := NewRuntime(config.DefaultConfig(), t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	t.Cleanup(rt.Shutdown)
+	rt.SetVariableStore(newMockStore())
+	sess, err := rt.CreateLuaSession(id)
+	if err != nil {
+		t.Fatalf("Failed to create Lua session: %v", err)
+	}
+	return sess
+}
+
+// TestPresenterTypesPerSession verifies two sessions registering different
+// presenters under the same name each keep their own
+func TestPresenterTypesPerSession(t *testing.T) {
+	sessions := []*LuaSession{newPresenterSession(t, "1"), newPresenterSession(t, "2")}
+	for i, sess := range sessions {
+		code := fmt.Sprintf(`ui.registerPresenter("Card", {label = function() return "app%d" end})`, i+1)
+		if _, err := sess.LoadCode("main.lua", code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, sess := range sessions {
+		card, err := sess.CreateInstance("Card", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := fmt.Sprintf("app%d", i+1)
+		if got, err := sess.CallMethod(card, "label"); err != nil || got != want {
+			t.Errorf("session %s label() = %v, %v, want %s", sess.ID, got, err, want)
+		}
+		if names := sess.ListPresenterTypes(); len(names) != 1 || names[0] != "Card" {
+			t.Errorf("session %s presenter types = %v", sess.ID, names)
+		}
+	}
+}
+
+// TestReloadReplacesPresenterTypes verifies a hot reload switches existing
+// instances to the new methods, drops presenters the file no longer
+// registers, keeps the old ones when it fails, and refreshes auto-discovered
+// globals
+func TestReloadReplacesPresenterTypes(t *testing.T) {
+	sess := newPresenterSession(t, "1")
+	reload := func(code string) error {
+		_, err := sess.execute(func() (interface{}, error) {
+			return nil, sess.ReloadDirect("apps/cards.lua", code)
+		})
+		return err
+	}
+	sess.SetCurrentModule("apps/cards.lua", "apps")
+	_, err := sess.LoadCode("apps/cards.lua", `
+		ui.registerPresenter("Card", {label = function() return "v1" end})
+		ui.registerPresenter("Old", {})
+		Row = {label = function() return "row1" end}
+	`)
+	sess.ClearCurrentModule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	card, err := sess.CreateInstance("Card", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := sess.CreateItemWrapper("Row", &ViewListItem{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := reload(`ui.registerPresenter("Card", {label = function() return "v2" end}) error("boom")`); err == nil {
+		t.Fatal("failed reload returned no error")
+	}
+	if got, _ := sess.CallMethod(card, "label"); got != "v1" {
+		t.Errorf("after a failed reload label() = %v, want v1", got)
+	}
+
+	if err := reload(`
+		ui.registerPresenter("Card", {label = function() return "v2" end})
+		Row = {label = function() return "row2" end}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sess.CallMethod(card, "label"); err != nil || got != "v2" {
+		t.Errorf("existing instance label() = %v, %v, want v2", got, err)
+	}
+	if _, ok := sess.GetPresenterType("Old"); ok {
+		t.Error("presenter no longer registered by the file survived the reload")
+	}
+	if names := sess.modules["apps/cards.lua"].PresenterTypes; len(names) != 1 || names[0] != "Card" {
+		t.Errorf("module presenter types = %v, want [Card]", names)
+	}
+	if _, err := sess.CreateItemWrapper("Row", &ViewListItem{}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := sess.CallMethod(row.instance, "label"); err != nil || got != "row2" {
+		t.Errorf("auto-discovered instance label() = %v, %v, want row2", got, err)
+	}
+}
+
+// TestExecuteFunction verifies a Lua global function is called with converted
+// arguments and its result converted back, and missing or non-function
+// globals and Lua errors are reported
+func TestExecuteFunction(t *testing.T) {
+	sess := newPresenterSession(t, "1")
+	_, err := sess.LoadCode("main.lua", `
+		function total(items, extra)
+			local sum = extra
+			for _, n in ipairs(items) do sum = sum + n end
+			return {sum = sum, count = #items}
+		end
+		function fail() error("broken") end
+		answer = 42
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := sess.ExecuteFunction("total", []interface{}{1, 2, 3}, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := got.(map[string]interface{}); !ok || fmt.Sprint(m["sum"], m["count"]) != "10 3" {
+		t.Errorf("total() = %#v, want sum 10 and count 3", got)
+	}
+	for name, want := range map[string]string{"missing": "not found", "answer": "not a function", "fail": "broken"} {
+		if _, err := sess.ExecuteFunction(name); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ExecuteFunction(%s) error = %v, want %q", name, err, want)
+		}
+	}
+}
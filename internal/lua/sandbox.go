@@ -0,0 +1,131 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Lua Sandbox)
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/metrics"
+	"strings"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// Sandbox limits, as named in SandboxError.Limit.
+const (
+	LimitCallDepth = "call depth"
+	LimitMemory    = "memory"
+	LimitCPU       = "cpu timeout"
+	LimitPanic     = "panic"
+)
+
+// memoryCheckInterval is how often a sandboxed task's allocations are sampled.
+const memoryCheckInterval = 10 * time.Millisecond
+
+// SandboxError reports an executor task stopped by a lua.sandbox limit, or a
+// panic recovered while the sandbox is on.
+type SandboxError struct {
+	Limit  string // LimitCallDepth, LimitMemory, LimitCPU or LimitPanic
+	Detail string
+}
+
+func (e *SandboxError) Error() string {
+	return fmt.Sprintf("lua sandbox: %s: %s", e.Limit, e.Detail)
+}
+
+// stateOptions sizes the call stack for lua.sandbox.max_call_depth.
+func stateOptions(cfg *config.Config) []lua.Options {
+	if cfg == nil || cfg.Lua.Sandbox.MaxCallDepth <= 0 {
+		return nil
+	}
+	return []lua.Options{{CallStackSize: cfg.Lua.Sandbox.MaxCallDepth}}
+}
+
+// runSandboxed runs an executor task under the session's sandbox limits.
+// The CPU and memory limits cancel the LState's context, which stops Lua at
+// its next instruction; a task that fails afterwards, overflows the call
+// stack or panics returns a SandboxError.
+func (r *LuaSession) runSandboxed(fn func() (interface{}, error)) (result interface{}, err error) {
+	if r.config == nil || !r.config.Lua.Sandbox.Enabled() {
+		return fn()
+	}
+	limits := r.config.Lua.Sandbox
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil)
+	r.State.SetContext(ctx)
+	defer r.State.RemoveContext()
+
+	if limits.CPUTimeoutSeconds > 0 {
+		timeout := time.Duration(limits.CPUTimeoutSeconds * float64(time.Second))
+		timer := time.AfterFunc(timeout, func() {
+			cancel(&SandboxError{Limit: LimitCPU, Detail: fmt.Sprintf("ran longer than %v", timeout)})
+		})
+		defer timer.Stop()
+	}
+	if limits.MaxMemoryMB > 0 {
+		go watchAllocations(ctx, cancel, uint64(limits.MaxMemoryMB)<<20)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			r.Log(0, "Lua sandbox: recovered panic: %v", p)
+			result, err = nil, &SandboxError{Limit: LimitPanic, Detail: fmt.Sprint(p)}
+		}
+	}()
+	result, err = fn()
+	var stopped *SandboxError
+	if errors.As(context.Cause(ctx), &stopped) {
+		r.Log(0, "Lua sandbox: task stopped: %s: %s", stopped.Limit, stopped.Detail)
+		if err != nil {
+			return nil, stopped
+		}
+	} else if err != nil && limits.MaxCallDepth > 0 && strings.Contains(err.Error(), "stack overflow") {
+		return nil, &SandboxError{Limit: LimitCallDepth, Detail: fmt.Sprintf("more than %d nested calls", limits.MaxCallDepth)}
+	}
+	return result, err
+}
+
+// watchAllocations cancels ctx once the process has allocated more than limit
+// bytes since it started. Allocation counts are process-wide, so other
+// goroutines' allocations count against the task too.
+func watchAllocations(ctx context.Context, cancel context.CancelCauseFunc, limit uint64) {
+	sample := []metrics.Sample{{Name: "/gc/heap/allocs:bytes"}}
+	metrics.Read(sample)
+	start := sample[0].Value.Uint64()
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			metrics.Read(sample)
+			if used := sample[0].Value.Uint64() - start; used > limit {
+				cancel(&SandboxError{Limit: LimitMemory, Detail: fmt.Sprintf("allocated %d MB", used>>20)})
+				return
+			}
+		}
+	}
+}
+
+// withTimeout runs fn with L's context limited to timeout (0 = no limit),
+// keeping any sandbox context as the parent and restoring it afterwards.
+func withTimeout(L *lua.LState, timeout time.Duration, fn func() error) error {
+	if timeout <= 0 {
+		return fn()
+	}
+	parent := L.Context()
+	if parent == nil {
+		parent = context.Background()
+		defer L.RemoveContext()
+	} else {
+		defer L.SetContext(parent)
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	L.SetContext(ctx)
+	return fn()
+}
@@ -0,0 +1,87 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Lua Sandbox)
+package lua
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+const sandboxCode = `
+	function deep(n) if n == 0 then return 0 end return 1 + deep(n - 1) end
+	function spin() while true do end end
+	function hog()
+		local t = {}
+		for i = 1, 1e8 do t[i] = string.rep("x", 1024) .. i end
+	end
+`
+
+func newSandboxSession(t *testing.T, limits config.SandboxConfig) *LuaSession {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Lua.Sandbox = limits
+	rt, err := NewRuntime(cfg, t.TempDir(), nil)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	t.Cleanup(rt.Shutdown)
+	rt.SetVariableStore(newMockStore())
+	sess, err := rt.CreateLuaSession("1")
+	if err != nil {
+		t.Fatalf("Failed to create Lua session: %v", err)
+	}
+	if _, err := sess.LoadCode("main.lua", sandboxCode); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+func wantSandboxError(t *testing.T, err error, limit string) {
+	t.Helper()
+	var sandboxErr *SandboxError
+	if !errors.As(err, &sandboxErr) || sandboxErr.Limit != limit {
+		t.Fatalf("error = %v, want a %s SandboxError", err, limit)
+	}
+}
+
+// TestSandboxCallDepth verifies recursion past max_call_depth fails while
+// shallower calls still work
+func TestSandboxCallDepth(t *testing.T) {
+	sess := newSandboxSession(t, config.SandboxConfig{MaxCallDepth: 50})
+	if got, err := sess.ExecuteFunction("deep", 20); err != nil || got != float64(20) {
+		t.Fatalf("deep(20) = %v, %v", got, err)
+	}
+	_, err := sess.ExecuteFunction("deep", 200)
+	wantSandboxError(t, err, LimitCallDepth)
+}
+
+// TestSandboxCPUTimeout verifies a task running past cpu_timeout_seconds is
+// stopped and the executor keeps serving the session
+func TestSandboxCPUTimeout(t *testing.T) {
+	sess := newSandboxSession(t, config.SandboxConfig{CPUTimeoutSeconds: 0.05})
+	_, err := sess.ExecuteFunction("spin")
+	wantSandboxError(t, err, LimitCPU)
+	if got, err := sess.ExecuteFunction("deep", 3); err != nil || got != float64(3) {
+		t.Errorf("deep(3) after timeout = %v, %v", got, err)
+	}
+}
+
+// TestSandboxMemory verifies a task allocating past max_memory_mb is stopped
+func TestSandboxMemory(t *testing.T) {
+	sess := newSandboxSession(t, config.SandboxConfig{MaxMemoryMB: 16})
+	_, err := sess.ExecuteFunction("hog")
+	wantSandboxError(t, err, LimitMemory)
+}
+
+// TestSandboxPanic verifies a panicking task is recovered as a SandboxError
+// instead of killing the executor
+func TestSandboxPanic(t *testing.T) {
+	sess := newSandboxSession(t, config.SandboxConfig{MaxCallDepth: 100})
+	_, err := sess.execute(func() (interface{}, error) { panic("boom") })
+	wantSandboxError(t, err, LimitPanic)
+	if _, err := sess.ExecuteFunction("deep", 3); err != nil {
+		t.Errorf("executor stopped after panic: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md
+package lua
+
+import (
+	"fmt"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SessionDecision is main.lua's answer to a session request.
+type SessionDecision struct {
+	Deny     bool
+	Status   int    // HTTP status for a denial (0 = server default)
+	Message  string // Response body for a denial
+	Redirect string // Redirect target for an accepted session ("" = the session URL)
+}
+
+// OnSessionRequest calls ui.onSessionRequest(info) if main.lua defined it.
+// Returning false or {deny=true, status=..., message=...} denies the session;
+// {redirect="/path"} accepts it with a different redirect target.
+// The hook runs on the executor and is aborted after timeout (0 = no limit),
+// which is reported as an error so a hung hook cannot block session creation.
+func (r *LuaSession) OnSessionRequest(info map[string]any, timeout time.Duration) (SessionDecision, error) {
+	var decision SessionDecision
+	_, err := r.execute(func() (interface{}, error) {
+		L := r.State
+		ui, ok := L.GetGlobal("ui").(*lua.LTable)
+		if !ok {
+			return nil, nil
+		}
+		hook, ok := L.GetField(ui, "onSessionRequest").(*lua.LFunction)
+		if !ok {
+			return nil, nil
+		}
+		err := withTimeout(L, timeout, func() error {
+			return L.CallByParam(lua.P{Fn: hook, NRet: 1, Protect: true}, r.GoToLua(info))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("ui.onSessionRequest failed: %w", err)
+		}
+		result := L.Get(-1)
+		L.Pop(1)
+		decision = sessionDecision(L, result)
+		return nil, nil
+	})
+	return decision, err
+}
+
+// sessionDecision interprets the hook's return value. Anything but false or a table accepts.
+func sessionDecision(L *lua.LState, result lua.LValue) SessionDecision {
+	switch v := result.(type) {
+	case lua.LBool:
+		return SessionDecision{Deny: !bool(v)}
+	case *lua.LTable:
+		decision := SessionDecision{Deny: lua.LVAsBool(L.GetField(v, "deny"))}
+		if status, ok := L.GetField(v, "status").(lua.LNumber); ok {
+			decision.Status = int(status)
+		}
+		if message, ok := L.GetField(v, "message").(lua.LString); ok {
+			decision.Message = string(message)
+		}
+		if redirect, ok := L.GetField(v, "redirect").(lua.LString); ok {
+			decision.Redirect = string(redirect)
+		}
+		return decision
+	}
+	return SessionDecision{}
+}
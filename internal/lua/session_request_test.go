@@ -0,0 +1,61 @@
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestOnSessionRequest verifies ui.onSessionRequest can deny, redirect, and is cut off by its timeout
+func TestOnSessionRequest(t *testing.T) {
+	rt, err := NewRuntime(config.DefaultConfig(), "/tmp", nil)
+	if err != nil {
+		t.Fatalf("Failed to create runtime: %v", err)
+	}
+	defer rt.Shutdown()
+	rt.SetVariableStore(newMockStore())
+	if _, err := rt.CreateLuaSession("1"); err != nil {
+		t.Fatalf("Failed to create Lua session: %v", err)
+	}
+	define := func(code string) {
+		t.Helper()
+		if _, err := rt.execute(func() (interface{}, error) { return nil, rt.State.DoString(code) }); err != nil {
+			t.Fatalf("Lua execution error: %v", err)
+		}
+	}
+	info := map[string]any{"path": "/", "query": map[string]any{"mode": "kiosk"}}
+
+	// No hook: accept
+	if d, err := rt.OnSessionRequest(info, time.Second); err != nil || d != (SessionDecision{}) {
+		t.Errorf("without hook = %+v, %v", d, err)
+	}
+
+	define(`function ui.onSessionRequest(info) return false end`)
+	if d, _ := rt.OnSessionRequest(info, time.Second); !d.Deny {
+		t.Errorf("false should deny, got %+v", d)
+	}
+
+	define(`function ui.onSessionRequest(info)
+		if info.query.mode == "kiosk" then return {redirect = "/kiosk"} end
+		return {deny = true, status = 503, message = "maintenance"}
+	end`)
+	if d, _ := rt.OnSessionRequest(info, time.Second); d.Deny || d.Redirect != "/kiosk" {
+		t.Errorf("kiosk request = %+v", d)
+	}
+	want := SessionDecision{Deny: true, Status: 503, Message: "maintenance"}
+	if d, _ := rt.OnSessionRequest(map[string]any{"query": map[string]any{}}, time.Second); d != want {
+		t.Errorf("denied request = %+v, want %+v", d, want)
+	}
+
+	// A hung hook is aborted and the session stays usable
+	define(`function ui.onSessionRequest(info) while true do end end`)
+	start := time.Now()
+	if _, err := rt.OnSessionRequest(info, 50*time.Millisecond); err == nil {
+		t.Error("hung hook should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+	define(`ui.onSessionRequest = nil`)
+}
@@ -0,0 +1,167 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Session Hibernation)
+package lua
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// snapshotTypeKey carries a table's prototype name in a snapshot. Fields
+// starting with "_" are private and never snapshotted, so it cannot collide.
+const snapshotTypeKey = "_type"
+
+// Snapshot encodes the app object's data for hibernation: strings, numbers,
+// booleans, and tables, with each table's prototype name. Functions, private
+// ("_") fields, and tables already encoded elsewhere in the tree are left out.
+// Must run on the session executor.
+func (r *LuaSession) Snapshot() (json.RawMessage, error) {
+	if r.appObject == nil {
+		return nil, fmt.Errorf("session %s has no app object", r.ID)
+	}
+	data := r.snapshotValue(r.appObject, make(map[*lua.LTable]bool))
+	return json.Marshal(data)
+}
+
+func (r *LuaSession) snapshotValue(val lua.LValue, seen map[*lua.LTable]bool) any {
+	switch v := val.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		return float64(v)
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if seen[v] {
+			return nil
+		}
+		seen[v] = true
+		if r.isArray(v) {
+			items := make([]any, v.Len())
+			for i := range items {
+				items[i] = r.snapshotValue(v.RawGetInt(i+1), seen)
+			}
+			return items
+		}
+		fields := make(map[string]any)
+		v.ForEach(func(key, value lua.LValue) {
+			name, ok := key.(lua.LString)
+			if !ok || strings.HasPrefix(string(name), "_") {
+				return
+			}
+			if field := r.snapshotValue(value, seen); field != nil {
+				fields[string(name)] = field
+			}
+		})
+		if typ := r.prototypeName(v); typ != "" {
+			fields[snapshotTypeKey] = typ
+		}
+		return fields
+	}
+	return nil
+}
+
+// prototypeName returns the registered prototype obj is an instance of, or "".
+func (r *LuaSession) prototypeName(obj *lua.LTable) string {
+	mt, ok := r.State.GetMetatable(obj).(*lua.LTable)
+	if !ok {
+		return ""
+	}
+	name := lua.LVAsString(r.State.GetField(mt, "type"))
+	if info := r.prototypeRegistry[name]; info == nil || info.prototype != mt {
+		return ""
+	}
+	return name
+}
+
+// Restore merges a Snapshot into the app object main.lua created: tables the
+// app already has are updated in place, keeping their prototypes unless the
+// snapshot names another, and data fields missing from the snapshot are cleared.
+// Must run on the session executor.
+func (r *LuaSession) Restore(data json.RawMessage) error {
+	if r.appObject == nil {
+		return fmt.Errorf("session %s has no app object", r.ID)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("bad snapshot: %w", err)
+	}
+	if err := r.restoreTable(r.appObject, fields); err != nil {
+		return err
+	}
+	r.MarkDirty()
+	return nil
+}
+
+func (r *LuaSession) restoreTable(tbl *lua.LTable, fields map[string]any) error {
+	L := r.State
+	if typ, _ := fields[snapshotTypeKey].(string); typ != "" {
+		info := r.prototypeRegistry[typ]
+		if info == nil {
+			return fmt.Errorf("snapshot type %s is not a registered prototype", typ)
+		}
+		if L.GetMetatable(tbl) != info.prototype {
+			r.createInstance(info.prototype, tbl)
+		}
+	}
+	// Clear data the app holds that was nil when the snapshot was taken
+	var stale []string
+	tbl.ForEach(func(key, value lua.LValue) {
+		name, ok := key.(lua.LString)
+		if !ok || strings.HasPrefix(string(name), "_") {
+			return
+		}
+		switch value.Type() {
+		case lua.LTString, lua.LTNumber, lua.LTBool, lua.LTTable:
+			if _, kept := fields[string(name)]; !kept {
+				stale = append(stale, string(name))
+			}
+		}
+	})
+	for _, name := range stale {
+		tbl.RawSetString(name, lua.LNil)
+	}
+	for name, value := range fields {
+		if name == snapshotTypeKey {
+			continue
+		}
+		sub, isObject := value.(map[string]any)
+		if existing, ok := tbl.RawGetString(name).(*lua.LTable); ok && isObject && !r.isArray(existing) {
+			if err := r.restoreTable(existing, sub); err != nil {
+				return err
+			}
+			continue
+		}
+		restored, err := r.restoreValue(value)
+		if err != nil {
+			return err
+		}
+		tbl.RawSetString(name, restored)
+	}
+	return nil
+}
+
+func (r *LuaSession) restoreValue(value any) (lua.LValue, error) {
+	switch v := value.(type) {
+	case []any:
+		tbl := r.State.NewTable()
+		for i, item := range v {
+			restored, err := r.restoreValue(item)
+			if err != nil {
+				return nil, err
+			}
+			tbl.RawSetInt(i+1, restored)
+		}
+		return tbl, nil
+	case map[string]any:
+		tbl := r.State.NewTable()
+		if err := r.restoreTable(tbl, v); err != nil {
+			return nil, err
+		}
+		return tbl, nil
+	}
+	return r.GoToLua(value), nil
+}
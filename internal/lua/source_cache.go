@@ -0,0 +1,159 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Lua source availability)
+package lua
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// sourcePollInterval is how often an unavailable lua directory is checked for its return.
+var sourcePollInterval = time.Second
+
+// SourceCache remembers the last content read from each Lua source file, so
+// sessions keep loading main.lua and modules while the lua directory is
+// unavailable (e.g. a dropped network mount). One cache is shared by all of a
+// server's sessions.
+type SourceCache struct {
+	config           *config.Config
+	dir              string // The lua directory
+	mu               sync.Mutex
+	files            map[string][]byte // Absolute path -> last content read
+	unavailableSince time.Time         // Zero while the lua directory is reachable
+	listeners        []func(available bool)
+	done             chan struct{}
+	closeOnce        sync.Once
+}
+
+// NewSourceCache creates a source cache for a lua directory.
+func NewSourceCache(cfg *config.Config, dir string) *SourceCache {
+	return &SourceCache{
+		config: cfg,
+		dir:    dir,
+		files:  make(map[string][]byte),
+		done:   make(chan struct{}),
+	}
+}
+
+// OnAvailabilityChange registers a callback for when the lua directory goes away or comes back.
+func (c *SourceCache) OnAvailabilityChange(fn func(available bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// Read returns a source file's content and remembers it. While the lua directory
+// is unavailable the remembered content is returned instead. A failed read of a
+// remembered file while the lua directory itself is gone marks the source unavailable.
+// A nil cache just reads the file.
+func (c *SourceCache) Read(path string) ([]byte, error) {
+	if c == nil {
+		return os.ReadFile(path)
+	}
+	c.mu.Lock()
+	unavailable := !c.unavailableSince.IsZero()
+	cached, ok := c.files[path]
+	c.mu.Unlock()
+
+	if !unavailable {
+		content, err := os.ReadFile(path)
+		if err == nil {
+			c.mu.Lock()
+			c.files[path] = content
+			c.mu.Unlock()
+			return content, nil
+		}
+		if !ok || c.dirPresent() {
+			return nil, err
+		}
+		c.MarkUnavailable()
+	}
+	if ok {
+		return cached, nil
+	}
+	return nil, fmt.Errorf("%s: lua source unavailable: %w", path, fs.ErrNotExist)
+}
+
+// Has reports whether the cache can serve path while the lua directory is unavailable.
+func (c *SourceCache) Has(path string) bool {
+	if c == nil {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.files[path]
+	return ok
+}
+
+// UnavailableSince returns when the lua directory went away, or the zero time.
+func (c *SourceCache) UnavailableSince() time.Time {
+	if c == nil {
+		return time.Time{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.unavailableSince
+}
+
+// MarkUnavailable records that the lua directory is gone and starts watching for
+// its return. Repeated calls while unavailable do nothing, so it logs once.
+func (c *SourceCache) MarkUnavailable() {
+	c.mu.Lock()
+	if !c.unavailableSince.IsZero() {
+		c.mu.Unlock()
+		return
+	}
+	c.unavailableSince = time.Now()
+	listeners := c.listeners
+	c.mu.Unlock()
+
+	c.config.Logger(config.LogLua).Log(0, "Lua source %s unavailable; hot loading paused, serving cached code", c.dir)
+	for _, fn := range listeners {
+		fn(false)
+	}
+	go c.pollForReturn()
+}
+
+// Close stops watching for the lua directory's return.
+func (c *SourceCache) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+func (c *SourceCache) dirPresent() bool {
+	info, err := os.Stat(c.dir)
+	return err == nil && info.IsDir()
+}
+
+// pollForReturn waits for the lua directory to reappear, then drops the cached
+// content (the files may have changed while it was away) and resumes.
+func (c *SourceCache) pollForReturn() {
+	ticker := time.NewTicker(sourcePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			if !c.dirPresent() {
+				continue
+			}
+			c.mu.Lock()
+			since := c.unavailableSince
+			c.unavailableSince = time.Time{}
+			c.files = make(map[string][]byte)
+			listeners := c.listeners
+			c.mu.Unlock()
+
+			c.config.Logger(config.LogLua).Log(0, "Lua source %s available again after %s; cache invalidated", c.dir, time.Since(since).Round(time.Second))
+			for _, fn := range listeners {
+				fn(true)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Spec: deployment.md (Lua source availability)
+package lua
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+func TestSourceCacheUnavailable(t *testing.T) {
+	sourcePollInterval = 10 * time.Millisecond
+	defer func() { sourcePollInterval = time.Second }()
+
+	dir := filepath.Join(t.TempDir(), "lua")
+	os.Mkdir(dir, 0755)
+	main := filepath.Join(dir, "main.lua")
+	os.WriteFile(main, []byte("v1"), 0644)
+
+	cfg := config.DefaultConfig()
+	cfg.Logging.Verbosity = 0
+	c := NewSourceCache(cfg, dir)
+	defer c.Close()
+	availability := make(chan bool, 2)
+	c.OnAvailabilityChange(func(available bool) { availability <- available })
+
+	if content, err := c.Read(main); err != nil || string(content) != "v1" {
+		t.Fatalf("Read = %q, %v", content, err)
+	}
+
+	// A missing file is still an error while the directory is there
+	if _, err := c.Read(filepath.Join(dir, "other.lua")); err == nil || !c.UnavailableSince().IsZero() {
+		t.Fatalf("missing file: err = %v, unavailable since %v", err, c.UnavailableSince())
+	}
+
+	os.RemoveAll(dir)
+	if content, err := c.Read(main); err != nil || string(content) != "v1" {
+		t.Fatalf("cached Read = %q, %v", content, err)
+	}
+	if c.UnavailableSince().IsZero() {
+		t.Fatal("source not marked unavailable")
+	}
+	if available := <-availability; available {
+		t.Fatal("got available, want unavailable")
+	}
+	if _, err := c.Read(filepath.Join(dir, "other.lua")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("uncached Read while unavailable = %v, want ErrNotExist", err)
+	}
+
+	// The directory returns with new content: the cache is dropped
+	os.Mkdir(dir, 0755)
+	os.WriteFile(main, []byte("v2"), 0644)
+	select {
+	case available := <-availability:
+		if !available {
+			t.Fatal("got unavailable, want available")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for the directory to come back")
+	}
+	if content, err := c.Read(main); err != nil || string(content) != "v2" {
+		t.Errorf("Read after return = %q, %v", content, err)
+	}
+}
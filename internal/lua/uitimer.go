@@ -0,0 +1,74 @@
+// CRC: crc-LuaSession.md
+// Spec: session-defer.md (ui.timer and ui.interval)
+package lua
+
+import (
+	"sync"
+	"time"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// addTimerAPI adds ui.timer(delaySeconds, fn) and ui.interval(delaySeconds, fn).
+// Both return a handle table whose cancel() stops future firings.
+func (r *LuaSession) addTimerAPI(uiMod *lua.LTable) {
+	r.setAPI(uiMod, "ui", "timer", r.State.NewFunction(func(L *lua.LState) int {
+		return r.startUITimer(L, "ui.timer", false)
+	}))
+	r.setAPI(uiMod, "ui", "interval", r.State.NewFunction(func(L *lua.LState) int {
+		return r.startUITimer(L, "ui.interval", true)
+	}))
+}
+
+// startUITimer schedules fn through onDefer after the delay, and again every
+// delay if repeat, using the session timer registry so Shutdown cancels it.
+func (r *LuaSession) startUITimer(L *lua.LState, name string, repeat bool) int {
+	seconds := float64(L.CheckNumber(1))
+	fn := L.CheckFunction(2)
+	if seconds < 0 || (repeat && seconds == 0) {
+		L.ArgError(1, "delay must be positive")
+		return 0
+	}
+	if r.onDefer == nil {
+		L.RaiseError("%s: session timers are not available", name)
+		return 0
+	}
+	delay := time.Duration(seconds * float64(time.Second))
+
+	// mu keeps a firing interval from rescheduling a timer cancel just stopped
+	var mu sync.Mutex
+	var timer *time.Timer
+	stopped := false
+	handle := r.allocTimerHandle(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		timer.Stop()
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	timer = time.AfterFunc(delay, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+		select {
+		case <-r.done:
+			return
+		default:
+		}
+		r.scheduleDeferred(handle, fn)
+		if repeat {
+			timer.Reset(delay)
+		}
+	})
+
+	result := L.NewTable()
+	L.SetField(result, "cancel", L.NewFunction(func(L *lua.LState) int {
+		r.cancelTimer(handle)
+		return 0
+	}))
+	L.Push(result)
+	return 1
+}
@@ -0,0 +1,27 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Store Limits)
+package lua
+
+import "math"
+
+// variableOverhead approximates a tracked variable's size apart from its
+// value and properties.
+const variableOverhead = 256
+
+// StoreUsage returns the number of variables in the session's tracker and an
+// estimate of their size in bytes. Must run on the session's executor.
+func (s *LuaSession) StoreUsage() (variables int, bytes int64) {
+	tracker := s.GetTracker()
+	if tracker == nil {
+		return 0, 0
+	}
+	for _, v := range tracker.Variables() {
+		size := variableOverhead + valueSize(v.ValueJSON, math.MaxInt)
+		for name, value := range v.Properties {
+			size += len(name) + len(value)
+		}
+		variables++
+		bytes += int64(size)
+	}
+	return variables, bytes
+}
@@ -7,11 +7,33 @@ package lua
 import (
 	"fmt"
 	"reflect"
+	"slices"
+	"strconv"
 	"sync"
 
 	changetracker "github.com/zot/change-tracker"
 )
 
+// Reserved properties of a windowed ViewList items variable. The frontend sets
+// the viewport; the backend reports where the sent items start and how many
+// items the whole list has.
+const (
+	WindowFirstProp    = "windowFirst"
+	WindowLastProp     = "windowLast"
+	WindowOverscanProp = "windowOverscan"
+	WindowStartProp    = "windowStart"
+	WindowTotalProp    = "windowTotal"
+)
+
+// ViewListWindow is the part of a ViewList's items a windowed variable sends.
+// It serializes as Items alone, but child variables index the whole list by
+// absolute position, so an item's child variable survives leaving the window.
+type ViewListWindow struct {
+	List  *ViewList
+	Start int
+	Items []*ViewListItem
+}
+
 // ViewList transforms an array of domain object refs into ViewListItem refs.
 // It creates ViewListItem objects for each item in the source array.
 type ViewList struct {
@@ -63,6 +85,18 @@ func (vl *ViewList) Value() interface{} {
 	return vl.Items
 }
 
+// HeldObjects returns the source array and the ViewListItems, which the list
+// keeps alive even when its JSON does not mention them, for object collection.
+func (vl *ViewList) HeldObjects() []any {
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+	held := []any{vl.value}
+	for _, item := range vl.Items {
+		held = append(held, item)
+	}
+	return held
+}
+
 // Update updates the ViewList with a new raw value from the backend.
 // ArrayGetter in SyncViewItems handles both Go slices and Lua tables.
 func (vl *ViewList) Update(newValue interface{}) {
@@ -132,6 +166,35 @@ func (vl *ViewList) SyncViewItems() {
 	}
 }
 
+// Window returns the items in the viewport props describe, widened by the
+// overscan on each side, and the list's full length. ok is false when props
+// has no viewport.
+func (vl *ViewList) Window(props map[string]string) (window *ViewListWindow, total int, ok bool) {
+	last, err := strconv.Atoi(props[WindowLastProp])
+	if err != nil {
+		return nil, 0, false
+	}
+	first, _ := strconv.Atoi(props[WindowFirstProp])
+	overscan, _ := strconv.Atoi(props[WindowOverscanProp])
+
+	vl.mu.RLock()
+	defer vl.mu.RUnlock()
+	total = len(vl.Items)
+	end := min(max(last+overscan+1, 0), total)
+	start := min(max(first-overscan, 0), end)
+	return &ViewListWindow{List: vl, Start: start, Items: slices.Clone(vl.Items[start:end])}, total, true
+}
+
+// item returns the item at an absolute index of the list.
+func (w *ViewListWindow) item(index int) (*ViewListItem, error) {
+	w.List.mu.RLock()
+	defer w.List.mu.RUnlock()
+	if index < 0 || index >= len(w.List.Items) {
+		return nil, fmt.Errorf("ViewList index %d out of range", index)
+	}
+	return w.List.Items[index], nil
+}
+
 // destroyListItem cleans up a ViewListItem.
 func (vl *ViewList) destroyListItem(listItem *ViewListItem) {
 	if vl.session != nil {
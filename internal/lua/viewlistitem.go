@@ -77,6 +77,13 @@ func (vli *ViewListItem) SetIndex(index int) {
 	vli.Index = index
 }
 
+// HeldObjects returns the objects the item keeps alive, for object collection.
+func (vli *ViewListItem) HeldObjects() []any {
+	vli.mu.RLock()
+	defer vli.mu.RUnlock()
+	return []any{vli.Item, vli.BaseItem, vli.List}
+}
+
 // init auto-registers the ViewList wrapper when package is imported.
 func init() {
 	RegisterCreateFactory("lua.ViewListItem", reflect.TypeFor[ViewListItem](), func(sess *LuaSession, value any) interface{} {
@@ -21,6 +21,7 @@ const (
 // Returns base property name and priority.
 // Examples: "viewdefs:high" -> ("viewdefs", PriorityHigh)
 //
+//	"data:medium" -> ("data", PriorityMedium), the change tracker's spelling of :med
 //	"name" -> ("name", PriorityMedium)
 func ParsePrioritySuffix(propertyName string) (string, Priority) {
 	if strings.HasSuffix(propertyName, ":high") {
@@ -29,6 +30,9 @@ func ParsePrioritySuffix(propertyName string) (string, Priority) {
 	if strings.HasSuffix(propertyName, ":med") {
 		return strings.TrimSuffix(propertyName, ":med"), PriorityMedium
 	}
+	if strings.HasSuffix(propertyName, ":medium") {
+		return strings.TrimSuffix(propertyName, ":medium"), PriorityMedium
+	}
 	if strings.HasSuffix(propertyName, ":low") {
 		return strings.TrimSuffix(propertyName, ":low"), PriorityLow
 	}
@@ -42,12 +46,13 @@ type PendingChange struct {
 	ValuePriority Priority
 	HasValue      bool
 	Properties    map[string]string     // property name -> value
-	PropPriorities map[string]Priority  // property name -> priority
+	PropPriorities map[string]Priority  // property name -> priority, for names queued with a suffix
 }
 
 // MessageBatcher batches protocol messages by priority.
 type MessageBatcher struct {
 	pending map[int64]*PendingChange
+	rules   []*PriorityRules // Consulted in order for unsuffixed properties
 	mu      sync.Mutex
 }
 
@@ -58,6 +63,14 @@ func NewMessageBatcher() *MessageBatcher {
 	}
 }
 
+// SetPriorityRules sets the rule sets consulted, in order, for properties
+// queued without a priority suffix (session rules before global rules).
+func (b *MessageBatcher) SetPriorityRules(rules ...*PriorityRules) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rules = rules
+}
+
 // getOrCreate returns existing pending change or creates a new one.
 func (b *MessageBatcher) getOrCreate(varID int64) *PendingChange {
 	if pc, ok := b.pending[varID]; ok {
@@ -85,7 +98,8 @@ func (b *MessageBatcher) QueueValue(varID int64, value json.RawMessage, priority
 }
 
 // QueueProperty queues a property change.
-// Property name can include priority suffix (e.g., "viewdefs:high").
+// Property name can include priority suffix (e.g., "viewdefs:high"), which
+// wins over priority rules. Unsuffixed properties are resolved at Flush.
 func (b *MessageBatcher) QueueProperty(varID int64, propertyName, value string) {
 	baseName, priority := ParsePrioritySuffix(propertyName)
 
@@ -94,7 +108,11 @@ func (b *MessageBatcher) QueueProperty(varID int64, propertyName, value string)
 
 	pc := b.getOrCreate(varID)
 	pc.Properties[baseName] = value
-	pc.PropPriorities[baseName] = priority
+	if baseName != propertyName {
+		pc.PropPriorities[baseName] = priority
+	} else {
+		delete(pc.PropPriorities, baseName)
+	}
 }
 
 // QueueProperties queues multiple property changes.
@@ -137,7 +155,10 @@ func (b *MessageBatcher) Flush() []*Message {
 		lowProps := make(map[string]string)
 
 		for name, value := range pc.Properties {
-			priority := pc.PropPriorities[name]
+			priority, explicit := pc.PropPriorities[name]
+			if !explicit {
+				priority = ResolvePropertyPriority(name, pc.Properties["type"], b.rules...)
+			}
 			switch priority {
 			case PriorityHigh:
 				highProps[name] = value
@@ -0,0 +1,48 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"fmt"
+
+	"github.com/zot/ui-engine/internal/backend"
+)
+
+// BenchProperty marks a variable created by `ui bench`.
+// Bench variables live only in the session's tracker: property updates are applied
+// directly and echoed to watchers by normal change detection, without running Lua,
+// so benchmarks measure transport and handler costs only.
+const BenchProperty = "bench"
+
+// isBenchVariable reports whether a variable was created as a bench variable.
+func isBenchVariable(b backend.Backend, varID int64) bool {
+	tracker := b.GetTracker()
+	if tracker == nil {
+		return false
+	}
+	v := tracker.GetVariable(varID)
+	return v != nil && v.Properties[BenchProperty] == "true"
+}
+
+// createBenchVariable creates a root bench variable with the frontend-provided ID.
+func (h *Handler) createBenchVariable(connectionID string, id int64, properties map[string]string) *Response {
+	var b backend.Backend
+	if h.backendLookup != nil {
+		b = h.backendLookup.GetBackendForConnection(connectionID)
+	}
+	if b == nil || b.GetTracker() == nil {
+		return &Response{Error: "session context required for bench variables"}
+	}
+	if b.GetTracker().CreateVariableWithId(id, nil, 0, "", properties) == nil {
+		return &Response{Error: fmt.Sprintf("variable ID %d already in use", id)}
+	}
+	return nil
+}
+
+// updateBenchVariable applies property updates to a bench variable; values are ignored.
+func updateBenchVariable(b backend.Backend, varID int64, properties map[string]string) {
+	v := b.GetTracker().GetVariable(varID)
+	for k, val := range properties {
+		v.SetProperty(k, val)
+	}
+}
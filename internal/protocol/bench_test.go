@@ -0,0 +1,41 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// fixedLookup maps every connection to one backend
+type fixedLookup struct{ b backend.Backend }
+
+func (l fixedLookup) GetBackendForConnection(string) backend.Backend { return l.b }
+
+// TestBenchVariableUpdatesWithoutLua verifies bench variables are stored and updated in the tracker directly
+func TestBenchVariableUpdatesWithoutLua(t *testing.T) {
+	cfg := config.DefaultConfig()
+	b := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	h := NewHandler(cfg, nil)
+	h.SetBackendLookup(fixedLookup{b})
+
+	create, _ := NewMessage(MsgCreate, CreateMessage{ID: 1000000, Properties: map[string]string{BenchProperty: "true"}})
+	if resp, _ := h.HandleMessage("c1", create); resp != nil && resp.Error != "" {
+		t.Fatalf("create failed: %s", resp.Error)
+	}
+	update, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 1000000, Properties: map[string]string{"seq": "7"}})
+	if resp, _ := h.HandleMessage("c1", update); resp != nil && resp.Error != "" {
+		t.Fatalf("update failed: %s", resp.Error)
+	}
+	if got := b.GetTracker().GetVariable(1000000).Properties["seq"]; got != "7" {
+		t.Errorf("seq = %q, want 7", got)
+	}
+
+	// Reusing the ID is an error
+	if resp, _ := h.HandleMessage("c1", create); resp == nil || resp.Error == "" {
+		t.Error("expected error creating a duplicate bench variable")
+	}
+}
@@ -0,0 +1,54 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestWatchRootBeforeCreate verifies a watch on variable 1 before a backend creates
+// it is answered as pending and resolved once the variable appears
+func TestWatchRootBeforeCreate(t *testing.T) {
+	cfg := config.DefaultConfig()
+	b := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	h := NewHandler(cfg, nil)
+	h.SetBackendLookup(fixedLookup{b})
+
+	watch, _ := NewMessage(MsgWatch, WatchMessage{VarID: 1})
+	resp, err := h.HandleMessage("c1", watch)
+	if err != nil {
+		t.Fatalf("watch on missing variable 1 failed: %v", err)
+	}
+	if result, _ := resp.Result.(map[string]bool); !result["pending"] {
+		t.Fatalf("watch result = %+v, want pending", resp.Result)
+	}
+	if resolved := b.ResolveDeferredWatches(); len(resolved) != 0 {
+		t.Fatalf("resolved %v before variable 1 exists", resolved)
+	}
+
+	// Other missing variables are still errors
+	watch, _ = NewMessage(MsgWatch, WatchMessage{VarID: 5})
+	if _, err := h.HandleMessage("c1", watch); err == nil {
+		t.Error("watch on missing variable 5 accepted")
+	}
+
+	tracker := b.GetTracker()
+	tracker.CreateVariable(map[string]any{"count": 1}, 0, "", map[string]string{"type": "App"})
+	tracker.DetectChanges()
+	tracker.GetChanges()
+	if resolved := b.ResolveDeferredWatches(); len(resolved) != 1 || resolved[0] != 1 {
+		t.Fatalf("resolved = %v, want [1]", resolved)
+	}
+	tracker.DetectChanges()
+	changes := tracker.GetChanges()
+	if len(changes) != 1 || changes[0].VariableID != 1 || !changes[0].ValueChanged {
+		t.Errorf("changes after resolve = %+v, want a full update of variable 1", changes)
+	}
+	if resolved := b.ResolveDeferredWatches(); len(resolved) != 0 {
+		t.Errorf("deferred watch resolved twice: %v", resolved)
+	}
+}
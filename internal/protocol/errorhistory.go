@@ -0,0 +1,118 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Error History)
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrorRecord is one error a connection was sent: an error response to one of
+// its messages (Type set) or an error message (Code set).
+type ErrorRecord struct {
+	Time        time.Time   `json:"time"`
+	Type        MessageType `json:"type,omitempty"` // Message the error answered
+	VarID       int64       `json:"varId,omitempty"`
+	Code        string      `json:"code,omitempty"`
+	Description string      `json:"description"`
+}
+
+// ErrorsResponse answers getErrors with the requesting connection's recent
+// errors, oldest first.
+type ErrorsResponse struct {
+	Errors []ErrorRecord `json:"errors"`
+}
+
+// ConnectionError is an ErrorRecord reported to telemetry, naming the
+// connection it was sent to.
+type ConnectionError struct {
+	Connection string
+	ErrorRecord
+}
+
+func (e *ConnectionError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("%s: %s", e.Code, e.Description)
+	}
+	return e.Description
+}
+
+// errorHistory keeps the last errors of each connection.
+type errorHistory struct {
+	mu    sync.Mutex
+	conns map[string][]ErrorRecord
+}
+
+// add appends rec to a connection's history, keeping at most size records.
+func (e *errorHistory) add(connectionID string, rec ErrorRecord, size int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.conns == nil {
+		e.conns = make(map[string][]ErrorRecord)
+	}
+	records := append(e.conns[connectionID], rec)
+	if len(records) > size {
+		records = append(records[:0:0], records[len(records)-size:]...)
+	}
+	e.conns[connectionID] = records
+}
+
+func (e *errorHistory) list(connectionID string) []ErrorRecord {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]ErrorRecord{}, e.conns[connectionID]...)
+}
+
+func (e *errorHistory) forget(connectionID string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.conns, connectionID)
+}
+
+// RecordError adds an error sent to a connection to its history and reports it
+// to telemetry with the connection's session. Nothing is kept when
+// session.error_history is 0.
+func (h *Handler) RecordError(connectionID string, rec ErrorRecord) {
+	size := h.config.Session.ErrorHistory
+	if size <= 0 {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	h.errors.add(connectionID, rec, size)
+	sessionID := ""
+	if h.backendLookup != nil {
+		if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil {
+			sessionID = b.GetSessionID()
+		}
+	}
+	h.telemetry.OnError(sessionID, &ConnectionError{Connection: connectionID, ErrorRecord: rec})
+}
+
+// ForgetConnection drops a closed connection's error history.
+func (h *Handler) ForgetConnection(connectionID string) {
+	h.errors.forget(connectionID)
+}
+
+// recordResponseError records a message's error response, with the variable
+// the message named.
+func (h *Handler) recordResponseError(connectionID string, msg *Message, description string) {
+	var target struct {
+		ID    int64 `json:"id"`
+		VarID int64 `json:"varId"`
+	}
+	json.Unmarshal(msg.Data, &target)
+	if target.VarID == 0 {
+		target.VarID = target.ID
+	}
+	h.RecordError(connectionID, ErrorRecord{Type: msg.Type, VarID: target.VarID, Description: description})
+}
+
+// handleGetErrors returns the requesting connection's error history. A
+// connection only ever sees its own errors.
+func (h *Handler) handleGetErrors(connectionID string) (*Response, error) {
+	return &Response{Result: ErrorsResponse{Errors: h.errors.list(connectionID)}}, nil
+}
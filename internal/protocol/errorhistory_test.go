@@ -0,0 +1,64 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Error History)
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+func getErrors(t *testing.T, h *Handler, connectionID string) []ErrorRecord {
+	t.Helper()
+	resp, err := h.HandleMessage(connectionID, &Message{Type: MsgGetErrors})
+	if err != nil || resp == nil || resp.Error != "" {
+		t.Fatalf("getErrors = %+v, %v", resp, err)
+	}
+	return resp.Result.(ErrorsResponse).Errors
+}
+
+// TestErrorHistory verifies each connection keeps only its own last errors,
+// reported to telemetry with the connection, and loses them on disconnect
+func TestErrorHistory(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Session.ErrorHistory = 2
+	h := NewHandler(cfg, nil)
+	h.SetBackendLookup(fixedLookup{backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())})
+	h.SetQueuer(&recordingQueuer{sent: map[string][]*Message{}})
+	ring := NewEventRing(10)
+	h.SetTelemetry(ring)
+
+	poll := &Message{Type: MsgPoll, Data: json.RawMessage(`{}`)}
+	h.HandleMessage("c1", poll)
+	watch, _ := NewMessage(MsgWatch, WatchMessage{VarID: 1})
+	h.HandleMessage("c1", watch) // Pending: no variable 1 yet
+	h.SendError("c1", 7, "bad path")
+	h.HandleMessage("c2", poll)
+
+	got := getErrors(t, h, "c1")
+	if len(got) != 2 {
+		t.Fatalf("c1 errors = %+v, want the last 2", got)
+	}
+	if got[0].Code != "pending" || got[0].VarID != 1 || got[1].VarID != 7 || got[1].Description != "bad path" || got[1].Time.IsZero() {
+		t.Errorf("c1 errors = %+v", got)
+	}
+	if got := getErrors(t, h, "c2"); len(got) != 1 || got[0].Type != MsgPoll {
+		t.Errorf("c2 errors = %+v, want only its poll error", got)
+	}
+
+	var buf bytes.Buffer
+	ring.WriteNDJSON(&buf)
+	if !strings.Contains(buf.String(), `"session":"1","error":"pending: waiting for backend to create variable 1","connection":"c1"`) {
+		t.Errorf("events lack the connection's error:\n%s", buf.String())
+	}
+
+	h.ForgetConnection("c1")
+	if got := getErrors(t, h, "c1"); len(got) != 0 {
+		t.Errorf("errors after disconnect = %+v", got)
+	}
+}
@@ -4,9 +4,12 @@ package protocol
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/zot/ui-engine/internal/backend"
 	"github.com/zot/ui-engine/internal/config"
@@ -21,7 +24,9 @@ type MessageSender interface {
 // PendingQueuer is an interface for pending message queues.
 type PendingQueuer interface {
 	Enqueue(connectionID string, msg *Message)
-	Poll(connectionID string, wait time.Duration) []*Message
+	// Poll returns pending messages, up to the limits, and advice for the
+	// connection's next poll. maxWait caps the suggested wait (0 for the server default).
+	Poll(connectionID string, wait, maxWait time.Duration, limits PollLimits) ([]*Message, PollHint)
 }
 
 // PathVariableHandler handles frontend-created path variables.
@@ -33,7 +38,56 @@ type PathVariableHandler interface {
 
 	// HandleFrontendUpdate handles an update to a path-based variable from frontend.
 	// Updates the backend object via the variable's path and returns error if any.
-	HandleFrontendUpdate(sessionID string, varID int64, value json.RawMessage, properties map[string]string) error
+	// connectionID is the sender, so the resulting change is not echoed back to it.
+	// removed names properties to delete.
+	HandleFrontendUpdate(sessionID, connectionID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error
+}
+
+// FlagSetter applies runtime feature flag changes to live sessions.
+type FlagSetter interface {
+	// SetSessionFlags merges flags into a session (all sessions if sessionID is empty).
+	SetSessionFlags(sessionID string, flags map[string]any) error
+}
+
+// Flusher settles a session for flush messages from backends.
+type Flusher interface {
+	// FlushSession returns once work queued on the session's executor has run and
+	// the resulting updates have been handed to its connections.
+	FlushSession(sessionID string) error
+}
+
+// SessionUpdater applies updates from backends that name a session.
+type SessionUpdater interface {
+	// UpdateSession updates a session's variable (vended ID) on its executor,
+	// notifies the variable's Lua watchers and schedules change detection.
+	UpdateSession(sessionID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error
+}
+
+// RootLister reports a session's named root variables for getRoots messages.
+type RootLister interface {
+	// SessionRoots returns root names mapped to variable IDs, and the meta root's ID.
+	SessionRoots(sessionID string) (map[string]int64, int64, error)
+}
+
+// ChangeNotifier is told when a message may have changed a session's variables,
+// so the session's next change detection is not skipped.
+type ChangeNotifier interface {
+	// SessionChanged marks a session (vended ID) as having pending work.
+	SessionChanged(sessionID string)
+}
+
+// RetryAdvisor tells clients how long to back off while the server is loaded or draining.
+type RetryAdvisor interface {
+	// Draining reports whether the server is shutting down.
+	Draining() bool
+	// RetryAfter returns a jittered retry delay scaled to current load.
+	RetryAfter() time.Duration
+}
+
+// DrainChecker refuses creates in sessions whose drain grace period is over.
+type DrainChecker interface {
+	// RefusesCreates reports whether a session (vended ID) refuses new variables.
+	RefusesCreates(sessionID string) bool
 }
 
 // BackendLookup provides per-connection backend lookup.
@@ -59,13 +113,27 @@ type Handler struct {
 	queuer              MessageQueuer
 	pending             PendingQueuer
 	pathVariableHandler PathVariableHandler // For path-based frontend creates
+	metrics             *HandlerMetrics     // nil disables timing
+	flagSetter          FlagSetter
+	flusher             Flusher
+	sessionUpdater      SessionUpdater
+	rootLister          RootLister
+	changeNotifier      ChangeNotifier
+	retryAdvisor        RetryAdvisor // nil disables retry hints
+	telemetry           TelemetryHook
+	allowlist           *PropertyAllowlist // Properties strict mode accepts
+	diagRecorder        DiagRecorder
+	drainChecker        DrainChecker
+	errors              errorHistory // Recent errors per connection, for getErrors
+	tracer              SessionTracer
 }
 
 // NewHandler creates a new protocol handler.
 func NewHandler(cfg *config.Config, sender MessageSender) *Handler {
 	return &Handler{
-		config: cfg,
-		sender: sender,
+		config:    cfg,
+		sender:    sender,
+		telemetry: NopTelemetry{},
 	}
 }
 
@@ -90,21 +158,150 @@ func (h *Handler) SetPathVariableHandler(handler PathVariableHandler) {
 	h.pathVariableHandler = handler
 }
 
+// SetFlagSetter sets the target for setFlags messages.
+func (h *Handler) SetFlagSetter(setter FlagSetter) {
+	h.flagSetter = setter
+}
+
+// SetTracer sets the target for trace messages and the source of session traces.
+func (h *Handler) SetTracer(tracer SessionTracer) {
+	h.tracer = tracer
+}
+
+// SetFlusher sets the target for flush messages.
+func (h *Handler) SetFlusher(flusher Flusher) {
+	h.flusher = flusher
+}
+
+// SetSessionUpdater sets the target for updates from backends that name a session.
+func (h *Handler) SetSessionUpdater(updater SessionUpdater) {
+	h.sessionUpdater = updater
+}
+
+// SetRootLister sets the source for getRoots messages.
+func (h *Handler) SetRootLister(lister RootLister) {
+	h.rootLister = lister
+}
+
+// SetChangeNotifier sets the target told about messages that can change variables.
+func (h *Handler) SetChangeNotifier(notifier ChangeNotifier) {
+	h.changeNotifier = notifier
+}
+
+// SetDrainChecker sets the check that refuses creates in drained sessions.
+func (h *Handler) SetDrainChecker(checker DrainChecker) {
+	h.drainChecker = checker
+}
+
+// SetRetryAdvisor sets the source of retry hints for draining and overloaded responses.
+func (h *Handler) SetRetryAdvisor(advisor RetryAdvisor) {
+	h.retryAdvisor = advisor
+}
+
+// SetTelemetry sets the hook receiving server events. Hook panics are recovered
+// and logged; pass nil to disable.
+func (h *Handler) SetTelemetry(hook TelemetryHook) {
+	if hook == nil {
+		h.telemetry = NopTelemetry{}
+		return
+	}
+	h.telemetry = guardedTelemetry{hook: hook, config: h.config}
+}
+
+// Telemetry returns the guarded telemetry hook (a no-op when none is set).
+func (h *Handler) Telemetry() TelemetryHook {
+	return h.telemetry
+}
+
+// SetMetrics enables per-message-type timing. Pass nil to disable.
+func (h *Handler) SetMetrics(metrics *HandlerMetrics) {
+	h.metrics = metrics
+}
+
+// Metrics returns the handler metrics, or nil if disabled.
+func (h *Handler) Metrics() *HandlerMetrics {
+	return h.metrics
+}
+
 // Log logs a message via the config.
 func (h *Handler) Log(level int, format string, args ...interface{}) {
-	h.config.Log(level, format, args...)
+	h.config.Logger(config.LogProtocol).Log(level, format, args...)
 }
 
 // HandleMessage processes an incoming protocol message.
 func (h *Handler) HandleMessage(connectionID string, msg *Message) (*Response, error) {
 	// Log message (verbosity level 2: abbreviated, level 4: complete)
 	msgType := strings.ToUpper(string(msg.Type))
-	if h.config.Verbosity() >= 4 {
-		h.Log(4, "[IN] %s: from=%s data=%s", msgType, connectionID, string(msg.Data))
+	if trace := h.ConnectionTrace(connectionID); trace != nil {
+		trace.Logf("[IN] %s: from=%s data=%s", msgType, connectionID, h.config.Sanitize(string(msg.Data)))
+	} else if h.config.ComponentVerbosity(config.LogProtocol) >= 4 {
+		h.Log(4, "[IN] %s: from=%s data=%s", msgType, connectionID, h.config.Sanitize(string(msg.Data)))
 	} else {
 		h.Log(2, "[IN] %s: from=%s", msgType, connectionID)
 	}
+	h.notifyChange(connectionID, msg.Type)
+
+	resp, err := h.timedDispatch(connectionID, msg)
+	if resp != nil && resp.Error != "" {
+		h.recordResponseError(connectionID, msg, resp.Error)
+	}
+	return resp, err
+}
+
+// timedDispatch dispatches a message, reporting its timing to metrics and
+// telemetry when either is enabled.
+func (h *Handler) timedDispatch(connectionID string, msg *Message) (*Response, error) {
+	if _, off := h.telemetry.(NopTelemetry); off && h.metrics == nil {
+		return h.dispatch(connectionID, msg)
+	}
+	start := time.Now()
+	resp, err := h.dispatch(connectionID, msg)
+	elapsed := time.Since(start)
+	failure := err
+	if failure == nil && resp != nil && resp.Error != "" {
+		failure = errors.New(resp.Error)
+	}
+	if h.metrics != nil {
+		h.metrics.Record(msg.Type, elapsed, failure != nil)
+	}
+	h.telemetry.OnMessage(msg.Type, elapsed, failure)
+	return resp, err
+}
 
+// notifyChange marks the connection's session as having pending work, unless the
+// message only reads (get, poll, flush and the like).
+func (h *Handler) notifyChange(connectionID string, msgType MessageType) {
+	switch msgType {
+	case MsgGet, MsgGetObjects, MsgPoll, MsgFlush, MsgGetRoots, MsgGetErrors, MsgTrace:
+		return
+	}
+	if h.changeNotifier == nil || h.backendLookup == nil {
+		return
+	}
+	if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil {
+		h.changeNotifier.SessionChanged(b.GetSessionID())
+	}
+}
+
+// dispatch routes a message to its type-specific handler.
+// Strict messages with unknown fields are rejected before reaching it.
+func (h *Handler) dispatch(connectionID string, msg *Message) (*Response, error) {
+	if h.isStrict(msg) {
+		if err := validateFields(msg); err != nil {
+			h.Log(1, "Rejected %s from %s: %v", msg.Type, connectionID, err)
+			return &Response{Error: err.Error()}, nil
+		}
+		resp, err := h.dispatchMessage(connectionID, msg)
+		if err == nil && (resp == nil || resp.Error == "") {
+			h.checkMessageProperties(connectionID, msg)
+		}
+		return resp, err
+	}
+	return h.dispatchMessage(connectionID, msg)
+}
+
+// dispatchMessage calls a message's type-specific handler.
+func (h *Handler) dispatchMessage(connectionID string, msg *Message) (*Response, error) {
 	switch msg.Type {
 	case MsgCreate:
 		return h.handleCreate(connectionID, msg.Data)
@@ -116,6 +313,18 @@ func (h *Handler) HandleMessage(connectionID string, msg *Message) (*Response, e
 		return h.handleWatch(connectionID, msg.Data)
 	case MsgUnwatch:
 		return h.handleUnwatch(connectionID, msg.Data)
+	case MsgPoll:
+		return h.handlePoll(connectionID, msg.Data)
+	case MsgSetFlags:
+		return h.handleSetFlags(msg.Data)
+	case MsgFlush:
+		return h.handleFlush(msg.Data)
+	case MsgGetRoots:
+		return h.handleGetRoots(connectionID, msg.Data)
+	case MsgGetErrors:
+		return h.handleGetErrors(connectionID)
+	case MsgTrace:
+		return h.handleTrace(connectionID, msg.Data)
 	default:
 		return nil, fmt.Errorf("unknown message type: %s", msg.Type)
 	}
@@ -135,8 +344,24 @@ func (h *Handler) handleCreate(connectionID string, data json.RawMessage) (*Resp
 	if id == 0 {
 		return &Response{Error: "create message must include id"}, nil
 	}
+	if resp := h.validateMessageProperties(connectionID, id, data, msg.Properties, nil); resp != nil {
+		return resp, nil
+	}
+	if h.drainChecker != nil && h.backendLookup != nil {
+		if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil && h.drainChecker.RefusesCreates(b.GetSessionID()) {
+			return &Response{Error: "DRAINING: session is shutting down"}, nil
+		}
+	}
 
-	if h.pathVariableHandler != nil {
+	if msg.Unbound {
+		if resp := h.createUnboundVariable(connectionID, &msg); resp != nil {
+			return resp, nil
+		}
+	} else if msg.Properties[BenchProperty] == "true" {
+		if resp := h.createBenchVariable(connectionID, id, msg.Properties); resp != nil {
+			return resp, nil
+		}
+	} else if h.pathVariableHandler != nil {
 		// Path-based variable: delegate to Lua runtime
 		var sessionID string
 		if h.backendLookup != nil {
@@ -157,9 +382,14 @@ func (h *Handler) handleCreate(connectionID string, data json.RawMessage) (*Resp
 	}
 
 	// Auto-watch unless nowatch is set
-	if !msg.NoWatch && h.backendLookup != nil {
+	if h.backendLookup != nil {
 		if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil {
-			b.Watch(id, connectionID)
+			if !msg.NoWatch {
+				b.Watch(id, connectionID)
+			} else if v := b.GetTracker().GetVariable(id); v != nil {
+				// Unwatched tracker variables are skipped by change detection until watched
+				v.SetActive(false)
+			}
 		}
 	}
 
@@ -216,6 +446,18 @@ func (h *Handler) handleUpdate(connectionID string, data json.RawMessage) (*Resp
 	if err := json.Unmarshal(data, &msg); err != nil {
 		return nil, err
 	}
+	if resp := h.validateMessageProperties(connectionID, msg.VarID, data, msg.Properties, msg.RemoveProperties); resp != nil {
+		return resp, nil
+	}
+	if !utf8.Valid(data) {
+		// Forward the decoded message, where invalid UTF-8 is replaced
+		data, _ = json.Marshal(msg)
+	}
+
+	var storeStart time.Time
+	if h.metrics != nil {
+		storeStart = time.Now()
+	}
 
 	// Get backend for this connection
 	var b backend.Backend
@@ -223,15 +465,53 @@ func (h *Handler) handleUpdate(connectionID string, data json.RawMessage) (*Resp
 		b = h.backendLookup.GetBackendForConnection(connectionID)
 	}
 
+	// A backend's update goes to the session it names
+	if b == nil && msg.Session != "" && h.sessionUpdater != nil {
+		if err := h.sessionUpdater.UpdateSession(msg.Session, msg.VarID, msg.Value, msg.Properties, msg.RemoveProperties); err != nil {
+			h.Log(0, "ERROR, handleUpdate: session %s update failed for var %d: %v", msg.Session, msg.VarID, err)
+			return &Response{Error: err.Error()}, nil
+		}
+		return &Response{}, nil
+	}
+
+	// Removing the inactive property reactivates the variable
+	reactivate := slices.Contains(msg.RemoveProperties, "inactive")
+	if b != nil && reactivate {
+		b.SetInactive(msg.VarID, false)
+	}
+
 	// Check if variable is inactive
 	if b != nil && b.IsInactive(msg.VarID) {
 		// Silently ignore updates to inactive variables
 		return &Response{}, nil
 	}
 
-	// Handle inactive property
-	if inactive, ok := msg.Properties["inactive"]; ok && b != nil {
-		b.SetInactive(msg.VarID, inactive != "")
+	// Handle inactive property: any value, even "", makes the variable inactive
+	if _, ok := msg.Properties["inactive"]; ok && b != nil && !reactivate {
+		b.SetInactive(msg.VarID, true)
+	}
+
+	// Unbound variables: store the update and forward it without touching Lua
+	if b != nil && b.UpdateUnbound(msg.VarID, msg.Value, msg.Properties, msg.RemoveProperties) {
+		h.forwardUnbound(b, connectionID, msg.VarID, data)
+		if h.metrics != nil {
+			h.metrics.RecordUpdateBreakdown(0, time.Since(storeStart))
+		}
+		return &Response{}, nil
+	}
+
+	// Bench variables echo property updates without Lua
+	if b != nil && isBenchVariable(b, msg.VarID) {
+		updateBenchVariable(b, msg.VarID, msg.Properties)
+		if h.metrics != nil {
+			h.metrics.RecordUpdateBreakdown(0, time.Since(storeStart))
+		}
+		return &Response{}, nil
+	}
+
+	var storeTime time.Duration
+	if h.metrics != nil {
+		storeTime = time.Since(storeStart)
 	}
 
 	if h.pathVariableHandler != nil {
@@ -242,10 +522,20 @@ func (h *Handler) handleUpdate(connectionID string, data json.RawMessage) (*Resp
 		if sessionID == "" {
 			return &Response{Error: "session context required for path variables"}, nil
 		}
-		if err := h.pathVariableHandler.HandleFrontendUpdate(sessionID, msg.VarID, msg.Value, msg.Properties); err != nil {
+		var luaStart time.Time
+		if h.metrics != nil {
+			luaStart = time.Now()
+		}
+		err := h.pathVariableHandler.HandleFrontendUpdate(sessionID, connectionID, msg.VarID, msg.Value, msg.Properties, msg.RemoveProperties)
+		if h.metrics != nil {
+			h.metrics.RecordUpdateBreakdown(time.Since(luaStart), storeTime)
+		}
+		if err != nil {
 			h.Log(0, "ERROR, handleUpdate: backend update failed for var %d: %v", msg.VarID, err)
 			return &Response{Error: err.Error()}, nil
 		}
+	} else if h.metrics != nil {
+		h.metrics.RecordUpdateBreakdown(0, storeTime)
 	}
 
 	return &Response{}, nil
@@ -270,7 +560,15 @@ func (h *Handler) handleWatch(connectionID string, data json.RawMessage) (*Respo
 		return nil, fmt.Errorf("no backend for connection %s", connectionID)
 	}
 
+	if u := b.GetUnbound(msg.VarID); u != nil {
+		h.sendUnbound(connectionID, u)
+		return &Response{}, nil
+	}
+
 	v := b.GetTracker().GetVariable(msg.VarID)
+	if v == nil && msg.VarID == 1 {
+		return h.deferRootWatch(connectionID, b), nil
+	}
 	if v == nil {
 		return nil, fmt.Errorf("variable %d not found", msg.VarID)
 	}
@@ -293,6 +591,29 @@ func (h *Handler) handleWatch(connectionID string, data json.RawMessage) (*Respo
 	return resp, nil
 }
 
+// deferRootWatch answers a watch on variable 1 before any backend has created it.
+// The watch stays registered and is resolved by change detection once variable 1
+// appears; meanwhile the frontend gets a "pending" error it clears on the first update.
+func (h *Handler) deferRootWatch(connectionID string, b backend.Backend) *Response {
+	h.Log(2, "Session %s: watch on variable 1 before it exists, deferring", b.GetSessionID())
+	b.DeferWatch(1)
+	notice := ErrorMessage{
+		VarID:       1,
+		Code:        "pending",
+		Description: "waiting for backend to create variable 1",
+	}
+	pending, err := NewMessage(MsgError, notice)
+	h.RecordError(connectionID, ErrorRecord{VarID: notice.VarID, Code: notice.Code, Description: notice.Description})
+	if err == nil {
+		if h.queuer != nil {
+			h.queuer.Queue(pending, []string{connectionID})
+		} else if h.sender != nil {
+			h.sender.Send(connectionID, pending)
+		}
+	}
+	return &Response{Result: map[string]bool{"pending": true}}
+}
+
 // handleUnwatch processes an unwatch message.
 func (h *Handler) handleUnwatch(connectionID string, data json.RawMessage) (*Response, error) {
 	var msg WatchMessage
@@ -316,6 +637,113 @@ func (h *Handler) handleUnwatch(connectionID string, data json.RawMessage) (*Res
 	return resp, nil
 }
 
+// handlePoll returns pending messages for a polling client, long-polling up to the requested wait.
+// A draining server answers immediately with a retry hint instead of holding the poll open.
+func (h *Handler) handlePoll(connectionID string, data json.RawMessage) (*Response, error) {
+	var msg PollMessage
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, err
+		}
+	}
+	if h.pending == nil {
+		return &Response{Error: "polling not available"}, nil
+	}
+
+	if msg.MaxMessages < 0 || msg.MaxBytes < 0 {
+		return &Response{Error: "maxMessages and maxBytes must not be negative"}, nil
+	}
+	limits := PollLimits{MaxMessages: msg.MaxMessages, MaxBytes: msg.MaxBytes}
+
+	if h.retryAdvisor != nil && h.retryAdvisor.Draining() {
+		msgs, hint := h.pending.Poll(connectionID, 0, 0, limits)
+		return &Response{
+			Result:       msgs,
+			RetryAfterMs: h.retryAdvisor.RetryAfter().Milliseconds(),
+			More:         hint.More,
+		}, nil
+	}
+
+	var wait, maxWait time.Duration
+	var err error
+	if msg.Wait != "" {
+		if wait, err = time.ParseDuration(msg.Wait); err != nil {
+			return &Response{Error: fmt.Sprintf("invalid wait %q: %v", msg.Wait, err)}, nil
+		}
+	}
+	if msg.MaxWait != "" {
+		if maxWait, err = time.ParseDuration(msg.MaxWait); err != nil {
+			return &Response{Error: fmt.Sprintf("invalid maxWait %q: %v", msg.MaxWait, err)}, nil
+		}
+	}
+	msgs, hint := h.pending.Poll(connectionID, wait, maxWait, limits)
+	return &Response{
+		Result:          msgs,
+		SuggestedWaitMs: hint.SuggestedWait.Milliseconds(),
+		Backoff:         hint.Backoff,
+		More:            hint.More,
+	}, nil
+}
+
+// handleSetFlags processes a setFlags message from a backend.
+func (h *Handler) handleSetFlags(data json.RawMessage) (*Response, error) {
+	var msg SetFlagsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if h.flagSetter == nil {
+		return &Response{Error: "feature flags not available"}, nil
+	}
+	if err := h.flagSetter.SetSessionFlags(msg.Session, msg.Flags); err != nil {
+		return &Response{Error: err.Error()}, nil
+	}
+	return &Response{}, nil
+}
+
+// handleFlush processes a flush message from a backend, which names the session to settle.
+// WebSocket connections flush their own session in the endpoint instead.
+func (h *Handler) handleFlush(data json.RawMessage) (*Response, error) {
+	var msg FlushMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Session == "" {
+		return &Response{Error: "flush requires a session"}, nil
+	}
+	if h.flusher == nil {
+		return &Response{Error: "flush not available"}, nil
+	}
+	if err := h.flusher.FlushSession(msg.Session); err != nil {
+		return &Response{Error: err.Error()}, nil
+	}
+	return &Response{Result: FlushResponse{}}, nil
+}
+
+// handleGetRoots processes a getRoots message. A backend names the session;
+// a connection without one asks about its own.
+func (h *Handler) handleGetRoots(connectionID string, data json.RawMessage) (*Response, error) {
+	var msg GetRootsMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if msg.Session == "" && h.backendLookup != nil {
+		if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil {
+			msg.Session = b.GetSessionID()
+		}
+	}
+	if msg.Session == "" {
+		return &Response{Error: "getRoots requires a session"}, nil
+	}
+	if h.rootLister == nil {
+		return &Response{Error: "getRoots not available"}, nil
+	}
+	roots, meta, err := h.rootLister.SessionRoots(msg.Session)
+	if err != nil {
+		return &Response{Error: err.Error()}, nil
+	}
+	return &Response{Result: RootsResponse{Roots: roots, Meta: meta}}, nil
+}
+
 // SendError sends an error message to a connection.
 // Routes through queuer when available to maintain message ordering.
 func (h *Handler) SendError(connectionID string, varID int64, description string) error {
@@ -326,6 +754,7 @@ func (h *Handler) SendError(connectionID string, varID int64, description string
 	if err != nil {
 		return err
 	}
+	h.RecordError(connectionID, ErrorRecord{VarID: varID, Description: description})
 	if h.queuer != nil {
 		h.queuer.Queue(msg, []string{connectionID})
 		return nil
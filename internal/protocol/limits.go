@@ -0,0 +1,131 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Property Limits)
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// ValidationPrefix starts the error of a message a property limit rejected.
+const ValidationPrefix = "VALIDATION: "
+
+// CheckProperty checks one property value against the limits: its size, and
+// that it is valid UTF-8 unless invalid sequences are replaced.
+func CheckProperty(limits config.PropertyLimitsConfig, name, value string) error {
+	baseName, _ := ParsePrioritySuffix(name)
+	limit := limits.MaxSize
+	if baseName == "viewdefs" {
+		limit = limits.MaxViewdefsSize
+	}
+	if limit > 0 && int64(len(value)) > limit {
+		return fmt.Errorf("property %q is %d bytes, over the %d byte limit", name, len(value), limit)
+	}
+	if limits.InvalidUTF8 != config.InvalidUTF8Replace && !utf8.ValidString(value) {
+		return fmt.Errorf("property %q is not valid UTF-8", name)
+	}
+	return nil
+}
+
+// CheckProperties checks properties set on a variable that now has existing
+// (nil for a new one), with removed then deleted: each value, and the total
+// size of the variable's values. The viewdefs property, capped on its own,
+// does not count toward the total.
+func CheckProperties(limits config.PropertyLimitsConfig, properties, existing map[string]string, removed []string) error {
+	for _, name := range slices.Sorted(maps.Keys(properties)) {
+		if err := CheckProperty(limits, name, properties[name]); err != nil {
+			return err
+		}
+	}
+	if limits.MaxTotal <= 0 {
+		return nil
+	}
+	merged := maps.Clone(existing)
+	if merged == nil {
+		merged = make(map[string]string, len(properties))
+	}
+	for name, value := range properties {
+		baseName, _ := ParsePrioritySuffix(name)
+		merged[baseName] = value
+	}
+	for _, name := range removed {
+		baseName, _ := ParsePrioritySuffix(name)
+		delete(merged, baseName)
+	}
+	delete(merged, "viewdefs")
+	total := int64(0)
+	for _, value := range merged {
+		total += int64(len(value))
+	}
+	if total > limits.MaxTotal {
+		return fmt.Errorf("properties total %d bytes, over the %d byte limit", total, limits.MaxTotal)
+	}
+	return nil
+}
+
+// ReplaceInvalidUTF8 replaces invalid UTF-8 in property values with U+FFFD,
+// reporting whether any value changed.
+func ReplaceInvalidUTF8(properties map[string]string) bool {
+	changed := false
+	for name, value := range properties {
+		if !utf8.ValidString(value) {
+			properties[name] = strings.ToValidUTF8(value, "\uFFFD")
+			changed = true
+		}
+	}
+	return changed
+}
+
+// validateMessageProperties checks the properties a create or update sets
+// before anything is stored, so a rejected message changes nothing. JSON
+// decoding already replaced invalid UTF-8, so data's raw values are checked.
+func (h *Handler) validateMessageProperties(connectionID string, varID int64, data json.RawMessage, properties map[string]string, removed []string) *Response {
+	limits := h.config.Session.Properties
+	if limits.InvalidUTF8 != config.InvalidUTF8Replace {
+		var raw struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		}
+		json.Unmarshal(data, &raw)
+		for _, name := range slices.Sorted(maps.Keys(raw.Properties)) {
+			if !utf8.Valid(raw.Properties[name]) {
+				return h.rejectProperties(connectionID, varID, fmt.Errorf("property %q is not valid UTF-8", name))
+			}
+		}
+	}
+	var existing map[string]string
+	if h.backendLookup != nil {
+		if b := h.backendLookup.GetBackendForConnection(connectionID); b != nil {
+			existing = variableProperties(b, varID)
+		}
+	}
+	if err := CheckProperties(limits, properties, existing, removed); err != nil {
+		return h.rejectProperties(connectionID, varID, err)
+	}
+	return nil
+}
+
+// rejectProperties logs a property limit violation and returns its response.
+func (h *Handler) rejectProperties(connectionID string, varID int64, err error) *Response {
+	h.Log(1, "Rejected properties of variable %d from %s: %v", varID, connectionID, err)
+	return &Response{Error: ValidationPrefix + err.Error()}
+}
+
+// variableProperties returns a variable's current properties, or nil.
+func variableProperties(b backend.Backend, varID int64) map[string]string {
+	if tracker := b.GetTracker(); tracker != nil {
+		if v := tracker.GetVariable(varID); v != nil {
+			return v.Properties
+		}
+	}
+	if u := b.GetUnbound(varID); u != nil {
+		return u.Properties
+	}
+	return nil
+}
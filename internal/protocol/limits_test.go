@@ -0,0 +1,107 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Property Limits)
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestCheckProperties verifies the size limits at their exact boundaries, the
+// separate viewdefs cap, the per-variable total and invalid UTF-8 handling
+func TestCheckProperties(t *testing.T) {
+	limits := config.PropertyLimitsConfig{MaxSize: 10, MaxViewdefsSize: 20, MaxTotal: 25, InvalidUTF8: config.InvalidUTF8Reject}
+	existing := map[string]string{"a": strings.Repeat("a", 10), "b": strings.Repeat("b", 10)}
+	tests := []struct {
+		name       string
+		properties map[string]string
+		existing   map[string]string
+		removed    []string
+		wantErr    string
+	}{
+		{"at size limit", map[string]string{"x": strings.Repeat("x", 10)}, nil, nil, ""},
+		{"over size limit", map[string]string{"x": strings.Repeat("x", 11)}, nil, nil, `"x" is 11 bytes`},
+		{"suffixed over size limit", map[string]string{"x:high": strings.Repeat("x", 11)}, nil, nil, `"x:high" is 11 bytes`},
+		{"viewdefs at own limit", map[string]string{"viewdefs": strings.Repeat("v", 20)}, existing, nil, ""},
+		{"viewdefs over own limit", map[string]string{"viewdefs": strings.Repeat("v", 21)}, nil, nil, `"viewdefs" is 21 bytes`},
+		{"at total limit", map[string]string{"c": strings.Repeat("c", 5)}, existing, nil, ""},
+		{"over total limit", map[string]string{"c": strings.Repeat("c", 6)}, existing, nil, "total 26 bytes"},
+		{"replacing counts once", map[string]string{"a:low": strings.Repeat("a", 10), "c": strings.Repeat("c", 5)}, existing, nil, ""},
+		{"removal frees room", map[string]string{"c": strings.Repeat("c", 10)}, existing, []string{"b"}, ""},
+		{"invalid UTF-8", map[string]string{"x": "a\xffb"}, nil, nil, `"x" is not valid UTF-8`},
+		{"valid multibyte", map[string]string{"x": "héllo"}, nil, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckProperties(limits, tt.properties, tt.existing, tt.removed)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("error = %v, want none", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+	limits.InvalidUTF8 = config.InvalidUTF8Replace
+	if err := CheckProperties(limits, map[string]string{"x": "a\xffb"}, nil, nil); err != nil {
+		t.Errorf("replace mode rejected invalid UTF-8: %v", err)
+	}
+}
+
+// TestPropertyLimitsAtBoundary verifies creates and updates at the default
+// limits, and that a rejected update applies none of its changes
+func TestPropertyLimitsAtBoundary(t *testing.T) {
+	h, b, lua, _ := newUnboundTestHandler()
+	maxSize := int(h.config.Session.Properties.MaxSize)
+	send := func(msgType MessageType, data string) *Response {
+		t.Helper()
+		resp, err := h.HandleMessage("c1", &Message{Type: msgType, Data: json.RawMessage(data)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	props := func(sizes ...int) string {
+		var parts []string
+		for i, size := range sizes {
+			parts = append(parts, `"p`+string(rune('a'+i))+`":"`+strings.Repeat("x", size)+`"`)
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+
+	if resp := send(MsgCreate, `{"id":2,"properties":`+props(maxSize)+`}`); resp.Error != "" {
+		t.Fatalf("create at the size limit: %s", resp.Error)
+	}
+	if resp := send(MsgCreate, `{"id":3,"properties":`+props(maxSize+1)+`}`); !strings.HasPrefix(resp.Error, ValidationPrefix) {
+		t.Errorf("create over the size limit = %q, want a validation error", resp.Error)
+	}
+	if b.GetTracker().GetVariable(3) != nil {
+		t.Error("rejected create made a variable")
+	}
+
+	// Four values at the size limit exactly fill the 1 MB total
+	if resp := send(MsgCreate, `{"id":4,"properties":`+props(maxSize, maxSize, maxSize, maxSize)+`}`); resp.Error != "" {
+		t.Fatalf("create at the total limit: %s", resp.Error)
+	}
+	updates := len(lua.updates)
+	if resp := send(MsgUpdate, `{"varId":4,"properties":{"inactive":"","extra":"x"}}`); !strings.Contains(resp.Error, "total") {
+		t.Errorf("update over the total = %q, want a total error", resp.Error)
+	}
+	if len(lua.updates) != updates || b.IsInactive(4) {
+		t.Error("rejected update was partly applied")
+	}
+
+	if resp := send(MsgUpdate, `{"varId":2,"properties":{"label":"ab`+"\xff"+`cd"}}`); resp.Error != ValidationPrefix+`property "label" is not valid UTF-8` {
+		t.Errorf("invalid UTF-8 = %q", resp.Error)
+	}
+	h.config.Session.Properties.InvalidUTF8 = config.InvalidUTF8Replace
+	send(MsgCreate, `{"id":5,"unbound":true}`)
+	if resp := send(MsgUpdate, `{"varId":5,"properties":{"label":"ab`+"\xff"+`cd"}}`); resp.Error != "" {
+		t.Fatalf("replace mode rejected invalid UTF-8: %s", resp.Error)
+	}
+	if u := b.GetUnbound(5); u == nil || u.Properties["label"] != "ab\uFFFDcd" {
+		t.Errorf("unbound properties = %v, want the invalid byte replaced", u)
+	}
+}
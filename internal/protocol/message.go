@@ -5,6 +5,7 @@ package protocol
 
 import (
 	"encoding/json"
+	"time"
 )
 
 // MessageType identifies the type of protocol message.
@@ -19,18 +20,27 @@ const (
 	MsgUnwatch MessageType = "unwatch"
 
 	// Server-response messages
-	MsgError MessageType = "error"
+	MsgError    MessageType = "error"
+	MsgShutdown MessageType = "shutdown" // Server going down; reconnect after retryAfterMs
 
 	// UI server-handled messages (not relayed)
 	MsgGet        MessageType = "get"
 	MsgGetObjects MessageType = "getObjects"
 	MsgPoll       MessageType = "poll"
+	MsgSetFlags   MessageType = "setFlags"
+	MsgFlush      MessageType = "flush"
+	MsgGetRoots   MessageType = "getRoots"
+	MsgGetErrors  MessageType = "getErrors"
+	MsgTrace      MessageType = "trace"
 )
 
 // Message is the base protocol message structure.
+// Strict opts the message into strict checking when the server is not strict.
 type Message struct {
-	Type MessageType     `json:"type"`
-	Data json.RawMessage `json:"data,omitempty"`
+	Type   MessageType     `json:"type"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Strict bool            `json:"strict,omitempty"`
+	Client string          `json:"client,omitempty"` // Backend socket client identity, e.g. "cli@host"
 }
 
 // CreateMessage represents a create variable request.
@@ -50,10 +60,53 @@ type DestroyMessage struct {
 }
 
 // UpdateMessage represents an update variable request.
+// An empty property value is stored as ""; RemoveProperties deletes properties.
+// A backend names the session; connections of a session leave Session empty.
 type UpdateMessage struct {
-	VarID      int64             `json:"varId"`
-	Value      json.RawMessage   `json:"value,omitempty"`
-	Properties map[string]string `json:"properties,omitempty"`
+	Session          string            `json:"session,omitempty"`
+	VarID            int64             `json:"varId"`
+	Value            json.RawMessage   `json:"value,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+	RemoveProperties []string          `json:"removeProperties,omitempty"`
+}
+
+// SetFlagsMessage changes feature flags on live sessions.
+// An empty Session targets all sessions; a null flag value removes the flag.
+type SetFlagsMessage struct {
+	Session string         `json:"session,omitempty"`
+	Flags   map[string]any `json:"flags"`
+}
+
+// FlushMessage asks the server to settle a session before responding.
+// WebSocket connections flush their own session and leave Session empty.
+type FlushMessage struct {
+	Session string `json:"session,omitempty"`
+}
+
+// FlushResponse is the result of a flush. Seq counts the frames the server had
+// written on the requesting WebSocket connection before the response, so every
+// update caused by earlier work arrived at or before frame Seq.
+type FlushResponse struct {
+	Seq int64 `json:"seq,omitempty"`
+}
+
+// GetRootsMessage asks for a session's named root variables.
+// WebSocket connections ask about their own session and leave Session empty.
+type GetRootsMessage struct {
+	Session string `json:"session,omitempty"`
+}
+
+// RootsResponse maps root names to variable IDs. Meta is the root that
+// carries viewdefs and flags.
+type RootsResponse struct {
+	Roots map[string]int64 `json:"roots"`
+	Meta  int64            `json:"meta,omitempty"`
+}
+
+// ConnectResponse answers POST /{session-id}/connect with a polling connection ID,
+// passed as ?conn= on /api calls.
+type ConnectResponse struct {
+	Connection string `json:"connection"`
 }
 
 // WatchMessage represents a watch/unwatch request.
@@ -96,21 +149,53 @@ type ObjectData struct {
 
 // PollMessage represents a poll for pending responses request.
 type PollMessage struct {
-	Wait string `json:"wait,omitempty"` // Duration string for long-polling
+	Wait        string `json:"wait,omitempty"`        // Duration string for long-polling
+	MaxWait     string `json:"maxWait,omitempty"`     // Longest wait the client accepts as a hint
+	MaxMessages int    `json:"maxMessages,omitempty"` // Most messages to return (0 = server default)
+	MaxBytes    int    `json:"maxBytes,omitempty"`    // Most message bytes to return (0 = server default)
+}
+
+// PollLimits caps the messages one poll returns (0 = server default).
+// A poll always returns at least one message when any are queued.
+type PollLimits struct {
+	MaxMessages int
+	MaxBytes    int
+}
+
+// PollHint advises a polling client how long to wait on its next poll.
+// Backoff is set when the connection has been idle for several polls, and the
+// suggested wait then grows past the requested one. More is set when the
+// limits left messages queued, so the client should poll again at once.
+type PollHint struct {
+	SuggestedWait time.Duration
+	Backoff       bool
+	More          bool
 }
 
 // ErrorMessage represents an error response.
 // Spec: protocol.md - error(varId, code, description)
 type ErrorMessage struct {
-	VarID       int64  `json:"varId,omitempty"`
-	Code        string `json:"code"`        // One-word error code (e.g., "path-failure", "not-found", "unauthorized")
-	Description string `json:"description"` // Human-readable error description
+	VarID        int64  `json:"varId,omitempty"`
+	Code         string `json:"code"`                   // One-word error code (e.g., "path-failure", "not-found", "unauthorized")
+	Description  string `json:"description"`            // Human-readable error description
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"` // Suggested delay before reconnecting or retrying
+}
+
+// ShutdownMessage tells a client the server is shutting down.
+type ShutdownMessage struct {
+	Reason       string `json:"reason"`
+	RetryAfterMs int64  `json:"retryAfterMs,omitempty"` // Suggested delay before reconnecting
 }
 
 // Response wraps handler responses (primarily for error reporting).
 type Response struct {
-	Result interface{} `json:"result,omitempty"`
-	Error  string      `json:"error,omitempty"`
+	Result       interface{} `json:"result,omitempty"`
+	Error        string      `json:"error,omitempty"`
+	RetryAfterMs int64       `json:"retryAfterMs,omitempty"` // Set when the server is overloaded or draining
+	// Poll responses only: advice for the next poll
+	SuggestedWaitMs int64 `json:"suggestedWaitMs,omitempty"`
+	Backoff         bool  `json:"backoff,omitempty"`
+	More            bool  `json:"more,omitempty"` // Messages are still queued; poll again without waiting
 }
 
 // BatchWrapper wraps a batch of messages with a userEvent flag.
@@ -0,0 +1,220 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// metricBuckets are the upper bounds of the latency histogram buckets.
+// Observations above the last bound land in an overflow bucket.
+var metricBuckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// histogram is a fixed-bucket latency histogram.
+type histogram struct {
+	counts []int64 // len(metricBuckets)+1, last is overflow
+	count  int64
+	total  time.Duration
+	max    time.Duration
+}
+
+func newHistogram() *histogram {
+	return &histogram{counts: make([]int64, len(metricBuckets)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := sort.Search(len(metricBuckets), func(i int) bool { return d <= metricBuckets[i] })
+	h.counts[i]++
+	h.count++
+	h.total += d
+	if d > h.max {
+		h.max = d
+	}
+}
+
+// quantile returns the upper bound of the bucket holding the q-th observation.
+// The overflow bucket reports the largest observed duration.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			if i < len(metricBuckets) {
+				return metricBuckets[i]
+			}
+			break
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) stats() TimingStats {
+	var mean time.Duration
+	if h.count > 0 {
+		mean = h.total / time.Duration(h.count)
+	}
+	return TimingStats{
+		Count:  h.count,
+		MeanMs: durationMs(mean),
+		P50Ms:  durationMs(h.quantile(0.50)),
+		P95Ms:  durationMs(h.quantile(0.95)),
+		MaxMs:  durationMs(h.max),
+	}
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// messageStats holds counters for one message type.
+type messageStats struct {
+	errors int64
+	timing *histogram
+}
+
+// HandlerMetrics records per-message-type handler timing and error counts.
+// A nil *HandlerMetrics on the Handler disables recording entirely.
+// CRC: crc-ProtocolHandler.md
+type HandlerMetrics struct {
+	types       map[MessageType]*messageStats
+	updateLua   *histogram            // time inside the path variable handler (Lua executor)
+	updateStore *histogram            // time in backend store operations
+	timings     map[string]*histogram // named durations, e.g. afterBatch
+	counters    map[string]int64
+	mu          sync.Mutex
+}
+
+// NewHandlerMetrics creates an empty metrics recorder.
+func NewHandlerMetrics() *HandlerMetrics {
+	return &HandlerMetrics{
+		types:       make(map[MessageType]*messageStats),
+		updateLua:   newHistogram(),
+		updateStore: newHistogram(),
+		timings:     make(map[string]*histogram),
+		counters:    make(map[string]int64),
+	}
+}
+
+// AddCount adds n to a named counter (e.g. "orphanedWatches.found").
+func (m *HandlerMetrics) AddCount(name string, n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += n
+}
+
+// Record adds one handled message of the given type.
+func (m *HandlerMetrics) Record(msgType MessageType, d time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.types[msgType]
+	if st == nil {
+		st = &messageStats{timing: newHistogram()}
+		m.types[msgType] = st
+	}
+	st.timing.observe(d)
+	if failed {
+		st.errors++
+	}
+}
+
+// Observe adds a duration to a named timing (e.g. "afterBatch").
+func (m *HandlerMetrics) Observe(name string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	h := m.timings[name]
+	if h == nil {
+		h = newHistogram()
+		m.timings[name] = h
+	}
+	h.observe(d)
+}
+
+// RecordUpdateBreakdown adds the downstream timing of one update message.
+func (m *HandlerMetrics) RecordUpdateBreakdown(lua, store time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.updateLua.observe(lua)
+	m.updateStore.observe(store)
+}
+
+// TimingStats summarizes a latency histogram.
+type TimingStats struct {
+	Count  int64   `json:"count"`
+	MeanMs float64 `json:"meanMs"`
+	P50Ms  float64 `json:"p50Ms"`
+	P95Ms  float64 `json:"p95Ms"`
+	MaxMs  float64 `json:"maxMs"`
+}
+
+// MessageTypeStats summarizes one message type.
+type MessageTypeStats struct {
+	TimingStats
+	Errors int64 `json:"errors"`
+}
+
+// UpdateBreakdown splits update handling time between Lua and the store.
+type UpdateBreakdown struct {
+	Lua   TimingStats `json:"lua"`
+	Store TimingStats `json:"store"`
+}
+
+// MetricsSnapshot is a point-in-time copy of the handler metrics.
+type MetricsSnapshot struct {
+	Messages map[MessageType]MessageTypeStats `json:"messages"`
+	Update   UpdateBreakdown                  `json:"update"`
+	Timings  map[string]TimingStats           `json:"timings,omitempty"`
+	Counters map[string]int64                 `json:"counters,omitempty"`
+}
+
+// Snapshot returns the current metrics.
+func (m *HandlerMetrics) Snapshot() MetricsSnapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := MetricsSnapshot{
+		Messages: make(map[MessageType]MessageTypeStats, len(m.types)),
+		Update: UpdateBreakdown{
+			Lua:   m.updateLua.stats(),
+			Store: m.updateStore.stats(),
+		},
+	}
+	if len(m.counters) > 0 {
+		snap.Counters = make(map[string]int64, len(m.counters))
+		for name, n := range m.counters {
+			snap.Counters[name] = n
+		}
+	}
+	if len(m.timings) > 0 {
+		snap.Timings = make(map[string]TimingStats, len(m.timings))
+		for name, h := range m.timings {
+			snap.Timings[name] = h.stats()
+		}
+	}
+	for typ, st := range m.types {
+		snap.Messages[typ] = MessageTypeStats{TimingStats: st.timing.stats(), Errors: st.errors}
+	}
+	return snap
+}
@@ -0,0 +1,135 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestHistogramQuantiles verifies p50/p95 come from bucket upper bounds
+func TestHistogramQuantiles(t *testing.T) {
+	h := newHistogram()
+	for i := 0; i < 90; i++ {
+		h.observe(80 * time.Microsecond) // 100µs bucket
+	}
+	for i := 0; i < 10; i++ {
+		h.observe(20 * time.Millisecond) // 25ms bucket
+	}
+
+	if got := h.quantile(0.50); got != 100*time.Microsecond {
+		t.Errorf("p50 = %v, want 100µs", got)
+	}
+	if got := h.quantile(0.95); got != 25*time.Millisecond {
+		t.Errorf("p95 = %v, want 25ms", got)
+	}
+
+	h.observe(3 * time.Second) // overflow bucket reports max
+	if got := h.quantile(1.0); got != 3*time.Second {
+		t.Errorf("p100 = %v, want 3s", got)
+	}
+}
+
+// TestHandlerRecordsMetricsByType verifies counts and errors are grouped by message type
+func TestHandlerRecordsMetricsByType(t *testing.T) {
+	h := NewHandler(config.DefaultConfig(), nil)
+	metrics := NewHandlerMetrics()
+	h.SetMetrics(metrics)
+
+	// Create without id yields a response error
+	create, _ := NewMessage(MsgCreate, CreateMessage{})
+	h.HandleMessage("c1", create)
+	// Unwatch with no backend succeeds
+	unwatch, _ := NewMessage(MsgUnwatch, WatchMessage{VarID: 1})
+	h.HandleMessage("c1", unwatch)
+	h.HandleMessage("c1", unwatch)
+	// Unknown type returns an error
+	h.HandleMessage("c1", &Message{Type: "bogus", Data: json.RawMessage(`{}`)})
+
+	snap := metrics.Snapshot()
+	if st := snap.Messages[MsgCreate]; st.Count != 1 || st.Errors != 1 {
+		t.Errorf("create stats = %+v, want count=1 errors=1", st)
+	}
+	if st := snap.Messages[MsgUnwatch]; st.Count != 2 || st.Errors != 0 {
+		t.Errorf("unwatch stats = %+v, want count=2 errors=0", st)
+	}
+	if st := snap.Messages["bogus"]; st.Errors != 1 {
+		t.Errorf("unknown type errors = %d, want 1", st.Errors)
+	}
+}
+
+// TestHandlerUpdateBreakdown verifies updates record Lua and store timing
+func TestHandlerUpdateBreakdown(t *testing.T) {
+	h := NewHandler(config.DefaultConfig(), nil)
+	metrics := NewHandlerMetrics()
+	h.SetMetrics(metrics)
+
+	update, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 2, Value: json.RawMessage(`1`)})
+	h.HandleMessage("c1", update)
+
+	snap := metrics.Snapshot()
+	if snap.Update.Store.Count != 1 {
+		t.Errorf("store breakdown count = %d, want 1", snap.Update.Store.Count)
+	}
+	if snap.Messages[MsgUpdate].Count != 1 {
+		t.Errorf("update count = %d, want 1", snap.Messages[MsgUpdate].Count)
+	}
+}
+
+// TestHandlerWithoutMetrics verifies the disabled path does not record
+func TestHandlerWithoutMetrics(t *testing.T) {
+	h := NewHandler(config.DefaultConfig(), nil)
+	if h.Metrics() != nil {
+		t.Fatal("metrics should be disabled by default")
+	}
+	unwatch, _ := NewMessage(MsgUnwatch, WatchMessage{VarID: 1})
+	if _, err := h.HandleMessage("c1", unwatch); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// TestWritePrometheus verifies create and update messages, counters and gauges
+// appear in the text exposition format
+func TestWritePrometheus(t *testing.T) {
+	h := NewHandler(config.DefaultConfig(), nil)
+	metrics := NewHandlerMetrics()
+	h.SetMetrics(metrics)
+
+	create, _ := NewMessage(MsgCreate, CreateMessage{})
+	h.HandleMessage("c1", create)
+	update, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 2, Value: json.RawMessage(`1`)})
+	h.HandleMessage("c1", update)
+	h.HandleMessage("c1", update)
+	metrics.AddCount("orphanedWatches.found", 3)
+	metrics.Observe("afterBatch", 2*time.Millisecond)
+
+	var out strings.Builder
+	metrics.WritePrometheus(&out, map[string]int64{"viewdefs.Todo.sent": 4}, []Gauge{
+		{Name: "ui_connections", Help: "Connections.", Labels: map[string]string{"transport": "websocket"}, Value: 2},
+		{Name: "ui_connections", Labels: map[string]string{"transport": "polling"}, Value: 1},
+	})
+	text := out.String()
+	for _, want := range []string{
+		`ui_messages_total{type="create"} 1`,
+		`ui_messages_total{type="update"} 2`,
+		`ui_message_errors_total{type="create"} 1`,
+		`ui_message_duration_seconds_bucket{type="update",le="+Inf"} 2`,
+		`ui_update_duration_seconds_count{part="store"} 2`,
+		`ui_after_batch_duration_seconds_bucket{le="0.0025"} 1`,
+		`ui_orphaned_watches_found_total 3`,
+		`ui_viewdefs_todo_sent_total 4`,
+		"# TYPE ui_connections gauge\n",
+		`ui_connections{transport="polling"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+	if strings.Count(text, "# TYPE ui_connections") != 1 {
+		t.Errorf("gauge family written more than once:\n%s", text)
+	}
+}
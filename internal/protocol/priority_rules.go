@@ -0,0 +1,115 @@
+// CRC: crc-MessageBatcher.md
+// Spec: protocol.md (Priority Rules)
+package protocol
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// PriorityRules gives default priorities to properties and variable types, for
+// updates whose property names carry no priority suffix.
+// Property rules win over type rules.
+type PriorityRules struct {
+	mu         sync.RWMutex
+	properties map[string]Priority // property name -> priority
+	types      map[string]Priority // variable type -> priority
+}
+
+// NewPriorityRules creates an empty rule set.
+func NewPriorityRules() *PriorityRules {
+	return &PriorityRules{
+		properties: make(map[string]Priority),
+		types:      make(map[string]Priority),
+	}
+}
+
+// ParsePriority converts "high", "med"/"medium", or "low" to a Priority.
+func ParsePriority(name string) (Priority, error) {
+	switch strings.ToLower(name) {
+	case "high":
+		return PriorityHigh, nil
+	case "med", "medium":
+		return PriorityMedium, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	return PriorityMedium, fmt.Errorf("unknown priority %q (want high, med, or low)", name)
+}
+
+// HasPrioritySuffix reports whether a property name carries an explicit
+// :high, :med, or :low suffix.
+func HasPrioritySuffix(propertyName string) bool {
+	baseName, _ := ParsePrioritySuffix(propertyName)
+	return baseName != propertyName
+}
+
+// SetProperty makes name default to priority on every variable.
+func (r *PriorityRules) SetProperty(name string, priority Priority) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.properties[name] = priority
+}
+
+// SetType makes the value and properties of variables of type typ default to priority.
+func (r *PriorityRules) SetType(typ string, priority Priority) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.types[typ] = priority
+}
+
+// Empty reports whether there are no rules. A nil rule set is empty.
+func (r *PriorityRules) Empty() bool {
+	if r == nil {
+		return true
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.properties) == 0 && len(r.types) == 0
+}
+
+// Property returns the rule for a property name, if any.
+func (r *PriorityRules) Property(name string) (Priority, bool) {
+	if r == nil {
+		return PriorityMedium, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	priority, ok := r.properties[name]
+	return priority, ok
+}
+
+// Type returns the rule for a variable type, if any.
+func (r *PriorityRules) Type(typ string) (Priority, bool) {
+	if r == nil || typ == "" {
+		return PriorityMedium, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	priority, ok := r.types[typ]
+	return priority, ok
+}
+
+// ResolvePropertyPriority returns the priority for an unsuffixed property of a
+// variable of type typ. Rule sets are consulted in order (session before global),
+// property rules before type rules. Returns PriorityMedium when no rule matches.
+func ResolvePropertyPriority(name, typ string, rules ...*PriorityRules) Priority {
+	for _, set := range rules {
+		if priority, ok := set.Property(name); ok {
+			return priority
+		}
+	}
+	return ResolveTypePriority(typ, rules...)
+}
+
+// ResolveTypePriority returns the priority for a variable's value by its type.
+// Returns PriorityMedium when no rule matches.
+func ResolveTypePriority(typ string, rules ...*PriorityRules) Priority {
+	for _, set := range rules {
+		if priority, ok := set.Type(typ); ok {
+			return priority
+		}
+	}
+	return PriorityMedium
+}
@@ -0,0 +1,133 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md (Metrics)
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Gauge is a point-in-time value written after the handler metrics.
+type Gauge struct {
+	Name   string            // e.g. ui_sessions
+	Help   string            // written once per name
+	Labels map[string]string // nil for none
+	Value  float64
+}
+
+// labelEscaper escapes label values for the text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// WritePrometheus writes the metrics in the Prometheus text exposition format
+// (version 0.0.4), followed by counters (added to the recorded ones) and
+// gauges. Gauges sharing a name must be adjacent.
+func (m *HandlerMetrics) WritePrometheus(w io.Writer, counters map[string]int64, gauges []Gauge) error {
+	var b bytes.Buffer
+	m.mu.Lock()
+	types := slices.Sorted(maps.Keys(m.types))
+	writeHeader(&b, "ui_messages_total", "counter", "Protocol messages handled, by type.")
+	for _, typ := range types {
+		fmt.Fprintf(&b, "ui_messages_total{%s} %d\n", labelPair("type", string(typ)), m.types[typ].timing.count)
+	}
+	writeHeader(&b, "ui_message_errors_total", "counter", "Protocol messages that failed, by type.")
+	for _, typ := range types {
+		fmt.Fprintf(&b, "ui_message_errors_total{%s} %d\n", labelPair("type", string(typ)), m.types[typ].errors)
+	}
+	writeHeader(&b, "ui_message_duration_seconds", "histogram", "Time to handle a protocol message, by type.")
+	for _, typ := range types {
+		m.types[typ].timing.writePrometheus(&b, "ui_message_duration_seconds", labelPair("type", string(typ)))
+	}
+	writeHeader(&b, "ui_update_duration_seconds", "histogram", "Update handling time in Lua and in the backend store.")
+	m.updateLua.writePrometheus(&b, "ui_update_duration_seconds", labelPair("part", "lua"))
+	m.updateStore.writePrometheus(&b, "ui_update_duration_seconds", labelPair("part", "store"))
+	for _, name := range slices.Sorted(maps.Keys(m.timings)) {
+		metric := "ui_" + metricName(name) + "_duration_seconds"
+		writeHeader(&b, metric, "histogram", "")
+		m.timings[name].writePrometheus(&b, metric, "")
+	}
+	all := maps.Clone(m.counters)
+	m.mu.Unlock()
+
+	maps.Copy(all, counters)
+	for _, name := range slices.Sorted(maps.Keys(all)) {
+		metric := "ui_" + metricName(name) + "_total"
+		writeHeader(&b, metric, "counter", "")
+		fmt.Fprintf(&b, "%s %d\n", metric, all[name])
+	}
+	for i, g := range gauges {
+		if i == 0 || gauges[i-1].Name != g.Name {
+			writeHeader(&b, g.Name, "gauge", g.Help)
+		}
+		pairs := make([]string, 0, len(g.Labels))
+		for _, k := range slices.Sorted(maps.Keys(g.Labels)) {
+			pairs = append(pairs, labelPair(k, g.Labels[k]))
+		}
+		fmt.Fprintf(&b, "%s%s %s\n", g.Name, braced(strings.Join(pairs, ",")), formatFloat(g.Value))
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writePrometheus writes the histogram's cumulative buckets, sum and count.
+// labels is the comma-separated label list without braces ("" for none).
+func (h *histogram) writePrometheus(b *bytes.Buffer, name, labels string) {
+	le := labels
+	if le != "" {
+		le += ","
+	}
+	var cumulative int64
+	for i, bound := range metricBuckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(b, "%s_bucket{%sle=\"%s\"} %d\n", name, le, formatFloat(bound.Seconds()), cumulative)
+	}
+	fmt.Fprintf(b, "%s_bucket{%sle=\"+Inf\"} %d\n", name, le, h.count)
+	fmt.Fprintf(b, "%s_sum%s %s\n", name, braced(labels), formatFloat(h.total.Seconds()))
+	fmt.Fprintf(b, "%s_count%s %d\n", name, braced(labels), h.count)
+}
+
+func writeHeader(b *bytes.Buffer, name, kind, help string) {
+	if help != "" {
+		fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	}
+	fmt.Fprintf(b, "# TYPE %s %s\n", name, kind)
+}
+
+func labelPair(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+func braced(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// metricName converts a counter or timing name to a metric name:
+// "orphanedWatches.found" becomes "orphaned_watches_found".
+func metricName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			if b.Len() > 0 && !strings.HasSuffix(b.String(), "_") {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r + 'a' - 'A')
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "_"):
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -17,6 +17,7 @@ func TestParsePrioritySuffix(t *testing.T) {
 	}{
 		{"viewdefs:high", "viewdefs", PriorityHigh},
 		{"data:med", "data", PriorityMedium},
+		{"data:medium", "data", PriorityMedium},
 		{"optional:low", "optional", PriorityLow},
 		{"name", "name", PriorityMedium}, // default
 		{"type", "type", PriorityMedium}, // no suffix = medium
@@ -134,6 +135,63 @@ func TestMessageBatcherSameVariableDifferentPriorities(t *testing.T) {
 	}
 }
 
+// TestPriorityRulesPrecedence verifies property rules beat type rules and
+// earlier (session) rule sets beat later (global) ones
+func TestPriorityRulesPrecedence(t *testing.T) {
+	session := NewPriorityRules()
+	session.SetProperty("status", PriorityHigh)
+	session.SetType("Alert", PriorityLow)
+	global := NewPriorityRules()
+	global.SetProperty("status", PriorityLow)
+	global.SetProperty("note", PriorityLow)
+	global.SetType("Alert", PriorityHigh)
+	global.SetType("Toast", PriorityHigh)
+
+	tests := []struct {
+		property, typ string
+		want          Priority
+	}{
+		{"status", "", PriorityHigh},     // session property beats global property
+		{"note", "Alert", PriorityLow},   // global property beats session type
+		{"title", "Alert", PriorityLow},  // session type beats global type
+		{"title", "Toast", PriorityHigh}, // global type
+		{"title", "", PriorityMedium},    // no rule
+	}
+	for _, tt := range tests {
+		if got := ResolvePropertyPriority(tt.property, tt.typ, session, global); got != tt.want {
+			t.Errorf("ResolvePropertyPriority(%q, %q) = %d, want %d", tt.property, tt.typ, got, tt.want)
+		}
+	}
+	if got := ResolvePropertyPriority("status", "", nil, global); got != PriorityLow {
+		t.Errorf("with no session rules: %d, want global low", got)
+	}
+}
+
+// TestMessageBatcherPriorityRules verifies rules apply only to unsuffixed properties
+func TestMessageBatcherPriorityRules(t *testing.T) {
+	rules := NewPriorityRules()
+	rules.SetProperty("status", PriorityHigh)
+	rules.SetProperty("label", PriorityLow)
+	rules.SetType("Alert", PriorityLow)
+	b := NewMessageBatcher()
+	b.SetPriorityRules(nil, rules)
+
+	b.QueueProperty(1, "title", "low by type")
+	b.QueueProperty(1, "status", "high by rule")
+	b.QueueProperty(1, "label:med", "suffix wins")
+	b.QueueProperty(1, "type", "Alert")
+
+	var got []map[string]string
+	for _, msg := range b.Flush() {
+		var update UpdateMessage
+		json.Unmarshal(msg.Data, &update)
+		got = append(got, update.Properties)
+	}
+	if len(got) != 3 || got[0]["status"] == "" || got[1]["label"] == "" || got[2]["title"] == "" || got[2]["type"] == "" {
+		t.Errorf("batches = %v, want [status] [label] [title type]", got)
+	}
+}
+
 // TestMessageBatcherFlushClearsState verifies flush empties queue
 func TestMessageBatcherFlushClearsState(t *testing.T) {
 	b := NewMessageBatcher()
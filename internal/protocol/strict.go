@@ -0,0 +1,202 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Strict Mode)
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/zot/ui-engine/internal/backend"
+)
+
+// DiagRecorder keeps diagnostics shown with a variable in the variable browser.
+type DiagRecorder interface {
+	// AddVariableDiag adds a diagnostic to a variable of a session (vended ID).
+	AddVariableDiag(sessionID string, varID int64, diag string)
+}
+
+// BuiltinProperties are the properties the engine itself reads. They are
+// allowed on every variable in strict mode.
+var BuiltinProperties = []string{
+	"access", BenchProperty, "create", "cspNonce", "elementId", "fallbackNamespace",
+	"inactive", "item", "itemWrapper", "keyStyle", "keypress", "namespace", "path",
+	"priority", "replace", "type", "viewdefMeta", "viewdefs", "windowFirst",
+	"windowLast", "windowOverscan", "windowStart", "windowTotal", "wrapper",
+}
+
+// messageFields returns a value to decode a message type's data into, for
+// checking it for unknown fields. Returns nil for types without data.
+func messageFields(msgType MessageType) any {
+	switch msgType {
+	case MsgCreate:
+		return &CreateMessage{}
+	case MsgDestroy:
+		return &DestroyMessage{}
+	case MsgUpdate:
+		return &UpdateMessage{}
+	case MsgWatch, MsgUnwatch:
+		return &WatchMessage{}
+	case MsgPoll:
+		return &PollMessage{}
+	case MsgSetFlags:
+		return &SetFlagsMessage{}
+	case MsgFlush:
+		return &FlushMessage{}
+	case MsgGetRoots:
+		return &GetRootsMessage{}
+	case MsgTrace:
+		return &TraceMessage{}
+	}
+	return nil
+}
+
+// isStrict reports whether msg is checked strictly: the server runs in strict
+// mode or the sender opted the message in.
+func (h *Handler) isStrict(msg *Message) bool {
+	return msg.Strict || h.config.Server.Strict
+}
+
+// validateFields returns a validation error when msg's data has fields its
+// type does not define.
+func validateFields(msg *Message) error {
+	fields := messageFields(msg.Type)
+	if fields == nil || len(msg.Data) == 0 {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(msg.Data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(fields); err != nil {
+		return fmt.Errorf("validation: %s: %s", msg.Type, strings.TrimPrefix(err.Error(), "json: "))
+	}
+	return nil
+}
+
+// PropertyAllowlist lists the properties variables may carry in strict mode,
+// beyond BuiltinProperties. It comes from the site's types.json.
+type PropertyAllowlist struct {
+	mu    sync.RWMutex
+	all   map[string]bool            // allowed on every type
+	types map[string]map[string]bool // variable type -> allowed properties
+}
+
+// NewPropertyAllowlist creates an allowlist of the built-in properties only.
+func NewPropertyAllowlist() *PropertyAllowlist {
+	return &PropertyAllowlist{
+		all:   make(map[string]bool),
+		types: make(map[string]map[string]bool),
+	}
+}
+
+// Allow allows property name on every variable.
+func (a *PropertyAllowlist) Allow(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.all[name] = true
+}
+
+// AllowForType allows property name on variables of type typ.
+func (a *PropertyAllowlist) AllowForType(typ, name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.types[typ] == nil {
+		a.types[typ] = make(map[string]bool)
+	}
+	a.types[typ][name] = true
+}
+
+// Allowed reports whether a variable of type typ may carry property name,
+// ignoring any priority suffix. While a variable has no type yet, a property
+// allowed for any type is allowed. A nil allowlist allows only built-ins.
+func (a *PropertyAllowlist) Allowed(typ, name string) bool {
+	name, _ = ParsePrioritySuffix(name)
+	if slices.Contains(BuiltinProperties, name) {
+		return true
+	}
+	if a == nil {
+		return false
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.all[name] {
+		return true
+	}
+	if typ != "" {
+		return a.types[typ][name]
+	}
+	for _, allowed := range a.types {
+		if allowed[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPropertyAllowlist sets the properties strict mode accepts without a warning.
+func (h *Handler) SetPropertyAllowlist(allowlist *PropertyAllowlist) {
+	h.allowlist = allowlist
+}
+
+// SetDiagRecorder sets where strict mode records warnings about variables.
+func (h *Handler) SetDiagRecorder(recorder DiagRecorder) {
+	h.diagRecorder = recorder
+}
+
+// checkMessageProperties checks the properties a create or update message set.
+func (h *Handler) checkMessageProperties(connectionID string, msg *Message) {
+	switch msg.Type {
+	case MsgCreate:
+		var create CreateMessage
+		if json.Unmarshal(msg.Data, &create) == nil {
+			h.checkProperties(connectionID, create.ID, create.Properties)
+		}
+	case MsgUpdate:
+		var update UpdateMessage
+		if json.Unmarshal(msg.Data, &update) == nil {
+			h.checkProperties(connectionID, update.VarID, update.Properties)
+		}
+	}
+}
+
+// checkProperties warns about properties a strict message set that the variable's
+// type does not allow: a level-1 log and a diag on the variable.
+func (h *Handler) checkProperties(connectionID string, varID int64, properties map[string]string) {
+	if len(properties) == 0 || h.backendLookup == nil {
+		return
+	}
+	b := h.backendLookup.GetBackendForConnection(connectionID)
+	if b == nil {
+		return
+	}
+	typ := variableType(b, varID, properties)
+	for _, name := range slices.Sorted(maps.Keys(properties)) {
+		if h.allowlist.Allowed(typ, name) {
+			continue
+		}
+		diag := fmt.Sprintf("unknown property %q", name)
+		if typ != "" {
+			diag += " for type " + typ
+		}
+		h.Log(1, "strict: variable %d: %s", varID, diag)
+		if h.diagRecorder != nil {
+			h.diagRecorder.AddVariableDiag(b.GetSessionID(), varID, diag)
+		}
+	}
+}
+
+// variableType returns the type of a variable, or the type being set on it.
+func variableType(b backend.Backend, varID int64, properties map[string]string) string {
+	if tracker := b.GetTracker(); tracker != nil {
+		if v := tracker.GetVariable(varID); v != nil && v.Properties["type"] != "" {
+			return v.Properties["type"]
+		}
+	}
+	if u := b.GetUnbound(varID); u != nil && u.Properties["type"] != "" {
+		return u.Properties["type"]
+	}
+	return properties["type"]
+}
@@ -0,0 +1,81 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Strict Mode)
+package protocol
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestStrictUnknownFields verifies every message type with an extra field is
+// rejected with a validation error in strict mode, by server config or by the
+// message's own strict flag, and accepted otherwise
+func TestStrictUnknownFields(t *testing.T) {
+	messages := map[MessageType]string{
+		MsgCreate:   `{"id": 2, "parentId": 1, "bogus": 1}`,
+		MsgDestroy:  `{"varId": 2, "bogus": 1}`,
+		MsgUpdate:   `{"varId": 2, "value": 1, "bogus": 1}`,
+		MsgWatch:    `{"varId": 2, "bogus": 1}`,
+		MsgUnwatch:  `{"varId": 2, "bogus": 1}`,
+		MsgPoll:     `{"wait": "0s", "bogus": 1}`,
+		MsgSetFlags: `{"flags": {}, "bogus": 1}`,
+		MsgFlush:    `{"session": "1", "bogus": 1}`,
+		MsgGetRoots: `{"session": "1", "bogus": 1}`,
+	}
+	strictCfg := config.DefaultConfig()
+	strictCfg.Server.Strict = true
+	strict := NewHandler(strictCfg, nil)
+	lax := NewHandler(config.DefaultConfig(), nil)
+	rejected := func(resp *Response, err error) bool {
+		return err == nil && resp != nil && strings.HasPrefix(resp.Error, "validation: ")
+	}
+
+	for msgType, data := range messages {
+		msg := &Message{Type: msgType, Data: json.RawMessage(data)}
+		resp, err := strict.HandleMessage("c1", msg)
+		if !rejected(resp, err) {
+			t.Errorf("strict %s: got %+v, %v, want validation error", msgType, resp, err)
+		} else if !strings.Contains(resp.Error, `"bogus"`) {
+			t.Errorf("strict %s: error %q does not name the field", msgType, resp.Error)
+		}
+		if resp, err := lax.HandleMessage("c1", msg); rejected(resp, err) {
+			t.Errorf("lax %s rejected: %s", msgType, resp.Error)
+		}
+		msg.Strict = true
+		if resp, err := lax.HandleMessage("c1", msg); !rejected(resp, err) {
+			t.Errorf("opted-in %s: got %+v, %v, want validation error", msgType, resp, err)
+		}
+	}
+}
+
+// TestPropertyAllowlist verifies built-ins are always allowed, priority suffixes
+// are ignored, and type-specific properties are allowed on their type, or on
+// any variable whose type is not known yet
+func TestPropertyAllowlist(t *testing.T) {
+	allowlist := NewPropertyAllowlist()
+	allowlist.Allow("status")
+	allowlist.AllowForType("Contact", "label")
+	var none *PropertyAllowlist
+
+	tests := []struct {
+		list      *PropertyAllowlist
+		typ, name string
+		want      bool
+	}{
+		{none, "Contact", "viewdefs:high", true},
+		{none, "Contact", "status", false},
+		{allowlist, "Toast", "status:low", true},
+		{allowlist, "Contact", "label", true},
+		{allowlist, "", "label", true},
+		{allowlist, "Toast", "label", false},
+		{allowlist, "Contact", "viewdfs", false},
+	}
+	for _, tt := range tests {
+		if got := tt.list.Allowed(tt.typ, tt.name); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.typ, tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TelemetryHook receives server events for an embedder's own analytics.
+// Session IDs are vended IDs ("1", "2"). Hooks are called synchronously on the
+// server's goroutines, so they should hand slow work off; a panicking hook is
+// recovered and logged.
+type TelemetryHook interface {
+	OnSessionCreated(sessionID string)
+	OnSessionDestroyed(sessionID string)
+	// OnMessage reports one handled protocol message; err is nil on success.
+	OnMessage(msgType MessageType, duration time.Duration, err error)
+	// OnAfterBatch reports change detection after a message batch.
+	OnAfterBatch(sessionID string, changeCount int, duration time.Duration)
+	OnError(sessionID string, err error)
+	// OnBackendAttached reports a backend socket client naming the session in
+	// a session-scoped command for the first time on its connection.
+	OnBackendAttached(sessionID, client string)
+}
+
+// NopTelemetry ignores all events. Embed it to implement only some hooks.
+type NopTelemetry struct{}
+
+func (NopTelemetry) OnSessionCreated(string)                     {}
+func (NopTelemetry) OnSessionDestroyed(string)                   {}
+func (NopTelemetry) OnMessage(MessageType, time.Duration, error) {}
+func (NopTelemetry) OnAfterBatch(string, int, time.Duration)     {}
+func (NopTelemetry) OnError(string, error)                       {}
+func (NopTelemetry) OnBackendAttached(string, string)            {}
+
+// MultiTelemetry fans events out to several hooks. Every hook sees each event
+// even if an earlier one panics; the first panic is raised again afterwards.
+func MultiTelemetry(hooks ...TelemetryHook) TelemetryHook {
+	return multiTelemetry(hooks)
+}
+
+type multiTelemetry []TelemetryHook
+
+func (m multiTelemetry) each(call func(TelemetryHook)) {
+	var failure any
+	for _, hook := range m {
+		func() {
+			defer func() {
+				if r := recover(); r != nil && failure == nil {
+					failure = r
+				}
+			}()
+			call(hook)
+		}()
+	}
+	if failure != nil {
+		panic(failure)
+	}
+}
+
+func (m multiTelemetry) OnSessionCreated(id string) {
+	m.each(func(h TelemetryHook) { h.OnSessionCreated(id) })
+}
+
+func (m multiTelemetry) OnSessionDestroyed(id string) {
+	m.each(func(h TelemetryHook) { h.OnSessionDestroyed(id) })
+}
+
+func (m multiTelemetry) OnMessage(t MessageType, d time.Duration, err error) {
+	m.each(func(h TelemetryHook) { h.OnMessage(t, d, err) })
+}
+
+func (m multiTelemetry) OnAfterBatch(id string, n int, d time.Duration) {
+	m.each(func(h TelemetryHook) { h.OnAfterBatch(id, n, d) })
+}
+
+func (m multiTelemetry) OnError(id string, err error) {
+	m.each(func(h TelemetryHook) { h.OnError(id, err) })
+}
+
+func (m multiTelemetry) OnBackendAttached(id, client string) {
+	m.each(func(h TelemetryHook) { h.OnBackendAttached(id, client) })
+}
+
+// guardedTelemetry recovers hook panics so telemetry never breaks request handling.
+type guardedTelemetry struct {
+	hook   TelemetryHook
+	config *config.Config
+}
+
+func (g guardedTelemetry) call(event string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			g.config.Logger(config.LogProtocol).Log(0, "Telemetry hook panicked in %s: %v", event, r)
+		}
+	}()
+	fn()
+}
+
+func (g guardedTelemetry) OnSessionCreated(id string) {
+	g.call("OnSessionCreated", func() { g.hook.OnSessionCreated(id) })
+}
+
+func (g guardedTelemetry) OnSessionDestroyed(id string) {
+	g.call("OnSessionDestroyed", func() { g.hook.OnSessionDestroyed(id) })
+}
+
+func (g guardedTelemetry) OnMessage(t MessageType, d time.Duration, err error) {
+	g.call("OnMessage", func() { g.hook.OnMessage(t, d, err) })
+}
+
+func (g guardedTelemetry) OnAfterBatch(id string, n int, d time.Duration) {
+	g.call("OnAfterBatch", func() { g.hook.OnAfterBatch(id, n, d) })
+}
+
+func (g guardedTelemetry) OnError(id string, err error) {
+	g.call("OnError", func() { g.hook.OnError(id, err) })
+}
+
+func (g guardedTelemetry) OnBackendAttached(id, client string) {
+	g.call("OnBackendAttached", func() { g.hook.OnBackendAttached(id, client) })
+}
+
+// NDJSONTelemetry writes each event as one JSON line, e.g.
+// {"time":"…","event":"message","type":"update","durationMs":0.4}
+type NDJSONTelemetry struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewNDJSONTelemetry creates a hook writing events to w.
+func NewNDJSONTelemetry(w io.Writer) *NDJSONTelemetry {
+	return &NDJSONTelemetry{enc: json.NewEncoder(w)}
+}
+
+type telemetryEvent struct {
+	Time       time.Time   `json:"time"`
+	Event      string      `json:"event"`
+	Session    string      `json:"session,omitempty"`
+	Type       MessageType `json:"type,omitempty"`
+	DurationMs float64     `json:"durationMs,omitempty"`
+	Changes    int         `json:"changes,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Client     string      `json:"client,omitempty"`
+	Connection string      `json:"connection,omitempty"` // Set on errors recorded for a connection
+}
+
+func (n *NDJSONTelemetry) write(ev telemetryEvent) {
+	ev.Time = time.Now().UTC()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.enc.Encode(ev)
+}
+
+// errorEvent builds an error event, naming the connection of a ConnectionError.
+func errorEvent(id string, err error) telemetryEvent {
+	ev := telemetryEvent{Event: "error", Session: id, Error: errorText(err)}
+	var connErr *ConnectionError
+	if errors.As(err, &connErr) {
+		ev.Connection = connErr.Connection
+	}
+	return ev
+}
+
+func errorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+func (n *NDJSONTelemetry) OnSessionCreated(id string) {
+	n.write(telemetryEvent{Event: "sessionCreated", Session: id})
+}
+
+func (n *NDJSONTelemetry) OnSessionDestroyed(id string) {
+	n.write(telemetryEvent{Event: "sessionDestroyed", Session: id})
+}
+
+func (n *NDJSONTelemetry) OnMessage(t MessageType, d time.Duration, err error) {
+	n.write(telemetryEvent{Event: "message", Type: t, DurationMs: durationMs(d), Error: errorText(err)})
+}
+
+func (n *NDJSONTelemetry) OnAfterBatch(id string, changes int, d time.Duration) {
+	n.write(telemetryEvent{Event: "afterBatch", Session: id, Changes: changes, DurationMs: durationMs(d)})
+}
+
+func (n *NDJSONTelemetry) OnError(id string, err error) {
+	n.write(errorEvent(id, err))
+}
+
+func (n *NDJSONTelemetry) OnBackendAttached(id, client string) {
+	n.write(telemetryEvent{Event: "backendAttached", Session: id, Client: client})
+}
+
+// EventRing keeps the most recent events in memory, for crash bundles.
+type EventRing struct {
+	mu     sync.Mutex
+	events []telemetryEvent
+	next   int
+	full   bool
+}
+
+// NewEventRing creates a ring holding the last size events.
+func NewEventRing(size int) *EventRing {
+	return &EventRing{events: make([]telemetryEvent, size)}
+}
+
+func (r *EventRing) record(ev telemetryEvent) {
+	ev.Time = time.Now().UTC()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[r.next] = ev
+	r.next = (r.next + 1) % len(r.events)
+	r.full = r.full || r.next == 0
+}
+
+// WriteNDJSON writes the held events, oldest first, in NDJSONTelemetry's format.
+func (r *EventRing) WriteNDJSON(w io.Writer) error {
+	r.mu.Lock()
+	events := append([]telemetryEvent(nil), r.events[:r.next]...)
+	if r.full {
+		events = append(append([]telemetryEvent(nil), r.events[r.next:]...), events...)
+	}
+	r.mu.Unlock()
+	enc := json.NewEncoder(w)
+	for _, ev := range events {
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *EventRing) OnSessionCreated(id string) {
+	r.record(telemetryEvent{Event: "sessionCreated", Session: id})
+}
+
+func (r *EventRing) OnSessionDestroyed(id string) {
+	r.record(telemetryEvent{Event: "sessionDestroyed", Session: id})
+}
+
+func (r *EventRing) OnMessage(t MessageType, d time.Duration, err error) {
+	r.record(telemetryEvent{Event: "message", Type: t, DurationMs: durationMs(d), Error: errorText(err)})
+}
+
+func (r *EventRing) OnAfterBatch(id string, changes int, d time.Duration) {
+	r.record(telemetryEvent{Event: "afterBatch", Session: id, Changes: changes, DurationMs: durationMs(d)})
+}
+
+func (r *EventRing) OnError(id string, err error) {
+	r.record(errorEvent(id, err))
+}
+
+func (r *EventRing) OnBackendAttached(id, client string) {
+	r.record(telemetryEvent{Event: "backendAttached", Session: id, Client: client})
+}
@@ -0,0 +1,72 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+type messageRecorder struct {
+	NopTelemetry
+	types  []MessageType
+	errors []error
+}
+
+func (r *messageRecorder) OnMessage(t MessageType, _ time.Duration, err error) {
+	r.types = append(r.types, t)
+	r.errors = append(r.errors, err)
+}
+
+type panickyTelemetry struct{ NopTelemetry }
+
+func (panickyTelemetry) OnMessage(MessageType, time.Duration, error) { panic("boom") }
+
+// TestTelemetryHookPanicsRecovered verifies a panicking hook neither breaks
+// message handling nor keeps other hooks from seeing the event
+func TestTelemetryHookPanicsRecovered(t *testing.T) {
+	h := NewHandler(config.DefaultConfig(), nil)
+	rec := &messageRecorder{}
+	h.SetTelemetry(MultiTelemetry(panickyTelemetry{}, rec))
+
+	resp, err := h.HandleMessage("c1", &Message{Type: MsgPoll, Data: json.RawMessage(`{}`)})
+	if err != nil || resp == nil || resp.Error == "" {
+		t.Fatalf("poll without a pending queue = %+v, %v; want an error response", resp, err)
+	}
+	if _, err := h.HandleMessage("c1", &Message{Type: "bogus"}); err == nil {
+		t.Fatal("unknown message type accepted")
+	}
+
+	if len(rec.types) != 2 || rec.types[0] != MsgPoll || rec.types[1] != "bogus" {
+		t.Fatalf("recorded %v, want poll then bogus", rec.types)
+	}
+	for i, err := range rec.errors {
+		if err == nil {
+			t.Errorf("message %d reported no error", i)
+		}
+	}
+}
+
+func TestNDJSONTelemetry(t *testing.T) {
+	var buf bytes.Buffer
+	hook := NewNDJSONTelemetry(&buf)
+	hook.OnSessionCreated("1")
+	hook.OnAfterBatch("1", 3, 1500*time.Microsecond)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines: %s", len(lines), buf.String())
+	}
+	var ev telemetryEvent
+	if err := json.Unmarshal([]byte(lines[1]), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Event != "afterBatch" || ev.Session != "1" || ev.Changes != 3 || ev.DurationMs != 1.5 || ev.Time.IsZero() {
+		t.Errorf("event = %+v", ev)
+	}
+}
@@ -0,0 +1,127 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Session Trace)
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultTraceDuration is how long a trace runs when its message names no duration.
+const DefaultTraceDuration = 10 * time.Minute
+
+// TraceMessage turns full message logging for one session on or off.
+// Duration is a Go duration ("10m"); File also writes the trace to a file.
+type TraceMessage struct {
+	Session  string `json:"session"`
+	On       bool   `json:"on"`
+	Duration string `json:"duration,omitempty"`
+	File     bool   `json:"file,omitempty"`
+}
+
+// TraceResponse describes a session's trace: when it ends and its file, if
+// any. Until is zero once tracing is off.
+type TraceResponse struct {
+	Session string    `json:"session"`
+	Until   time.Time `json:"until,omitzero"`
+	File    string    `json:"file,omitempty"`
+}
+
+// SessionTracer starts and stops session traces for trace messages, and finds
+// the trace of a connection's session.
+type SessionTracer interface {
+	// SetTrace starts (on) or stops a session's trace; a new start replaces it.
+	SetTrace(session string, on bool, duration time.Duration, file bool) (*TraceResponse, error)
+	// ConnectionTrace returns the trace of the connection's session, or nil.
+	ConnectionTrace(connectionID string) *SessionTrace
+}
+
+// SessionTrace logs one session's messages in full, whatever the verbosity,
+// and tees them to a file if it has one. Logf on a nil trace does nothing.
+type SessionTrace struct {
+	Session string // Vended ID
+	Until   time.Time
+	Path    string // Trace file ("" = log only)
+	mu      sync.Mutex
+	file    *os.File
+}
+
+// NewSessionTrace starts a trace; a non-empty path is created or appended to.
+func NewSessionTrace(session string, until time.Time, path string) (*SessionTrace, error) {
+	t := &SessionTrace{Session: session, Until: until, Path: path}
+	if path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		t.file = file
+	}
+	return t, nil
+}
+
+// Logf logs a trace line tagged with the session.
+func (t *SessionTrace) Logf(format string, args ...any) {
+	if t == nil {
+		return
+	}
+	line := fmt.Sprintf(format, args...)
+	log.Printf("[trace %s] %s", t.Session, line)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		fmt.Fprintf(t.file, "%s %s\n", time.Now().Format(time.RFC3339Nano), line)
+	}
+}
+
+// Close closes the trace file; later lines only go to the log.
+func (t *SessionTrace) Close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file != nil {
+		t.file.Close()
+		t.file = nil
+	}
+}
+
+// ConnectionTrace returns the trace of the connection's session, or nil.
+func (h *Handler) ConnectionTrace(connectionID string) *SessionTrace {
+	if h.tracer == nil {
+		return nil
+	}
+	return h.tracer.ConnectionTrace(connectionID)
+}
+
+// handleTrace processes a trace message. Only backends may trace; a
+// frontend's connection belongs to a session and is refused.
+func (h *Handler) handleTrace(connectionID string, data json.RawMessage) (*Response, error) {
+	var msg TraceMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return nil, err
+	}
+	if h.backendLookup != nil && h.backendLookup.GetBackendForConnection(connectionID) != nil {
+		return &Response{Error: "trace is only available to backends"}, nil
+	}
+	if msg.Session == "" {
+		return &Response{Error: "trace requires a session"}, nil
+	}
+	if h.tracer == nil {
+		return &Response{Error: "trace not available"}, nil
+	}
+	duration := DefaultTraceDuration
+	if msg.Duration != "" {
+		d, err := time.ParseDuration(msg.Duration)
+		if err != nil || d <= 0 {
+			return &Response{Error: fmt.Sprintf("invalid trace duration %q", msg.Duration)}, nil
+		}
+		duration = d
+	}
+	resp, err := h.tracer.SetTrace(msg.Session, msg.On, duration, msg.File)
+	if err != nil {
+		return &Response{Error: err.Error()}, nil
+	}
+	return &Response{Result: *resp}, nil
+}
@@ -0,0 +1,58 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Source of truth responsibilities)
+package protocol
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/zot/ui-engine/internal/backend"
+)
+
+// createUnboundVariable stores an unbound variable in the session backend.
+// Unbound variables bypass the Lua runtime entirely: the UI server is their source of truth.
+func (h *Handler) createUnboundVariable(connectionID string, msg *CreateMessage) *Response {
+	var b backend.Backend
+	if h.backendLookup != nil {
+		b = h.backendLookup.GetBackendForConnection(connectionID)
+	}
+	if b == nil {
+		return &Response{Error: "session context required for unbound variables"}
+	}
+	if err := b.CreateUnbound(msg.ID, msg.ParentID, msg.Value, msg.Properties); err != nil {
+		return &Response{Error: err.Error()}
+	}
+	return nil
+}
+
+// sendUnbound sends an unbound variable's current value to one connection.
+func (h *Handler) sendUnbound(connectionID string, v *backend.UnboundVariable) {
+	msg, err := NewMessage(MsgUpdate, UpdateMessage{VarID: v.ID, Value: v.Value, Properties: v.Properties})
+	if err != nil {
+		return
+	}
+	h.queue(msg, []string{connectionID})
+}
+
+// forwardUnbound relays an unbound variable update to its other watchers.
+func (h *Handler) forwardUnbound(b backend.Backend, connectionID string, varID int64, data json.RawMessage) {
+	watchers := slices.DeleteFunc(b.GetWatchers(varID), func(id string) bool { return id == connectionID })
+	if len(watchers) == 0 {
+		return
+	}
+	h.queue(&Message{Type: MsgUpdate, Data: data}, watchers)
+}
+
+// queue sends a message to connections through the batcher when available.
+func (h *Handler) queue(msg *Message, connectionIDs []string) {
+	if h.queuer != nil {
+		h.queuer.Queue(msg, connectionIDs)
+		return
+	}
+	if h.sender == nil {
+		return
+	}
+	for _, id := range connectionIDs {
+		h.sender.Send(id, msg)
+	}
+}
@@ -0,0 +1,189 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// fakeLua stands in for the Lua runtime: it creates path variables in the tracker
+// and fails once torn down
+type fakeLua struct {
+	b        *backend.LuaBackend
+	creates  []int64
+	updates  []int64
+	tornDown bool
+}
+
+func (f *fakeLua) HandleFrontendCreate(sessionID string, id int64, parentID int64, properties map[string]string) error {
+	if f.tornDown {
+		return errors.New("Lua session not found")
+	}
+	f.creates = append(f.creates, id)
+	f.b.GetTracker().CreateVariableWithId(id, nil, 0, "", properties)
+	return nil
+}
+
+func (f *fakeLua) HandleFrontendUpdate(sessionID, connectionID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error {
+	if f.tornDown {
+		return errors.New("Lua session not found")
+	}
+	f.updates = append(f.updates, varID)
+	return nil
+}
+
+// teardown models Lua session shutdown: Lua-resolved variables go away with it
+func (f *fakeLua) teardown() {
+	f.tornDown = true
+	for _, id := range f.creates {
+		f.b.DestroyVariable(id)
+	}
+}
+
+// recordingQueuer records queued messages per connection
+type recordingQueuer struct {
+	sent map[string][]*Message
+}
+
+func (q *recordingQueuer) Queue(msg *Message, watchers []string) {
+	for _, w := range watchers {
+		q.sent[w] = append(q.sent[w], msg)
+	}
+}
+
+func newUnboundTestHandler() (*Handler, *backend.LuaBackend, *fakeLua, *recordingQueuer) {
+	cfg := config.DefaultConfig()
+	b := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	lua := &fakeLua{b: b}
+	q := &recordingQueuer{sent: make(map[string][]*Message)}
+	h := NewHandler(cfg, nil)
+	h.SetBackendLookup(fixedLookup{b})
+	h.SetPathVariableHandler(lua)
+	h.SetQueuer(q)
+	return h, b, lua, q
+}
+
+// TestCreateFlagCombinations verifies nowatch and unbound through handleCreate
+func TestCreateFlagCombinations(t *testing.T) {
+	tests := []struct {
+		name        string
+		noWatch     bool
+		unbound     bool
+		wantLua     bool
+		wantWatched bool
+	}{
+		{"bound watched", false, false, true, true},
+		{"bound nowatch", true, false, true, false},
+		{"unbound watched", false, true, false, true},
+		{"unbound nowatch", true, true, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, b, lua, _ := newUnboundTestHandler()
+			create, _ := NewMessage(MsgCreate, CreateMessage{
+				ID:         2,
+				Value:      json.RawMessage(`"hello"`),
+				Properties: map[string]string{"path": "name"},
+				NoWatch:    tt.noWatch,
+				Unbound:    tt.unbound,
+			})
+			if resp, _ := h.HandleMessage("c1", create); resp != nil && resp.Error != "" {
+				t.Fatalf("create failed: %s", resp.Error)
+			}
+
+			if got := len(lua.creates) == 1; got != tt.wantLua {
+				t.Errorf("resolved through Lua = %v, want %v", got, tt.wantLua)
+			}
+			if got := b.GetWatcherCount(2) == 1; got != tt.wantWatched {
+				t.Errorf("watched = %v, want %v", got, tt.wantWatched)
+			}
+			if tt.unbound {
+				if b.GetTracker().GetVariable(2) != nil {
+					t.Error("unbound variable was created in the tracker")
+				}
+				if u := b.GetUnbound(2); u == nil || string(u.Value) != `"hello"` {
+					t.Errorf("unbound variable = %+v", u)
+				}
+			} else if v := b.GetTracker().GetVariable(2); v == nil || v.Active != tt.wantWatched {
+				t.Errorf("tracker variable = %+v, want active = %v", v, tt.wantWatched)
+			}
+		})
+	}
+}
+
+// TestUnboundUpdatesBypassLua verifies unbound updates are stored and forwarded to other watchers
+func TestUnboundUpdatesBypassLua(t *testing.T) {
+	h, b, lua, q := newUnboundTestHandler()
+	create, _ := NewMessage(MsgCreate, CreateMessage{ID: 2, Value: json.RawMessage(`1`), Unbound: true})
+	h.HandleMessage("c1", create)
+	watch, _ := NewMessage(MsgWatch, WatchMessage{VarID: 2})
+	h.HandleMessage("c2", watch)
+	if len(q.sent["c2"]) != 1 {
+		t.Fatalf("watch should send the current value, got %d messages", len(q.sent["c2"]))
+	}
+
+	update, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 2, Value: json.RawMessage(`2`), Properties: map[string]string{"k": "v"}})
+	if resp, _ := h.HandleMessage("c1", update); resp != nil && resp.Error != "" {
+		t.Fatalf("update failed: %s", resp.Error)
+	}
+	if len(lua.updates) != 0 {
+		t.Error("unbound update reached Lua")
+	}
+	if u := b.GetUnbound(2); string(u.Value) != `2` || u.Properties["k"] != "v" {
+		t.Errorf("stored = %+v", u)
+	}
+	if len(q.sent["c2"]) != 2 || len(q.sent["c1"]) != 0 {
+		t.Errorf("forwarded c1=%d c2=%d, want 0 and 2", len(q.sent["c1"]), len(q.sent["c2"]))
+	}
+
+	// Removed properties are deleted and the removal is forwarded
+	remove, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 2, RemoveProperties: []string{"k"}})
+	h.HandleMessage("c1", remove)
+	if _, ok := b.GetUnbound(2).Properties["k"]; ok || len(q.sent["c2"]) != 3 {
+		t.Errorf("after removal stored = %+v, forwarded %d", b.GetUnbound(2), len(q.sent["c2"]))
+	}
+
+	// Destroy removes it
+	destroy, _ := NewMessage(MsgDestroy, DestroyMessage{VarID: 2})
+	h.HandleMessage("c1", destroy)
+	if b.GetUnbound(2) != nil {
+		t.Error("unbound variable survived destroy")
+	}
+}
+
+// TestUnboundSurvivesLuaTeardown verifies unbound variables keep working without a Lua session
+func TestUnboundSurvivesLuaTeardown(t *testing.T) {
+	h, b, lua, q := newUnboundTestHandler()
+	bound, _ := NewMessage(MsgCreate, CreateMessage{ID: 2, Properties: map[string]string{"path": "name"}})
+	unbound, _ := NewMessage(MsgCreate, CreateMessage{ID: 3, Value: json.RawMessage(`"kept"`), Unbound: true})
+	h.HandleMessage("c1", bound)
+	h.HandleMessage("c1", unbound)
+
+	lua.teardown()
+
+	if b.GetTracker().GetVariable(2) != nil {
+		t.Fatal("bound variable should be gone after teardown")
+	}
+	update, _ := NewMessage(MsgUpdate, UpdateMessage{VarID: 3, Value: json.RawMessage(`"still here"`)})
+	if resp, _ := h.HandleMessage("c1", update); resp != nil && resp.Error != "" {
+		t.Fatalf("update after teardown failed: %s", resp.Error)
+	}
+	watch, _ := NewMessage(MsgWatch, WatchMessage{VarID: 3})
+	if _, err := h.HandleMessage("c2", watch); err != nil {
+		t.Fatalf("watch after teardown failed: %v", err)
+	}
+	var got UpdateMessage
+	json.Unmarshal(q.sent["c2"][0].Data, &got)
+	if string(got.Value) != `"still here"` {
+		t.Errorf("watch delivered %s", got.Value)
+	}
+	if orphans := b.CheckWatches(false); len(orphans) != 0 {
+		t.Errorf("unbound watches reported as orphans: %v", orphans)
+	}
+}
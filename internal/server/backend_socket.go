@@ -4,13 +4,21 @@ package server
 
 import (
 	"bufio"
+	"cmp"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/zot/ui-engine/internal/config"
 	"github.com/zot/ui-engine/internal/protocol"
@@ -23,11 +31,31 @@ type BackendSocket struct {
 	listener    net.Listener
 	handler     *protocol.Handler
 	httpHandler *HTTPEndpoint
-	connections map[string]net.Conn
+	connections map[string]*backendConn
+	nextConnID  atomic.Int64
 	closed      bool
 	mu          sync.RWMutex
 }
 
+// backendConn is a backend socket connection and what its messages have said
+// about it.
+type backendConn struct {
+	conn      net.Conn
+	client    string // From the messages' client field ("" until one is sent)
+	connected time.Time
+	sessions  []string // Vended IDs named by its session-scoped commands
+	watches   int      // Variables watched and not yet unwatched
+}
+
+// BackendConnection describes a backend socket connection, for GET /api/debug/connections.
+type BackendConnection struct {
+	ID        string    `json:"id"`
+	Client    string    `json:"client,omitempty"`
+	Connected time.Time `json:"connected"`
+	Sessions  []string  `json:"sessions,omitempty"`
+	Watches   int       `json:"watches,omitempty"`
+}
+
 // NewBackendSocket creates a new backend socket handler.
 func NewBackendSocket(cfg *config.Config, socketPath string, handler *protocol.Handler, httpHandler *HTTPEndpoint) *BackendSocket {
 	return &BackendSocket{
@@ -35,13 +63,13 @@ func NewBackendSocket(cfg *config.Config, socketPath string, handler *protocol.H
 		socketPath:  socketPath,
 		handler:     handler,
 		httpHandler: httpHandler,
-		connections: make(map[string]net.Conn),
+		connections: make(map[string]*backendConn),
 	}
 }
 
 // Log logs a message via the config.
 func (bs *BackendSocket) Log(level int, format string, args ...interface{}) {
-	bs.config.Log(level, format, args...)
+	bs.config.Logger(config.LogProtocol).Log(level, format, args...)
 }
 
 // DefaultSocketPath returns the platform-specific default socket path.
@@ -52,11 +80,23 @@ func DefaultSocketPath() string {
 	return "/tmp/ui.sock"
 }
 
+// SocketInUseError reports that a live server already owns the backend socket.
+type SocketInUseError struct {
+	Path   string
+	Status string // What the running server reported about itself
+}
+
+func (e *SocketInUseError) Error() string {
+	return fmt.Sprintf("backend socket %s is in use by a running server (%s); stop it or use --socket", e.Path, e.Status)
+}
+
 // Listen starts listening on the backend socket.
 func (bs *BackendSocket) Listen() error {
-	// Remove existing socket file on Unix
+	// Clear a stale socket file on Unix, but never take over a live one
 	if runtime.GOOS != "windows" {
-		os.Remove(bs.socketPath)
+		if err := bs.prepareSocketPath(); err != nil {
+			return err
+		}
 	}
 
 	// Create listener
@@ -74,15 +114,64 @@ func (bs *BackendSocket) Listen() error {
 	}
 
 	// Accept connections
-	go bs.acceptLoop()
+	go bs.acceptLoop(bs.listener)
 
 	return nil
 }
 
+// prepareSocketPath removes a socket file left behind by a crashed run.
+// A socket that still accepts connections belongs to a running server: it is left
+// alone and reported with that server's status.
+func (bs *BackendSocket) prepareSocketPath() error {
+	if _, err := os.Lstat(bs.socketPath); err != nil {
+		return nil
+	}
+	conn, err := net.DialTimeout("unix", bs.socketPath, time.Second)
+	if err != nil {
+		bs.Log(0, "Removing stale backend socket %s", bs.socketPath)
+		os.Remove(bs.socketPath)
+		return nil
+	}
+	conn.Close()
+	return &SocketInUseError{Path: bs.socketPath, Status: probeSocketStatus(bs.socketPath)}
+}
+
+// probeSocketStatus asks the server behind a socket for its metrics over HTTP.
+func probeSocketStatus(socketPath string) string {
+	client := &http.Client{
+		Timeout: 2 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+	resp, err := client.Get("http://ui/metrics")
+	if err != nil {
+		return "not responding to HTTP; not a ui-engine server?"
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "ui-engine, metrics disabled"
+	}
+	var snap protocol.MetricsSnapshot
+	if err := json.NewDecoder(resp.Body).Decode(&snap); err != nil {
+		return "ui-engine, unreadable metrics"
+	}
+	var total, errs int64
+	for _, st := range snap.Messages {
+		total += st.Count
+		errs += st.Errors
+	}
+	return fmt.Sprintf("ui-engine, %d messages handled, %d errors", total, errs)
+}
+
 // acceptLoop accepts incoming connections.
-func (bs *BackendSocket) acceptLoop() {
+// Takes the listener so Close can clear bs.listener while the loop is running.
+func (bs *BackendSocket) acceptLoop(listener net.Listener) {
 	for {
-		conn, err := bs.listener.Accept()
+		conn, err := listener.Accept()
 		if err != nil {
 			bs.mu.RLock()
 			closed := bs.closed
@@ -99,11 +188,13 @@ func (bs *BackendSocket) acceptLoop() {
 }
 
 // handleConnection handles a new backend connection.
+// Unix socket peers have no address, so connections are numbered.
 func (bs *BackendSocket) handleConnection(conn net.Conn) {
-	connID := "backend-" + conn.RemoteAddr().String()
+	connID := fmt.Sprintf("backend-%d", bs.nextConnID.Add(1))
+	bc := &backendConn{conn: conn, connected: time.Now()}
 
 	bs.mu.Lock()
-	bs.connections[connID] = conn
+	bs.connections[connID] = bc
 	bs.mu.Unlock()
 
 	// Log connection event (verbosity level 1)
@@ -112,10 +203,12 @@ func (bs *BackendSocket) handleConnection(conn net.Conn) {
 	defer func() {
 		bs.mu.Lock()
 		delete(bs.connections, connID)
+		name := bc.name(connID)
 		bs.mu.Unlock()
+		bs.handler.ForgetConnection(connID)
 		conn.Close()
 		// Log disconnection event (verbosity level 1)
-		bs.Log(1, "Backend disconnected: %s", connID)
+		bs.Log(1, "Backend disconnected: %s", name)
 	}()
 
 	// Detect protocol by peeking first 4 bytes
@@ -194,7 +287,9 @@ func (bs *BackendSocket) handlePacketConnection(reader *bufio.Reader, conn net.C
 		}
 
 		resp, err := bs.handler.HandleMessage(connID, msg)
+		bs.observe(connID, msg, err == nil && (resp == nil || resp.Error == ""))
 		if err != nil {
+			bs.handler.RecordError(connID, protocol.ErrorRecord{Type: msg.Type, Description: err.Error()})
 			bs.writePacketError(conn, err.Error())
 			continue
 		}
@@ -204,6 +299,84 @@ func (bs *BackendSocket) handlePacketConnection(reader *bufio.Reader, conn net.C
 	}
 }
 
+// name identifies a connection in logs and events: its client, or its ID.
+func (bc *backendConn) name(connID string) string {
+	if bc.client != "" {
+		return bc.client
+	}
+	return connID
+}
+
+// observe records what a handled message says about its connection: the
+// client's name, sessions named by session-scoped commands, and watches.
+// A session named for the first time is logged and reported to telemetry.
+func (bs *BackendSocket) observe(connID string, msg *protocol.Message, ok bool) {
+	var scoped struct {
+		Session string `json:"session"`
+	}
+	json.Unmarshal(msg.Data, &scoped)
+
+	bs.mu.Lock()
+	bc := bs.connections[connID]
+	if bc == nil {
+		bs.mu.Unlock()
+		return
+	}
+	identified := msg.Client != "" && msg.Client != bc.client
+	if identified {
+		bc.client = msg.Client
+	}
+	if ok {
+		switch msg.Type {
+		case protocol.MsgWatch:
+			bc.watches++
+		case protocol.MsgUnwatch:
+			bc.watches = max(bc.watches-1, 0)
+		}
+	}
+	attached := ok && scoped.Session != "" && !slices.Contains(bc.sessions, scoped.Session)
+	if attached {
+		bc.sessions = append(bc.sessions, scoped.Session)
+	}
+	name := bc.name(connID)
+	bs.mu.Unlock()
+
+	if identified {
+		bs.Log(1, "Backend %s is %s", connID, name)
+	}
+	if attached {
+		bs.Log(1, "Backend %s attached to session %s", name, scoped.Session)
+		bs.handler.Telemetry().OnBackendAttached(scoped.Session, name)
+	}
+}
+
+// Connections lists the open backend connections, oldest first.
+func (bs *BackendSocket) Connections() []BackendConnection {
+	bs.mu.RLock()
+	defer bs.mu.RUnlock()
+	list := make([]BackendConnection, 0, len(bs.connections))
+	for id, bc := range bs.connections {
+		list = append(list, BackendConnection{
+			ID:        id,
+			Client:    bc.client,
+			Connected: bc.connected,
+			Sessions:  slices.Clone(bc.sessions),
+			Watches:   bc.watches,
+		})
+	}
+	slices.SortFunc(list, func(a, b BackendConnection) int {
+		return cmp.Or(a.Connected.Compare(b.Connected), strings.Compare(a.ID, b.ID))
+	})
+	return list
+}
+
+// handleConnectionList serves GET /api/debug/connections: the open backend
+// socket connections.
+func (s *Server) handleConnectionList(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string][]BackendConnection{"backends": s.backendSocket.Connections()})
+}
+
 // writePacketResponse writes a packet-protocol response.
 func (bs *BackendSocket) writePacketResponse(conn net.Conn, resp *protocol.Response) error {
 	data, err := json.Marshal(resp)
@@ -242,9 +415,9 @@ func (bs *BackendSocket) Broadcast(msg *protocol.Message) error {
 	bs.mu.RLock()
 	defer bs.mu.RUnlock()
 
-	for _, conn := range bs.connections {
-		conn.Write(lenBuf)
-		conn.Write(data)
+	for _, bc := range bs.connections {
+		bc.conn.Write(lenBuf)
+		bc.conn.Write(data)
 	}
 	return nil
 }
@@ -258,10 +431,10 @@ func (bs *BackendSocket) Close() error {
 	bs.mu.Lock()
 	defer bs.mu.Unlock()
 
-	for _, conn := range bs.connections {
-		conn.Close()
+	for _, bc := range bs.connections {
+		bc.conn.Close()
 	}
-	bs.connections = make(map[string]net.Conn)
+	bs.connections = make(map[string]*backendConn)
 
 	if bs.listener != nil {
 		err := bs.listener.Close()
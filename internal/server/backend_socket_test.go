@@ -0,0 +1,157 @@
+// CRC: crc-BackendSocket.md
+// Spec: deployment.md
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestListenRemovesStaleSocket verifies a socket file with no server behind it is replaced
+func TestListenRemovesStaleSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ui.sock")
+	crashed, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	crashed.SetUnlinkOnClose(false)
+	crashed.Close()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal("stale socket file should remain for the test")
+	}
+
+	bs := NewBackendSocket(config.DefaultConfig(), path, nil, nil)
+	if err := bs.Listen(); err != nil {
+		t.Fatalf("Listen over stale socket: %v", err)
+	}
+	bs.Close()
+}
+
+// TestListenReportsLiveSocket verifies a running server's socket is left alone and described
+func TestListenReportsLiveSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ui.sock")
+	live, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	go http.Serve(live, http.NotFoundHandler())
+
+	bs := NewBackendSocket(config.DefaultConfig(), path, nil, nil)
+	err = bs.Listen()
+	var inUse *SocketInUseError
+	if !errors.As(err, &inUse) || !strings.Contains(inUse.Status, "metrics disabled") {
+		t.Fatalf("Listen over live socket = %v", err)
+	}
+	if conn, err := net.Dial("unix", path); err != nil {
+		t.Errorf("live socket was removed: %v", err)
+	} else {
+		conn.Close()
+	}
+}
+
+// TestListenHTTPPortRetry verifies busy ports are skipped only when retries are allowed
+func TestListenHTTPPortRetry(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	port := busy.Addr().(*net.TCPAddr).Port
+
+	if _, err := listenHTTP("127.0.0.1", port, 0); err == nil || !strings.Contains(err.Error(), "--port-retry") {
+		t.Errorf("busy port without retry = %v", err)
+	}
+
+	ln, err := listenHTTP("127.0.0.1", port, 5)
+	if err != nil {
+		t.Skipf("no free port after %d: %v", port, err)
+	}
+	defer ln.Close()
+	if got := ln.Addr().(*net.TCPAddr).Port; got <= port || got > port+5 {
+		t.Errorf("retry chose port %d, want %d-%d", got, port+1, port+5)
+	}
+}
+
+// TestBackendConnectionIdentity verifies backend connections are listed with
+// their client name, sessions and watches, and that naming a session reports
+// the client in the session's events
+func TestBackendConnectionIdentity(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`session:createAppVariable({count = 1})`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+	rec := &eventRecorder{}
+	s.SetTelemetry(rec)
+	_, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		s.backendSocket.handleConnection(server)
+		close(done)
+	}()
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		msg.Client = "cli@test"
+		payload, _ := msg.Encode()
+		binary.Write(client, binary.BigEndian, uint32(len(payload)))
+		client.Write(payload)
+		var n uint32
+		binary.Read(client, binary.BigEndian, &n)
+		resp := make([]byte, n)
+		if _, err := io.ReadFull(client, resp); err != nil || strings.Contains(string(resp), `"error"`) {
+			t.Fatalf("%s answered %s (%v)", msgType, resp, err)
+		}
+	}
+	send(protocol.MsgGetRoots, protocol.GetRootsMessage{Session: vendedID})
+	send(protocol.MsgFlush, protocol.FlushMessage{Session: vendedID})
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/connections", nil))
+	var list struct {
+		Backends []BackendConnection `json:"backends"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &list)
+	if len(list.Backends) != 1 || list.Backends[0].Client != "cli@test" || !slices.Equal(list.Backends[0].Sessions, []string{vendedID}) {
+		t.Errorf("connections = %s, want cli@test attached to session %s", w.Body, vendedID)
+	}
+	var attached []string
+	rec.mu.Lock()
+	for _, ev := range rec.events {
+		if strings.HasPrefix(ev, "attached") {
+			attached = append(attached, ev)
+		}
+	}
+	rec.mu.Unlock()
+	if want := []string{"attached " + vendedID + " cli@test"}; !slices.Equal(attached, want) {
+		t.Errorf("attach events = %v, want %v", attached, want)
+	}
+
+	client.Close()
+	<-done
+	if n := len(s.backendSocket.Connections()); n != 0 {
+		t.Errorf("%d connections listed after disconnect", n)
+	}
+}
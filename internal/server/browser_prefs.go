@@ -0,0 +1,96 @@
+// CRC: crc-VariableBrowser.md
+// CRC: crc-HTTPEndpoint.md
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// PrefsObserver is notified when a session's variable browser preferences change.
+type PrefsObserver interface {
+	PrefsChanged(vendedID string, prefs json.RawMessage)
+}
+
+// SetPrefsObserver sets the observer for variable browser preference changes.
+func (h *HTTPEndpoint) SetPrefsObserver(observer PrefsObserver) {
+	h.prefsObserver = observer
+}
+
+// HandleVariablePrefs serves GET and PUT of /{session-id}/variables/prefs.
+// Preferences are an opaque JSON object of at most MaxBrowserPrefsSize bytes.
+func (h *HTTPEndpoint) HandleVariablePrefs(w http.ResponseWriter, r *http.Request, sessionID string) {
+	sess := h.sessions.Get(sessionID)
+	if sess == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(browserPrefsOrEmpty(sess))
+	case http.MethodPut:
+		data, err := io.ReadAll(io.LimitReader(r.Body, MaxBrowserPrefsSize+1))
+		if err != nil {
+			http.Error(w, "Failed to read body", http.StatusBadRequest)
+			return
+		}
+		if len(data) > MaxBrowserPrefsSize {
+			http.Error(w, "Preferences too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(data, &obj); err != nil {
+			http.Error(w, "Preferences must be a JSON object", http.StatusBadRequest)
+			return
+		}
+		prefs := json.RawMessage(data)
+		sess.SetBrowserPrefs(prefs)
+		if h.prefsObserver != nil {
+			h.prefsObserver.PrefsChanged(h.sessions.GetVendedID(sessionID), prefs)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// renderVariableBrowser fills the page's theme and embedded preferences so the
+// first render already uses the saved columns and theme. A non-nil snapshot
+// is embedded in place of fetching variables.json.
+func renderVariableBrowser(sess *Session, snapshot []byte) []byte {
+	prefs := []byte("{}")
+	theme := "light"
+	if sess != nil {
+		prefs = browserPrefsOrEmpty(sess)
+		var p struct {
+			Theme string `json:"theme"`
+		}
+		if json.Unmarshal(prefs, &p) == nil && p.Theme == "dark" {
+			theme = "dark"
+		}
+	}
+	if snapshot == nil {
+		snapshot = []byte("null")
+	}
+	// Escape <, > and & so the JSON cannot close the script element
+	var script, snapshotScript bytes.Buffer
+	json.HTMLEscape(&script, prefs)
+	json.HTMLEscape(&snapshotScript, snapshot)
+	return []byte(strings.NewReplacer(
+		"{{THEME}}", theme,
+		"{{PREFS}}", script.String(),
+		"{{SNAPSHOT}}", snapshotScript.String(),
+	).Replace(variableBrowserHTML))
+}
+
+func browserPrefsOrEmpty(sess *Session) []byte {
+	if prefs := sess.GetBrowserPrefs(); prefs != nil {
+		return prefs
+	}
+	return []byte("{}")
+}
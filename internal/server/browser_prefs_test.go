@@ -0,0 +1,79 @@
+// CRC: crc-VariableBrowser.md
+// CRC: crc-HTTPEndpoint.md
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordingPrefsObserver records preference changes by vended session ID
+type recordingPrefsObserver struct {
+	changes map[string]json.RawMessage
+}
+
+func (o *recordingPrefsObserver) PrefsChanged(vendedID string, prefs json.RawMessage) {
+	o.changes[vendedID] = prefs
+}
+
+// TestVariablePrefsRoundTrip verifies preferences are stored, capped, and embedded in the page
+func TestVariablePrefsRoundTrip(t *testing.T) {
+	sessions := NewSessionManager(time.Hour)
+	endpoint := NewHTTPEndpoint(sessions, nil, nil)
+	observer := &recordingPrefsObserver{changes: make(map[string]json.RawMessage)}
+	endpoint.SetPrefsObserver(observer)
+	sess, vendedID, err := sessions.CreateSession()
+	if err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+	url := "/" + sess.ID + "/variables/prefs"
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		endpoint.ServeHTTP(w, httptest.NewRequest("PUT", url, strings.NewReader(body)))
+		return w.Code
+	}
+
+	// Defaults before anything is saved
+	w := httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Body.String() != "{}" {
+		t.Errorf("initial prefs = %q, want {}", w.Body.String())
+	}
+
+	prefs := `{"theme":"dark","view":"flat","columns":["id","value"],"note":"</script><b>"}`
+	if code := put(prefs); code != http.StatusNoContent {
+		t.Fatalf("PUT = %d, want 204", code)
+	}
+	if string(observer.changes[vendedID]) != prefs {
+		t.Errorf("observer got %q for session %s", observer.changes[vendedID], vendedID)
+	}
+	if code := put(`["not", "an", "object"]`); code != http.StatusBadRequest {
+		t.Errorf("PUT array = %d, want 400", code)
+	}
+	if code := put(`{"x":"` + strings.Repeat("a", MaxBrowserPrefsSize) + `"}`); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT oversized = %d, want 413", code)
+	}
+
+	// Rejected writes leave the stored value alone
+	w = httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+	if w.Body.String() != prefs {
+		t.Errorf("GET = %q, want %q", w.Body.String(), prefs)
+	}
+
+	// The browser page starts in the saved theme with prefs embedded and script-safe
+	w = httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("GET", "/"+sess.ID+"/variables", nil))
+	page, _ := io.ReadAll(w.Result().Body)
+	if !strings.Contains(string(page), `data-theme="dark"`) {
+		t.Error("page should start in the dark theme")
+	}
+	if strings.Contains(string(page), "</script><b>") || !strings.Contains(string(page), `</script>`) {
+		t.Error("embedded prefs are not HTML-escaped")
+	}
+}
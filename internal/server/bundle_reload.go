@@ -0,0 +1,66 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Reload)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+// BundleReloadInfo reports a bundle reload (POST /api/debug/reload-bundle).
+type BundleReloadInfo struct {
+	Files    int `json:"files"`
+	Viewdefs int `json:"viewdefs"`
+}
+
+// ReloadBundle re-reads the site bundle from the executable, for when a new
+// site was bundled over the running binary, and serves it: site files, asset
+// directories, viewdefs and, for new sessions, main.lua. Requests already
+// serving finish against the old bundle, and running sessions keep their Lua
+// code until ReloadSession. SIGHUP and POST /api/debug/reload-bundle call it;
+// an MCP tool should call it through RunMCPTool with MCPSessionControl.
+func (s *Server) ReloadBundle() (BundleReloadInfo, error) {
+	cfg := s.config
+	if cfg.Server.Dir != "" && !cfg.Server.BundleFallback() {
+		return BundleReloadInfo{}, fmt.Errorf("serving from %s without the bundle", cfg.Server.Dir)
+	}
+	s.bundleReloadMu.Lock()
+	defer s.bundleReloadMu.Unlock()
+
+	reader, err := bundle.Reload()
+	if err != nil {
+		return BundleReloadInfo{}, err
+	}
+	s.setupSite(cfg)
+	if err := s.viewdefManager.LoadFromBundle(); err != nil {
+		s.Log(0, "Warning: failed to load viewdefs from bundle: %v", err)
+	}
+	if cfg.Server.Dir != "" {
+		// The directory's viewdefs still win over the bundle's
+		s.viewdefManager.LoadFromDirectory(filepath.Join(cfg.Server.Dir, "viewdefs"))
+	} else if s.luaConfig != nil {
+		s.preloadMainLuaFromBundleToConfig()
+	}
+	info := BundleReloadInfo{Files: len(reader.File), Viewdefs: s.viewdefManager.Count()}
+	s.Log(0, "Reloaded bundle: %d files, %d viewdefs", info.Files, info.Viewdefs)
+	return info, nil
+}
+
+// handleBundleReload serves POST /api/debug/reload-bundle.
+func (s *Server) handleBundleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	info, err := s.ReloadBundle()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
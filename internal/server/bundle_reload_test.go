@@ -0,0 +1,51 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Bundle Reload)
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestReloadBundleUnbundled verifies a reload with no bundle in the executable
+// fails without disturbing the site being served, over the admin endpoint too,
+// and that --dir without the bundle refuses
+func TestReloadBundleUnbundled(t *testing.T) {
+	t.Cleanup(func() { bundle.SetFallback(nil) })
+	cfg := config.DefaultConfig()
+	cfg.Lua.Path = t.TempDir()
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	if _, err := s.ReloadBundle(); err == nil {
+		t.Error("ReloadBundle of an unbundled binary succeeded")
+	}
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/main.js", nil))
+	if w.Code != 200 || w.Body.Len() == 0 {
+		t.Errorf("demo site after failed reload: GET /main.js = %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("POST", "/api/debug/reload-bundle", nil))
+	if w.Code != 409 {
+		t.Errorf("POST /api/debug/reload-bundle = %d, want 409", w.Code)
+	}
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/reload-bundle", nil))
+	if w.Code != 405 {
+		t.Errorf("GET /api/debug/reload-bundle = %d, want 405", w.Code)
+	}
+
+	dirCfg := config.DefaultConfig()
+	dirCfg.Server.Dir = t.TempDir()
+	dirCfg.Server.NoBundleFallback = true
+	d := New(dirCfg)
+	defer d.Shutdown(context.Background())
+	if _, err := d.ReloadBundle(); err == nil {
+		t.Error("ReloadBundle with --no-bundle-fallback succeeded")
+	}
+}
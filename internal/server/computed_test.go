@@ -0,0 +1,126 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Computed Values)
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gopher "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestComputedRecomputation compares 100 computed values with 100 method
+// paths over ten batches that each change one input: the method paths run
+// every time, the computed values only when their inputs change. A failing
+// function leaves a diag and the rest of the batch goes on
+func TestComputedRecomputation(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		calls = {method = 0, computed = 0}
+		Line = {}
+		Line.__index = Line
+		function Line:total()
+			calls.method = calls.method + 1
+			return self.price * self.qty
+		end
+		lines = {}
+		session:createAppVariable({})
+		for i = 1, 100 do
+			local line = setmetatable({price = i, qty = 1}, Line)
+			lines[i] = line
+			local id = session:createRoot("line" .. i, line)
+			session:createVariable(id, {}, {path = "total()"})
+			session:computed(line, "sum", {"price", "qty"}, function(self)
+				calls.computed = calls.computed + 1
+				if self.qty < 0 then error("negative quantity") end
+				return self.price * self.qty
+			end)
+		end
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	_, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	calls := func(kind string) int {
+		var n int
+		s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			n = int(luaSession.State.GetField(luaSession.State.GetGlobal("calls"), kind).(gopher.LNumber))
+			return nil, nil
+		})
+		return n
+	}
+	run := func(code string) {
+		t.Helper()
+		if _, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			if _, err := luaSession.LoadCodeDirect("test", code); err != nil {
+				return nil, err
+			}
+			luaSession.AfterBatch(vendedID)
+			return nil, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	method, computed := calls("method"), calls("computed")
+	if computed != 100 {
+		t.Fatalf("computed functions ran %d times at creation, want 100", computed)
+	}
+
+	for i := 1; i <= 10; i++ {
+		run(fmt.Sprintf(`lines[%d].qty = lines[%d].qty + 1`, i, i))
+	}
+	method, computed = calls("method")-method, calls("computed")-computed
+	if computed != 10 {
+		t.Errorf("computed functions ran %d times over 10 batches, want 10", computed)
+	}
+	if method < 1000 {
+		t.Errorf("method paths ran %d times over 10 batches, want at least 1000", method)
+	}
+	t.Logf("10 batches: %d method path calls, %d computed calls", method, computed)
+
+	// Only a changed result changes the variable
+	tracker := luaSession.GetTracker()
+	roots, _ := luaSession.Roots()
+	var sum *changetracker.Variable
+	for _, v := range tracker.Children(roots["line5"]) {
+		if v.Properties["path"] == "sum" {
+			sum = v
+		}
+	}
+	changes := sum.ChangeCount
+	run(`lines[5].price, lines[5].qty = lines[5].qty, lines[5].price`)
+	if sum.ChangeCount != changes || sum.ValueJSON != float64(10) {
+		t.Errorf("swapping inputs changed the sum to %v (%d changes)", sum.ValueJSON, sum.ChangeCount-changes)
+	}
+
+	run(`lines[5].qty = -1`)
+	vars, err := s.getDebugVariables(tracker, luaSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vars {
+		if v.ID == sum.ID && (len(v.Diags) != 1 || !strings.Contains(v.Diags[0], "negative quantity")) {
+			t.Errorf("diags = %q, want the error", v.Diags)
+		}
+	}
+	if sum.ValueJSON != float64(10) {
+		t.Errorf("sum after an error = %v, want the previous 10", sum.ValueJSON)
+	}
+	run(`lines[5].qty = 3`)
+	if diags := luaSession.VariableDiags(sum.ID); diags != nil {
+		t.Errorf("diags after a successful run = %q", diags)
+	}
+}
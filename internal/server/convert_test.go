@@ -0,0 +1,83 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Conversion Limits)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestCyclicValueDiag verifies a watched array that contains itself is sent
+// with a $cycle marker instead of recursing forever, that the variable
+// browser shows why, and that the session keeps working
+func TestCyclicValueDiag(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {loop = {}, count = 1}
+		app.loop[1] = app.loop
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	for id, path := range map[int64]string{2: "loop", 3: "count"} {
+		msg, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: id, ParentID: 1, Properties: map[string]string{"path": path}})
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("create %s failed: %v %+v", path, err, resp)
+		}
+	}
+	updates := luaSession.AfterBatch(vendedID)
+
+	var loop []map[string]int64
+	for _, u := range updates {
+		if u.VarID == 2 {
+			json.Unmarshal(u.Value, &loop)
+		}
+	}
+	tracker := luaSession.GetTracker()
+	if len(loop) != 1 || loop[0]["obj"] == 0 {
+		t.Fatalf("loop value = %v, want one object reference", loop)
+	}
+	if marker, _ := json.Marshal(tracker.GetObject(loop[0]["obj"])); string(marker) != `{"$cycle":true}` {
+		t.Errorf("loop element = %s, want the $cycle marker", marker)
+	}
+	want := []string{"table contains itself"}
+	vars, err := s.getDebugVariables(tracker, luaSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vars {
+		if v.ID == 2 && !slices.Equal(v.Diags, want) {
+			t.Errorf("variable browser diags = %q, want %q", v.Diags, want)
+		}
+	}
+
+	// The session still runs, and the marker does not read as a change
+	if _, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return luaSession.LoadCodeDirect("bump", `app.count = 2`)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	updates = luaSession.AfterBatch(vendedID)
+	if len(updates) != 1 || updates[0].VarID != 3 {
+		t.Errorf("updates after changing count = %+v, want only variable 3", updates)
+	}
+}
@@ -0,0 +1,194 @@
+// CRC: crc-Server.md
+// Spec: deployment.md (Crash Bundles)
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+const (
+	crashEventCount    = 200      // Telemetry events kept in memory for crash bundles
+	crashMaxStackBytes = 4 << 20  // Cap on the all-goroutine dump
+	crashMaxSessions   = 1000     // Sessions listed in a bundle
+	crashBundlePrefix  = "crash-" // Bundle file names: crash-<time>-<pid>.json
+	crashBundleSuffix  = ".json"
+	crashTimeFormat    = "20060102-150405"
+)
+
+// CrashBundle is the post-mortem report written when the server dies of a panic.
+type CrashBundle struct {
+	Time       time.Time         `json:"time"`
+	Where      string            `json:"where"` // The goroutine that panicked, e.g. "main", "cleanup"
+	Panic      string            `json:"panic"`
+	Stack      string            `json:"stack"`      // The panicking goroutine
+	Goroutines string            `json:"goroutines"` // All goroutines, truncated to crashMaxStackBytes
+	Build      map[string]string `json:"build"`
+	Config     map[string]any    `json:"config"`
+	Sessions   []SessionInfo     `json:"sessions"`
+	Events     []json.RawMessage `json:"events"` // Most recent telemetry events, oldest first
+}
+
+// RecoverCrash writes a crash bundle for a panic and then panics again, so the
+// process still dies with a non-zero exit code. Defer it at the top of main
+// and of every long-running goroutine:
+//
+//	defer s.RecoverCrash("cleanup")
+func (s *Server) RecoverCrash(where string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if path, err := s.WriteCrashBundle(where, r, debug.Stack()); err != nil {
+		s.Log(0, "Failed to write crash bundle: %v", err)
+	} else if path != "" {
+		s.Log(0, "Crash bundle written to %s", path)
+	}
+	panic(r)
+}
+
+// WriteCrashBundle writes a crash bundle to the configured crash directory and
+// removes the oldest bundles beyond CrashKeep. Returns "" when crash bundles are off.
+func (s *Server) WriteCrashBundle(where string, panicValue any, stack []byte) (string, error) {
+	dir := s.config.Server.CrashDir
+	if dir == "" {
+		return "", nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	report := CrashBundle{
+		Time:       now.UTC(),
+		Where:      where,
+		Panic:      fmt.Sprint(panicValue),
+		Stack:      string(stack),
+		Goroutines: allGoroutines(),
+		Build:      buildSummary(),
+		Config:     s.configSummary(),
+		Sessions:   s.sessions.List(),
+		Events:     []json.RawMessage{},
+	}
+	if len(report.Sessions) > crashMaxSessions {
+		report.Sessions = report.Sessions[:crashMaxSessions]
+	}
+	if s.events != nil {
+		var buf bytes.Buffer
+		s.events.WriteNDJSON(&buf)
+		for line := range strings.SplitSeq(strings.TrimSpace(buf.String()), "\n") {
+			if line != "" {
+				report.Events = append(report.Events, json.RawMessage(line))
+			}
+		}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s%s-%d%s", crashBundlePrefix, now.Format(crashTimeFormat), os.Getpid(), crashBundleSuffix)
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	rotateCrashBundles(dir, s.config.Server.CrashKeep)
+	return path, nil
+}
+
+// ListCrashBundles returns the crash bundle paths in dir, newest first.
+func ListCrashBundles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, crashBundlePrefix) && strings.HasSuffix(name, crashBundleSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	// Names start with a sortable timestamp
+	slices.Sort(paths)
+	slices.Reverse(paths)
+	return paths, nil
+}
+
+// rotateCrashBundles removes all but the newest keep bundles.
+func rotateCrashBundles(dir string, keep int) {
+	keep = max(keep, 1)
+	paths, err := ListCrashBundles(dir)
+	if err != nil || len(paths) <= keep {
+		return
+	}
+	for _, path := range paths[keep:] {
+		os.Remove(path)
+	}
+}
+
+// allGoroutines returns every goroutine's stack, truncated to crashMaxStackBytes.
+func allGoroutines() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= crashMaxStackBytes {
+			if n == len(buf) {
+				return string(buf[:n]) + "\n... truncated"
+			}
+			return string(buf[:n])
+		}
+		buf = make([]byte, min(2*len(buf), crashMaxStackBytes))
+	}
+}
+
+// buildSummary identifies the binary and the site it serves.
+func buildSummary() map[string]string {
+	summary := map[string]string{"go": runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		summary["module"] = info.Main.Path + "@" + info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" || setting.Key == "vcs.modified" {
+				summary[setting.Key] = setting.Value
+			}
+		}
+	}
+	if reader, err := bundle.GetBundleReader(); err == nil && reader != nil {
+		// Fingerprint of the bundled files' names and checksums
+		h := sha256.New()
+		for _, f := range reader.File {
+			h.Write([]byte(f.Name))
+			binary.Write(h, binary.BigEndian, f.CRC32)
+		}
+		summary["bundle"] = hex.EncodeToString(h.Sum(nil))[:16]
+	}
+	return summary
+}
+
+// configSummary returns the settings that matter for a post-mortem, without
+// anything secret-bearing such as redaction lists.
+func (s *Server) configSummary() map[string]any {
+	cfg := s.config
+	return map[string]any{
+		"host":           cfg.Server.Host,
+		"port":           cfg.Server.Port,
+		"dir":            cfg.Server.Dir,
+		"socket":         cfg.Server.Socket,
+		"metrics":        cfg.Server.Metrics,
+		"lua":            cfg.Lua.Enabled,
+		"hotload":        cfg.Lua.Hotload,
+		"sessionTimeout": cfg.Session.Timeout.Duration().String(),
+		"verbosity":      cfg.Verbosity(),
+	}
+}
@@ -0,0 +1,75 @@
+// CRC: crc-Server.md
+// Spec: deployment.md (Crash Bundles)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestCrashBundle verifies a panic writes a bundle, re-panics, and that old
+// bundles are rotated out
+func TestCrashBundle(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Lua.Enabled = false
+	cfg.Server.Demo = config.DemoOff
+	cfg.Server.CrashDir = t.TempDir()
+	cfg.Server.CrashKeep = 2
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+	if _, _, err := s.sessions.CreateSessionInGroup("wall1"); err != nil {
+		t.Fatal(err)
+	}
+	for range crashEventCount + 10 {
+		s.events.OnError("1", errors.New("old event"))
+	}
+	s.events.OnError("1", errors.New("last event"))
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("RecoverCrash re-panicked with %v, want boom", r)
+			}
+		}()
+		defer s.RecoverCrash("cleanup")
+		panic("boom")
+	}()
+
+	paths, err := ListCrashBundles(cfg.Server.CrashDir)
+	if err != nil || len(paths) != 1 {
+		t.Fatalf("bundles = %v, %v", paths, err)
+	}
+	data, _ := os.ReadFile(paths[0])
+	var bundle CrashBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		t.Fatal(err)
+	}
+	if bundle.Where != "cleanup" || bundle.Panic != "boom" || !strings.Contains(bundle.Stack, "TestCrashBundle") {
+		t.Errorf("bundle where=%q panic=%q stack:\n%s", bundle.Where, bundle.Panic, bundle.Stack)
+	}
+	if !strings.Contains(bundle.Goroutines, "goroutine ") || bundle.Build["go"] == "" || bundle.Config["port"] == nil {
+		t.Errorf("bundle lacks goroutines, build or config: %+v %+v", bundle.Build, bundle.Config)
+	}
+	if len(bundle.Sessions) != 1 || bundle.Sessions[0].Group != "wall1" {
+		t.Errorf("bundle sessions = %+v", bundle.Sessions)
+	}
+	if len(bundle.Events) != crashEventCount || !strings.Contains(string(bundle.Events[crashEventCount-1]), "last event") {
+		t.Errorf("bundle has %d events, want the last %d", len(bundle.Events), crashEventCount)
+	}
+
+	// Rotation keeps the newest CrashKeep bundles
+	for _, name := range []string{"crash-20000101-000000-1.json", "crash-20000102-000000-1.json"} {
+		os.WriteFile(filepath.Join(cfg.Server.CrashDir, name), []byte("{}"), 0600)
+	}
+	rotateCrashBundles(cfg.Server.CrashDir, cfg.Server.CrashKeep)
+	if paths, _ := ListCrashBundles(cfg.Server.CrashDir); len(paths) != 2 || !strings.Contains(paths[1], "20000102") {
+		t.Errorf("after rotation: %v", paths)
+	}
+}
@@ -0,0 +1,168 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Session Critical Sections)
+package server
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// OpClass is the kind of work an operation does in a session. Every class runs
+// on the session executor; reloads also hold off interactive work.
+type OpClass int
+
+const (
+	OpInteractive   OpClass = iota // Frontend messages and session timers
+	OpExternalWrite                // MCP tools and backend calls (ExecuteInSession)
+	OpReload                       // Hot reloads, which swap module state
+)
+
+// retryCode is the error code sent for frontend messages rejected during a reload.
+const retryCode = "retry"
+
+// errReloading rejects interactive work while a reload is queued or running
+// and lua.reload_policy is "reject".
+var errReloading = errors.New("session reloading, retry")
+
+// sessionTask is one operation queued on a session executor.
+type sessionTask struct {
+	class  OpClass
+	ticket int64 // Barrier ticket, outstanding while the task is held
+	code   func()
+	reject func(error) // Called instead of code when rejected (nil = always wait)
+}
+
+// sessionGate gives reloads exclusive access to a session: interactive tasks
+// that reach the executor while a reload is queued or running are held until
+// every reload has finished.
+type sessionGate struct {
+	mu      sync.Mutex
+	reloads int
+	held    []*sessionTask
+}
+
+func (g *sessionGate) beginReload() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reloads++
+}
+
+// endReload returns the held tasks once the last reload has finished.
+func (g *sessionGate) endReload() []*sessionTask {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.reloads--
+	if g.reloads > 0 {
+		return nil
+	}
+	held := g.held
+	g.held = nil
+	return held
+}
+
+// reloading reports whether a reload is queued or running.
+func (g *sessionGate) reloading() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.reloads > 0
+}
+
+// hold keeps a task until the reloads finish, unless they already have.
+func (g *sessionGate) hold(t *sessionTask) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.reloads == 0 {
+		return false
+	}
+	g.held = append(g.held, t)
+	return true
+}
+
+// submit queues a task of a class on a session's executor, counting it in
+// QueueDepth until it starts and holding up flushes until it finishes.
+func (ws *WebSocketEndpoint) submit(sessionID string, class OpClass, code func(), reject func(error)) {
+	svc, barrier, gate := ws.getOrCreateSvc(sessionID)
+	if class == OpReload {
+		gate.beginReload()
+	}
+	if ws.rejects(class, reject, gate) {
+		reject(errReloading)
+		return
+	}
+	t := &sessionTask{class: class, ticket: barrier.start(), code: code, reject: reject}
+	ws.queued.Add(1)
+	Svc(svc, func() {
+		ws.queued.Add(-1)
+		ws.run(svc, barrier, gate, t)
+	})
+}
+
+// run runs a task on the executor under its class's rules. A reload releases
+// the interactive tasks it held, in arrival order, as one executor task.
+func (ws *WebSocketEndpoint) run(svc ChanSvc, barrier *executorBarrier, gate *sessionGate, t *sessionTask) {
+	if ws.rejects(t.class, t.reject, gate) {
+		barrier.finish(t.ticket)
+		t.reject(errReloading)
+		return
+	}
+	if t.class == OpInteractive && gate.hold(t) {
+		return
+	}
+	defer barrier.finish(t.ticket)
+	if t.class == OpReload {
+		defer func() {
+			if held := gate.endReload(); len(held) > 0 {
+				ws.queued.Add(int64(len(held)))
+				Svc(svc, func() {
+					for _, h := range held {
+						ws.queued.Add(-1)
+						ws.run(svc, barrier, gate, h)
+					}
+				})
+			}
+		}()
+	}
+	t.code()
+}
+
+// rejects reports whether interactive work is turned away by a reload under
+// the "reject" policy. Work that cannot be retried (reject is nil) always waits.
+func (ws *WebSocketEndpoint) rejects(class OpClass, reject func(error), gate *sessionGate) bool {
+	return class == OpInteractive && reject != nil && ws.config.Lua.ReloadPolicy == "reject" && gate.reloading()
+}
+
+// ExecuteClass runs a function of a class on a session's executor and waits
+// for it. AfterBatch runs in the same task, so a reload's changes go out
+// before any other work sees the session. Interactive work rejected during a
+// reload returns errReloading.
+func (ws *WebSocketEndpoint) ExecuteClass(sessionID string, class OpClass, fn func() (interface{}, error)) (interface{}, error) {
+	var result interface{}
+	var err error
+	done := make(chan struct{})
+	ws.submit(sessionID, class, func() {
+		defer close(done)
+		result, err = fn()
+		// Only with connections, so viewdefs aren't marked sent before a browser connects
+		if ws.afterBatch != nil && ws.HasConnectionsForSession(sessionID) {
+			ws.afterBatch(sessionID, false)
+		}
+	}, func(e error) {
+		err = e
+		close(done)
+	})
+	<-done
+	return result, err
+}
+
+// rejectMessage tells a connection its frame was not processed because the
+// session was reloading, so the client can send it again.
+func (ws *WebSocketEndpoint) rejectMessage(connectionID string) func(error) {
+	return func(err error) {
+		ws.Log(1, "Rejected message during reload: conn=%s", connectionID)
+		msg, _ := protocol.NewMessage(protocol.MsgError, protocol.ErrorMessage{Code: retryCode, Description: err.Error()})
+		ws.handler.RecordError(connectionID, protocol.ErrorRecord{Code: retryCode, Description: err.Error()})
+		ws.Send(connectionID, msg)
+	}
+}
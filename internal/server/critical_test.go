@@ -0,0 +1,161 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Session Critical Sections)
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+const criticalMain = `
+	Item = session:prototype("Item", {n = 0})
+	Item.version = 0
+	app = {version = 0, items = {}}
+	function app:add()
+		if #self.items >= 20 then table.remove(self.items, 1) end
+		table.insert(self.items, session:create(Item, {n = #self.items}))
+	end
+	session:createAppVariable(app)
+`
+
+// newCriticalServer starts a server with one session and a polling connection
+// watching the app's items, with variable 2 calling app:add() when updated.
+func newCriticalServer(t *testing.T, policy string) (*Server, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(criticalMain), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Lua.ReloadPolicy = policy
+	s := New(cfg)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.wsEndpoint.ConnectPolling(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, create := range []protocol.CreateMessage{
+		{ID: 2, ParentID: 1, Properties: map[string]string{"path": "add()", "access": "action"}},
+		{ID: 3, ParentID: 1, Properties: map[string]string{"path": "items"}},
+	} {
+		msg, _ := protocol.NewMessage(protocol.MsgCreate, create)
+		if resp, err := s.wsEndpoint.HandlePolled(conn, msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("create %d failed: %v %+v", create.ID, err, resp)
+		}
+	}
+	return s, vendedID, conn
+}
+
+// reloadMain hot reloads main.lua's prototypes and module state as version n.
+func reloadMain(s *Server, vendedID string, n int) error {
+	return s.runReload(vendedID, func() error {
+		return s.GetLuaSession(vendedID).ReloadDirect("main.lua", fmt.Sprintf(`
+			Item = session:prototype("Item", {n = 0})
+			Item.version = %d
+			app.version = %d
+		`, n, n))
+	})
+}
+
+// TestCriticalSectionStress interleaves reloads, external writes and frontend
+// messages and checks that no operation sees a half-swapped module
+func TestCriticalSectionStress(t *testing.T) {
+	s, vendedID, conn := newCriticalServer(t, "")
+	const iterations = 2000
+	add, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Value: []byte("true")})
+	poll, _ := protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 3)
+	worker := func(fn func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= iterations; i++ {
+				if err := fn(i); err != nil {
+					errs <- fmt.Errorf("iteration %d: %w", i, err)
+					return
+				}
+			}
+		}()
+	}
+	worker(func(i int) error { return reloadMain(s, vendedID, i) })
+	worker(func(i int) error {
+		_, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			luaSession := s.GetLuaSession(vendedID)
+			if v := luaSession.GetTracker().GetVariable(1); v == nil || v.Value == nil {
+				return nil, errors.New("variable 1 not resolvable")
+			}
+			return luaSession.LoadCodeDirect("check", `
+				for _, item in ipairs(app.items) do
+					if getmetatable(item) ~= Item then error("mixed-module metatable") end
+				end
+				if Item.version ~= app.version then error("mixed module state") end
+			`)
+		})
+		return err
+	})
+	worker(func(i int) error {
+		resp, err := s.wsEndpoint.HandlePolled(conn, add)
+		if err == nil && resp != nil && resp.Error != "" {
+			err = errors.New(resp.Error)
+		}
+		if i%100 == 0 {
+			s.wsEndpoint.HandlePolled(conn, poll)
+		}
+		return err
+	})
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if ok, err := s.GetLuaSession(vendedID).LoadCode("final", fmt.Sprintf(`return app.version == %d and #app.items == 20`, iterations)); err != nil || ok != true {
+		t.Errorf("final state missing reloads or messages (%v)", err)
+	}
+}
+
+// TestReloadRejectPolicy verifies frontend messages are turned away with a
+// retry error while a reload is queued under the "reject" policy, and run once
+// it has finished
+func TestReloadRejectPolicy(t *testing.T) {
+	s, vendedID, conn := newCriticalServer(t, "reject")
+	add, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Value: []byte("true")})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	reloaded := make(chan error)
+	go func() {
+		reloaded <- s.runReload(vendedID, func() error {
+			close(started)
+			<-release
+			return nil
+		})
+	}()
+	<-started
+	if _, err := s.wsEndpoint.HandlePolled(conn, add); !errors.Is(err, errReloading) {
+		t.Errorf("message during reload returned %v, want errReloading", err)
+	}
+	close(release)
+	if err := <-reloaded; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.wsEndpoint.HandlePolled(conn, add); err != nil {
+		t.Errorf("message after reload returned %v", err)
+	}
+	if ok, err := s.GetLuaSession(vendedID).LoadCode("count", `return #app.items == 1`); err != nil || ok != true {
+		t.Errorf("app.items has the rejected message's item (%v)", err)
+	}
+}
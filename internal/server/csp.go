@@ -0,0 +1,82 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md, viewdefs.md
+package server
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/zot/ui-engine/internal/viewdef"
+)
+
+// newNonce returns a random CSP nonce.
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// CSPNonce returns the session's script nonce, created on first use. It lasts as
+// long as the session so every open page of it accepts its viewdef scripts.
+func (s *Session) CSPNonce() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cspNonce == "" {
+		s.cspNonce = newNonce()
+	}
+	return s.cspNonce
+}
+
+// cspHeader adds nonce sources to the policy's script-src, adding the directive
+// when the policy has none.
+func cspHeader(policy string, nonces ...string) string {
+	var sources strings.Builder
+	for _, nonce := range nonces {
+		sources.WriteString(" 'nonce-" + nonce + "'")
+	}
+	directives := strings.Split(policy, ";")
+	for i, d := range directives {
+		if fields := strings.Fields(d); len(fields) > 0 && strings.EqualFold(fields[0], "script-src") {
+			directives[i] = strings.TrimRight(d, " ") + sources.String()
+			return strings.Join(directives, ";")
+		}
+	}
+	return strings.TrimRight(policy, "; ") + "; script-src" + sources.String()
+}
+
+// SetCSP enables a Content-Security-Policy on served pages ("" disables it).
+func (h *HTTPEndpoint) SetCSP(policy string) {
+	h.csp = policy
+}
+
+// serveIndex serves the SPA page for a session. With CSP on, each response gets a
+// fresh nonce for the page's own scripts plus the session's nonce for viewdefs.
+func (h *HTTPEndpoint) serveIndex(w http.ResponseWriter, r *http.Request, sessionID string) {
+	sess := h.sessions.Get(sessionID)
+	if h.csp == "" || sess == nil {
+		h.serveStatic(w, r, "index.html")
+		return
+	}
+	var data []byte
+	var err error
+	if h.staticDir != "" {
+		data, err = os.ReadFile(h.staticDir + "/index.html")
+	} else if site := h.site(); site != nil {
+		data, err = fs.ReadFile(site, "index.html")
+	} else {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	nonce := newNonce()
+	w.Header().Set("Content-Security-Policy", cspHeader(h.csp, nonce, sess.CSPNonce()))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store") // the nonce must not be replayed
+	w.Write([]byte(viewdef.AddScriptNonce(string(data), nonce)))
+}
@@ -0,0 +1,60 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md, viewdefs.md
+package server
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCSPHeader(t *testing.T) {
+	tests := []struct{ policy, want string }{
+		{"script-src 'self'; object-src 'none'", "script-src 'self' 'nonce-a' 'nonce-b'; object-src 'none'"},
+		{"default-src 'self';", "default-src 'self'; script-src 'nonce-a' 'nonce-b'"},
+	}
+	for _, tt := range tests {
+		if got := cspHeader(tt.policy, "a", "b"); got != tt.want {
+			t.Errorf("cspHeader(%q) = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+// TestServeIndexNonces verifies each page response gets a fresh nonce on its
+// scripts and header, alongside the session's stable viewdef nonce
+func TestServeIndexNonces(t *testing.T) {
+	sessions := NewSessionManager(time.Hour)
+	endpoint := NewHTTPEndpoint(sessions, nil, nil)
+	endpoint.SetEmbeddedSite(&mockFS{files: map[string]string{
+		"index.html": `<html><script>boot()</script><script type="module" src="/app.js"></script></html>`,
+	}})
+	endpoint.SetCSP("script-src 'self'")
+	sess, _, _ := sessions.CreateSession()
+
+	get := func() (string, string) {
+		w := httptest.NewRecorder()
+		endpoint.ServeHTTP(w, httptest.NewRequest("GET", "/"+sess.ID, nil))
+		body, _ := io.ReadAll(w.Result().Body)
+		return w.Header().Get("Content-Security-Policy"), string(body)
+	}
+	header1, body1 := get()
+	header2, body2 := get()
+
+	nonce := strings.TrimSuffix(strings.TrimPrefix(header1, "script-src 'self' 'nonce-"), "' 'nonce-"+sess.CSPNonce()+"'")
+	if nonce == header1 || strings.Count(body1, `nonce="`+nonce+`"`) != 2 {
+		t.Fatalf("header %q does not match page %s", header1, body1)
+	}
+	if header1 == header2 || body1 == body2 {
+		t.Error("nonce was reused across responses")
+	}
+	if !strings.HasSuffix(header2, "'nonce-"+sess.CSPNonce()+"'") {
+		t.Errorf("session nonce missing from %q", header2)
+	}
+
+	endpoint.SetCSP("")
+	if header, _ := get(); header != "" {
+		t.Errorf("CSP off still sent %q", header)
+	}
+}
@@ -0,0 +1,61 @@
+// CRC: crc-LuaBackend.md
+// Spec: protocol.md
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+type backendLookup struct{ b backend.Backend }
+
+func (l backendLookup) GetBackendForConnection(string) backend.Backend { return l.b }
+
+// TestRootCreatedAfterWatch verifies a session without main.lua answers a watch on
+// variable 1 as pending, and sends variable 1 once the backend creates it later
+func TestRootCreatedAfterWatch(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	watch, _ := protocol.NewMessage(protocol.MsgWatch, protocol.WatchMessage{VarID: 1})
+	resp, err := h.HandleMessage("c1", watch)
+	if err != nil {
+		t.Fatalf("watch failed: %v", err)
+	}
+	if result, _ := resp.Result.(map[string]bool); !result["pending"] {
+		t.Fatalf("watch result = %+v, want pending", resp.Result)
+	}
+
+	luaSession := s.GetLuaSession(vendedID)
+	if updates := luaSession.AfterBatch(vendedID); len(updates) != 0 {
+		t.Fatalf("updates before variable 1 exists: %+v", updates)
+	}
+
+	// The backend gets around to creating variable 1 in a later batch
+	if _, err := luaSession.LoadCode("backend", `session:createAppVariable({count = 1})`); err != nil {
+		t.Fatal(err)
+	}
+	sent := false
+	for _, u := range luaSession.AfterBatch(vendedID) {
+		sent = sent || u.VarID == 1 && u.Value != nil
+	}
+	if !sent {
+		t.Error("variable 1 value not sent after it was created")
+	}
+}
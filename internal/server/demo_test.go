@@ -0,0 +1,83 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Demo Site)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestDemoSite smoke-tests the built-in demo: with no bundle and no --dir it
+// serves the page, loads the viewdefs, and runs the counter app, whose action
+// buttons change a watched value and fill a ViewList. --demo=off disables it
+func TestDemoSite(t *testing.T) {
+	t.Cleanup(func() { bundle.SetFallback(nil) })
+	cfg := config.DefaultConfig()
+	cfg.Lua.Path = t.TempDir() // No filesystem Lua, like a fresh install
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/main.js", nil))
+	if w.Code != 200 || w.Body.Len() == 0 {
+		t.Fatalf("GET /main.js = %d", w.Code)
+	}
+	for _, key := range []string{"Counter.DEFAULT", "Count.list-item", "lua.ViewList.DEFAULT"} {
+		if _, ok := s.viewdefManager.GetAllViewdefs()[key]; !ok {
+			t.Errorf("demo viewdef %s not loaded", key)
+		}
+	}
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	tracker := luaSession.GetTracker()
+	if typ := tracker.GetVariable(1).Properties["type"]; typ != "Counter" {
+		t.Fatalf("app variable type = %q, want Counter", typ)
+	}
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msgType, err, resp)
+		}
+	}
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "count"}})
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 3, ParentID: 1, Properties: map[string]string{"path": "increment()", "access": "action"}})
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 4, ParentID: 1, Properties: map[string]string{"path": "record()", "access": "action"}})
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 5, ParentID: 1, Properties: map[string]string{"path": "history", "wrapper": "lua.ViewList"}})
+	send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 3, Value: json.RawMessage(`null`)})
+	send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 3, Value: json.RawMessage(`null`)})
+	send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 4, Value: json.RawMessage(`null`)})
+	luaSession.AfterBatch(vendedID)
+
+	if count, _ := json.Marshal(tracker.GetVariable(2).ValueJSON); string(count) != "2" {
+		t.Errorf("count = %s, want 2", count)
+	}
+	if list, ok := tracker.GetVariable(5).WrapperValue.(*lua.ViewList); !ok || len(list.Items) != 1 {
+		t.Errorf("history ViewList = %#v, want 1 item", tracker.GetVariable(5).WrapperValue)
+	}
+
+	// --demo=off restores the "no site" behavior
+	bundle.SetFallback(nil)
+	cfg = config.DefaultConfig()
+	cfg.Lua.Enabled = false
+	cfg.Server.Demo = config.DemoOff
+	off := New(cfg)
+	defer off.Shutdown(context.Background())
+	if bundled, _ := bundle.IsBundled(); bundled {
+		t.Error("demo served with --demo=off")
+	}
+}
@@ -0,0 +1,143 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Draining a Session)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// drainCode is the error creates get once a draining session's grace period
+// is over, and the code of the notice sent when the session ends.
+const drainCode = "DRAINING"
+
+// Draining reports whether the session is draining.
+func (s *Session) Draining() bool {
+	return !s.DrainDeadline().IsZero()
+}
+
+// DrainDeadline returns when a draining session is destroyed, or the zero
+// time if it is not draining.
+func (s *Session) DrainDeadline() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.drainDeadline
+}
+
+// drainExpired reports whether the session's grace period is over.
+func (s *Session) drainExpired(now time.Time) bool {
+	deadline := s.DrainDeadline()
+	return !deadline.IsZero() && !now.Before(deadline)
+}
+
+func (s *Session) setDrain(message string, deadline time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.drainMessage = message
+	s.drainDeadline = deadline
+}
+
+// DrainSession ends a session gently: message shows as a banner on variable 1
+// (the stock frontend renders it), new connections to the session are
+// refused, and after grace its creates are refused and it is destroyed.
+func (s *Server) DrainSession(vendedID, message string, grace time.Duration) (*SessionInfo, error) {
+	internalID := s.sessions.GetInternalID(vendedID)
+	sess := s.sessions.Get(internalID)
+	if sess == nil {
+		return nil, fmt.Errorf("session %s not found", vendedID)
+	}
+	sess.setDrain(message, time.Now().Add(grace))
+	if message != "" {
+		s.setBanner(vendedID, message)
+	}
+	time.AfterFunc(grace, s.destroyDrainedSessions)
+	s.Log(0, "Session %s draining, ends in %v", vendedID, grace)
+	for _, info := range s.sessions.List() {
+		if info.ID == vendedID {
+			return &info, nil
+		}
+	}
+	return nil, fmt.Errorf("session %s not found", vendedID)
+}
+
+// setBanner sets variable 1's banner property, which the stock frontend shows
+// above the app.
+func (s *Server) setBanner(vendedID, message string) {
+	luaSession := s.GetLuaSession(vendedID)
+	if luaSession == nil {
+		return
+	}
+	s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		if tracker := luaSession.GetTracker(); tracker != nil {
+			if v1 := tracker.GetVariable(1); v1 != nil {
+				v1.SetProperty("banner", message)
+				luaSession.MarkDirty()
+			}
+		}
+		return nil, nil
+	})
+}
+
+// RefusesCreates reports whether a session (vended ID) is past its drain grace
+// period. Implements protocol.DrainChecker.
+func (s *Server) RefusesCreates(vendedID string) bool {
+	sess := s.sessions.Get(s.sessions.GetInternalID(vendedID))
+	return sess != nil && sess.drainExpired(time.Now())
+}
+
+// destroyDrainedSessions destroys the sessions whose drain grace period is
+// over, telling their connections first. The drain timer and the cleanup
+// worker both call it.
+func (s *Server) destroyDrainedSessions() {
+	now := time.Now()
+	for _, sess := range s.sessions.GetAllSessions() {
+		if !sess.drainExpired(now) {
+			continue
+		}
+		sess.mu.RLock()
+		message := sess.drainMessage
+		sess.mu.RUnlock()
+		if message == "" {
+			message = "session ended for maintenance"
+		}
+		notice, _ := protocol.NewMessage(protocol.MsgError, protocol.ErrorMessage{Code: drainCode, Description: message})
+		s.wsEndpoint.Broadcast(sess.ID, notice)
+		vendedID := s.sessions.GetVendedID(sess.ID)
+		s.sessions.DestroySession(sess.ID)
+		s.Log(0, "Session %s drained", vendedID)
+	}
+}
+
+// handleSessionDrain serves POST /api/debug/drain?session=ID&grace=5m&message=text,
+// starting to drain a session and responding with its SessionInfo.
+func (s *Server) handleSessionDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	query := r.URL.Query()
+	vendedID := query.Get("session")
+	if vendedID == "" {
+		http.Error(w, "session required", http.StatusBadRequest)
+		return
+	}
+	var grace time.Duration
+	if g := query.Get("grace"); g != "" {
+		var err error
+		if grace, err = time.ParseDuration(g); err != nil || grace < 0 {
+			http.Error(w, "invalid grace duration", http.StatusBadRequest)
+			return
+		}
+	}
+	info, err := s.DrainSession(vendedID, query.Get("message"), grace)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
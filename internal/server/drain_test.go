@@ -0,0 +1,78 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Draining a Session)
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestDrainSession verifies a draining session shows its banner, refuses new
+// connections, refuses creates once the grace period is over, and is then
+// destroyed after its connections are told
+func TestDrainSession(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {items = {}}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.wsEndpoint.ConnectPolling(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(id int64) *protocol.Response {
+		msg, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: id, ParentID: 1,
+			Properties: map[string]string{"path": "items"}})
+		resp, err := s.wsEndpoint.HandlePolled(conn, msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	info, err := s.DrainSession(vendedID, "Maintenance in 5 minutes", time.Hour)
+	if err != nil || info.DrainUntil.IsZero() {
+		t.Fatalf("drain returned %+v, %v", info, err)
+	}
+	v1 := s.GetLuaSession(vendedID).GetTracker().GetVariable(1)
+	if banner := v1.Properties["banner"]; banner != "Maintenance in 5 minutes" {
+		t.Errorf("banner = %q", banner)
+	}
+	for _, path := range []string{"/" + sess.ID, "/ws/" + sess.ID} {
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != 503 {
+			t.Errorf("GET %s during drain returned %d, want 503", path, w.Code)
+		}
+	}
+	if resp := create(2); resp != nil && resp.Error != "" {
+		t.Errorf("create during the grace period failed: %s", resp.Error)
+	}
+
+	sess.setDrain("Maintenance in 5 minutes", time.Now()) // Grace period over
+	if resp := create(3); resp == nil || !strings.HasPrefix(resp.Error, "DRAINING") {
+		t.Errorf("create after the grace period returned %+v, want a DRAINING error", resp)
+	}
+	s.destroyDrainedSessions()
+	if s.sessions.Get(sess.ID) != nil || s.GetLuaSession(vendedID) != nil {
+		t.Error("drained session was not destroyed")
+	}
+}
@@ -0,0 +1,88 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Echo Suppression)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestFrontendUpdateEcho verifies a frontend update is not sent back to the
+// connection that made it, unless the backend changed the value it sent
+func TestFrontendUpdateEcho(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	send := func(connectionID string, msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage(connectionID, msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s from %s failed: %v %+v", msgType, connectionID, err, resp)
+		}
+	}
+	send("c1", protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name", "access": "rw"}})
+	send("c2", protocol.MsgWatch, protocol.WatchMessage{VarID: 2})
+	luaSession.AfterBatch(vendedID)
+
+	// deliver sends a batch's updates and returns the connections variable 2 went to
+	deliver := func() []string {
+		t.Helper()
+		sender := &mockSender{}
+		s.deliverUpdates(vendedID, sess.GetBackend(), NewOutgoingBatcher(sender), luaSession.AfterBatch(vendedID), true)
+		var sentTo []string
+		for i, msg := range sender.messages {
+			var update protocol.UpdateMessage
+			if json.Unmarshal(msg.Data, &update) == nil && update.VarID == 2 {
+				sentTo = append(sentTo, sender.connIDs[i]+"="+string(update.Value))
+			}
+		}
+		slices.Sort(sentTo)
+		return sentTo
+	}
+
+	// Unchanged by the backend: c1 already shows it, c2 still needs it
+	send("c1", protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Value: json.RawMessage(`"bob"`)})
+	if sentTo := deliver(); !slices.Equal(sentTo, []string{`c2="bob"`}) {
+		t.Errorf("plain update sent to %v, want only c2", sentTo)
+	}
+
+	// Transformed by validation: the echo carries the new value, so it goes to c1 too
+	send("c1", protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Value: json.RawMessage(`"carol"`)})
+	if _, err := luaSession.LoadCode("validate", `app.name = app.name:upper()`); err != nil {
+		t.Fatal(err)
+	}
+	if sentTo := deliver(); !slices.Equal(sentTo, []string{`c1="CAROL"`, `c2="CAROL"`}) {
+		t.Errorf("transformed update sent to %v, want c1 and c2", sentTo)
+	}
+
+	// Backend changes in later batches are not attributed to the old update
+	if _, err := luaSession.LoadCode("backend", `app.name = "bob"`); err != nil {
+		t.Fatal(err)
+	}
+	if sentTo := deliver(); len(sentTo) != 2 {
+		t.Errorf("backend update sent to %v, want c1 and c2", sentTo)
+	}
+}
@@ -0,0 +1,126 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md
+package server
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// FlagsHook returns per-session flag overrides (e.g. from authentication).
+// It is called once when a session is created.
+type FlagsHook func(vendedID string, sess *Session) map[string]any
+
+// Flag precedence, lowest to highest:
+//   site flags.json < config [flags.defaults] < FlagsHook < ?flag.NAME query (dev only) < setFlags message
+
+// mergeFlags merges flag layers; later layers win and nil values remove a flag.
+func mergeFlags(layers ...map[string]any) map[string]any {
+	result := make(map[string]any)
+	for _, layer := range layers {
+		for k, v := range layer {
+			if v == nil {
+				delete(result, k)
+			} else {
+				result[k] = v
+			}
+		}
+	}
+	return result
+}
+
+// loadFlagDefaults reads the site's flags.json and applies config defaults on top.
+func loadFlagDefaults(cfg *config.Config) map[string]any {
+	var data []byte
+	var err error
+	if cfg.Server.Dir != "" {
+		data, err = os.ReadFile(filepath.Join(cfg.Server.Dir, "flags.json"))
+	} else if bundled, _ := bundle.IsBundled(); bundled {
+		data, err = bundle.ReadFile("flags.json")
+	}
+
+	var site map[string]any
+	if err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &site); err != nil {
+			cfg.Log(0, "Warning: invalid flags.json: %v", err)
+		}
+	}
+	return mergeFlags(site, cfg.Flags.Defaults)
+}
+
+// parseQueryFlags extracts flag.NAME=value query parameters.
+// Values that parse as JSON (true, 3, "x") keep their type; others are strings.
+func parseQueryFlags(query url.Values) map[string]any {
+	var flags map[string]any
+	for key, values := range query {
+		name, ok := strings.CutPrefix(key, "flag.")
+		if !ok || name == "" || len(values) == 0 {
+			continue
+		}
+		if flags == nil {
+			flags = make(map[string]any)
+		}
+		var v any
+		if err := json.Unmarshal([]byte(values[0]), &v); err != nil {
+			v = values[0]
+		}
+		flags[name] = v
+	}
+	return flags
+}
+
+// SetFlagsHook sets the hook that supplies per-session flag overrides at session creation.
+func (s *Server) SetFlagsHook(hook FlagsHook) {
+	s.flagsHook = hook
+}
+
+// initialFlags computes the flags for a new session.
+func (s *Server) initialFlags(vendedID string, sess *Session) map[string]any {
+	var hooked map[string]any
+	if s.flagsHook != nil {
+		hooked = s.flagsHook(vendedID, sess)
+	}
+	return mergeFlags(s.flagDefaults, hooked)
+}
+
+// SetSessionFlags merges flag changes into a live session (all sessions if vendedID is empty).
+// A nil value removes the flag. Changes reach the frontend via variable 1's flags property.
+func (s *Server) SetSessionFlags(vendedID string, flags map[string]any) error {
+	targets := []string{vendedID}
+	if vendedID == "" {
+		targets = s.GetSessionIDs()
+	}
+	for _, id := range targets {
+		luaSession := s.GetLuaSession(id)
+		if luaSession == nil {
+			continue
+		}
+		_, err := s.ExecuteInSession(id, func() (interface{}, error) {
+			luaSession.SetFlags(mergeFlags(luaSession.Flags(), flags))
+			return nil, nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyQueryFlags applies ?flag.NAME=value overrides to a session (dev only).
+func (s *Server) applyQueryFlags(internalID string, query url.Values) {
+	flags := parseQueryFlags(query)
+	if len(flags) == 0 {
+		return
+	}
+	if vendedID := s.sessions.GetVendedID(internalID); vendedID != "" {
+		if err := s.SetSessionFlags(vendedID, flags); err != nil {
+			s.Log(1, "Failed to apply query flags to session %s: %v", vendedID, err)
+		}
+	}
+}
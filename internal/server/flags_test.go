@@ -0,0 +1,90 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md
+package server
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestFlagPrecedence verifies later layers win and nil removes a flag
+func TestFlagPrecedence(t *testing.T) {
+	site := map[string]any{"a": "site", "b": "site", "c": "site", "d": "site"}
+	cfgDefaults := map[string]any{"b": "config", "c": "config", "d": "config"}
+	hook := map[string]any{"c": "hook", "d": "hook"}
+	query := map[string]any{"d": "query"}
+	runtime := map[string]any{"a": nil}
+
+	got := mergeFlags(mergeFlags(site, cfgDefaults, hook, query), runtime)
+
+	tests := []struct {
+		name string
+		want any
+	}{
+		{"b", "config"},
+		{"c", "hook"},
+		{"d", "query"},
+	}
+	for _, tt := range tests {
+		if got[tt.name] != tt.want {
+			t.Errorf("flag %s = %v, want %v", tt.name, got[tt.name], tt.want)
+		}
+	}
+	if _, ok := got["a"]; ok {
+		t.Error("flag a should be removed by nil override")
+	}
+}
+
+// TestLoadFlagDefaultsConfigOverridesSite verifies config defaults win over flags.json
+func TestLoadFlagDefaultsConfigOverridesSite(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "flags.json"), []byte(`{"beta":false,"theme":"light"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Flags.Defaults = map[string]any{"beta": true}
+
+	flags := loadFlagDefaults(cfg)
+	if flags["beta"] != true {
+		t.Errorf("beta = %v, want true (config overrides site)", flags["beta"])
+	}
+	if flags["theme"] != "light" {
+		t.Errorf("theme = %v, want light", flags["theme"])
+	}
+}
+
+// TestInitialFlagsHookOverridesDefaults verifies the hook layer sits above defaults
+func TestInitialFlagsHookOverridesDefaults(t *testing.T) {
+	s := &Server{flagDefaults: map[string]any{"beta": false, "theme": "light"}}
+	s.SetFlagsHook(func(vendedID string, sess *Session) map[string]any {
+		return map[string]any{"beta": true}
+	})
+
+	flags := s.initialFlags("1", nil)
+	if flags["beta"] != true || flags["theme"] != "light" {
+		t.Errorf("initialFlags = %v", flags)
+	}
+}
+
+// TestParseQueryFlags verifies flag.NAME parameters and JSON value typing
+func TestParseQueryFlags(t *testing.T) {
+	q, _ := url.ParseQuery("flag.beta=true&flag.limit=3&flag.name=bob&other=1")
+	flags := parseQueryFlags(q)
+	if flags["beta"] != true {
+		t.Errorf("beta = %#v, want true", flags["beta"])
+	}
+	if flags["limit"] != float64(3) {
+		t.Errorf("limit = %#v, want 3", flags["limit"])
+	}
+	if flags["name"] != "bob" {
+		t.Errorf("name = %#v, want bob", flags["name"])
+	}
+	if _, ok := flags["other"]; ok {
+		t.Error("non-flag parameter should be ignored")
+	}
+}
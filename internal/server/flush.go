@@ -0,0 +1,160 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// executorBarrier tracks the tasks queued on one session executor so a flush can
+// wait for everything queued before it. Tasks may start out of order (Svc sends
+// from a goroutine), so each gets a ticket and waiters watch the oldest one.
+type executorBarrier struct {
+	mu          sync.Mutex
+	issued      int64
+	outstanding map[int64]struct{}
+	waiters     []barrierWaiter
+}
+
+type barrierWaiter struct {
+	ticket int64 // released once no ticket at or below this is outstanding
+	done   chan struct{}
+}
+
+func newExecutorBarrier() *executorBarrier {
+	return &executorBarrier{outstanding: make(map[int64]struct{})}
+}
+
+// start records a queued task and returns its ticket.
+func (b *executorBarrier) start() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.issued++
+	b.outstanding[b.issued] = struct{}{}
+	return b.issued
+}
+
+// finish marks a task complete and releases the waiters it was holding up.
+func (b *executorBarrier) finish(ticket int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.outstanding, ticket)
+	b.release(false)
+}
+
+// wait returns a channel closed once every task queued so far has finished.
+func (b *executorBarrier) wait() <-chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	w := barrierWaiter{ticket: b.issued, done: make(chan struct{})}
+	b.waiters = append(b.waiters, w)
+	b.release(false)
+	return w.done
+}
+
+// close releases all waiters; used when the executor shuts down.
+func (b *executorBarrier) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.release(true)
+}
+
+func (b *executorBarrier) release(all bool) {
+	oldest := int64(math.MaxInt64)
+	for t := range b.outstanding {
+		oldest = min(oldest, t)
+	}
+	kept := b.waiters[:0]
+	for _, w := range b.waiters {
+		if all || w.ticket < oldest {
+			close(w.done)
+		} else {
+			kept = append(kept, w)
+		}
+	}
+	b.waiters = kept
+}
+
+// write sends one frame, after any the batch window holds, and counts it in
+// the connection's sequence.
+func (wc *wsConn) write(data []byte) error {
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+	wc.drainLocked()
+	return wc.writeLocked(data)
+}
+
+// writeLocked is write for a caller holding writeMu. Messages too small to
+// gain from deflate are sent uncompressed.
+func (wc *wsConn) writeLocked(data []byte) error {
+	wc.seq++
+	if c := wc.compression; c != nil {
+		wc.conn.EnableWriteCompression(len(data) >= wsCompressMinSize)
+		c.messages.Add(1)
+		c.payloadBytes.Add(int64(len(data)))
+	}
+	return wc.conn.WriteMessage(websocket.TextMessage, data)
+}
+
+// settle waits until the work queued on a session's executor has run, including
+// its AfterBatch and any asynchronous deliveries, then hands the resulting
+// updates to the session's connections.
+func (ws *WebSocketEndpoint) settle(sessionID string) {
+	ws.mu.RLock()
+	barrier := ws.barriers[sessionID]
+	ws.mu.RUnlock()
+	if barrier != nil {
+		<-barrier.wait()
+	}
+	sess := ws.getSession(sessionID)
+	if sess == nil {
+		return
+	}
+	<-sess.deliveriesDone()
+	if batcher := sess.GetBatcher(); batcher != nil {
+		batcher.FlushNow()
+	}
+}
+
+// flush answers a connection's flush message once its session has settled.
+// Must not run on the session executor, which it waits for.
+func (ws *WebSocketEndpoint) flush(connectionID, sessionID string) {
+	ws.settle(sessionID)
+
+	ws.mu.RLock()
+	wc, ok := ws.connections[connectionID]
+	ws.mu.RUnlock()
+	if !ok {
+		return
+	}
+	if wc.poll != nil {
+		// Polling clients send /api/flush, which answers once settled
+		return
+	}
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+	wc.drainLocked()
+	data, err := json.Marshal(protocol.Response{Result: protocol.FlushResponse{Seq: wc.seq}})
+	if err != nil {
+		return
+	}
+	ws.Log(2, "[OUT] FLUSHED: to=%s seq=%d", connectionID, wc.seq)
+	wc.writeLocked(data)
+}
+
+// FlushSession settles a session for a backend's flush message.
+// Implements protocol.Flusher.
+func (s *Server) FlushSession(vendedID string) error {
+	internalID := s.sessions.GetInternalID(vendedID)
+	if internalID == "" {
+		return fmt.Errorf("session %s not found", vendedID)
+	}
+	s.wsEndpoint.settle(internalID)
+	return nil
+}
@@ -0,0 +1,125 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+func released(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func TestExecutorBarrier(t *testing.T) {
+	b := newExecutorBarrier()
+	first := b.start()
+	second := b.start()
+	wait := b.wait()
+	later := b.start()
+
+	b.finish(second)
+	if released(wait) {
+		t.Fatal("released while an earlier task is outstanding")
+	}
+	b.finish(first)
+	if !released(wait) {
+		t.Fatal("not released after earlier tasks finished")
+	}
+	if released(b.wait()) {
+		t.Fatal("a new wait must cover the later task")
+	}
+	b.finish(later)
+
+	idle := b.wait()
+	if !released(idle) {
+		t.Error("wait on an idle executor should release at once")
+	}
+}
+
+// TestWebSocketFlush verifies a flush waits for earlier executor work and reports
+// the frame sequence the resulting updates were written at
+func TestWebSocketFlush(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sessions := NewSessionManager(time.Hour)
+	sess, _, _ := sessions.CreateSession()
+	ws := NewWebSocketEndpoint(cfg, sessions, protocol.NewHandler(cfg, nil))
+	batcher := NewOutgoingBatcher(ws)
+	batcher.debounceInterval = time.Hour // only the flush sends
+	sess.SetBatcher(batcher)
+	update, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1, Value: json.RawMessage(`1`)})
+	ws.SetAfterBatch(func(sessionID string, userEvent bool) {
+		batcher.Queue(update, sess.GetConnections())
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.HandleWebSocket(w, r, sess.ID)
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	frames := make(chan []byte, 10)
+	go func() {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				close(frames)
+				return
+			}
+			frames <- data
+		}
+	}()
+
+	gate := make(chan struct{})
+	ws.ExecuteInSessionAsync(sess.ID, func() (interface{}, error) {
+		<-gate
+		return nil, nil
+	})
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"flush"}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-frames:
+		t.Fatalf("frame %s arrived before queued work finished", data)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(gate)
+	count := 0
+	for {
+		select {
+		case data, ok := <-frames:
+			if !ok {
+				t.Fatal("connection closed before flush response")
+			}
+			var resp struct {
+				Result *protocol.FlushResponse `json:"result"`
+			}
+			if json.Unmarshal(data, &resp) == nil && resp.Result != nil {
+				if count == 0 || resp.Result.Seq != int64(count) {
+					t.Errorf("flush seq = %d after %d update frames", resp.Result.Seq, count)
+				}
+				return
+			}
+			count++
+		case <-time.After(2 * time.Second):
+			t.Fatal("no flush response")
+		}
+	}
+}
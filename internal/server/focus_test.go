@@ -0,0 +1,115 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Focus and Shortcuts)
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+)
+
+// focusSession starts a server whose app has a form with a save method, and
+// returns a function that runs Lua in the session and the batch's variable 1
+// properties.
+func focusSession(t *testing.T) (*Server, string, func(code string) (map[string]string, error)) {
+	t.Helper()
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Form = {}
+		Form.__index = Form
+		function Form:save() end
+		app = {name = "", form = setmetatable({email = ""}, Form)}
+		function app:refresh() end
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	_, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	run := func(code string) (map[string]string, error) {
+		var props map[string]string
+		_, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			if _, err := luaSession.LoadCodeDirect("test", code); err != nil {
+				return nil, err
+			}
+			for _, u := range luaSession.AfterBatch(vendedID) {
+				if u.VarID == 1 {
+					props = u.Properties
+				}
+			}
+			return nil, nil
+		})
+		return props, err
+	}
+	run("")
+	return s, vendedID, run
+}
+
+// TestSessionFocus verifies session:focus sends variable 1's focus once per
+// call, including the same path twice in a row
+func TestSessionFocus(t *testing.T) {
+	_, _, run := focusSession(t)
+	for i := range 2 {
+		props, err := run(`session:focus("form.email")`)
+		if err != nil || props[lua.FocusProperty] != "form.email" {
+			t.Fatalf("focus %d sent %v, %v", i, props, err)
+		}
+		if props, _ := run(""); props[lua.FocusProperty] != "" {
+			t.Fatalf("focus %d sent again: %v", i, props)
+		}
+	}
+	if _, err := run(`session:focus("form..email")`); err == nil {
+		t.Error("invalid focus path was accepted")
+	}
+}
+
+// TestSessionShortcuts verifies session:shortcut publishes its actions on
+// variable 1, rejects targets without the method, bad combos and frontend
+// writes, and removes a shortcut given no target
+func TestSessionShortcuts(t *testing.T) {
+	s, vendedID, run := focusSession(t)
+	props, err := run(`
+		session:shortcut("Ctrl-S", "form", "save")
+		session:shortcut("f5", app, "refresh")
+	`)
+	want := `{"ctrl-s":{"var":1,"path":"form.save()"},"f5":{"var":1,"path":"refresh()"}}`
+	if err != nil || props[lua.ShortcutsProperty] != want {
+		t.Fatalf("shortcuts = %q, %v, want %q", props[lua.ShortcutsProperty], err, want)
+	}
+
+	for _, code := range []string{
+		`session:shortcut("ctrl-d", "form", "delete")`,  // no such method
+		`session:shortcut("ctrl-e", "form", "email")`,   // not a function
+		`session:shortcut("ctrl-n", "missing", "save")`, // no such object
+		`session:shortcut("ctrl-x", {}, "save")`,        // not a variable
+		`session:shortcut("ctrl", "form", "save")`,      // no key
+		`session:shortcut("hyper-s", "form", "save")`,   // unknown modifier
+	} {
+		if _, err := run(code); err == nil || !strings.Contains(err.Error(), "shortcut:") {
+			t.Errorf("%s: err = %v, want rejection", code, err)
+		}
+	}
+
+	luaSession := s.GetLuaSession(vendedID)
+	if _, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return nil, luaSession.HandleFrontendUpdate(vendedID, "", 1, nil, map[string]string{"shortcuts": `{"ctrl-q":{"var":1,"path":"quit()"}}`}, nil)
+	}); err == nil {
+		t.Error("frontend set variable 1's shortcuts")
+	}
+
+	props, err = run(`session:shortcut("ctrl-s", nil)`)
+	if want := `{"f5":{"var":1,"path":"refresh()"}}`; err != nil || props[lua.ShortcutsProperty] != want {
+		t.Errorf("after removal shortcuts = %q, %v, want %q", props[lua.ShortcutsProperty], err, want)
+	}
+}
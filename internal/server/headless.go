@@ -0,0 +1,98 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Headless Sessions)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// HeadlessSession is a session driven from Go with no frontend, for
+// automation and CI. It has a polling connection that never expires and
+// watches variable 1, so the updates a browser would get are queued for
+// Poll. Change detection runs after each Run and Send as it would for a
+// browser's messages.
+type HeadlessSession struct {
+	server     *Server
+	ID         string // Internal session ID
+	VendedID   string
+	Connection string
+}
+
+// CreateHeadlessSession creates a session, runs main.lua in it like any
+// other, and connects it to a synthetic polling connection.
+func (s *Server) CreateHeadlessSession() (*HeadlessSession, error) {
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.wsEndpoint.connectPolling(sess.ID, 0)
+	if err != nil {
+		s.sessions.DestroySession(sess.ID)
+		return nil, err
+	}
+	h := &HeadlessSession{server: s, ID: sess.ID, VendedID: vendedID, Connection: conn}
+	watch, _ := protocol.NewMessage(protocol.MsgWatch, protocol.WatchMessage{VarID: 1})
+	if _, err := h.Send(watch); err != nil {
+		h.Close()
+		return nil, err
+	}
+	return h, nil
+}
+
+// Run executes Lua code in the session, like the MCP run tool, and returns
+// its result.
+func (h *HeadlessSession) Run(name, code string) (any, error) {
+	luaSession := h.server.GetLuaSession(h.VendedID)
+	if luaSession == nil {
+		return nil, fmt.Errorf("Lua session %s not found", h.VendedID)
+	}
+	return h.server.ExecuteInSession(h.VendedID, func() (interface{}, error) {
+		return luaSession.LoadCodeDirect(name, code)
+	})
+}
+
+// Send handles a protocol message from the session's connection, as if a
+// frontend had sent it, and returns the response.
+func (h *HeadlessSession) Send(msg *protocol.Message) (*protocol.Response, error) {
+	resp, err := h.server.wsEndpoint.HandlePolled(h.Connection, msg)
+	if err == nil && resp != nil && resp.Error != "" {
+		err = fmt.Errorf("%s: %s", msg.Type, resp.Error)
+	}
+	return resp, err
+}
+
+// Flush waits until the session's queued work has run and its updates are
+// queued for Poll.
+func (h *HeadlessSession) Flush() error {
+	return h.server.FlushSession(h.VendedID)
+}
+
+// Poll returns and removes the messages queued for the connection.
+func (h *HeadlessSession) Poll() []*protocol.Message {
+	return h.server.pendingQueues.GetQueue(h.Connection).Drain()
+}
+
+// State returns the app object's data in the session hibernation format.
+func (h *HeadlessSession) State() (json.RawMessage, error) {
+	luaSession := h.server.GetLuaSession(h.VendedID)
+	if luaSession == nil {
+		return nil, fmt.Errorf("Lua session %s not found", h.VendedID)
+	}
+	state, err := h.server.ExecuteInSession(h.VendedID, func() (interface{}, error) {
+		return luaSession.Snapshot()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state.(json.RawMessage), nil
+}
+
+// Close disconnects and destroys the session.
+func (h *HeadlessSession) Close() {
+	h.server.wsEndpoint.onDisconnect(h.Connection)
+	h.server.pendingQueues.RemoveQueue(h.Connection)
+	h.server.sessions.DestroySession(h.ID)
+}
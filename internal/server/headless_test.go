@@ -0,0 +1,72 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Headless Sessions)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestHeadlessSession verifies a headless session runs main.lua, queues the
+// updates a frontend would get for its connection, and exports its state
+func TestHeadlessSession(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {count = 0, title = "new"}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	h, err := s.CreateHeadlessSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := h.Poll(); len(msgs) == 0 || msgs[0].Type != protocol.MsgUpdate {
+		t.Fatalf("initial messages = %v, want variable 1's update", msgs)
+	}
+
+	// Like a frontend binding, a child variable carries the field's updates
+	create, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "count"}})
+	if _, err := h.Send(create); err != nil {
+		t.Fatal(err)
+	}
+	h.Flush()
+	h.Poll()
+	if _, err := h.Run("step", `app.count = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	msgs := h.Poll()
+	if len(msgs) != 1 || !strings.Contains(string(msgs[0].Data), `"value":3`) {
+		t.Errorf("messages after run = %v, want an update with count 3", msgs)
+	}
+	state, err := h.State()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var app map[string]any
+	if err := json.Unmarshal(state, &app); err != nil || app["count"] != float64(3) || app["title"] != "new" {
+		t.Errorf("state = %s, %v", state, err)
+	}
+
+	h.Close()
+	if s.sessions.Get(h.ID) != nil {
+		t.Error("session still exists after Close")
+	}
+}
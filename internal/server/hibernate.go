@@ -0,0 +1,297 @@
+// CRC: crc-SessionManager.md
+// Spec: protocol.md (Session Hibernation)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// sessionResetCode is the error code a rehydrated session's first connection
+// gets when the session's state could not be restored and it started fresh.
+const sessionResetCode = "session-reset"
+
+// SessionHibernateCallback saves an idle session's state before it is torn
+// down and returns the file it wrote.
+type SessionHibernateCallback func(vendedID string, session *Session) (string, error)
+
+// SessionRehydrateCallback restores a file written by SessionHibernateCallback
+// into the session recreated for it (main.lua has already run).
+type SessionRehydrateCallback func(vendedID string, session *Session, path string) error
+
+// hibernation keeps a stub for each hibernated session.
+type hibernation struct {
+	retention time.Duration // Stubs and files are dropped after this (0 = never)
+	save      SessionHibernateCallback
+	restore   SessionRehydrateCallback
+	stubs     map[string]hibernatedStub // internal session ID -> stub
+}
+
+// hibernatedStub is all a hibernated session keeps in memory.
+type hibernatedStub struct {
+	group string
+	path  string
+	at    time.Time
+}
+
+// hibernatedFile is the saved state of a hibernated session.
+type hibernatedFile struct {
+	Time  time.Time       `json:"time"`
+	Group string          `json:"group,omitempty"`
+	App   json.RawMessage `json:"app"` // LuaSession.Snapshot of the app object
+}
+
+// SetHibernation makes CleanupInactiveSessions hibernate idle sessions instead
+// of destroying them.
+func (m *SessionManager) SetHibernation(retention time.Duration, save SessionHibernateCallback, restore SessionRehydrateCallback) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hibernation = &hibernation{
+		retention: retention,
+		save:      save,
+		restore:   restore,
+		stubs:     make(map[string]hibernatedStub),
+	}
+}
+
+// HibernateSession saves a session's state, tears the session down, and keeps
+// a stub so RehydrateSession can bring it back. A session that cannot be saved
+// is destroyed.
+func (m *SessionManager) HibernateSession(id string) error {
+	session := m.Get(id)
+	if session == nil || m.hibernation == nil {
+		return nil
+	}
+	path, err := m.hibernation.save(m.GetVendedID(id), session)
+	m.DestroySession(id)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.hibernation.stubs[id] = hibernatedStub{group: session.group, path: path, at: m.now()}
+	m.mu.Unlock()
+	return nil
+}
+
+// IsHibernated reports whether id is a hibernated session.
+func (m *SessionManager) IsHibernated(id string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.hibernation == nil {
+		return false
+	}
+	_, ok := m.hibernation.stubs[id]
+	return ok
+}
+
+// RehydrateSession recreates a hibernated session under its old ID, runs
+// main.lua, and restores the saved state. If the state cannot be restored the
+// session starts fresh and its first connection gets a session-reset notice.
+func (m *SessionManager) RehydrateSession(id string, req *SessionRequest) (*Session, string, error) {
+	m.mu.Lock()
+	if m.closed {
+		// Keep the saved state for the next server
+		m.mu.Unlock()
+		return nil, "", errSessionsClosed
+	}
+	var stub hibernatedStub
+	var ok bool
+	if m.hibernation != nil {
+		stub, ok = m.hibernation.stubs[id]
+		delete(m.hibernation.stubs, id)
+	}
+	m.mu.Unlock()
+	if !ok {
+		if session := m.Get(id); session != nil {
+			return session, m.GetVendedID(id), nil // Rehydrated by a concurrent request
+		}
+		return nil, "", fmt.Errorf("session %s is not hibernated", id)
+	}
+	defer os.Remove(stub.path)
+
+	session, vendedID, err := m.createSession(id, req, stub.group)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := m.hibernation.restore(vendedID, session, stub.path); err != nil {
+		m.DestroySession(id)
+		if session, vendedID, err = m.createSession(id, req, stub.group); err != nil {
+			return nil, "", err
+		}
+		session.setNotice(sessionResetCode)
+	}
+	return session, vendedID, nil
+}
+
+// expireHibernated drops hibernated sessions older than the retention period.
+func (m *SessionManager) expireHibernated() {
+	m.mu.Lock()
+	if m.hibernation == nil || m.hibernation.retention == 0 {
+		m.mu.Unlock()
+		return
+	}
+	cutoff := m.now().Add(-m.hibernation.retention)
+	var expired []string
+	for id, stub := range m.hibernation.stubs {
+		if stub.at.Before(cutoff) {
+			expired = append(expired, stub.path)
+			delete(m.hibernation.stubs, id)
+		}
+	}
+	m.mu.Unlock()
+	for _, path := range expired {
+		os.Remove(path)
+	}
+}
+
+// loadHibernated registers stubs for sessions hibernated by an earlier run.
+func (m *SessionManager) loadHibernated(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || !entry.Type().IsRegular() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		var file hibernatedFile
+		if err != nil || json.Unmarshal(data, &file) != nil {
+			continue
+		}
+		m.mu.Lock()
+		m.hibernation.stubs[id] = hibernatedStub{group: file.Group, path: path, at: m.loadedTime(file.Time)}
+		m.mu.Unlock()
+	}
+}
+
+// loadedTime converts a saved wall clock time to one on the current clock,
+// so later comparisons use the monotonic clock. A time in the future (the
+// wall clock was set back since it was saved) counts as now.
+func (m *SessionManager) loadedTime(saved time.Time) time.Time {
+	now := m.now()
+	return now.Add(-max(now.Sub(saved), 0))
+}
+
+// setNotice queues an error code for the session's next connection.
+func (s *Session) setNotice(code string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notice = code
+}
+
+// takeNotice returns and clears the queued notice, if any.
+func (s *Session) takeNotice() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	code := s.notice
+	s.notice = ""
+	return code
+}
+
+// setupHibernation makes idle sessions hibernate to the configured directory.
+func (s *Server) setupHibernation() {
+	cfg := s.config.Session
+	s.sessions.SetHibernation(cfg.HibernateRetention.Duration(), s.hibernateSession, s.rehydrateSession)
+	s.sessions.loadHibernated(cfg.HibernateDir)
+}
+
+// hibernateSession writes a session's app state to the hibernation directory.
+// Implements SessionHibernateCallback.
+func (s *Server) hibernateSession(vendedID string, sess *Session) (string, error) {
+	luaSession := s.GetLuaSession(vendedID)
+	if luaSession == nil {
+		return "", fmt.Errorf("Lua session %s not found", vendedID)
+	}
+	app, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return luaSession.Snapshot()
+	})
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(hibernatedFile{Time: time.Now().UTC(), Group: sess.group, App: app.(json.RawMessage)})
+	if err != nil {
+		return "", err
+	}
+	dir := s.config.Session.HibernateDir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, sess.ID+".json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return "", err
+	}
+	s.count("sessions.hibernated")
+	s.Log(1, "Hibernated session %s to %s", vendedID, path)
+	return path, nil
+}
+
+// rehydrateSession applies a hibernated session's saved state to its new Lua session.
+// Implements SessionRehydrateCallback.
+func (s *Server) rehydrateSession(vendedID string, sess *Session, path string) error {
+	err := s.restoreHibernated(vendedID, path)
+	if err != nil {
+		s.count("sessions.rehydrateFailed")
+		s.Log(0, "Session %s could not be rehydrated, starting fresh: %v", vendedID, err)
+		return err
+	}
+	s.count("sessions.rehydrated")
+	return nil
+}
+
+func (s *Server) restoreHibernated(vendedID, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var file hibernatedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	if luaSession == nil {
+		return fmt.Errorf("Lua session %s not found", vendedID)
+	}
+	_, err = s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return nil, luaSession.Restore(file.App)
+	})
+	return err
+}
+
+// count adds one to a named counter when metrics are enabled.
+func (s *Server) count(name string) {
+	if metrics := s.handler.Metrics(); metrics != nil {
+		metrics.AddCount(name, 1)
+	}
+}
+
+// sessionResetMessage tells a client its session started fresh.
+func sessionResetMessage() *protocol.Message {
+	msg, _ := protocol.NewMessage(protocol.MsgError, protocol.ErrorMessage{
+		VarID:       1,
+		Code:        sessionResetCode,
+		Description: "your session expired and could not be restored",
+	})
+	return msg
+}
+
+// hibernationEnabled reports whether idle sessions hibernate, warning about unknown idle actions.
+func hibernationEnabled(cfg *config.Config) bool {
+	switch cfg.Session.IdleAction {
+	case config.IdleHibernate:
+		return true
+	case config.IdleDestroy, "":
+		return false
+	}
+	cfg.Log(0, "Warning: unknown session idle_action %q, destroying idle sessions", cfg.Session.IdleAction)
+	return false
+}
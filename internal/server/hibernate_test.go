@@ -0,0 +1,140 @@
+// CRC: crc-SessionManager.md
+// Spec: protocol.md (Session Hibernation)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestHibernateAndRehydrate verifies a hibernated session comes back under its
+// old ID with its app state and prototypes, and that a session whose file is
+// corrupt starts fresh with a session-reset notice
+func TestHibernateAndRehydrate(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Item = session:prototype("Item", {n = 0})
+		app = {count = 0, title = "new", items = {}}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Server.Metrics = true
+	cfg.Session.IdleAction = config.IdleHibernate
+	cfg.Session.HibernateDir = t.TempDir()
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLuaSession(vendedID).LoadCode("mutate", `
+		app.count = 5
+		app.title = nil
+		app.items = {session:create(Item, {n = 2})}
+	`); err != nil {
+		t.Fatal(err)
+	}
+	id := sess.ID
+	path := filepath.Join(cfg.Session.HibernateDir, id+".json")
+
+	if err := s.sessions.HibernateSession(id); err != nil {
+		t.Fatal(err)
+	}
+	if !s.sessions.IsHibernated(id) || s.sessions.Get(id) != nil {
+		t.Fatalf("session was not hibernated")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("hibernation file: %v", err)
+	}
+
+	sess, vendedID, err = s.sessions.RehydrateSession(id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sess.ID != id || s.sessions.IsHibernated(id) {
+		t.Fatalf("rehydrated session ID = %s, want %s", sess.ID, id)
+	}
+	if _, err := s.GetLuaSession(vendedID).LoadCode("check", `
+		assert(app.count == 5, "count")
+		assert(app.title == nil, "title")
+		assert(getmetatable(app.items[1]) == Item, "prototype")
+		assert(app.items[1].n == 2, "item")
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("hibernation file was not removed")
+	}
+	if code := sess.takeNotice(); code != "" {
+		t.Errorf("notice = %q after a good restore", code)
+	}
+
+	// A corrupt file gives a fresh session that is told so
+	if err := s.sessions.HibernateSession(id); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(path, []byte("{"), 0600)
+	sess, vendedID, err = s.sessions.RehydrateSession(id, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetLuaSession(vendedID).LoadCode("fresh", `
+		assert(app.count == 0 and app.title == "new", "not fresh")
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if code := sess.takeNotice(); code != sessionResetCode {
+		t.Errorf("notice = %q, want %q", code, sessionResetCode)
+	}
+
+	counters := s.handler.Metrics().Snapshot().Counters
+	for name, want := range map[string]int64{
+		"sessions.hibernated":      2,
+		"sessions.rehydrated":      1,
+		"sessions.rehydrateFailed": 1,
+	} {
+		if counters[name] != want {
+			t.Errorf("%s = %d, want %d", name, counters[name], want)
+		}
+	}
+}
+
+// TestHibernatedClockJump verifies saved hibernation times from a wall clock
+// that has since been set back count as now, so their stubs still expire after
+// the retention period
+func TestHibernatedClockJump(t *testing.T) {
+	dir := t.TempDir()
+	saved := map[string]time.Time{
+		"ahead": time.Now().Add(24 * time.Hour), // clock set back since
+		"old":   time.Now().Add(-2 * time.Hour),
+	}
+	for id, at := range saved {
+		data, _ := json.Marshal(hibernatedFile{Time: at.UTC(), App: json.RawMessage(`{}`)})
+		os.WriteFile(filepath.Join(dir, id+".json"), data, 0644)
+	}
+	m := NewSessionManager(time.Hour)
+	m.SetHibernation(time.Hour, nil, nil)
+	m.loadHibernated(dir)
+	if at := m.hibernation.stubs["ahead"].at; at.After(time.Now()) {
+		t.Fatalf("future save time loaded as %v", at)
+	}
+
+	m.expireHibernated()
+	if !m.IsHibernated("ahead") || m.IsHibernated("old") {
+		t.Fatalf("after load: ahead %v, old %v; want only ahead kept", m.IsHibernated("ahead"), m.IsHibernated("old"))
+	}
+	m.now = func() time.Time { return time.Now().Add(time.Hour + time.Minute) }
+	m.expireHibernated()
+	if m.IsHibernated("ahead") {
+		t.Error("stub saved under a later wall clock never expires")
+	}
+}
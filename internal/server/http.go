@@ -3,14 +3,21 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"maps"
 	"mime"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	changetracker "github.com/zot/change-tracker"
 	"github.com/zot/ui-engine/internal/lua"
@@ -21,11 +28,21 @@ import (
 // Returns variables, tracker change count, and error.
 type DebugDataProvider func(sessionID string, diagLevel int) ([]DebugVariable, int64, error)
 
+// ObjectGraphProvider builds a session's object graph, highlighting the objects
+// reachable from the focus variable if it is nonzero.
+type ObjectGraphProvider func(sessionID string, focus int64) (*ObjectGraph, error)
+
 // RootSessionProvider returns the session ID to use for the root path "/".
 // If it returns an empty string, the default behavior (create new session and redirect) is used.
 // If it returns a session ID, index.html is served with a session cookie set.
 type RootSessionProvider func() string
 
+// FlagOverrideHandler applies ?flag.NAME=value query overrides to a session (dev only).
+type FlagOverrideHandler func(sessionID string, query url.Values)
+
+// AuthFunc reports whether an HTTP request may be served.
+type AuthFunc func(r *http.Request) bool
+
 // DebugVariable represents a variable for the debug tree view.
 // CRC: crc-HTTPEndpoint.md (R57, R59, R60, R61)
 type DebugVariable struct {
@@ -50,6 +67,7 @@ type DebugVariable struct {
 	ChangeCount    int64                   `json:"changeCount"`
 	Depth          int                     `json:"depth"`
 	ElementId      string                  `json:"elementId"`
+	Routes         []string                `json:"routes,omitempty"` // URL paths registered to this variable
 }
 
 // HTTPEndpoint handles HTTP requests.
@@ -58,10 +76,21 @@ type HTTPEndpoint struct {
 	handler             *protocol.Handler
 	wsEndpoint          *WebSocketEndpoint
 	staticDir           string
-	embeddedSite        fs.FS
+	embeddedSite        atomic.Pointer[fs.FS] // Swapped whole by ReloadBundle; nil if none
 	mux                 *http.ServeMux
 	debugDataProvider   DebugDataProvider
+	objectGraphProvider ObjectGraphProvider
 	rootSessionProvider RootSessionProvider
+	flagOverrideHandler FlagOverrideHandler
+	retryAdvisor        protocol.RetryAdvisor      // nil disables draining responses
+	prefsObserver       PrefsObserver              // nil if preferences are not persisted
+	sanitizeValue       func(string) string        // Snapshot value redaction/truncation (nil = none)
+	metricsCounters     func() map[string]int64    // Extra /metrics counters (nil if none)
+	metricsGauges       func() []protocol.Gauge    // Gauges for the text format of /metrics (nil if none)
+	csp                 string                     // Content-Security-Policy ("" = off)
+	staticCache         string                     // Cache-Control for static files other than index.html ("" = none)
+	assets              atomic.Pointer[siteAssets] // nil when no asset directories are configured
+	auth                AuthFunc                   // Requests it rejects get 401 (nil = all served)
 }
 
 // NewHTTPEndpoint creates a new HTTP endpoint.
@@ -81,9 +110,22 @@ func (h *HTTPEndpoint) SetStaticDir(dir string) {
 	h.staticDir = dir
 }
 
-// SetEmbeddedSite sets the embedded site filesystem.
+// SetEmbeddedSite sets the embedded site filesystem. Requests already
+// serving keep the one they started with.
 func (h *HTTPEndpoint) SetEmbeddedSite(site fs.FS) {
-	h.embeddedSite = site
+	if site == nil {
+		h.embeddedSite.Store(nil)
+		return
+	}
+	h.embeddedSite.Store(&site)
+}
+
+// site returns the embedded site filesystem, or nil.
+func (h *HTTPEndpoint) site() fs.FS {
+	if site := h.embeddedSite.Load(); site != nil {
+		return *site
+	}
+	return nil
 }
 
 // SetDebugDataProvider sets the callback for getting debug variable data.
@@ -91,12 +133,37 @@ func (h *HTTPEndpoint) SetDebugDataProvider(provider DebugDataProvider) {
 	h.debugDataProvider = provider
 }
 
+// SetObjectGraphProvider sets the callback for /{session-id}/objects.json.
+func (h *HTTPEndpoint) SetObjectGraphProvider(provider ObjectGraphProvider) {
+	h.objectGraphProvider = provider
+}
+
 // SetRootSessionProvider sets a provider for the root path "/" session.
 // If the provider returns a session ID, that session is used instead of creating a new one.
 func (h *HTTPEndpoint) SetRootSessionProvider(provider RootSessionProvider) {
 	h.rootSessionProvider = provider
 }
 
+// SetFlagOverrideHandler enables query-parameter flag overrides.
+func (h *HTTPEndpoint) SetFlagOverrideHandler(handler FlagOverrideHandler) {
+	h.flagOverrideHandler = handler
+}
+
+// SetRetryAdvisor enables 503 + Retry-After responses while the server is draining.
+func (h *HTTPEndpoint) SetRetryAdvisor(advisor protocol.RetryAdvisor) {
+	h.retryAdvisor = advisor
+}
+
+// SetMetricsCounters sets a source of counters added to the /metrics response.
+func (h *HTTPEndpoint) SetMetricsCounters(counters func() map[string]int64) {
+	h.metricsCounters = counters
+}
+
+// SetMetricsGauges sets a source of gauges added to the text format of /metrics.
+func (h *HTTPEndpoint) SetMetricsGauges(gauges func() []protocol.Gauge) {
+	h.metricsGauges = gauges
+}
+
 // HandleFunc registers a custom handler on the HTTP mux.
 func (h *HTTPEndpoint) HandleFunc(pattern string, handler http.HandlerFunc) {
 	h.mux.HandleFunc(pattern, handler)
@@ -107,11 +174,22 @@ func (h *HTTPEndpoint) setupRoutes() {
 	h.mux.HandleFunc("/", h.handleRoot)
 	h.mux.HandleFunc("/api/", h.handleAPI)
 	h.mux.HandleFunc("/ws/", h.handleWebSocket)
+	h.mux.HandleFunc("/metrics", h.handleMetrics)
+	h.mux.HandleFunc("/_bundle/", h.handleBundle)
 	// Note: /SESSION-ID/variables is handled in handleRoot
 }
 
+// SetAuthFunc sets the check every request must pass (nil = none).
+func (h *HTTPEndpoint) SetAuthFunc(auth AuthFunc) {
+	h.auth = auth
+}
+
 // ServeHTTP implements http.Handler.
 func (h *HTTPEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil && !h.auth(r) {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
 	h.mux.ServeHTTP(w, r)
 }
 
@@ -126,16 +204,33 @@ func (h *HTTPEndpoint) handleRoot(w http.ResponseWriter, r *http.Request) {
 			if sessionID := h.rootSessionProvider(); sessionID != "" {
 				// Serve index.html with session cookie (no redirect)
 				h.setSessionCookie(w, sessionID)
-				h.serveStatic(w, r, "index.html")
+				h.serveIndex(w, r, sessionID)
 				return
 			}
 		}
 		// Default: create new session and redirect
-		sess, _, err := h.sessions.CreateSession()
+		if h.draining() {
+			h.writeUnavailable(w)
+			return
+		}
+		req := newSessionRequest(r)
+		sess, _, err := h.sessions.CreateSessionForRequest(req)
 		if err != nil {
+			var denied *SessionDeniedError
+			if errors.As(err, &denied) {
+				http.Error(w, denied.Message, denied.Status)
+				return
+			}
 			http.Error(w, "Failed to create session", http.StatusInternalServerError)
 			return
 		}
+		h.applyFlagOverrides(sess.ID, r)
+		if req.Redirect != "" {
+			// The page at the hook's target finds its session through the cookie
+			h.setSessionCookie(w, sess.ID)
+			http.Redirect(w, r, req.Redirect, http.StatusTemporaryRedirect)
+			return
+		}
 		// Use internal session ID for URL path (user-facing)
 		http.Redirect(w, r, "/"+sess.ID, http.StatusTemporaryRedirect)
 		return
@@ -146,22 +241,36 @@ func (h *HTTPEndpoint) handleRoot(w http.ResponseWriter, r *http.Request) {
 	sessionID := parts[0]
 
 	// Check if this is a valid session
-	if h.sessions.SessionExists(sessionID) {
+	if h.liveSession(sessionID, r) {
 		// Set session cookie for this session
 		h.setSessionCookie(w, sessionID)
+		h.applyFlagOverrides(sessionID, r)
 		// CRC: crc-HTTPEndpoint.md (R57, R58)
 		if len(parts) > 1 {
 			switch parts[1] {
-			case "variables":
-				h.ServeVariableBrowser(w, r)
+			case "variables", "variables.html":
+				h.ServeVariableBrowser(w, r, sessionID)
+				return
+			case "variables/prefs":
+				h.HandleVariablePrefs(w, r, sessionID)
 				return
 			case "variables.json":
 				h.HandleVariablesJSON(w, r, sessionID)
 				return
+			case "objects.json":
+				h.HandleObjectsJSON(w, r, sessionID)
+				return
+			case "connect":
+				h.handleConnect(w, r, sessionID)
+				return
 			}
 		}
 		// Serve the SPA - it will handle the routing client-side
-		h.serveStatic(w, r, "index.html")
+		if h.sessionDraining(sessionID) {
+			http.Error(w, "Session draining", http.StatusServiceUnavailable)
+			return
+		}
+		h.serveIndex(w, r, sessionID)
 		return
 	}
 
@@ -169,6 +278,13 @@ func (h *HTTPEndpoint) handleRoot(w http.ResponseWriter, r *http.Request) {
 	h.serveStatic(w, r, strings.TrimPrefix(path, "/"))
 }
 
+// applyFlagOverrides passes flag.NAME query parameters to the override handler, if enabled.
+func (h *HTTPEndpoint) applyFlagOverrides(sessionID string, r *http.Request) {
+	if h.flagOverrideHandler != nil && r.URL.RawQuery != "" {
+		h.flagOverrideHandler(sessionID, r.URL.Query())
+	}
+}
+
 // setSessionCookie sets the ui-session cookie.
 func (h *HTTPEndpoint) setSessionCookie(w http.ResponseWriter, sessionID string) {
 	http.SetCookie(w, &http.Cookie{
@@ -191,21 +307,43 @@ func (h *HTTPEndpoint) serveStatic(w http.ResponseWriter, r *http.Request, path
 		w.Header().Set("Content-Type", ct)
 	}
 
-	// Try custom directory first
+	// Try custom directory first; with an embedded site too, only for files it has
+	site := h.site()
 	if h.staticDir != "" {
-		http.ServeFile(w, r, h.staticDir+"/"+path)
-		return
+		info, err := fs.Stat(os.DirFS(h.staticDir), path)
+		if site == nil || err == nil {
+			if err == nil && !info.IsDir() {
+				h.setCacheHeaders(w, path, info)
+			}
+			http.ServeFile(w, r, h.staticDir+"/"+path)
+			return
+		}
 	}
 
-	// Fall back to embedded site
-	if h.embeddedSite != nil {
-		data, err := fs.ReadFile(h.embeddedSite, path)
+	// Fall back to embedded site, streaming the file rather than reading it into memory
+	if site != nil {
+		file, err := site.Open(path)
 		if err != nil {
 			http.NotFound(w, r)
 			return
 		}
-
-		w.Write(data)
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		h.setCacheHeaders(w, path, info)
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			data, err := io.ReadAll(file)
+			if err != nil {
+				http.NotFound(w, r)
+				return
+			}
+			content = bytes.NewReader(data)
+		}
+		http.ServeContent(w, r, path, info.ModTime(), content)
 		return
 	}
 
@@ -218,14 +356,35 @@ func (h *HTTPEndpoint) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	path := strings.TrimPrefix(r.URL.Path, "/ws/")
 	sessionID := strings.Split(path, "/")[0]
 
-	if !h.sessions.SessionExists(sessionID) {
+	if !h.liveSession(sessionID, r) {
 		http.Error(w, "Session not found", http.StatusNotFound)
 		return
 	}
+	if h.draining() {
+		h.writeUnavailable(w)
+		return
+	}
+	if h.sessionDraining(sessionID) {
+		http.Error(w, "Session draining", http.StatusServiceUnavailable)
+		return
+	}
 
 	h.wsEndpoint.HandleWebSocket(w, r, sessionID)
 }
 
+// liveSession reports whether sessionID names a session, rehydrating it first
+// if it is hibernated.
+func (h *HTTPEndpoint) liveSession(sessionID string, r *http.Request) bool {
+	if h.sessions.SessionExists(sessionID) {
+		return true
+	}
+	if sessionID == "" || !h.sessions.IsHibernated(sessionID) || h.draining() {
+		return false
+	}
+	_, _, err := h.sessions.RehydrateSession(sessionID, newSessionRequest(r))
+	return err == nil
+}
+
 // handleAPI handles REST API requests.
 func (h *HTTPEndpoint) handleAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -238,6 +397,19 @@ func (h *HTTPEndpoint) handleAPI(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Polls still drain pending messages; the handler returns them early with a hint
+	if endpoint != string(protocol.MsgPoll) && h.draining() {
+		h.writeUnavailable(w)
+		return
+	}
+
+	// Polling connections send WebSocket frames to /api/batch
+	connectionID := r.URL.Query().Get("conn")
+	if endpoint == "batch" && connectionID != "" {
+		h.handlePolledBatch(w, r, connectionID)
+		return
+	}
+
 	var msg protocol.Message
 	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
 		h.writeError(w, "Invalid JSON", http.StatusBadRequest)
@@ -247,18 +419,134 @@ func (h *HTTPEndpoint) handleAPI(w http.ResponseWriter, r *http.Request) {
 	// Override type from URL path
 	msg.Type = protocol.MessageType(endpoint)
 
-	// Use a synthetic connection ID for API calls
-	connectionID := "api-" + r.RemoteAddr
-
-	resp, err := h.handler.HandleMessage(connectionID, &msg)
+	var resp *protocol.Response
+	var err error
+	if connectionID != "" {
+		resp, err = h.wsEndpoint.HandlePolled(connectionID, &msg)
+	} else {
+		// Use a synthetic connection ID for API calls
+		resp, err = h.handler.HandleMessage("api-"+r.RemoteAddr, &msg)
+	}
+	if errors.Is(err, errUnknownConnection) {
+		h.writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, errReloading) {
+		w.Header().Set("Retry-After", "1")
+		h.writeError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 	if err != nil {
 		h.writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if resp != nil && resp.RetryAfterMs > 0 {
+		w.Header().Set("Retry-After", retryAfterSeconds(resp.RetryAfterMs))
+	}
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handlePolledBatch processes a frame from a polling connection and answers
+// with the responses it produced.
+func (h *HTTPEndpoint) handlePolledBatch(w http.ResponseWriter, r *http.Request, connectionID string) {
+	frame, err := io.ReadAll(r.Body)
+	if err != nil {
+		h.writeError(w, "Invalid body", http.StatusBadRequest)
+		return
+	}
+	responses, err := h.wsEndpoint.HandlePolledBatch(connectionID, frame)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if responses == nil {
+		responses = []*protocol.Response{}
+	}
+	json.NewEncoder(w).Encode(responses)
+}
+
+// handleConnect opens a polling connection for clients that cannot use a WebSocket.
+func (h *HTTPEndpoint) handleConnect(w http.ResponseWriter, r *http.Request, sessionID string) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		h.writeError(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.draining() {
+		h.writeUnavailable(w)
+		return
+	}
+	if h.sessionDraining(sessionID) {
+		h.writeError(w, "session draining", http.StatusServiceUnavailable)
+		return
+	}
+	connectionID, err := h.wsEndpoint.ConnectPolling(sessionID)
+	if err != nil {
+		h.writeError(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	json.NewEncoder(w).Encode(protocol.Response{Result: protocol.ConnectResponse{Connection: connectionID}})
+}
+
+// draining reports whether the server is shutting down.
+func (h *HTTPEndpoint) draining() bool {
+	return h.retryAdvisor != nil && h.retryAdvisor.Draining()
+}
+
+// sessionDraining reports whether a session is draining, so new connections
+// to it are refused.
+func (h *HTTPEndpoint) sessionDraining(sessionID string) bool {
+	sess := h.sessions.Get(sessionID)
+	return sess != nil && sess.Draining()
+}
+
+// writeUnavailable writes a 503 with a Retry-After header and a JSON retry hint.
+func (h *HTTPEndpoint) writeUnavailable(w http.ResponseWriter) {
+	ms := h.retryAdvisor.RetryAfter().Milliseconds()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", retryAfterSeconds(ms))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(protocol.Response{Error: "server draining", RetryAfterMs: ms})
+}
+
+// retryAfterSeconds formats a millisecond hint as a Retry-After value (whole seconds, rounded up).
+func retryAfterSeconds(ms int64) string {
+	return strconv.FormatInt((ms+999)/1000, 10)
+}
+
+// handleMetrics serves the protocol handler metrics as JSON, or in the
+// Prometheus text format with ?format=prometheus or an Accept of text/plain.
+// Returns 404 when metrics are disabled.
+func (h *HTTPEndpoint) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.handler == nil || h.handler.Metrics() == nil {
+		http.Error(w, "Metrics disabled (start with --metrics)", http.StatusNotFound)
+		return
+	}
+	var counters map[string]int64
+	if h.metricsCounters != nil {
+		counters = h.metricsCounters()
+	}
+	if r.URL.Query().Get("format") == "prometheus" || strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		var gauges []protocol.Gauge
+		if h.metricsGauges != nil {
+			gauges = h.metricsGauges()
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		h.handler.Metrics().WritePrometheus(w, counters, gauges)
+		return
+	}
+	snap := h.handler.Metrics().Snapshot()
+	if counters != nil {
+		if snap.Counters == nil {
+			snap.Counters = make(map[string]int64)
+		}
+		maps.Copy(snap.Counters, counters)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snap)
+}
+
 // writeError writes an error response.
 func (h *HTTPEndpoint) writeError(w http.ResponseWriter, message string, status int) {
 	w.WriteHeader(status)
@@ -270,11 +558,22 @@ func (h *HTTPEndpoint) HandleProtocolCommand(msg *protocol.Message) (*protocol.R
 	return h.handler.HandleMessage("cli", msg)
 }
 
-// ServeVariableBrowser serves the embedded variable browser HTML page.
+// ServeVariableBrowser serves the embedded variable browser HTML page
+// with the session's saved preferences embedded. ?snapshot=1 serves a
+// read-only page with the current variables inlined.
 // CRC: crc-HTTPEndpoint.md (R58)
-func (h *HTTPEndpoint) ServeVariableBrowser(w http.ResponseWriter, r *http.Request) {
+func (h *HTTPEndpoint) ServeVariableBrowser(w http.ResponseWriter, r *http.Request, sessionID string) {
+	var snapshot []byte
+	if r.URL.Query().Get("snapshot") == "1" {
+		var err error
+		if snapshot, err = h.variableSnapshot(sessionID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="variables-%s.html"`, h.sessions.GetVendedID(sessionID)))
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.Write([]byte(variableBrowserHTML))
+	w.Write(renderVariableBrowser(h.sessions.Get(sessionID), snapshot))
 }
 
 // HandleVariablesJSON returns variable data as JSON.
@@ -288,17 +587,12 @@ func (h *HTTPEndpoint) HandleVariablesJSON(w http.ResponseWriter, r *http.Reques
 
 	w.Header().Set("Content-Type", "application/json")
 
-	if h.debugDataProvider == nil {
-		json.NewEncoder(w).Encode([]DebugVariable{})
-		return
-	}
-
 	diagLevel := 0
 	if d := r.URL.Query().Get("diag"); d != "" {
 		fmt.Sscanf(d, "%d", &diagLevel)
 	}
 
-	variables, changeCount, err := h.debugDataProvider(vendedID, diagLevel)
+	variables, changeCount, err := h.debugVariables(sessionID, vendedID, diagLevel)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
@@ -307,3 +601,49 @@ func (h *HTTPEndpoint) HandleVariablesJSON(w http.ResponseWriter, r *http.Reques
 	w.Header().Set("X-Change-Count", strconv.FormatInt(changeCount, 10))
 	json.NewEncoder(w).Encode(variables)
 }
+
+// debugVariables returns a session's variables with their routes, and the
+// tracker's change count.
+func (h *HTTPEndpoint) debugVariables(sessionID, vendedID string, diagLevel int) ([]DebugVariable, int64, error) {
+	if h.debugDataProvider == nil {
+		return []DebugVariable{}, 0, nil
+	}
+	variables, changeCount, err := h.debugDataProvider(vendedID, diagLevel)
+	if err != nil {
+		return nil, 0, err
+	}
+	routes := make(map[int64][]string)
+	for _, route := range h.sessions.ListURLPaths(sessionID) {
+		routes[route.VariableID] = append(routes[route.VariableID], route.Path)
+	}
+	for i := range variables {
+		variables[i].Routes = routes[variables[i].ID]
+	}
+	return variables, changeCount, nil
+}
+
+// HandleObjectsJSON serves the session's object graph as JSON, or as Graphviz
+// DOT with ?format=dot. ?var=ID highlights that variable's object subgraph.
+func (h *HTTPEndpoint) HandleObjectsJSON(w http.ResponseWriter, r *http.Request, sessionID string) {
+	vendedID := h.sessions.GetVendedID(sessionID)
+	if vendedID == "" || h.objectGraphProvider == nil {
+		http.NotFound(w, r)
+		return
+	}
+	focus, _ := strconv.ParseInt(r.URL.Query().Get("var"), 10, 64)
+	graph, err := h.objectGraphProvider(vendedID, focus)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if graph.Truncated {
+		w.Header().Set("Warning", "199 - "+strconv.Quote(graph.Warning))
+	}
+	if r.URL.Query().Get("format") == "dot" {
+		w.Header().Set("Content-Type", "text/vnd.graphviz")
+		graph.WriteDOT(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(graph)
+}
@@ -11,6 +11,8 @@ import (
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/zot/ui-engine/internal/config"
 )
 
 // TestHTTPRedirectToSession verifies GET / creates session and redirects
@@ -352,3 +354,42 @@ func (fi *mockFileInfo) Mode() fs.FileMode  { return 0644 }
 func (fi *mockFileInfo) ModTime() time.Time { return time.Now() }
 func (fi *mockFileInfo) IsDir() bool        { return false }
 func (fi *mockFileInfo) Sys() interface{}   { return nil }
+
+// TestVariableSnapshot verifies ?snapshot=1 inlines sanitized variables and
+// header details in a page that does not fetch them
+func TestVariableSnapshot(t *testing.T) {
+	sessions := NewSessionManager(time.Hour)
+	endpoint := NewHTTPEndpoint(sessions, nil, nil)
+	endpoint.SetDebugDataProvider(func(vendedID string, diagLevel int) ([]DebugVariable, int64, error) {
+		return []DebugVariable{
+			{ID: 1, Type: "App", Value: map[string]string{"name": "Test", "password": "hunter2"}},
+			{ID: 2, ParentID: 1, Path: "notes", Value: strings.Repeat("x", 100) + "</script>"},
+		}, 7, nil
+	})
+	cfg := config.DefaultConfig()
+	cfg.Logging.Redact = []string{"password"}
+	cfg.Logging.MaxValueLength = 50
+	endpoint.SetValueSanitizer(cfg.Sanitize)
+	sess, vendedID, _ := sessions.CreateSession()
+
+	get := func(url string) string {
+		w := httptest.NewRecorder()
+		endpoint.ServeHTTP(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d", url, w.Code)
+		}
+		return w.Body.String()
+	}
+	if live := get("/" + sess.ID + "/variables"); !strings.Contains(live, "const SNAPSHOT = null;") {
+		t.Error("live page has a snapshot")
+	}
+	page := get("/" + sess.ID + "/variables.html?snapshot=1")
+	for _, want := range []string{`"label":"session ` + vendedID + `"`, `"changeCount":7`, `"version":`, `"name":"Test"`, config.RedactedMarker, " bytes)"} {
+		if !strings.Contains(page, want) {
+			t.Errorf("snapshot page is missing %s", want)
+		}
+	}
+	if strings.Contains(page, "hunter2") || strings.Contains(page, "x</script>") {
+		t.Error("snapshot page has an unredacted or untruncated value")
+	}
+}
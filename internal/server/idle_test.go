@@ -0,0 +1,118 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Idle Sessions)
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// detectionCounter counts change detection runs (AfterBatch telemetry) and the changes they found
+type detectionCounter struct {
+	protocol.NopTelemetry
+	mu      sync.Mutex
+	runs    int
+	changes int
+}
+
+func (c *detectionCounter) OnAfterBatch(_ string, changes int, _ time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.runs++
+	c.changes += changes
+}
+
+// take returns the counts so far and resets them
+func (c *detectionCounter) take() (runs, changes int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	runs, changes = c.runs, c.changes
+	c.runs, c.changes = 0, 0
+	return runs, changes
+}
+
+// TestIdleSessionsSkipDetection verifies quiet sessions skip change detection on
+// heartbeat batches, and that work after a long idle period still propagates
+func TestIdleSessionsSkipDetection(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {count = 1}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+	counter := &detectionCounter{}
+	s.SetTelemetry(counter)
+
+	const sessionCount, heartbeats = 20, 60 // a minute of one batch per second
+	ids := make(map[string]string)          // vended -> internal
+	for range sessionCount {
+		sess, vendedID, err := s.sessions.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[vendedID] = sess.ID
+		s.AfterBatch(sess.ID, false)
+	}
+	if runs, _ := counter.take(); runs != sessionCount {
+		t.Fatalf("initial batches ran detection %d times, want %d", runs, sessionCount)
+	}
+
+	// Session 1's page shows app.count
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{s.sessions.Get(ids["1"]).GetBackend()})
+	h.SetPathVariableHandler(s)
+	h.SetChangeNotifier(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if _, err := h.HandleMessage("c1", msg); err != nil {
+			t.Fatalf("%s failed: %v", msgType, err)
+		}
+	}
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "count"}})
+	s.AfterBatch(ids["1"], false)
+	counter.take()
+
+	for range heartbeats {
+		for _, internalID := range ids {
+			s.AfterBatch(internalID, false)
+		}
+	}
+	if runs, _ := counter.take(); runs != 0 {
+		t.Errorf("%d idle heartbeat batches ran detection %d times, want 0", sessionCount*heartbeats, runs)
+	}
+
+	// Lua work after the idle minute is detected on the next batch
+	vendedID := "1"
+	if _, err := s.GetLuaSession(vendedID).LoadCode("backend", `app.count = 2`); err != nil {
+		t.Fatal(err)
+	}
+	s.AfterBatch(ids[vendedID], false)
+	if runs, changes := counter.take(); runs != 1 || changes == 0 {
+		t.Errorf("after Lua work: %d runs with %d changes, want 1 run with changes", runs, changes)
+	}
+
+	// Read-only messages leave the session idle; a watch does not
+	for _, msgType := range []protocol.MessageType{protocol.MsgPoll, protocol.MsgWatch} {
+		send(msgType, protocol.WatchMessage{VarID: 2})
+		s.AfterBatch(ids[vendedID], false)
+		want := 0
+		if msgType == protocol.MsgWatch {
+			want = 1
+		}
+		if runs, _ := counter.take(); runs != want {
+			t.Errorf("after %s: %d detection runs, want %d", msgType, runs, want)
+		}
+	}
+}
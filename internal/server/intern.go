@@ -0,0 +1,183 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"sync"
+
+	gopher "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+)
+
+// internThreshold is the size above which string values are pooled per session.
+var internThreshold = 32 << 10
+
+// internPool keeps one copy of each large string value in a session. Variables whose
+// Value JSON is a large string point at the pooled copy, and the encoded JSON is
+// kept with it so sending the value again does not re-marshal it.
+type internPool struct {
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]*internEntry
+	vars    map[int64][sha256.Size]byte // variable -> entry it references
+}
+
+type internEntry struct {
+	value   string
+	encoded json.RawMessage // nil until first sent
+	refs    int
+}
+
+// InternStats reports a session's pool usage.
+type InternStats struct {
+	Values     int // distinct pooled values
+	Refs       int // variables referencing pooled values
+	Bytes      int // bytes held by the pool
+	SavedBytes int // bytes the extra references would otherwise hold
+}
+
+func newInternPool() *internPool {
+	return &internPool{
+		entries: make(map[[sha256.Size]byte]*internEntry),
+		vars:    make(map[int64][sha256.Size]byte),
+	}
+}
+
+// intern points a changed variable at the pooled copy of its value, moving its
+// reference from whatever it held before.
+func (p *internPool) intern(v *changetracker.Variable) {
+	str, ok := v.ValueJSON.(string)
+	if !ok || len(str) < internThreshold {
+		p.release(v.ID)
+		return
+	}
+	sum := sha256.Sum256([]byte(str))
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry := p.entries[sum]
+	if old, held := p.vars[v.ID]; !held || old != sum {
+		if held {
+			p.unref(old)
+		}
+		if entry == nil {
+			entry = &internEntry{value: str}
+			p.entries[sum] = entry
+		}
+		entry.refs++
+		p.vars[v.ID] = sum
+	}
+	v.ValueJSON = entry.value
+	switch v.Value.(type) {
+	case string:
+		v.Value = entry.value
+	case gopher.LString:
+		v.Value = gopher.LString(entry.value)
+	}
+}
+
+// release drops a variable's reference, freeing the entry when it was the last.
+func (p *internPool) release(varID int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if sum, ok := p.vars[varID]; ok {
+		delete(p.vars, varID)
+		p.unref(sum)
+	}
+}
+
+func (p *internPool) unref(sum [sha256.Size]byte) {
+	if entry := p.entries[sum]; entry != nil {
+		entry.refs--
+		if entry.refs <= 0 {
+			delete(p.entries, sum)
+		}
+	}
+}
+
+// sweep releases variables the tracker no longer has, catching destroys that
+// do not go through the adapter (frontend destroys, descendants).
+func (p *internPool) sweep(tracker *changetracker.Tracker) {
+	p.mu.Lock()
+	var gone []int64
+	for id := range p.vars {
+		if tracker.GetVariable(id) == nil {
+			gone = append(gone, id)
+		}
+	}
+	p.mu.Unlock()
+	for _, id := range gone {
+		p.release(id)
+	}
+}
+
+// encoded returns the JSON encoding of a variable's pooled value, encoding it
+// the first time any variable sharing it is sent.
+func (p *internPool) encoded(varID int64) (json.RawMessage, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	sum, ok := p.vars[varID]
+	if !ok {
+		return nil, false
+	}
+	entry := p.entries[sum]
+	if entry.encoded == nil {
+		data, err := json.Marshal(entry.value)
+		if err != nil {
+			return nil, false
+		}
+		entry.encoded = data
+	}
+	return entry.encoded, true
+}
+
+func (p *internPool) stats() InternStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var st InternStats
+	for _, entry := range p.entries {
+		st.Values++
+		st.Refs += entry.refs
+		st.Bytes += len(entry.value) + len(entry.encoded)
+		st.SavedBytes += (entry.refs - 1) * len(entry.value)
+	}
+	return st
+}
+
+// pool returns a session's intern pool, creating it if needed.
+func (a *luaTrackerAdapter) pool(sessionID string) *internPool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.pools == nil {
+		a.pools = make(map[string]*internPool)
+	}
+	p := a.pools[sessionID]
+	if p == nil {
+		p = newInternPool()
+		a.pools[sessionID] = p
+	}
+	return p
+}
+
+// EncodedValue returns the cached JSON for a variable whose value is pooled.
+// Implements lua.EncodedValueCache.
+func (a *luaTrackerAdapter) EncodedValue(sessionID string, varID int64) (json.RawMessage, bool) {
+	a.mu.RLock()
+	p := a.pools[sessionID]
+	a.mu.RUnlock()
+	if p == nil {
+		return nil, false
+	}
+	return p.encoded(varID)
+}
+
+// InternStats returns the intern pool usage of a session.
+func (a *luaTrackerAdapter) InternStats(sessionID string) InternStats {
+	a.mu.RLock()
+	p := a.pools[sessionID]
+	a.mu.RUnlock()
+	if p == nil {
+		return InternStats{}
+	}
+	return p.stats()
+}
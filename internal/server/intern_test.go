@@ -0,0 +1,83 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unsafe"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestInternSharedLargeValue builds N variables holding separate copies of one
+// big value and checks the pool keeps a single copy
+func TestInternSharedLargeValue(t *testing.T) {
+	const n = 40
+	cfg := config.DefaultConfig()
+	adapter := &luaTrackerAdapter{config: cfg}
+	lb := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	adapter.SetBackend("1", lb)
+	tracker := lb.GetTracker()
+
+	big := strings.Repeat("<div>viewdef</div>", 200<<10/18)
+	var roots, docs []*changetracker.Variable
+	for i := 0; i < n; i++ {
+		root := tracker.CreateVariable(map[string]any{"doc": strings.Clone(big)}, 0, "", nil)
+		doc := tracker.CreateVariable(nil, root.ID, "doc", nil)
+		doc.ValueJSON = nil // as for frontend creates, so the first detection reports it
+		roots, docs = append(roots, root), append(docs, doc)
+	}
+	small := tracker.CreateVariable("small", 0, "", nil)
+	small.ValueJSON = nil
+
+	adapter.DetectChanges("1")
+	adapter.GetChanges("1")
+
+	st := adapter.InternStats("1")
+	if st.Values != 1 || st.Refs != n {
+		t.Fatalf("stats = %+v, want 1 value with %d refs", st, n)
+	}
+	if st.SavedBytes != (n-1)*len(big) {
+		t.Errorf("saved %d bytes, want %d", st.SavedBytes, (n-1)*len(big))
+	}
+	shared := unsafe.StringData(docs[0].ValueJSON.(string))
+	for _, doc := range docs {
+		if unsafe.StringData(doc.ValueJSON.(string)) != shared || unsafe.StringData(doc.Value.(string)) != shared {
+			t.Fatalf("variable %d does not reference the pooled copy", doc.ID)
+		}
+	}
+
+	// Sending reuses one encoding
+	want, _ := json.Marshal(big)
+	first, ok := adapter.EncodedValue("1", docs[0].ID)
+	if !ok || string(first) != string(want) {
+		t.Fatal("no cached encoding for a pooled value")
+	}
+	if again, _ := adapter.EncodedValue("1", docs[n-1].ID); unsafe.SliceData(again) != unsafe.SliceData(first) {
+		t.Error("encoding was not shared between variables")
+	}
+	if _, ok := adapter.EncodedValue("1", small.ID); ok {
+		t.Error("small value should not be pooled")
+	}
+
+	// A changed value moves its reference to a new entry
+	roots[0].Value.(map[string]any)["doc"] = big + "!"
+	adapter.DetectChanges("1")
+	adapter.GetChanges("1")
+	if st := adapter.InternStats("1"); st.Values != 2 || st.Refs != n {
+		t.Errorf("after change stats = %+v, want 2 values with %d refs", st, n)
+	}
+
+	// Destroying variables releases their references
+	for _, root := range roots {
+		lb.DestroyVariable(root.ID)
+	}
+	adapter.GetChanges("1")
+	if st := adapter.InternStats("1"); st != (InternStats{}) {
+		t.Errorf("after destroy stats = %+v, want empty", st)
+	}
+}
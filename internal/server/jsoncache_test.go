@@ -0,0 +1,86 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// jsonCacheAdapter returns an adapter with one session holding n root
+// variables, each a small array.
+func jsonCacheAdapter(n int) (*luaTrackerAdapter, []*changetracker.Variable) {
+	cfg := config.DefaultConfig()
+	adapter := &luaTrackerAdapter{config: cfg}
+	lb := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	adapter.SetBackend("1", lb)
+	vars := make([]*changetracker.Variable, n)
+	for i := range vars {
+		value := []any{fmt.Sprintf("item %d", i), float64(i), "a", "b"}
+		vars[i] = lb.GetTracker().CreateVariable(value, 0, "", nil)
+		adapter.varToSession[vars[i].ID] = "1"
+	}
+	return adapter, vars
+}
+
+// TestJSONCache verifies Get reuses a variable's encoding until a change is
+// detected, and drops it when the variable is destroyed
+func TestJSONCache(t *testing.T) {
+	adapter, vars := jsonCacheAdapter(2)
+	v := vars[0]
+	first, _, ok := adapter.Get(v.ID)
+	if !ok || string(first) != `["item 0",0,"a","b"]` {
+		t.Fatalf("Get = %s, %v", first, ok)
+	}
+	if _, hit := adapter.jsonCache[v.ID]; !hit {
+		t.Fatal("encoding was not cached")
+	}
+
+	v.Value = []any{"renamed"}
+	adapter.DetectChanges("1")
+	adapter.GetChanges("1")
+	if got, _, _ := adapter.Get(v.ID); string(got) != `["renamed"]` {
+		t.Errorf("after change Get = %s", got)
+	}
+	adapter.Get(vars[1].ID)
+
+	adapter.Destroy(v.ID)
+	if _, hit := adapter.jsonCache[v.ID]; hit {
+		t.Error("destroyed variable's encoding still cached")
+	}
+	adapter.DestroySession("1")
+	if len(adapter.jsonCache) != 0 {
+		t.Errorf("cache after session end = %v", adapter.jsonCache)
+	}
+}
+
+// BenchmarkGetValues reads 1000 variables per batch with 5 changing each
+// batch, with and without the encoded value cache
+func BenchmarkGetValues(b *testing.B) {
+	for _, cached := range []bool{true, false} {
+		b.Run(fmt.Sprintf("cached=%v", cached), func(b *testing.B) {
+			adapter, vars := jsonCacheAdapter(1000)
+			b.ReportAllocs()
+			batch := 0
+			for b.Loop() {
+				for i := range 5 {
+					v := vars[(batch*5+i)%len(vars)]
+					v.Value = []any{"item", float64(batch), "a", "b"}
+				}
+				batch++
+				adapter.DetectChanges("1")
+				adapter.GetChanges("1")
+				if !cached {
+					clear(adapter.jsonCache)
+				}
+				for _, v := range vars {
+					adapter.Get(v.ID)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Configuration Options)
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestRepeatedGetterErrorLog verifies a getter that throws on every batch is
+// logged once per window, then summarized, while its diags always hold the error
+func TestRepeatedGetterErrorLog(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {n = 0}
+		function app:boom() self.n = self.n + 1; error("kaboom") end
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Logging.ErrorWindow = config.Duration(100 * time.Millisecond)
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	msg, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "boom()"}})
+	h.HandleMessage("c1", msg)
+
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+	cfg.Logging.Verbosity = 1
+	batches := func(n int) {
+		for range n {
+			luaSession.AfterBatch(vendedID)
+			if diags := luaSession.GetTracker().GetVariable(2).Diags; len(diags) == 0 || !strings.Contains(diags[0], "kaboom") {
+				t.Fatalf("diags = %q, want the error", diags)
+			}
+		}
+	}
+
+	batches(20)
+	if n := strings.Count(logged.String(), "kaboom"); n > 1 {
+		t.Errorf("error logged %d times within the window, want at most once", n)
+	}
+	time.Sleep(120 * time.Millisecond)
+	batches(1)
+	if !strings.Contains(logged.String(), "last error ×") {
+		t.Errorf("no summary after the window:\n%s", logged.String())
+	}
+	cfg.Logging.Verbosity = 0
+}
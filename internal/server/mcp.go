@@ -0,0 +1,53 @@
+// CRC: crc-Server.md
+// Spec: deployment.md
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// RunMCPTool is the enforcement point for MCP tool handlers: it refuses the call if
+// capability is not granted, otherwise runs fn, and records the invocation in the
+// audit log either way. Read-only tools pass an empty capability.
+func (s *Server) RunMCPTool(tool string, capability config.MCPCapability, args json.RawMessage, fn func() (any, error)) (any, error) {
+	bundled, _ := bundle.IsBundled()
+	if err := s.config.CheckMCP(capability, bundled); err != nil {
+		s.auditMCP(tool, args, err)
+		return nil, err
+	}
+	result, err := fn()
+	s.auditMCP(tool, args, err)
+	return result, err
+}
+
+// RunMCPSessionTool is RunMCPTool for a tool that works on one session: fn runs
+// there as an external write, serialized with frontend messages and never
+// interleaved with a hot reload. Like ExecuteInSession, fn runs on the Lua
+// executor and must use direct calls such as LoadCodeDirect.
+func (s *Server) RunMCPSessionTool(tool string, capability config.MCPCapability, args json.RawMessage, vendedID string, fn func() (any, error)) (any, error) {
+	return s.RunMCPTool(tool, capability, args, func() (any, error) {
+		return s.ExecuteClass(vendedID, OpExternalWrite, fn)
+	})
+}
+
+// auditMCP logs an MCP tool invocation with a digest of its arguments, so the trail
+// identifies calls without copying their (possibly sensitive) contents into the log.
+func (s *Server) auditMCP(tool string, args json.RawMessage, err error) {
+	sum := sha256.Sum256(args)
+	digest := hex.EncodeToString(sum[:8])
+	var denied *config.MCPCapabilityError
+	switch {
+	case err == nil:
+		s.Log(0, "MCP audit: %s args=%s ok", tool, digest)
+	case errors.As(err, &denied):
+		s.Log(0, "MCP audit: %s args=%s denied: %v", tool, digest, err)
+	default:
+		s.Log(0, "MCP audit: %s args=%s error: %v", tool, digest, err)
+	}
+}
@@ -0,0 +1,34 @@
+// CRC: crc-Server.md
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestRunMCPToolGates verifies disabled capabilities stop the tool before it runs
+func TestRunMCPToolGates(t *testing.T) {
+	cfg := config.DefaultConfig()
+	off := false
+	cfg.MCP.AllowRun = &off
+	s := &Server{config: cfg}
+	args := json.RawMessage(`{"code":"return 1"}`)
+
+	ran := false
+	_, err := s.RunMCPTool("run", config.MCPRun, args, func() (any, error) {
+		ran = true
+		return nil, nil
+	})
+	var denied *config.MCPCapabilityError
+	if !errors.As(err, &denied) || ran {
+		t.Errorf("disabled run: err %v, ran %v", err, ran)
+	}
+
+	result, err := s.RunMCPTool("state_get", "", args, func() (any, error) { return 42, nil })
+	if err != nil || result != 42 {
+		t.Errorf("read-only tool = %v, %v", result, err)
+	}
+}
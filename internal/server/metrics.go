@@ -0,0 +1,38 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Metrics)
+package server
+
+import (
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// metricsGauges reports server state for the text format of /metrics:
+// sessions, connections by transport, executor queues, pending poll queues
+// and each session's variable count as of its last batch.
+func (s *Server) metricsGauges() []protocol.Gauge {
+	websockets, polling := s.wsEndpoint.ConnectionCounts()
+	gauges := []protocol.Gauge{
+		{Name: "ui_sessions", Help: "Active sessions.", Value: float64(s.sessions.Count())},
+		{Name: "ui_connections", Help: "Open browser connections, by transport.", Labels: map[string]string{"transport": "websocket"}, Value: float64(websockets)},
+		{Name: "ui_connections", Labels: map[string]string{"transport": "polling"}, Value: float64(polling)},
+		{Name: "ui_session_queue_depth", Help: "Tasks waiting for a session executor.", Value: float64(s.wsEndpoint.QueueDepth())},
+		{Name: "ui_pending_messages", Help: "Messages waiting in polling queues.", Value: float64(s.pendingQueues.TotalLen())},
+		{Name: "ui_pending_bytes", Help: "Bytes waiting in polling queues.", Value: float64(s.pendingQueues.QueuedBytes())},
+	}
+	s.luaSessionsMu.RLock()
+	depth := 0
+	for _, luaSession := range s.luaSessions {
+		depth += luaSession.ExecutorQueueDepth()
+	}
+	s.luaSessionsMu.RUnlock()
+	gauges = append(gauges, protocol.Gauge{Name: "ui_lua_executor_queue_depth", Help: "Work items waiting for Lua executors.", Value: float64(depth)})
+	for _, sess := range s.sessions.GetAllSessions() {
+		gauges = append(gauges, protocol.Gauge{
+			Name:   "ui_variables",
+			Help:   "Tracker variables per session, as of its last batch.",
+			Labels: map[string]string{"session": s.sessions.GetVendedID(sess.ID)},
+			Value:  float64(sess.variables.Load()),
+		})
+	}
+	return gauges
+}
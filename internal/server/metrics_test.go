@@ -0,0 +1,63 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Metrics)
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestMetricsPrometheusFormat verifies /metrics serves the server gauges in the
+// text exposition format on request and stays JSON by default
+func TestMetricsPrometheusFormat(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		session:createAppVariable({items = {{name = "a"}, {name = "b"}}})
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Server.Metrics = true
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AfterBatch(sess.ID, false)
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/metrics?format=prometheus", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("content type = %q", ct)
+	}
+	text := w.Body.String()
+	for _, want := range []string{
+		"ui_sessions 1\n",
+		`ui_connections{transport="websocket"} 0`,
+		"ui_pending_messages 0\n",
+		"ui_lua_executor_queue_depth 0\n",
+		"# TYPE ui_after_batch_duration_seconds histogram",
+		`ui_variables{session="` + vendedID + `"} `,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, `ui_variables{session="`+vendedID+`"} 0`) {
+		t.Errorf("variable count not recorded:\n%s", text)
+	}
+
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("default content type = %q", ct)
+	}
+}
@@ -0,0 +1,98 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Backend Updates)
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+const notifyMain = `
+	app = {name = "", greeting = ""}
+	session:createAppVariable(app)
+	session._watchers[2] = {value = {function(name) app.greeting = "hello " .. name end}}
+`
+
+// TestBackendUpdateRunsWatchers sends `ui update` for a Lua variable with a
+// watcher and expects a browser to get the watcher's change with no frontend
+// message to trigger change detection
+func TestBackendUpdateRunsWatchers(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(notifyMain), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.wsEndpoint.HandleWebSocket(w, r, sess.ID)
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	for _, create := range []protocol.CreateMessage{
+		{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name"}},
+		{ID: 3, ParentID: 1, Properties: map[string]string{"path": "greeting"}},
+	} {
+		msg, _ := protocol.NewMessage(protocol.MsgCreate, create)
+		data, _ := json.Marshal(msg)
+		conn.WriteMessage(websocket.TextMessage, data)
+	}
+	flushed := false
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"type":"flush"}`))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for !flushed {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("creates not flushed: %v", err)
+		}
+		flushed = strings.Contains(string(data), `"result":{`)
+	}
+
+	// The backend socket, as ui update --session does
+	client, server := net.Pipe()
+	go s.backendSocket.handleConnection(server)
+	defer client.Close()
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{Session: vendedID, VarID: 2, Value: json.RawMessage(`"Bob"`)})
+	payload, _ := msg.Encode()
+	binary.Write(client, binary.BigEndian, uint32(len(payload)))
+	client.Write(payload)
+	var n uint32
+	binary.Read(client, binary.BigEndian, &n)
+	resp := make([]byte, n)
+	if _, err := io.ReadFull(client, resp); err != nil || strings.Contains(string(resp), `"error"`) {
+		t.Fatalf("update answered %s (%v)", resp, err)
+	}
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("no update for the watcher's change: %v", err)
+		}
+		if strings.Contains(string(data), `"hello Bob"`) {
+			return
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Object Collection)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	gopher "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// ObjectGCStats reports one object collection in a session.
+type ObjectGCStats struct {
+	Session          string        `json:"session"`
+	Time             time.Time     `json:"time"`
+	Duration         time.Duration `json:"duration"`
+	ObjectsBefore    int           `json:"objectsBefore"` // Objects registered in the tracker
+	ObjectsAfter     int           `json:"objectsAfter"`
+	IdentitiesBefore int           `json:"identitiesBefore"` // Lua _objectToId entries
+	IdentitiesAfter  int           `json:"identitiesAfter"`
+	VariablesPruned  int           `json:"variablesPruned"` // Stale variable-to-session entries
+}
+
+// objectHolder is implemented by wrappers whose internals keep objects alive
+// that their JSON may not mention, such as a ViewList's items.
+type objectHolder interface {
+	HeldObjects() []any
+}
+
+// objectDestroyer is a wrapper's destroy hook, called when it is collected.
+type objectDestroyer interface {
+	Destroy() error
+}
+
+// ObjectGC returns the session's most recent object collection, or nil.
+func (s *Session) ObjectGC() *ObjectGCStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.objectGC
+}
+
+func (s *Session) setObjectGC(stats *ObjectGCStats, mark int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objectGC = stats
+	s.objectGCMark = mark
+}
+
+func (s *Session) getObjectGCMark() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.objectGCMark
+}
+
+// CollectObjects removes the session's objects that nothing reachable from
+// its variables refers to: tracker registrations, Lua _objectToId entries,
+// cached Variable wrappers and varToSession entries of destroyed variables.
+// Objects referenced by updates not yet delivered, and objects wrappers hold,
+// count as reachable. It runs on the session executor.
+func (s *Server) CollectObjects(vendedID string) (*ObjectGCStats, error) {
+	luaSession := s.GetLuaSession(vendedID)
+	if luaSession == nil || s.storeAdapter == nil {
+		return nil, fmt.Errorf("session %s not found", vendedID)
+	}
+	internalID := s.sessions.GetInternalID(vendedID)
+	var stats *ObjectGCStats
+	var mark int64
+	_, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		tracker := luaSession.GetTracker()
+		if tracker == nil {
+			return nil, fmt.Errorf("tracker not found")
+		}
+		start := time.Now()
+		pending := s.wsEndpoint.QueuedMessages(internalID)
+		if sess := s.sessions.Get(internalID); sess != nil && sess.GetBatcher() != nil {
+			pending = append(pending, sess.GetBatcher().PendingMessages()...)
+		}
+		reached := markObjects(tracker, pending)
+		stats = &ObjectGCStats{Session: vendedID, Time: start}
+		stats.ObjectsBefore, stats.ObjectsAfter, mark = sweepObjects(tracker, reached)
+		stats.IdentitiesBefore, stats.IdentitiesAfter = luaSession.PruneObjectIDs(func(obj *gopher.LTable, varID int64) bool {
+			return reached[obj] || tracker.GetVariable(varID) != nil
+		})
+		stats.VariablesPruned = s.storeAdapter.pruneVariables(vendedID, tracker)
+		stats.Duration = time.Since(start)
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sess := s.sessions.Get(internalID); sess != nil {
+		sess.setObjectGC(stats, mark)
+	}
+	if metrics := s.handler.Metrics(); metrics != nil {
+		metrics.AddCount("objects.collections", 1)
+		metrics.AddCount("objects.collected", int64(stats.ObjectsBefore-stats.ObjectsAfter))
+		metrics.AddCount("objectIds.pruned", int64(stats.IdentitiesBefore-stats.IdentitiesAfter))
+	}
+	s.Log(1, "Session %s: collected objects %d -> %d, object IDs %d -> %d, %d stale variables in %v", vendedID,
+		stats.ObjectsBefore, stats.ObjectsAfter, stats.IdentitiesBefore, stats.IdentitiesAfter, stats.VariablesPruned, stats.Duration)
+	return stats, nil
+}
+
+// StartObjectCollector checks every session each session.object_gc_interval
+// and collects objects in those that registered session.object_gc_threshold
+// objects since their last collection.
+func (s *Server) StartObjectCollector() {
+	interval := s.config.Session.ObjectGCInterval.Duration()
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		defer s.RecoverCrash("objectgc")
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.collectGrownSessions()
+		}
+	}()
+}
+
+// collectGrownSessions collects objects in sessions past the threshold.
+func (s *Server) collectGrownSessions() {
+	for _, vendedID := range s.GetSessionIDs() {
+		sess := s.sessions.Get(s.sessions.GetInternalID(vendedID))
+		luaSession := s.GetLuaSession(vendedID)
+		if sess == nil || luaSession == nil {
+			continue
+		}
+		var next int64
+		s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			if tracker := luaSession.GetTracker(); tracker != nil {
+				next = nextObjectID(tracker)
+			}
+			return nil, nil
+		})
+		if next-sess.getObjectGCMark() >= s.config.Session.ObjectGCThreshold {
+			if _, err := s.CollectObjects(vendedID); err != nil {
+				s.Log(1, "Session %s: object collection failed: %v", vendedID, err)
+			}
+		}
+	}
+}
+
+// markObjects returns the objects reachable from the tracker's variables and
+// from object references in messages not yet delivered. It follows Lua table
+// keys, values and metatables, and the objects wrappers hold.
+func markObjects(tracker *changetracker.Tracker, pending []*protocol.Message) map[any]bool {
+	reached := make(map[any]bool)
+	var work []any
+	for _, v := range tracker.Variables() {
+		work = append(work, v.Value, v.WrapperValue)
+		for _, id := range append(valueRefs(v.ValueJSON), valueRefs(v.WrapperJSON)...) {
+			work = append(work, tracker.GetObject(id))
+		}
+	}
+	for _, msg := range pending {
+		for _, id := range messageRefs(msg) {
+			work = append(work, tracker.GetObject(id))
+		}
+	}
+	for len(work) > 0 {
+		obj := work[len(work)-1]
+		work = work[:len(work)-1]
+		if obj == nil {
+			continue
+		}
+		rv := reflect.ValueOf(obj)
+		switch rv.Kind() {
+		case reflect.Slice, reflect.Array:
+			for i := range rv.Len() {
+				work = append(work, rv.Index(i).Interface())
+			}
+			continue
+		case reflect.Pointer:
+		default:
+			continue
+		}
+		if reached[obj] {
+			continue
+		}
+		reached[obj] = true
+		switch o := obj.(type) {
+		case *gopher.LTable:
+			o.ForEach(func(k, val gopher.LValue) {
+				work = append(work, k, val)
+			})
+			work = append(work, o.Metatable)
+		case *gopher.LUserData:
+			work = append(work, o.Value)
+		case objectHolder:
+			work = append(work, o.HeldObjects()...)
+		}
+	}
+	return reached
+}
+
+// sweepObjects unregisters the tracker's objects that are not reached, calling
+// wrapper destroy hooks. Objects that cannot be compared, like maps, are kept.
+// Returns the registered objects before and after, and the next object ID.
+func sweepObjects(tracker *changetracker.Tracker, reached map[any]bool) (before, after int, next int64) {
+	next = nextObjectID(tracker)
+	for id := int64(1); id < next; id++ {
+		obj := tracker.GetObject(id)
+		if obj == nil {
+			continue
+		}
+		before++
+		if !reflect.TypeOf(obj).Comparable() || reached[obj] {
+			after++
+			continue
+		}
+		if d, ok := obj.(objectDestroyer); ok {
+			d.Destroy()
+		}
+		tracker.UnregisterObject(obj)
+	}
+	return before, after, next
+}
+
+// nextObjectID returns the ID the tracker will give its next object. The
+// tracker cannot list its registry, so this registers and drops a probe.
+func nextObjectID(tracker *changetracker.Tracker) int64 {
+	probe := new(byte)
+	id, _ := tracker.RegisterObject(probe)
+	tracker.UnregisterObject(probe)
+	return id
+}
+
+// messageRefs returns the object IDs in a message's {"obj": id} references.
+func messageRefs(msg *protocol.Message) []int64 {
+	var data any
+	if json.Unmarshal(msg.Data, &data) != nil {
+		return nil
+	}
+	var ids []int64
+	var walk func(v any)
+	walk = func(v any) {
+		switch v := v.(type) {
+		case map[string]any:
+			if id, ok := v["obj"].(float64); ok && len(v) == 1 {
+				ids = append(ids, int64(id))
+				return
+			}
+			for _, elem := range v {
+				walk(elem)
+			}
+		case []any:
+			for _, elem := range v {
+				walk(elem)
+			}
+		}
+	}
+	walk(data)
+	return ids
+}
+
+// handleObjectGC serves POST /api/debug/gc?session=ID, collecting a session's
+// unreachable objects and responding with the stats.
+func (s *Server) handleObjectGC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	vendedID := r.URL.Query().Get("session")
+	if vendedID == "" {
+		http.Error(w, "session required", http.StatusBadRequest)
+		return
+	}
+	stats, err := s.CollectObjects(vendedID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
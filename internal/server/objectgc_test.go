@@ -0,0 +1,122 @@
+// CRC: crc-LuaSession.md
+// Spec: deployment.md (Object Collection)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+
+	gopher "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestObjectCollection verifies a collection drops objects only destroyed
+// variables referred to, and keeps objects referenced only from an undelivered
+// update or from a ViewList's item wrappers
+func TestObjectCollection(t *testing.T) {
+	// The tracker holds registered objects weakly; keep Go's GC out of the counts
+	defer debug.SetGCPercent(debug.SetGCPercent(-1))
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Row = {}
+		Row.__index = Row
+		function Row:new(item) return setmetatable({item = item}, self) end
+		app = {rows = {{n = 1}, {n = 2}}}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.wsEndpoint.ConnectPolling(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1,
+		Properties: map[string]string{"path": "rows", "wrapper": "lua.ViewList", "itemWrapper": "Row"}})
+	if resp, err := s.wsEndpoint.HandlePolled(conn, create); err != nil || resp != nil && resp.Error != "" {
+		t.Fatalf("create failed: %v %+v", err, resp)
+	}
+
+	luaSession := s.GetLuaSession(vendedID)
+	tracker := luaSession.GetTracker()
+	var dead []int64
+	var pendingID, presenterID int64
+	_, err = s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		// Tables whose variables were destroyed, left in _objectToId and the registry
+		if _, err := luaSession.LoadCodeDirect("garbage", `
+			dead = {}
+			for i = 1, 3 do
+				local t = {n = i}
+				session:destroyVariable(session:createVariable(1, t, {path = "rows"}))
+				dead[i] = t
+			end
+			undelivered = {n = 99}
+		`); err != nil {
+			return nil, err
+		}
+		for i := 1; i <= 3; i++ {
+			id, _ := tracker.RegisterObject(luaSession.State.GetGlobal("dead").(*gopher.LTable).RawGetInt(i))
+			dead = append(dead, id)
+		}
+		pendingID, _ = tracker.RegisterObject(luaSession.State.GetGlobal("undelivered"))
+		list := tracker.GetVariable(2).WrapperValue.(*lua.ViewList)
+		presenterID, _ = tracker.RegisterObject(list.Items[0].Item)
+		return luaSession.LoadCodeDirect("drop", `dead = nil; undelivered = nil`)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	update, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2,
+		Value: json.RawMessage(fmt.Sprintf(`[{"obj":%d}]`, pendingID))})
+	s.wsEndpoint.pending.Enqueue(conn, update)
+
+	stats, err := s.CollectObjects(vendedID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := stats.ObjectsBefore - stats.ObjectsAfter; n != 3 {
+		t.Errorf("collected %d objects, want 3 (%+v)", n, stats)
+	}
+	if n := stats.IdentitiesBefore - stats.IdentitiesAfter; n != 3 {
+		t.Errorf("pruned %d _objectToId entries, want 3 (%+v)", n, stats)
+	}
+	for _, id := range dead {
+		if tracker.GetObject(id) != nil {
+			t.Errorf("object %d of a destroyed variable is still registered", id)
+		}
+	}
+	if tracker.GetObject(pendingID) == nil {
+		t.Error("object in an undelivered update was collected")
+	}
+	if tracker.GetObject(presenterID) == nil {
+		t.Error("ViewList item wrapper was collected")
+	}
+	if sess.ObjectGC() != stats {
+		t.Error("session does not report its last collection")
+	}
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("POST", "/api/debug/gc?session="+vendedID, nil))
+	var again ObjectGCStats
+	if err := json.Unmarshal(w.Body.Bytes(), &again); err != nil || w.Code != 200 {
+		t.Fatalf("gc returned %d: %s", w.Code, w.Body)
+	}
+	if again.ObjectsBefore != again.ObjectsAfter || again.IdentitiesBefore != again.IdentitiesAfter {
+		t.Errorf("second collection removed objects: %+v", again)
+	}
+}
@@ -0,0 +1,295 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: variable-browser.md (Object Graph)
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strconv"
+
+	gopher "github.com/yuin/gopher-lua"
+	changetracker "github.com/zot/change-tracker"
+)
+
+// maxGraphObjects caps the objects in an object graph; larger graphs are truncated.
+const maxGraphObjects = 5000
+
+// ObjectGraph is a snapshot of a tracker's registered objects, served at
+// /{session-id}/objects.json.
+type ObjectGraph struct {
+	Objects   []GraphObject `json:"objects"`
+	Edges     []GraphEdge   `json:"edges"`
+	Total     int           `json:"total"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Warning   string        `json:"warning,omitempty"`
+}
+
+// GraphObject is a registered object and the variables whose values refer to it.
+type GraphObject struct {
+	ID        int64   `json:"id"`
+	Type      string  `json:"type,omitempty"`
+	Size      int     `json:"size"` // Approximate bytes, not counting referenced objects
+	Variables []int64 `json:"variables,omitempty"`
+	Highlight bool    `json:"highlight,omitempty"` // Reachable from the focus variable
+}
+
+// GraphEdge is a reference from one object to another, through a child
+// variable's path or a Lua table field.
+type GraphEdge struct {
+	From  int64  `json:"from"`
+	To    int64  `json:"to"`
+	Label string `json:"label,omitempty"`
+}
+
+// ObjectGraph builds a session's object graph on its executor, so the tracker
+// is not mutated while it is read. A nonzero focus highlights the objects
+// reachable from that variable's value.
+func (s *Server) ObjectGraph(vendedID string, focus int64) (*ObjectGraph, error) {
+	var graph *ObjectGraph
+	_, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		luaSession := s.GetLuaSession(vendedID)
+		tracker := luaSession.GetTracker()
+		if tracker == nil {
+			return nil, fmt.Errorf("tracker not found")
+		}
+		graph = buildObjectGraph(tracker, focus, maxGraphObjects)
+		return nil, nil
+	})
+	return graph, err
+}
+
+// buildObjectGraph collects the objects referred to by variable values, plus
+// any others still registered, and the references between them.
+func buildObjectGraph(tracker *changetracker.Tracker, focus int64, limit int) *ObjectGraph {
+	vars := tracker.Variables()
+	byID := make(map[int64]*changetracker.Variable, len(vars))
+	objects := make(map[int64]*GraphObject)
+	var maxID int64
+	node := func(id int64) *GraphObject {
+		if objects[id] == nil {
+			obj := tracker.GetObject(id)
+			if obj == nil {
+				return nil
+			}
+			objects[id] = &GraphObject{ID: id, Type: tracker.Resolver.GetType(nil, obj), Size: approxSize(obj)}
+		}
+		return objects[id]
+	}
+	for _, v := range vars {
+		byID[v.ID] = v
+		maxID = max(maxID, v.ID)
+		for _, id := range valueRefs(v.ValueJSON) {
+			if o := node(id); o != nil {
+				o.Variables = append(o.Variables, v.ID)
+			}
+			maxID = max(maxID, id)
+		}
+	}
+	// Objects and variables share the tracker's ID sequence, so this finds
+	// registered objects no variable refers to any more
+	for id := int64(1); id <= maxID; id++ {
+		node(id)
+	}
+
+	edges := make(map[GraphEdge]bool)
+	for _, v := range vars {
+		if parent := byID[v.ParentID]; parent != nil {
+			for _, from := range valueRefs(parent.ValueJSON) {
+				for _, to := range valueRefs(v.ValueJSON) {
+					if objects[from] != nil && objects[to] != nil {
+						edges[GraphEdge{from, to, v.Properties["path"]}] = true
+					}
+				}
+			}
+		}
+	}
+	for id := range objects {
+		tbl, ok := tracker.GetObject(id).(*gopher.LTable)
+		if !ok {
+			continue
+		}
+		tbl.ForEach(func(k, val gopher.LValue) {
+			for _, to := range fieldRefs(tracker, val) {
+				if objects[to] != nil {
+					edges[GraphEdge{id, to, k.String()}] = true
+				}
+			}
+		})
+	}
+
+	graph := &ObjectGraph{Total: len(objects)}
+	for _, o := range objects {
+		graph.Objects = append(graph.Objects, *o)
+	}
+	for e := range edges {
+		graph.Edges = append(graph.Edges, e)
+	}
+	if v := byID[focus]; v != nil {
+		graph.highlight(valueRefs(v.ValueJSON))
+	}
+	// Highlighted objects come first so truncation keeps them
+	slices.SortFunc(graph.Objects, func(a, b GraphObject) int {
+		if a.Highlight != b.Highlight {
+			if a.Highlight {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	slices.SortFunc(graph.Edges, func(a, b GraphEdge) int {
+		return cmp.Or(cmp.Compare(a.From, b.From), cmp.Compare(a.To, b.To), cmp.Compare(a.Label, b.Label))
+	})
+	if len(graph.Objects) > limit {
+		graph.truncate(limit)
+	}
+	if graph.Objects == nil {
+		graph.Objects = []GraphObject{}
+	}
+	if graph.Edges == nil {
+		graph.Edges = []GraphEdge{}
+	}
+	return graph
+}
+
+// highlight marks the objects reachable from roots.
+func (g *ObjectGraph) highlight(roots []int64) {
+	out := make(map[int64][]int64)
+	for _, e := range g.Edges {
+		out[e.From] = append(out[e.From], e.To)
+	}
+	reached := make(map[int64]bool)
+	for len(roots) > 0 {
+		id := roots[0]
+		roots = roots[1:]
+		if !reached[id] {
+			reached[id] = true
+			roots = append(roots, out[id]...)
+		}
+	}
+	for i := range g.Objects {
+		g.Objects[i].Highlight = reached[g.Objects[i].ID]
+	}
+}
+
+// truncate keeps the first limit objects and the edges between them.
+func (g *ObjectGraph) truncate(limit int) {
+	g.Objects = g.Objects[:limit]
+	kept := make(map[int64]bool, limit)
+	for _, o := range g.Objects {
+		kept[o.ID] = true
+	}
+	g.Edges = slices.DeleteFunc(g.Edges, func(e GraphEdge) bool {
+		return !kept[e.From] || !kept[e.To]
+	})
+	g.Truncated = true
+	g.Warning = fmt.Sprintf("graph truncated to %d of %d objects", limit, g.Total)
+}
+
+// WriteDOT writes the graph in Graphviz DOT format.
+func (g *ObjectGraph) WriteDOT(w io.Writer) error {
+	dw := &dotWriter{w: w}
+	dw.printf("digraph objects {\n\tnode [shape=box];\n")
+	if g.Warning != "" {
+		dw.printf("\tlabel=%s;\n", strconv.Quote(g.Warning))
+	}
+	for _, o := range g.Objects {
+		label := fmt.Sprintf("%d %s\n%d bytes", o.ID, o.Type, o.Size)
+		if len(o.Variables) > 0 {
+			label += fmt.Sprintf("\nvars %v", o.Variables)
+		}
+		style := ""
+		if o.Highlight {
+			style = ", style=filled, fillcolor=gold"
+		}
+		dw.printf("\to%d [label=%s%s];\n", o.ID, strconv.Quote(label), style)
+	}
+	for _, e := range g.Edges {
+		dw.printf("\to%d -> o%d [label=%s];\n", e.From, e.To, strconv.Quote(e.Label))
+	}
+	dw.printf("}\n")
+	return dw.err
+}
+
+// dotWriter keeps the first write error so WriteDOT can check it once.
+type dotWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (d *dotWriter) printf(format string, args ...any) {
+	if d.err == nil {
+		_, d.err = fmt.Fprintf(d.w, format, args...)
+	}
+}
+
+// valueRefs returns the object IDs in a variable's Value JSON.
+func valueRefs(valueJSON any) []int64 {
+	switch v := valueJSON.(type) {
+	case changetracker.ObjectRef:
+		return []int64{v.Obj}
+	case []any:
+		var ids []int64
+		for _, elem := range v {
+			if ref, ok := elem.(changetracker.ObjectRef); ok {
+				ids = append(ids, ref.Obj)
+			}
+		}
+		return ids
+	}
+	return nil
+}
+
+// fieldRefs returns the registered objects a Lua table field holds, directly
+// or as elements of an array table. It never registers objects.
+func fieldRefs(tracker *changetracker.Tracker, val gopher.LValue) []int64 {
+	tbl, ok := val.(*gopher.LTable)
+	if !ok {
+		return nil
+	}
+	if id, ok := tracker.LookupObject(tbl); ok {
+		return []int64{id}
+	}
+	elems, ok := tracker.Resolver.ConvertToValueJSON(tracker, tbl).([]any)
+	if !ok {
+		return nil
+	}
+	var ids []int64
+	for _, elem := range elems {
+		if id, ok := tracker.LookupObject(elem); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// approxSize estimates an object's own size in bytes.
+func approxSize(obj any) int {
+	const word = 8
+	if tbl, ok := obj.(*gopher.LTable); ok {
+		size := 0
+		tbl.ForEach(func(k, v gopher.LValue) {
+			size += 2*word + scalarSize(k) + scalarSize(v)
+		})
+		return size
+	}
+	rv := reflect.ValueOf(obj)
+	switch rv.Kind() {
+	case reflect.Pointer:
+		return int(rv.Type().Elem().Size())
+	case reflect.Map:
+		return rv.Len() * 2 * word
+	}
+	return word
+}
+
+// scalarSize is the size of a Lua value held in a table; tables count as references.
+func scalarSize(v gopher.LValue) int {
+	if s, ok := v.(gopher.LString); ok {
+		return len(s)
+	}
+	return 8
+}
@@ -0,0 +1,99 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: variable-browser.md (Object Graph)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestObjectGraph verifies objects.json lists the objects variables refer to
+// with edges from child paths and table fields, highlights a variable's
+// subgraph, serves DOT, and truncates with a warning
+func TestObjectGraph(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice", profile = {email = "a@example.com"}, items = {{n = 1}, {n = 2}}}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	for _, msg := range []protocol.CreateMessage{
+		{ID: 2, ParentID: 1, Properties: map[string]string{"path": "profile"}},
+		{ID: 3, ParentID: 1, Properties: map[string]string{"path": "items"}},
+	} {
+		m, _ := protocol.NewMessage(protocol.MsgCreate, msg)
+		if resp, err := h.HandleMessage("c1", m); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("create %d failed: %v %+v", msg.ID, err, resp)
+		}
+	}
+	luaSession.AfterBatch(vendedID)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/"+sess.ID+"/objects.json"+query, nil))
+		if w.Code != 200 {
+			t.Fatalf("objects.json%s returned %d: %s", query, w.Code, w.Body)
+		}
+		return w
+	}
+	var graph ObjectGraph
+	if err := json.Unmarshal(get("?var=2").Body.Bytes(), &graph); err != nil {
+		t.Fatal(err)
+	}
+	byVar := make(map[int64]GraphObject)
+	for _, o := range graph.Objects {
+		for _, v := range o.Variables {
+			byVar[v] = o
+		}
+	}
+	app, profile := byVar[1], byVar[2]
+	if app.ID == 0 || profile.ID == 0 || profile.Size == 0 {
+		t.Fatalf("objects = %+v, want the app and profile tables", graph.Objects)
+	}
+	if !profile.Highlight || app.Highlight {
+		t.Errorf("highlighted app %v profile %v, want only variable 2's subgraph", app.Highlight, profile.Highlight)
+	}
+	labels := make(map[string]int)
+	for _, e := range graph.Edges {
+		if e.From == app.ID {
+			labels[e.Label]++
+		}
+	}
+	if labels["profile"] != 1 || labels["items"] != 2 {
+		t.Errorf("edges from app = %v, want profile once and both items", labels)
+	}
+
+	if dot := get("?format=dot").Body.String(); !strings.HasPrefix(dot, "digraph objects {") || !strings.Contains(dot, `[label="profile"]`) {
+		t.Errorf("DOT output:\n%s", dot)
+	}
+
+	tracker := luaSession.GetTracker()
+	small := buildObjectGraph(tracker, 2, 1)
+	if !small.Truncated || small.Warning == "" || len(small.Objects) != 1 || small.Objects[0].ID != profile.ID ||
+		slices.ContainsFunc(small.Edges, func(e GraphEdge) bool { return e.From != profile.ID || e.To != profile.ID }) {
+		t.Errorf("truncated graph = %+v, want only the highlighted profile and a warning", small)
+	}
+}
@@ -0,0 +1,66 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Server Options)
+package server
+
+import (
+	"io/fs"
+
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+	"github.com/zot/ui-engine/internal/viewdef"
+)
+
+// Option substitutes a component NewWithOptions would otherwise build from config.
+type Option func(*serverOptions)
+
+// serverOptions holds the components given to NewWithOptions (nil = default).
+type serverOptions struct {
+	sessions        *SessionManager
+	viewdefManager  *viewdef.ViewdefManager
+	store           PersistentStore
+	wrapperRegistry *lua.WrapperRegistry
+	telemetry       protocol.TelemetryHook
+	auth            AuthFunc
+	siteFS          fs.FS
+}
+
+// WithSessionManager uses sessions instead of one with session.timeout. The
+// server installs its session callbacks on it, so it must not serve another Server.
+func WithSessionManager(sessions *SessionManager) Option {
+	return func(o *serverOptions) { o.sessions = sessions }
+}
+
+// WithViewdefManager uses manager instead of a new one. The site's viewdefs
+// are loaded into it, over any it already has.
+func WithViewdefManager(manager *viewdef.ViewdefManager) Option {
+	return func(o *serverOptions) { o.viewdefManager = manager }
+}
+
+// WithStore persists variable state of persistent sessions to store, as
+// SetPersistentStore does.
+func WithStore(store PersistentStore) Option {
+	return func(o *serverOptions) { o.store = store }
+}
+
+// WithWrapperRegistry gives every Lua session registry for ui.registerWrapper
+// instead of a new one, so the embedder can register wrappers from Go.
+func WithWrapperRegistry(registry *lua.WrapperRegistry) Option {
+	return func(o *serverOptions) { o.wrapperRegistry = registry }
+}
+
+// WithTelemetry installs hook, as SetTelemetry does.
+func WithTelemetry(hook protocol.TelemetryHook) Option {
+	return func(o *serverOptions) { o.telemetry = hook }
+}
+
+// WithAuthFunc refuses HTTP requests auth rejects, WebSocket upgrades and
+// polling included. The backend socket is not covered.
+func WithAuthFunc(auth AuthFunc) Option {
+	return func(o *serverOptions) { o.auth = auth }
+}
+
+// WithSiteFS serves static files from siteFS, as SetSiteFS does. Lua and
+// viewdefs still come from the bundle or server.dir.
+func WithSiteFS(siteFS fs.FS) Option {
+	return func(o *serverOptions) { o.siteFS = siteFS }
+}
@@ -0,0 +1,86 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Server Options)
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/viewdef"
+)
+
+// TestNewWithOptions injects each component and verifies the server uses it
+// in place of the one it would build
+func TestNewWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.MkdirAll(filepath.Join(dir, "viewdefs"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		ui.registerWrapper("Probe", {})
+		session:createAppVariable({count = 1})
+	`), 0644)
+	os.WriteFile(filepath.Join(dir, "viewdefs", "Probe.DEFAULT.html"), []byte(`<template><div></div></template>`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+
+	sessions := NewSessionManager(time.Hour)
+	viewdefs := viewdef.NewViewdefManager()
+	store := &flakyStore{}
+	registry := lua.NewWrapperRegistry()
+	rec := &eventRecorder{}
+	site := fstest.MapFS{"hello.txt": {Data: []byte("hello")}}
+	s := NewWithOptions(cfg,
+		WithSessionManager(sessions),
+		WithViewdefManager(viewdefs),
+		WithStore(store),
+		WithWrapperRegistry(registry),
+		WithTelemetry(rec),
+		WithAuthFunc(func(r *http.Request) bool { return r.Header.Get("X-Token") == "ok" }),
+		WithSiteFS(site),
+	)
+	defer s.Shutdown(context.Background())
+
+	if s.GetViewdefManager() != viewdefs || viewdefs.GetAllViewdefs()["Probe.DEFAULT"] == "" {
+		t.Errorf("site viewdefs not loaded into the given manager: %v", viewdefs.GetAllViewdefs())
+	}
+	_, vendedID, err := sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.GetLuaSession(vendedID) == nil {
+		t.Fatal("session created on the given manager has no Lua session")
+	}
+	if _, ok := registry.Get("Probe"); !ok {
+		t.Error("ui.registerWrapper did not use the given registry")
+	}
+	if s.persist == nil || s.persist.store != store {
+		t.Error("write-through does not use the given store")
+	}
+	rec.mu.Lock()
+	if !slices.Contains(rec.events, "created "+vendedID) {
+		t.Errorf("telemetry events = %v", rec.events)
+	}
+	rec.mu.Unlock()
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/hello.txt", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request without token: %d", w.Code)
+	}
+	r := httptest.NewRequest("GET", "/hello.txt", nil)
+	r.Header.Set("X-Token", "ok")
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Body.String() != "hello" {
+		t.Errorf("site file: %d %q", w.Code, w.Body.String())
+	}
+}
@@ -5,16 +5,18 @@
 package server
 
 import (
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/zot/ui-engine/internal/protocol"
 )
 
-// MessageSender sends protocol messages and logs.
+// MessageSender sends encoded frames and logs.
 type MessageSender interface {
-	Send(connectionID string, msg *protocol.Message) error
-	SendBatch(connectionID string, msgs []*protocol.Message) error
+	// SendFrame sends one encoded frame holding msgs (a message, or an array of
+	// them) to each of the connections.
+	SendFrame(connectionIDs []string, data []byte, msgs []*protocol.Message) error
 	Log(level int, format string, args ...interface{})
 }
 
@@ -22,6 +24,7 @@ type MessageSender interface {
 type pendingUpdate struct {
 	msg      *protocol.Message
 	watchers []string // connection IDs to send to
+	encoded  []byte   // msg encoded, once a flush needs it
 }
 
 // OutgoingBatcher batches outgoing messages for a single session with debouncing.
@@ -112,7 +115,7 @@ func (b *OutgoingBatcher) FlushNow() {
 }
 
 // flush sends pending messages (called by timer or FlushNow).
-// Groups messages by connection and sends one batch per connection.
+// Groups connections by the messages they get and sends each group one frame.
 func (b *OutgoingBatcher) flush() {
 	b.mu.Lock()
 
@@ -131,23 +134,108 @@ func (b *OutgoingBatcher) flush() {
 		return
 	}
 
-	// Group messages by connection ID
-	connMsgs := make(map[string][]*protocol.Message)
-	for _, update := range updates {
+	b.sender.Log(4, "[OUT] BATCH %d", count)
+	// Connections getting the same messages share one frame, so each message
+	// and each distinct frame is encoded once however many watchers there are
+	for _, group := range groupFrames(updates) {
+		msgs := make([]*protocol.Message, len(group.updates))
+		parts := make([][]byte, len(group.updates))
+		var err error
+		for i, u := range group.updates {
+			msgs[i] = updates[u].msg
+			if parts[i], err = encodeOnce(updates, u); err != nil {
+				break
+			}
+		}
+		if err != nil {
+			b.sender.Log(0, "ERROR: failed to encode batch %d: %v", count, err)
+			continue
+		}
+		data := parts[0]
+		if len(parts) > 1 {
+			data = joinFrame(parts)
+		}
+		b.sender.SendFrame(group.connections, data, msgs)
+	}
+}
+
+// frameGroup is the connections that get the same pending updates, by index.
+type frameGroup struct {
+	updates     []int
+	connections []string
+}
+
+// groupFrames groups each connection with the others getting the same
+// sequence of updates. Sequences form a trie: a connection's node advances by
+// one edge per update it watches, so no per-connection key is built.
+func groupFrames(updates []pendingUpdate) []*frameGroup {
+	type edge struct{ from, update int }
+	type node struct{ parent, update int }
+	nodes := []node{{-1, -1}} // Node 0 is the empty sequence
+	next := make(map[edge]int)
+	at := make(map[string]int, len(updates[0].watchers))
+	var order []string // Connections in first-seen order, so sends are deterministic
+	for i, update := range updates {
 		for _, connID := range update.watchers {
-			connMsgs[connID] = append(connMsgs[connID], update.msg)
+			from, seen := at[connID]
+			if !seen {
+				order = append(order, connID)
+			}
+			to, ok := next[edge{from, i}]
+			if !ok {
+				to = len(nodes)
+				nodes = append(nodes, node{from, i})
+				next[edge{from, i}] = to
+			}
+			at[connID] = to
 		}
 	}
+	byNode := make(map[int]*frameGroup)
+	var groups []*frameGroup
+	for _, connID := range order {
+		n := at[connID]
+		group := byNode[n]
+		if group == nil {
+			group = &frameGroup{}
+			for ; n > 0; n = nodes[n].parent {
+				group.updates = append(group.updates, nodes[n].update)
+			}
+			slices.Reverse(group.updates)
+			byNode[at[connID]] = group
+			groups = append(groups, group)
+		}
+		group.connections = append(group.connections, connID)
+	}
+	return groups
+}
 
-	b.sender.Log(4, "[OUT] BATCH %d", count)
-	// Send one batch per connection
-	for connID, msgs := range connMsgs {
-		if len(msgs) == 1 {
-			b.sender.Send(connID, msgs[0])
-		} else {
-			b.sender.SendBatch(connID, msgs)
+// encodeOnce returns an update's encoded message, encoding it on first use.
+func encodeOnce(updates []pendingUpdate, i int) ([]byte, error) {
+	if updates[i].encoded == nil {
+		data, err := updates[i].msg.Encode()
+		if err != nil {
+			return nil, err
+		}
+		updates[i].encoded = data
+	}
+	return updates[i].encoded, nil
+}
+
+// joinFrame joins encoded messages into a JSON array.
+func joinFrame(parts [][]byte) []byte {
+	size := len(parts) + 1
+	for _, part := range parts {
+		size += len(part)
+	}
+	frame := make([]byte, 0, size)
+	frame = append(frame, '[')
+	for i, part := range parts {
+		if i > 0 {
+			frame = append(frame, ',')
 		}
+		frame = append(frame, part...)
 	}
+	return append(frame, ']')
 }
 
 // Clear removes all pending messages and stops the timer.
@@ -163,6 +251,17 @@ func (b *OutgoingBatcher) Clear() {
 	b.pendingUpdates = nil
 }
 
+// PendingMessages returns the messages waiting to be flushed.
+func (b *OutgoingBatcher) PendingMessages() []*protocol.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	msgs := make([]*protocol.Message, len(b.pendingUpdates))
+	for i, u := range b.pendingUpdates {
+		msgs[i] = u.msg
+	}
+	return msgs
+}
+
 // PendingCount returns the number of pending updates (for testing).
 func (b *OutgoingBatcher) PendingCount() int {
 	b.mu.Lock()
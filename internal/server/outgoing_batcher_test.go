@@ -5,6 +5,7 @@ package server
 
 import (
 	"encoding/json"
+	"fmt"
 	"sync"
 	"testing"
 	"time"
@@ -17,26 +18,28 @@ type mockSender struct {
 	mu       sync.Mutex
 	messages []*protocol.Message
 	connIDs  []string
+	frames   []sentFrame
 	onSend   func(connID string, msg *protocol.Message)
 }
 
-func (m *mockSender) Send(connectionID string, msg *protocol.Message) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-	m.messages = append(m.messages, msg)
-	m.connIDs = append(m.connIDs, connectionID)
-	if m.onSend != nil {
-		m.onSend(connectionID, msg)
-	}
-	return nil
+// sentFrame is one SendFrame call.
+type sentFrame struct {
+	connections []string
+	data        []byte
 }
 
-func (m *mockSender) SendBatch(connectionID string, msgs []*protocol.Message) error {
+func (m *mockSender) SendFrame(connectionIDs []string, data []byte, msgs []*protocol.Message) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	for _, msg := range msgs {
-		m.messages = append(m.messages, msg)
-		m.connIDs = append(m.connIDs, connectionID)
+	m.frames = append(m.frames, sentFrame{connections: connectionIDs, data: data})
+	for _, connID := range connectionIDs {
+		for _, msg := range msgs {
+			m.messages = append(m.messages, msg)
+			m.connIDs = append(m.connIDs, connID)
+			if m.onSend != nil {
+				m.onSend(connID, msg)
+			}
+		}
 	}
 	return nil
 }
@@ -293,3 +296,87 @@ func TestPerSessionBatcherIsolation(t *testing.T) {
 		t.Errorf("batcher2 should have sent after debounce, got %d", mock2.connCount("conn2"))
 	}
 }
+
+// TestOutgoingBatcherSharesFrames verifies connections getting the same
+// messages share one encoded frame, and one whose echo was suppressed gets its
+// own variant
+func TestOutgoingBatcherSharesFrames(t *testing.T) {
+	mock := &mockSender{}
+	batcher := NewOutgoingBatcher(mock)
+	msgs := make([]*protocol.Message, 3)
+	for i := range msgs {
+		msgs[i], _ = protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{
+			VarID: int64(i + 1),
+			Value: json.RawMessage(`"v"`),
+		})
+	}
+	batcher.Queue(msgs[0], []string{"a", "b", "c"})
+	batcher.Queue(msgs[1], []string{"a", "b"}) // c sent this value
+	batcher.Queue(msgs[2], []string{"c", "d"})
+	batcher.FlushNow()
+
+	batch := func(m ...*protocol.Message) string {
+		data, _ := json.Marshal(m)
+		return string(data)
+	}
+	single, _ := msgs[2].Encode()
+	want := []struct {
+		connections string
+		data        string
+	}{
+		{"[a b]", batch(msgs[0], msgs[1])},
+		{"[c]", batch(msgs[0], msgs[2])},
+		{"[d]", string(single)},
+	}
+	if len(mock.frames) != len(want) {
+		t.Fatalf("sent %d frames, want %d", len(mock.frames), len(want))
+	}
+	for i, w := range want {
+		frame := mock.frames[i]
+		if fmt.Sprint(frame.connections) != w.connections || string(frame.data) != w.data {
+			t.Errorf("frame %d went to %v with %s, want %s with %s", i, frame.connections, frame.data, w.connections, w.data)
+		}
+	}
+}
+
+// discardSender is a MessageSender that drops frames, for benchmarks.
+type discardSender struct{}
+
+func (discardSender) SendFrame([]string, []byte, []*protocol.Message) error { return nil }
+func (discardSender) Log(int, string, ...interface{})                       {}
+
+// BenchmarkFanOut sends one variable's update to 500 watchers. "shared frame"
+// is the batcher's flush; "frame per watcher" groups and encodes per
+// connection, as flushing used to.
+func BenchmarkFanOut(b *testing.B) {
+	watchers := make([]string, 500)
+	for i := range watchers {
+		watchers[i] = fmt.Sprintf("conn-%d", i)
+	}
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{
+		VarID: 1,
+		Value: json.RawMessage(`{"name":"Alice","items":[1,2,3],"total":42.5}`),
+	})
+	b.Run("shared frame", func(b *testing.B) {
+		b.ReportAllocs()
+		batcher := NewOutgoingBatcher(discardSender{})
+		for b.Loop() {
+			batcher.Enqueue(msg, watchers)
+			batcher.FlushNow()
+		}
+	})
+	b.Run("frame per watcher", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			connMsgs := make(map[string][]*protocol.Message)
+			for _, connID := range watchers {
+				connMsgs[connID] = append(connMsgs[connID], msg)
+			}
+			for _, msgs := range connMsgs {
+				if _, err := msgs[0].Encode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// CRC: crc-Bundle.md
+// Spec: deployment.md (Directory Overlay)
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// overlaySite starts a server for a --dir holding files, over a bundle
+// holding bundled.
+func overlaySite(t *testing.T, files, bundled map[string]string, noFallback bool) *Server {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range bundled {
+		w, _ := zw.Create(name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	reader, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	bundle.SetFallback(reader)
+	t.Cleanup(func() { bundle.SetFallback(nil) })
+
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		os.WriteFile(path, []byte(content), 0644)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Server.NoBundleFallback = noFallback
+	s := New(cfg)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	return s
+}
+
+// TestDirOverlay verifies --dir files override the bundle's while HTML,
+// viewdefs and Lua it lacks come from the bundle, and --no-bundle-fallback
+// serves only --dir
+func TestDirOverlay(t *testing.T) {
+	bundled := map[string]string{
+		"html/page.html":            "bundled page",
+		"html/app.css":              "body {}",
+		"viewdefs/App.DEFAULT.html": "<template><div>bundled</div></template>",
+		"lua/main.lua":              `app = {from = "bundle"} session:createAppVariable(app)`,
+		"lua/lib.lua":               `return {v = 7}`,
+	}
+	get := func(s *Server, path string) (int, string) {
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+	state := func(s *Server) (string, error) {
+		t.Helper()
+		h, err := s.CreateHeadlessSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer h.Close()
+		data, err := h.State()
+		return string(data), err
+	}
+
+	s := overlaySite(t, map[string]string{
+		"html/page.html": "my page",
+		"lua/main.lua":   `app = {v = require("lib").v} session:createAppVariable(app)`,
+	}, bundled, false)
+	if code, body := get(s, "/page.html"); code != 200 || body != "my page" {
+		t.Errorf("GET /page.html = %d %q, want the directory's", code, body)
+	}
+	if code, body := get(s, "/app.css"); code != 200 || body != "body {}" {
+		t.Errorf("GET /app.css = %d %q, want the bundle's", code, body)
+	}
+	if _, ok := s.viewdefManager.GetAllViewdefs()["App.DEFAULT"]; !ok {
+		t.Error("bundled viewdef not loaded")
+	}
+	if got, err := state(s); err != nil || !strings.Contains(got, `"v":7`) {
+		t.Errorf("state = %s, want the directory's main.lua with the bundled lib", got)
+	}
+
+	s = overlaySite(t, map[string]string{"html/page.html": "my page"}, bundled, false)
+	if got, err := state(s); err != nil || !strings.Contains(got, `"from":"bundle"`) {
+		t.Errorf("state = %s, want the bundled main.lua", got)
+	}
+
+	s = overlaySite(t, map[string]string{"html/page.html": "my page"}, bundled, true)
+	if code, _ := get(s, "/app.css"); code != 404 {
+		t.Errorf("GET /app.css = %d without fallback, want 404", code)
+	}
+	if _, ok := s.viewdefManager.GetAllViewdefs()["App.DEFAULT"]; ok {
+		t.Error("bundled viewdef loaded without fallback")
+	}
+	if got, err := state(s); err == nil {
+		t.Errorf("state = %s, want no app without the bundled main.lua", got)
+	}
+}
@@ -3,17 +3,41 @@
 package server
 
 import (
+	"cmp"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zot/ui-engine/internal/protocol"
 )
 
+// Poll hint tuning: after pollIdleThreshold consecutive empty polls the suggested
+// wait doubles for each further threshold's worth, up to the client's maximum.
+const (
+	pollIdleThreshold  = 3
+	pollDefaultWait    = 30 * time.Second
+	pollDefaultMaxWait = 5 * time.Minute
+	pollMaxDoublings   = 10
+)
+
+// Poll size defaults, used when a poll sets no maxMessages or maxBytes, and the
+// longest a parked poll waits once queued bytes exceed the memory limit.
+const (
+	pollDefaultMaxMessages = 1000
+	pollDefaultMaxBytes    = 1 << 20
+	pollPressureWait       = time.Second
+)
+
 // PendingResponseQueue accumulates push messages for polling clients.
 type PendingResponseQueue struct {
-	queue   []*protocol.Message
-	waiters []chan struct{}
-	mu      sync.Mutex
+	queue     []*protocol.Message
+	bytes     int // size of the queued messages
+	waiters   []chan struct{}
+	idlePolls int                  // consecutive polls that returned nothing
+	closed    bool                 // removed from its manager; parked polls return at once
+	manager   *PendingQueueManager // counts queued bytes across queues (nil if standalone)
+	mu        sync.Mutex
 }
 
 // NewPendingResponseQueue creates a new pending response queue.
@@ -24,15 +48,44 @@ func NewPendingResponseQueue() *PendingResponseQueue {
 	}
 }
 
-// Enqueue adds a message to the pending queue.
+// Enqueue adds a message to the pending queue. Messages for a removed queue
+// are dropped, since nothing will poll it.
 // Valid message types: update, error, destroy
 func (q *PendingResponseQueue) Enqueue(msg *protocol.Message) {
 	q.mu.Lock()
 	defer q.mu.Unlock()
 
+	if q.closed {
+		return
+	}
 	q.queue = append(q.queue, msg)
+	q.addBytes(messageSize(msg))
+	q.notifyWaiters()
+}
+
+// messageSize approximates a queued message's memory and wire size.
+func messageSize(msg *protocol.Message) int {
+	return len(msg.Type) + len(msg.Data)
+}
 
-	// Notify any waiters
+// addBytes tracks the queued size here and in the manager. Caller holds q.mu.
+func (q *PendingResponseQueue) addBytes(delta int) {
+	q.bytes += delta
+	if q.manager != nil {
+		q.manager.addBytes(delta)
+	}
+}
+
+// pressure returns the manager's memory pressure signal (nil if standalone).
+func (q *PendingResponseQueue) pressure() <-chan struct{} {
+	if q.manager == nil {
+		return nil
+	}
+	return q.manager.pressureSignal()
+}
+
+// notifyWaiters wakes parked polls. Caller holds q.mu.
+func (q *PendingResponseQueue) notifyWaiters() {
 	for _, ch := range q.waiters {
 		select {
 		case ch <- struct{}{}:
@@ -42,55 +95,148 @@ func (q *PendingResponseQueue) Enqueue(msg *protocol.Message) {
 	}
 }
 
+// close wakes parked polls for good and drops the queued messages; used when
+// the queue is removed.
+func (q *PendingResponseQueue) close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.queue = nil
+	q.addBytes(-q.bytes)
+	q.notifyWaiters()
+}
+
 // Drain returns all pending messages and clears the queue.
 func (q *PendingResponseQueue) Drain() []*protocol.Message {
 	q.mu.Lock()
 	defer q.mu.Unlock()
+	return q.drainLocked()
+}
 
+func (q *PendingResponseQueue) drainLocked() []*protocol.Message {
 	if len(q.queue) == 0 {
 		return nil
 	}
 
 	messages := q.queue
 	q.queue = make([]*protocol.Message, 0)
+	q.addBytes(-q.bytes)
 	return messages
 }
 
-// Poll returns pending messages, optionally waiting for availability.
-// If wait is 0, returns immediately. Otherwise waits up to the duration.
-func (q *PendingResponseQueue) Poll(wait time.Duration) []*protocol.Message {
-	// Try immediate drain first
-	messages := q.Drain()
-	if len(messages) > 0 || wait == 0 {
-		return messages
+// takeLocked removes the oldest messages that fit the limits, at least one,
+// and reports whether more are left. Caller holds q.mu.
+func (q *PendingResponseQueue) takeLocked(limits protocol.PollLimits) ([]*protocol.Message, bool) {
+	maxMessages := cmp.Or(limits.MaxMessages, pollDefaultMaxMessages)
+	maxBytes := cmp.Or(limits.MaxBytes, pollDefaultMaxBytes)
+	n, size := 0, 0
+	for n < len(q.queue) && n < maxMessages {
+		msgSize := messageSize(q.queue[n])
+		if n > 0 && size+msgSize > maxBytes {
+			break
+		}
+		size += msgSize
+		n++
 	}
+	if n == len(q.queue) {
+		return q.drainLocked(), false
+	}
+	messages := q.queue[:n:n]
+	// Copy the rest so the returned messages' slots are not kept alive
+	q.queue = append(make([]*protocol.Message, 0, len(q.queue)-n), q.queue[n:]...)
+	q.addBytes(-size)
+	return messages, true
+}
 
-	// Set up waiter channel
-	ch := make(chan struct{}, 1)
+// Poll returns pending messages up to the limits, optionally waiting for
+// availability, and whether more are still queued. If wait is 0, returns
+// immediately. Otherwise waits up to the duration, returning as soon as a
+// message is enqueued.
+func (q *PendingResponseQueue) Poll(wait time.Duration, limits protocol.PollLimits) ([]*protocol.Message, bool) {
+	messages, more := q.poll(wait, limits)
 	q.mu.Lock()
-	q.waiters = append(q.waiters, ch)
+	if len(messages) == 0 {
+		q.idlePolls++
+	} else {
+		q.idlePolls = 0
+	}
 	q.mu.Unlock()
+	return messages, more
+}
 
-	// Wait for notification or timeout
-	select {
-	case <-ch:
-		// Message arrived
-	case <-time.After(wait):
-		// Timeout
+func (q *PendingResponseQueue) poll(wait time.Duration, limits protocol.PollLimits) ([]*protocol.Message, bool) {
+	// Check and park under one lock so an Enqueue in between cannot be missed
+	q.mu.Lock()
+	if len(q.queue) > 0 || wait == 0 || q.closed {
+		defer q.mu.Unlock()
+		return q.takeLocked(limits)
 	}
+	ch := make(chan struct{}, 1)
+	q.waiters = append(q.waiters, ch)
+	q.mu.Unlock()
 
-	// Remove waiter
+	q.wait(ch, wait)
+
+	// Remove waiter and take whatever is available
 	q.mu.Lock()
+	defer q.mu.Unlock()
 	for i, w := range q.waiters {
 		if w == ch {
 			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
 			break
 		}
 	}
+	return q.takeLocked(limits)
+}
+
+// wait parks a poll until a message arrives or the wait ends. Under memory
+// pressure the rest of the wait is cut to pollPressureWait.
+func (q *PendingResponseQueue) wait(ch chan struct{}, wait time.Duration) {
+	deadline := time.Now().Add(wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	pressure := q.pressure()
+	for {
+		select {
+		case <-ch:
+			return // Message arrived
+		case <-timer.C:
+			return // Timeout
+		case <-pressure:
+			pressure = nil
+			if time.Until(deadline) > pollPressureWait {
+				timer.Reset(pollPressureWait)
+			}
+		}
+	}
+}
+
+// Hint advises the next poll from recent activity: the requested wait while
+// messages are flowing, growing toward maxWait once polls keep coming back empty.
+func (q *PendingResponseQueue) Hint(wait, maxWait time.Duration) protocol.PollHint {
+	q.mu.Lock()
+	idle := q.idlePolls
 	q.mu.Unlock()
 
-	// Drain whatever is available
-	return q.Drain()
+	if wait <= 0 {
+		wait = pollDefaultWait
+	}
+	if maxWait <= 0 {
+		maxWait = pollDefaultMaxWait
+	}
+	maxWait = max(maxWait, wait)
+	if idle < pollIdleThreshold {
+		return protocol.PollHint{SuggestedWait: wait}
+	}
+	doublings := min(idle/pollIdleThreshold, pollMaxDoublings)
+	return protocol.PollHint{SuggestedWait: min(wait<<doublings, maxWait), Backoff: true}
+}
+
+// Messages returns the queued messages without removing them.
+func (q *PendingResponseQueue) Messages() []*protocol.Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return slices.Clone(q.queue)
 }
 
 // IsEmpty checks if the queue has pending messages.
@@ -109,17 +255,60 @@ func (q *PendingResponseQueue) Len() int {
 
 // PendingQueueManager manages pending queues per connection.
 type PendingQueueManager struct {
-	queues map[string]*PendingResponseQueue
-	mu     sync.RWMutex
+	queues      map[string]*PendingResponseQueue
+	mu          sync.RWMutex
+	queuedBytes atomic.Int64
+	memoryLimit int64 // Queued bytes across queues that mean memory pressure (0 = none)
+	pressureMu  sync.Mutex
+	pressure    chan struct{} // Closed while queued bytes exceed memoryLimit
+	pressured   bool
 }
 
 // NewPendingQueueManager creates a new pending queue manager.
 func NewPendingQueueManager() *PendingQueueManager {
 	return &PendingQueueManager{
-		queues: make(map[string]*PendingResponseQueue),
+		queues:   make(map[string]*PendingResponseQueue),
+		pressure: make(chan struct{}),
+	}
+}
+
+// SetMemoryLimit sets the queued bytes across all queues above which parked
+// polls are cut short (0 = no limit). Call before the queues are used.
+func (m *PendingQueueManager) SetMemoryLimit(bytes int64) {
+	m.memoryLimit = bytes
+}
+
+// QueuedBytes returns the size of the messages waiting across all queues.
+func (m *PendingQueueManager) QueuedBytes() int64 {
+	return m.queuedBytes.Load()
+}
+
+// addBytes updates the queued total and the memory pressure signal.
+func (m *PendingQueueManager) addBytes(delta int) {
+	total := m.queuedBytes.Add(int64(delta))
+	if m.memoryLimit <= 0 {
+		return
+	}
+	m.pressureMu.Lock()
+	defer m.pressureMu.Unlock()
+	if over := total > m.memoryLimit; over != m.pressured {
+		m.pressured = over
+		if over {
+			close(m.pressure)
+		} else {
+			m.pressure = make(chan struct{})
+		}
 	}
 }
 
+// pressureSignal returns a channel that is closed while, or once, queued
+// bytes exceed the memory limit.
+func (m *PendingQueueManager) pressureSignal() <-chan struct{} {
+	m.pressureMu.Lock()
+	defer m.pressureMu.Unlock()
+	return m.pressure
+}
+
 // GetQueue returns the queue for a connection, creating if needed.
 func (m *PendingQueueManager) GetQueue(connectionID string) *PendingResponseQueue {
 	m.mu.Lock()
@@ -128,6 +317,7 @@ func (m *PendingQueueManager) GetQueue(connectionID string) *PendingResponseQueu
 	q, ok := m.queues[connectionID]
 	if !ok {
 		q = NewPendingResponseQueue()
+		q.manager = m
 		m.queues[connectionID] = q
 	}
 	return q
@@ -136,8 +326,24 @@ func (m *PendingQueueManager) GetQueue(connectionID string) *PendingResponseQueu
 // RemoveQueue removes a connection's queue.
 func (m *PendingQueueManager) RemoveQueue(connectionID string) {
 	m.mu.Lock()
-	defer m.mu.Unlock()
+	q := m.queues[connectionID]
 	delete(m.queues, connectionID)
+	m.mu.Unlock()
+	if q != nil {
+		q.close()
+	}
+}
+
+// TotalLen returns the number of messages waiting across all queues.
+func (m *PendingQueueManager) TotalLen() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	total := 0
+	for _, q := range m.queues {
+		total += q.Len()
+	}
+	return total
 }
 
 // EnqueueToAll enqueues a message to all queues.
@@ -150,6 +356,16 @@ func (m *PendingQueueManager) EnqueueToAll(msg *protocol.Message) {
 	}
 }
 
+// EnqueueEach enqueues a separately built message to every queue.
+func (m *PendingQueueManager) EnqueueEach(build func() *protocol.Message) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, q := range m.queues {
+		q.Enqueue(build())
+	}
+}
+
 // EnqueueTo enqueues a message to specific connections.
 func (m *PendingQueueManager) EnqueueTo(msg *protocol.Message, connectionIDs []string) {
 	m.mu.RLock()
@@ -169,7 +385,10 @@ func (m *PendingQueueManager) Enqueue(connectionID string, msg *protocol.Message
 }
 
 // Poll implements protocol.PendingQueuer interface.
-func (m *PendingQueueManager) Poll(connectionID string, wait time.Duration) []*protocol.Message {
+func (m *PendingQueueManager) Poll(connectionID string, wait, maxWait time.Duration, limits protocol.PollLimits) ([]*protocol.Message, protocol.PollHint) {
 	q := m.GetQueue(connectionID)
-	return q.Poll(wait)
+	messages, more := q.Poll(wait, limits)
+	hint := q.Hint(wait, maxWait)
+	hint.More = more
+	return messages, hint
 }
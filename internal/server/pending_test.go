@@ -0,0 +1,173 @@
+// CRC: crc-PendingResponseQueue.md
+// Spec: deployment.md
+package server
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestPollWakesOnEnqueue verifies a parked poll returns as soon as a message arrives
+func TestPollWakesOnEnqueue(t *testing.T) {
+	m := NewPendingQueueManager()
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1})
+	for i := 0; i < 50; i++ {
+		go func() {
+			time.Sleep(time.Millisecond)
+			m.Enqueue("c1", msg)
+		}()
+		start := time.Now()
+		msgs, _ := m.Poll("c1", 10*time.Second, 0, protocol.PollLimits{})
+		if elapsed := time.Since(start); elapsed > time.Second || len(msgs) != 1 {
+			t.Fatalf("poll %d returned %d messages after %v", i, len(msgs), elapsed)
+		}
+	}
+}
+
+// TestRemoveQueueWakesPoll verifies removing a queue releases its parked poll
+func TestRemoveQueueWakesPoll(t *testing.T) {
+	m := NewPendingQueueManager()
+	m.GetQueue("c1")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		m.RemoveQueue("c1")
+	}()
+	start := time.Now()
+	m.GetQueue("c1").Poll(10*time.Second, protocol.PollLimits{})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("poll held for %v after its queue was removed", elapsed)
+	}
+}
+
+func TestPollHintBackoff(t *testing.T) {
+	m := NewPendingQueueManager()
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1})
+	wait := 10 * time.Second
+
+	var hints []protocol.PollHint
+	for i := 0; i < 2*pollIdleThreshold; i++ {
+		_, hint := m.Poll("c1", 0, time.Minute, protocol.PollLimits{})
+		hints = append(hints, hint)
+	}
+	if hints[0].Backoff || hints[0].SuggestedWait != pollDefaultWait {
+		t.Errorf("first idle hint = %+v, want default wait without backoff", hints[0])
+	}
+	if h := hints[pollIdleThreshold-1]; !h.Backoff || h.SuggestedWait != time.Minute {
+		t.Errorf("hint after %d idle polls = %+v, want backoff capped at 1m", pollIdleThreshold, h)
+	}
+
+	// Activity resets to the requested wait
+	m.Enqueue("c1", msg)
+	if _, hint := m.Poll("c1", wait, 0, protocol.PollLimits{}); hint.Backoff || hint.SuggestedWait != wait {
+		t.Errorf("hint after a message = %+v, want %v without backoff", hint, wait)
+	}
+
+	// Idle polls double the wait, up to the default maximum
+	var hint protocol.PollHint
+	for i := 0; i < pollIdleThreshold; i++ {
+		_, hint = m.Poll("c1", 0, 0, protocol.PollLimits{})
+	}
+	if !hint.Backoff || hint.SuggestedWait != 2*pollDefaultWait {
+		t.Errorf("hint = %+v, want backoff to %v", hint, 2*pollDefaultWait)
+	}
+	for i := 0; i < 100; i++ {
+		_, hint = m.Poll("c1", 0, 0, protocol.PollLimits{})
+	}
+	if hint.SuggestedWait != pollDefaultMaxWait {
+		t.Errorf("hint = %v, want cap %v", hint.SuggestedWait, pollDefaultMaxWait)
+	}
+}
+
+// TestPollResponseHints verifies the hint reaches poll responses
+func TestPollResponseHints(t *testing.T) {
+	handler := protocol.NewHandler(config.DefaultConfig(), nil)
+	handler.SetPendingQueuer(NewPendingQueueManager())
+	poll, _ := protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{MaxWait: "45s"})
+	var resp *protocol.Response
+	for i := 0; i < pollIdleThreshold; i++ {
+		resp, _ = handler.HandleMessage("c1", poll)
+	}
+	data, _ := json.Marshal(resp)
+	var got struct {
+		SuggestedWaitMs int64 `json:"suggestedWaitMs"`
+		Backoff         bool  `json:"backoff"`
+	}
+	json.Unmarshal(data, &got)
+	if !got.Backoff || got.SuggestedWaitMs != 45000 {
+		t.Errorf("response %s, want backoff with suggestedWaitMs 45000", data)
+	}
+
+	bad, _ := protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{MaxWait: "soon"})
+	if resp, _ := handler.HandleMessage("c1", bad); resp == nil || resp.Error == "" {
+		t.Error("invalid maxWait accepted")
+	}
+}
+
+// TestPollLimits verifies polls return at once when messages are queued, stop
+// at maxMessages and maxBytes (always returning one), and flag what is left
+func TestPollLimits(t *testing.T) {
+	m := NewPendingQueueManager()
+	for i := 1; i <= 5; i++ {
+		msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: int64(i), Value: json.RawMessage(`"0123456789"`)})
+		m.Enqueue("c1", msg)
+	}
+	size := int(m.QueuedBytes() / 5)
+
+	start := time.Now()
+	msgs, hint := m.Poll("c1", 10*time.Second, 0, protocol.PollLimits{MaxMessages: 2})
+	if elapsed := time.Since(start); elapsed > time.Second || len(msgs) != 2 || !hint.More {
+		t.Fatalf("poll returned %d messages, more=%v after %v; want 2 with more at once", len(msgs), hint.More, elapsed)
+	}
+	if msgs, hint = m.Poll("c1", 0, 0, protocol.PollLimits{MaxBytes: 2*size - 1}); len(msgs) != 1 || !hint.More {
+		t.Errorf("byte-capped poll returned %d messages, more=%v; want 1 with more", len(msgs), hint.More)
+	}
+	if msgs, hint = m.Poll("c1", 0, 0, protocol.PollLimits{MaxBytes: 1}); len(msgs) != 1 || !hint.More {
+		t.Errorf("poll under a too-small cap returned %d messages, want 1", len(msgs))
+	}
+	if msgs, hint = m.Poll("c1", 0, 0, protocol.PollLimits{}); len(msgs) != 1 || hint.More {
+		t.Errorf("last poll returned %d messages, more=%v; want the last one without more", len(msgs), hint.More)
+	}
+	if n := m.QueuedBytes(); n != 0 {
+		t.Errorf("%d bytes still counted after the queue emptied", n)
+	}
+
+	// The flag reaches poll responses
+	handler := protocol.NewHandler(config.DefaultConfig(), nil)
+	handler.SetPendingQueuer(m)
+	m.Enqueue("c1", msgs[0])
+	m.Enqueue("c1", msgs[0])
+	poll, _ := protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{MaxMessages: 1})
+	if resp, _ := handler.HandleMessage("c1", poll); resp == nil || !resp.More {
+		t.Errorf("poll response %+v, want more", resp)
+	}
+}
+
+// TestMemoryPressureShortensPoll verifies parked polls are cut short once
+// queued bytes across connections exceed the memory limit
+func TestMemoryPressureShortensPoll(t *testing.T) {
+	m := NewPendingQueueManager()
+	m.SetMemoryLimit(100)
+	big, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1, Value: json.RawMessage(`"` + strings.Repeat("x", 200) + `"`)})
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Enqueue("c2", big)
+	}()
+	start := time.Now()
+	m.Poll("c1", time.Minute, 0, protocol.PollLimits{})
+	if elapsed := time.Since(start); elapsed < pollPressureWait || elapsed > pollPressureWait+time.Second {
+		t.Errorf("parked poll returned after %v, want about %v", elapsed, pollPressureWait)
+	}
+
+	// Draining the large queue ends the pressure
+	m.Poll("c2", 0, 0, protocol.PollLimits{})
+	start = time.Now()
+	m.Poll("c1", 1500*time.Millisecond, 0, protocol.PollLimits{})
+	if elapsed := time.Since(start); elapsed < 1400*time.Millisecond {
+		t.Errorf("poll without pressure returned after %v, want its full wait", elapsed)
+	}
+}
@@ -0,0 +1,198 @@
+// CRC: crc-Server.md
+// Spec: protocol.md
+package server
+
+import (
+	"encoding/json"
+	"maps"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// VariableRecord is the persisted state of one variable.
+type VariableRecord struct {
+	ID               int64             `json:"id"`
+	Value            json.RawMessage   `json:"value,omitempty"`
+	Properties       map[string]string `json:"properties,omitempty"`
+	RemoveProperties []string          `json:"removeProperties,omitempty"` // Properties the store should delete
+}
+
+// PersistentStore saves variable state for persistent sessions.
+// SaveVariables must write all records in one transaction: on error, none are assumed saved.
+type PersistentStore interface {
+	SaveVariables(sessionID string, records []VariableRecord) error
+}
+
+// PrefsStore is optionally implemented by a PersistentStore to save variable
+// browser preferences with the session.
+type PrefsStore interface {
+	SavePrefs(sessionID string, prefs json.RawMessage) error
+}
+
+// transientProperties are variable 1 delivery properties that are never persisted.
+var transientProperties = []string{"viewdefs", "viewdefMeta"}
+
+// writeThrough persists AfterBatch changes for sessions marked persistent.
+// Each AfterBatch becomes at most one store write. Records that fail to save
+// stay dirty and are retried, merged with newer changes, on the session's next batch.
+type writeThrough struct {
+	config     *config.Config
+	store      PersistentStore
+	metrics    *protocol.HandlerMetrics // nil when metrics are disabled
+	persistent map[string]bool          // vendedID -> persistent
+	dirty      map[string]map[int64]*VariableRecord
+	mu         sync.Mutex
+}
+
+func newWriteThrough(cfg *config.Config, store PersistentStore, metrics *protocol.HandlerMetrics) *writeThrough {
+	return &writeThrough{
+		config:     cfg,
+		store:      store,
+		metrics:    metrics,
+		persistent: make(map[string]bool),
+		dirty:      make(map[string]map[int64]*VariableRecord),
+	}
+}
+
+// setPersistent marks a session as persistent (or not).
+// Turning persistence off drops any unsaved changes.
+func (w *writeThrough) setPersistent(vendedID string, persistent bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if persistent {
+		w.persistent[vendedID] = true
+	} else {
+		delete(w.persistent, vendedID)
+		delete(w.dirty, vendedID)
+	}
+}
+
+// write merges a batch's updates into the session's dirty set and saves it.
+// Failures are logged and counted but never returned: delivery to watchers must not depend on storage.
+// Runs on the session's executor, so writes for one session never overlap; the lock is
+// not held while saving so a slow store only delays its own session.
+func (w *writeThrough) write(vendedID string, updates []lua.VariableUpdate) {
+	records := w.collect(vendedID, updates)
+	if len(records) == 0 {
+		return
+	}
+
+	if err := w.store.SaveVariables(vendedID, records); err != nil {
+		w.config.Log(0, "Warning: failed to persist %d variables for session %s (will retry): %v", len(records), vendedID, err)
+		w.count("persist.failed", 1)
+		return
+	}
+	w.mu.Lock()
+	delete(w.dirty, vendedID)
+	w.mu.Unlock()
+	w.count("persist.saved", int64(len(records)))
+}
+
+// collect merges updates into the session's dirty set and returns it sorted by ID.
+func (w *writeThrough) collect(vendedID string, updates []lua.VariableUpdate) []VariableRecord {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.persistent[vendedID] {
+		return nil
+	}
+	dirty := w.dirty[vendedID]
+	for _, update := range updates {
+		if dirty == nil {
+			dirty = make(map[int64]*VariableRecord)
+			w.dirty[vendedID] = dirty
+		}
+		rec := dirty[update.VarID]
+		if rec == nil {
+			rec = &VariableRecord{ID: update.VarID}
+			dirty[update.VarID] = rec
+		}
+		if update.Value != nil {
+			rec.Value = update.Value
+		}
+		for name, value := range update.Properties {
+			if rec.Properties == nil {
+				rec.Properties = make(map[string]string)
+			}
+			rec.Properties[name] = value
+			rec.RemoveProperties = slices.DeleteFunc(rec.RemoveProperties, func(n string) bool { return n == name })
+		}
+		for _, name := range update.Removed {
+			delete(rec.Properties, name)
+			if !slices.Contains(rec.RemoveProperties, name) {
+				rec.RemoveProperties = append(rec.RemoveProperties, name)
+			}
+		}
+		for _, name := range transientProperties {
+			delete(rec.Properties, name)
+			rec.RemoveProperties = slices.DeleteFunc(rec.RemoveProperties, func(n string) bool { return n == name })
+		}
+		if rec.Value == nil && len(rec.Properties) == 0 && len(rec.RemoveProperties) == 0 {
+			delete(dirty, update.VarID)
+		}
+	}
+
+	records := make([]VariableRecord, 0, len(dirty))
+	for _, rec := range dirty {
+		records = append(records, VariableRecord{ID: rec.ID, Value: rec.Value, Properties: maps.Clone(rec.Properties), RemoveProperties: slices.Clone(rec.RemoveProperties)})
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+	return records
+}
+
+// forget drops a destroyed session's state.
+func (w *writeThrough) forget(vendedID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n := len(w.dirty[vendedID]); n > 0 {
+		w.config.Log(0, "Warning: session %s destroyed with %d unsaved variables", vendedID, n)
+	}
+	delete(w.persistent, vendedID)
+	delete(w.dirty, vendedID)
+}
+
+// PrefsChanged saves a persistent session's variable browser preferences.
+// Implements PrefsObserver; a no-op if the store does not implement PrefsStore.
+func (w *writeThrough) PrefsChanged(vendedID string, prefs json.RawMessage) {
+	store, ok := w.store.(PrefsStore)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	persistent := w.persistent[vendedID]
+	w.mu.Unlock()
+	if !persistent {
+		return
+	}
+	if err := store.SavePrefs(vendedID, prefs); err != nil {
+		w.config.Log(0, "Warning: failed to persist browser preferences for session %s: %v", vendedID, err)
+		w.count("persist.failed", 1)
+	}
+}
+
+func (w *writeThrough) count(name string, n int64) {
+	if w.metrics != nil {
+		w.metrics.AddCount(name, n)
+	}
+}
+
+// SetPersistentStore enables write-through of tracker changes to store for persistent sessions.
+// Call before sessions are created.
+func (s *Server) SetPersistentStore(store PersistentStore) {
+	s.persist = newWriteThrough(s.config, store, s.handler.Metrics())
+	s.HttpEndpoint.SetPrefsObserver(s.persist)
+	s.loadViewdefUsage()
+}
+
+// SetSessionPersistent marks a session's variables for write-through persistence.
+// Has no effect unless a PersistentStore is set.
+func (s *Server) SetSessionPersistent(vendedID string, persistent bool) {
+	if s.persist != nil {
+		s.persist.setPersistent(vendedID, persistent)
+	}
+}
@@ -0,0 +1,102 @@
+// CRC: crc-Server.md
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// flakyStore fails every save while failing is set and records successful transactions
+type flakyStore struct {
+	failing bool
+	saves   [][]VariableRecord
+}
+
+func (f *flakyStore) SaveVariables(sessionID string, records []VariableRecord) error {
+	if f.failing {
+		return errors.New("storage unavailable")
+	}
+	f.saves = append(f.saves, records)
+	return nil
+}
+
+func TestWriteThroughRetriesDirtyRecords(t *testing.T) {
+	store := &flakyStore{}
+	metrics := protocol.NewHandlerMetrics()
+	w := newWriteThrough(config.DefaultConfig(), store, metrics)
+
+	// Non-persistent sessions are ignored
+	w.write("2", []lua.VariableUpdate{{VarID: 5, Value: json.RawMessage(`1`)}})
+	if len(store.saves) != 0 {
+		t.Fatalf("saved for non-persistent session: %v", store.saves)
+	}
+
+	w.setPersistent("1", true)
+	store.failing = true
+	w.write("1", []lua.VariableUpdate{
+		{VarID: 1, Properties: map[string]string{"viewdefs": "{}"}},
+		{VarID: 2, Value: json.RawMessage(`"a"`), Properties: map[string]string{"type": "Contact"}},
+	})
+	if len(store.saves) != 0 {
+		t.Fatal("failed save should not be recorded")
+	}
+
+	// Next batch retries the dirty record merged with new changes, in one transaction
+	store.failing = false
+	w.write("1", []lua.VariableUpdate{
+		{VarID: 2, Value: json.RawMessage(`"b"`)},
+		{VarID: 3, Value: json.RawMessage(`3`)},
+	})
+	if len(store.saves) != 1 {
+		t.Fatalf("saves = %d, want 1", len(store.saves))
+	}
+	got := store.saves[0]
+	if len(got) != 2 || got[0].ID != 2 || got[1].ID != 3 {
+		t.Fatalf("records = %+v, want variables 2 and 3 (transient variable 1 skipped)", got)
+	}
+	if string(got[0].Value) != `"b"` || got[0].Properties["type"] != "Contact" {
+		t.Errorf("merged record = %+v", got[0])
+	}
+
+	// Nothing dirty after a successful save
+	w.write("1", nil)
+	if len(store.saves) != 1 {
+		t.Errorf("clean session saved again")
+	}
+
+	counters := metrics.Snapshot().Counters
+	if counters["persist.failed"] != 1 || counters["persist.saved"] != 2 {
+		t.Errorf("counters = %v", counters)
+	}
+}
+
+// prefsStore is a flakyStore that also saves browser preferences
+type prefsStore struct {
+	flakyStore
+	prefs map[string]json.RawMessage
+}
+
+func (p *prefsStore) SavePrefs(sessionID string, prefs json.RawMessage) error {
+	p.prefs[sessionID] = prefs
+	return nil
+}
+
+func TestWriteThroughSavesPrefsForPersistentSessions(t *testing.T) {
+	store := &prefsStore{prefs: make(map[string]json.RawMessage)}
+	w := newWriteThrough(config.DefaultConfig(), store, nil)
+
+	w.PrefsChanged("2", json.RawMessage(`{"theme":"dark"}`))
+	if len(store.prefs) != 0 {
+		t.Fatalf("saved prefs for non-persistent session: %v", store.prefs)
+	}
+	w.setPersistent("1", true)
+	w.PrefsChanged("1", json.RawMessage(`{"theme":"dark"}`))
+	if string(store.prefs["1"]) != `{"theme":"dark"}` {
+		t.Errorf("prefs = %v", store.prefs)
+	}
+}
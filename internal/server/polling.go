@@ -0,0 +1,240 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Polling Connections)
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// errUnknownConnection is returned for a polling connection that never existed or has expired.
+var errUnknownConnection = errors.New("connection not found")
+
+// shutdownPollWait is the longest shutdown waits for polling connections to
+// collect their last messages.
+const shutdownPollWait = time.Second
+
+// pollConn is the state of a connection that receives messages by polling
+// instead of over a WebSocket, for clients behind proxies that block upgrades.
+type pollConn struct {
+	queue     *PendingResponseQueue
+	timeout   time.Duration
+	mu        sync.Mutex
+	idle      *time.Timer          // Expires the connection; stopped while a request is in flight (nil = never)
+	inFlight  int                  // Requests being handled
+	polled    time.Time            // When its last poll returned (zero = never polled)
+	responses []*protocol.Response // Answers for the batch request being handled
+}
+
+// send delivers messages to a connection: written to its WebSocket once its
+// batch window passes, or queued for its next poll.
+func (wc *wsConn) send(data []byte, msgs ...*protocol.Message) error {
+	if wc.poll == nil {
+		return wc.queue(data)
+	}
+	for _, msg := range msgs {
+		wc.poll.queue.Enqueue(msg)
+	}
+	return nil
+}
+
+// respond keeps a response for the batch request being handled.
+func (pc *pollConn) respond(resp *protocol.Response) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.responses = append(pc.responses, resp)
+}
+
+// markPolled records that a poll returned.
+func (pc *pollConn) markPolled() {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.polled = time.Now()
+}
+
+// awaitPolls waits until polling connections whose clients are polling have
+// collected their queued messages, for at most wait or until ctx ends.
+func (ws *WebSocketEndpoint) awaitPolls(ctx context.Context, wait time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for ws.pollsPending() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pollsPending reports whether a polling connection with a poll in flight, or
+// one that returned within shutdownPollWait, has messages queued. Clients that
+// stopped polling are not waited for.
+func (ws *WebSocketEndpoint) pollsPending() bool {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	for _, wc := range ws.connections {
+		pc := wc.poll
+		if pc == nil || pc.queue.IsEmpty() {
+			continue
+		}
+		pc.mu.Lock()
+		polling := pc.inFlight > 0 || (!pc.polled.IsZero() && time.Since(pc.polled) < shutdownPollWait)
+		pc.mu.Unlock()
+		if polling {
+			return true
+		}
+	}
+	return false
+}
+
+// SetPendingQueues enables polling connections, which receive messages through these queues.
+func (ws *WebSocketEndpoint) SetPendingQueues(pending *PendingQueueManager) {
+	ws.pending = pending
+}
+
+// ConnectPolling opens a polling connection to a session. It is registered
+// like a WebSocket connection, so watches and updates route to it the same
+// way, and it expires after session.poll_timeout without a request.
+func (ws *WebSocketEndpoint) ConnectPolling(sessionID string) (string, error) {
+	return ws.connectPolling(sessionID, ws.config.Session.PollTimeout.Duration())
+}
+
+// connectPolling opens a polling connection that expires after timeout
+// without a request (0 = never).
+func (ws *WebSocketEndpoint) connectPolling(sessionID string, timeout time.Duration) (string, error) {
+	if ws.pending == nil {
+		return "", errors.New("polling not available")
+	}
+	connectionID := generatePollConnectionID()
+	pc := &pollConn{queue: ws.pending.GetQueue(connectionID), timeout: timeout}
+	if pc.timeout > 0 {
+		pc.idle = time.AfterFunc(pc.timeout, func() { ws.expirePoll(connectionID) })
+	}
+	ws.register(connectionID, sessionID, &wsConn{poll: pc})
+	return connectionID, nil
+}
+
+// HandlePolled handles one message from a polling connection. Polls and
+// flushes wait, so they run off the session executor; anything else runs on it
+// like a WebSocket message, followed by change detection. A message rejected
+// during a reload returns errReloading.
+func (ws *WebSocketEndpoint) HandlePolled(connectionID string, msg *protocol.Message) (*protocol.Response, error) {
+	pc, sessionID, err := ws.beginPoll(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.endPoll(pc)
+	if msg.Type == protocol.MsgPoll {
+		defer pc.markPolled()
+	}
+	if msg.Type == protocol.MsgPoll || msg.Type == protocol.MsgFlush {
+		return ws.handler.HandleMessage(connectionID, msg)
+	}
+	var resp *protocol.Response
+	ws.queueSync(sessionID, func() {
+		resp, err = ws.handler.HandleMessage(connectionID, msg)
+		if ws.afterBatch != nil {
+			ws.afterBatch(sessionID, true)
+		}
+	}, func(e error) { err = e })
+	return resp, err
+}
+
+// HandlePolledBatch handles a frame a WebSocket client would send (a message,
+// an array, or a batch wrapper) from a polling connection. It returns the
+// responses the frame would have sent back, such as errors and getRoots answers.
+func (ws *WebSocketEndpoint) HandlePolledBatch(connectionID string, frame []byte) ([]*protocol.Response, error) {
+	pc, sessionID, err := ws.beginPoll(connectionID)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.endPoll(pc)
+	ws.queueSync(sessionID, func() {
+		ws.processMessage(connectionID, sessionID, frame)
+	}, ws.rejectMessage(connectionID))
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	responses := pc.responses
+	pc.responses = nil
+	return responses, nil
+}
+
+// queueSync runs interactive code on a session's executor and waits for it,
+// or for its rejection during a reload.
+func (ws *WebSocketEndpoint) queueSync(sessionID string, code func(), reject func(error)) {
+	done := make(chan struct{})
+	ws.submit(sessionID, OpInteractive, func() {
+		defer close(done)
+		code()
+	}, func(err error) {
+		defer close(done)
+		reject(err)
+	})
+	<-done
+}
+
+// beginPoll looks up a polling connection for a request and holds off its expiry.
+func (ws *WebSocketEndpoint) beginPoll(connectionID string) (*pollConn, string, error) {
+	ws.mu.RLock()
+	wc := ws.connections[connectionID]
+	sessionID := ws.sessionBindings[connectionID]
+	ws.mu.RUnlock()
+	if wc == nil || wc.poll == nil {
+		return nil, "", errUnknownConnection
+	}
+	pc := wc.poll
+	pc.mu.Lock()
+	pc.inFlight++
+	if pc.idle != nil {
+		pc.idle.Stop()
+	}
+	pc.mu.Unlock()
+	if sess := ws.getSession(sessionID); sess != nil {
+		sess.Touch()
+	}
+	return pc, sessionID, nil
+}
+
+// endPoll restarts a polling connection's expiry once it has no requests in flight.
+func (ws *WebSocketEndpoint) endPoll(pc *pollConn) {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	pc.inFlight--
+	if pc.inFlight == 0 && pc.idle != nil {
+		pc.idle.Reset(pc.timeout)
+	}
+}
+
+// expirePoll disconnects an idle polling connection.
+func (ws *WebSocketEndpoint) expirePoll(connectionID string) {
+	ws.mu.RLock()
+	wc := ws.connections[connectionID]
+	ws.mu.RUnlock()
+	if wc == nil || wc.poll == nil {
+		return
+	}
+	wc.poll.mu.Lock()
+	busy := wc.poll.inFlight > 0
+	wc.poll.mu.Unlock()
+	if busy {
+		// A request arrived as the timer fired
+		return
+	}
+	ws.Log(1, "Polling connection expired: conn=%s", connectionID)
+	ws.onDisconnect(connectionID)
+	ws.pending.RemoveQueue(connectionID)
+}
+
+func generatePollConnectionID() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return "poll-" + hex.EncodeToString(bytes)
+}
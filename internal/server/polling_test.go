@@ -0,0 +1,111 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Polling Connections)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestPollingConnection runs a create/watch/update session over a polling
+// connection with no WebSocket, then lets the connection expire
+func TestPollingConnection(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Session.PollTimeout = config.Duration(300 * time.Millisecond)
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+	call := func(path, body string) protocol.Response {
+		t.Helper()
+		w := post(path, body)
+		var resp protocol.Response
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != 200 || resp.Error != "" {
+			t.Fatalf("%s returned %d: %s", path, w.Code, w.Body)
+		}
+		return resp
+	}
+
+	conn := call("/"+sess.ID+"/connect", "").Result.(map[string]any)["connection"].(string)
+	if s.sessions.Get(sess.ID).GetConnectionCount() != 1 {
+		t.Fatal("polling connection not registered on the session")
+	}
+	api := func(msgType string) string { return "/api/" + msgType + "?conn=" + conn }
+
+	// poll waits for an update to varID and returns its value
+	poll := func(varID int64) string {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			raw, _ := json.Marshal(call(api("poll"), `{"data":{"wait":"500ms"}}`).Result)
+			var msgs []protocol.Message
+			json.Unmarshal(raw, &msgs)
+			for _, msg := range msgs {
+				var update protocol.UpdateMessage
+				if msg.Type == protocol.MsgUpdate && json.Unmarshal(msg.Data, &update) == nil && update.VarID == varID && update.Value != nil {
+					return string(update.Value)
+				}
+			}
+		}
+		t.Fatalf("no update for variable %d", varID)
+		return ""
+	}
+
+	call(api("watch"), `{"data":{"varId":1}}`)
+	call(api("create"), `{"data":{"id":2,"parentId":1,"properties":{"path":"name"}}}`)
+	if value := poll(2); value != `"alice"` {
+		t.Errorf("variable 2 = %s, want alice", value)
+	}
+
+	call(api("update"), `{"data":{"varId":2,"value":"bob"}}`)
+	if name, err := s.GetLuaSession(vendedID).LoadCode("name", `return app.name`); err != nil || name != "bob" {
+		t.Errorf("app.name = %v (%v), want bob", name, err)
+	}
+
+	// Backend changes reach the poller like a WebSocket client
+	s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return s.GetLuaSession(vendedID).LoadCodeDirect("rename", `app.name = "carol"`)
+	})
+	if value := poll(2); value != `"carol"` {
+		t.Errorf("variable 2 = %s, want carol", value)
+	}
+
+	// WebSocket frames posted to /api/batch answer with their responses
+	w := post(api("batch"), `{"messages":[{"type":"getRoots","data":{}}],"userEvent":true}`)
+	if !strings.Contains(w.Body.String(), `"roots":{"app":1}`) {
+		t.Errorf("batch answered %d %s, want the roots", w.Code, w.Body)
+	}
+
+	time.Sleep(600 * time.Millisecond)
+	if w := post(api("poll"), `{}`); w.Code != 404 {
+		t.Errorf("expired connection polled with %d, want 404", w.Code)
+	}
+	if n := s.sessions.Get(sess.ID).GetConnectionCount(); n != 0 {
+		t.Errorf("session has %d connections after expiry, want 0", n)
+	}
+}
@@ -0,0 +1,98 @@
+// CRC: crc-LuaSession.md
+// Spec: libraries.md (Presenting Plain Data)
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestPresentLazyAndRediff verifies session:present creates eager presenters at
+// once, lazy ones on their parent's first watch, and that presenting again with
+// a changed spec keeps, retypes, and removes presenters instead of rebuilding
+func TestPresentLazyAndRediff(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Contact = session:prototype("Contact", {name = EMPTY})
+		Card = session:prototype("Card", {name = EMPTY})
+		Detail = session:prototype("Detail", {})
+		Address = session:prototype("Address", {city = EMPTY})
+		app = {
+			contacts = {{name = "ann"}, {name = "bob"}},
+			detail = {address = {city = "Oslo"}},
+		}
+		session:createAppVariable(app)
+		assert(session:present(app, {
+			contacts = {itemType = "Contact"},
+			detail = {type = "Detail", lazy = true},
+			["detail.address"] = "Address",
+		}) == app)
+		assert(getmetatable(app.contacts[2]) == Contact)
+		assert(getmetatable(app.detail) == nil, "lazy presenter instantiated early")
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracker := sess.GetBackend().GetTracker()
+	children := func(id int64) map[string]*changetracker.Variable {
+		byType := make(map[string]*changetracker.Variable)
+		for _, v := range tracker.Children(id) {
+			byType[v.Properties["type"]] = v
+		}
+		return byType
+	}
+	top := children(1)
+	contacts := top[""]
+	if contacts == nil || len(top) != 1 {
+		t.Fatalf("before watch, variable 1 children = %v, want only contacts", top)
+	}
+
+	// Watching variable 1 creates the lazy detail and its eager address
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	msg, _ := protocol.NewMessage(protocol.MsgWatch, protocol.WatchMessage{VarID: 1})
+	if _, err := h.HandleMessage("c1", msg); err != nil {
+		t.Fatal(err)
+	}
+	detail := children(1)["Detail"]
+	if detail == nil {
+		t.Fatalf("after watch, variable 1 children = %v", children(1))
+	}
+	if address := children(detail.ID)["Address"]; address == nil {
+		t.Fatalf("detail children = %v, want Address", children(detail.ID))
+	}
+
+	// Re-present: contacts retyped in place, detail retyped, address removed
+	if _, err := s.GetLuaSession(vendedID).LoadCode("rediff", `
+		session:present(app, {
+			contacts = {itemType = "Card"},
+			detail = {type = "Card", lazy = true},
+		})
+		assert(getmetatable(app.contacts[1]) == Card)
+	`); err != nil {
+		t.Fatal(err)
+	}
+	top = children(1)
+	if top[""] != contacts {
+		t.Errorf("contacts variable was rebuilt")
+	}
+	if top["Card"] != detail {
+		t.Errorf("detail was not retyped in place: %v", top)
+	}
+	if len(tracker.Children(detail.ID)) != 0 || tracker.GetVariable(-3) != nil {
+		t.Errorf("address presenter was not destroyed")
+	}
+}
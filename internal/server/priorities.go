@@ -0,0 +1,93 @@
+// CRC: crc-MessageBatcher.md
+// Spec: protocol.md (Priority Rules)
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// typeSettings is one entry of types.json's properties or types section.
+type typeSettings struct {
+	Priority string `json:"priority"`
+	// Properties a type's variables may carry in strict mode (types section only)
+	Properties []string `json:"properties,omitempty"`
+}
+
+// typesFile is the site's types.json.
+type typesFile struct {
+	Properties map[string]typeSettings `json:"properties"`
+	Types      map[string]typeSettings `json:"types"`
+}
+
+// readTypesFile reads the site's types.json.
+// Returns nil when the file is missing or invalid.
+func readTypesFile(cfg *config.Config) *typesFile {
+	var data []byte
+	var err error
+	if cfg.Server.Dir != "" {
+		data, err = os.ReadFile(filepath.Join(cfg.Server.Dir, "types.json"))
+	} else if bundled, _ := bundle.IsBundled(); bundled {
+		data, err = bundle.ReadFile("types.json")
+	}
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	var file typesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		cfg.Log(0, "Warning: invalid types.json: %v", err)
+		return nil
+	}
+	return &file
+}
+
+// loadPriorityRules reads the global priority rules from the site's types.json.
+// Returns nil when the file is missing or invalid.
+func loadPriorityRules(cfg *config.Config) *protocol.PriorityRules {
+	file := readTypesFile(cfg)
+	if file == nil {
+		return nil
+	}
+	rules := protocol.NewPriorityRules()
+	add := func(kind string, entries map[string]typeSettings, set func(string, protocol.Priority)) {
+		for name, settings := range entries {
+			if settings.Priority == "" {
+				continue
+			}
+			priority, err := protocol.ParsePriority(settings.Priority)
+			if err != nil {
+				cfg.Log(0, "Warning: types.json %s %s: %v", kind, name, err)
+				continue
+			}
+			set(name, priority)
+		}
+	}
+	add("property", file.Properties, rules.SetProperty)
+	add("type", file.Types, rules.SetType)
+	return rules
+}
+
+// loadPropertyAllowlist builds strict mode's property allowlist from types.json:
+// properties named in the properties section are allowed on every type, and a
+// type's properties list is allowed on that type.
+func loadPropertyAllowlist(cfg *config.Config) *protocol.PropertyAllowlist {
+	allowlist := protocol.NewPropertyAllowlist()
+	file := readTypesFile(cfg)
+	if file == nil {
+		return allowlist
+	}
+	for name := range file.Properties {
+		allowlist.Allow(name)
+	}
+	for typ, settings := range file.Types {
+		for _, name := range settings.Properties {
+			allowlist.AllowForType(typ, name)
+		}
+	}
+	return allowlist
+}
@@ -0,0 +1,160 @@
+// CRC: crc-MessageBatcher.md
+// Spec: protocol.md (Priority Rules)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestPriorityRulesPrecedence verifies suffixes beat session rules, which beat
+// types.json rules, when AfterBatch orders a batch's updates
+func TestPriorityRulesPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		session:createAppVariable(app)
+		ui.priority{property = "status", priority = "high"}
+		ui.priority{property = "label", priority = "high"}
+	`), 0644)
+	os.WriteFile(filepath.Join(dir, "types.json"), []byte(`{
+		"properties": {
+			"status": {"priority": "low"},
+			"note": {"priority": "high"},
+			"hint": {"priority": "low"}
+		}
+	}`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msgType, err, resp)
+		}
+	}
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name"}})
+	luaSession.AfterBatch(vendedID)
+	send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Properties: map[string]string{
+		"status":       "s", // session high beats global low
+		"note":         "n", // global high
+		"hint":         "h", // global low
+		"label:medium": "l", // suffix beats session high
+		"title":        "t", // no rule
+	}})
+
+	// Record the position of the update that carried each property
+	position := make(map[string]int)
+	for i, update := range luaSession.AfterBatch(vendedID) {
+		if update.VarID != 2 {
+			continue
+		}
+		for name := range update.Properties {
+			position[name] = i
+		}
+	}
+	for _, name := range []string{"status", "note", "hint", "label", "title"} {
+		if _, ok := position[name]; !ok {
+			t.Fatalf("property %s not sent: %v", name, position)
+		}
+	}
+	if position["status"] != position["note"] {
+		t.Errorf("status and note should both be high: %v", position)
+	}
+	if position["label"] != position["title"] || position["label"] <= position["status"] {
+		t.Errorf("label:medium should stay medium despite the session rule: %v", position)
+	}
+	if position["hint"] <= position["label"] {
+		t.Errorf("hint should be low, after medium properties: %v", position)
+	}
+}
+
+// TestViewdefsSentBeforeValues verifies a polling client gets the viewdefs for
+// a new type in an earlier frame than the value that first uses the type, even
+// when a priority rule makes the value high priority
+func TestViewdefsSentBeforeValues(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.MkdirAll(filepath.Join(dir, "viewdefs"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Contact = session:prototype("Contact", {name = EMPTY})
+		app = {}
+		session:createAppVariable(app)
+		ui.priority{type = "Contact", priority = "high"}
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := s.wsEndpoint.ConnectPolling(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []struct {
+		typ  protocol.MessageType
+		data any
+	}{
+		{protocol.MsgWatch, protocol.WatchMessage{VarID: 1}},
+		{protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "contact"}}},
+	} {
+		m, _ := protocol.NewMessage(msg.typ, msg.data)
+		if resp, err := s.wsEndpoint.HandlePolled(conn, m); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msg.typ, err, resp)
+		}
+	}
+	queue := s.wsEndpoint.pending.GetQueue(conn)
+	queue.Poll(time.Second, protocol.PollLimits{})
+
+	// Contact's viewdef is found on disk the first time a Contact appears
+	os.WriteFile(filepath.Join(dir, "viewdefs", "Contact.DEFAULT.html"), []byte(`<template><div></div></template>`), 0644)
+	s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return s.GetLuaSession(vendedID).LoadCodeDirect("contact", `app.contact = session:create(Contact, {name = "ann"})`)
+	})
+	viewdefSeq, valueSeq := -1, -1
+	var seq int
+	for deadline := time.Now().Add(2 * time.Second); valueSeq < 0 && time.Now().Before(deadline); {
+		msgs, _ := queue.Poll(500*time.Millisecond, protocol.PollLimits{})
+		for _, msg := range msgs {
+			var update protocol.UpdateMessage
+			if msg.Type == protocol.MsgUpdate && json.Unmarshal(msg.Data, &update) == nil {
+				switch {
+				case update.VarID == 1 && update.Properties["viewdefs"] != "" && viewdefSeq < 0:
+					viewdefSeq = seq
+				case update.VarID == 2 && update.Value != nil && valueSeq < 0:
+					valueSeq = seq
+				}
+			}
+			seq++
+		}
+	}
+	if viewdefSeq < 0 || valueSeq < 0 {
+		t.Fatalf("missing updates: viewdefs at %d, value at %d", viewdefSeq, valueSeq)
+	}
+	if viewdefSeq > valueSeq {
+		t.Errorf("viewdefs sent in frame %d, after the value in frame %d", viewdefSeq, valueSeq)
+	}
+}
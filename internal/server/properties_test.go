@@ -0,0 +1,139 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Variable Protocol Messages)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestPropertyRemoval verifies an empty property value is stored rather than
+// removed, that removeProperties deletes a property and tells its watchers, and
+// that a removed property can be set again
+func TestPropertyRemoval(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	b := sess.GetBackend()
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{b})
+	h.SetPathVariableHandler(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msgType, err, resp)
+		}
+	}
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name"}})
+	b.Watch(2, "c2")
+	luaSession.AfterBatch(vendedID)
+
+	// deliver returns the update c2 gets for variable 2, if any
+	deliver := func() *protocol.UpdateMessage {
+		t.Helper()
+		sender := &mockSender{}
+		s.deliverUpdates(vendedID, b, NewOutgoingBatcher(sender), luaSession.AfterBatch(vendedID), true)
+		for i, msg := range sender.messages {
+			var update protocol.UpdateMessage
+			if sender.connIDs[i] == "c2" && json.Unmarshal(msg.Data, &update) == nil && update.VarID == 2 {
+				return &update
+			}
+		}
+		return nil
+	}
+	label := func() (string, bool) {
+		val, ok := b.GetTracker().GetVariable(2).Properties["label"]
+		return val, ok
+	}
+	update := func(props map[string]string, remove ...string) {
+		t.Helper()
+		send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Properties: props, RemoveProperties: remove})
+	}
+
+	for _, value := range []string{"", "first", "second"} {
+		update(map[string]string{"label": value})
+		if val, ok := label(); !ok || val != value {
+			t.Fatalf("after set %q, label = %q, %v", value, val, ok)
+		}
+		if got := deliver(); got == nil || !reflect.DeepEqual(got.Properties, map[string]string{"label": value}) || got.RemoveProperties != nil {
+			t.Errorf("set %q: watcher got %+v", value, got)
+		}
+
+		update(nil, "label")
+		if _, ok := label(); ok {
+			t.Fatalf("label still present after removing %q", value)
+		}
+		if got := deliver(); got == nil || got.Properties != nil || !reflect.DeepEqual(got.RemoveProperties, []string{"label"}) {
+			t.Errorf("remove %q: watcher got %+v", value, got)
+		}
+	}
+
+	// Removing an absent property changes nothing
+	update(nil, "label")
+	if got := deliver(); got != nil {
+		t.Errorf("removing an absent property sent %+v", got)
+	}
+
+	// inactive is set by any value and cleared only by removal
+	update(map[string]string{"inactive": ""})
+	if !b.IsInactive(2) {
+		t.Errorf(`inactive="" did not deactivate the variable`)
+	}
+	update(nil, "inactive")
+	if b.IsInactive(2) {
+		t.Errorf("removing inactive did not reactivate the variable")
+	}
+}
+
+// TestLuaPropertyLimits verifies properties Lua sets over the limits or with
+// invalid UTF-8 are dropped rather than failing main.lua
+func TestLuaPropertyLimits(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		session:createAppVariable(app, {ok = "fine", big = string.rep("x", 256 * 1024 + 1), bad = "a\255b"})
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, _, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := sess.GetBackend().GetTracker().GetVariable(1)
+	if v == nil {
+		t.Fatal("main.lua did not create variable 1")
+	}
+	if v.Properties["ok"] != "fine" {
+		t.Errorf("valid property = %q, want fine", v.Properties["ok"])
+	}
+	for _, name := range []string{"big", "bad"} {
+		if _, ok := v.Properties[name]; ok {
+			t.Errorf("property %s was kept", name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Property Limits)
+package server
+
+import (
+	"maps"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// limitProperties applies the session.properties limits to properties Lua
+// sets on a new variable. Violations are logged, not returned, so an app bug
+// does not fail the flow: invalid UTF-8 is replaced or the value dropped,
+// values over the size limit are dropped, and the largest values are dropped
+// until the total fits.
+func (a *luaTrackerAdapter) limitProperties(sessionID string, properties map[string]string) map[string]string {
+	limits := a.config.Session.Properties
+	replace := limits.InvalidUTF8 == config.InvalidUTF8Replace
+	if protocol.CheckProperties(limits, properties, nil, nil) == nil && !(replace && hasInvalidUTF8(properties)) {
+		return properties
+	}
+	kept := maps.Clone(properties)
+	if replace && protocol.ReplaceInvalidUTF8(kept) {
+		a.config.Log(1, "Session %s: replaced invalid UTF-8 in properties set from Lua", sessionID)
+	}
+	for _, name := range slices.Sorted(maps.Keys(kept)) {
+		if err := protocol.CheckProperty(limits, name, kept[name]); err != nil {
+			a.config.Log(0, "Session %s: dropped a property set from Lua: %v", sessionID, err)
+			delete(kept, name)
+		}
+	}
+	for {
+		err := protocol.CheckProperties(limits, kept, nil, nil)
+		if err == nil {
+			return kept
+		}
+		largest := ""
+		for _, name := range slices.Sorted(maps.Keys(kept)) {
+			if name != "viewdefs" && (largest == "" || len(kept[name]) > len(kept[largest])) {
+				largest = name
+			}
+		}
+		if largest == "" {
+			return kept
+		}
+		a.config.Log(0, "Session %s: dropped property %q set from Lua: %v", sessionID, largest, err)
+		delete(kept, largest)
+	}
+}
+
+func hasInvalidUTF8(properties map[string]string) bool {
+	for _, value := range properties {
+		if !utf8.ValidString(value) {
+			return true
+		}
+	}
+	return false
+}
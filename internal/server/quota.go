@@ -0,0 +1,111 @@
+// CRC: crc-Session.md
+// Spec: deployment.md
+package server
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// QuotaKind names a per-session transfer quota.
+type QuotaKind string
+
+const (
+	QuotaUpload   QuotaKind = "upload"   // Bytes received from the browser
+	QuotaDownload QuotaKind = "download" // Bytes generated for the browser to download
+	QuotaFetch    QuotaKind = "fetch"    // Bytes read from outbound fetches
+)
+
+// QuotaExceededCode is the error code for operations refused by a quota.
+const QuotaExceededCode = "QUOTA_EXCEEDED"
+
+// QuotaExceededError reports that an operation would pass a session's quota.
+type QuotaExceededError struct {
+	Kind  QuotaKind
+	Limit int64
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s: %s quota of %d bytes exceeded", QuotaExceededCode, e.Kind, e.Limit)
+}
+
+// sessionQuota holds a session's usage for the current quota window.
+type sessionQuota struct {
+	used        map[QuotaKind]int64
+	windowStart time.Time
+}
+
+// quotaLimit returns the configured limit for kind (0 = unlimited).
+func quotaLimit(limits config.QuotaConfig, kind QuotaKind) int64 {
+	switch kind {
+	case QuotaUpload:
+		return limits.UploadBytes
+	case QuotaDownload:
+		return limits.DownloadBytes
+	case QuotaFetch:
+		return limits.FetchBytes
+	}
+	return 0
+}
+
+// ChargeQuota records n bytes against the session's kind quota.
+// Fails with a *QuotaExceededError, without recording, if that would pass the limit.
+func (s *Session) ChargeQuota(limits config.QuotaConfig, kind QuotaKind, n int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetQuotaLocked(limits)
+	limit := quotaLimit(limits, kind)
+	if limit > 0 && s.quota.used[kind]+n > limit {
+		return &QuotaExceededError{Kind: kind, Limit: limit}
+	}
+	s.quota.used[kind] += n
+	return nil
+}
+
+// QuotaUsage returns the bytes used per quota in the current window.
+func (s *Session) QuotaUsage(limits config.QuotaConfig) map[QuotaKind]int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resetQuotaLocked(limits)
+	return map[QuotaKind]int64{
+		QuotaUpload:   s.quota.used[QuotaUpload],
+		QuotaDownload: s.quota.used[QuotaDownload],
+		QuotaFetch:    s.quota.used[QuotaFetch],
+	}
+}
+
+// resetQuotaLocked starts a new quota window when the reset interval has passed.
+func (s *Session) resetQuotaLocked(limits config.QuotaConfig) {
+	now := time.Now()
+	reset := time.Duration(limits.Reset)
+	if s.quota.used == nil || (reset > 0 && now.Sub(s.quota.windowStart) >= reset) {
+		s.quota = sessionQuota{used: make(map[QuotaKind]int64), windowStart: now}
+	}
+}
+
+// QuotaReader wraps a stream so each read is charged to the session's kind quota.
+// Reads fail with a *QuotaExceededError once the stream would pass the limit,
+// so enforcement points abort mid-stream instead of after buffering everything.
+func (s *Session) QuotaReader(limits config.QuotaConfig, kind QuotaKind, r io.Reader) io.Reader {
+	return &quotaReader{session: s, limits: limits, kind: kind, r: r}
+}
+
+type quotaReader struct {
+	session *Session
+	limits  config.QuotaConfig
+	kind    QuotaKind
+	r       io.Reader
+}
+
+func (q *quotaReader) Read(p []byte) (int, error) {
+	n, err := q.r.Read(p)
+	if n > 0 {
+		if qerr := q.session.ChargeQuota(q.limits, q.kind, int64(n)); qerr != nil {
+			return 0, qerr
+		}
+	}
+	return n, err
+}
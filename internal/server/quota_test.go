@@ -0,0 +1,53 @@
+// CRC: crc-Session.md
+package server
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestSessionQuota verifies limits, per-kind accounting and window reset
+func TestSessionQuota(t *testing.T) {
+	sess := NewSession("s")
+	limits := config.QuotaConfig{UploadBytes: 100, Reset: config.Duration(50 * time.Millisecond)}
+
+	if err := sess.ChargeQuota(limits, QuotaUpload, 80); err != nil {
+		t.Fatalf("charge within limit: %v", err)
+	}
+	var exceeded *QuotaExceededError
+	if err := sess.ChargeQuota(limits, QuotaUpload, 30); !errors.As(err, &exceeded) || exceeded.Kind != QuotaUpload {
+		t.Errorf("charge past limit = %v", err)
+	}
+	if err := sess.ChargeQuota(limits, QuotaFetch, 1000); err != nil {
+		t.Errorf("unlimited quota refused: %v", err)
+	}
+	if usage := sess.QuotaUsage(limits); usage[QuotaUpload] != 80 || usage[QuotaFetch] != 1000 {
+		t.Errorf("usage = %v", usage)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if usage := sess.QuotaUsage(limits); usage[QuotaUpload] != 0 {
+		t.Errorf("usage after reset = %v", usage)
+	}
+}
+
+// TestQuotaReaderAbortsMidStream verifies streams are cut off once they pass the quota
+func TestQuotaReaderAbortsMidStream(t *testing.T) {
+	sess := NewSession("s")
+	limits := config.QuotaConfig{FetchBytes: 1000}
+	r := sess.QuotaReader(limits, QuotaFetch, io.LimitReader(strings.NewReader(strings.Repeat("x", 5000)), 5000))
+
+	n, err := io.Copy(io.Discard, r)
+	var exceeded *QuotaExceededError
+	if !errors.As(err, &exceeded) || n > 1000 {
+		t.Errorf("copied %d bytes, err %v; want abort at 1000", n, err)
+	}
+	if !strings.Contains(err.Error(), QuotaExceededCode) {
+		t.Errorf("error %q lacks %s", err, QuotaExceededCode)
+	}
+}
@@ -0,0 +1,40 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Readiness)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Readiness is the body of GET /readyz.
+type Readiness struct {
+	Ready    bool `json:"ready"`
+	Draining bool `json:"draining,omitempty"`
+	// LuaSourceUnavailableSince is set while the lua directory is gone and
+	// sessions run on cached code; the server stays ready.
+	LuaSourceUnavailableSince *time.Time `json:"luaSourceUnavailableSince,omitempty"`
+}
+
+// Readiness reports whether the server is taking new sessions, and why not.
+func (s *Server) Readiness() Readiness {
+	r := Readiness{Draining: s.retry.Draining()}
+	r.Ready = !r.Draining
+	if s.luaConfig != nil {
+		if since := s.luaConfig.sources.UnavailableSince(); !since.IsZero() {
+			r.LuaSourceUnavailableSince = &since
+		}
+	}
+	return r
+}
+
+// handleReadiness serves GET /readyz: 200 when ready, 503 while draining.
+func (s *Server) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := s.Readiness()
+	w.Header().Set("Content-Type", "application/json")
+	if !readiness.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(readiness)
+}
@@ -0,0 +1,66 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestLuaSourceUnavailable verifies new sessions run cached main.lua and modules
+// after the lua directory disappears, and readiness reports it
+func TestLuaSourceUnavailable(t *testing.T) {
+	dir := t.TempDir()
+	luaDir := filepath.Join(dir, "lua")
+	os.MkdirAll(luaDir, 0755)
+	os.WriteFile(filepath.Join(luaDir, "helper.lua"), []byte(`return {n = 7}`), 0644)
+	os.WriteFile(filepath.Join(luaDir, "main.lua"), []byte(`
+		local helper = require("helper")
+		session:createAppVariable({count = helper.n})
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	readiness := func() Readiness {
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/readyz", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /readyz = %d", w.Code)
+		}
+		var r Readiness
+		json.NewDecoder(w.Body).Decode(&r)
+		return r
+	}
+
+	if _, _, err := s.sessions.CreateSession(); err != nil {
+		t.Fatal(err)
+	}
+	if r := readiness(); !r.Ready || r.LuaSourceUnavailableSince != nil {
+		t.Fatalf("readiness before = %+v", r)
+	}
+
+	// The mount drops
+	if err := os.Rename(luaDir, luaDir+".gone"); err != nil {
+		t.Fatal(err)
+	}
+	_, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatalf("session after the lua directory disappeared: %v", err)
+	}
+	n, err := s.GetLuaSession(vendedID).LoadCode("check", `return require("helper").n`)
+	if err != nil || n != float64(7) {
+		t.Errorf("cached module = %v, %v; want 7", n, err)
+	}
+	if r := readiness(); !r.Ready || r.LuaSourceUnavailableSince == nil {
+		t.Errorf("readiness while unavailable = %+v", r)
+	}
+}
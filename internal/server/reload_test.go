@@ -0,0 +1,107 @@
+// CRC: crc-LuaHotLoader.md
+// Spec: main.md (Hot-Loading System)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestReloadSession verifies ReloadSession re-runs main.lua keeping the app
+// variable, calls session:onReload, pushes the changes, and leaves the
+// session working when main.lua fails
+func TestReloadSession(t *testing.T) {
+	dir := t.TempDir()
+	mainPath := filepath.Join(dir, "lua", "main.lua")
+	os.MkdirAll(filepath.Dir(mainPath), 0755)
+	writeMain := func(body string) {
+		t.Helper()
+		if err := os.WriteFile(mainPath, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeMain(`
+		if not session:getApp() then
+			app = {count = 1, label = "v1"}
+			session:createAppVariable(app)
+		end
+	`)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	h, err := s.CreateHeadlessSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	h.Flush()
+	create, _ := protocol.NewMessage(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "label"}})
+	if _, err := h.Send(create); err != nil {
+		t.Fatal(err)
+	}
+	h.Flush()
+	h.Poll()
+	if _, err := h.Run("step", `app.count = 2`); err != nil {
+		t.Fatal(err)
+	}
+	h.Flush()
+	h.Poll()
+
+	state := func() map[string]any {
+		t.Helper()
+		data, err := h.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var app map[string]any
+		if err := json.Unmarshal(data, &app); err != nil {
+			t.Fatal(err)
+		}
+		return app
+	}
+
+	writeMain(`
+		if not session:getApp() then
+			app = {count = 1, label = "v1"}
+			session:createAppVariable(app)
+		end
+		function session:onReload()
+			app.label = "v2"
+		end
+	`)
+	for range 2 {
+		if err := s.ReloadSession(h.VendedID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if app := state(); app["count"] != float64(2) || app["label"] != "v2" {
+		t.Errorf("state after reload = %v, want count 2 kept and label v2", app)
+	}
+	h.Flush()
+	if msgs := h.Poll(); len(msgs) != 1 || !strings.Contains(string(msgs[0].Data), `"value":"v2"`) {
+		t.Errorf("messages after reload = %v, want one update with label v2", msgs)
+	}
+
+	writeMain(`error("broken")`)
+	if err := s.ReloadSession(h.VendedID); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("broken reload = %v, want main.lua's error", err)
+	}
+	if app := state(); app["count"] != float64(2) || app["label"] != "v2" {
+		t.Errorf("state after broken reload = %v", app)
+	}
+	if _, err := h.Run("step", `app.count = 3`); err != nil {
+		t.Errorf("session stopped working after broken reload: %v", err)
+	}
+	if err := s.ReloadSession("no-such-session"); err == nil {
+		t.Error("ReloadSession of an unknown session succeeded")
+	}
+}
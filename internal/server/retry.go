@@ -0,0 +1,78 @@
+// CRC: crc-Server.md
+// Spec: deployment.md
+package server
+
+import (
+	"math/rand/v2"
+	"sync/atomic"
+	"time"
+
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// Retry hint tuning: a base delay plus a cost per message or task waiting on the server.
+const (
+	retryBase       = 500 * time.Millisecond
+	retryDrainBase  = 5 * time.Second
+	retryPerPending = 2 * time.Millisecond
+	retryPerTask    = 10 * time.Millisecond
+	retryMax        = 60 * time.Second
+)
+
+// retryAdvisor computes client retry hints from server load so clients that hit an
+// overloaded or draining server spread their retries out instead of stampeding back.
+// Implements protocol.RetryAdvisor.
+type retryAdvisor struct {
+	pending  *PendingQueueManager
+	ws       *WebSocketEndpoint
+	draining atomic.Bool
+	jitter   func(n int64) int64 // random value in [0, n)
+}
+
+func newRetryAdvisor(pending *PendingQueueManager, ws *WebSocketEndpoint) *retryAdvisor {
+	return &retryAdvisor{pending: pending, ws: ws, jitter: rand.Int64N}
+}
+
+// Draining reports whether the server is shutting down.
+func (a *retryAdvisor) Draining() bool {
+	return a.draining.Load()
+}
+
+// RetryAfter returns a delay scaled by pending queue depth and executor queue depth.
+// Equal jitter picks from [d/2, d), so the hint still grows with load.
+func (a *retryAdvisor) RetryAfter() time.Duration {
+	d := retryBase
+	if a.draining.Load() {
+		d = retryDrainBase
+	}
+	d += time.Duration(a.pending.TotalLen()) * retryPerPending
+	if a.ws != nil {
+		d += time.Duration(a.ws.QueueDepth()) * retryPerTask
+	}
+	d = min(d, retryMax)
+	half := int64(d / 2)
+	return time.Duration(half + a.jitter(half))
+}
+
+// drain marks the server as draining, refuses new sessions, sends the updates
+// waiting in session batches and then tells connected clients when to come
+// back. Each client gets its own jittered hint. Polling clients are woken by
+// the notification so long-polls do not hold up shutdown.
+func (s *Server) drain() {
+	s.retry.draining.Store(true)
+	s.sessions.StopAccepting()
+	for _, sess := range s.sessions.GetAllSessions() {
+		if batcher := sess.GetBatcher(); batcher != nil {
+			batcher.FlushNow()
+		}
+	}
+	notice := func() *protocol.Message {
+		msg, _ := protocol.NewMessage(protocol.MsgShutdown, protocol.ShutdownMessage{
+			Reason:       "server shutting down",
+			RetryAfterMs: s.retry.RetryAfter().Milliseconds(),
+		})
+		return msg
+	}
+	s.wsEndpoint.NotifyAll(notice)
+	s.pendingQueues.EnqueueEach(notice)
+}
@@ -0,0 +1,221 @@
+// CRC: crc-Server.md
+// Spec: deployment.md
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// hintRange returns the smallest and largest hint the advisor can currently give
+func hintRange(a *retryAdvisor) (time.Duration, time.Duration) {
+	a.jitter = func(int64) int64 { return 0 }
+	lo := a.RetryAfter()
+	a.jitter = func(n int64) int64 { return n - 1 }
+	hi := a.RetryAfter()
+	return lo, hi
+}
+
+func TestRetryHintScalesWithLoad(t *testing.T) {
+	pending := NewPendingQueueManager()
+	ws := NewWebSocketEndpoint(config.DefaultConfig(), NewSessionManager(time.Hour), nil)
+	a := newRetryAdvisor(pending, ws)
+
+	idleLo, idleHi := hintRange(a)
+	if idleLo >= idleHi {
+		t.Fatalf("no jitter: range [%v, %v]", idleLo, idleHi)
+	}
+
+	// Induce load: pending messages for polling clients and queued executor tasks
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1})
+	for i := 0; i < 500; i++ {
+		pending.Enqueue("poller", msg)
+	}
+	ws.queued.Add(100)
+	loadedLo, loadedHi := hintRange(a)
+	if loadedLo <= idleHi {
+		t.Errorf("loaded hint %v should exceed idle hint %v", loadedLo, idleHi)
+	}
+
+	// More load, longer hint, up to the cap
+	ws.queued.Add(100000)
+	cappedLo, cappedHi := hintRange(a)
+	if cappedLo <= loadedHi {
+		t.Errorf("heavier load hint %v should exceed %v", cappedLo, loadedHi)
+	}
+	if cappedHi > retryMax {
+		t.Errorf("hint %v exceeds cap %v", cappedHi, retryMax)
+	}
+
+	// Draining raises the floor
+	ws.queued.Store(0)
+	for pending.TotalLen() > 0 {
+		pending.GetQueue("poller").Drain()
+	}
+	a.draining.Store(true)
+	if drainLo, _ := hintRange(a); drainLo <= idleHi {
+		t.Errorf("draining hint %v should exceed idle hint %v", drainLo, idleHi)
+	}
+}
+
+func TestDrainingHTTPResponses(t *testing.T) {
+	sessions := NewSessionManager(time.Hour)
+	pending := NewPendingQueueManager()
+	handler := protocol.NewHandler(config.DefaultConfig(), nil)
+	handler.SetPendingQueuer(pending)
+	endpoint := NewHTTPEndpoint(sessions, handler, nil)
+	a := newRetryAdvisor(pending, nil)
+	handler.SetRetryAdvisor(a)
+	endpoint.SetRetryAdvisor(a)
+	a.draining.Store(true)
+
+	// New sessions are refused with Retry-After
+	w := httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") == "" {
+		t.Errorf("GET / = %d, Retry-After %q; want 503 with header", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// API calls too, with the hint in the body
+	w = httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("POST", "/api/update", strings.NewReader(`{"data":{"varId":1}}`)))
+	var resp protocol.Response
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusServiceUnavailable || resp.RetryAfterMs < int64(retryDrainBase/2/time.Millisecond) {
+		t.Errorf("POST /api/update = %d %+v", w.Code, resp)
+	}
+
+	// A long-poll returns at once with the hint instead of waiting
+	start := time.Now()
+	w = httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("POST", "/api/poll", strings.NewReader(`{"data":{"wait":"10s"}}`)))
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("poll held open for %v while draining", elapsed)
+	}
+	resp = protocol.Response{}
+	json.NewDecoder(w.Body).Decode(&resp)
+	if w.Code != http.StatusOK || resp.RetryAfterMs == 0 || w.Header().Get("Retry-After") == "" {
+		t.Errorf("POST /api/poll = %d %+v, Retry-After %q", w.Code, resp, w.Header().Get("Retry-After"))
+	}
+}
+
+// TestShutdownDrain verifies shutdown sends a session's batched update ahead of
+// the shutdown notice to WebSocket and polling clients, waits for a polling
+// client to collect them, and refuses new sessions
+func TestShutdownDrain(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`session:createAppVariable({count = 1})`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	sess, _, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.wsEndpoint.HandleWebSocket(w, r, sess.ID)
+	}))
+	defer srv.Close()
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	pollID, err := s.wsEndpoint.ConnectPolling(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wsID string
+	for deadline := time.Now().Add(time.Second); wsID == "" && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		for _, id := range sess.GetConnections() {
+			if id != pollID {
+				wsID = id
+			}
+		}
+	}
+
+	// A client polling in a loop, one message at a time so it must come back
+	poll, _ := protocol.NewMessage(protocol.MsgPoll, protocol.PollMessage{Wait: "50ms", MaxMessages: 1})
+	s.wsEndpoint.HandlePolled(pollID, poll)
+	polled := make(chan []protocol.MessageType)
+	go func() {
+		var types []protocol.MessageType
+		for !slices.Contains(types, protocol.MsgShutdown) {
+			resp, err := s.wsEndpoint.HandlePolled(pollID, poll)
+			if err != nil {
+				break
+			}
+			raw, _ := json.Marshal(resp.Result)
+			var msgs []protocol.Message
+			json.Unmarshal(raw, &msgs)
+			for _, msg := range msgs {
+				types = append(types, msg.Type)
+			}
+		}
+		polled <- types
+	}()
+
+	update, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1, Value: json.RawMessage(`2`)})
+	sess.GetBatcher().Queue(update, []string{wsID, pollID})
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.pendingQueues.GetQueue(pollID).Len(); n != 0 {
+		t.Errorf("shutdown returned with %d messages not yet polled", n)
+	}
+
+	want := []protocol.MessageType{protocol.MsgUpdate, protocol.MsgShutdown}
+	select {
+	case types := <-polled:
+		if !slices.Equal(types, want) {
+			t.Errorf("polled %v, want %v", types, want)
+		}
+	case <-time.After(time.Second):
+		t.Error("polling client did not get the shutdown notice")
+	}
+	var types []protocol.MessageType
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for len(types) < 2 {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("WebSocket read after %v: %v", types, err)
+		}
+		var msgs []protocol.Message
+		if data[0] != '[' {
+			data = append(append([]byte{'['}, data...), ']')
+		}
+		json.Unmarshal(data, &msgs)
+		for _, msg := range msgs {
+			types = append(types, msg.Type)
+			if msg.Type == protocol.MsgShutdown {
+				var notice protocol.ShutdownMessage
+				json.Unmarshal(msg.Data, &notice)
+				if notice.Reason == "" || notice.RetryAfterMs == 0 {
+					t.Errorf("notice = %+v", notice)
+				}
+			}
+		}
+	}
+	if !slices.Equal(types, want) {
+		t.Errorf("WebSocket got %v, want %v", types, want)
+	}
+
+	var denied *SessionDeniedError
+	if _, _, err := s.sessions.CreateSession(); !errors.As(err, &denied) || denied.Status != http.StatusServiceUnavailable {
+		t.Errorf("CreateSession after shutdown: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+// CRC: crc-LuaSession.md
+// Spec: protocol.md (Named Roots)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestNamedRoots verifies a second root is found by name with getRoots, that
+// each root's connections only get their own root's updates, and that viewdefs
+// ride on the meta root (the app) alone
+func TestNamedRoots(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.MkdirAll(filepath.Join(dir, "viewdefs"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "alice"}
+		notes = {count = 0}
+		session:createAppVariable(app)
+		session:createRoot("notifications", notes)
+	`), 0644)
+	os.WriteFile(filepath.Join(dir, "viewdefs", "Note.DEFAULT.html"), []byte(`<template><span ui-value="count"></span></template>`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	h.SetRootLister(s)
+	send := func(connectionID string, msgType protocol.MessageType, data any) *protocol.Response {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		resp, err := h.HandleMessage(connectionID, msg)
+		if err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s from %s failed: %v %+v", msgType, connectionID, err, resp)
+		}
+		return resp
+	}
+
+	// The app keeps variable 1; other roots get server IDs that never collide with frontend ones
+	roots := send("c2", protocol.MsgGetRoots, protocol.GetRootsMessage{}).Result.(protocol.RootsResponse)
+	notesID := roots.Roots["notifications"]
+	if roots.Roots["app"] != 1 || notesID >= 0 || roots.Meta != 1 {
+		t.Fatalf("roots = %+v, want app 1, a negative notifications ID and meta 1", roots)
+	}
+	if _, err := luaSession.LoadCode("dup", `session:createRoot("notifications", {})`); err == nil {
+		t.Error("duplicate root name accepted")
+	}
+
+	send("c1", protocol.MsgWatch, protocol.WatchMessage{VarID: 1})
+	send("c1", protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name"}})
+	send("c2", protocol.MsgWatch, protocol.WatchMessage{VarID: notesID})
+	send("c2", protocol.MsgCreate, protocol.CreateMessage{ID: 3, ParentID: notesID, Properties: map[string]string{"path": "count"}})
+
+	// deliver sends a batch's updates and returns them as connection:varID, with "+viewdefs"
+	// when they carry viewdefs
+	deliver := func() []string {
+		t.Helper()
+		sender := &mockSender{}
+		s.deliverUpdates(vendedID, sess.GetBackend(), NewOutgoingBatcher(sender), luaSession.AfterBatch(vendedID), true)
+		var sent []string
+		for i, msg := range sender.messages {
+			var update protocol.UpdateMessage
+			if msg.Type != protocol.MsgUpdate || json.Unmarshal(msg.Data, &update) != nil {
+				continue
+			}
+			entry, _ := json.Marshal(update.VarID)
+			if _, ok := update.Properties["viewdefs"]; ok {
+				entry = append(entry, "+viewdefs"...)
+			}
+			sent = append(sent, sender.connIDs[i]+":"+string(entry))
+		}
+		slices.Sort(sent)
+		return slices.Compact(sent)
+	}
+	if sent := deliver(); !slices.Contains(sent, "c1:1+viewdefs") || slices.ContainsFunc(sent, func(e string) bool {
+		return strings.HasPrefix(e, "c2:") && strings.HasSuffix(e, "+viewdefs")
+	}) {
+		t.Errorf("first batch sent %v, want viewdefs on the app root to c1 only", sent)
+	}
+
+	if _, err := luaSession.LoadCode("notify", `notes.count = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if sent := deliver(); !slices.Equal(sent, []string{"c2:3"}) {
+		t.Errorf("notifications change sent %v, want only c2", sent)
+	}
+	if _, err := luaSession.LoadCode("rename", `app.name = "bob"`); err != nil {
+		t.Fatal(err)
+	}
+	if sent := deliver(); !slices.Equal(sent, []string{"c1:2"}) {
+		t.Errorf("app change sent %v, want only c1", sent)
+	}
+}
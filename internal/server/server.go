@@ -8,15 +8,22 @@
 package server
 
 import (
+	"archive/zip"
+	"cmp"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"net"
 	"net/http"
+	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	gopher "github.com/yuin/gopher-lua"
@@ -24,6 +31,7 @@ import (
 	"github.com/zot/ui-engine/internal/backend"
 	"github.com/zot/ui-engine/internal/bundle"
 	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/demo"
 	"github.com/zot/ui-engine/internal/lua"
 	"github.com/zot/ui-engine/internal/protocol"
 	"github.com/zot/ui-engine/internal/viewdef"
@@ -33,6 +41,7 @@ import (
 // CRC: crc-Server.md
 type Server struct {
 	config           *config.Config
+	traces           atomic.Int32 // Sessions with a trace, so untraced logging skips lookups
 	sessions         *SessionManager
 	handler          *protocol.Handler
 	pendingQueues    *PendingQueueManager
@@ -46,32 +55,66 @@ type Server struct {
 	wrapperRegistry  *lua.WrapperRegistry
 	storeAdapter     *luaTrackerAdapter
 	viewdefManager   *viewdef.ViewdefManager
-	hotLoader        *lua.HotLoader     // Lua hot-reloading (nil if disabled)
-	viewdefHotLoader *viewdef.HotLoader // Viewdef hot-reloading (nil if disabled)
+	hotLoader        *lua.HotLoader          // Lua hot-reloading (nil if disabled)
+	viewdefHotLoader *viewdef.HotLoader      // Viewdef hot-reloading (nil if disabled)
+	flagDefaults     map[string]any          // flags.json + config defaults
+	priorityRules    *protocol.PriorityRules // types.json priority rules, shared by all sessions
+	flagsHook        FlagsHook               // Per-session flag overrides (nil if unset)
+	persist          *writeThrough           // Write-through persistence (nil if no store)
+	retry            *retryAdvisor           // Load-based retry hints and draining state
+	events           *protocol.EventRing     // Recent telemetry events for crash bundles
+	bundleReloadMu   sync.Mutex              // Serializes ReloadBundle
+	siteFS           fs.FS                   // Embedder's static files (nil = bundle or directory)
+	store            storeLimits             // Evictions past the store limits
 }
 
 // luaSetupConfig holds shared configuration for creating Lua sessions.
 type luaSetupConfig struct {
 	config      *config.Config
 	luaDir      string
-	mainLuaCode string // Cached main.lua for bundle mode
+	mainLuaCode atomic.Pointer[string] // Cached main.lua for bundle mode (nil if none)
+	sources     *lua.SourceCache       // Lua files as last read, for when the lua directory is unavailable
 }
 
 // New creates a new server with the given configuration.
 func New(cfg *config.Config) *Server {
-	sessions := NewSessionManager(cfg.Session.Timeout.Duration())
+	return NewWithOptions(cfg)
+}
+
+// NewWithOptions creates a new server, with opts substituting components it
+// would otherwise build from cfg.
+func NewWithOptions(cfg *config.Config, opts ...Option) *Server {
+	var o serverOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	sessions := o.sessions
+	if sessions == nil {
+		sessions = NewSessionManager(cfg.Session.Timeout.Duration())
+	}
 	s := &Server{
 		config:        cfg,
 		sessions:      sessions,
 		pendingQueues: NewPendingQueueManager(),
+		siteFS:        o.siteFS,
 	}
 	// Create message sender that wraps WebSocket endpoint
 	sender := &serverMessageSender{server: s}
 	s.handler = protocol.NewHandler(cfg, sender)
 
+	// Keep recent events in memory for crash bundles
+	s.events = protocol.NewEventRing(crashEventCount)
+	s.handler.SetTelemetry(s.events)
+
 	// Set up pending queue for CLI/REST clients
+	s.pendingQueues.SetMemoryLimit(cfg.Session.PollMemoryLimit)
 	s.handler.SetPendingQueuer(s.pendingQueues)
 
+	// Handler timing is opt-in; a nil recorder keeps the hot path free
+	if cfg.Server.Metrics {
+		s.handler.SetMetrics(protocol.NewHandlerMetrics())
+	}
+
 	// Set up backend lookup for per-session watch management
 	s.handler.SetBackendLookup(&serverBackendLookup{server: s})
 
@@ -80,15 +123,45 @@ func New(cfg *config.Config) *Server {
 
 	// Create WebSocket endpoint
 	s.wsEndpoint = NewWebSocketEndpoint(cfg, sessions, s.handler)
+	s.wsEndpoint.SetPendingQueues(s.pendingQueues)
 
 	// Create HTTP endpoint
 	s.HttpEndpoint = NewHTTPEndpoint(sessions, s.handler, s.wsEndpoint)
 
+	// Retry hints for draining and overloaded responses
+	s.retry = newRetryAdvisor(s.pendingQueues, s.wsEndpoint)
+	s.handler.SetRetryAdvisor(s.retry)
+	s.HttpEndpoint.SetRetryAdvisor(s.retry)
+	s.HttpEndpoint.SetCSP(cfg.Server.CSP)
+	s.HttpEndpoint.SetStaticCache(cfg.Server.StaticCache)
+
+	// Session listing (ui-engine sessions)
+	s.HttpEndpoint.HandleFunc("/api/debug/sessions", s.handleSessionList)
+	s.HttpEndpoint.HandleFunc("/api/debug/drain", s.handleSessionDrain)
+	s.handler.SetDrainChecker(s)
+	s.handler.SetTracer(s)
+	s.HttpEndpoint.HandleFunc("/api/debug/viewdefs", s.handleViewdefList)
+	s.HttpEndpoint.HandleFunc("/api/debug/connections", s.handleConnectionList)
+	s.HttpEndpoint.HandleFunc("/api/debug/compression", s.handleCompressionStats)
+	s.HttpEndpoint.HandleFunc("/api/debug/store", s.handleStoreStats)
+	s.HttpEndpoint.HandleFunc("/api/debug/reload-bundle", s.handleBundleReload)
+	s.HttpEndpoint.HandleFunc("/readyz", s.handleReadiness)
+
 	// Set up site serving (bundle or custom directory)
 	s.setupSite(cfg)
+	lua.SetConvertLimits(cfg.Lua.MaxConvertDepth, cfg.Lua.MaxConvertNodes)
 
 	// Set up viewdef manager and load viewdefs
-	s.setupViewdefs(cfg)
+	s.setupViewdefs(cfg, o.viewdefManager)
+	s.HttpEndpoint.SetMetricsCounters(s.viewdefCounters)
+	s.HttpEndpoint.SetMetricsGauges(s.metricsGauges)
+
+	// Load feature flag defaults (site flags.json, then config)
+	s.flagDefaults = loadFlagDefaults(cfg)
+
+	// Global priority rules and strict mode's property allowlist (site types.json)
+	s.priorityRules = loadPriorityRules(cfg)
+	s.handler.SetPropertyAllowlist(loadPropertyAllowlist(cfg))
 
 	// Create backend socket
 	s.backendSocket = NewBackendSocket(cfg, cfg.Server.Socket, s.handler, s.HttpEndpoint)
@@ -102,7 +175,10 @@ func New(cfg *config.Config) *Server {
 	// store.SetVerbosity(verbosity) - Removed
 
 	// Initialize wrapper registry (needed for ViewList wrapper support)
-	s.wrapperRegistry = lua.NewWrapperRegistry()
+	s.wrapperRegistry = o.wrapperRegistry
+	if s.wrapperRegistry == nil {
+		s.wrapperRegistry = lua.NewWrapperRegistry()
+	}
 
 	// Initialize Lua runtime if enabled
 	if cfg.Lua.Enabled {
@@ -120,9 +196,11 @@ func New(cfg *config.Config) *Server {
 			if tracker == nil {
 				return nil, 0, fmt.Errorf("tracker not found")
 			}
-			vars, err := s.getDebugVariables(tracker)
+			vars, err := s.getDebugVariables(tracker, luaSession)
 			return vars, tracker.ChangeCount, err
 		})
+		s.HttpEndpoint.SetObjectGraphProvider(s.ObjectGraph)
+		s.HttpEndpoint.SetValueSanitizer(cfg.Sanitize)
 
 		// Set viewdef manager on store adapter so it can send viewdefs when new types appear
 		if s.storeAdapter != nil && s.viewdefManager != nil {
@@ -135,12 +213,24 @@ func New(cfg *config.Config) *Server {
 		// Callbacks receive vended IDs (compact integers) for backend communication
 		// Each session gets its own LuaBackend and OutgoingBatcher for per-session isolation
 		sessions.SetOnSessionCreated(func(vendedID string, sess *Session) error {
-			return s.CreateLuaBackendForSession(vendedID, sess)
+			if err := s.CreateLuaBackendForSession(vendedID, sess); err != nil {
+				s.handler.Telemetry().OnError(vendedID, err)
+				return err
+			}
+			s.handler.Telemetry().OnSessionCreated(vendedID)
+			return nil
 		})
 		sessions.SetOnSessionDestroyed(func(vendedID string, sess *Session) {
+			s.endTrace(sess, sess.Trace())
 			s.DestroyLuaBackendForSession(vendedID, sess)
+			s.handler.Telemetry().OnSessionDestroyed(vendedID)
 		})
 
+		// Idle sessions hibernate to disk instead of being destroyed
+		if hibernationEnabled(cfg) {
+			s.setupHibernation()
+		}
+
 		// Set up afterBatch callback for automatic change detection
 		s.wsEndpoint.SetAfterBatch(s.AfterBatch)
 
@@ -152,6 +242,10 @@ func New(cfg *config.Config) *Server {
 				s.viewdefManager.ClearSession(vendedID)
 			}
 
+			if luaSession := s.GetLuaSession(vendedID); luaSession != nil {
+				luaSession.MarkDirty()
+			}
+
 			// Clear all descendants of the app variable so page refresh starts fresh
 			if vendedID != "" && s.storeAdapter != nil {
 				if lb := s.storeAdapter.GetBackend(vendedID); lb != nil {
@@ -167,11 +261,52 @@ func New(cfg *config.Config) *Server {
 
 		// Set server as path variable handler (routes to per-session LuaSession)
 		s.handler.SetPathVariableHandler(s)
+
+		// Watch table consistency check (ui doctor --live)
+		s.HttpEndpoint.HandleFunc("/api/debug/watches", s.handleWatchCheck)
+
+		// Object collection on demand (ui-engine gc)
+		s.HttpEndpoint.HandleFunc("/api/debug/gc", s.handleObjectGC)
+
+		// Runtime flag changes (setFlags message) and dev-only query overrides
+		s.handler.SetFlagSetter(s)
+		if cfg.Flags.AllowQuery {
+			s.HttpEndpoint.SetFlagOverrideHandler(s.applyQueryFlags)
+		}
+
+		// Flush barrier for backends (flush message)
+		s.handler.SetFlusher(s)
+
+		// Updates from backends that name a session (ui update --session)
+		s.handler.SetSessionUpdater(s)
+
+		// Named root lookup (getRoots message)
+		s.handler.SetRootLister(s)
+
+		// Messages that change variables outside Lua mark their session dirty
+		s.handler.SetChangeNotifier(s)
+
+		// Strict mode warnings show with the variables in the variable browser
+		s.handler.SetDiagRecorder(s)
+	}
+
+	// Embedder components that have setters
+	if o.telemetry != nil {
+		s.SetTelemetry(o.telemetry)
+	}
+	if o.store != nil {
+		s.SetPersistentStore(o.store)
 	}
+	s.HttpEndpoint.SetAuthFunc(o.auth)
 
 	return s
 }
 
+// Log logs a message at the server component's verbosity.
+func (s *Server) Log(level int, format string, args ...interface{}) {
+	s.config.Logger(config.LogServer).Log(level, format, args...)
+}
+
 // Start starts the server.
 func (s *Server) Start() error {
 	// Start HTTP server and block
@@ -179,8 +314,8 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
-	s.config.Log(0, "HTTP server listening on %s", url)
-	s.config.Log(0, "Serving site from directory: %s", s.HttpEndpoint.staticDir)
+	s.Log(0, "HTTP server listening on %s", url)
+	s.Log(0, "Serving site from directory: %s", s.HttpEndpoint.staticDir)
 	// Block until shutdown
 	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
 		return fmt.Errorf("HTTP server error: %v", err)
@@ -195,26 +330,24 @@ func (s *Server) configureHTTP(port int) (*http.Server, net.Listener, string, er
 	if err := s.backendSocket.Listen(); err != nil {
 		return nil, nil, "", fmt.Errorf("failed to start backend socket: %w", err)
 	}
-	s.config.Log(0, "Backend socket listening on %s", s.backendSocket.GetSocketPath())
+	s.Log(0, "Backend socket listening on %s", s.backendSocket.GetSocketPath())
 
 	// Start HTTP server
-	addr := fmt.Sprintf("%s:%d", s.config.Server.Host, port)
+	listener, err := listenHTTP(s.config.Server.Host, port, s.config.Server.PortRetry)
+	if err != nil {
+		s.backendSocket.Close()
+		return nil, nil, "", err
+	}
 	s.httpServer = &http.Server{
-		Addr:    addr,
+		Addr:    listener.Addr().String(),
 		Handler: s.HttpEndpoint,
 	}
 
-	// We need to capture the actual port if 0 was passed
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		return nil, nil, "", fmt.Errorf("failed to listen on %s: %w", addr, err)
-	}
-
-	// Update port in config if it was 0
-	if port == 0 {
-		addr = listener.Addr().String()
-		_, portStr, _ := net.SplitHostPort(addr)
-		s.config.Server.Port, _ = strconv.Atoi(portStr)
+	// Record the actual port (0 was passed, or a retry moved it)
+	_, portStr, _ := net.SplitHostPort(listener.Addr().String())
+	s.config.Server.Port, _ = strconv.Atoi(portStr)
+	if port != 0 && s.config.Server.Port != port {
+		s.Log(0, "Port %d is busy, using %d", port, s.config.Server.Port)
 	}
 
 	host := s.config.Server.Host
@@ -226,18 +359,48 @@ func (s *Server) configureHTTP(port int) (*http.Server, net.Listener, string, er
 	return s.httpServer, listener, url, nil
 }
 
+// listenHTTP listens on host:port. When the port is busy it tries up to retries
+// following ports; without retries the error says how to resolve the conflict.
+func listenHTTP(host string, port, retries int) (net.Listener, error) {
+	for attempt := 0; ; attempt++ {
+		addr := fmt.Sprintf("%s:%d", host, port+attempt)
+		listener, err := net.Listen("tcp", addr)
+		if err == nil {
+			return listener, nil
+		}
+		if !errors.Is(err, syscall.EADDRINUSE) || port == 0 {
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		if attempt >= retries {
+			if retries == 0 {
+				return nil, fmt.Errorf("port %d is already in use (another ui-engine running?); use --port or --port-retry N", port)
+			}
+			return nil, fmt.Errorf("ports %d-%d are all in use", port, port+retries)
+		}
+	}
+}
+
 // Shutdown gracefully shuts down the server.
 func (s *Server) Shutdown(ctx context.Context) error {
+	// Tell clients to back off before connections start closing, and let
+	// polling clients collect what is left for them
+	s.drain()
+	s.wsEndpoint.awaitPolls(ctx, shutdownPollWait)
+	s.saveViewdefUsage()
+
 	// Stop hot loader first
 	if s.hotLoader != nil {
 		s.hotLoader.Stop()
 		s.hotLoader = nil
 	}
+	if s.luaConfig != nil {
+		s.luaConfig.sources.Close()
+	}
 
 	// Shutdown all Lua sessions
 	s.luaSessionsMu.Lock()
 	for vendedID, luaSession := range s.luaSessions {
-		s.config.Log(0, "Shutting down Lua session %s", vendedID)
+		s.Log(0, "Shutting down Lua session %s", vendedID)
 		luaSession.Shutdown()
 	}
 	s.luaSessions = nil
@@ -269,56 +432,125 @@ func (s *Server) GetHandler() *protocol.Handler {
 // StartCleanupWorker starts a background worker to clean up inactive sessions.
 func (s *Server) StartCleanupWorker(interval time.Duration) {
 	go func() {
+		defer s.RecoverCrash("cleanup")
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
 		for range ticker.C {
 			count := s.sessions.CleanupInactiveSessions()
 			if count > 0 {
-				s.config.Log(0, "Cleaned up %d inactive sessions", count)
+				s.Log(0, "Cleaned up %d inactive sessions", count)
 			}
+			s.destroyDrainedSessions()
+			s.CheckWatches(true)
+			s.saveViewdefUsage()
 		}
 	}()
 }
 
-// setupSite configures the site filesystem (bundle or directory).
+// setupSite configures the site filesystem (bundle or directory). An
+// embedder's site filesystem replaces its static files.
 func (s *Server) setupSite(cfg *config.Config) {
-	// If --dir is specified, use that directory's html/ subdirectory
+	bundle.SetCacheSize(cfg.Server.BundleCacheSize)
+	if s.siteFS != nil {
+		defer s.HttpEndpoint.SetEmbeddedSite(s.siteFS)
+	}
+
+	// If --dir is specified, use that directory's html/ subdirectory, falling
+	// back to the bundle for files it lacks unless --no-bundle-fallback
 	if cfg.Server.Dir != "" {
 		htmlDir := cfg.Server.Dir + "/html"
 		s.HttpEndpoint.SetStaticDir(htmlDir)
-		s.config.Log(0, "Serving site from directory: %s", htmlDir)
+		var site fs.FS = os.DirFS(cfg.Server.Dir)
+		if zipReader := s.fallbackBundle(cfg); zipReader != nil {
+			s.HttpEndpoint.SetEmbeddedSite(bundle.NewZipFileSystem(zipReader))
+			site = bundle.OverlayFS{site, zipReader}
+			s.Log(0, "Serving site from directory: %s (missing files from the embedded bundle)", htmlDir)
+		} else {
+			s.Log(0, "Serving site from directory: %s", htmlDir)
+		}
+		s.HttpEndpoint.SetSiteAssets(site, cfg.Server.AssetDirs, false)
 		return
 	}
 
 	// Try to load from bundle
 	zipReader, err := bundle.GetBundleReader()
 	if err != nil {
-		s.config.Log(0, "Warning: failed to read bundle: %v", err)
+		s.Log(0, "Warning: failed to read bundle: %v", err)
 		return
 	}
 
 	if zipReader != nil {
+		// --verify-bundle already refused to start on failure; otherwise only warn
+		if !cfg.Server.VerifyBundle {
+			if err := bundle.Verify(); err != nil {
+				s.Log(0, "Warning: %v", err)
+			}
+		}
 		// NewZipFileSystem automatically serves from html/ subdirectory
 		s.HttpEndpoint.SetEmbeddedSite(bundle.NewZipFileSystem(zipReader))
-		s.config.Log(0, "Serving site from embedded bundle (html/)")
+		s.HttpEndpoint.SetSiteAssets(zipReader, cfg.Server.AssetDirs, true)
+		s.Log(0, "Serving site from embedded bundle (html/)")
+		return
+	}
+
+	if cfg.Server.Demo != config.DemoOff {
+		s.setupDemoSite(cfg)
 		return
 	}
+	s.Log(0, "Warning: no site available (not bundled and no --dir specified)")
+}
+
+// fallbackBundle returns the bundle that fills in files missing from --dir,
+// or nil if there is none or --no-bundle-fallback is set.
+func (s *Server) fallbackBundle(cfg *config.Config) *zip.Reader {
+	if !cfg.Server.BundleFallback() {
+		return nil
+	}
+	zipReader, err := bundle.GetBundleReader()
+	if err != nil {
+		s.Log(0, "Warning: failed to read bundle: %v", err)
+		return nil
+	}
+	return zipReader
+}
 
-	s.config.Log(0, "Warning: no site available (not bundled and no --dir specified)")
+// setupDemoSite serves the built-in demo site as if it were the bundle, so its
+// Lua and viewdefs load the way a bundled site's do.
+func (s *Server) setupDemoSite(cfg *config.Config) {
+	zipReader, err := demo.Zip()
+	if err != nil {
+		s.Log(0, "Warning: failed to load demo site: %v", err)
+		return
+	}
+	bundle.SetFallback(zipReader)
+	s.HttpEndpoint.SetEmbeddedSite(bundle.NewZipFileSystem(zipReader))
+	s.HttpEndpoint.SetSiteAssets(zipReader, cfg.Server.AssetDirs, true)
+	s.Log(0, "Serving the built-in demo site (no bundle or --dir; --demo=off disables it)")
 }
 
-// setupViewdefs initializes the viewdef manager and loads viewdefs.
-func (s *Server) setupViewdefs(cfg *config.Config) {
-	s.viewdefManager = viewdef.NewViewdefManager()
+// setupViewdefs initializes the viewdef manager, or the embedder's if not nil,
+// and loads viewdefs.
+func (s *Server) setupViewdefs(cfg *config.Config, manager *viewdef.ViewdefManager) {
+	if manager == nil {
+		manager = viewdef.NewViewdefManager()
+	}
+	s.viewdefManager = manager
+	s.viewdefManager.SetConfig(cfg)
 
-	// If --dir is specified, load from that directory's viewdefs/ subdirectory
+	// If --dir is specified, load from that directory's viewdefs/ subdirectory,
+	// over the bundle's unless --no-bundle-fallback
 	if cfg.Server.Dir != "" {
 		viewdefsDir := cfg.Server.Dir + "/viewdefs"
-		if err := s.viewdefManager.LoadFromDirectory(viewdefsDir); err != nil {
-			s.config.Log(0, "Warning: failed to load viewdefs from %s: %v", viewdefsDir, err)
+		if s.fallbackBundle(cfg) != nil {
+			if err := s.viewdefManager.LoadFromBundle(); err != nil {
+				s.Log(0, "Warning: failed to load viewdefs from bundle: %v", err)
+			}
+		}
+		if err := s.viewdefManager.LoadFromDirectory(viewdefsDir); err != nil && !(errors.Is(err, fs.ErrNotExist) && s.fallbackBundle(cfg) != nil) {
+			s.Log(0, "Warning: failed to load viewdefs from %s: %v", viewdefsDir, err)
 		} else {
-			s.config.Log(0, "Loaded %d viewdefs from directory: %s", s.viewdefManager.Count(), viewdefsDir)
+			s.Log(0, "Loaded %d viewdefs from directory: %s", s.viewdefManager.Count(), viewdefsDir)
 		}
 
 		// Initialize viewdef hot-loader if Lua hot-loading is enabled
@@ -331,9 +563,9 @@ func (s *Server) setupViewdefs(cfg *config.Config) {
 
 	// Try to load from bundle
 	if err := s.viewdefManager.LoadFromBundle(); err != nil {
-		s.config.Log(0, "Warning: failed to load viewdefs from bundle: %v", err)
+		s.Log(0, "Warning: failed to load viewdefs from bundle: %v", err)
 	} else if s.viewdefManager.Count() > 0 {
-		s.config.Log(0, "Loaded %d viewdefs from bundle", s.viewdefManager.Count())
+		s.Log(0, "Loaded %d viewdefs from bundle", s.viewdefManager.Count())
 	}
 }
 
@@ -348,18 +580,18 @@ func (s *Server) setupViewdefHotLoader(cfg *config.Config, viewdefsDir string) {
 		s, // Server implements viewdef.SessionPusher
 	)
 	if err != nil {
-		s.config.Log(0, "ViewdefHotLoader: failed to create: %v", err)
+		s.Log(0, "ViewdefHotLoader: failed to create: %v", err)
 		return
 	}
 
 	s.viewdefHotLoader = hotLoader
 	if err := hotLoader.Start(); err != nil {
-		s.config.Log(0, "ViewdefHotLoader: failed to start: %v", err)
+		s.Log(0, "ViewdefHotLoader: failed to start: %v", err)
 		s.viewdefHotLoader = nil
 		return
 	}
 
-	s.config.Log(0, "ViewdefHotLoader: watching %s for changes", viewdefsDir)
+	s.Log(0, "ViewdefHotLoader: watching %s for changes", viewdefsDir)
 }
 
 // GetSessionIDs returns all active vended session IDs.
@@ -375,6 +607,13 @@ func (s *Server) GetSessionIDs() []string {
 	return ids
 }
 
+// GetSessionCount returns how many Lua sessions exist.
+func (s *Server) GetSessionCount() int {
+	s.luaSessionsMu.RLock()
+	defer s.luaSessionsMu.RUnlock()
+	return len(s.luaSessions)
+}
+
 // PushViewdefs pushes updated viewdefs to a session.
 // This triggers AfterBatch to detect and send the changes.
 // Implements viewdef.SessionPusher.
@@ -389,20 +628,46 @@ func (s *Server) PushViewdefs(vendedID string, viewdefs map[string]string) {
 	})
 }
 
-// triggerSessionRefresh triggers AfterBatch for a session to push pending changes.
-// Used by Lua hot-loader after reloading code.
+// runReload runs a Lua hot reload in a session as one reload-class task, so the
+// module swap and the AfterBatch that pushes its changes happen with no
+// interactive work in between.
 // CRC: crc-LuaHotLoader.md
 // Sequence: seq-lua-hotload.md
-func (s *Server) triggerSessionRefresh(vendedID string) {
-	s.config.Log(1, "triggerSessionRefresh: triggering refresh for session %s", vendedID)
-	s.ExecuteInSession(vendedID, func() (interface{}, error) {
-		// No-op - just trigger AfterBatch which will detect any changes
-		return nil, nil
+func (s *Server) runReload(vendedID string, reload func() error) error {
+	_, err := s.ExecuteClass(vendedID, OpReload, func() (interface{}, error) {
+		return nil, reload()
 	})
+	return err
 }
 
-// SetSiteFS sets a custom filesystem for serving static files.
+// ReloadSession re-runs main.lua in a session, keeping its app variable, calls
+// session:onReload() if defined, and pushes the resulting changes. It runs as
+// a reload-class task, so it is safe from any goroutine, including the hot
+// loader's. If main.lua fails the session keeps its previous code.
+// CRC: crc-LuaHotLoader.md
+func (s *Server) ReloadSession(vendedID string) error {
+	sess := s.GetLuaSession(vendedID)
+	if sess == nil {
+		return fmt.Errorf("session %s has no Lua session", vendedID)
+	}
+	return s.runReload(vendedID, sess.ReloadSessionDirect)
+}
+
+// SetTelemetry sets the hook receiving session, message and batch events.
+// Use protocol.MultiTelemetry for several hooks; nil removes the hook.
+// The server's own crash-bundle event ring always receives events too.
+func (s *Server) SetTelemetry(hook protocol.TelemetryHook) {
+	if hook == nil {
+		s.handler.SetTelemetry(s.events)
+		return
+	}
+	s.handler.SetTelemetry(protocol.MultiTelemetry(s.events, hook))
+}
+
+// SetSiteFS sets a custom filesystem for serving static files, kept when the
+// bundle is reloaded.
 func (s *Server) SetSiteFS(siteFS fs.FS) {
+	s.siteFS = siteFS
 	s.HttpEndpoint.SetEmbeddedSite(siteFS)
 }
 
@@ -496,8 +761,9 @@ func (s *Server) setupLua(cfg *config.Config) {
 	// Initialize sessions map and shared config
 	s.luaSessions = make(map[string]*lua.LuaSession)
 	s.luaConfig = &luaSetupConfig{
-		config: cfg,
-		luaDir: luaDir,
+		config:  cfg,
+		luaDir:  luaDir,
+		sources: lua.NewSourceCache(cfg, luaDir),
 	}
 
 	// Create store adapter (will be shared across sessions)
@@ -510,19 +776,20 @@ func (s *Server) setupLua(cfg *config.Config) {
 
 	// Initialize hot loader if enabled
 	if cfg.Lua.Hotload {
-		hotLoader, err := lua.NewHotLoader(cfg, luaDir, s.getLuaSessions, s.triggerSessionRefresh)
+		hotLoader, err := lua.NewHotLoader(cfg, luaDir, s.getLuaSessions, s.runReload)
 		if err != nil {
-			s.config.Log(0, "HotLoader: failed to create: %v", err)
+			s.Log(0, "HotLoader: failed to create: %v", err)
 		} else {
 			s.hotLoader = hotLoader
+			hotLoader.SetSourceCache(s.luaConfig.sources)
 			if err := hotLoader.Start(); err != nil {
-				s.config.Log(0, "HotLoader: failed to start: %v", err)
+				s.Log(0, "HotLoader: failed to start: %v", err)
 				s.hotLoader = nil
 			}
 		}
 	}
 
-	s.config.Log(0, "Lua sessions enabled (dir: %s, hotload: %v)", luaDir, cfg.Lua.Hotload)
+	s.Log(0, "Lua sessions enabled (dir: %s, hotload: %v)", luaDir, cfg.Lua.Hotload)
 }
 
 // CreateLuaBackendForSession creates a LuaBackend and LuaSession for a new frontend session.
@@ -542,9 +809,10 @@ func (s *Server) CreateLuaBackendForSession(vendedID string, sess *Session) erro
 	}
 
 	// Set cached main.lua code if available (bundle mode)
-	if s.luaConfig.mainLuaCode != "" {
-		luaSession.SetMainLuaCode(s.luaConfig.mainLuaCode)
+	if code := s.luaConfig.mainLuaCode.Load(); code != nil {
+		luaSession.SetMainLuaCode(*code)
 	}
+	luaSession.SetSourceCache(s.luaConfig.sources)
 
 	// Set wrapper registry on session (allows ui.registerWrapper from Lua)
 	luaSession.SetWrapperRegistry(s.wrapperRegistry)
@@ -555,9 +823,17 @@ func (s *Server) CreateLuaBackendForSession(vendedID string, sess *Session) erro
 		s.ExecuteInSessionAsync(vendedID, fn)
 	})
 
+	// Property watchers run on the session executor, followed by AfterBatch
+	luaSession.SetChangeScheduler(func(fn func(), flush bool) error {
+		return s.scheduleChange(sess.ID, fn, flush)
+	})
+
 	// Create LuaBackend with resolver
 	lb := backend.NewLuaBackend(s.config, vendedID, &lua.LuaResolver{})
 
+	// Lazy presenters (session:present) are created on their parent's first watch
+	lb.SetFirstWatchHook(luaSession.HandleFirstWatch)
+
 	// Attach backend to session
 	sess.SetBackend(lb)
 
@@ -574,6 +850,19 @@ func (s *Server) CreateLuaBackendForSession(vendedID string, sess *Session) erro
 	// Set variable store on Lua session
 	luaSession.SetVariableStore(s.storeAdapter)
 
+	// Flags must be in place before main.lua runs
+	luaSession.SetFlags(s.initialFlags(vendedID, sess))
+	luaSession.SetGlobalPriorityRules(s.priorityRules)
+
+	// Session groups: session.group and ui.groupBroadcast
+	luaSession.SetGroup(sess.Group())
+	luaSession.SetGroupBroadcaster(s.groupBroadcast)
+
+	// Viewdef scripts carry the session's nonce from the first send
+	if s.config.Server.CSP != "" && s.viewdefManager != nil {
+		s.viewdefManager.SetSessionNonce(vendedID, sess.CSPNonce())
+	}
+
 	// Store in our sessions map
 	s.luaSessionsMu.Lock()
 	s.luaSessions[vendedID] = luaSession
@@ -589,7 +878,38 @@ func (s *Server) CreateLuaBackendForSession(vendedID string, sess *Session) erro
 		return err
 	}
 
-	s.config.Log(0, "Created Lua session %s with isolated state", vendedID)
+	// Let main.lua veto or redirect browser requests before the session is handed out
+	if req := sess.Request(); req != nil {
+		if err := s.checkSessionRequest(vendedID, sess, luaSession, req); err != nil {
+			s.DestroyLuaBackendForSession(vendedID, sess)
+			return err
+		}
+	}
+
+	s.Log(0, "Created Lua session %s with isolated state", vendedID)
+	return nil
+}
+
+// checkSessionRequest runs ui.onSessionRequest for a new session.
+// Returns a *SessionDeniedError if the hook refuses the request.
+func (s *Server) checkSessionRequest(vendedID string, sess *Session, luaSession *lua.LuaSession, req *SessionRequest) error {
+	decision, err := luaSession.OnSessionRequest(req.info(), time.Duration(s.config.Session.RequestTimeout))
+	if err != nil {
+		s.Log(0, "Session %s: %v", vendedID, err)
+		return err
+	}
+	if decision.Deny {
+		denied := &SessionDeniedError{Status: decision.Status, Message: decision.Message}
+		if denied.Status < 400 || denied.Status > 599 {
+			denied.Status = http.StatusForbidden
+		}
+		if denied.Message == "" {
+			denied.Message = http.StatusText(denied.Status)
+		}
+		s.Log(1, "Session %s: request denied (%d)", vendedID, denied.Status)
+		return denied
+	}
+	req.Redirect = decision.Redirect
 	return nil
 }
 
@@ -622,8 +942,14 @@ func (s *Server) DestroyLuaBackendForSession(vendedID string, sess *Session) {
 		s.storeAdapter.RemoveBackend(vendedID)
 		s.storeAdapter.RemoveLuaSession(vendedID)
 	}
+	if s.persist != nil {
+		s.persist.forget(vendedID)
+	}
+	if s.viewdefManager != nil {
+		s.viewdefManager.SetSessionNonce(vendedID, "")
+	}
 
-	s.config.Log(0, "Destroyed Lua session %s", vendedID)
+	s.Log(0, "Destroyed Lua session %s", vendedID)
 }
 
 // AfterBatch triggers Lua change detection after processing a message batch.
@@ -660,8 +986,53 @@ func (s *Server) AfterBatch(internalSessionID string, userEvent bool) {
 		return
 	}
 
+	// Nothing ran since the last batch (e.g. only flush or poll messages):
+	// skip change detection and viewdef bookkeeping
+	if !luaSession.TakeDirty() {
+		if userEvent && batcher != nil {
+			batcher.FlushNow()
+		}
+		return
+	}
+
 	// Get detected changes from Lua session
+	start := time.Now()
 	updates := luaSession.AfterBatch(vendedID)
+	elapsed := time.Since(start)
+	s.handler.Telemetry().OnAfterBatch(vendedID, len(updates), elapsed)
+	if m := s.handler.Metrics(); m != nil {
+		m.Observe("afterBatch", elapsed)
+	}
+	if s.handler.Metrics() != nil || s.config.Store.Enabled() {
+		s.recordStoreUsage(internalSessionID, sess, luaSession)
+	}
+	if !lua.HasPending(updates) && sess.deliverInline() {
+		s.deliverUpdates(vendedID, b, batcher, updates, userEvent)
+		return
+	}
+	// Large values are still encoding: deliver from a goroutine so the executor is free,
+	// after any earlier deliveries so updates stay in order
+	sess.deliverAfter(func() {
+		for i := range updates {
+			if err := updates[i].Await(); err != nil {
+				s.Log(1, "ERROR: failed to encode variable %d: %v", updates[i].VarID, err)
+				s.handler.Telemetry().OnError(vendedID, err)
+			}
+		}
+		updates = slices.DeleteFunc(updates, func(u lua.VariableUpdate) bool {
+			return u.Value == nil && len(u.Properties) == 0 && len(u.Removed) == 0
+		})
+		s.deliverUpdates(vendedID, b, batcher, updates, userEvent)
+	})
+}
+
+// deliverUpdates queues a batch's updates to their watchers, then persists them.
+func (s *Server) deliverUpdates(vendedID string, b backend.Backend, batcher *OutgoingBatcher, updates []lua.VariableUpdate, userEvent bool) {
+	if s.persist != nil {
+		// Persist after queueing so storage latency and failures never hold up delivery
+		defer s.persist.write(vendedID, updates)
+	}
+	s.traceUpdates(vendedID, updates)
 	if len(updates) == 0 {
 		// Even with no updates, flush immediately for user events
 		if userEvent && batcher != nil {
@@ -670,21 +1041,29 @@ func (s *Server) AfterBatch(internalSessionID string, userEvent bool) {
 		return
 	}
 
-	// Queue each update to batcher or send directly
+	// Queue each update to batcher or send directly, viewdefs first so no
+	// watcher gets a value whose type it cannot render yet
+	orderUpdates(updates)
 	for _, update := range updates {
 		watchers := b.GetWatchers(update.VarID)
+		if update.Origin != "" {
+			// The sender already shows this value; echoing it would move its caret
+			watchers = slices.DeleteFunc(slices.Clone(watchers), func(connID string) bool { return connID == update.Origin })
+		}
 		if len(watchers) == 0 {
 			continue
 		}
 
 		// Build update message
 		updateMsg, err := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{
-			VarID:      update.VarID,
-			Value:      update.Value,
-			Properties: update.Properties,
+			VarID:            update.VarID,
+			Value:            update.Value,
+			Properties:       update.Properties,
+			RemoveProperties: update.Removed,
 		})
-		if update.Properties["viewdefs"] != "" {
-			s.config.Log(4, "SENDING VIEWDEFS TO ENDPOINT: %#v", update.Properties)
+		if vlog := s.config.Logger(config.LogViewdef); update.Properties["viewdefs"] != "" && vlog.Verbosity() >= 4 {
+			propJson, _ := json.Marshal(update.Properties)
+			vlog.Log(4, "SENDING VIEWDEFS TO ENDPOINT: %s", s.config.Sanitize(string(propJson)))
 		}
 		if err != nil {
 			continue
@@ -693,11 +1072,9 @@ func (s *Server) AfterBatch(internalSessionID string, userEvent bool) {
 		// Queue to batcher or send directly
 		if batcher != nil {
 			batcher.Queue(updateMsg, watchers)
-		} else {
-			// Fallback: send directly (no batching)
-			for _, connID := range watchers {
-				s.wsEndpoint.Send(connID, updateMsg)
-			}
+		} else if data, err := updateMsg.Encode(); err == nil {
+			// Fallback: send directly (no batching), encoded once for all watchers
+			s.wsEndpoint.SendFrame(watchers, data, []*protocol.Message{updateMsg})
 		}
 	}
 
@@ -707,12 +1084,39 @@ func (s *Server) AfterBatch(internalSessionID string, userEvent bool) {
 	}
 }
 
-// ExecuteInSession executes code within a session's context.
+// orderUpdates sorts a batch's updates for sending: viewdefs and their metadata,
+// then updates carrying properties (such as a new type), then plain values,
+// each high to low priority. The sort is stable, so otherwise order is kept.
+// Spec: protocol.md (Priority-based batching)
+func orderUpdates(updates []lua.VariableUpdate) {
+	tier := func(u lua.VariableUpdate) int {
+		switch {
+		case u.Properties["viewdefs"] != "" || u.Properties["viewdefMeta"] != "":
+			return 0
+		case len(u.Properties) > 0 || len(u.Removed) > 0:
+			return 1
+		}
+		return 2
+	}
+	slices.SortStableFunc(updates, func(a, b lua.VariableUpdate) int {
+		return cmp.Or(cmp.Compare(tier(a), tier(b)), cmp.Compare(b.Priority, a.Priority))
+	})
+}
+
+// ExecuteInSession executes code within a session's context as an external write.
 // This queues through the session's executor to serialize with WebSocket operations.
 // AfterBatch is called after execution to detect and push any changes.
 // Also sets up the Lua session context so session:getApp() etc. work.
 // vendedID is the compact session ID ("1", "2", etc.)
 func (s *Server) ExecuteInSession(vendedID string, fn func() (interface{}, error)) (interface{}, error) {
+	return s.ExecuteClass(vendedID, OpExternalWrite, fn)
+}
+
+// ExecuteClass is ExecuteInSession for an operation of any class. fn runs on
+// the Lua executor too, so it must use direct calls such as LoadCodeDirect.
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Session Critical Sections)
+func (s *Server) ExecuteClass(vendedID string, class OpClass, fn func() (interface{}, error)) (interface{}, error) {
 	internalID := s.sessions.GetInternalID(vendedID)
 	if internalID == "" {
 		return nil, fmt.Errorf("session %s not found", vendedID)
@@ -728,7 +1132,7 @@ func (s *Server) ExecuteInSession(vendedID string, fn func() (interface{}, error
 
 	// Delegate to websocket endpoint (queues through session's executor)
 	// Wrap fn to set up Lua session context
-	return s.wsEndpoint.ExecuteInSession(internalID, func() (interface{}, error) {
+	return s.wsEndpoint.ExecuteClass(internalID, class, func() (interface{}, error) {
 		return luaSession.ExecuteInSession(vendedID, fn)
 	})
 }
@@ -790,19 +1194,103 @@ func (s *Server) HandleFrontendCreate(sessionID string, id int64, parentID int64
 
 // HandleFrontendUpdate implements PathVariableHandler.
 // It delegates to the per-session LuaSession.
-func (s *Server) HandleFrontendUpdate(sessionID string, varID int64, value json.RawMessage, properties map[string]string) error {
+func (s *Server) HandleFrontendUpdate(sessionID, connectionID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error {
 	s.luaSessionsMu.RLock()
 	luaSession := s.luaSessions[sessionID]
 	s.luaSessionsMu.RUnlock()
 	if luaSession == nil {
 		return fmt.Errorf("Lua session %s not found", sessionID)
 	}
-	return luaSession.HandleFrontendUpdate(sessionID, varID, value, properties)
+	return luaSession.HandleFrontendUpdate(sessionID, connectionID, varID, value, properties, removed)
+}
+
+// AddVariableDiag implements protocol.DiagRecorder.
+// It keeps the diagnostic in the per-session LuaSession.
+func (s *Server) AddVariableDiag(sessionID string, varID int64, diag string) {
+	s.luaSessionsMu.RLock()
+	luaSession := s.luaSessions[sessionID]
+	s.luaSessionsMu.RUnlock()
+	if luaSession != nil {
+		luaSession.AddVariableDiag(varID, diag)
+	}
+}
+
+// SessionRoots implements protocol.RootLister.
+func (s *Server) SessionRoots(vendedID string) (map[string]int64, int64, error) {
+	luaSession := s.GetLuaSession(vendedID)
+	if luaSession == nil {
+		return nil, 0, fmt.Errorf("session %s not found", vendedID)
+	}
+	roots, meta := luaSession.Roots()
+	return roots, meta, nil
+}
+
+// scheduleChange runs fn on a session's executor and makes change detection
+// follow it. Implements lua.ChangeScheduler for the session's Lua watchers.
+// Without flush the AfterBatch is coalesced with one already queued; with
+// flush it runs in the same task and its updates are sent before returning.
+func (s *Server) scheduleChange(internalID string, fn func(), flush bool) error {
+	if !flush {
+		s.wsEndpoint.queue(internalID, func() {
+			fn()
+			s.wsEndpoint.ScheduleAfterBatch(internalID)
+		})
+		return nil
+	}
+	_, err := s.wsEndpoint.ExecuteClass(internalID, OpExternalWrite, func() (interface{}, error) {
+		fn()
+		return nil, nil
+	})
+	if err == nil {
+		s.wsEndpoint.settle(internalID)
+	}
+	return err
+}
+
+// UpdateSession implements protocol.SessionUpdater for backend updates.
+// The update is applied on the session's executor as a frontend's would be,
+// then each changed property goes through NotifyPropertyChange, so its
+// watchers run and browsers get the update and whatever they changed.
+func (s *Server) UpdateSession(vendedID string, varID int64, value json.RawMessage, properties map[string]string, removed []string) error {
+	internalID := s.sessions.GetInternalID(vendedID)
+	luaSession := s.GetLuaSession(vendedID)
+	if internalID == "" || luaSession == nil {
+		return fmt.Errorf("session %s not found", vendedID)
+	}
+	var err error
+	s.wsEndpoint.queueSync(internalID, func() {
+		err = luaSession.HandleFrontendUpdate(vendedID, "", varID, value, properties, removed)
+	}, func(e error) {
+		err = e
+	})
+	if err != nil {
+		return err
+	}
+	if len(value) > 0 {
+		var goValue interface{}
+		json.Unmarshal(value, &goValue)
+		luaSession.NotifyPropertyChange(vendedID, varID, "value", goValue)
+	}
+	for name, val := range properties {
+		luaSession.NotifyPropertyChange(vendedID, varID, name, val)
+	}
+	for _, name := range removed {
+		luaSession.NotifyPropertyChange(vendedID, varID, name, nil)
+	}
+	return nil
+}
+
+// SessionChanged implements protocol.ChangeNotifier.
+// It marks the Lua session dirty so its next AfterBatch runs change detection.
+func (s *Server) SessionChanged(vendedID string) {
+	if luaSession := s.GetLuaSession(vendedID); luaSession != nil {
+		luaSession.MarkDirty()
+	}
 }
 
 // getDebugVariables returns all variables in topological order from a tracker.
 // CRC: crc-HTTPEndpoint.md (R57, R59, R60, R61)
-func (s *Server) getDebugVariables(tracker *changetracker.Tracker) ([]DebugVariable, error) {
+func (s *Server) getDebugVariables(tracker *changetracker.Tracker, luaSession *lua.LuaSession) ([]DebugVariable, error) {
 	allVars := tracker.Variables()
 
 	// Build map for quick lookup and depth computation
@@ -897,6 +1385,15 @@ func (s *Server) getDebugVariables(tracker *changetracker.Tracker) ([]DebugVaria
 		if len(v.Diags) > 0 {
 			info.Diags = v.Diags
 		}
+		if diags := luaSession.VariableDiags(v.ID); len(diags) > 0 {
+			info.Diags = append(slices.Clip(info.Diags), diags...)
+		}
+		if s.viewdefManager != nil {
+			if diags := s.viewdefManager.A11yDiags(info.Type); len(diags) > 0 {
+				// Clip so the tracker's Diags slice is never appended to
+				info.Diags = append(slices.Clip(info.Diags), diags...)
+			}
+		}
 		if v.Error != nil {
 			info.Error = v.Error.Error()
 		}
@@ -933,12 +1430,13 @@ func (s *Server) StartAsync(port int) (string, error) {
 		return "", err
 	}
 
-	s.config.Log(0, "HTTP server listening on %s", url)
-	s.config.Log(0, "Serving site from directory: %s", s.HttpEndpoint.staticDir)
+	s.Log(0, "HTTP server listening on %s", url)
+	s.Log(0, "Serving site from directory: %s", s.HttpEndpoint.staticDir)
 
 	go func() {
+		defer s.RecoverCrash("http")
 		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
-			s.config.Log(0, "HTTP server error: %v", err)
+			s.Log(0, "HTTP server error: %v", err)
 		}
 	}()
 
@@ -951,10 +1449,12 @@ func (s *Server) preloadMainLuaFromBundleToConfig() {
 	content, err := bundle.ReadFile("lua/main.lua")
 	if err != nil {
 		// No main.lua in bundle - OK for hybrid/backend-only modes
+		s.luaConfig.mainLuaCode.Store(nil)
 		return
 	}
-	s.luaConfig.mainLuaCode = string(content)
-	s.config.Log(0, "Preloaded main.lua from bundle")
+	code := string(content)
+	s.luaConfig.mainLuaCode.Store(&code)
+	s.Log(0, "Preloaded main.lua from bundle")
 }
 
 // luaTrackerAdapter adapts variable.Store to lua.VariableStore interface.
@@ -966,7 +1466,10 @@ type luaTrackerAdapter struct {
 	luaSessions     map[string]*lua.LuaSession     // vendedID -> LuaSession
 	varToSession    map[int64]string               // variableID -> sessionID
 	nextServerVarId map[string]int64               // vendedID -> next negative ID (starts at -1, decrements)
+	pools           map[string]*internPool         // vendedID -> pool of large values
 	mu              sync.RWMutex
+	// variableID -> last encoded value, dropped when the value changes
+	jsonCache map[int64]json.RawMessage
 }
 
 // SetViewdefManager sets the viewdef manager for sending viewdefs to frontend.
@@ -998,10 +1501,12 @@ func (a *luaTrackerAdapter) RemoveBackend(sessionID string) {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 	delete(a.backends, sessionID)
+	delete(a.pools, sessionID)
 	// Clean up varToSession
 	for varID, sid := range a.varToSession {
 		if sid == sessionID {
 			delete(a.varToSession, varID)
+			delete(a.jsonCache, varID)
 		}
 	}
 }
@@ -1055,10 +1560,27 @@ func (a *luaTrackerAdapter) DestroySession(sessionID string) {
 	for varID, sid := range a.varToSession {
 		if sid == sessionID {
 			delete(a.varToSession, varID)
+			delete(a.jsonCache, varID)
 		}
 	}
 }
 
+// pruneVariables removes a session's varToSession entries for variables its
+// tracker no longer has, returning how many it removed.
+func (a *luaTrackerAdapter) pruneVariables(sessionID string, tracker *changetracker.Tracker) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	pruned := 0
+	for varID, sid := range a.varToSession {
+		if sid == sessionID && tracker.GetVariable(varID) == nil {
+			delete(a.varToSession, varID)
+			delete(a.jsonCache, varID)
+			pruned++
+		}
+	}
+	return pruned
+}
+
 // GetTracker returns the tracker for a session.
 func (a *luaTrackerAdapter) GetTracker(sessionID string) *changetracker.Tracker {
 	a.mu.RLock()
@@ -1072,45 +1594,80 @@ func (a *luaTrackerAdapter) GetTracker(sessionID string) *changetracker.Tracker
 // CreateVariable creates a variable using the session's tracker.
 // Spec: protocol.md - Server uses positive ID 1 for root, negative IDs for others.
 // Root variable (parentID == 0) uses auto-assigned ID (1).
-// Non-root server variables use negative IDs starting from -1.
+// Non-root server variables use negative IDs starting from -1; one with a
+// "path" property takes its value from the parent through that path.
 func (a *luaTrackerAdapter) CreateVariable(sessionID string, parentID int64, luaObject *gopher.LTable, properties map[string]string) (int64, error) {
 	a.mu.Lock()
 	lb := a.backends[sessionID]
+	a.mu.Unlock()
 	if lb == nil {
-		a.mu.Unlock()
 		return 0, fmt.Errorf("session %s not found", sessionID)
 	}
-	tracker := lb.GetTracker()
-
-	var v *changetracker.Variable
-	var id int64
-
-	if parentID == 0 {
-		// Root variable - use auto-assigned ID (will be 1)
-		v = tracker.CreateVariable(luaObject, parentID, "", properties)
-		id = v.ID
-	} else {
+	properties = a.limitProperties(sessionID, properties)
+	if parentID != 0 {
 		// Non-root server variable - use negative ID
-		id = a.nextServerVarId[sessionID]
-		a.nextServerVarId[sessionID]--
-		a.mu.Unlock()
+		return a.createServerVariable(sessionID, lb, parentID, luaObject, properties)
+	}
 
-		v = tracker.CreateVariableWithId(id, luaObject, parentID, "", properties)
-		if v == nil {
-			return 0, fmt.Errorf("variable ID %d already in use", id)
-		}
+	// Root variable - use auto-assigned ID (will be 1)
+	v := lb.GetTracker().CreateVariable(luaObject, parentID, "", properties)
+	id := v.ID
+
+	a.config.Log(0, "CREATED ROOT LUA VARIABLE id=%d, type=%s", id, v.Properties["type"])
+	a.countCreated(v)
+	lb.TrackVariable(id)
+	return id, nil
+}
 
-		a.config.Log(0, "CREATED LUA VARIABLE id=%d, type=%s", id, v.Properties["type"])
-		lb.TrackVariable(id)
-		return id, nil
+// CreateRootVariable creates a named root variable (see lua.NamedRootStore).
+// Like other server variables it gets a negative ID, so it cannot collide with
+// IDs the frontend vends.
+func (a *luaTrackerAdapter) CreateRootVariable(sessionID string, luaObject *gopher.LTable, properties map[string]string) (int64, error) {
+	a.mu.Lock()
+	lb := a.backends[sessionID]
+	a.mu.Unlock()
+	if lb == nil {
+		return 0, fmt.Errorf("session %s not found", sessionID)
 	}
+	properties = a.limitProperties(sessionID, properties)
+	return a.createServerVariable(sessionID, lb, 0, luaObject, properties)
+}
+
+// createServerVariable creates a variable with the session's next negative ID.
+func (a *luaTrackerAdapter) createServerVariable(sessionID string, lb *backend.LuaBackend, parentID int64, luaObject *gopher.LTable, properties map[string]string) (int64, error) {
+	a.mu.Lock()
+	id := a.nextServerVarId[sessionID]
+	a.nextServerVarId[sessionID]--
 	a.mu.Unlock()
 
-	a.config.Log(0, "CREATED ROOT LUA VARIABLE id=%d, type=%s", id, v.Properties["type"])
+	// A path property makes a child the tracker resolves from its parent
+	var value any = luaObject
+	path := properties["path"]
+	if path != "" {
+		value = nil
+	}
+	v := lb.GetTracker().CreateVariableWithId(id, value, parentID, path, properties)
+	if v == nil {
+		return 0, fmt.Errorf("variable ID %d already in use", id)
+	}
+
+	a.config.Log(0, "CREATED LUA VARIABLE id=%d, type=%s", id, v.Properties["type"])
+	a.countCreated(v)
 	lb.TrackVariable(id)
+	a.mu.Lock()
+	a.varToSession[id] = sessionID // So Destroy finds it
+	delete(a.jsonCache, id)
+	a.mu.Unlock()
 	return id, nil
 }
 
+// countCreated adds a created variable to its type's viewdef usage.
+func (a *luaTrackerAdapter) countCreated(v *changetracker.Variable) {
+	if a.viewdefManager != nil {
+		a.viewdefManager.CountCreated(v.Properties["type"])
+	}
+}
+
 // CreatePathVariable creates a path-based variable initiated by the frontend.
 // This is called when the frontend creates a variable with parentId and path property.
 // The variable is created in the parent's tracker, which resolves the path.
@@ -1143,6 +1700,7 @@ func (a *luaTrackerAdapter) CreatePathVariable(parentID int64, path string, prop
 	// Track which session owns this variable
 	a.mu.Lock()
 	a.varToSession[id] = sessionID
+	delete(a.jsonCache, id)
 	a.mu.Unlock()
 
 	// Get the resolved value
@@ -1161,19 +1719,27 @@ func (a *luaTrackerAdapter) CreatePathVariable(parentID int64, path string, prop
 	return id, jsonValue, nil
 }
 
-// Get retrieves a variable's value and properties.
+// Get retrieves a variable's value and properties. The value is encoded once
+// and reused until change detection reports it changed.
 func (a *luaTrackerAdapter) Get(id int64) (json.RawMessage, map[string]string, bool) {
 	// First try the backend's tracker
 	a.mu.RLock()
 	sessionID, ok := a.varToSession[id]
 	if ok {
 		lb := a.backends[sessionID]
+		cached, hit := a.jsonCache[id]
 		a.mu.RUnlock()
 		if lb != nil {
 			tracker := lb.GetTracker()
 			v := tracker.GetVariable(id)
 			if v != nil {
-				jsonBytes, _ := tracker.ToValueJSONBytes(v.Value)
+				if hit {
+					return cached, v.Properties, true
+				}
+				jsonBytes, err := tracker.ToValueJSONBytes(v.Value)
+				if err == nil {
+					a.cacheJSON(id, sessionID, jsonBytes)
+				}
 				return jsonBytes, v.Properties, true
 			}
 		}
@@ -1183,6 +1749,20 @@ func (a *luaTrackerAdapter) Get(id int64) (json.RawMessage, map[string]string, b
 	return nil, nil, false
 }
 
+// cacheJSON stores a variable's encoded value, unless the variable has since
+// been destroyed or reassigned to another session.
+func (a *luaTrackerAdapter) cacheJSON(id int64, sessionID string, value json.RawMessage) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.varToSession[id] != sessionID {
+		return
+	}
+	if a.jsonCache == nil {
+		a.jsonCache = make(map[int64]json.RawMessage)
+	}
+	a.jsonCache[id] = value
+}
+
 // GetProperty retrieves a property value.
 func (a *luaTrackerAdapter) GetProperty(id int64, name string) (string, bool) {
 	// First try the backend's tracker
@@ -1195,8 +1775,8 @@ func (a *luaTrackerAdapter) GetProperty(id int64, name string) (string, bool) {
 			tracker := lb.GetTracker()
 			v := tracker.GetVariable(id)
 			if v != nil {
-				val := v.GetProperty(name)
-				return val, val != ""
+				val, ok := v.Properties[name]
+				return val, ok
 			}
 		}
 	} else {
@@ -1210,17 +1790,38 @@ func (a *luaTrackerAdapter) Update(id int64, value json.RawMessage, properties m
 	return nil
 }
 
+// WatcherCount returns the number of frontend watches on a variable.
+// Implements lua.WatchCounter.
+func (a *luaTrackerAdapter) WatcherCount(sessionID string, varID int64) int {
+	a.mu.RLock()
+	lb := a.backends[sessionID]
+	a.mu.RUnlock()
+	if lb == nil {
+		return 0
+	}
+	return lb.GetWatcherCount(varID)
+}
+
 // Destroy removes a variable.
 func (a *luaTrackerAdapter) Destroy(id int64) error {
-	// Remove from backend's tracker
+	// Remove from backend (tracker, descendants, and watch tables)
 	a.mu.Lock()
 	sessionID, ok := a.varToSession[id]
 	if ok {
 		if lb := a.backends[sessionID]; lb != nil {
-			lb.GetTracker().DestroyVariable(id)
-			lb.UntrackVariable(id)
+			destroyed := lb.DestroyVariable(id)
+			for _, d := range destroyed {
+				delete(a.varToSession, d)
+				delete(a.jsonCache, d)
+			}
+			if p := a.pools[sessionID]; p != nil {
+				for _, d := range destroyed {
+					p.release(d)
+				}
+			}
 		}
 		delete(a.varToSession, id)
+		delete(a.jsonCache, id)
 	}
 	a.mu.Unlock()
 	return nil
@@ -1232,12 +1833,17 @@ func (a *luaTrackerAdapter) DetectChanges(sessionID string) bool {
 	lb := a.backends[sessionID]
 	a.mu.RUnlock()
 	if lb != nil {
+		// Watches that arrived before their variable existed (e.g. variable 1 in
+		// connected-backend mode) get a full update once it does
+		if resolved := lb.ResolveDeferredWatches(); len(resolved) > 0 {
+			a.config.Log(2, "Session %s: deferred watches resolved %v", sessionID, resolved)
+		}
 		return lb.GetTracker().DetectChanges()
 	}
 	return false
 }
 
-// DetectChanges returns changes for a session.
+// GetChanges returns changes for a session, pooling large changed values.
 func (a *luaTrackerAdapter) GetChanges(sessionID string) []changetracker.Change {
 	a.mu.RLock()
 	lb := a.backends[sessionID]
@@ -1247,7 +1853,26 @@ func (a *luaTrackerAdapter) GetChanges(sessionID string) []changetracker.Change
 		return nil
 	}
 
-	return lb.GetTracker().GetChanges()
+	tracker := lb.GetTracker()
+	changes := tracker.GetChanges()
+	pool := a.pool(sessionID)
+	pool.sweep(tracker)
+	a.mu.Lock()
+	for _, change := range changes {
+		if change.ValueChanged {
+			delete(a.jsonCache, change.VariableID)
+		}
+	}
+	a.mu.Unlock()
+	for _, change := range changes {
+		if !change.ValueChanged {
+			continue
+		}
+		if v := tracker.GetVariable(change.VariableID); v != nil {
+			pool.intern(v)
+		}
+	}
+	return changes
 }
 
 // updateVariable1Viewdefs updates variable 1's viewdefs property with new viewdefs.
@@ -1256,10 +1881,18 @@ func (a *luaTrackerAdapter) updateVariable1Viewdefs(sessionID string, viewdefs m
 	// Serialize viewdefs as JSON
 	viewdefsJSON, err := json.Marshal(viewdefs)
 	if err != nil {
-		a.config.Log(0, "Warning: failed to marshal viewdefs: %v", err)
+		a.config.Logger(config.LogViewdef).Log(0, "Warning: failed to marshal viewdefs: %v", err)
 		return
 	}
 
 	lb := a.backends[sessionID]
-	lb.GetTracker().GetVariable(1).SetProperty("viewdefs", string(viewdefsJSON))
+	if lb == nil {
+		return
+	}
+	v1 := lb.GetTracker().GetVariable(1)
+	if v1 == nil {
+		a.config.Logger(config.LogViewdef).Log(2, "Session %s: variable 1 not created yet, viewdefs left pending", sessionID)
+		return
+	}
+	v1.SetProperty("viewdefs", string(viewdefsJSON))
 }
@@ -6,10 +6,13 @@ package server
 import (
 	"crypto/rand"
 	"encoding/hex"
+	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/protocol"
 )
 
 // Session represents a single user session.
@@ -25,8 +28,26 @@ type Session struct {
 	lastActivity  time.Time
 	mu            sync.RWMutex
 	batchCount    int
+	browserPrefs  json.RawMessage        // Variable browser preferences (JSON object)
+	request       *SessionRequest        // Browser request that created the session (nil if none)
+	lastDelivery  chan struct{}          // Closed when the most recent async update delivery finishes
+	quota         sessionQuota           // Transfer usage in the current quota window
+	cspNonce      string                 // Script nonce for viewdefs (see CSPNonce)
+	group         string                 // Session group name ("" = none); fixed at creation
+	notice        string                 // Error code for the next connection (see hibernate.go)
+	objectGC      *ObjectGCStats         // Most recent object collection (see objectgc.go)
+	objectGCMark  int64                  // Tracker's next object ID at that collection
+	drainMessage  string                 // Banner shown while draining (see drain.go)
+	drainDeadline time.Time              // When a draining session is destroyed; zero if not draining
+	trace         *protocol.SessionTrace // Full message logging for this session (see trace.go)
+	variables     atomic.Int64           // Tracker variables after the last batch (with --metrics or store limits)
+	variableBytes atomic.Int64           // Their estimated size (see lua.LuaSession.StoreUsage)
+	batchPending  atomic.Bool            // A scheduled AfterBatch is queued (see ScheduleAfterBatch)
 }
 
+// MaxBrowserPrefsSize caps the stored variable browser preferences.
+const MaxBrowserPrefsSize = 4096
+
 // NewSession creates a new session with the given ID.
 func NewSession(id string) *Session {
 	now := time.Now()
@@ -171,9 +192,69 @@ func (s *Session) GetConnections() []string {
 	return conns
 }
 
+// GetBrowserPrefs returns the variable browser preferences, or nil if none are set.
+func (s *Session) GetBrowserPrefs() json.RawMessage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.browserPrefs
+}
+
+// SetBrowserPrefs stores the variable browser preferences.
+// The caller validates the JSON and its size.
+func (s *Session) SetBrowserPrefs(prefs json.RawMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.browserPrefs = prefs
+}
+
 // GenerateSessionID creates a unique session identifier.
 func GenerateSessionID() string {
 	bytes := make([]byte, 16)
 	rand.Read(bytes)
 	return hex.EncodeToString(bytes)
 }
+
+// deliverInline reports whether updates can be delivered on the caller's goroutine,
+// i.e. no asynchronous delivery is still in flight.
+func (s *Session) deliverInline() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastDelivery == nil {
+		return true
+	}
+	select {
+	case <-s.lastDelivery:
+		s.lastDelivery = nil
+		return true
+	default:
+		return false
+	}
+}
+
+// deliveriesDone returns a channel closed once the asynchronous deliveries started so far finish.
+func (s *Session) deliveriesDone() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lastDelivery != nil {
+		return s.lastDelivery
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+// deliverAfter runs deliver on a goroutine once earlier asynchronous deliveries finish.
+func (s *Session) deliverAfter(deliver func()) {
+	done := make(chan struct{})
+	s.mu.Lock()
+	prev := s.lastDelivery
+	s.lastDelivery = done
+	s.mu.Unlock()
+	go func() {
+		defer close(done)
+		if prev != nil {
+			<-prev
+		}
+		deliver()
+	}()
+}
@@ -0,0 +1,198 @@
+// CRC: crc-SessionManager.md
+// Spec: interfaces.md (Session Groups)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+)
+
+var groupNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// validGroupName reports whether name can be used as a session group.
+func validGroupName(name string) bool {
+	return groupNamePattern.MatchString(name)
+}
+
+// Group returns the session's group name, or "" if it is not in a group.
+func (s *Session) Group() string {
+	return s.group
+}
+
+// CreateSessionInGroup creates a session in a group, like a browser request with ?group=.
+func (m *SessionManager) CreateSessionInGroup(group string) (*Session, string, error) {
+	return m.createSession(GenerateSessionID(), nil, group)
+}
+
+func (m *SessionManager) joinGroupLocked(group, internalID string) {
+	if group == "" {
+		return
+	}
+	members := m.groups[group]
+	if members == nil {
+		members = make(map[string]struct{})
+		m.groups[group] = members
+	}
+	members[internalID] = struct{}{}
+}
+
+func (m *SessionManager) leaveGroupLocked(group, internalID string) {
+	members := m.groups[group]
+	if members == nil {
+		return
+	}
+	delete(members, internalID)
+	if len(members) == 0 {
+		delete(m.groups, group)
+	}
+}
+
+// GroupMembers returns the vended IDs of a group's sessions.
+func (m *SessionManager) GroupMembers(group string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	ids := make([]string, 0, len(m.groups[group]))
+	for internalID := range m.groups[group] {
+		ids = append(ids, m.internalToVended[internalID])
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// DestroyGroup destroys every session in a group.
+// Returns the number of sessions destroyed.
+func (m *SessionManager) DestroyGroup(group string) int {
+	m.mu.RLock()
+	ids := make([]string, 0, len(m.groups[group]))
+	for internalID := range m.groups[group] {
+		ids = append(ids, internalID)
+	}
+	m.mu.RUnlock()
+
+	for _, id := range ids {
+		m.DestroySession(id)
+	}
+	return len(ids)
+}
+
+// SessionInfo summarizes a session for `ui-engine sessions`.
+type SessionInfo struct {
+	ID           string         `json:"id"` // Vended ID
+	Group        string         `json:"group,omitempty"`
+	Connections  int            `json:"connections"`
+	Created      time.Time      `json:"created"`
+	LastActivity time.Time      `json:"lastActivity"`
+	Routes       []URLRoute     `json:"routes,omitempty"`    // Only with ?routes=1
+	GC           *ObjectGCStats `json:"gc,omitempty"`        // Most recent object collection
+	DrainUntil   time.Time      `json:"drainUntil,omitzero"` // When a draining session ends
+	TraceUntil   time.Time      `json:"traceUntil,omitzero"` // When a traced session's trace ends
+	Variables    int            `json:"variables,omitempty"` // Tracked variables, only with ?variables=1
+}
+
+// List returns a summary of every session, ordered by vended ID.
+func (m *SessionManager) List() []SessionInfo {
+	m.mu.RLock()
+	infos := make([]SessionInfo, 0, len(m.sessions))
+	for internalID, sess := range m.sessions {
+		infos = append(infos, SessionInfo{
+			ID:           m.internalToVended[internalID],
+			Group:        sess.group,
+			Connections:  sess.GetConnectionCount(),
+			Created:      sess.GetCreatedAt(),
+			LastActivity: sess.GetLastActivity(),
+			GC:           sess.ObjectGC(),
+			DrainUntil:   sess.DrainDeadline(),
+			TraceUntil:   traceUntil(sess.Trace()),
+		})
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+// variableCount returns how many variables a session tracks, counted on its
+// executor, or 0 if it has no Lua session.
+func (s *Server) variableCount(vendedID string) int {
+	count, err := s.ExecuteInSession(vendedID, func() (interface{}, error) {
+		return len(s.GetLuaSession(vendedID).GetTracker().Variables()), nil
+	})
+	if err != nil {
+		return 0
+	}
+	return count.(int)
+}
+
+// groupBroadcast delivers a broadcast to every session in a group, each on its
+// own executor. The payload is JSON, so no Lua values cross session boundaries.
+// Returns the number of sessions it was sent to.
+func (s *Server) groupBroadcast(group, name string, payload []byte, from string) int {
+	members := s.sessions.GroupMembers(group)
+	for _, vendedID := range members {
+		s.ExecuteInSessionAsync(vendedID, func() (interface{}, error) {
+			luaSession := s.GetLuaSession(vendedID)
+			if luaSession == nil {
+				return nil, nil
+			}
+			if err := luaSession.DeliverGroupBroadcast(name, payload, from); err != nil {
+				s.Log(0, "Session %s: %v", vendedID, err)
+				s.handler.Telemetry().OnError(vendedID, err)
+			}
+			return nil, nil
+		})
+	}
+	return len(members)
+}
+
+// DestroyGroup tears down every session in a group together.
+// Returns the number of sessions destroyed.
+func (s *Server) DestroyGroup(group string) int {
+	n := s.sessions.DestroyGroup(group)
+	s.Log(1, "Destroyed session group %s (%d sessions)", group, n)
+	return n
+}
+
+// handleSessionList serves GET /api/debug/sessions[?group=name][&routes=1], and
+// DELETE /api/debug/sessions?group=name, which destroys the group.
+func (s *Server) handleSessionList(w http.ResponseWriter, r *http.Request) {
+	group := r.URL.Query().Get("group")
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodDelete:
+		if group == "" {
+			http.Error(w, "group required", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"destroyed": s.DestroyGroup(group)})
+		return
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	infos := s.sessions.List()
+	if group != "" {
+		filtered := infos[:0]
+		for _, info := range infos {
+			if info.Group == group {
+				filtered = append(filtered, info)
+			}
+		}
+		infos = filtered
+	}
+	if r.URL.Query().Get("routes") != "" {
+		for i := range infos {
+			infos[i].Routes = s.sessions.ListURLPaths(s.sessions.GetInternalID(infos[i].ID))
+		}
+	}
+	if r.URL.Query().Get("variables") != "" {
+		for i := range infos {
+			infos[i].Variables = s.variableCount(infos[i].ID)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(infos)
+}
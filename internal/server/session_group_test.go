@@ -0,0 +1,150 @@
+// CRC: crc-SessionManager.md
+// Spec: interfaces.md
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	gopher "github.com/yuin/gopher-lua"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestSessionGroupBroadcast verifies ?group= membership, session.group, JSON
+// broadcasts to every member, the session listing and group destroy
+func TestSessionGroupBroadcast(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		received = {}
+		function ui.onGroupBroadcast(name, payload, from)
+			table.insert(received, name .. ":" .. payload.panel .. ":" .. from .. ":" .. tostring(session.group))
+		end
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	for _, path := range []string{"/?group=wall1", "/?group=wall1", "/"} {
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusTemporaryRedirect {
+			t.Fatalf("GET %s = %d", path, w.Code)
+		}
+	}
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/?group=bad%20name", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid group = %d, want 400", w.Code)
+	}
+	if _, vendedID, err := s.sessions.CreateSessionInGroup("wall2"); err != nil || vendedID != "4" {
+		t.Fatalf("CreateSessionInGroup = %q, %v", vendedID, err)
+	}
+	if members := s.sessions.GroupMembers("wall1"); !slices.Equal(members, []string{"1", "2"}) {
+		t.Fatalf("wall1 members = %v", members)
+	}
+
+	// Members 1 and 2 each get the broadcast on their own executor; 3 is not in the group
+	sent, err := s.GetLuaSession("1").LoadCode("broadcast", `return ui.groupBroadcast("wall1", "focus", {panel = "left"})`)
+	if err != nil || sent != float64(2) {
+		t.Fatalf("ui.groupBroadcast = %v, %v; want 2", sent, err)
+	}
+	// Deliveries are queued asynchronously; wait for each member's executor to settle
+	for _, vendedID := range []string{"1", "2"} {
+		s.wsEndpoint.settle(s.sessions.GetInternalID(vendedID))
+	}
+	for vendedID, want := range map[string][]string{
+		"1": {"focus:left:1:wall1"},
+		"2": {"focus:left:1:wall1"},
+		"3": nil,
+	} {
+		var got []string
+		s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			received := s.GetLuaSession(vendedID).State.GetGlobal("received").(*gopher.LTable)
+			received.ForEach(func(_, v gopher.LValue) { got = append(got, v.String()) })
+			return nil, nil
+		})
+		if !slices.Equal(got, want) {
+			t.Errorf("session %s received %v, want %v", vendedID, got, want)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/sessions", nil))
+	var infos []SessionInfo
+	json.NewDecoder(w.Body).Decode(&infos)
+	var groups []string
+	for _, info := range infos {
+		groups = append(groups, info.ID+"="+info.Group)
+	}
+	if !slices.Equal(groups, []string{"1=wall1", "2=wall1", "3=", "4=wall2"}) {
+		t.Errorf("session list = %v", groups)
+	}
+	if infos[0].Routes != nil {
+		t.Errorf("routes listed without ?routes=1: %v", infos[0].Routes)
+	}
+
+	s.sessions.RegisterURLPath(s.sessions.GetInternalID("3"), "/docs/*", 7, false)
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/sessions?routes=1", nil))
+	infos = nil
+	json.NewDecoder(w.Body).Decode(&infos)
+	if len(infos) != 4 || !slices.Equal(infos[2].Routes, []URLRoute{{Path: "/docs/*", VariableID: 7}}) {
+		t.Errorf("session list with routes = %+v", infos)
+	}
+
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/debug/sessions?group=wall1", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("destroy group = %d", w.Code)
+	}
+	if ids := s.GetSessionIDs(); len(ids) != 2 || s.GetLuaSession("1") != nil || s.GetLuaSession("2") != nil {
+		t.Errorf("sessions after group destroy = %v", ids)
+	}
+	if members := s.sessions.GroupMembers("wall1"); len(members) != 0 {
+		t.Errorf("wall1 still has members %v", members)
+	}
+}
+
+// TestSessionListVariables verifies GetSessionCount and that the session
+// listing reports each session's variable count only with ?variables=1
+func TestSessionListVariables(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		session:createAppVariable({name = "app"})
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	for range 2 {
+		if _, _, err := s.sessions.CreateSession(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.GetSessionCount(); n != 2 {
+		t.Errorf("GetSessionCount = %d, want 2", n)
+	}
+	list := func(query string) []SessionInfo {
+		w := httptest.NewRecorder()
+		s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/sessions"+query, nil))
+		var infos []SessionInfo
+		json.NewDecoder(w.Body).Decode(&infos)
+		return infos
+	}
+	if infos := list(""); len(infos) != 2 || infos[0].Variables != 0 {
+		t.Errorf("session list without ?variables=1 = %+v", infos)
+	}
+	if infos := list("?variables=1"); len(infos) != 2 || infos[0].Variables != 1 || infos[1].Variables != 1 {
+		t.Errorf("session list with variables = %+v", infos)
+	}
+}
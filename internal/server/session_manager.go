@@ -3,6 +3,7 @@
 package server
 
 import (
+	"net/http"
 	"strconv"
 	"sync"
 	"time"
@@ -19,10 +20,14 @@ type SessionDestroyedCallback func(vendedID string, session *Session)
 // SessionManager manages all sessions.
 type SessionManager struct {
 	sessions           map[string]*Session
-	urlPaths           map[string]map[string]int64 // sessionID -> path -> variableID
+	urlPaths           map[string]map[string]int64    // sessionID -> path -> variableID
+	groups             map[string]map[string]struct{} // group name -> internal session IDs
 	sessionTimeout     time.Duration
 	onSessionCreated   SessionCreatedCallback
 	onSessionDestroyed SessionDestroyedCallback
+	hibernation        *hibernation     // nil = idle sessions are destroyed
+	now                func() time.Time // Clock for idle and retention checks
+	closed             bool             // Shutting down: no new or rehydrated sessions
 	mu                 sync.RWMutex
 
 	// Vended ID mapping for backend communication
@@ -36,13 +41,26 @@ func NewSessionManager(sessionTimeout time.Duration) *SessionManager {
 	return &SessionManager{
 		sessions:         make(map[string]*Session),
 		urlPaths:         make(map[string]map[string]int64),
+		groups:           make(map[string]map[string]struct{}),
 		sessionTimeout:   sessionTimeout,
+		now:              time.Now,
 		nextVendedID:     1, // Vended IDs start at 1
 		internalToVended: make(map[string]string),
 		vendedToInternal: make(map[string]string),
 	}
 }
 
+// errSessionsClosed refuses sessions once the server is shutting down.
+var errSessionsClosed = &SessionDeniedError{Status: http.StatusServiceUnavailable, Message: "server shutting down"}
+
+// StopAccepting refuses new and rehydrated sessions from now on; existing
+// sessions are unaffected.
+func (m *SessionManager) StopAccepting() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.closed = true
+}
+
 // SetOnSessionCreated sets a callback called when a session is created.
 func (m *SessionManager) SetOnSessionCreated(callback SessionCreatedCallback) {
 	m.onSessionCreated = callback
@@ -59,11 +77,34 @@ func (m *SessionManager) SetOnSessionDestroyed(callback SessionDestroyedCallback
 // - Lua main.lua calling session:createAppVariable() (Lua-only mode)
 // - External backend via protocol (backend-only mode)
 func (m *SessionManager) CreateSession() (*Session, string, error) {
-	internalID := GenerateSessionID()
+	return m.CreateSessionForRequest(nil)
+}
+
+// CreateSessionForRequest creates a session on behalf of a browser request.
+// The request is available to the creation callback through Session.Request.
+// A group query parameter (?group=wall1) puts the session in that group.
+func (m *SessionManager) CreateSessionForRequest(req *SessionRequest) (*Session, string, error) {
+	var group string
+	if req != nil {
+		group = req.Query["group"]
+	}
+	return m.createSession(GenerateSessionID(), req, group)
+}
+
+func (m *SessionManager) createSession(internalID string, req *SessionRequest, group string) (*Session, string, error) {
+	if group != "" && !validGroupName(group) {
+		return nil, "", &SessionDeniedError{Status: http.StatusBadRequest, Message: "invalid session group"}
+	}
 
 	session := NewSession(internalID)
+	session.request = req
+	session.group = group
 
 	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return nil, "", errSessionsClosed
+	}
 	// Assign vended ID
 	vendedID := strconv.FormatInt(m.nextVendedID, 10)
 	m.nextVendedID++
@@ -72,6 +113,7 @@ func (m *SessionManager) CreateSession() (*Session, string, error) {
 
 	m.sessions[internalID] = session
 	m.urlPaths[internalID] = make(map[string]int64)
+	m.joinGroupLocked(group, internalID)
 	m.mu.Unlock()
 
 	// Call callback to create Lua session (if enabled)
@@ -84,6 +126,7 @@ func (m *SessionManager) CreateSession() (*Session, string, error) {
 			delete(m.urlPaths, internalID)
 			delete(m.internalToVended, internalID)
 			delete(m.vendedToInternal, vendedID)
+			m.leaveGroupLocked(group, internalID)
 			m.mu.Unlock()
 			return nil, "", err
 		}
@@ -143,6 +186,7 @@ func (m *SessionManager) DestroySession(id string) error {
 	delete(m.sessions, id)
 	delete(m.urlPaths, id)
 	delete(m.internalToVended, id)
+	m.leaveGroupLocked(session.group, id)
 	if vendedID != "" {
 		delete(m.vendedToInternal, vendedID)
 	}
@@ -171,34 +215,6 @@ func (m *SessionManager) SessionExists(id string) bool {
 	return ok
 }
 
-// RegisterURLPath associates a URL path with a presenter variable for a session.
-func (m *SessionManager) RegisterURLPath(sessionID, path string, variableID int64) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	paths, ok := m.urlPaths[sessionID]
-	if !ok {
-		return nil // Session doesn't exist
-	}
-
-	paths[path] = variableID
-	return nil
-}
-
-// ResolveURLPath finds the presenter variable for a URL path in a session.
-func (m *SessionManager) ResolveURLPath(sessionID, path string) (int64, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	paths, ok := m.urlPaths[sessionID]
-	if !ok {
-		return 0, false
-	}
-
-	varID, ok := paths[path]
-	return varID, ok
-}
-
 // GetAllSessions returns all sessions.
 func (m *SessionManager) GetAllSessions() []*Session {
 	m.mu.RLock()
@@ -211,14 +227,18 @@ func (m *SessionManager) GetAllSessions() []*Session {
 	return sessions
 }
 
-// CleanupInactiveSessions removes sessions with no activity past the timeout.
+// CleanupInactiveSessions removes sessions with no activity past the timeout,
+// hibernating them instead when hibernation is enabled.
 func (m *SessionManager) CleanupInactiveSessions() int {
+	m.expireHibernated()
 	if m.sessionTimeout == 0 {
 		return 0 // Never cleanup
 	}
 
 	m.mu.RLock()
-	cutoff := time.Now().Add(-m.sessionTimeout)
+	// Activity times come from time.Now, so the comparison uses the monotonic
+	// clock and a wall clock jump does not expire every session at once
+	cutoff := m.now().Add(-m.sessionTimeout)
 	var toRemove []string
 
 	for id, session := range m.sessions {
@@ -229,12 +249,40 @@ func (m *SessionManager) CleanupInactiveSessions() int {
 	m.mu.RUnlock()
 
 	for _, id := range toRemove {
-		m.DestroySession(id)
+		if m.hibernation != nil {
+			m.HibernateSession(id)
+		} else {
+			m.DestroySession(id)
+		}
 	}
 
 	return len(toRemove)
 }
 
+// EvictIdle removes the least recently active session with no connections,
+// other than exclude, as CleanupInactiveSessions would. Returns its vended ID,
+// or "" if every other session has a connection.
+func (m *SessionManager) EvictIdle(exclude string) string {
+	var victim *Session
+	for _, session := range m.GetAllSessions() {
+		if session.ID != exclude && !session.IsActive() &&
+			(victim == nil || session.GetLastActivity().Before(victim.GetLastActivity())) {
+			victim = session
+		}
+	}
+	// Checked again in case a connection arrived meanwhile
+	if victim == nil || victim.IsActive() {
+		return ""
+	}
+	vendedID := m.GetVendedID(victim.ID)
+	if m.hibernation != nil {
+		m.HibernateSession(victim.ID)
+	} else {
+		m.DestroySession(victim.ID)
+	}
+	return vendedID
+}
+
 // Count returns the number of sessions.
 func (m *SessionManager) Count() int {
 	m.mu.RLock()
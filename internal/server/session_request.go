@@ -0,0 +1,75 @@
+// CRC: crc-SessionManager.md
+// Spec: interfaces.md
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SessionRequest describes the browser request that is creating a session.
+// Passed to ui.onSessionRequest, which may set Redirect to change where the browser goes.
+type SessionRequest struct {
+	Path       string
+	Host       string
+	RemoteAddr string
+	UserAgent  string
+	Query      map[string]string
+	Headers    map[string]string // lower-case names, first value only
+	Redirect   string            // redirect target chosen by the hook ("" = the session URL)
+}
+
+// SessionDeniedError is returned by session creation when ui.onSessionRequest refuses the request.
+type SessionDeniedError struct {
+	Status  int
+	Message string
+}
+
+func (e *SessionDeniedError) Error() string {
+	return fmt.Sprintf("session request denied (%d): %s", e.Status, e.Message)
+}
+
+// newSessionRequest captures the metadata of an HTTP request.
+func newSessionRequest(r *http.Request) *SessionRequest {
+	req := &SessionRequest{
+		Path:       r.URL.Path,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		UserAgent:  r.UserAgent(),
+		Query:      make(map[string]string),
+		Headers:    make(map[string]string),
+	}
+	for name, values := range r.URL.Query() {
+		req.Query[name] = values[0]
+	}
+	for name, values := range r.Header {
+		req.Headers[strings.ToLower(name)] = values[0]
+	}
+	return req
+}
+
+// Request returns the browser request that created the session, or nil.
+func (s *Session) Request() *SessionRequest {
+	return s.request
+}
+
+// info returns the request as the table passed to ui.onSessionRequest.
+func (req *SessionRequest) info() map[string]any {
+	query := make(map[string]any, len(req.Query))
+	for k, v := range req.Query {
+		query[k] = v
+	}
+	headers := make(map[string]any, len(req.Headers))
+	for k, v := range req.Headers {
+		headers[k] = v
+	}
+	return map[string]any{
+		"path":       req.Path,
+		"host":       req.Host,
+		"remoteAddr": req.RemoteAddr,
+		"userAgent":  req.UserAgent,
+		"query":      query,
+		"headers":    headers,
+	}
+}
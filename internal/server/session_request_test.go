@@ -0,0 +1,57 @@
+// CRC: crc-SessionManager.md
+// Spec: interfaces.md
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestSessionRequestHook verifies ui.onSessionRequest can deny or redirect session creation
+func TestSessionRequestHook(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		function ui.onSessionRequest(info)
+			if info.query.seat == "none" then
+				return {deny = true, status = 503, message = "no seats"}
+			elseif info.headers["x-kiosk"] then
+				return {redirect = "/kiosk"}
+			end
+		end
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/?seat=none", nil))
+	if w.Code != http.StatusServiceUnavailable || !strings.Contains(w.Body.String(), "no seats") {
+		t.Errorf("denied = %d %q", w.Code, w.Body.String())
+	}
+	if n := len(s.getLuaSessions()); n != 0 {
+		t.Errorf("denied session left %d Lua sessions", n)
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Kiosk", "1")
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, req)
+	if w.Code != http.StatusTemporaryRedirect || w.Header().Get("Location") != "/kiosk" || len(w.Result().Cookies()) == 0 {
+		t.Errorf("redirect = %d %q, cookies %v", w.Code, w.Header().Get("Location"), w.Result().Cookies())
+	}
+
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if loc := w.Header().Get("Location"); w.Code != http.StatusTemporaryRedirect || !s.sessions.SessionExists(strings.TrimPrefix(loc, "/")) {
+		t.Errorf("default = %d %q", w.Code, loc)
+	}
+}
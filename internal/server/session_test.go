@@ -4,6 +4,8 @@
 package server
 
 import (
+	"errors"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -127,7 +129,7 @@ func TestRegisterURLPath(t *testing.T) {
 		t.Fatalf("CreateSession failed: %v", err)
 	}
 
-	err = manager.RegisterURLPath(session.ID, "/users", 42)
+	err = manager.RegisterURLPath(session.ID, "/users", 42, false)
 	if err != nil {
 		t.Fatalf("RegisterURLPath failed: %v", err)
 	}
@@ -151,7 +153,7 @@ func TestURLPathResolution(t *testing.T) {
 	}
 
 	// Register path
-	manager.RegisterURLPath(session.ID, "/users", 10)
+	manager.RegisterURLPath(session.ID, "/users", 10, false)
 
 	// Resolve registered path
 	varID, ok := manager.ResolveURLPath(session.ID, "/users")
@@ -172,6 +174,92 @@ func TestURLPathResolution(t *testing.T) {
 	}
 }
 
+// TestURLPathWildcards verifies exact paths beat the longest matching prefix
+func TestURLPathWildcards(t *testing.T) {
+	manager := NewSessionManager(time.Hour)
+	session, _, err := manager.CreateSession()
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	for path, varID := range map[string]int64{
+		"/docs/*":          1,
+		"/docs/api/*":      2,
+		"/docs/api/intro":  3,
+		"/":                4,
+		"/*":               5,
+		"/docs/api/v2/*":   6,
+		"/downloads/files": 7,
+	} {
+		if err := manager.RegisterURLPath(session.ID, path, varID, false); err != nil {
+			t.Fatalf("RegisterURLPath(%s) failed: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		want   int64
+		wantOK bool
+	}{
+		{"/docs/api/intro", 3, true},    // exact beats prefixes
+		{"/docs/api/other", 2, true},    // longest prefix
+		{"/docs/api/v2/x/y", 6, true},   // deeper prefix
+		{"/docs/api", 2, true},          // prefix root without trailing slash
+		{"/docs/", 1, true},             // prefix root with trailing slash
+		{"/docsets", 5, true},           // not under /docs/, falls back to /*
+		{"/", 4, true},                  // exact root
+		{"/downloads/files/x", 5, true}, // exact paths are not prefixes
+	}
+	for _, tt := range tests {
+		got, ok := manager.ResolveURLPath(session.ID, tt.path)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("ResolveURLPath(%s) = %d, %v; want %d, %v", tt.path, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	routes := manager.ListURLPaths(session.ID)
+	if len(routes) != 7 || routes[0].Path != "/" || routes[1].Path != "/*" || routes[6].Path != "/downloads/files" {
+		t.Errorf("ListURLPaths = %v, want 7 routes sorted by path", routes)
+	}
+}
+
+// TestURLPathConflicts verifies re-registering a path to another variable needs replace
+func TestURLPathConflicts(t *testing.T) {
+	manager := NewSessionManager(time.Hour)
+	session, _, err := manager.CreateSession()
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		varID   int64
+		replace bool
+		wantErr error
+		want    int64
+	}{
+		{"first registration", "/docs/*", 1, false, nil, 1},
+		{"same variable again", "/docs/*", 1, false, nil, 1},
+		{"different variable", "/docs/*", 2, false, ErrURLPathRegistered, 1},
+		{"different variable with replace", "/docs/*", 2, true, nil, 2},
+	}
+	for _, tt := range tests {
+		err := manager.RegisterURLPath(session.ID, tt.path, tt.varID, tt.replace)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got, _ := manager.ResolveURLPath(session.ID, "/docs/x"); got != tt.want {
+			t.Errorf("%s: resolves to %d, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	for _, path := range []string{"docs", "/docs*", "/*/docs", "/docs/*/x"} {
+		if err := manager.RegisterURLPath(session.ID, path, 9, false); err == nil {
+			t.Errorf("RegisterURLPath(%q) accepted an invalid path", path)
+		}
+	}
+}
+
 // TestSessionConnectionTracking verifies connection add/remove
 func TestSessionConnectionTracking(t *testing.T) {
 	session := NewSession("test-session")
@@ -247,6 +335,28 @@ func TestSessionCleanupOnInactivity(t *testing.T) {
 	}
 }
 
+// TestSessionCleanupClock verifies idle cleanup measures activity on the
+// manager's clock, and that activity times keep their monotonic reading so a
+// wall clock jump cannot make them look old
+func TestSessionCleanupClock(t *testing.T) {
+	manager := NewSessionManager(time.Hour)
+	session, _, err := manager.CreateSession()
+	if err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	session.Touch()
+	if !strings.Contains(session.GetLastActivity().String(), " m=") {
+		t.Errorf("last activity %v has no monotonic reading", session.GetLastActivity())
+	}
+	if removed := manager.CleanupInactiveSessions(); removed != 0 {
+		t.Fatalf("active session removed")
+	}
+	manager.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	if removed := manager.CleanupInactiveSessions(); removed != 1 {
+		t.Errorf("Expected 1 session removed, got %d", removed)
+	}
+}
+
 // TestSessionDestroyCleanup verifies session destruction
 func TestSessionDestroyCleanup(t *testing.T) {
 	manager := NewSessionManager(time.Hour)
@@ -601,3 +711,37 @@ func TestSessionEnsureDebounceStarted(t *testing.T) {
 		t.Errorf("Expected 1 message sent after debounce, got %d", mock.messageCount())
 	}
 }
+
+// TestSessionDeliveryOrder verifies async deliveries run in order and hold back inline ones
+func TestSessionDeliveryOrder(t *testing.T) {
+	sess := NewSession("s")
+	if !sess.deliverInline() {
+		t.Fatal("idle session should deliver inline")
+	}
+
+	release := make(chan struct{})
+	var order []int
+	var mu sync.Mutex
+	record := func(n int) {
+		mu.Lock()
+		order = append(order, n)
+		mu.Unlock()
+	}
+	sess.deliverAfter(func() { <-release; record(1) })
+	sess.deliverAfter(func() { record(2) })
+	if sess.deliverInline() {
+		t.Error("inline delivery allowed while an async delivery is pending")
+	}
+	close(release)
+
+	deadline := time.Now().Add(time.Second)
+	for !sess.deliverInline() {
+		if time.Now().After(deadline) {
+			t.Fatal("deliveries never finished")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(order) != 2 || order[0] != 1 || order[1] != 2 {
+		t.Errorf("delivery order = %v, want [1 2]", order)
+	}
+}
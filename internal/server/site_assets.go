@@ -0,0 +1,149 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Site Assets)
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// AssetEntry is one file in the /_bundle/manifest.json listing.
+type AssetEntry struct {
+	Path string `json:"path"` // Site-relative, e.g. "i18n/fr.json"
+	Size int64  `json:"size"`
+	Hash string `json:"hash"` // Hex SHA-256 of the content
+}
+
+// AssetManifest is the body of GET /_bundle/manifest.json.
+type AssetManifest struct {
+	Files []AssetEntry `json:"files"`
+}
+
+// siteAssets serves files from allowlisted top-level directories of the site
+// root (the bundle, or the --dir directory) for the frontend to lazy-load.
+type siteAssets struct {
+	root     fs.FS
+	dirs     []string
+	frozen   bool // Root never changes (bundle), so the manifest is built once
+	once     sync.Once
+	manifest AssetManifest
+}
+
+// SetSiteAssets serves the allowlisted top-level directories of root at
+// /_bundle/. Set frozen when root cannot change, so the manifest is cached.
+func (h *HTTPEndpoint) SetSiteAssets(root fs.FS, dirs []string, frozen bool) {
+	var allowed []string
+	for _, dir := range dirs {
+		if fs.ValidPath(dir) && dir != "." && !strings.Contains(dir, "/") {
+			allowed = append(allowed, dir)
+		}
+	}
+	if root == nil || len(allowed) == 0 {
+		h.assets.Store(nil)
+		return
+	}
+	h.assets.Store(&siteAssets{root: root, dirs: allowed, frozen: frozen})
+}
+
+// allowed reports whether name is a valid path inside an allowlisted directory.
+func (a *siteAssets) allowed(name string) bool {
+	if !fs.ValidPath(name) {
+		return false
+	}
+	top, _, nested := strings.Cut(name, "/")
+	return nested && slices.Contains(a.dirs, top)
+}
+
+// read returns an allowlisted regular file's content and info.
+// Symlinks are followed where root supports them (--dir mode).
+func (a *siteAssets) read(name string) ([]byte, fs.FileInfo, error) {
+	if !a.allowed(name) {
+		return nil, nil, fs.ErrNotExist
+	}
+	info, err := fs.Stat(a.root, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, nil, fs.ErrNotExist
+	}
+	content, err := fs.ReadFile(a.root, name)
+	return content, info, err
+}
+
+// buildManifest lists every file under the allowlisted directories, sorted by path.
+func (a *siteAssets) buildManifest() AssetManifest {
+	manifest := AssetManifest{Files: []AssetEntry{}}
+	for _, dir := range a.dirs {
+		fs.WalkDir(a.root, dir, func(name string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			content, info, err := a.read(name)
+			if err != nil {
+				return nil
+			}
+			sum := sha256.Sum256(content)
+			manifest.Files = append(manifest.Files, AssetEntry{Path: name, Size: info.Size(), Hash: hex.EncodeToString(sum[:])})
+			return nil
+		})
+	}
+	slices.SortFunc(manifest.Files, func(x, y AssetEntry) int { return strings.Compare(x.Path, y.Path) })
+	return manifest
+}
+
+// Manifest returns the asset listing, cached when the root is frozen.
+func (a *siteAssets) Manifest() AssetManifest {
+	if !a.frozen {
+		return a.buildManifest()
+	}
+	a.once.Do(func() { a.manifest = a.buildManifest() })
+	return a.manifest
+}
+
+// handleBundle serves GET /_bundle/manifest.json and /_bundle/file/PATH.
+// Returns 404 when no asset directories are configured.
+func (h *HTTPEndpoint) handleBundle(w http.ResponseWriter, r *http.Request) {
+	assets := h.assets.Load()
+	if assets == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.TrimPrefix(r.URL.Path, "/_bundle/")
+	if rest == "manifest.json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(assets.Manifest())
+		return
+	}
+	name, ok := strings.CutPrefix(rest, "file/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	content, info, err := assets.read(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	// Same headers as static files (content type by extension, Last-Modified),
+	// plus the manifest hash as ETag
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	sum := sha256.Sum256(content)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	http.ServeContent(w, r, name, info.ModTime(), bytes.NewReader(content))
+}
@@ -0,0 +1,82 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Site Assets)
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestSiteAssets(t *testing.T) {
+	endpoint := NewHTTPEndpoint(NewSessionManager(time.Hour), nil, nil)
+	get := func(path string, header ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if len(header) == 2 {
+			r.Header.Set(header[0], header[1])
+		}
+		endpoint.ServeHTTP(w, r)
+		return w
+	}
+	if w := get("/_bundle/manifest.json"); w.Code != http.StatusNotFound {
+		t.Fatalf("unconfigured manifest: status %d, want 404", w.Code)
+	}
+
+	fr := `{"hello":"bonjour"}`
+	endpoint.SetSiteAssets(fstest.MapFS{
+		"i18n/fr.json":       {Data: []byte(fr), ModTime: time.Unix(1000, 0)},
+		"assets/icons/a.svg": {Data: []byte("<svg/>")},
+		"lua/main.lua":       {Data: []byte("secret")},
+		"html/index.html":    {Data: []byte("<html>")},
+	}, []string{"i18n", "assets", "../etc"}, false)
+
+	w := get("/_bundle/manifest.json")
+	var manifest AssetManifest
+	if err := json.NewDecoder(w.Body).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	hash := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	want := []AssetEntry{
+		{Path: "assets/icons/a.svg", Size: 6, Hash: hash("<svg/>")},
+		{Path: "i18n/fr.json", Size: int64(len(fr)), Hash: hash(fr)},
+	}
+	if !slices.Equal(manifest.Files, want) {
+		t.Fatalf("manifest = %+v, want %+v", manifest.Files, want)
+	}
+
+	w = get("/_bundle/file/i18n/fr.json")
+	if w.Code != http.StatusOK || w.Body.String() != fr {
+		t.Fatalf("file: status %d body %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if w.Header().Get("Last-Modified") == "" {
+		t.Error("no Last-Modified header")
+	}
+	if w := get("/_bundle/file/i18n/fr.json", "If-None-Match", w.Header().Get("ETag")); w.Code != http.StatusNotModified {
+		t.Errorf("matching ETag: status %d, want 304", w.Code)
+	}
+
+	for _, path := range []string{
+		"/_bundle/file/lua/main.lua",
+		"/_bundle/file/html/index.html",
+		"/_bundle/file/i18n",
+		"/_bundle/file/i18n/../lua/main.lua",
+		"/_bundle/file/i18n/%2e%2e/lua/main.lua",
+	} {
+		if w := get(path); w.Code == http.StatusOK {
+			t.Errorf("%s was served: %q", path, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,72 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Static File Caching)
+package server
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+// immutableCache is the Cache-Control for files whose names carry a content
+// hash, which change name whenever their content changes.
+const immutableCache = "public, max-age=31536000, immutable"
+
+// SetStaticCache sets the Cache-Control sent with static files other than
+// index.html and hashed files ("" sends none).
+func (h *HTTPEndpoint) SetStaticCache(policy string) {
+	h.staticCache = policy
+}
+
+// setCacheHeaders sets a static file's ETag and Cache-Control. index.html is
+// always revalidated, so session redirects keep working; hashed names, and
+// assets a fingerprinted bundle renamed, never are.
+func (h *HTTPEndpoint) setCacheHeaders(w http.ResponseWriter, name string, info fs.FileInfo) {
+	w.Header().Set("ETag", staticETag(info))
+	switch {
+	case path.Base(name) == "index.html":
+		w.Header().Set("Cache-Control", "no-cache")
+	case hashedName(name) || bundle.Fingerprinted(name):
+		w.Header().Set("Cache-Control", immutableCache)
+	case h.staticCache != "":
+		w.Header().Set("Cache-Control", h.staticCache)
+	}
+}
+
+// staticETag returns a file's ETag: a bundle entry's CRC32 and size from its
+// ZIP header, or a directory file's modification time and size.
+func staticETag(info fs.FileInfo) string {
+	if header, ok := info.Sys().(*zip.FileHeader); ok {
+		return fmt.Sprintf(`"%08x-%x"`, header.CRC32, header.UncompressedSize64)
+	}
+	return fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// hashedName reports whether a file name carries a content hash, as bundlers
+// write them: the part before the extension ends in "-" or "." and eight or
+// more letters and digits, at least one a digit (main.3f9a1c2e.js,
+// chunk-Q7X2ABCD.js).
+func hashedName(name string) bool {
+	base := path.Base(name)
+	stem := strings.TrimSuffix(base, path.Ext(base))
+	i := strings.LastIndexAny(stem, "-.")
+	if i < 0 {
+		return false
+	}
+	hash := stem[i+1:]
+	if len(hash) < 8 || !strings.ContainsFunc(hash, unicode.IsDigit) {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
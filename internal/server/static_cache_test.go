@@ -0,0 +1,111 @@
+// CRC: crc-HTTPEndpoint.md
+// Spec: deployment.md (Static File Caching)
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/bundle"
+)
+
+var staticCacheFiles = map[string]string{
+	"index.html":         "<html></html>",
+	"app.css":            "body {}",
+	"main.3f9a1c2e.js":   "console.log(1)",
+	"chunk-Q7X2ABC9.css": "p {}",
+}
+
+// checkStaticCache verifies each file's Cache-Control, the session page's
+// included, and that repeating a request with its ETag gets 304 Not Modified
+func checkStaticCache(t *testing.T, endpoint *HTTPEndpoint, sessions *SessionManager) {
+	t.Helper()
+	endpoint.SetStaticCache("max-age=3600")
+	sess, _, _ := sessions.CreateSession()
+	tests := []struct{ path, file, cache string }{
+		{"/" + sess.ID, "index.html", "no-cache"},
+		{"/app.css", "app.css", "max-age=3600"},
+		{"/main.3f9a1c2e.js", "main.3f9a1c2e.js", immutableCache},
+		{"/chunk-Q7X2ABC9.css", "chunk-Q7X2ABC9.css", immutableCache},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		endpoint.ServeHTTP(w, httptest.NewRequest("GET", tt.path, nil))
+		etag := w.Header().Get("ETag")
+		if w.Code != 200 || etag == "" || w.Body.String() != staticCacheFiles[tt.file] {
+			t.Fatalf("GET %s = %d, ETag %q, body %q", tt.path, w.Code, etag, w.Body.String())
+		}
+		if got := w.Header().Get("Cache-Control"); got != tt.cache {
+			t.Errorf("GET %s Cache-Control = %q, want %q", tt.path, got, tt.cache)
+		}
+
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		endpoint.ServeHTTP(w, req)
+		if w.Code != 304 || w.Body.Len() != 0 {
+			t.Errorf("GET %s with If-None-Match = %d, body %q, want 304", tt.path, w.Code, w.Body.String())
+		}
+	}
+
+	endpoint.SetStaticCache("")
+	w := httptest.NewRecorder()
+	endpoint.ServeHTTP(w, httptest.NewRequest("GET", "/app.css", nil))
+	if got := w.Header().Get("Cache-Control"); got != "" {
+		t.Errorf("empty policy still sent Cache-Control %q", got)
+	}
+}
+
+// TestStaticCacheBundle verifies caching headers for files served from a
+// bundle through ZipFileSystem
+func TestStaticCacheBundle(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range staticCacheFiles {
+		w, _ := zw.Create("html/" + name)
+		w.Write([]byte(content))
+	}
+	zw.Close()
+	reader, _ := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	sessions := NewSessionManager(time.Hour)
+	endpoint := NewHTTPEndpoint(sessions, nil, nil)
+	endpoint.SetEmbeddedSite(bundle.NewZipFileSystem(reader))
+	checkStaticCache(t, endpoint, sessions)
+}
+
+// TestStaticCacheDir verifies caching headers for files served from --dir
+func TestStaticCacheDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range staticCacheFiles {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+	sessions := NewSessionManager(time.Hour)
+	endpoint := NewHTTPEndpoint(sessions, nil, nil)
+	endpoint.SetStaticDir(dir)
+	checkStaticCache(t, endpoint, sessions)
+}
+
+func TestHashedName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"main.3f9a1c2e.js", true},
+		{"assets/chunk-Q7X2ABC9.js", true},
+		{"app.css", false},
+		{"main.js", false},
+		{"vendor-abcdefgh.js", false}, // no digit
+		{"v-1234567.js", false},       // too short
+		{"index.html", false},
+	}
+	for _, tt := range tests {
+		if got := hashedName(tt.name); got != tt.want {
+			t.Errorf("hashedName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
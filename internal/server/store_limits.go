@@ -0,0 +1,87 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Store Limits)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/zot/ui-engine/internal/lua"
+)
+
+// storeLimits tracks evictions made to keep all sessions' variables within
+// the store limits.
+type storeLimits struct {
+	evicting  atomic.Bool // An eviction pass is running
+	evictions atomic.Int64
+}
+
+// StoreStats reports the variables of all sessions, as of each session's last
+// batch, against the store limits.
+type StoreStats struct {
+	Variables    int64 `json:"variables"`
+	MemoryBytes  int64 `json:"memoryBytes"` // Estimated
+	Evictions    int64 `json:"evictions"`   // Sessions evicted since startup
+	MaxVariables int   `json:"maxVariables,omitempty"`
+	MaxMemoryMB  int   `json:"maxMemoryMB,omitempty"`
+}
+
+// StoreStats returns the store usage. Sessions report theirs after each batch while
+// store limits or metrics are on, so it is all zeros otherwise.
+func (s *Server) StoreStats() StoreStats {
+	stats := StoreStats{
+		Evictions:    s.store.evictions.Load(),
+		MaxVariables: s.config.Store.MaxVariables,
+		MaxMemoryMB:  s.config.Store.MaxMemoryMB,
+	}
+	for _, sess := range s.sessions.GetAllSessions() {
+		stats.Variables += sess.variables.Load()
+		stats.MemoryBytes += sess.variableBytes.Load()
+	}
+	return stats
+}
+
+// overLimits reports whether the usage passes a store limit.
+func (st StoreStats) overLimits() bool {
+	return st.MaxVariables > 0 && st.Variables > int64(st.MaxVariables) ||
+		st.MaxMemoryMB > 0 && st.MemoryBytes > int64(st.MaxMemoryMB)<<20
+}
+
+// recordStoreUsage records a session's variables after a batch, on its
+// executor, and evicts other sessions if that passes a store limit.
+func (s *Server) recordStoreUsage(internalID string, sess *Session, luaSession *lua.LuaSession) {
+	variables, bytes := luaSession.StoreUsage()
+	sess.variables.Store(int64(variables))
+	sess.variableBytes.Store(bytes)
+	if s.config.Store.Enabled() && s.StoreStats().overLimits() {
+		s.evictForStore(internalID)
+	}
+}
+
+// evictForStore evicts idle sessions with no connections, least recently
+// active first, until the store is within its limits. It runs off the
+// executor, one pass at a time; the session that passed the limit is spared.
+func (s *Server) evictForStore(exclude string) {
+	if !s.store.evicting.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer s.store.evicting.Store(false)
+		for s.StoreStats().overLimits() {
+			vendedID := s.sessions.EvictIdle(exclude)
+			if vendedID == "" {
+				s.Log(1, "store limits exceeded, but every other session has a connection")
+				return
+			}
+			s.store.evictions.Add(1)
+			s.Log(1, "Evicted session %s: store limits exceeded", vendedID)
+		}
+	}()
+}
+
+// handleStoreStats serves /api/debug/store.
+func (s *Server) handleStoreStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.StoreStats())
+}
@@ -0,0 +1,70 @@
+// CRC: crc-SessionManager.md
+// Spec: deployment.md (Store Limits)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestStoreLimitsEvictIdleSessions verifies passing store.max_variables evicts
+// the least recently active session without connections, sparing connected
+// sessions and the one whose batch passed the limit
+func TestStoreLimitsEvictIdleSessions(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		session:createAppVariable({name = "app"})
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Store.MaxVariables = 1000
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	var sessions []*Session
+	for range 3 {
+		sess, _, err := s.sessions.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.AfterBatch(sess.ID, false)
+		sessions = append(sessions, sess)
+		time.Sleep(time.Millisecond) // Distinct activity times
+	}
+	perSession := sessions[0].variables.Load()
+	if perSession == 0 || sessions[0].variableBytes.Load() == 0 {
+		t.Fatalf("usage not recorded: %+v", s.StoreStats())
+	}
+
+	// The oldest session has a connection, so the second one goes
+	sessions[0].AddConnection("c1")
+	cfg.Store.MaxVariables = int(2 * perSession)
+	sessions[2].Touch()
+	s.recordStoreUsage(sessions[2].ID, sessions[2], s.GetLuaSession(s.sessions.GetVendedID(sessions[2].ID)))
+	for deadline := time.Now().Add(2 * time.Second); s.sessions.Count() > 2 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+	}
+	if s.sessions.Get(sessions[1].ID) != nil {
+		t.Error("least recently active idle session not evicted")
+	}
+	if s.sessions.Get(sessions[0].ID) == nil || s.sessions.Get(sessions[2].ID) == nil {
+		t.Error("connected or batching session evicted")
+	}
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/api/debug/store", nil))
+	var stats StoreStats
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Evictions != 1 || stats.Variables != 2*perSession || stats.MaxVariables != cfg.Store.MaxVariables {
+		t.Errorf("store stats = %+v", stats)
+	}
+}
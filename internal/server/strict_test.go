@@ -0,0 +1,86 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: protocol.md (Strict Mode)
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestStrictPropertyWarnings verifies strict mode checks frontend properties
+// against types.json, keeping a warning diag on the variable for each unknown
+// one, and that the diags show in the variable browser.
+// Without strict mode properties are not checked
+func TestStrictPropertyWarnings(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Contact = session:prototype("Contact", {name = EMPTY})
+		session:createAppVariable({contact = session:create(Contact, {name = "ann"})})
+	`), 0644)
+	os.WriteFile(filepath.Join(dir, "types.json"), []byte(`{
+		"properties": {"status": {"priority": "high"}},
+		"types": {"Contact": {"properties": ["label"]}}
+	}`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Server.Strict = true
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	h.SetPropertyAllowlist(loadPropertyAllowlist(cfg))
+	h.SetDiagRecorder(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msgType, err, resp)
+		}
+	}
+
+	// The variable's type is set as it is created, so its properties are checked against Contact
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{
+		"path": "contact", "label": "Ann", "status": "ok", "colour": "red",
+	}})
+	luaSession.AfterBatch(vendedID)
+	send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 2, Properties: map[string]string{
+		"viewdfs:high": "x", "label": "Ann B", "colour": "blue",
+	}})
+	want := []string{
+		`unknown property "colour" for type Contact`,
+		`unknown property "viewdfs:high" for type Contact`,
+	}
+	if diags := luaSession.VariableDiags(2); !slices.Equal(diags, want) {
+		t.Errorf("diags = %q, want %q", diags, want)
+	}
+	vars, err := s.getDebugVariables(luaSession.GetTracker(), luaSession)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vars {
+		if v.ID == 2 && !slices.Equal(v.Diags, want) {
+			t.Errorf("variable browser diags = %q, want %q", v.Diags, want)
+		}
+	}
+
+	// Without strict mode nothing is checked
+	cfg.Server.Strict = false
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 3, ParentID: 1, Properties: map[string]string{"path": "contact", "colour": "red"}})
+	if diags := luaSession.VariableDiags(3); diags != nil {
+		t.Errorf("diags without strict mode = %q", diags)
+	}
+}
@@ -0,0 +1,64 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+type eventRecorder struct {
+	protocol.NopTelemetry
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *eventRecorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) OnSessionCreated(id string)   { r.add("created " + id) }
+func (r *eventRecorder) OnSessionDestroyed(id string) { r.add("destroyed " + id) }
+func (r *eventRecorder) OnAfterBatch(id string, _ int, _ time.Duration) {
+	r.add("afterBatch " + id)
+}
+func (r *eventRecorder) OnBackendAttached(id, client string) {
+	r.add("attached " + id + " " + client)
+}
+
+// TestServerTelemetry verifies session lifecycle and AfterBatch reach the hook
+func TestServerTelemetry(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`session:createAppVariable({count = 1})`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+	rec := &eventRecorder{}
+	s.SetTelemetry(rec)
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.AfterBatch(sess.ID, false)
+	s.sessions.DestroySession(sess.ID)
+
+	want := []string{"created " + vendedID, "afterBatch " + vendedID, "destroyed " + vendedID}
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if !slices.Equal(rec.events, want) {
+		t.Errorf("events = %v, want %v", rec.events, want)
+	}
+}
@@ -0,0 +1,125 @@
+// CRC: crc-SessionManager.md
+// Spec: protocol.md (Session Trace)
+package server
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// Trace returns the session's active trace, or nil.
+func (s *Session) Trace() *protocol.SessionTrace {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trace
+}
+
+// swapTrace makes trace the session's trace, returning the one it replaces.
+func (s *Session) swapTrace(trace *protocol.SessionTrace) *protocol.SessionTrace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.trace
+	s.trace = trace
+	return old
+}
+
+// clearTrace removes trace if it is still the session's trace.
+func (s *Session) clearTrace(trace *protocol.SessionTrace) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.trace != trace {
+		return false
+	}
+	s.trace = nil
+	return true
+}
+
+// traceUntil returns when trace ends, or the zero time for no trace.
+func traceUntil(trace *protocol.SessionTrace) time.Time {
+	if trace == nil {
+		return time.Time{}
+	}
+	return trace.Until
+}
+
+// SetTrace starts or stops a session's trace (vended ID), which logs its
+// messages and updates in full until duration passes. With file, the trace
+// also goes to a file under logging.trace_dir. Implements protocol.SessionTracer.
+func (s *Server) SetTrace(vendedID string, on bool, duration time.Duration, file bool) (*protocol.TraceResponse, error) {
+	sess := s.sessions.Get(s.sessions.GetInternalID(vendedID))
+	if sess == nil {
+		return nil, fmt.Errorf("session %s not found", vendedID)
+	}
+	if !on {
+		s.endTrace(sess, sess.Trace())
+		return &protocol.TraceResponse{Session: vendedID}, nil
+	}
+	path := ""
+	if file {
+		if err := os.MkdirAll(s.config.Logging.TraceDir, 0700); err != nil {
+			return nil, err
+		}
+		path = filepath.Join(s.config.Logging.TraceDir, fmt.Sprintf("session-%s-%s.log", vendedID, time.Now().Format("20060102-150405")))
+	}
+	trace, err := protocol.NewSessionTrace(vendedID, time.Now().Add(duration), path)
+	if err != nil {
+		return nil, err
+	}
+	if old := sess.swapTrace(trace); old != nil {
+		old.Close()
+	} else {
+		s.traces.Add(1)
+	}
+	time.AfterFunc(duration, func() { s.endTrace(sess, trace) })
+	s.Log(0, "Session %s: tracing for %v", vendedID, duration)
+	return &protocol.TraceResponse{Session: vendedID, Until: trace.Until, File: path}, nil
+}
+
+// endTrace stops trace if it is still the session's trace. Expiry, trace
+// messages and session destruction all end traces here.
+func (s *Server) endTrace(sess *Session, trace *protocol.SessionTrace) {
+	if trace == nil || !sess.clearTrace(trace) {
+		return
+	}
+	s.traces.Add(-1)
+	trace.Close()
+	s.Log(0, "Session %s: trace ended", trace.Session)
+}
+
+// ConnectionTrace returns the trace of a connection's session, or nil.
+// Implements protocol.SessionTracer.
+func (s *Server) ConnectionTrace(connectionID string) *protocol.SessionTrace {
+	if s.traces.Load() == 0 {
+		return nil
+	}
+	return s.sessionTrace(s.wsEndpoint.GetSessionIDForConnection(connectionID))
+}
+
+// sessionTrace returns a session's trace (internal ID), or nil.
+func (s *Server) sessionTrace(internalID string) *protocol.SessionTrace {
+	if s.traces.Load() == 0 || internalID == "" {
+		return nil
+	}
+	sess := s.sessions.Get(internalID)
+	if sess == nil {
+		return nil
+	}
+	return sess.Trace()
+}
+
+// traceUpdates logs a batch's updates to the session's trace, if any.
+func (s *Server) traceUpdates(vendedID string, updates []lua.VariableUpdate) {
+	trace := s.sessionTrace(s.sessions.GetInternalID(vendedID))
+	if trace == nil {
+		return
+	}
+	for _, u := range updates {
+		trace.Logf("[AFTERBATCH] var=%d value=%s properties=%s removed=%v", u.VarID,
+			s.config.Sanitize(string(u.Value)), s.config.Sanitize(fmt.Sprint(u.Properties)), u.Removed)
+	}
+}
@@ -0,0 +1,115 @@
+// CRC: crc-SessionManager.md
+// Spec: protocol.md (Session Trace)
+package server
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestSessionTrace verifies a trace logs one session's messages and updates
+// in full at verbosity 0, leaves other sessions' logging alone, tees to a
+// file, shows in the session list, and ends on expiry and on destroy
+func TestSessionTrace(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {name = "ada"}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Logging.TraceDir = t.TempDir()
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	traced, err := s.CreateHeadlessSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := s.CreateHeadlessSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	trace := func(on bool, duration string) *protocol.Response {
+		msg, _ := protocol.NewMessage(protocol.MsgTrace, protocol.TraceMessage{Session: traced.VendedID, On: on, Duration: duration, File: true})
+		resp, err := s.handler.HandleMessage("backend-1", msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	resp := trace(true, "1h")
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	file := resp.Result.(protocol.TraceResponse).File
+	if resp := trace(true, "1h"); resp.Error != "" {
+		t.Fatalf("restarting a trace: %s", resp.Error)
+	}
+	if _, err := other.Send(mustMessage(protocol.MsgTrace, protocol.TraceMessage{Session: other.VendedID, On: true})); err == nil {
+		t.Error("a frontend connection started a trace")
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	for _, h := range []*HeadlessSession{traced, other} {
+		if _, err := h.Send(mustMessage(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "name"}})); err != nil {
+			t.Fatal(err)
+		}
+		h.Flush()
+	}
+	logged := buf.String()
+	tag := "[trace " + traced.VendedID + "]"
+	if !strings.Contains(logged, tag+" [IN] CREATE: from="+traced.Connection) || !strings.Contains(logged, `[AFTERBATCH] var=2 value="ada"`) {
+		t.Errorf("trace lacks the session's message and update:\n%s", logged)
+	}
+	if strings.Contains(logged, other.Connection) || strings.Count(logged, "[trace ") != strings.Count(logged, "\n") {
+		t.Errorf("untraced session logged:\n%s", logged)
+	}
+	if data, err := os.ReadFile(file); err != nil || !strings.Contains(string(data), "[IN] CREATE") {
+		t.Errorf("trace file %s = %q, %v", file, data, err)
+	}
+
+	untilOf := func(vendedID string) time.Time {
+		for _, info := range s.sessions.List() {
+			if info.ID == vendedID {
+				return info.TraceUntil
+			}
+		}
+		return time.Time{}
+	}
+	if untilOf(traced.VendedID).IsZero() || !untilOf(other.VendedID).IsZero() {
+		t.Error("session list does not show only the traced session")
+	}
+	trace(true, "10ms")
+	time.Sleep(50 * time.Millisecond)
+	if s.sessions.Get(traced.ID).Trace() != nil || !untilOf(traced.VendedID).IsZero() {
+		t.Error("trace did not expire")
+	}
+
+	trace(true, "1h")
+	sess := s.sessions.Get(traced.ID)
+	traced.Close()
+	if sess.Trace() != nil || s.traces.Load() != 0 {
+		t.Error("trace outlived its session")
+	}
+}
+
+func mustMessage(msgType protocol.MessageType, data any) *protocol.Message {
+	msg, err := protocol.NewMessage(msgType, data)
+	if err != nil {
+		panic(err)
+	}
+	return msg
+}
@@ -0,0 +1,75 @@
+// CRC: crc-LuaSession.md
+// Spec: session-defer.md (ui.timer and ui.interval)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// TestUITimers verifies ui.timer fires once, ui.interval repeats until its
+// handle is cancelled, and destroying a session cancels its timers
+func TestUITimers(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {ticks = 0, fired = 0}
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	h, err := s.CreateHeadlessSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Flush()
+	if _, err := h.Run("timers", `
+		ui.timer(0.01, function() app.fired = app.fired + 1 end)
+		local ticker
+		ticker = ui.interval(0.01, function()
+			app.ticks = app.ticks + 1
+			if app.ticks == 3 then ticker:cancel() end
+		end)
+	`); err != nil {
+		t.Fatal(err)
+	}
+	state := func() map[string]any {
+		t.Helper()
+		data, err := h.State()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var app map[string]any
+		json.Unmarshal(data, &app)
+		return app
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for app := state(); app["ticks"] != float64(3) || app["fired"] != float64(1); app = state() {
+		if time.Now().After(deadline) {
+			t.Fatalf("state = %v, want 3 ticks and 1 timer firing", app)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if app := state(); app["ticks"] != float64(3) || app["fired"] != float64(1) {
+		t.Errorf("state after cancel = %v, want no more firings", app)
+	}
+
+	if _, err := h.Run("bad", `ui.interval(0, function() end)`); err == nil {
+		t.Error("ui.interval accepted a zero delay")
+	}
+	if _, err := h.Run("pending", `ui.interval(0.005, function() app.ticks = app.ticks + 1 end)`); err != nil {
+		t.Fatal(err)
+	}
+	h.Close()
+	time.Sleep(30 * time.Millisecond) // Firings after destruction would touch a closed Lua state
+}
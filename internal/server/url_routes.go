@@ -0,0 +1,95 @@
+// CRC: crc-SessionManager.md
+// Spec: interfaces.md (URL Paths)
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ErrURLPathRegistered is returned when a URL path is already registered to
+// another variable and the registration does not ask to replace it.
+var ErrURLPathRegistered = errors.New("URL path already registered")
+
+// URLRoute is one registered URL path of a session.
+type URLRoute struct {
+	Path       string `json:"path"` // Exact path, or prefix ending in "/*"
+	VariableID int64  `json:"variableId"`
+}
+
+// validURLPath reports whether path is absolute with at most a trailing "/*" wildcard.
+func validURLPath(path string) bool {
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	return !strings.Contains(strings.TrimSuffix(path, "/*"), "*")
+}
+
+// matchesPrefix reports whether path falls under a wildcard registration.
+// "/docs/*" matches "/docs" and everything below it, but not "/docsets".
+func matchesPrefix(pattern, path string) bool {
+	prefix := strings.TrimSuffix(pattern, "*")
+	return strings.HasPrefix(path, prefix) || path == strings.TrimSuffix(prefix, "/")
+}
+
+// RegisterURLPath associates a URL path with a presenter variable for a session.
+// A path ending in "/*" registers every path below it. Registering a path that
+// already belongs to a different variable fails with ErrURLPathRegistered
+// unless replace is set.
+func (m *SessionManager) RegisterURLPath(sessionID, path string, variableID int64, replace bool) error {
+	if !validURLPath(path) {
+		return fmt.Errorf("invalid URL path %q: must start with / and may only end in /*", path)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths, ok := m.urlPaths[sessionID]
+	if !ok {
+		return nil // Session doesn't exist
+	}
+	if existing, ok := paths[path]; ok && existing != variableID && !replace {
+		return fmt.Errorf("%w: %s is registered to variable %d", ErrURLPathRegistered, path, existing)
+	}
+	paths[path] = variableID
+	return nil
+}
+
+// ResolveURLPath finds the presenter variable for a URL path in a session.
+// An exact registration wins; otherwise the longest matching "/*" prefix does.
+func (m *SessionManager) ResolveURLPath(sessionID, path string) (int64, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	paths, ok := m.urlPaths[sessionID]
+	if !ok {
+		return 0, false
+	}
+	if varID, ok := paths[path]; ok && !strings.HasSuffix(path, "/*") {
+		return varID, true
+	}
+	best := ""
+	for pattern := range paths {
+		if strings.HasSuffix(pattern, "/*") && len(pattern) > len(best) && matchesPrefix(pattern, path) {
+			best = pattern
+		}
+	}
+	if best == "" {
+		return 0, false
+	}
+	return paths[best], true
+}
+
+// ListURLPaths returns a session's registered URL paths, sorted by path.
+func (m *SessionManager) ListURLPaths(sessionID string) []URLRoute {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	routes := make([]URLRoute, 0, len(m.urlPaths[sessionID]))
+	for path, varID := range m.urlPaths[sessionID] {
+		routes = append(routes, URLRoute{Path: path, VariableID: varID})
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Path < routes[j].Path })
+	return routes
+}
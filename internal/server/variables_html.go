@@ -3,7 +3,7 @@
 package server
 
 const variableBrowserHTML = `<!DOCTYPE html>
-<html lang="en">
+<html lang="en" data-theme="{{THEME}}">
 <head>
 <meta charset="utf-8">
 <title>Variable Browser</title>
@@ -49,11 +49,12 @@ tr:hover { background: #f8f8ff; }
 .col-avgtime { font-family: monospace; font-size: 0.9em; color: #555; }
 .col-maxtime { font-family: monospace; font-size: 0.9em; color: #555; }
 .col-error { color: #cc0000; font-family: monospace; font-size: 0.9em; }
-.col-access { font-family: monospace; font-size: 0.9em; color: #666; }
+.col-access, .col-routes { font-family: monospace; font-size: 0.9em; color: #666; }
 .col-active { text-align: center; }
 .col-props { font-size: 0.85em; color: #888; max-width: 200px; overflow: hidden; text-overflow: ellipsis; }
 .col-spacer { width: 100%; }
 td.has-error { background: #fff0f0; }
+.graph-link { margin-right: 6px; font-size: 0.85em; }
 
 /* Diag toggle */
 .diag-btn { background: none; border: 1px solid #ccc; border-radius: 3px; cursor: pointer; font-size: 0.75em; padding: 1px 5px; color: #666; }
@@ -73,11 +74,36 @@ tr.diag-row li::before { content: "- "; color: #999; }
 
 /* Status bar */
 .status { font-size: 0.8em; color: #888; margin-top: 8px; }
+
+/* Dark theme */
+html[data-theme="dark"] body { background: #1e1f22; color: #ddd; }
+html[data-theme="dark"] .toolbar, html[data-theme="dark"] .table-wrap, html[data-theme="dark"] .col-picker-menu { background: #2b2d30; border-color: #444; }
+html[data-theme="dark"] .toolbar button, html[data-theme="dark"] .toolbar select { background: #3a3c40; color: #ddd; border-color: #555; }
+html[data-theme="dark"] .toolbar button:hover { background: #45474c; }
+html[data-theme="dark"] thead { background: #333539; }
+html[data-theme="dark"] th { border-bottom-color: #555; }
+html[data-theme="dark"] th.sortable:hover { background: #3d3f44; }
+html[data-theme="dark"] td { border-bottom-color: #3a3a3a; }
+html[data-theme="dark"] tr:hover { background: #34363c; }
+html[data-theme="dark"] .col-type { color: #6cb6ff; }
+html[data-theme="dark"] .col-value { color: #7ccf7c; }
+html[data-theme="dark"] .col-error { color: #ff7b72; }
+html[data-theme="dark"] td.has-error { background: #4a2a2a; }
+html[data-theme="dark"] .col-gotype, html[data-theme="dark"] .col-access, html[data-theme="dark"] .col-routes, html[data-theme="dark"] .col-changes,
+html[data-theme="dark"] .col-time, html[data-theme="dark"] .col-avgtime, html[data-theme="dark"] .col-maxtime { color: #aaa; }
+html[data-theme="dark"] .diag-btn { color: #bbb; border-color: #555; }
+html[data-theme="dark"] .diag-btn:hover, html[data-theme="dark"] .diag-btn.open { background: #45474c; }
+html[data-theme="dark"] tr.diag-row td { background: #2f302b; border-bottom-color: #3a3a3a; }
+html[data-theme="dark"] tr.diag-row li { color: #bbb; }
+html[data-theme="dark"] .tree-toggle:hover { color: #eee; }
+.snapshot-info { font-size: 0.85em; color: #666; margin: -4px 0 8px; }
+html[data-theme="dark"] .snapshot-info { color: #aaa; }
 </style>
 </head>
 <body>
 
 <h1>Variable Browser</h1>
+<div class="snapshot-info" id="snapshotInfo" hidden></div>
 
 <div class="toolbar">
   <label><input type="radio" name="view" value="flat" checked> Flat</label>
@@ -91,6 +117,7 @@ tr.diag-row li::before { content: "- "; color: #999; }
     <option value="5000">5s</option>
   </select>
   <span class="spacer"></span>
+  <button id="themeBtn">Dark</button>
   <div class="col-picker">
     <button class="col-picker-btn" id="colPickerBtn">Columns &#9662;</button>
     <div class="col-picker-menu" id="colPickerMenu"></div>
@@ -125,6 +152,7 @@ tr.diag-row li::before { content: "- "; color: #999; }
     { key: 'maxTime', label: 'Max Time', visible: false, sortable: true, numeric: true },
     { key: 'error',   label: 'Error',    visible: true,  sortable: true },
     { key: 'access',  label: 'Access',   visible: false, sortable: true },
+    { key: 'routes',  label: 'Routes',   visible: false, sortable: true },
     { key: 'active',  label: 'Active',   visible: false, sortable: true },
     { key: 'props',   label: 'Props',    visible: false, sortable: false },
   ];
@@ -138,10 +166,58 @@ tr.diag-row li::before { content: "- "; color: #999; }
   let expandedDiags = new Set();
   let collapsedNodes = new Set();
 
+  // Preferences saved on the session, embedded by the server
+  const SAVED_PREFS = {{PREFS}};
+  // Read-only snapshot with the variables inlined (null on the live page)
+  const SNAPSHOT = {{SNAPSHOT}};
+  let theme = document.documentElement.dataset.theme === 'dark' ? 'dark' : 'light';
+  let savePrefsTimer = null;
+
   // Extract session ID from URL path
   const pathParts = location.pathname.split('/').filter(Boolean);
   const sessionId = pathParts[0] || '';
 
+  // --- Preferences ---
+  // Columns, view mode, poll interval and theme are stored server-side per session
+
+  function applyPrefs(prefs) {
+    if (Array.isArray(prefs.columns)) {
+      for (const col of COLUMNS) {
+        if (!col.alwaysVisible) col.visible = prefs.columns.includes(col.key);
+      }
+    }
+    if (prefs.view === 'flat' || prefs.view === 'tree') {
+      viewMode = prefs.view;
+      document.querySelector('input[name="view"][value="' + viewMode + '"]').checked = true;
+    }
+    if (prefs.pollInterval) {
+      document.getElementById('pollInterval').value = String(prefs.pollInterval);
+    }
+    updateThemeButton();
+  }
+
+  function updateThemeButton() {
+    document.getElementById('themeBtn').textContent = theme === 'dark' ? 'Light' : 'Dark';
+  }
+
+  function savePrefs() {
+    if (SNAPSHOT) return;
+    clearTimeout(savePrefsTimer);
+    savePrefsTimer = setTimeout(() => {
+      const prefs = {
+        theme,
+        view: viewMode,
+        pollInterval: parseInt(document.getElementById('pollInterval').value, 10),
+        columns: COLUMNS.filter(c => c.visible && !c.alwaysVisible).map(c => c.key),
+      };
+      fetch('/' + sessionId + '/variables/prefs', {
+        method: 'PUT',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify(prefs),
+      }).catch(() => {});
+    }, 300);
+  }
+
   // --- Data fetching ---
   // R57, R67
   async function fetchVariables() {
@@ -159,6 +235,22 @@ tr.diag-row li::before { content: "- "; color: #999; }
     }
   }
 
+  // --- Snapshot ---
+  // Shows the inlined variables with fetching and polling disabled, so a saved page works offline
+  function showSnapshot() {
+    document.querySelector('h1').textContent = 'Variable Browser \u2014 ' + SNAPSHOT.label;
+    const info = document.getElementById('snapshotInfo');
+    info.textContent = 'Snapshot taken ' + new Date(SNAPSHOT.time).toLocaleString() + ' \u00b7 ' + SNAPSHOT.version;
+    info.hidden = false;
+    for (const id of ['refreshBtn', 'pollToggle', 'pollInterval']) {
+      document.getElementById(id).disabled = true;
+    }
+    trackerRefreshCount = SNAPSHOT.changeCount || 0;
+    variables = SNAPSHOT.variables || [];
+    render();
+    document.getElementById('status').textContent = variables.length + ' variables (read-only snapshot)';
+  }
+
   // --- Rendering ---
   function render() {
     renderHeader();
@@ -289,6 +381,7 @@ tr.diag-row li::before { content: "- "; color: #999; }
       case 'error': return v.error || '';
       case 'goType': return v.goType || '';
       case 'access': return v.access || '';
+      case 'routes': return (v.routes || []).join(' ');
       case 'active': return v.active ? '1' : '0';
       default: return '';
     }
@@ -358,6 +451,15 @@ tr.diag-row li::before { content: "- "; color: #999; }
           const display = full.length > 100 ? full.slice(0, 100) + '\u2026' : full;
           td.textContent = display;
           if (full.length > 100) td.title = full;
+          // Object values link to their subgraph in the object graph
+          if (v.baseValue && v.baseValue.obj && !SNAPSHOT) {
+            const link = document.createElement('a');
+            link.className = 'graph-link';
+            link.href = '/' + sessionId + '/objects.json?format=dot&var=' + v.id;
+            link.target = '_blank';
+            link.textContent = 'graph';
+            td.prepend(link);
+          }
           break;
         }
 
@@ -397,6 +499,10 @@ tr.diag-row li::before { content: "- "; color: #999; }
           td.textContent = v.access || '';
           break;
 
+        case 'routes':
+          td.textContent = (v.routes || []).join(', ');
+          break;
+
         case 'active':
           td.textContent = v.active ? '\u2713' : '\u2717';
           break;
@@ -475,6 +581,7 @@ tr.diag-row li::before { content: "- "; color: #999; }
       viewMode = radio.value;
       sortCol = null;
       render();
+      savePrefs();
     });
   });
 
@@ -493,7 +600,14 @@ tr.diag-row li::before { content: "- "; color: #999; }
     }
   }
   pollToggle.addEventListener('change', updatePolling);
-  pollInterval.addEventListener('change', updatePolling);
+  pollInterval.addEventListener('change', () => { updatePolling(); savePrefs(); });
+
+  document.getElementById('themeBtn').addEventListener('click', () => {
+    theme = theme === 'dark' ? 'light' : 'dark';
+    document.documentElement.dataset.theme = theme;
+    updateThemeButton();
+    savePrefs();
+  });
 
   // R69: column picker
   function buildColumnPicker() {
@@ -508,6 +622,7 @@ tr.diag-row li::before { content: "- "; color: #999; }
       cb.addEventListener('change', () => {
         col.visible = cb.checked;
         render();
+        savePrefs();
       });
       label.appendChild(cb);
       label.appendChild(document.createTextNode(' ' + col.label));
@@ -527,8 +642,13 @@ tr.diag-row li::before { content: "- "; color: #999; }
   });
 
   // --- Init ---
+  applyPrefs(SAVED_PREFS);
   buildColumnPicker();
-  fetchVariables();
+  if (SNAPSHOT) {
+    showSnapshot();
+  } else {
+    fetchVariables();
+  }
 })();
 </script>
 </body>
@@ -0,0 +1,85 @@
+// CRC: crc-VariableBrowser.md
+// CRC: crc-HTTPEndpoint.md
+// Spec: variable-browser.md (Snapshots)
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// variableSnapshot is the data a snapshot page shows instead of fetching variables.json.
+type variableSnapshot struct {
+	Label       string          `json:"label"`
+	Time        time.Time       `json:"time"`
+	Version     string          `json:"version"`
+	ChangeCount int64           `json:"changeCount"`
+	Variables   []DebugVariable `json:"variables"`
+}
+
+// SetValueSanitizer sets the redaction and truncation applied to variable
+// values in snapshot pages.
+func (h *HTTPEndpoint) SetValueSanitizer(sanitize func(string) string) {
+	h.sanitizeValue = sanitize
+}
+
+// variableSnapshot returns the JSON a snapshot page embeds: the session's
+// variables with sanitized values, and the label, time and version for its header.
+func (h *HTTPEndpoint) variableSnapshot(sessionID string) ([]byte, error) {
+	vendedID := h.sessions.GetVendedID(sessionID)
+	variables, changeCount, err := h.debugVariables(sessionID, vendedID, 0)
+	if err != nil {
+		return nil, err
+	}
+	if h.sanitizeValue != nil {
+		for i := range variables {
+			variables[i].Value = sanitizeDebugValue(variables[i].Value, h.sanitizeValue)
+			variables[i].BaseValue = sanitizeDebugValue(variables[i].BaseValue, h.sanitizeValue)
+		}
+	}
+	label := "session " + vendedID
+	if sess := h.sessions.Get(sessionID); sess != nil && sess.Group() != "" {
+		label += " (" + sess.Group() + ")"
+	}
+	return json.Marshal(variableSnapshot{
+		Label:       label,
+		Time:        time.Now().UTC(),
+		Version:     snapshotVersion(),
+		ChangeCount: changeCount,
+		Variables:   variables,
+	})
+}
+
+// sanitizeDebugValue applies sanitize to a value's JSON. A truncated value is
+// no longer JSON and becomes a string.
+func sanitizeDebugValue(v any, sanitize func(string) string) any {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return v
+	}
+	clean := sanitize(string(raw))
+	if clean == string(raw) {
+		return v
+	}
+	if json.Valid([]byte(clean)) {
+		return json.RawMessage(clean)
+	}
+	return clean
+}
+
+// snapshotVersion identifies the binary and bundled site in a snapshot header.
+func snapshotVersion() string {
+	summary := buildSummary()
+	version := summary["module"]
+	if version == "" {
+		version = summary["go"]
+	}
+	if bundle := summary["bundle"]; bundle != "" {
+		version += fmt.Sprintf(" (bundle %s)", bundle)
+	}
+	return version
+}
@@ -0,0 +1,108 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md (Usage Statistics)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/zot/ui-engine/internal/viewdef"
+)
+
+// UsageStore is optionally implemented by a PersistentStore to keep viewdef
+// usage counters across restarts.
+type UsageStore interface {
+	SaveViewdefUsage(usage json.RawMessage) error
+	LoadViewdefUsage() (json.RawMessage, error) // nil when nothing was saved
+}
+
+// ViewdefList is the /api/debug/viewdefs response.
+type ViewdefList struct {
+	Keys  []string      `json:"keys"` // Loaded viewdefs (TYPE.NAMESPACE), sorted
+	Usage viewdef.Usage `json:"usage"`
+}
+
+// loadViewdefUsage restores usage counters saved by an earlier run.
+func (s *Server) loadViewdefUsage() {
+	store, ok := s.usageStore()
+	if !ok {
+		return
+	}
+	data, err := store.LoadViewdefUsage()
+	if err != nil {
+		s.Log(0, "Warning: failed to load viewdef usage: %v", err)
+		return
+	}
+	if data == nil {
+		return
+	}
+	var usage viewdef.Usage
+	if err := json.Unmarshal(data, &usage); err != nil {
+		s.Log(0, "Warning: ignoring bad saved viewdef usage: %v", err)
+		return
+	}
+	s.viewdefManager.SetUsage(usage)
+}
+
+// saveViewdefUsage saves the usage counters when the store keeps them.
+func (s *Server) saveViewdefUsage() {
+	store, ok := s.usageStore()
+	if !ok {
+		return
+	}
+	data, err := json.Marshal(s.viewdefManager.Usage())
+	if err == nil {
+		err = store.SaveViewdefUsage(data)
+	}
+	if err != nil {
+		s.Log(0, "Warning: failed to persist viewdef usage: %v", err)
+		s.count("persist.failed")
+	}
+}
+
+func (s *Server) usageStore() (UsageStore, bool) {
+	if s.persist == nil || s.viewdefManager == nil {
+		return nil, false
+	}
+	store, ok := s.persist.store.(UsageStore)
+	return store, ok
+}
+
+// viewdefCounters reports usage as /metrics counters: viewdefs.TYPE.sent and viewdefs.TYPE.created.
+func (s *Server) viewdefCounters() map[string]int64 {
+	usage := s.viewdefManager.Usage()
+	counters := make(map[string]int64, 2*len(usage.Types))
+	for typ, u := range usage.Types {
+		counters["viewdefs."+typ+".sent"] = u.Sent
+		counters["viewdefs."+typ+".created"] = u.Created
+	}
+	return counters
+}
+
+// handleViewdefList serves GET /api/debug/viewdefs, and DELETE, which resets
+// the usage counters and responds with the ones it cleared.
+func (s *Server) handleViewdefList(w http.ResponseWriter, r *http.Request) {
+	if s.viewdefManager == nil {
+		http.Error(w, "viewdefs not loaded", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodDelete:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	list := ViewdefList{Usage: s.viewdefManager.Usage()}
+	for key := range s.viewdefManager.GetAllViewdefs() {
+		list.Keys = append(list.Keys, key)
+	}
+	slices.Sort(list.Keys)
+	if r.Method == http.MethodDelete {
+		s.viewdefManager.ResetUsage()
+		s.saveViewdefUsage()
+		s.Log(1, "Reset viewdef usage counters")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
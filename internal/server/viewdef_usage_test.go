@@ -0,0 +1,88 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md (Usage Statistics)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+	"github.com/zot/ui-engine/internal/viewdef"
+)
+
+// usageStore keeps viewdef usage in memory
+type usageStore struct {
+	flakyStore
+	usage json.RawMessage
+}
+
+func (u *usageStore) SaveViewdefUsage(usage json.RawMessage) error {
+	u.usage = usage
+	return nil
+}
+
+func (u *usageStore) LoadViewdefUsage() (json.RawMessage, error) {
+	return u.usage, nil
+}
+
+// TestViewdefUsageEndpoints verifies usage counters are loaded from the store,
+// counted as variables are created, reported at /metrics and
+// /api/debug/viewdefs, and reset and saved by DELETE
+func TestViewdefUsageEndpoints(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.MkdirAll(filepath.Join(dir, "viewdefs"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		Contact = session:prototype("Contact", {name = EMPTY})
+		session:createAppVariable(session:create(Contact, {name = "ann"}))
+	`), 0644)
+	os.WriteFile(filepath.Join(dir, "viewdefs", "Contact.DEFAULT.html"), []byte(`<template><div></div></template>`), 0644)
+	os.WriteFile(filepath.Join(dir, "viewdefs", "Dead.DEFAULT.html"), []byte(`<template><div></div></template>`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	cfg.Server.Metrics = true
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	since := time.Now().Add(-48 * time.Hour).UTC()
+	saved, _ := json.Marshal(viewdef.Usage{Since: since, Types: map[string]viewdef.TypeUsage{"Contact": {Created: 3}}})
+	store := &usageStore{usage: saved}
+	s.SetPersistentStore(store)
+	if _, _, err := s.sessions.CreateSession(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	var snap protocol.MetricsSnapshot
+	json.Unmarshal(w.Body.Bytes(), &snap)
+	if snap.Counters["viewdefs.Contact.created"] != 4 || snap.Counters["viewdefs.Dead.created"] != 0 {
+		t.Errorf("metrics counters = %v, want Contact created 4", snap.Counters)
+	}
+
+	w = httptest.NewRecorder()
+	s.HttpEndpoint.ServeHTTP(w, httptest.NewRequest("DELETE", "/api/debug/viewdefs", nil))
+	var list ViewdefList
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Keys) != 2 || !list.Usage.Since.Equal(since) || list.Usage.Types["Contact"].Created != 4 {
+		t.Errorf("list = %+v", list)
+	}
+	if _, ok := list.Usage.Types["Dead"]; !ok {
+		t.Errorf("unused Dead type missing from %v", list.Usage.Types)
+	}
+
+	// The reset counters were saved
+	var reset viewdef.Usage
+	json.Unmarshal(store.usage, &reset)
+	if !reset.Since.After(since) || reset.Types["Contact"].Created != 0 {
+		t.Errorf("saved after reset = %+v", reset)
+	}
+}
@@ -0,0 +1,99 @@
+// CRC: crc-ViewList.md
+// Spec: viewdefs.md (Windowed ViewLists)
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/lua"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestViewListWindow simulates scrolling a 5,000 item list: each viewport
+// change sends only the window's items with its start and the total, and an
+// item's child variable keeps resolving after the item leaves the window
+func TestViewListWindow(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lua"), 0755)
+	os.WriteFile(filepath.Join(dir, "lua", "main.lua"), []byte(`
+		app = {rows = {}}
+		for i = 1, 5000 do app.rows[i] = {n = i} end
+		session:createAppVariable(app)
+	`), 0644)
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = dir
+	s := New(cfg)
+	defer s.Shutdown(context.Background())
+
+	sess, vendedID, err := s.sessions.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	luaSession := s.GetLuaSession(vendedID)
+	h := protocol.NewHandler(cfg, nil)
+	h.SetBackendLookup(backendLookup{sess.GetBackend()})
+	h.SetPathVariableHandler(s)
+	send := func(msgType protocol.MessageType, data any) {
+		t.Helper()
+		msg, _ := protocol.NewMessage(msgType, data)
+		if resp, err := h.HandleMessage("c1", msg); err != nil || resp != nil && resp.Error != "" {
+			t.Fatalf("%s failed: %v %+v", msgType, err, resp)
+		}
+	}
+	viewport := func(first int) map[string]string {
+		return map[string]string{
+			lua.WindowFirstProp:    strconv.Itoa(first),
+			lua.WindowLastProp:     strconv.Itoa(first + 19),
+			lua.WindowOverscanProp: "5",
+		}
+	}
+	// scroll returns the update the items variable got
+	scroll := func() lua.VariableUpdate {
+		t.Helper()
+		for _, update := range luaSession.AfterBatch(vendedID) {
+			if update.VarID == 3 {
+				return update
+			}
+		}
+		t.Fatal("no update for the items variable")
+		return lua.VariableUpdate{}
+	}
+
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 2, ParentID: 1, Properties: map[string]string{"path": "rows", "wrapper": "lua.ViewList"}})
+	props := viewport(0)
+	props["path"] = "items"
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 3, ParentID: 2, Properties: props})
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 4, ParentID: 3, Properties: map[string]string{"path": "10"}})
+	send(protocol.MsgCreate, protocol.CreateMessage{ID: 5, ParentID: 4, Properties: map[string]string{"path": "index"}})
+	update := scroll()
+	if update.Properties[lua.WindowTotalProp] != "5000" || update.Properties[lua.WindowStartProp] != "0" {
+		t.Errorf("first window properties = %v, want start 0 and total 5000", update.Properties)
+	}
+
+	for first := 500; first <= 4500; first += 500 {
+		send(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 3, Properties: viewport(first)})
+		update := scroll()
+		var items []json.RawMessage
+		if err := json.Unmarshal(update.Value, &items); err != nil || len(items) != 30 {
+			t.Fatalf("window at %d sent %d items (%v), want 30", first, len(items), err)
+		}
+		if len(update.Value) > 1024 {
+			t.Errorf("window at %d sent %d bytes", first, len(update.Value))
+		}
+		if start := update.Properties[lua.WindowStartProp]; start != strconv.Itoa(first-5) {
+			t.Errorf("window at %d starts at %s, want %d", first, start, first-5)
+		}
+	}
+
+	// Item 10 left the window long ago, but its variables still resolve
+	tracker := luaSession.GetTracker()
+	if v := tracker.GetVariable(5); v.Error != nil || v.Value != 10 {
+		t.Errorf("index of item 10 = %v (%v), want 10", v.Value, v.Error)
+	}
+}
@@ -0,0 +1,70 @@
+// CRC: crc-LuaBackend.md
+// Spec: protocol.md
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// WatchCheckReport lists orphaned watch entries found in one session.
+type WatchCheckReport struct {
+	Session  string  `json:"session"`
+	Orphans  []int64 `json:"orphans"`
+	Repaired bool    `json:"repaired"`
+}
+
+// CheckWatches compares every session's watch tables against its tracker.
+// Orphans are watch entries for variables that no longer exist; repair removes them.
+// Only sessions with orphans appear in the result.
+func (s *Server) CheckWatches(repair bool) []WatchCheckReport {
+	if s.storeAdapter == nil {
+		return nil
+	}
+	ids := s.GetSessionIDs()
+	sort.Strings(ids)
+
+	var reports []WatchCheckReport
+	var found int64
+	for _, vendedID := range ids {
+		lb := s.storeAdapter.GetBackend(vendedID)
+		if lb == nil {
+			continue
+		}
+		// Run on the session executor so the tracker is not mutated concurrently
+		var orphans []int64
+		s.ExecuteInSession(vendedID, func() (interface{}, error) {
+			orphans = lb.CheckWatches(repair)
+			return nil, nil
+		})
+		if len(orphans) > 0 {
+			sort.Slice(orphans, func(i, j int) bool { return orphans[i] < orphans[j] })
+			reports = append(reports, WatchCheckReport{Session: vendedID, Orphans: orphans, Repaired: repair})
+			found += int64(len(orphans))
+		}
+	}
+
+	if metrics := s.handler.Metrics(); metrics != nil && found > 0 {
+		metrics.AddCount("orphanedWatches.found", found)
+		if repair {
+			metrics.AddCount("orphanedWatches.repaired", found)
+		}
+	}
+	return reports
+}
+
+// handleWatchCheck serves GET /api/debug/watches[?repair=1].
+func (s *Server) handleWatchCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	repair := r.URL.Query().Get("repair") != ""
+	reports := s.CheckWatches(repair)
+	if reports == nil {
+		reports = []WatchCheckReport{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(reports)
+}
@@ -0,0 +1,69 @@
+// CRC: crc-LuaBackend.md
+// Spec: protocol.md
+package server
+
+import (
+	"testing"
+
+	changetracker "github.com/zot/change-tracker"
+	"github.com/zot/ui-engine/internal/backend"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// newWatchTestAdapter returns an adapter with one session backend holding a watched variable.
+func newWatchTestAdapter(t *testing.T) (*luaTrackerAdapter, *backend.LuaBackend, int64) {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	adapter := &luaTrackerAdapter{config: cfg}
+	lb := backend.NewLuaBackend(cfg, "1", changetracker.NewTracker())
+	adapter.SetBackend("1", lb)
+
+	tracker := lb.GetTracker()
+	root := tracker.CreateVariable(map[string]any{"name": "root"}, 0, "", nil)
+	child := tracker.CreateVariable(nil, root.ID, "name", nil)
+	adapter.varToSession[child.ID] = "1"
+	lb.Watch(child.ID, "conn-1")
+	return adapter, lb, child.ID
+}
+
+// TestDestroyPurgesWatches verifies destroying a watched variable removes its watch entries
+func TestDestroyPurgesWatches(t *testing.T) {
+	adapter, lb, id := newWatchTestAdapter(t)
+
+	if len(lb.GetWatchers(id)) != 1 {
+		t.Fatal("expected one watcher before destroy")
+	}
+	adapter.Destroy(id)
+
+	if watchers := lb.GetWatchers(id); len(watchers) != 0 {
+		t.Errorf("GetWatchers after destroy = %v, want empty", watchers)
+	}
+	if lb.GetWatcherCount(id) != 0 {
+		t.Errorf("watch count after destroy = %d, want 0", lb.GetWatcherCount(id))
+	}
+	if orphans := lb.CheckWatches(false); len(orphans) != 0 {
+		t.Errorf("CheckWatches after destroy = %v, want none", orphans)
+	}
+}
+
+// TestCheckWatchesRepairsOrphans verifies the consistency check finds and removes orphans
+func TestCheckWatchesRepairsOrphans(t *testing.T) {
+	_, lb, id := newWatchTestAdapter(t)
+
+	// Bypass the backend so the watch entry is left behind
+	lb.GetTracker().DestroyVariable(id)
+
+	if orphans := lb.CheckWatches(false); len(orphans) != 1 || orphans[0] != id {
+		t.Fatalf("CheckWatches = %v, want [%d]", orphans, id)
+	}
+	if len(lb.GetWatchers(id)) != 1 {
+		t.Error("check without repair should leave entries in place")
+	}
+	lb.CheckWatches(true)
+	if len(lb.GetWatchers(id)) != 0 {
+		t.Error("repair should remove orphaned watchers")
+	}
+	if orphans := lb.CheckWatches(false); len(orphans) != 0 {
+		t.Errorf("CheckWatches after repair = %v, want none", orphans)
+	}
+}
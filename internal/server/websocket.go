@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/zot/ui-engine/internal/config"
@@ -38,20 +40,35 @@ type DisconnectCallback func(sessionID string)
 type wsConn struct {
 	conn    *websocket.Conn
 	writeMu sync.Mutex
+	seq     int64     // frames written so far, guarded by writeMu
+	poll    *pollConn // non-nil for a polling connection, which has no conn
+	// compression counts the frames of a connection that negotiated deflate
+	compression *compressionCounters
+	// Frames held for the batch window, guarded by writeMu (window 0 = none)
+	window     time.Duration
+	pending    [][]byte
+	batchTimer *time.Timer
 }
 
 // WebSocketEndpoint handles WebSocket connections.
 type WebSocketEndpoint struct {
 	config          *config.Config
-	connections     map[string]*wsConn // connectionID -> conn
-	sessionBindings map[string]string  // connectionID -> sessionID
-	reconnectTokens map[string]string  // sessionID -> token
-	sessionSvc      map[string]ChanSvc // sessionID -> executor (serializes session operations)
+	connections     map[string]*wsConn          // connectionID -> conn
+	sessionBindings map[string]string           // connectionID -> sessionID
+	reconnectTokens map[string]string           // sessionID -> token
+	sessionSvc      map[string]ChanSvc          // sessionID -> executor (serializes session operations)
+	barriers        map[string]*executorBarrier // sessionID -> executor task tracking for flush
+	gates           map[string]*sessionGate     // sessionID -> reload exclusion
 	sessions        *SessionManager
 	handler         *protocol.Handler
 	afterBatch      AfterBatchCallback // Called after each message to detect changes
 	onDisconnectCb  DisconnectCallback // Called when a connection disconnects
+	queued          atomic.Int64       // executor tasks waiting to run, across sessions
+	compression     compressionCounters
 	mu              sync.RWMutex
+
+	// Queues for polling connections (nil disables them)
+	pending *PendingQueueManager
 }
 
 // NewWebSocketEndpoint creates a new WebSocket endpoint.
@@ -62,6 +79,8 @@ func NewWebSocketEndpoint(cfg *config.Config, sessions *SessionManager, handler
 		sessionBindings: make(map[string]string),
 		reconnectTokens: make(map[string]string),
 		sessionSvc:      make(map[string]ChanSvc),
+		barriers:        make(map[string]*executorBarrier),
+		gates:           make(map[string]*sessionGate),
 		sessions:        sessions,
 		handler:         handler,
 	}
@@ -69,7 +88,7 @@ func NewWebSocketEndpoint(cfg *config.Config, sessions *SessionManager, handler
 
 // Log logs a message via the config.
 func (ws *WebSocketEndpoint) Log(level int, format string, args ...interface{}) {
-	ws.config.Log(level, format, args...)
+	ws.config.Logger(config.LogProtocol).Log(level, format, args...)
 }
 
 // SetAfterBatch sets the callback for change detection after message processing.
@@ -89,19 +108,21 @@ func (ws *WebSocketEndpoint) getSession(sessionID string) *Session {
 	return sess
 }
 
-// getOrCreateSvc returns the executor for a session, creating if needed.
-func (ws *WebSocketEndpoint) getOrCreateSvc(sessionID string) ChanSvc {
+// getOrCreateSvc returns the executor for a session, its barrier and its gate, creating if needed.
+func (ws *WebSocketEndpoint) getOrCreateSvc(sessionID string) (ChanSvc, *executorBarrier, *sessionGate) {
 	ws.mu.Lock()
 	defer ws.mu.Unlock()
 
 	if svc, ok := ws.sessionSvc[sessionID]; ok {
-		return svc
+		return svc, ws.barriers[sessionID], ws.gates[sessionID]
 	}
 
 	svc := make(ChanSvc)
 	ws.sessionSvc[sessionID] = svc
+	ws.barriers[sessionID] = newExecutorBarrier()
+	ws.gates[sessionID] = &sessionGate{}
 	RunSvc(svc)
-	return svc
+	return svc, ws.barriers[sessionID], ws.gates[sessionID]
 }
 
 // cleanupSessionSvc closes and removes a session's executor.
@@ -112,36 +133,55 @@ func (ws *WebSocketEndpoint) cleanupSessionSvc(sessionID string) {
 	if svc, ok := ws.sessionSvc[sessionID]; ok {
 		close(svc)
 		delete(ws.sessionSvc, sessionID)
+		ws.barriers[sessionID].close()
+		delete(ws.barriers, sessionID)
+		delete(ws.gates, sessionID)
 	}
 }
 
-// ExecuteInSession executes a function within a session's executor.
+// QueueDepth returns the number of session executor tasks waiting to run.
+func (ws *WebSocketEndpoint) QueueDepth() int64 {
+	return ws.queued.Load()
+}
+
+// ConnectionCounts returns how many WebSocket and polling connections are open.
+func (ws *WebSocketEndpoint) ConnectionCounts() (websockets, polling int) {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	for _, wc := range ws.connections {
+		if wc.poll != nil {
+			polling++
+		} else {
+			websockets++
+		}
+	}
+	return websockets, polling
+}
+
+// queue runs interactive code on a session's executor, counting it in QueueDepth
+// until it starts and holding up flushes until it finishes. It waits out reloads.
+func (ws *WebSocketEndpoint) queue(sessionID string, code func()) {
+	ws.submit(sessionID, OpInteractive, code, nil)
+}
+
+// ExecuteInSession executes a function within a session's executor as an
+// external write (see ExecuteClass).
 // This serializes the execution with WebSocket message processing for the session.
 // AfterBatch is called after execution to detect and push any changes,
 // but only if there are active browser connections to receive the updates.
 // Returns the result and any error from the function.
 func (ws *WebSocketEndpoint) ExecuteInSession(sessionID string, fn func() (interface{}, error)) (interface{}, error) {
-	svc := ws.getOrCreateSvc(sessionID)
-	return SvcSync(svc, func() (interface{}, error) {
-		result, err := fn()
-		// Trigger change detection after execution, but only if there are connections
-		// This prevents marking viewdefs as "sent" before any browser is connected
-		// Use userEvent=false since this is backend-triggered (not user interaction)
-		if ws.afterBatch != nil && ws.HasConnectionsForSession(sessionID) {
-			ws.afterBatch(sessionID, false)
-		}
-		return result, err
-	})
+	return ws.ExecuteClass(sessionID, OpExternalWrite, fn)
 }
 
 // ExecuteInSessionAsync is a fire-and-forget variant of ExecuteInSession.
 // It queues execution through ChanSvc using Svc (async) instead of SvcSync (blocking).
+// It runs as interactive work, so session timers wait out reloads.
 // AfterBatch is called after execution to detect and push any changes.
 // CRC: crc-LuaSession.md
 // Seq: seq-session-timer.md
 func (ws *WebSocketEndpoint) ExecuteInSessionAsync(sessionID string, fn func() (interface{}, error)) {
-	svc := ws.getOrCreateSvc(sessionID)
-	Svc(svc, func() {
+	ws.queue(sessionID, func() {
 		fn()
 		if ws.afterBatch != nil && ws.HasConnectionsForSession(sessionID) {
 			ws.afterBatch(sessionID, false)
@@ -149,31 +189,63 @@ func (ws *WebSocketEndpoint) ExecuteInSessionAsync(sessionID string, fn func() (
 	})
 }
 
+// ScheduleAfterBatch queues change detection for a session after work that
+// ran outside a message, such as Lua property watchers. While one is queued,
+// further calls join it, so a burst of changes costs one AfterBatch.
+// CRC: crc-LuaSession.md
+func (ws *WebSocketEndpoint) ScheduleAfterBatch(sessionID string) {
+	sess := ws.getSession(sessionID)
+	if sess == nil || ws.afterBatch == nil || !sess.batchPending.CompareAndSwap(false, true) {
+		return
+	}
+	ws.queue(sessionID, func() {
+		sess.batchPending.Store(false)
+		if ws.HasConnectionsForSession(sessionID) {
+			ws.afterBatch(sessionID, false)
+		}
+	})
+}
+
 // HandleWebSocket handles incoming WebSocket connections.
 func (ws *WebSocketEndpoint) HandleWebSocket(w http.ResponseWriter, r *http.Request, sessionID string) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	conn, compression, err := ws.upgrade(w, r)
 	if err != nil {
 		ws.Log(0, "WebSocket upgrade failed: %v", err)
 		return
 	}
 
 	connectionID := generateConnectionID()
+	ws.register(connectionID, sessionID, &wsConn{
+		conn:        conn,
+		compression: compression,
+		window:      ws.config.Server.WSBatchWindow.Duration(),
+	})
 
+	// Handle messages
+	go ws.readPump(connectionID, conn)
+}
+
+// register binds a connection to its session, whatever its transport.
+func (ws *WebSocketEndpoint) register(connectionID, sessionID string, wc *wsConn) {
 	ws.mu.Lock()
-	ws.connections[connectionID] = &wsConn{conn: conn}
+	ws.connections[connectionID] = wc
 	ws.sessionBindings[connectionID] = sessionID
 	ws.mu.Unlock()
 
 	// Log connection event (verbosity level 1)
-	ws.Log(1, "WebSocket connected: session=%s conn=%s", sessionID, connectionID)
+	transport := "WebSocket"
+	if wc.poll != nil {
+		transport = "Polling"
+	}
+	ws.Log(1, "%s connected: session=%s conn=%s", transport, sessionID, connectionID)
 
 	// Add connection to session
 	if sess, ok := ws.sessions.GetSession(sessionID); ok {
 		sess.AddConnection(connectionID)
+		if code := sess.takeNotice(); code == sessionResetCode {
+			ws.Send(connectionID, sessionResetMessage())
+		}
 	}
-
-	// Handle messages
-	go ws.readPump(connectionID, conn)
 }
 
 // readPump reads messages from a WebSocket connection.
@@ -202,10 +274,9 @@ func (ws *WebSocketEndpoint) readPump(connectionID string, conn *websocket.Conn)
 		}
 
 		// Queue message processing through session's executor
-		svc := ws.getOrCreateSvc(sessionID)
-		Svc(svc, func() {
+		ws.submit(sessionID, OpInteractive, func() {
 			ws.processMessage(connectionID, sessionID, message)
-		})
+		}, ws.rejectMessage(connectionID))
 	}
 }
 
@@ -217,6 +288,7 @@ func (ws *WebSocketEndpoint) processMessage(connectionID, sessionID string, mess
 	defer func() {
 		if r := recover(); r != nil {
 			ws.Log(0, "PANIC in processMessage: %v", r)
+			ws.handler.Telemetry().OnError(ws.sessions.GetVendedID(sessionID), fmt.Errorf("panic in processMessage: %v", r))
 			ws.handler.SendError(connectionID, 0, fmt.Sprintf("internal error: %v", r))
 		}
 	}()
@@ -239,7 +311,13 @@ func (ws *WebSocketEndpoint) processMessage(connectionID, sessionID string, mess
 	ws.Log(4, "[IN] BATCH %d (%s)", count, evtMsg)
 
 	// Process each message in the batch
+	flush := false
 	for _, msg := range msgs {
+		if msg.Type == protocol.MsgFlush {
+			// Answered after this batch and everything queued before it settles
+			flush = true
+			continue
+		}
 		resp, err := ws.handler.HandleMessage(connectionID, msg)
 		if err != nil {
 			ws.Log(0, "Failed to handle message: %v", err)
@@ -247,9 +325,9 @@ func (ws *WebSocketEndpoint) processMessage(connectionID, sessionID string, mess
 			continue
 		}
 
-		// Send response if there's an error
+		// Send response if there's an error, or a result the frontend asked for
 		// Note: create no longer returns a response (frontend-vended IDs)
-		if resp != nil && resp.Error != "" {
+		if resp != nil && (resp.Error != "" || msg.Type == protocol.MsgGetRoots || msg.Type == protocol.MsgGetErrors) {
 			ws.sendResponse(connectionID, resp)
 		}
 	}
@@ -259,6 +337,9 @@ func (ws *WebSocketEndpoint) processMessage(connectionID, sessionID string, mess
 	if ws.afterBatch != nil {
 		ws.afterBatch(sessionID, userEvent)
 	}
+	if flush {
+		go ws.flush(connectionID, sessionID)
+	}
 }
 
 // sendResponse sends a response to a connection.
@@ -270,19 +351,29 @@ func (ws *WebSocketEndpoint) sendResponse(connectionID string, resp *protocol.Re
 	if !ok {
 		return nil
 	}
+	if wc.poll != nil {
+		wc.poll.respond(resp)
+		return nil
+	}
 
 	// Log response
-	if ws.config.Verbosity() >= 4 {
-		if respJson, err := json.Marshal(resp); err != nil {
-			ws.Log(4, "[OUT] RESPONSE: to=%s data=%+v", connectionID, respJson)
+	if trace := ws.trace(connectionID); trace != nil {
+		if respJson, err := json.Marshal(resp); err == nil {
+			trace.Logf("[OUT] RESPONSE: to=%s data=%s", connectionID, ws.config.Sanitize(string(respJson)))
+		}
+	} else if ws.config.ComponentVerbosity(config.LogProtocol) >= 4 {
+		if respJson, err := json.Marshal(resp); err == nil {
+			ws.Log(4, "[OUT] RESPONSE: to=%s data=%s", connectionID, ws.config.Sanitize(string(respJson)))
 		}
 	} else {
 		ws.Log(2, "[OUT] RESPONSE: to=%s", connectionID)
 	}
 
-	wc.writeMu.Lock()
-	defer wc.writeMu.Unlock()
-	return wc.conn.WriteJSON(resp)
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	return wc.write(data)
 }
 
 // onDisconnect handles connection close.
@@ -292,6 +383,7 @@ func (ws *WebSocketEndpoint) onDisconnect(connectionID string) {
 	delete(ws.connections, connectionID)
 	delete(ws.sessionBindings, connectionID)
 	ws.mu.Unlock()
+	ws.handler.ForgetConnection(connectionID)
 
 	// Log disconnection event (verbosity level 1)
 	ws.Log(1, "WebSocket disconnected: session=%s conn=%s", sessionID, connectionID)
@@ -319,8 +411,10 @@ func (ws *WebSocketEndpoint) Send(connectionID string, msg *protocol.Message) er
 
 	// Log message
 	msgType := strings.ToUpper(string(msg.Type))
-	if ws.config.Verbosity() >= 4 {
-		ws.Log(4, "[OUT] %s: to=%s data=%s", msgType, connectionID, string(msg.Data))
+	if trace := ws.trace(connectionID); trace != nil {
+		trace.Logf("[OUT] %s: to=%s data=%s", msgType, connectionID, ws.config.Sanitize(string(msg.Data)))
+	} else if ws.config.ComponentVerbosity(config.LogProtocol) >= 4 {
+		ws.Log(4, "[OUT] %s: to=%s data=%s", msgType, connectionID, ws.config.Sanitize(string(msg.Data)))
 	} else {
 		ws.Log(2, "[OUT] %s: to=%s", msgType, connectionID)
 	}
@@ -330,9 +424,7 @@ func (ws *WebSocketEndpoint) Send(connectionID string, msg *protocol.Message) er
 		return err
 	}
 
-	wc.writeMu.Lock()
-	defer wc.writeMu.Unlock()
-	return wc.conn.WriteMessage(websocket.TextMessage, data)
+	return wc.send(data, msg)
 }
 
 // SendBatch sends multiple messages as a JSON array to a specific connection.
@@ -355,9 +447,41 @@ func (ws *WebSocketEndpoint) SendBatch(connectionID string, msgs []*protocol.Mes
 		return err
 	}
 
-	wc.writeMu.Lock()
-	defer wc.writeMu.Unlock()
-	return wc.conn.WriteMessage(websocket.TextMessage, data)
+	return wc.send(data, msgs...)
+}
+
+// SendFrame sends one encoded frame holding msgs to each connection, so a
+// frame many connections share is encoded once. Polling connections queue msgs.
+func (ws *WebSocketEndpoint) SendFrame(connectionIDs []string, data []byte, msgs []*protocol.Message) error {
+	ws.mu.RLock()
+	conns := make([]*wsConn, 0, len(connectionIDs))
+	for _, connID := range connectionIDs {
+		if wc, ok := ws.connections[connID]; ok {
+			conns = append(conns, wc)
+		}
+	}
+	ws.mu.RUnlock()
+
+	// A frame's connections share a session, so the first one's trace covers it
+	var trace *protocol.SessionTrace
+	if len(connectionIDs) > 0 {
+		trace = ws.trace(connectionIDs[0])
+	}
+	if trace != nil {
+		trace.Logf("[OUT] FRAME: to=%d connections count=%d data=%s", len(conns), len(msgs), ws.config.Sanitize(string(data)))
+	} else if ws.config.ComponentVerbosity(config.LogProtocol) >= 4 {
+		ws.Log(4, "[OUT] FRAME: to=%d connections count=%d data=%s", len(conns), len(msgs), ws.config.Sanitize(string(data)))
+	} else {
+		ws.Log(2, "[OUT] FRAME: to=%d connections count=%d", len(conns), len(msgs))
+	}
+
+	var firstErr error
+	for _, wc := range conns {
+		if err := wc.send(data, msgs...); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
 }
 
 // Broadcast sends a message to all connections in a session.
@@ -375,8 +499,10 @@ func (ws *WebSocketEndpoint) Broadcast(sessionID string, msg *protocol.Message)
 
 	// Log message
 	msgType := strings.ToUpper(string(msg.Type))
-	if ws.config.Verbosity() >= 4 {
-		ws.Log(4, "[OUT] %s: to=session:%s data=%s", msgType, sessionID, string(msg.Data))
+	if trace := ws.sessionTrace(sessionID); trace != nil {
+		trace.Logf("[OUT] %s: to=session:%s data=%s", msgType, sessionID, ws.config.Sanitize(string(msg.Data)))
+	} else if ws.config.ComponentVerbosity(config.LogProtocol) >= 4 {
+		ws.Log(4, "[OUT] %s: to=session:%s data=%s", msgType, sessionID, ws.config.Sanitize(string(msg.Data)))
 	} else {
 		ws.Log(2, "[OUT] %s: to=session:%s", msgType, sessionID)
 	}
@@ -387,13 +513,34 @@ func (ws *WebSocketEndpoint) Broadcast(sessionID string, msg *protocol.Message)
 	}
 
 	for _, wc := range conns {
-		wc.writeMu.Lock()
-		wc.conn.WriteMessage(websocket.TextMessage, data)
-		wc.writeMu.Unlock()
+		wc.send(data, msg)
 	}
 	return nil
 }
 
+// NotifyAll sends every WebSocket connection its own message from build.
+// Used for notices that must differ per client, such as jittered retry hints.
+// Polling connections get them through their pending queues.
+func (ws *WebSocketEndpoint) NotifyAll(build func() *protocol.Message) {
+	ws.mu.RLock()
+	conns := make([]*wsConn, 0, len(ws.connections))
+	for _, wc := range ws.connections {
+		if wc.poll == nil {
+			conns = append(conns, wc)
+		}
+	}
+	ws.mu.RUnlock()
+
+	ws.Log(2, "[OUT] NOTIFY: to=all (%d connections)", len(conns))
+	for _, wc := range conns {
+		data, err := build().Encode()
+		if err != nil {
+			continue
+		}
+		wc.write(data)
+	}
+}
+
 // IsConnected checks if a connection is active.
 func (ws *WebSocketEndpoint) IsConnected(connectionID string) bool {
 	ws.mu.RLock()
@@ -402,6 +549,22 @@ func (ws *WebSocketEndpoint) IsConnected(connectionID string) bool {
 	return ok
 }
 
+// trace returns the trace of a connection's session, or nil.
+func (ws *WebSocketEndpoint) trace(connectionID string) *protocol.SessionTrace {
+	if ws.handler == nil {
+		return nil
+	}
+	return ws.handler.ConnectionTrace(connectionID)
+}
+
+// sessionTrace returns a session's trace (internal ID), or nil.
+func (ws *WebSocketEndpoint) sessionTrace(sessionID string) *protocol.SessionTrace {
+	if sess := ws.sessions.Get(sessionID); sess != nil {
+		return sess.Trace()
+	}
+	return nil
+}
+
 // GetSessionID returns the session ID for a connection.
 func (ws *WebSocketEndpoint) GetSessionID(connectionID string) (string, bool) {
 	ws.mu.RLock()
@@ -430,6 +593,20 @@ func (ws *WebSocketEndpoint) HasConnectionsForSession(sessionID string) bool {
 	return false
 }
 
+// QueuedMessages returns the messages waiting in a session's polling
+// connections' queues.
+func (ws *WebSocketEndpoint) QueuedMessages(sessionID string) []*protocol.Message {
+	ws.mu.RLock()
+	defer ws.mu.RUnlock()
+	var msgs []*protocol.Message
+	for connID, sessID := range ws.sessionBindings {
+		if wc := ws.connections[connID]; sessID == sessionID && wc != nil && wc.poll != nil {
+			msgs = append(msgs, wc.poll.queue.Messages()...)
+		}
+	}
+	return msgs
+}
+
 // IsSessionReconnectable checks if a session can be rejoined.
 // A session can be rejoined if it exists and hasn't timed out.
 func (ws *WebSocketEndpoint) IsSessionReconnectable(sessionID string) bool {
@@ -0,0 +1,56 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Message Batching)
+package server
+
+import (
+	"time"
+)
+
+// queue sends a frame once the connection's batch window has passed since the
+// first frame it holds, joined with the others in one array frame. A window of
+// 0 writes it at once.
+func (wc *wsConn) queue(data []byte) error {
+	if wc.window <= 0 {
+		return wc.write(data)
+	}
+	wc.writeMu.Lock()
+	defer wc.writeMu.Unlock()
+	wc.pending = append(wc.pending, data)
+	if wc.batchTimer == nil {
+		wc.batchTimer = time.AfterFunc(wc.window, func() {
+			wc.writeMu.Lock()
+			defer wc.writeMu.Unlock()
+			wc.drainLocked()
+		})
+	}
+	return nil
+}
+
+// drainLocked writes the frames the connection holds as one frame, for a
+// caller holding writeMu. Anything written directly drains first, so frames
+// keep their order and a flush's seq covers them.
+func (wc *wsConn) drainLocked() error {
+	if wc.batchTimer != nil {
+		wc.batchTimer.Stop()
+		wc.batchTimer = nil
+	}
+	pending := wc.pending
+	wc.pending = nil
+	switch len(pending) {
+	case 0:
+		return nil
+	case 1:
+		return wc.writeLocked(pending[0])
+	}
+	parts := make([][]byte, 0, len(pending))
+	for _, data := range pending {
+		if data[0] == '[' {
+			// Already an array frame: its messages join the others
+			if data = data[1 : len(data)-1]; len(data) == 0 {
+				continue
+			}
+		}
+		parts = append(parts, data)
+	}
+	return wc.writeLocked(joinFrame(parts))
+}
@@ -0,0 +1,92 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: protocol.md (Message Batching)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestWebSocketBatchWindow sends 50 updates to a connection, with an array
+// frame among them, and verifies the batch window delivers them in order in one
+// frame where a window of 0 takes one frame per send
+func TestWebSocketBatchWindow(t *testing.T) {
+	for _, window := range []time.Duration{0, 5 * time.Millisecond} {
+		cfg := config.DefaultConfig()
+		cfg.Server.WSBatchWindow = config.Duration(window)
+		sessions := NewSessionManager(time.Hour)
+		sess, _, _ := sessions.CreateSession()
+		ws := NewWebSocketEndpoint(cfg, sessions, protocol.NewHandler(cfg, nil))
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ws.HandleWebSocket(w, r, sess.ID)
+		}))
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var connID string
+		for deadline := time.Now().Add(time.Second); connID == "" && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			for _, id := range sess.GetConnections() {
+				connID = id
+			}
+		}
+
+		update := func(id int64) *protocol.Message {
+			msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: id, Value: json.RawMessage(`"x"`)})
+			return msg
+		}
+		for id := int64(1); id <= 48; id++ {
+			ws.Send(connID, update(id))
+		}
+		ws.SendBatch(connID, []*protocol.Message{update(49), update(50)})
+
+		frames := 0
+		var ids []int64
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		for len(ids) < 50 {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				t.Fatalf("window %v: after %d frames: %v", window, frames, err)
+			}
+			frames++
+			var msgs []protocol.Message
+			if data[0] != '[' {
+				msgs = make([]protocol.Message, 1)
+				err = json.Unmarshal(data, &msgs[0])
+			} else {
+				err = json.Unmarshal(data, &msgs)
+			}
+			if err != nil {
+				t.Fatalf("window %v: frame %s: %v", window, data, err)
+			}
+			for _, msg := range msgs {
+				var u protocol.UpdateMessage
+				json.Unmarshal(msg.Data, &u)
+				ids = append(ids, u.VarID)
+			}
+		}
+		for i, id := range ids {
+			if id != int64(i+1) {
+				t.Fatalf("window %v: updates out of order: %v", window, ids)
+			}
+		}
+		want := 49
+		if window > 0 {
+			want = 1
+		}
+		if frames != want {
+			t.Errorf("window %v: 50 updates took %d frames, want %d", window, frames, want)
+		}
+		t.Logf("window %v: 50 updates in %d frames", window, frames)
+		conn.Close()
+		srv.Close()
+	}
+}
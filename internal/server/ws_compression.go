@@ -0,0 +1,126 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: interfaces.md (WebSocket Compression)
+package server
+
+import (
+	"bufio"
+	"compress/flate"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// wsCompressionLevel favors latency; viewdefs and updates are mostly
+	// repetitive JSON and HTML that deflate well even at the fastest level
+	wsCompressionLevel = flate.BestSpeed
+	// wsCompressMinSize is the smallest message worth deflating
+	wsCompressMinSize = 256
+)
+
+// CompressionStats reports WebSocket compression, for connections that
+// negotiated it.
+type CompressionStats struct {
+	Enabled      bool  `json:"enabled"`      // Compression is offered to clients
+	Connections  int64 `json:"connections"`  // Connections that negotiated it
+	Messages     int64 `json:"messages"`     // Messages sent on them
+	PayloadBytes int64 `json:"payloadBytes"` // Bytes of those messages before compression
+	WireBytes    int64 `json:"wireBytes"`    // Bytes written to the network, frame headers included
+}
+
+// compressionCounters accumulates CompressionStats across connections.
+type compressionCounters struct {
+	connections  atomic.Int64
+	messages     atomic.Int64
+	payloadBytes atomic.Int64
+	wireBytes    atomic.Int64
+}
+
+// countingConn counts the bytes a compressed connection writes to the network
+// once counting starts, after the handshake.
+type countingConn struct {
+	net.Conn
+	counters *compressionCounters
+	counting atomic.Bool
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if c.counting.Load() {
+		c.counters.wireBytes.Add(int64(n))
+	}
+	return n, err
+}
+
+// countingWriter hijacks its connection wrapped in a countingConn.
+type countingWriter struct {
+	http.ResponseWriter
+	counters *compressionCounters
+	conn     *countingConn
+}
+
+func (w *countingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = &countingConn{Conn: conn, counters: w.counters}
+	return w.conn, brw, nil
+}
+
+// upgrade upgrades a request to a WebSocket connection, with per-message
+// deflate when it is enabled and the client offers it. A client can ask for
+// none with ?compress=0. Returns the connection's counters if it compresses.
+func (ws *WebSocketEndpoint) upgrade(w http.ResponseWriter, r *http.Request) (*websocket.Conn, *compressionCounters, error) {
+	_, hijacker := w.(http.Hijacker)
+	if !ws.config.Server.WSCompression || r.URL.Query().Get("compress") == "0" || !offersDeflate(r) || !hijacker {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		return conn, nil, err
+	}
+	cw := &countingWriter{ResponseWriter: w, counters: &ws.compression}
+	compressing := upgrader
+	compressing.EnableCompression = true
+	conn, err := compressing.Upgrade(cw, r, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetCompressionLevel(wsCompressionLevel)
+	ws.compression.connections.Add(1)
+	cw.conn.counting.Store(true)
+	return conn, &ws.compression, nil
+}
+
+// offersDeflate reports whether a WebSocket request offers per-message
+// deflate, which the upgrader then always accepts.
+func offersDeflate(r *http.Request) bool {
+	for _, header := range r.Header.Values("Sec-Websocket-Extensions") {
+		for _, ext := range strings.Split(header, ",") {
+			name, _, _ := strings.Cut(ext, ";")
+			if strings.TrimSpace(name) == "permessage-deflate" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompressionStats returns the WebSocket compression counters.
+func (ws *WebSocketEndpoint) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Enabled:      ws.config.Server.WSCompression,
+		Connections:  ws.compression.connections.Load(),
+		Messages:     ws.compression.messages.Load(),
+		PayloadBytes: ws.compression.payloadBytes.Load(),
+		WireBytes:    ws.compression.wireBytes.Load(),
+	}
+}
+
+// handleCompressionStats serves /api/debug/compression.
+func (s *Server) handleCompressionStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.wsEndpoint.CompressionStats())
+}
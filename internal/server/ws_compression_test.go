@@ -0,0 +1,76 @@
+// CRC: crc-WebSocketEndpoint.md
+// Spec: interfaces.md (WebSocket Compression)
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+)
+
+// TestWebSocketCompression verifies a client offering deflate gets compressed
+// messages counted in CompressionStats, and one asking for none (?compress=0)
+// does not
+func TestWebSocketCompression(t *testing.T) {
+	cfg := config.DefaultConfig()
+	sessions := NewSessionManager(time.Hour)
+	sess, _, _ := sessions.CreateSession()
+	ws := NewWebSocketEndpoint(cfg, sessions, protocol.NewHandler(cfg, nil))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws.HandleWebSocket(w, r, sess.ID)
+	}))
+	defer srv.Close()
+	viewdef, _ := json.Marshal(strings.Repeat(`<div class="row"><span ui-value="name"></span></div>`, 400))
+	msg, _ := protocol.NewMessage(protocol.MsgUpdate, protocol.UpdateMessage{VarID: 1, Value: viewdef})
+	want, _ := msg.Encode()
+
+	for _, query := range []string{"", "?compress=0"} {
+		before := ws.CompressionStats()
+		dialer := websocket.Dialer{EnableCompression: true}
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var connID string
+		for deadline := time.Now().Add(time.Second); connID == "" && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+			for _, id := range sess.GetConnections() {
+				connID = id
+			}
+		}
+		ws.Send(connID, msg)
+		_, data, err := conn.ReadMessage()
+		if err != nil || string(data) != string(want) {
+			t.Fatalf("%q: read %d bytes, %v", query, len(data), err)
+		}
+		conn.Close()
+		ws.onDisconnect(connID)
+
+		stats := ws.CompressionStats()
+		sent := CompressionStats{
+			Enabled:      true,
+			Connections:  stats.Connections - before.Connections,
+			Messages:     stats.Messages - before.Messages,
+			PayloadBytes: stats.PayloadBytes - before.PayloadBytes,
+			WireBytes:    stats.WireBytes - before.WireBytes,
+		}
+		if query != "" {
+			if sent != (CompressionStats{Enabled: true}) {
+				t.Errorf("uncompressed connection counted: %+v", sent)
+			}
+			continue
+		}
+		if sent.Connections != 1 || sent.Messages != 1 || sent.PayloadBytes != int64(len(want)) {
+			t.Errorf("stats = %+v, want one message of %d bytes", sent, len(want))
+		}
+		if sent.WireBytes == 0 || sent.WireBytes > sent.PayloadBytes/10 {
+			t.Errorf("%d bytes on the wire for %d bytes of messages", sent.WireBytes, sent.PayloadBytes)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md (Generating Tests)
+package uitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/protocol"
+	"github.com/zot/ui-engine/internal/server"
+)
+
+// SessionPlaceholder stands for the session ID in expected values, since each
+// run gets a new session.
+const SessionPlaceholder = "$session"
+
+// Step is one inbound message and what the server should answer. Response is
+// compared structurally; Updates must arrive in order, among other messages.
+type Step struct {
+	Send     string   // A protocol.Message as JSON
+	Response string   // Expected response JSON, or "" to skip the check
+	Updates  []string // Expected outbound messages as JSON
+}
+
+// Harness drives one session of a server through its polling API, as a
+// frontend that cannot use a WebSocket would.
+type Harness struct {
+	t       testing.TB
+	Server  *server.Server
+	Session string // Internal session ID
+	conn    string
+}
+
+// New starts a server for siteDir, or for an empty app when siteDir is "",
+// and connects to a new session. The server shuts down when the test ends.
+func New(t testing.TB, siteDir string) *Harness {
+	t.Helper()
+	if siteDir == "" {
+		siteDir = t.TempDir()
+		os.MkdirAll(filepath.Join(siteDir, "lua"), 0755)
+		os.WriteFile(filepath.Join(siteDir, "lua", "main.lua"), nil, 0644)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Server.Dir = siteDir
+	s := server.New(cfg)
+	t.Cleanup(func() { s.Shutdown(context.Background()) })
+	sess, _, err := s.GetSessions().CreateSession()
+	if err != nil {
+		t.Fatalf("failed to create session: %v", err)
+	}
+	h := &Harness{t: t, Server: s, Session: sess.ID}
+	var connected struct {
+		Result protocol.ConnectResponse `json:"result"`
+	}
+	if err := json.Unmarshal(h.post("/"+sess.ID+"/connect", nil), &connected); err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	h.conn = connected.Result.Connection
+	return h
+}
+
+// Send sends a message and returns the response and the messages the server
+// queued for the connection meanwhile.
+func (h *Harness) Send(msg string) (json.RawMessage, []json.RawMessage) {
+	h.t.Helper()
+	var m protocol.Message
+	if err := json.Unmarshal([]byte(msg), &m); err != nil {
+		h.t.Fatalf("invalid message %s: %v", msg, err)
+	}
+	resp := h.post("/api/"+string(m.Type)+"?conn="+h.conn, []byte(msg))
+	var polled struct {
+		Result []json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(h.post("/api/poll?conn="+h.conn, []byte(`{}`)), &polled); err != nil {
+		h.t.Fatalf("invalid poll response: %v", err)
+	}
+	return resp, polled.Result
+}
+
+// Replay sends each step's message and checks its response and updates,
+// ignoring the values at the ignore paths (see Match).
+func (h *Harness) Replay(steps []Step, ignore ...string) {
+	h.t.Helper()
+	for i, step := range steps {
+		resp, updates := h.Send(step.Send)
+		if step.Response != "" {
+			if diff := Match(h.normalize(resp), json.RawMessage(step.Response), ignore); diff != "" {
+				h.t.Errorf("step %d %s: response %s", i+1, step.Send, diff)
+			}
+		}
+		next := 0
+		for _, want := range step.Updates {
+			for next < len(updates) && Match(h.normalize(updates[next]), json.RawMessage(want), ignore) != "" {
+				next++
+			}
+			if next == len(updates) {
+				h.t.Errorf("step %d %s: no update matching %s", i+1, step.Send, want)
+				break
+			}
+			next++
+		}
+	}
+}
+
+// normalize replaces the session ID with SessionPlaceholder.
+func (h *Harness) normalize(data json.RawMessage) json.RawMessage {
+	return bytes.ReplaceAll(data, []byte(h.Session), []byte(SessionPlaceholder))
+}
+
+func (h *Harness) post(path string, body []byte) []byte {
+	h.t.Helper()
+	w := httptest.NewRecorder()
+	h.Server.HttpEndpoint.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body)))
+	if w.Code != http.StatusOK {
+		h.t.Fatalf("POST %s returned %d: %s", path, w.Code, w.Body.String())
+	}
+	return w.Body.Bytes()
+}
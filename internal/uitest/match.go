@@ -0,0 +1,113 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md (Generating Tests)
+package uitest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Match compares two JSON values structurally, so key order and spacing do
+// not matter. Values at the ignore paths are skipped; a path is dotted keys
+// and array indexes where * matches any one, e.g. "result.*.time". Returns ""
+// when they match, or where they first differ.
+func Match(got, want json.RawMessage, ignore []string) string {
+	var g, w any
+	if err := decode(got, &g); err != nil {
+		return fmt.Sprintf("is not JSON: %v", err)
+	}
+	if err := decode(want, &w); err != nil {
+		return fmt.Sprintf("expected value is not JSON: %v", err)
+	}
+	return match(nil, g, w, ignore)
+}
+
+func decode(data json.RawMessage, v *any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func match(path []string, got, want any, ignore []string) string {
+	if ignored(path, ignore) {
+		return ""
+	}
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return mismatch(path, got, want)
+		}
+		keys := make([]string, 0, len(w)+len(g))
+		for key := range w {
+			keys = append(keys, key)
+		}
+		for key := range g {
+			if _, ok := w[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		slices.Sort(keys)
+		for _, key := range keys {
+			gv, gok := g[key]
+			wv, wok := w[key]
+			sub := append(slices.Clip(path), key)
+			if gok != wok {
+				if ignored(sub, ignore) {
+					continue
+				}
+				return fmt.Sprintf("differs at %q: got %s, want %s", strings.Join(sub, "."), present(gv, gok), present(wv, wok))
+			}
+			if diff := match(sub, gv, wv, ignore); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	case []any:
+		g, ok := got.([]any)
+		if !ok || len(g) != len(w) {
+			return mismatch(path, got, want)
+		}
+		for i := range w {
+			if diff := match(append(slices.Clip(path), strconv.Itoa(i)), g[i], w[i], ignore); diff != "" {
+				return diff
+			}
+		}
+		return ""
+	default:
+		if got != want {
+			return mismatch(path, got, want)
+		}
+		return ""
+	}
+}
+
+// ignored reports whether path matches one of the ignore paths.
+func ignored(path, ignore []string) bool {
+	for _, pattern := range ignore {
+		parts := strings.Split(pattern, ".")
+		if len(parts) == len(path) && slices.EqualFunc(parts, path, func(p, s string) bool {
+			return p == "*" || p == s
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+func mismatch(path []string, got, want any) string {
+	return fmt.Sprintf("differs at %q: got %s, want %s", strings.Join(path, "."), present(got, true), present(want, true))
+}
+
+// present formats a value for a mismatch, or "missing" for an absent key.
+func present(v any, ok bool) string {
+	if !ok {
+		return "missing"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
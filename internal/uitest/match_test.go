@@ -0,0 +1,33 @@
+// CRC: crc-ProtocolHandler.md
+// Spec: deployment.md (Generating Tests)
+package uitest
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// TestMatch verifies structural matching and ignore paths
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		got, want string
+		ignore    []string
+		diff      string // Substring of the result; "" means they match
+	}{
+		{`{"a":1,"b":[true,"x"]}`, `{"b":[true,"x"], "a":1}`, nil, ""},
+		{`{"a":1}`, `{"a":2}`, nil, `differs at "a": got 1, want 2`},
+		{`{"a":1}`, `{"a":1,"b":null}`, nil, `differs at "b": got missing, want null`},
+		{`{"a":[1,2]}`, `{"a":[1]}`, nil, `differs at "a"`},
+		{`{"a":{"time":"now","v":1}}`, `{"a":{"time":"then","v":1}}`, []string{"a.time"}, ""},
+		{`{"r":[{"t":1},{"t":2}]}`, `{"r":[{"t":3},{"t":4}]}`, []string{"r.*.t"}, ""},
+		{`{"r":[{"t":1}]}`, `{"r":[{}]}`, []string{"r.*.t"}, ""},
+		{`{"a":1.0}`, `{"a":1}`, nil, `differs at "a"`},
+	}
+	for _, tt := range tests {
+		diff := Match(json.RawMessage(tt.got), json.RawMessage(tt.want), tt.ignore)
+		if (tt.diff == "") != (diff == "") || !strings.Contains(diff, tt.diff) {
+			t.Errorf("Match(%s, %s, %v) = %q, want %q", tt.got, tt.want, tt.ignore, diff, tt.diff)
+		}
+	}
+}
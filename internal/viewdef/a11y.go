@@ -0,0 +1,197 @@
+// Accessibility audit of viewdef HTML (--a11y-audit).
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md
+package viewdef
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// Audit rules; each can be suppressed with <!-- a11y-ignore: RULE ... --> in the viewdef.
+const (
+	RuleImgAlt     = "img-alt"     // <img> (or <input type="image">) without alt
+	RuleInputLabel = "input-label" // Form control without a label
+	RuleHTMLLang   = "html-lang"   // <html> without lang
+)
+
+var (
+	a11yTagPattern     = regexp.MustCompile(`<(/?)([A-Za-z][A-Za-z0-9-]*)((?:\s+[^\s=>/]+(?:\s*=\s*(?:"[^"]*"|'[^']*'|[^\s>]+))?)*)\s*/?>`)
+	a11yAttrPattern    = regexp.MustCompile(`([^\s=>/]+)(?:\s*=\s*("[^"]*"|'[^']*'|[^\s>]+))?`)
+	a11yCommentPattern = regexp.MustCompile(`<!--[\s\S]*?-->`)
+	a11yIgnorePattern  = regexp.MustCompile(`^<!--\s*a11y-ignore:?([\s\S]*?)-->$`)
+)
+
+// A11yFinding is one accessibility problem in a viewdef.
+type A11yFinding struct {
+	Rule    string `json:"rule"`
+	Line    int    `json:"line"`
+	Message string `json:"message"`
+}
+
+func (f A11yFinding) String() string {
+	return fmt.Sprintf("a11y %s (line %d): %s", f.Rule, f.Line, f.Message)
+}
+
+// a11yTag is a start tag found in viewdef HTML.
+type a11yTag struct {
+	name  string
+	attrs map[string]string
+	line  int
+}
+
+// has reports whether the tag sets one of the attributes directly or binds it with ui-attr-*.
+func (t *a11yTag) has(names ...string) bool {
+	for _, name := range names {
+		if _, ok := t.attrs[name]; ok {
+			return true
+		}
+		if _, ok := t.attrs["ui-attr-"+name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditA11y checks viewdef HTML for missing alt text, unlabelled form controls
+// and a missing document language. It is analysis only: the HTML is not changed.
+func AuditA11y(html string) []A11yFinding {
+	ignored := make(map[string]bool)
+	// Blank comments (keeping newlines) so tags inside them are not audited
+	scan := a11yCommentPattern.ReplaceAllStringFunc(html, func(comment string) string {
+		if m := a11yIgnorePattern.FindStringSubmatch(comment); m != nil {
+			for _, rule := range strings.FieldsFunc(m[1], func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\n' }) {
+				ignored[rule] = true
+			}
+		}
+		return strings.Map(func(r rune) rune {
+			if r == '\n' {
+				return r
+			}
+			return ' '
+		}, comment)
+	})
+
+	var findings []A11yFinding
+	report := func(rule string, line int, format string, args ...any) {
+		if !ignored[rule] {
+			findings = append(findings, A11yFinding{Rule: rule, Line: line, Message: fmt.Sprintf(format, args...)})
+		}
+	}
+
+	labelDepth := 0
+	labelled := make(map[string]bool) // IDs named by <label for=...>
+	var unlabelled []*a11yTag         // controls outside any <label>, checked once every label is known
+	for _, m := range a11yTagPattern.FindAllStringSubmatchIndex(scan, -1) {
+		name := strings.ToLower(scan[m[4]:m[5]])
+		if m[3] > m[2] {
+			if name == "label" && labelDepth > 0 {
+				labelDepth--
+			}
+			continue
+		}
+		tag := &a11yTag{name: name, attrs: parseA11yAttrs(scan[m[6]:m[7]]), line: strings.Count(scan[:m[0]], "\n") + 1}
+		switch name {
+		case "label":
+			if id := tag.attrs["for"]; id != "" {
+				labelled[id] = true
+			}
+			if !strings.HasSuffix(scan[m[0]:m[1]], "/>") {
+				labelDepth++
+			}
+		case "html":
+			if !tag.has("lang") {
+				report(RuleHTMLLang, tag.line, "<html> has no lang attribute")
+			}
+		case "img":
+			if !tag.has("alt") {
+				report(RuleImgAlt, tag.line, "<img> has no alt attribute")
+			}
+		case "input":
+			switch strings.ToLower(tag.attrs["type"]) {
+			case "hidden", "submit", "button", "reset":
+				continue
+			case "image":
+				if !tag.has("alt") {
+					report(RuleImgAlt, tag.line, `<input type="image"> has no alt attribute`)
+				}
+				continue
+			}
+			fallthrough
+		case "select", "textarea", "sl-input", "sl-select", "sl-textarea":
+			if labelDepth == 0 && !tag.has("aria-label", "aria-labelledby", "title", "label") {
+				unlabelled = append(unlabelled, tag)
+			}
+		}
+	}
+	for _, tag := range unlabelled {
+		if id := tag.attrs["id"]; id == "" || !labelled[id] {
+			report(RuleInputLabel, tag.line, "<%s> has no label (wrap it in <label> or set aria-label)", tag.name)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return findings
+}
+
+// parseA11yAttrs returns a tag's attributes with lowercase names and unquoted values.
+func parseA11yAttrs(attrs string) map[string]string {
+	result := make(map[string]string)
+	for _, m := range a11yAttrPattern.FindAllStringSubmatch(attrs, -1) {
+		result[strings.ToLower(m[1])] = strings.Trim(m[2], `"'`)
+	}
+	return result
+}
+
+// auditA11y audits a viewdef when --a11y-audit is on, logging and recording
+// its findings. Returns the findings. Must be called with write lock held.
+func (m *ViewdefManager) auditA11y(key, content string) []A11yFinding {
+	if m.config == nil || !m.config.Server.A11yAudit {
+		return nil
+	}
+	findings := AuditA11y(content)
+	if len(findings) == 0 {
+		delete(m.a11y, key)
+		return nil
+	}
+	m.a11y[key] = findings
+	for _, f := range findings {
+		m.config.Logger(config.LogViewdef).Log(1, "Viewdef %s: %s", key, f)
+	}
+	return findings
+}
+
+// A11yFindings returns the recorded audit findings of a viewdef.
+func (m *ViewdefManager) A11yFindings(key string) []A11yFinding {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.a11y[key]
+}
+
+// A11yDiags returns the audit findings of every viewdef of a type, as
+// diagnostic lines ("KEY: finding") ordered by viewdef key.
+func (m *ViewdefManager) A11yDiags(typeName string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.a11y) == 0 || typeName == "" {
+		return nil
+	}
+	prefix := typeName + "."
+	var keys []string
+	for key := range m.a11y {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	var diags []string
+	for _, key := range keys {
+		for _, f := range m.a11y[key] {
+			diags = append(diags, key+": "+f.String())
+		}
+	}
+	return diags
+}
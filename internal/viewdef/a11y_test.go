@@ -0,0 +1,88 @@
+// Spec: viewdefs.md (Accessibility audit)
+package viewdef
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func findingRules(findings []A11yFinding) []string {
+	var rules []string
+	for _, f := range findings {
+		rules = append(rules, f.Rule)
+	}
+	return rules
+}
+
+func TestAuditA11y(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want []string
+	}{
+		{"img without alt", `<template><img src="a.png"></template>`, []string{RuleImgAlt}},
+		{"img with bound alt", `<template><img src="a.png" ui-attr-alt="caption"></template>`, nil},
+		{"decorative img", `<template><img src="a.png" alt=""></template>`, nil},
+		{"unlabelled input", "<template>\n<input ui-value=\"name\"></template>", []string{RuleInputLabel}},
+		{"input in label", `<template><label>Name <input ui-value="name"></label></template>`, nil},
+		{"input with label for", `<template><input id="n" ui-value="name"><label for="n">Name</label></template>`, nil},
+		{"shoelace label attribute", `<template><sl-input label="Name" ui-value="name"></sl-input></template>`, nil},
+		{"hidden input", `<template><input type="hidden" ui-value="id"></template>`, nil},
+		{"html without lang", `<html><body></body></html>`, []string{RuleHTMLLang}},
+		{"tags in comments", `<template><!-- <img src="old.png"> --></template>`, nil},
+		{"suppressed rule", `<template><!-- a11y-ignore: img-alt --><img src="a.png"><select></select></template>`, []string{RuleInputLabel}},
+		{"suppressed rules", `<template><!-- a11y-ignore: img-alt, input-label --><img src="a.png"><select></select></template>`, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findingRules(AuditA11y(tt.html)); !slices.Equal(got, tt.want) {
+				t.Errorf("rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	findings := AuditA11y("<template>\n  <div>\n    <img src=\"a.png\">\n</template>")
+	if len(findings) != 1 || findings[0].Line != 3 {
+		t.Errorf("findings = %v, want one on line 3", findings)
+	}
+}
+
+func TestA11yAuditOnLoad(t *testing.T) {
+	dir := createTempViewdefDir(t)
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "Contact.DEFAULT.html"), []byte(`<template><img src="a.png"></template>`), 0644)
+
+	cfg := testViewdefConfig()
+	cfg.Server.A11yAudit = true
+	m := NewViewdefManager()
+	m.SetConfig(cfg)
+	if err := m.LoadFromDirectory(dir); err != nil {
+		t.Fatal(err)
+	}
+	if got := findingRules(m.A11yFindings("Contact.DEFAULT")); !slices.Equal(got, []string{RuleImgAlt}) {
+		t.Errorf("findings on load = %v", got)
+	}
+	if diags := m.A11yDiags("Contact"); len(diags) != 1 {
+		t.Errorf("diags = %v, want 1", diags)
+	}
+
+	// Uploading a fixed viewdef clears the findings
+	if findings := m.AddViewdef("Contact.DEFAULT", `<template><img src="a.png" alt="Photo"></template>`); findings != nil {
+		t.Errorf("upload findings = %v, want none", findings)
+	}
+	if findings := m.AddViewdef("Contact.COMPACT", `<template><input></template>`); len(findings) != 1 {
+		t.Errorf("upload findings = %v, want 1", findings)
+	}
+	if diags := m.A11yDiags("Contact"); len(diags) != 1 {
+		t.Errorf("diags after upload = %v, want 1", diags)
+	}
+
+	// Without --a11y-audit nothing is recorded
+	off := NewViewdefManager()
+	off.SetConfig(testViewdefConfig())
+	if findings := off.AddViewdef("Contact.DEFAULT", `<template><img></template>`); findings != nil {
+		t.Errorf("findings with audit off = %v", findings)
+	}
+}
@@ -8,11 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"sync"
-	"time"
 
-	"github.com/fsnotify/fsnotify"
 	"github.com/zot/ui-engine/internal/config"
+	"github.com/zot/ui-engine/internal/watchcore"
 )
 
 // SessionPusher provides session management for hot-loading viewdefs.
@@ -25,162 +23,66 @@ type SessionPusher interface {
 }
 
 // HotLoader watches the viewdef directory for file changes and triggers pushes.
+// File watching, symlink tracking and debouncing are handled by watchcore.
 type HotLoader struct {
-	config     *config.Config
+	log        config.Logger
 	viewdefDir string
-	watcher    *fsnotify.Watcher
+	core       *watchcore.Core
 	manager    *ViewdefManager
 	sessions   SessionPusher
-
-	// Symlink tracking (see cross-cutting: Hot-Loading Symlink Tracking)
-	symlinkTargets map[string]string // viewdef file path -> resolved target dir
-	watchedDirs    map[string]int    // dir path -> reference count
-	mu             sync.Mutex
-
-	// Debouncing
-	pendingReloads map[string]time.Time
-	debounceMu     sync.Mutex
-	debounceDelay  time.Duration
-
-	done chan struct{}
 }
 
 // NewHotLoader creates a new hot loader for the given viewdef directory.
 func NewHotLoader(cfg *config.Config, viewdefDir string, manager *ViewdefManager, sessions SessionPusher) (*HotLoader, error) {
-	watcher, err := fsnotify.NewWatcher()
+	h := &HotLoader{
+		log:        cfg.Logger(config.LogViewdef),
+		viewdefDir: viewdefDir,
+		manager:    manager,
+		sessions:   sessions,
+	}
+	core, err := watchcore.New(h.log, "ViewdefHotLoader", viewdefDir, h)
 	if err != nil {
 		return nil, err
 	}
-
-	h := &HotLoader{
-		config:         cfg,
-		viewdefDir:     viewdefDir,
-		watcher:        watcher,
-		manager:        manager,
-		sessions:       sessions,
-		symlinkTargets: make(map[string]string),
-		watchedDirs:    make(map[string]int),
-		pendingReloads: make(map[string]time.Time),
-		debounceDelay:  100 * time.Millisecond,
-		done:           make(chan struct{}),
-	}
-
+	h.core = core
 	return h, nil
 }
 
 // Start begins watching for file changes.
 func (h *HotLoader) Start() error {
-	// Watch the main viewdef directory
-	if err := h.addWatch(h.viewdefDir); err != nil {
+	if err := h.core.Start(); err != nil {
 		return err
 	}
-
-	// Scan for existing symlinks and watch their target directories
-	if err := h.scanSymlinks(); err != nil {
-		h.config.Log(1, "ViewdefHotLoader: error scanning symlinks: %v", err)
-	}
-
-	// Start the event loop
-	go h.eventLoop()
-
-	// Start the debounce processor
-	go h.debounceLoop()
-
-	h.config.Log(1, "ViewdefHotLoader: watching %s for changes", h.viewdefDir)
+	h.log.Log(1, "ViewdefHotLoader: watching %s for changes", h.viewdefDir)
 	return nil
 }
 
 // Stop stops the hot loader.
 func (h *HotLoader) Stop() error {
-	close(h.done)
-	return h.watcher.Close()
+	return h.core.Stop()
 }
 
-// eventLoop processes file system events.
-func (h *HotLoader) eventLoop() {
-	for {
-		select {
-		case <-h.done:
-			return
-		case event, ok := <-h.watcher.Events:
-			if !ok {
-				return
-			}
-			h.handleEvent(event)
-		case err, ok := <-h.watcher.Errors:
-			if !ok {
-				return
-			}
-			h.config.Log(1, "ViewdefHotLoader: watcher error: %v", err)
-		}
-	}
+// WatchesFile reports whether a file is a viewdef or metadata sidecar.
+// Implements watchcore.Listener.
+func (h *HotLoader) WatchesFile(name string) bool {
+	return isViewdefFile(name)
 }
 
-// handleEvent processes a single file system event.
-func (h *HotLoader) handleEvent(event fsnotify.Event) {
-	// Only care about .html files
-	if !strings.HasSuffix(event.Name, ".html") {
-		return
-	}
-
-	h.config.Log(3, "ViewdefHotLoader: event %s on %s", event.Op, event.Name)
-
-	// Handle symlink changes in the viewdef directory
-	if filepath.Dir(event.Name) == h.viewdefDir {
-		switch {
-		case event.Op&fsnotify.Create != 0:
-			h.updateSymlinkWatch(event.Name)
-		case event.Op&fsnotify.Remove != 0:
-			h.removeSymlinkWatch(event.Name)
-		case event.Op&fsnotify.Rename != 0:
-			// Rename is like remove + create elsewhere
-			h.removeSymlinkWatch(event.Name)
-		}
-	}
-
-	// Queue reload for write events
-	if event.Op&fsnotify.Write != 0 || event.Op&fsnotify.Create != 0 {
-		h.queueReload(event.Name)
-	}
-}
-
-// queueReload queues a file for reload with debouncing.
-func (h *HotLoader) queueReload(filePath string) {
-	h.debounceMu.Lock()
-	h.pendingReloads[filePath] = time.Now()
-	h.debounceMu.Unlock()
+// FileChanged reloads a changed viewdef file.
+// Implements watchcore.Listener.
+func (h *HotLoader) FileChanged(path string) {
+	h.reloadFile(path)
 }
 
-// debounceLoop processes pending reloads after the debounce delay.
-func (h *HotLoader) debounceLoop() {
-	ticker := time.NewTicker(50 * time.Millisecond)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-h.done:
-			return
-		case <-ticker.C:
-			h.processPendingReloads()
-		}
-	}
-}
-
-// processPendingReloads reloads files that have been pending for longer than debounceDelay.
-func (h *HotLoader) processPendingReloads() {
-	h.debounceMu.Lock()
-	now := time.Now()
-	var toReload []string
-	for path, queuedAt := range h.pendingReloads {
-		if now.Sub(queuedAt) >= h.debounceDelay {
-			toReload = append(toReload, path)
-			delete(h.pendingReloads, path)
-		}
+// FileRemoved resets metadata when a sidecar is deleted; the HTML is unaffected.
+// Implements watchcore.RemoveListener.
+func (h *HotLoader) FileRemoved(path string) {
+	if filepath.Dir(path) != h.viewdefDir {
+		return
 	}
-	h.debounceMu.Unlock()
-
-	for _, path := range toReload {
-		h.reloadFile(path)
+	if key, ok := metaKey(path); ok {
+		h.manager.removeMeta(key)
+		h.pushToReceivers(key)
 	}
 }
 
@@ -195,14 +97,23 @@ func (h *HotLoader) reloadFile(filePath string) {
 	// Check if file exists (might have been deleted)
 	info, err := os.Stat(reloadPath)
 	if err != nil {
-		h.config.Log(2, "ViewdefHotLoader: file not found %s", reloadPath)
+		h.log.Log(2, "ViewdefHotLoader: file not found %s", reloadPath)
 		return
 	}
 
 	// Read the file content
 	content, err := os.ReadFile(reloadPath)
 	if err != nil {
-		h.config.Log(1, "ViewdefHotLoader: error reading %s: %v", reloadPath, err)
+		h.log.Log(1, "ViewdefHotLoader: error reading %s: %v", reloadPath, err)
+		return
+	}
+
+	// Metadata sidecars update independently of the HTML
+	if key, ok := metaKey(reloadPath); ok {
+		h.log.Log(1, "ViewdefHotLoader: reloading metadata for %s", key)
+		if err := h.manager.updateMeta(key, content, reloadPath, info.ModTime()); err == nil {
+			h.pushToReceivers(key)
+		}
 		return
 	}
 
@@ -210,7 +121,7 @@ func (h *HotLoader) reloadFile(filePath string) {
 	filename := filepath.Base(reloadPath)
 	key := strings.TrimSuffix(filename, ".html")
 
-	h.config.Log(1, "ViewdefHotLoader: reloading %s", key)
+	h.log.Log(1, "ViewdefHotLoader: reloading %s", key)
 
 	// Update the viewdef in the manager
 	h.manager.updateViewdef(key, string(content), reloadPath, info.ModTime())
@@ -221,97 +132,19 @@ func (h *HotLoader) reloadFile(filePath string) {
 			// Push the updated viewdef to this session
 			viewdefs := map[string]string{key: string(content)}
 			h.sessions.PushViewdefs(sessionID, viewdefs)
-			h.config.Log(2, "ViewdefHotLoader: pushed %s to session %s", key, sessionID)
+			h.log.Log(2, "ViewdefHotLoader: pushed %s to session %s", key, sessionID)
 		}
 	}
 }
 
-// scanSymlinks scans the viewdef directory for symlinks and watches their target directories.
-func (h *HotLoader) scanSymlinks() error {
-	entries, err := os.ReadDir(h.viewdefDir)
-	if err != nil {
-		return err
-	}
-
-	for _, entry := range entries {
-		if !strings.HasSuffix(entry.Name(), ".html") {
-			continue
-		}
-		filePath := filepath.Join(h.viewdefDir, entry.Name())
-		h.updateSymlinkWatch(filePath)
-	}
-
-	return nil
-}
-
-// updateSymlinkWatch checks if a file is a symlink and updates watches accordingly.
-func (h *HotLoader) updateSymlinkWatch(filePath string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	// Check if file is a symlink
-	info, err := os.Lstat(filePath)
-	if err != nil {
-		return
-	}
-
-	// Remove old watch if this file was previously a symlink
-	if oldTarget, ok := h.symlinkTargets[filePath]; ok {
-		h.removeWatchLocked(oldTarget)
-		delete(h.symlinkTargets, filePath)
-	}
-
-	// If it's a symlink, resolve and watch the target directory
-	if info.Mode()&os.ModeSymlink != 0 {
-		target, err := filepath.EvalSymlinks(filePath)
-		if err != nil {
-			h.config.Log(2, "ViewdefHotLoader: cannot resolve symlink %s: %v", filePath, err)
-			return
-		}
-
-		targetDir := filepath.Dir(target)
-		h.symlinkTargets[filePath] = targetDir
-		h.addWatchLocked(targetDir)
-		h.config.Log(2, "ViewdefHotLoader: watching symlink target dir %s for %s", targetDir, filePath)
-	}
-}
-
-// removeSymlinkWatch removes the watch for a symlink's target directory.
-func (h *HotLoader) removeSymlinkWatch(filePath string) {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if targetDir, ok := h.symlinkTargets[filePath]; ok {
-		h.removeWatchLocked(targetDir)
-		delete(h.symlinkTargets, filePath)
-	}
-}
-
-// addWatch adds a directory to the watch list.
-func (h *HotLoader) addWatch(dir string) error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
-	return h.addWatchLocked(dir)
-}
-
-func (h *HotLoader) addWatchLocked(dir string) error {
-	h.watchedDirs[dir]++
-	if h.watchedDirs[dir] == 1 {
-		if err := h.watcher.Add(dir); err != nil {
-			h.watchedDirs[dir]--
-			return err
+// pushToReceivers triggers a refresh for sessions that have received a viewdef.
+// Changed metadata is picked up by AfterBatch, so no viewdef content is pushed.
+func (h *HotLoader) pushToReceivers(key string) {
+	for _, sessionID := range h.sessions.GetSessionIDs() {
+		if h.manager.hasSessionReceivedViewdef(sessionID, key) {
+			h.sessions.PushViewdefs(sessionID, nil)
+			h.log.Log(2, "ViewdefHotLoader: pushed %s metadata to session %s", key, sessionID)
 		}
-		h.config.Log(2, "ViewdefHotLoader: added watch for %s", dir)
-	}
-	return nil
-}
-
-func (h *HotLoader) removeWatchLocked(dir string) {
-	h.watchedDirs[dir]--
-	if h.watchedDirs[dir] <= 0 {
-		h.watcher.Remove(dir)
-		delete(h.watchedDirs, dir)
-		h.config.Log(2, "ViewdefHotLoader: removed watch for %s", dir)
 	}
 }
 
@@ -328,21 +161,5 @@ func (h *HotLoader) resolveReloadPath(changedPath string) string {
 
 	// Otherwise, this is a change in a symlink target directory
 	// Find which viewdef file symlinks to this location
-	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	changedDir := filepath.Dir(changedPath)
-	changedBase := filepath.Base(changedPath)
-
-	for viewdefPath, targetDir := range h.symlinkTargets {
-		if targetDir == changedDir {
-			// Check if the symlink points to this specific file
-			target, err := filepath.EvalSymlinks(viewdefPath)
-			if err == nil && filepath.Base(target) == changedBase {
-				return viewdefPath
-			}
-		}
-	}
-
-	return ""
+	return h.core.SymlinkFor(changedPath)
 }
@@ -87,8 +87,8 @@ func TestNewViewdefHotLoader(t *testing.T) {
 	if h.viewdefDir != viewdefDir {
 		t.Errorf("viewdefDir = %q, want %q", h.viewdefDir, viewdefDir)
 	}
-	if h.watcher == nil {
-		t.Error("watcher is nil")
+	if h.core == nil {
+		t.Error("watcher core is nil")
 	}
 	if h.manager == nil {
 		t.Error("manager is nil")
@@ -118,8 +118,8 @@ func TestViewdefHotLoaderStart(t *testing.T) {
 	defer h.Stop()
 
 	// Verify viewdef directory is being watched
-	if h.watchedDirs[viewdefDir] != 1 {
-		t.Errorf("viewdefDir not in watchedDirs, got %v", h.watchedDirs)
+	if n := h.core.WatchCount(viewdefDir); n != 1 {
+		t.Errorf("viewdefDir watch count = %d, want 1", n)
 	}
 }
 
@@ -219,10 +219,8 @@ func TestViewdefScanExistingSymlinks(t *testing.T) {
 	defer h.Stop()
 
 	// Check symlink was detected
-	h.mu.Lock()
-	targetTracked := h.symlinkTargets[symlinkPath]
-	watchCount := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	targetTracked := h.core.SymlinkTarget(symlinkPath)
+	watchCount := h.core.WatchCount(targetDir)
 
 	if targetTracked != targetDir {
 		t.Errorf("symlinkTargets[%s] = %q, want %q", symlinkPath, targetTracked, targetDir)
@@ -259,9 +257,7 @@ func TestViewdefReferenceCountingForSharedTargets(t *testing.T) {
 	defer h.Stop()
 
 	// Both should point to same target dir
-	h.mu.Lock()
-	watchCount := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	watchCount := h.core.WatchCount(targetDir)
 
 	if watchCount != 2 {
 		t.Errorf("Watch count for shared target = %d, want 2", watchCount)
@@ -271,9 +267,7 @@ func TestViewdefReferenceCountingForSharedTargets(t *testing.T) {
 	os.Remove(symlinkA)
 	time.Sleep(100 * time.Millisecond)
 
-	h.mu.Lock()
-	watchCountAfter := h.watchedDirs[targetDir]
-	h.mu.Unlock()
+	watchCountAfter := h.core.WatchCount(targetDir)
 
 	if watchCountAfter != 1 {
 		t.Errorf("Watch count after remove = %d, want 1", watchCountAfter)
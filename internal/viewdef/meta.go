@@ -0,0 +1,191 @@
+// Viewdef metadata sidecars (TYPE.NAMESPACE.meta.json).
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md
+package viewdef
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// MetaSuffix is the file suffix for viewdef metadata sidecars.
+const MetaSuffix = ".meta.json"
+
+// Meta holds layout hints for a viewdef.
+// Unknown fields are rejected so typos surface instead of silently doing nothing.
+type Meta struct {
+	Width string `json:"width,omitempty"` // Preferred width as a CSS length (e.g. "32rem")
+	Mode  string `json:"mode,omitempty"`  // "modal" or "inline"
+	Icon  string `json:"icon,omitempty"`  // Icon name or URL
+}
+
+// ParseMeta decodes and validates viewdef metadata.
+func ParseMeta(data []byte) (*Meta, error) {
+	var meta Meta
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&meta); err != nil {
+		return nil, err
+	}
+	switch meta.Mode {
+	case "", "modal", "inline":
+	default:
+		return nil, fmt.Errorf("invalid mode %q (expected modal or inline)", meta.Mode)
+	}
+	return &meta, nil
+}
+
+// metaKey returns the viewdef key for a metadata file name.
+func metaKey(filename string) (string, bool) {
+	key, ok := strings.CutSuffix(filepath.Base(filename), MetaSuffix)
+	return key, ok && key != ""
+}
+
+// isViewdefFile reports whether a file is a viewdef or a viewdef metadata sidecar.
+func isViewdefFile(name string) bool {
+	return strings.HasSuffix(name, ".html") || strings.HasSuffix(name, MetaSuffix)
+}
+
+// metaEntry tracks a viewdef's metadata and source file info.
+type metaEntry struct {
+	content  string    // Normalized JSON ("{}" when removed)
+	filePath string    // Source file path (empty if from bundle or dynamic)
+	modTime  time.Time // Last modification time when loaded
+}
+
+// encodeMeta validates metadata and returns its normalized JSON.
+func encodeMeta(data []byte) (string, error) {
+	meta, err := ParseMeta(data)
+	if err != nil {
+		return "", err
+	}
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// storeMeta validates and stores metadata for a key.
+// Invalid metadata is logged and skipped; the viewdef HTML is unaffected.
+// Must be called with write lock held.
+func (m *ViewdefManager) storeMeta(key string, data []byte, filePath string, modTime time.Time) error {
+	content, err := encodeMeta(data)
+	if err != nil {
+		err = fmt.Errorf("invalid viewdef metadata for %s: %w", key, err)
+		if m.config != nil {
+			m.config.Logger(config.LogViewdef).Log(0, "Warning: %v", err)
+		}
+		return err
+	}
+	m.meta[key] = &metaEntry{content: content, filePath: filePath, modTime: modTime}
+	return nil
+}
+
+// loadMetaFile loads a metadata sidecar from disk.
+// Must be called with write lock held.
+func (m *ViewdefManager) loadMetaFile(path string, modTime time.Time) {
+	key, ok := metaKey(path)
+	if !ok {
+		return
+	}
+	if existing, exists := m.meta[key]; exists && existing.filePath != "" && !modTime.After(existing.modTime) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	m.storeMeta(key, data, path, modTime)
+}
+
+// AddViewdefMeta adds or updates a viewdef's metadata dynamically, independently of its HTML.
+// If viewdefDir is set, writes the sidecar file. Returns an error for invalid metadata.
+func (m *ViewdefManager) AddViewdefMeta(key, content string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := encodeMeta([]byte(content)); err != nil {
+		return fmt.Errorf("invalid viewdef metadata for %s: %w", key, err)
+	}
+
+	filePath := ""
+	modTime := time.Now()
+	if m.viewdefDir != "" {
+		path := filepath.Join(m.viewdefDir, key+MetaSuffix)
+		if err := os.WriteFile(path, []byte(content), 0644); err == nil {
+			if info, err := os.Stat(path); err == nil {
+				filePath = path
+				modTime = info.ModTime()
+			}
+		}
+	}
+	return m.storeMeta(key, []byte(content), filePath, modTime)
+}
+
+// GetViewdefMeta returns a viewdef's metadata JSON, or "{}" when it has none.
+func (m *ViewdefManager) GetViewdefMeta(key string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if entry, ok := m.meta[key]; ok {
+		return entry.content
+	}
+	return "{}"
+}
+
+// updateMeta updates a metadata entry from a file (used by HotLoader).
+func (m *ViewdefManager) updateMeta(key string, data []byte, filePath string, modTime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.storeMeta(key, data, filePath, modTime)
+}
+
+// removeMeta resets a viewdef's metadata to empty (used by HotLoader when a sidecar is deleted).
+// The entry is kept so sessions that received the old metadata get the empty object.
+func (m *ViewdefManager) removeMeta(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.meta[key]; ok {
+		m.meta[key] = &metaEntry{content: "{}", modTime: time.Now()}
+	}
+}
+
+// GetChangedMetaForSession returns metadata that needs to be sent to a session.
+// Only metadata for viewdefs the session has received is included, so call this
+// after GetChangedViewdefsForSession. Marks returned metadata as sent.
+func (m *ViewdefManager) GetChangedMetaForSession(sessionID string) map[string]json.RawMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	received := m.sentViewdefs[sessionID]
+	if len(received) == 0 || len(m.meta) == 0 {
+		return nil
+	}
+	if m.sentMeta[sessionID] == nil {
+		m.sentMeta[sessionID] = make(map[string]time.Time)
+	}
+	sentTimes := m.sentMeta[sessionID]
+
+	var result map[string]json.RawMessage
+	for key, entry := range m.meta {
+		if _, ok := received[key]; !ok {
+			continue
+		}
+		sentTime, wasSent := sentTimes[key]
+		if !wasSent || entry.modTime.After(sentTime) {
+			if result == nil {
+				result = make(map[string]json.RawMessage)
+			}
+			result[key] = json.RawMessage(entry.content)
+			sentTimes[key] = entry.modTime
+		}
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+// Test Design: test-HotLoader.md (Viewdef Metadata section)
+package viewdef
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseMeta(t *testing.T) {
+	if _, err := ParseMeta([]byte(`{"width":"32rem","mode":"modal","icon":"user"}`)); err != nil {
+		t.Errorf("valid metadata rejected: %v", err)
+	}
+	if _, err := ParseMeta([]byte(`{"mode":"popup"}`)); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+	if _, err := ParseMeta([]byte(`{"widht":"32rem"}`)); err == nil {
+		t.Error("expected error for unknown field")
+	}
+}
+
+func TestLoadMetaSidecars(t *testing.T) {
+	dir := createTempViewdefDir(t)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"Contact.DEFAULT.html":      "<template><div></div></template>",
+		"Contact.DEFAULT.meta.json": `{"mode":"modal"}`,
+		"Task.DEFAULT.html":         "<template><div></div></template>",
+		"Task.DEFAULT.meta.json":    `{"mode":"sideways"}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := NewViewdefManager()
+	m.SetConfig(testViewdefConfig())
+	if err := m.LoadFromDirectory(dir); err != nil {
+		t.Fatalf("LoadFromDirectory failed: %v", err)
+	}
+
+	// Invalid metadata must not block the HTML
+	if m.Count() != 2 {
+		t.Errorf("Count = %d, want 2", m.Count())
+	}
+	if got := m.GetViewdefMeta("Contact.DEFAULT"); got != `{"mode":"modal"}` {
+		t.Errorf("Contact meta = %s", got)
+	}
+	if got := m.GetViewdefMeta("Task.DEFAULT"); got != "{}" {
+		t.Errorf("invalid Task meta = %s, want {}", got)
+	}
+
+	// Metadata follows the viewdefs a session has received
+	if metas := m.GetChangedMetaForSession("1"); len(metas) != 0 {
+		t.Errorf("meta sent before viewdefs: %v", metas)
+	}
+	m.GetChangedViewdefsForSession("1")
+	metas := m.GetChangedMetaForSession("1")
+	if string(metas["Contact.DEFAULT"]) != `{"mode":"modal"}` || len(metas) != 1 {
+		t.Errorf("GetChangedMetaForSession = %v", metas)
+	}
+	if metas := m.GetChangedMetaForSession("1"); len(metas) != 0 {
+		t.Errorf("meta resent without change: %v", metas)
+	}
+
+	// Metadata updates independently of the HTML
+	if err := m.AddViewdefMeta("Contact.DEFAULT", `{"mode":"inline"}`); err != nil {
+		t.Fatalf("AddViewdefMeta failed: %v", err)
+	}
+	if defs := m.GetChangedViewdefsForSession("1"); len(defs) != 0 {
+		t.Errorf("HTML resent for metadata change: %v", defs)
+	}
+	if metas := m.GetChangedMetaForSession("1"); string(metas["Contact.DEFAULT"]) != `{"mode":"inline"}` {
+		t.Errorf("updated meta = %v", metas)
+	}
+}
@@ -0,0 +1,52 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md
+package viewdef
+
+import (
+	"regexp"
+)
+
+var (
+	scriptTagPattern  = regexp.MustCompile(`(?i)<script\b([^>]*)>`)
+	nonceAttrPattern  = regexp.MustCompile(`(?i)\s+nonce\s*=\s*("[^"]*"|'[^']*'|[^\s>]*)`)
+	nonceValuePattern = regexp.MustCompile(`^[A-Za-z0-9+/=_-]+$`)
+)
+
+// AddScriptNonce sets the nonce attribute of every script tag in html, replacing
+// any nonce the source already carries so only the caller's nonce is ever sent.
+func AddScriptNonce(html, nonce string) string {
+	if nonce == "" || !nonceValuePattern.MatchString(nonce) {
+		return html
+	}
+	return scriptTagPattern.ReplaceAllStringFunc(html, func(tag string) string {
+		attrs := scriptTagPattern.FindStringSubmatch(tag)[1]
+		attrs = nonceAttrPattern.ReplaceAllString(attrs, "")
+		return `<script nonce="` + nonce + `"` + attrs + ">"
+	})
+}
+
+// SetSessionNonce sets the script nonce used for a session's viewdefs ("" removes it).
+// Unlike sent tracking, the nonce survives ClearSession: a reloaded page keeps it.
+func (m *ViewdefManager) SetSessionNonce(sessionID, nonce string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if nonce == "" {
+		delete(m.nonces, sessionID)
+		return
+	}
+	m.nonces[sessionID] = nonce
+}
+
+// SessionNonce returns a session's script nonce, or "" when CSP is off.
+func (m *ViewdefManager) SessionNonce(sessionID string) string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.nonces[sessionID]
+}
+
+// sessionContent returns a viewdef as sent to one session. Rewriting happens on
+// every send from the shared source, so no session's nonce is ever cached.
+// Caller must hold m.mu.
+func (m *ViewdefManager) sessionContent(sessionID string, entry *viewdefEntry) string {
+	return AddScriptNonce(entry.content, m.nonces[sessionID])
+}
@@ -0,0 +1,53 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md
+package viewdef
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAddScriptNonce(t *testing.T) {
+	html := `<template><script>a()</script><SCRIPT type="module" nonce='old'>b()</SCRIPT><scripts></scripts></template>`
+	got := AddScriptNonce(html, "abc")
+	want := `<template><script nonce="abc">a()</script><script nonce="abc" type="module">b()</SCRIPT><scripts></scripts></template>`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	if AddScriptNonce(html, `x" onload="y`) != html {
+		t.Error("malformed nonce was inserted")
+	}
+}
+
+// TestSessionNonceIsolation verifies each session gets only its own nonce,
+// including for a viewdef resent after hot reload
+func TestSessionNonceIsolation(t *testing.T) {
+	m := NewViewdefManager()
+	m.AddViewdef("App.DEFAULT", `<template><script>go()</script></template>`)
+	m.SetSessionNonce("1", "one")
+	m.SetSessionNonce("2", "two")
+
+	check := func(sessionID, nonce string) {
+		t.Helper()
+		def := m.GetChangedViewdefsForSession(sessionID)["App.DEFAULT"]
+		if !strings.Contains(def, `nonce="`+nonce+`"`) || strings.Count(def, "nonce=") != 1 {
+			t.Errorf("session %s got %q, want nonce %q", sessionID, def, nonce)
+		}
+	}
+	check("1", "one")
+	check("2", "two")
+
+	m.updateViewdef("App.DEFAULT", `<template><script nonce="two">again()</script></template>`, "", time.Now().Add(time.Second))
+	check("1", "one")
+	check("2", "two")
+
+	// The nonce outlives sent tracking, and goes with the session
+	m.ClearSession("1")
+	check("1", "one")
+	m.SetSessionNonce("1", "")
+	m.ClearSession("1")
+	if def := m.GetChangedViewdefsForSession("1")["App.DEFAULT"]; strings.Contains(def, `nonce="one"`) {
+		t.Errorf("removed session nonce still applied: %q", def)
+	}
+}
@@ -0,0 +1,97 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md (Usage Statistics)
+package viewdef
+
+import (
+	"maps"
+	"time"
+)
+
+// TypeUsage counts how much one type's viewdefs are used.
+type TypeUsage struct {
+	Sent     int64     `json:"sent"`              // Viewdefs of the type sent to sessions
+	Created  int64     `json:"created"`           // Variables of the type created
+	LastUsed time.Time `json:"lastUsed,omitzero"` // Last send or create
+}
+
+// Usage is a point-in-time copy of the viewdef usage counters.
+// Types lists every type with a loaded viewdef, unused ones with zero counts.
+type Usage struct {
+	Since time.Time            `json:"since"` // When counting started (last reset)
+	Types map[string]TypeUsage `json:"types"`
+}
+
+// Unused returns the types not used within horizon of now. Nothing is unused
+// until the counters are at least horizon old.
+func (u Usage) Unused(now time.Time, horizon time.Duration) []string {
+	cutoff := now.Add(-horizon)
+	if u.Since.After(cutoff) {
+		return nil
+	}
+	var unused []string
+	for typ, usage := range u.Types {
+		if usage.LastUsed.Before(cutoff) {
+			unused = append(unused, typ)
+		}
+	}
+	return unused
+}
+
+// countSent records a viewdef sent to a session. Caller must hold m.mu.
+func (m *ViewdefManager) countSent(key string) {
+	typeName, _, err := ParseKey(key)
+	if err != nil {
+		return
+	}
+	m.countUsage(typeName, func(u *TypeUsage) { u.Sent++ })
+}
+
+// CountCreated records a variable of typeName being created.
+func (m *ViewdefManager) CountCreated(typeName string) {
+	if typeName == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.countUsage(typeName, func(u *TypeUsage) { u.Created++ })
+}
+
+// countUsage applies count to typeName's counters. Caller must hold m.mu.
+func (m *ViewdefManager) countUsage(typeName string, count func(*TypeUsage)) {
+	if m.usage == nil {
+		m.usage = make(map[string]TypeUsage)
+	}
+	u := m.usage[typeName]
+	count(&u)
+	u.LastUsed = time.Now()
+	m.usage[typeName] = u
+}
+
+// Usage returns the usage counters of every type that has a viewdef or was counted.
+func (m *ViewdefManager) Usage() Usage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	types := maps.Clone(m.usage)
+	if types == nil {
+		types = make(map[string]TypeUsage)
+	}
+	for key := range m.viewdefs {
+		if typeName, _, err := ParseKey(key); err == nil {
+			types[typeName] = m.usage[typeName]
+		}
+	}
+	return Usage{Since: m.usageSince, Types: types}
+}
+
+// SetUsage replaces the counters, e.g. with ones saved by an earlier run.
+func (m *ViewdefManager) SetUsage(usage Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = maps.Clone(usage.Types)
+	m.usageSince = usage.Since
+}
+
+// ResetUsage clears the counters and starts counting from now.
+func (m *ViewdefManager) ResetUsage() {
+	m.SetUsage(Usage{Since: time.Now()})
+}
@@ -0,0 +1,48 @@
+// CRC: crc-ViewdefStore.md
+// Spec: viewdefs.md (Usage Statistics)
+package viewdef
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestViewdefUsage verifies sends and creations are counted per type, that
+// types never used are listed with zero counts, and that reset starts over
+func TestViewdefUsage(t *testing.T) {
+	m := NewViewdefManager()
+	m.AddViewdef("Contact.DEFAULT", `<template><div></div></template>`)
+	m.AddViewdef("Contact.list-item", `<template><span></span></template>`)
+	m.AddViewdef("Dead.DEFAULT", `<template><div></div></template>`)
+
+	m.GetChangedViewdefsForSession("1")
+	m.GetChangedViewdefsForSession("1") // Nothing new to send
+	m.CountCreated("Contact")
+	m.CountCreated("Contact")
+	m.CountCreated("")
+
+	usage := m.Usage()
+	if got := usage.Types["Contact"]; got.Sent != 2 || got.Created != 2 || got.LastUsed.IsZero() {
+		t.Errorf("Contact usage = %+v, want 2 sent, 2 created", got)
+	}
+	if got, ok := usage.Types["Dead"]; !ok || got.Sent != 1 || got.Created != 0 {
+		t.Errorf("Dead usage = %+v, %v, want 1 sent, 0 created", got, ok)
+	}
+
+	// Nothing is unused until the counters cover the horizon
+	if unused := usage.Unused(time.Now(), time.Hour); unused != nil {
+		t.Errorf("unused = %v before the horizon passed", unused)
+	}
+	later := time.Now().Add(2 * time.Hour)
+	usage.Types["Contact"] = TypeUsage{Created: 2, LastUsed: later.Add(-time.Minute)}
+	if unused := usage.Unused(later, time.Hour); !slices.Equal(unused, []string{"Dead"}) {
+		t.Errorf("unused = %v, want [Dead]", unused)
+	}
+
+	m.ResetUsage()
+	usage = m.Usage()
+	if got := usage.Types["Contact"]; got != (TypeUsage{}) || time.Since(usage.Since) > time.Minute {
+		t.Errorf("after reset usage = %+v since %v", got, usage.Since)
+	}
+}
@@ -3,6 +3,7 @@
 package viewdef
 
 import (
+	"errors"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/zot/ui-engine/internal/bundle"
+	"github.com/zot/ui-engine/internal/config"
 )
 
 // viewdefEntry tracks a viewdef's content and source file info.
@@ -27,8 +29,21 @@ type ViewdefManager struct {
 	// sentViewdefs tracks which viewdefs have been sent per session with their modTime
 	// sessionID -> viewdef key -> modTime when sent
 	sentViewdefs map[string]map[string]time.Time
+	// meta maps TYPE.NAMESPACE to viewdef metadata (from TYPE.NAMESPACE.meta.json)
+	meta map[string]*metaEntry
+	// sentMeta tracks which metadata has been sent per session, like sentViewdefs
+	sentMeta map[string]map[string]time.Time
+	// config is used for logging invalid metadata (optional)
+	config *config.Config
+	// nonces maps sessionID to its CSP script nonce (empty when CSP is off)
+	nonces map[string]string
+	// a11y maps TYPE.NAMESPACE to its accessibility findings (with --a11y-audit)
+	a11y map[string][]A11yFinding
 	// viewdefDir is the directory to check for viewdefs on-demand
 	viewdefDir string
+	// usage counts viewdef sends and variable creations per type since usageSince
+	usage      map[string]TypeUsage
+	usageSince time.Time
 	mu         sync.RWMutex
 }
 
@@ -37,9 +52,21 @@ func NewViewdefManager() *ViewdefManager {
 	return &ViewdefManager{
 		viewdefs:     make(map[string]*viewdefEntry),
 		sentViewdefs: make(map[string]map[string]time.Time),
+		meta:         make(map[string]*metaEntry),
+		sentMeta:     make(map[string]map[string]time.Time),
+		nonces:       make(map[string]string),
+		a11y:         make(map[string][]A11yFinding),
+		usageSince:   time.Now(),
 	}
 }
 
+// SetConfig sets the config used for logging.
+func (m *ViewdefManager) SetConfig(cfg *config.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.config = cfg
+}
+
 // SetViewdefDir sets the directory for on-demand viewdef loading.
 func (m *ViewdefManager) SetViewdefDir(dir string) {
 	m.mu.Lock()
@@ -63,6 +90,10 @@ func (m *ViewdefManager) LoadFromDirectory(dir string) error {
 		if info.IsDir() {
 			return nil
 		}
+		if strings.HasSuffix(path, MetaSuffix) {
+			m.loadMetaFile(path, info.ModTime())
+			return nil
+		}
 		if !strings.HasSuffix(path, ".html") {
 			return nil
 		}
@@ -82,13 +113,15 @@ func (m *ViewdefManager) LoadFromDirectory(dir string) error {
 			filePath: path,
 			modTime:  info.ModTime(),
 		}
+		m.auditA11y(key, string(content))
 		return nil
 	})
 }
 
 // AddViewdef adds or updates a viewdef dynamically.
 // If viewdefDir is set, writes to file and tracks the file path.
-func (m *ViewdefManager) AddViewdef(key, content string) {
+// Returns the accessibility findings when --a11y-audit is on, so uploaders can fix them.
+func (m *ViewdefManager) AddViewdef(key, content string) []A11yFinding {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -106,36 +139,31 @@ func (m *ViewdefManager) AddViewdef(key, content string) {
 	}
 
 	m.viewdefs[key] = entry
+	return m.auditA11y(key, content)
 }
 
-// LoadFromBundle loads viewdefs from the embedded bundle.
+// LoadFromBundle loads viewdefs from the embedded bundle's viewdefs/ directory.
 func (m *ViewdefManager) LoadFromBundle() error {
+	fsys, err := bundle.FS("viewdefs")
+	if err != nil {
+		return err
+	}
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	files, err := bundle.ListFilesInDir("viewdefs")
+	entries, err := fs.ReadDir(fsys, ".")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
 	if err != nil {
 		return err
 	}
-
-	for _, bundlePath := range files {
-		if !strings.HasSuffix(bundlePath, ".html") {
-			continue
-		}
-
-		content, err := bundle.ReadFile(bundlePath)
-		if err != nil {
-			continue
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			// Bundle viewdefs have no file path (embedded)
+			m.loadFSFile(fsys, entry.Name())
 		}
-
-		// Get filename from path (e.g., "viewdefs/Adder.DEFAULT.html" -> "Adder.DEFAULT")
-		filename := filepath.Base(bundlePath)
-		key := strings.TrimSuffix(filename, ".html")
-
-		// Bundle viewdefs have no file path (embedded)
-		m.viewdefs[key] = &viewdefEntry{content: string(content)}
 	}
-
 	return nil
 }
 
@@ -151,22 +179,34 @@ func (m *ViewdefManager) LoadFromFS(fsys fs.FS, dir string) error {
 		if d.IsDir() {
 			return nil
 		}
-		if !strings.HasSuffix(path, ".html") {
-			return nil
-		}
+		// FS viewdefs have no trackable file path
+		return m.loadFSFile(fsys, path)
+	})
+}
 
-		content, err := fs.ReadFile(fsys, path)
-		if err != nil {
-			return err
+// loadFSFile loads a viewdef or metadata sidecar from fsys, ignoring other
+// files. Must be called with write lock held.
+func (m *ViewdefManager) loadFSFile(fsys fs.FS, path string) error {
+	if key, ok := metaKey(path); ok {
+		if data, err := fs.ReadFile(fsys, path); err == nil {
+			m.storeMeta(key, data, "", time.Time{})
 		}
+		return nil
+	}
+	if !strings.HasSuffix(path, ".html") {
+		return nil
+	}
 
-		filename := filepath.Base(path)
-		key := strings.TrimSuffix(filename, ".html")
+	content, err := fs.ReadFile(fsys, path)
+	if err != nil {
+		return err
+	}
 
-		// FS viewdefs have no trackable file path
-		m.viewdefs[key] = &viewdefEntry{content: string(content)}
-		return nil
-	})
+	filename := filepath.Base(path)
+	key := strings.TrimSuffix(filename, ".html")
+	m.viewdefs[key] = &viewdefEntry{content: string(content)}
+	m.auditA11y(key, string(content))
+	return nil
 }
 
 // GetViewdefsForType returns all viewdefs for a given type.
@@ -206,6 +246,7 @@ func (m *ViewdefManager) reloadIfStale(key string, entry *viewdefEntry) {
 		}
 		entry.content = string(content)
 		entry.modTime = info.ModTime()
+		m.auditA11y(key, entry.content)
 	}
 }
 
@@ -257,6 +298,15 @@ func (m *ViewdefManager) tryLoadFromFilesystem(typeName string) {
 			filePath: path,
 			modTime:  info.ModTime(),
 		}
+		m.auditA11y(key, string(content))
+	}
+
+	// Load TYPE.*.meta.json sidecars
+	metaMatches, _ := filepath.Glob(filepath.Join(m.viewdefDir, typeName+".*"+MetaSuffix))
+	for _, path := range metaMatches {
+		if info, err := os.Stat(path); err == nil {
+			m.loadMetaFile(path, info.ModTime())
+		}
 	}
 }
 
@@ -265,6 +315,7 @@ func (m *ViewdefManager) tryLoadFromFilesystem(typeName string) {
 // - Viewdefs for new types that haven't been sent yet
 // - Viewdefs that have been modified since they were last sent
 // Marks returned viewdefs as sent with their current mod time.
+// Script tags carry the session's CSP nonce, if it has one.
 func (m *ViewdefManager) GetChangedViewdefsForSession(sessionID string) map[string]string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -283,8 +334,9 @@ func (m *ViewdefManager) GetChangedViewdefsForSession(sessionID string) map[stri
 
 		sentTime, wasSent := sentTimes[key]
 		if !wasSent || entry.modTime.After(sentTime) {
-			defs[key] = entry.content
+			defs[key] = m.sessionContent(sessionID, entry)
 			sentTimes[key] = entry.modTime
+			m.countSent(key)
 		}
 	}
 
@@ -316,8 +368,9 @@ func (m *ViewdefManager) AddNewViewdefsForType(sessionID, typeName string, defs
 
 			sentTime, wasSent := sentTimes[key]
 			if !wasSent || entry.modTime.After(sentTime) {
-				defs[key] = entry.content
+				defs[key] = m.sessionContent(sessionID, entry)
 				sentTimes[key] = entry.modTime
+				m.countSent(key)
 			}
 		}
 	}
@@ -328,6 +381,7 @@ func (m *ViewdefManager) ClearSession(sessionID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	delete(m.sentViewdefs, sessionID)
+	delete(m.sentMeta, sessionID)
 }
 
 // GetAllViewdefs returns all loaded viewdefs.
@@ -360,6 +414,7 @@ func (m *ViewdefManager) updateViewdef(key, content, filePath string, modTime ti
 		filePath: filePath,
 		modTime:  modTime,
 	}
+	m.auditA11y(key, content)
 }
 
 // hasSessionReceivedViewdef checks if a session has received a specific viewdef.
@@ -402,5 +457,6 @@ func (m *ViewdefManager) MarkViewdefSent(sessionID, key string) {
 	entry, ok := m.viewdefs[key]
 	if ok {
 		m.sentViewdefs[sessionID][key] = entry.modTime
+		m.countSent(key)
 	}
 }
@@ -0,0 +1,436 @@
+// Package watchcore provides the file watching machinery shared by the hot loaders:
+// reference-counted directory watches, symlink target tracking, and debounced change delivery.
+// CRC: crc-WatchCore.md
+// Spec: main.md (Hot-Loading System)
+package watchcore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// DefaultDebounceDelay is how long a file must be quiet before its change is delivered.
+const DefaultDebounceDelay = 100 * time.Millisecond
+
+// Listener receives debounced changes for the files it is interested in.
+// CRC: crc-WatchCore.md
+type Listener interface {
+	// WatchesFile reports whether changes to the named file are of interest.
+	WatchesFile(name string) bool
+	// FileChanged is called once a created or written file has been quiet for the debounce delay.
+	FileChanged(path string)
+}
+
+// RemoveListener is implemented by listeners that also want to know about deleted files.
+type RemoveListener interface {
+	// FileRemoved is called once a removed or renamed-away file has been gone for the debounce delay.
+	FileRemoved(path string)
+}
+
+// RootListener is implemented by listeners that want to know when the primary
+// directory itself is removed or renamed away (e.g. a dropped network mount).
+type RootListener interface {
+	// RootRemoved is called when the primary directory disappears.
+	RootRemoved()
+}
+
+// Core watches a primary directory (plus any extra directories) for changes.
+// Symlinks in the primary directory have their target directories watched too,
+// so edits to the link targets are delivered as changes.
+// CRC: crc-WatchCore.md
+type Core struct {
+	log      config.Logger
+	name     string // log prefix, e.g. "HotLoader"
+	dir      string // primary directory; symlinks here are tracked
+	listener Listener
+	watcher  *fsnotify.Watcher
+
+	// Symlink tracking (see cross-cutting: Hot-Loading Symlink Tracking)
+	symlinkTargets map[string]string // symlink path -> resolved target dir
+	watchedDirs    map[string]int    // dir path -> reference count
+	mu             sync.Mutex
+
+	// Debouncing
+	pending       map[string]time.Time
+	pendingMu     sync.Mutex
+	debounceDelay time.Duration
+
+	paused atomic.Bool // Primary directory is gone; see Pause
+	done   chan struct{}
+}
+
+// New creates a watcher core for dir. Call Start to begin watching.
+func New(log config.Logger, name, dir string, listener Listener) (*Core, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &Core{
+		log:            log,
+		name:           name,
+		dir:            dir,
+		listener:       listener,
+		watcher:        watcher,
+		symlinkTargets: make(map[string]string),
+		watchedDirs:    make(map[string]int),
+		pending:        make(map[string]time.Time),
+		debounceDelay:  DefaultDebounceDelay,
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Start watches the primary directory, its symlink targets, and begins delivering changes.
+func (c *Core) Start() error {
+	if err := c.Watch(c.dir); err != nil {
+		return err
+	}
+
+	// Scan for existing symlinks and watch their target directories
+	if err := c.scanSymlinks(); err != nil {
+		c.log.Log(1, "%s: error scanning symlinks: %v", c.name, err)
+	}
+
+	go c.eventLoop()
+	go c.debounceLoop()
+	return nil
+}
+
+// Stop stops watching. Pending changes are dropped.
+func (c *Core) Stop() error {
+	close(c.done)
+	return c.watcher.Close()
+}
+
+// Pause stops delivering changes while the primary directory is unavailable.
+// Pending changes are dropped and watcher errors are only logged at level 3.
+func (c *Core) Pause() {
+	if c.paused.Swap(true) {
+		return
+	}
+	c.dropDeletedDir(c.dir)
+	c.pendingMu.Lock()
+	clear(c.pending)
+	c.pendingMu.Unlock()
+}
+
+// Resume watches the primary directory again after Pause, rescanning its symlinks.
+func (c *Core) Resume() error {
+	if !c.paused.Load() {
+		return nil
+	}
+	c.mu.Lock()
+	_, watched := c.watchedDirs[c.dir]
+	c.mu.Unlock()
+	if !watched {
+		if err := c.Watch(c.dir); err != nil {
+			return err
+		}
+	}
+	c.paused.Store(false)
+	if err := c.scanSymlinks(); err != nil {
+		c.log.Log(1, "%s: error scanning symlinks: %v", c.name, err)
+	}
+	return nil
+}
+
+// Paused reports whether change delivery is paused.
+func (c *Core) Paused() bool {
+	return c.paused.Load()
+}
+
+// Watch adds a reference to a directory watch.
+func (c *Core) Watch(dir string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addWatchLocked(dir)
+}
+
+// WatchRecursive watches a directory and all its subdirectories.
+// Unreadable subdirectories are skipped.
+func (c *Core) WatchRecursive(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil // Skip directories we can't read
+		}
+		if info.IsDir() {
+			if err := c.Watch(path); err != nil {
+				c.log.Log(2, "%s: could not watch %s: %v", c.name, path, err)
+			}
+		}
+		return nil
+	})
+}
+
+// WatchCount returns the number of references to a directory watch.
+func (c *Core) WatchCount(dir string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.watchedDirs[dir]
+}
+
+// SymlinkTarget returns the target directory tracked for a symlink, or "".
+func (c *Core) SymlinkTarget(path string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.symlinkTargets[path]
+}
+
+// SymlinkFor returns the tracked symlink that points at targetPath, or "".
+func (c *Core) SymlinkFor(targetPath string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	targetDir := filepath.Dir(targetPath)
+	targetBase := filepath.Base(targetPath)
+	for linkPath, dir := range c.symlinkTargets {
+		if dir == targetDir {
+			// Check if the symlink points to this specific file
+			target, err := filepath.EvalSymlinks(linkPath)
+			if err == nil && filepath.Base(target) == targetBase {
+				return linkPath
+			}
+		}
+	}
+	return ""
+}
+
+// Forget drops symlink tracking and any pending change for a file.
+func (c *Core) Forget(path string) {
+	c.mu.Lock()
+	c.untrackSymlinkLocked(path)
+	c.mu.Unlock()
+
+	c.pendingMu.Lock()
+	delete(c.pending, path)
+	c.pendingMu.Unlock()
+}
+
+// ForgetDir drops tracking for every file under dir and releases one reference to dir's watch.
+func (c *Core) ForgetDir(dir string) {
+	c.mu.Lock()
+	for path := range c.symlinkTargets {
+		if isUnder(path, dir) {
+			c.untrackSymlinkLocked(path)
+		}
+	}
+	if c.watchedDirs[dir] > 0 {
+		c.removeWatchLocked(dir)
+	}
+	c.mu.Unlock()
+
+	c.pendingMu.Lock()
+	for path := range c.pending {
+		if isUnder(path, dir) {
+			delete(c.pending, path)
+		}
+	}
+	c.pendingMu.Unlock()
+}
+
+func isUnder(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// scanSymlinks tracks existing symlinks in the primary directory.
+func (c *Core) scanSymlinks() error {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if c.listener.WatchesFile(entry.Name()) {
+			c.updateSymlinkWatch(filepath.Join(c.dir, entry.Name()))
+		}
+	}
+	return nil
+}
+
+// updateSymlinkWatch (re)tracks a file in the primary directory.
+// A retargeted symlink moves its reference from the old target directory to the new one.
+func (c *Core) updateSymlinkWatch(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	oldTarget, hadTarget := c.symlinkTargets[path]
+	delete(c.symlinkTargets, path)
+
+	info, err := os.Lstat(path)
+	if err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if target, err := filepath.EvalSymlinks(path); err != nil {
+			c.log.Log(2, "%s: cannot resolve symlink %s: %v", c.name, path, err)
+		} else {
+			// Add the new reference before releasing the old one so a
+			// symlink retargeted within the same directory keeps its watch
+			targetDir := filepath.Dir(target)
+			if err := c.addWatchLocked(targetDir); err != nil {
+				c.log.Log(2, "%s: cannot watch symlink target dir %s: %v", c.name, targetDir, err)
+			} else {
+				c.symlinkTargets[path] = targetDir
+				c.log.Log(2, "%s: watching symlink target dir %s for %s", c.name, targetDir, path)
+			}
+		}
+	}
+
+	if hadTarget {
+		c.removeWatchLocked(oldTarget)
+	}
+}
+
+// untrackSymlinkLocked drops a symlink and releases its target directory watch.
+func (c *Core) untrackSymlinkLocked(path string) {
+	if targetDir, ok := c.symlinkTargets[path]; ok {
+		delete(c.symlinkTargets, path)
+		c.removeWatchLocked(targetDir)
+	}
+}
+
+func (c *Core) addWatchLocked(dir string) error {
+	c.watchedDirs[dir]++
+	if c.watchedDirs[dir] == 1 {
+		if err := c.watcher.Add(dir); err != nil {
+			delete(c.watchedDirs, dir)
+			return err
+		}
+		c.log.Log(2, "%s: added watch for %s", c.name, dir)
+	}
+	return nil
+}
+
+func (c *Core) removeWatchLocked(dir string) {
+	if _, ok := c.watchedDirs[dir]; !ok {
+		return // already gone (e.g. the directory was deleted)
+	}
+	c.watchedDirs[dir]--
+	if c.watchedDirs[dir] <= 0 {
+		c.watcher.Remove(dir)
+		delete(c.watchedDirs, dir)
+		c.log.Log(2, "%s: removed watch for %s", c.name, dir)
+	}
+}
+
+// dropDeletedDir forgets a watched directory that was removed or renamed away.
+// The OS drops the watch itself, so keeping the reference count would stop a
+// recreated directory from being watched again.
+func (c *Core) dropDeletedDir(dir string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.watchedDirs[dir]; !ok {
+		return
+	}
+	delete(c.watchedDirs, dir)
+	c.watcher.Remove(dir)
+	c.log.Log(2, "%s: watched directory %s disappeared", c.name, dir)
+}
+
+// eventLoop processes file system events.
+func (c *Core) eventLoop() {
+	for {
+		select {
+		case <-c.done:
+			return
+		case event, ok := <-c.watcher.Events:
+			if !ok {
+				return
+			}
+			c.handleEvent(event)
+		case err, ok := <-c.watcher.Errors:
+			if !ok {
+				return
+			}
+			level := 1
+			if c.paused.Load() {
+				level = 3
+			}
+			c.log.Log(level, "%s: watcher error: %v", c.name, err)
+		}
+	}
+}
+
+// handleEvent processes a single file system event.
+func (c *Core) handleEvent(event fsnotify.Event) {
+	gone := event.Op&(fsnotify.Remove|fsnotify.Rename) != 0
+	if gone {
+		c.dropDeletedDir(event.Name)
+		if event.Name == c.dir {
+			if root, ok := c.listener.(RootListener); ok {
+				root.RootRemoved()
+			}
+			return
+		}
+	}
+	if c.paused.Load() || !c.listener.WatchesFile(event.Name) {
+		return
+	}
+
+	c.log.Log(3, "%s: event %s on %s", c.name, event.Op, event.Name)
+
+	// Handle symlink changes in the primary directory
+	if filepath.Dir(event.Name) == c.dir {
+		switch {
+		case event.Op&fsnotify.Create != 0:
+			c.updateSymlinkWatch(event.Name)
+		case gone:
+			// Rename is like remove + create elsewhere
+			c.mu.Lock()
+			c.untrackSymlinkLocked(event.Name)
+			c.mu.Unlock()
+		}
+	}
+
+	if gone || event.Op&(fsnotify.Write|fsnotify.Create) != 0 {
+		c.queue(event.Name)
+	}
+}
+
+// queue records a change, restarting the file's debounce delay.
+func (c *Core) queue(path string) {
+	c.pendingMu.Lock()
+	c.pending[path] = time.Now()
+	c.pendingMu.Unlock()
+}
+
+// debounceLoop delivers pending changes after the debounce delay.
+func (c *Core) debounceLoop() {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.processPending()
+		}
+	}
+}
+
+// processPending delivers files that have been quiet for at least debounceDelay.
+// Whether a file changed or was removed is decided when it is delivered, so an
+// editor's save-by-rename arrives as a single change.
+func (c *Core) processPending() {
+	c.pendingMu.Lock()
+	now := time.Now()
+	var ready []string
+	for path, queuedAt := range c.pending {
+		if now.Sub(queuedAt) >= c.debounceDelay {
+			ready = append(ready, path)
+			delete(c.pending, path)
+		}
+	}
+	c.pendingMu.Unlock()
+
+	for _, path := range ready {
+		if _, err := os.Stat(path); err == nil {
+			c.listener.FileChanged(path)
+		} else if remover, ok := c.listener.(RemoveListener); ok {
+			remover.FileRemoved(path)
+		}
+	}
+}
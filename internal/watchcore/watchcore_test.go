@@ -0,0 +1,241 @@
+// Test Design: test-WatchCore.md
+package watchcore
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/zot/ui-engine/internal/config"
+)
+
+// recordingListener records delivered changes for .txt files
+type recordingListener struct {
+	changed []string
+	removed []string
+	mu      sync.Mutex
+}
+
+func (l *recordingListener) WatchesFile(name string) bool {
+	return strings.HasSuffix(name, ".txt")
+}
+
+func (l *recordingListener) FileChanged(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.changed = append(l.changed, path)
+}
+
+func (l *recordingListener) FileRemoved(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.removed = append(l.removed, path)
+}
+
+func (l *recordingListener) count(path string, removed bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	list := l.changed
+	if removed {
+		list = l.removed
+	}
+	n := 0
+	for _, p := range list {
+		if p == path {
+			n++
+		}
+	}
+	return n
+}
+
+// startCore starts a core on a fresh temp directory
+func startCore(t *testing.T) (*Core, *recordingListener, string) {
+	t.Helper()
+	dir := t.TempDir()
+	c := startCoreIn(t, dir)
+	return c, c.listener.(*recordingListener), dir
+}
+
+func startCoreIn(t *testing.T, dir string) *Core {
+	t.Helper()
+	cfg := config.DefaultConfig()
+	cfg.Logging.Verbosity = 0
+	c, err := New(cfg.Logger(config.LogServer), "test", dir, &recordingListener{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	c.debounceDelay = 20 * time.Millisecond
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { c.Stop() })
+	return c
+}
+
+// waitFor polls cond until it holds or the timeout expires
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSymlinkRetarget(t *testing.T) {
+	dir := t.TempDir()
+	oldDir := t.TempDir()
+	newDir := t.TempDir()
+	os.WriteFile(filepath.Join(oldDir, "a.txt"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(newDir, "a.txt"), []byte("new"), 0644)
+	link := filepath.Join(dir, "a.txt")
+	if err := os.Symlink(filepath.Join(oldDir, "a.txt"), link); err != nil {
+		t.Skipf("Cannot create symlinks: %v", err)
+	}
+
+	c := startCoreIn(t, dir)
+	l := c.listener.(*recordingListener)
+	if c.SymlinkTarget(link) != oldDir || c.WatchCount(oldDir) != 1 {
+		t.Fatalf("initial target = %q (count %d), want %q", c.SymlinkTarget(link), c.WatchCount(oldDir), oldDir)
+	}
+
+	// Retarget the symlink
+	os.Remove(link)
+	if err := os.Symlink(filepath.Join(newDir, "a.txt"), link); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "retarget", func() bool { return c.SymlinkTarget(link) == newDir })
+	if n := c.WatchCount(oldDir); n != 0 {
+		t.Errorf("old target watch count = %d, want 0", n)
+	}
+	if n := c.WatchCount(newDir); n != 1 {
+		t.Errorf("new target watch count = %d, want 1", n)
+	}
+
+	// Edits to the new target are delivered through the symlink
+	os.WriteFile(filepath.Join(newDir, "a.txt"), []byte("edited"), 0644)
+	target := filepath.Join(newDir, "a.txt")
+	waitFor(t, "change in new target", func() bool { return l.count(target, false) > 0 })
+	if c.SymlinkFor(target) != link {
+		t.Errorf("SymlinkFor(%q) = %q, want %q", target, c.SymlinkFor(target), link)
+	}
+}
+
+func TestRenameEvents(t *testing.T) {
+	_, l, dir := startCore(t)
+
+	tmp := filepath.Join(dir, "a.txt.tmp")
+	file := filepath.Join(dir, "a.txt")
+	os.WriteFile(file, []byte("v1"), 0644)
+	waitFor(t, "create", func() bool { return l.count(file, false) == 1 })
+
+	// Save-by-rename delivers one change, not a removal
+	os.WriteFile(tmp, []byte("v2"), 0644)
+	if err := os.Rename(tmp, file); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "rename over", func() bool { return l.count(file, false) == 2 })
+	if n := l.count(file, true); n != 0 {
+		t.Errorf("removals after save-by-rename = %d, want 0", n)
+	}
+
+	// Renaming away is a removal
+	if err := os.Rename(file, filepath.Join(dir, "b.md")); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "rename away", func() bool { return l.count(file, true) == 1 })
+}
+
+func TestWatchedDirDisappears(t *testing.T) {
+	c, l, dir := startCore(t)
+
+	sub := filepath.Join(dir, "sub")
+	os.Mkdir(sub, 0755)
+	if err := c.Watch(sub); err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	os.RemoveAll(sub)
+	waitFor(t, "directory removal", func() bool { return c.WatchCount(sub) == 0 })
+
+	// A recreated directory can be watched again
+	os.Mkdir(sub, 0755)
+	if err := c.Watch(sub); err != nil {
+		t.Fatalf("re-Watch failed: %v", err)
+	}
+	if n := c.WatchCount(sub); n != 1 {
+		t.Fatalf("watch count after recreate = %d, want 1", n)
+	}
+	file := filepath.Join(sub, "a.txt")
+	os.WriteFile(file, []byte("x"), 0644)
+	waitFor(t, "change in recreated directory", func() bool { return l.count(file, false) > 0 })
+}
+
+func TestForgetDirReleasesSymlinkWatches(t *testing.T) {
+	dir := t.TempDir()
+	target := t.TempDir()
+	os.WriteFile(filepath.Join(target, "a.txt"), []byte("a"), 0644)
+	link := filepath.Join(dir, "a.txt")
+	if err := os.Symlink(filepath.Join(target, "a.txt"), link); err != nil {
+		t.Skipf("Cannot create symlinks: %v", err)
+	}
+
+	c := startCoreIn(t, dir)
+	c.ForgetDir(dir)
+	if n := c.WatchCount(target); n != 0 {
+		t.Errorf("symlink target watch count after ForgetDir = %d, want 0", n)
+	}
+	if c.SymlinkTarget(link) != "" {
+		t.Error("symlink still tracked after ForgetDir")
+	}
+}
+
+// rootListener also records removal of the primary directory
+type rootListener struct {
+	recordingListener
+	rootRemoved atomic.Int32
+}
+
+func (l *rootListener) RootRemoved() {
+	l.rootRemoved.Add(1)
+}
+
+func TestPrimaryDirectoryRemoved(t *testing.T) {
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "lua")
+	os.Mkdir(dir, 0755)
+	cfg := config.DefaultConfig()
+	cfg.Logging.Verbosity = 0
+	l := &rootListener{}
+	c, err := New(cfg.Logger(config.LogServer), "test", dir, l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.debounceDelay = 20 * time.Millisecond
+	if err := c.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Stop() })
+
+	os.RemoveAll(dir)
+	waitFor(t, "RootRemoved", func() bool { return l.rootRemoved.Load() == 1 })
+	c.Pause()
+	if !c.Paused() || c.WatchCount(dir) != 0 {
+		t.Fatalf("paused = %v, watch count = %d", c.Paused(), c.WatchCount(dir))
+	}
+
+	// The directory comes back: resuming watches it again
+	os.Mkdir(dir, 0755)
+	if err := c.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "a.txt")
+	os.WriteFile(file, []byte("back"), 0644)
+	waitFor(t, "change after resume", func() bool { return l.count(file, false) > 0 })
+}
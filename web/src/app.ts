@@ -4,7 +4,7 @@
 
 import { Connection, VariableStore } from './connection';
 import { BindingEngine } from './binding';
-import { Message } from './protocol';
+import { Message, ShutdownMessage } from './protocol';
 import { ViewdefStore } from './viewdef_store';
 import { AppView, findAppElement, createAppView } from './app_view';
 import { getSessionIdFromLocation } from './router';
@@ -73,6 +73,11 @@ export class UIApp {
         const error = msg.data as { description: string };
         console.error('Server error:', error.description);
         break;
+      case 'shutdown':
+        // The connection reconnects with backoff; variable 1's next update clears this
+        console.warn('Server shutdown:', (msg.data as ShutdownMessage).reason);
+        this.appView?.showBanner('Server restarting, reconnecting…');
+        break;
       // Other message types are handled by VariableStore
     }
   }
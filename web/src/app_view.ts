@@ -3,14 +3,21 @@
 // Spec: viewdefs.md
 
 import { View } from './view';
-import { ViewdefStore } from './viewdef_store';
+import { ViewdefStore, ViewdefMeta } from './viewdef_store';
 import { VariableStore } from './connection';
 import { BindingEngine } from './binding';
 import { ensureElementId } from './element_id_vendor';
+import { setScriptNonce } from './viewdef';
 
 // Root app variable ID is always 1
 const ROOT_VARIABLE_ID = 1;
 
+// A session shortcut: the action variable created for its method path
+interface Shortcut {
+  combo: string;
+  actionVarId: number;
+}
+
 export class AppView {
   readonly elementId: string;
   readonly variableId: number = ROOT_VARIABLE_ID;
@@ -20,7 +27,11 @@ export class AppView {
   private viewdefStore: ViewdefStore;
   private variableStore: VariableStore;
   private unwatch: (() => void) | null = null;
+  private unwatchErrors: (() => void) | null = null;
   private binding?: BindingEngine;
+  private shortcutsJson = '';
+  private shortcuts: Shortcut[] = [];
+  private keyHandler: ((event: KeyboardEvent) => void) | null = null;
 
   constructor(
     element: HTMLElement,
@@ -61,15 +72,45 @@ export class AppView {
     this.view.setVariable(this.variableId, true);
 
     //// Also watch variable 1 for viewdefs property updates
-    this.unwatch = this.variableStore.watch(this.variableId, (_v, value, props) => {
+    this.unwatch = this.variableStore.watch(this.variableId, (v, value, props) => {
       this.handleRootUpdate(value, props ?? {});
+      this.applyShortcuts(v.properties['shortcuts'] ?? '');
     }, false);
+
+    // Until a backend creates variable 1 the server reports it as pending;
+    // ui-pending lets the page show "waiting for backend"
+    this.unwatchErrors = this.variableStore.watchErrors(this.variableId, (error) => {
+      this.getElement()?.toggleAttribute('ui-pending', error?.code === 'pending');
+      // A hibernated session that could not be restored started fresh;
+      // ui-session-reset stays set so the page can say so
+      if (error?.code === 'session-reset') {
+        this.getElement()?.setAttribute('ui-session-reset', '');
+      }
+    });
   }
 
   // Handle updates to variable 1
   private handleRootUpdate(_value: unknown, props: Record<string, string>): void {
     console.log('handleRootUpdate called, props:', Object.keys(props));
 
+    // CSP nonce before viewdefs, so their scripts are allowed to run
+    if (props['cspNonce']) {
+      setScriptNonce(props['cspNonce']);
+    }
+
+    // Metadata first, so viewdefs rendered below see their layout hints
+    const metaJson = props['viewdefMeta'];
+    if (metaJson) {
+      try {
+        const meta = JSON.parse(metaJson) as Record<string, ViewdefMeta>;
+        if (typeof meta === 'object' && meta !== null) {
+          this.viewdefStore.processMeta(meta);
+        }
+      } catch (e) {
+        console.error('Failed to parse viewdefMeta property:', e);
+      }
+    }
+
     // Check for viewdefs property (JSON string containing TYPE.NAMESPACE -> HTML mappings)
     // Per spec: "Variable 1 has a viewdefs property containing TYPE.NAMESPACE → HTML mappings"
     const viewdefsJson = props['viewdefs'];
@@ -88,10 +129,105 @@ export class AppView {
       console.log('No viewdefs property found');
     }
 
+    // A session being drained for maintenance shows its message above the app
+    this.showBanner(props['banner'] ?? '');
+
+    // focus is sent once per session:focus call, after the views it names
+    if (props['focus']) {
+      requestAnimationFrame(() => this.focusPath(props['focus']));
+    }
+
     // The View will re-render automatically when type property changes
     // since it watches the variable
   }
 
+  // Show or remove the banner element before ui-app; ui-banner marks the app
+  // while one is shown
+  showBanner(message: string): void {
+    const element = this.getElement();
+    if (!element) {
+      return;
+    }
+    const bannerId = this.elementId + '-banner';
+    let banner = document.getElementById(bannerId);
+    if (!message) {
+      banner?.remove();
+      element.removeAttribute('ui-banner');
+      return;
+    }
+    if (!banner) {
+      banner = document.createElement('div');
+      banner.id = bannerId;
+      banner.className = 'ui-banner';
+      banner.setAttribute('role', 'status');
+      element.before(banner);
+    }
+    banner.textContent = message;
+    element.setAttribute('ui-banner', '');
+  }
+
+  // Focus the first element in the app whose ui-value is bound to path
+  // Spec: libraries.md - Focus and Shortcuts
+  private focusPath(path: string): void {
+    const element = this.getElement();
+    if (!element) {
+      return;
+    }
+    for (const el of element.querySelectorAll<HTMLElement>('[ui-value]')) {
+      if (el.getAttribute('ui-value')?.split('?')[0] === path) {
+        el.focus();
+        return;
+      }
+    }
+  }
+
+  // Replace the session's shortcuts when variable 1's shortcuts property
+  // changes. Each gets an action variable, updated when its combo is pressed
+  // anywhere on the page.
+  // Spec: libraries.md - Focus and Shortcuts
+  private applyShortcuts(json: string): void {
+    if (json === this.shortcutsJson) {
+      return;
+    }
+    this.shortcutsJson = json;
+    this.clearShortcuts();
+    if (!json) {
+      return;
+    }
+    try {
+      const specs = JSON.parse(json) as Record<string, { var: number; path: string }>;
+      for (const [combo, spec] of Object.entries(specs)) {
+        const actionVarId = this.variableStore.create({
+          parentId: spec.var,
+          properties: { path: spec.path, access: 'action' },
+        });
+        this.shortcuts.push({ combo, actionVarId });
+      }
+    } catch (e) {
+      console.error('Failed to parse shortcuts property:', e);
+    }
+    this.keyHandler = (event: KeyboardEvent) => {
+      const shortcut = this.shortcuts.find((s) => this.binding?.matchesKeyCombo(event, s.combo));
+      if (shortcut) {
+        event.preventDefault();
+        this.variableStore.update(shortcut.actionVarId, null);
+      }
+    };
+    document.addEventListener('keydown', this.keyHandler);
+  }
+
+  // Remove the shortcuts' key handler and action variables
+  private clearShortcuts(): void {
+    if (this.keyHandler) {
+      document.removeEventListener('keydown', this.keyHandler);
+      this.keyHandler = null;
+    }
+    for (const shortcut of this.shortcuts) {
+      this.variableStore.destroy(shortcut.actionVarId);
+    }
+    this.shortcuts = [];
+  }
+
   // Get the View instance
   getView(): View | null {
     return this.view;
@@ -108,6 +244,11 @@ export class AppView {
       this.unwatch();
       this.unwatch = null;
     }
+    if (this.unwatchErrors) {
+      this.unwatchErrors();
+      this.unwatchErrors = null;
+    }
+    this.clearShortcuts();
     if (this.view) {
       this.view.destroy();
       this.view = null;
@@ -1090,6 +1090,14 @@ export class BindingEngine {
     return true
   }
 
+  // Check if a keyboard event matches a key combo in ui-event-keypress form
+  // (e.g. "ctrl-shift-s"), as session shortcuts use
+  // Spec: libraries.md - Focus and Shortcuts
+  matchesKeyCombo(event: KeyboardEvent, combo: string): boolean {
+    const { modifiers, key } = this.parseKeypressAttribute(combo)
+    return key !== '' && this.matchesTargetKey(event, key) && this.matchesModifiers(event, modifiers)
+  }
+
   // Sync ui-value before sending event if element value differs from cached
   // Spec: viewdefs.md - Event Bindings (value sync with ui-value)
   // CRC: crc-EventBinding.md - Event Update Behavior
@@ -1,8 +1,8 @@
-// WebSocket connection management
+// WebSocket connection management, with a polling fallback
 // CRC: crc-WebSocketEndpoint.md, crc-SharedWorker.md
 // Spec: interfaces.md
 
-import { Message, UpdateMessage, ErrorMessage } from './protocol';
+import { Message, UpdateMessage, ErrorMessage, ShutdownMessage, RootsResponse, ErrorsResponse, ErrorRecord } from './protocol';
 import { Variable } from './variable';
 import { FrontendOutgoingBatcher, Priority } from './outgoing_batcher';
 import type { Widget } from './binding';
@@ -11,16 +11,29 @@ export type MessageHandler = (msg: Message) => void;
 export type ErrorHandler = (error: string) => void;
 export type ConnectionHandler = () => void;
 
+// Failed WebSocket upgrades before falling back to a polling connection
+// Spec: protocol.md - Polling Connections
+const POLL_FALLBACK_AFTER = 3;
+const POLL_WAIT = '25s';
+
 export class Connection {
   private ws: WebSocket | null = null;
   private sessionId: string;
   private reconnectAttempts = 0;
   private maxReconnectAttempts = 5;
   private reconnectDelay = 1000;
+  private retryAfterMs: number | null = null; // server hint for the next reconnect
   private messageHandlers: MessageHandler[] = [];
   private errorHandlers: ErrorHandler[] = [];
   private connectHandlers: ConnectionHandler[] = [];
   private disconnectHandlers: ConnectionHandler[] = [];
+  private rootsWaiters: ((roots: RootsResponse) => void)[] = []; // pending getRoots() calls
+  private errorsWaiters: ((errors: ErrorRecord[]) => void)[] = []; // pending getErrors() calls
+  private failedUpgrades = 0; // WebSocket attempts that never opened
+  private pollConn: string | null = null; // polling connection ID, when polling
+  // Spec: interfaces.md - WebSocket Compression
+  private compress = true; // offer per-message deflate; off after a compressed socket failed
+  private compressed = false; // the open socket negotiated per-message deflate
   // Spec: protocol.md - Frontend vends variable IDs starting from 2 (1 is root from server)
   private nextVarId = 2;
   // Outgoing message batcher (50ms debounce, priority sorting)
@@ -32,20 +45,35 @@ export class Connection {
     this.batcher = new FrontendOutgoingBatcher((data) => this.sendRaw(data));
   }
 
+  // Whether the open WebSocket negotiated per-message deflate
+  isCompressed(): boolean {
+    return this.compressed;
+  }
+
   connect(): Promise<void> {
+    if (this.failedUpgrades >= POLL_FALLBACK_AFTER) {
+      return this.connectPolling();
+    }
     return new Promise((resolve, reject) => {
       const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-      const url = `${protocol}//${window.location.host}/ws/${this.sessionId}`;
+      const query = this.compress ? '' : '?compress=0';
+      const url = `${protocol}//${window.location.host}/ws/${this.sessionId}${query}`;
+      let opened = false;
+      let received = false;
 
       this.ws = new WebSocket(url);
 
       this.ws.onopen = () => {
+        opened = true;
+        this.compressed = this.ws?.extensions.includes('permessage-deflate') ?? false;
+        this.failedUpgrades = 0;
         this.reconnectAttempts = 0;
         this.connectHandlers.forEach((h) => h());
         resolve();
       };
 
       this.ws.onmessage = (event) => {
+        received = true;
         try {
           const data = JSON.parse(event.data);
 
@@ -71,10 +99,22 @@ export class Connection {
 
       this.ws.onerror = (event) => {
         console.error('WebSocket error:', event);
+        if (!opened) {
+          // Proxies that block upgrades fail here; enough of these switches to polling
+          this.failedUpgrades++;
+        }
         reject(new Error('WebSocket connection failed'));
       };
 
-      this.ws.onclose = () => {
+      this.ws.onclose = (event) => {
+        // A browser or proxy that mangles deflated frames fails the socket
+        // (protocol error or invalid data) before any message gets through;
+        // reconnect without compression
+        if (this.compressed && !received && (event.code === 1002 || event.code === 1007)) {
+          console.warn('WebSocket compression failed, reconnecting without it');
+          this.compress = false;
+        }
+        this.compressed = false;
         this.disconnectHandlers.forEach((h) => h());
         this.attemptReconnect();
       };
@@ -88,7 +128,9 @@ export class Connection {
     }
 
     this.reconnectAttempts++;
-    const delay = this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
+    // Prefer the server's jittered hint so clients don't reconnect in lockstep
+    const delay = this.retryAfterMs ?? this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
+    this.retryAfterMs = null;
 
     setTimeout(() => {
       this.connect().catch(() => {
@@ -97,6 +139,80 @@ export class Connection {
     }, delay);
   }
 
+  // Open a polling connection and start its poll loop
+  // Spec: protocol.md - Polling Connections
+  private async connectPolling(): Promise<void> {
+    const resp = await fetch(`/${this.sessionId}/connect`, { method: 'POST' });
+    if (!resp.ok) {
+      throw new Error(`Polling connection failed: ${resp.status}`);
+    }
+    const conn = (await resp.json()).result.connection as string;
+    console.log('Falling back to polling connection', conn);
+    this.pollConn = conn;
+    this.reconnectAttempts = 0;
+    this.connectHandlers.forEach((h) => h());
+    this.pollLoop(conn);
+  }
+
+  // Long-poll for messages until the connection closes or expires
+  private async pollLoop(conn: string): Promise<void> {
+    while (this.pollConn === conn) {
+      let body: { result?: unknown[]; retryAfterMs?: number };
+      try {
+        const resp = await fetch(`/api/poll?conn=${conn}`, {
+          method: 'POST',
+          body: JSON.stringify({ data: { wait: POLL_WAIT } }),
+        });
+        if (!resp.ok) {
+          throw new Error(`poll failed: ${resp.status}`);
+        }
+        body = await resp.json();
+      } catch (e) {
+        console.error('Polling error:', e);
+        this.pollClosed(conn);
+        return;
+      }
+      if (this.pollConn !== conn) {
+        return;
+      }
+      this.batcher.ensureDebounceStarted();
+      for (const item of body.result ?? []) {
+        this.processIncomingItem(item);
+      }
+      if (body.retryAfterMs) {
+        // Draining server: come back when it says
+        this.retryAfterMs = body.retryAfterMs;
+        await new Promise((resolve) => setTimeout(resolve, body.retryAfterMs));
+      }
+    }
+  }
+
+  // Handle a lost polling connection like a closed WebSocket
+  private pollClosed(conn: string): void {
+    if (this.pollConn !== conn) {
+      return;
+    }
+    this.pollConn = null;
+    this.disconnectHandlers.forEach((h) => h());
+    this.attemptReconnect();
+  }
+
+  // Post a batch on the polling connection; its responses come back in the reply
+  private postBatch(conn: string, data: string): void {
+    fetch(`/api/batch?conn=${conn}`, { method: 'POST', body: data })
+      .then((resp) => {
+        if (!resp.ok) {
+          throw new Error(`batch failed: ${resp.status}`);
+        }
+        return resp.json();
+      })
+      .then((responses: unknown[]) => responses.forEach((item) => this.processIncomingItem(item)))
+      .catch((e) => {
+        console.error('Polling send error:', e);
+        this.pollClosed(conn);
+      });
+  }
+
   // Process a single incoming item (message)
   // Called for each item in a batch or for a single item
   private processIncomingItem(data: unknown): void {
@@ -106,7 +222,24 @@ export class Connection {
 
     // All incoming items should be messages (no more responses)
     //console.log('RECEIVED MESSAGE', JSON.stringify(data));
-    this.handleMessage(data as Message);
+    const msg = data as Message;
+    const result = (data as { result?: RootsResponse & ErrorsResponse }).result;
+    if (!msg.type && result?.roots) {
+      // getRoots and getErrors answers are the only results sent without an error
+      this.rootsWaiters.shift()?.(result);
+      return;
+    }
+    if (!msg.type && result?.errors) {
+      this.errorsWaiters.shift()?.(result.errors);
+      return;
+    }
+    if (msg.type === 'error' || msg.type === 'shutdown') {
+      const hint = (msg.data as ErrorMessage | ShutdownMessage | undefined)?.retryAfterMs;
+      if (hint) {
+        this.retryAfterMs = hint;
+      }
+    }
+    this.handleMessage(msg);
   }
 
   private handleMessage(msg: Message): void {
@@ -120,9 +253,11 @@ export class Connection {
     return this.nextVarId++;
   }
 
-  // Send raw data directly to WebSocket (used by batcher)
+  // Send raw data directly to WebSocket or polling connection (used by batcher)
   private sendRaw(data: string): void {
-    if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+    if (this.pollConn) {
+      this.postBatch(this.pollConn, data);
+    } else if (this.ws && this.ws.readyState === WebSocket.OPEN) {
       this.ws.send(data);
     } else {
       console.error('WebSocket not connected');
@@ -134,7 +269,7 @@ export class Connection {
   // Spec: protocol.md - Frontend outgoing batching
   // CRC: crc-FrontendOutgoingBatcher.md - debounce vs immediate flush
   send(msg: Message, priority: Priority = 'medium', immediate = false): void {
-    if (!this.ws || this.ws.readyState !== WebSocket.OPEN) {
+    if (!this.isConnected()) {
       console.error('WebSocket not connected');
       return;
     }
@@ -146,6 +281,24 @@ export class Connection {
     }
   }
 
+  // Look up the session's named root variables (name -> variable ID)
+  // Spec: protocol.md - Named Roots
+  getRoots(): Promise<RootsResponse> {
+    return new Promise((resolve) => {
+      this.rootsWaiters.push(resolve);
+      this.send({ type: 'getRoots', data: {} }, 'high', true);
+    });
+  }
+
+  // Fetch this connection's recent protocol errors, oldest first, e.g. for a dev console
+  // Spec: protocol.md - Error History
+  getErrors(): Promise<ErrorRecord[]> {
+    return new Promise((resolve) => {
+      this.errorsWaiters.push(resolve);
+      this.send({ type: 'getErrors', data: {} }, 'high', true);
+    });
+  }
+
   onMessage(handler: MessageHandler): () => void {
     this.messageHandlers.push(handler);
     return () => {
@@ -181,6 +334,7 @@ export class Connection {
   disconnect(): void {
     // Flush pending messages before closing
     this.batcher.flushNow();
+    this.pollConn = null;
     if (this.ws) {
       this.ws.close();
       this.ws = null;
@@ -188,7 +342,7 @@ export class Connection {
   }
 
   isConnected(): boolean {
-    return this.ws !== null && this.ws.readyState === WebSocket.OPEN;
+    return this.pollConn !== null || (this.ws !== null && this.ws.readyState === WebSocket.OPEN);
   }
 }
 
@@ -221,7 +375,7 @@ export class VariableStore {
     connection.onMessage((msg) => {
       if (msg.type === 'update') {
         const data = msg.data as UpdateMessage;
-        this.handleUpdate(data.varId, data.value, data.properties);
+        this.handleUpdate(data.varId, data.value, data.properties, undefined, data.removeProperties);
       } else if (msg.type === 'destroy') {
         const data = msg.data as { varId: number };
         this.handleDestroy(data.varId);
@@ -234,7 +388,7 @@ export class VariableStore {
     });
   }
 
-  private handleUpdate(varId: number, value?: unknown, properties?: Record<string, string>, parentId?: number): void {
+  private handleUpdate(varId: number, value?: unknown, properties?: Record<string, string>, parentId?: number, removeProperties?: string[]): void {
     let existing = this.variables.get(varId);
     if (!existing) {
       existing = { varId, value: undefined, properties: {} } as Variable;
@@ -251,6 +405,13 @@ export class VariableStore {
     if (properties) {
       existing.properties = { ...existing.properties, ...properties };
     }
+    // Removed properties are deleted; watchers read the variable's properties to see them gone
+    if (removeProperties?.length) {
+      existing.properties = { ...existing.properties };
+      for (const name of removeProperties) {
+        delete existing.properties[name];
+      }
+    }
 
     // Clear error on successful update (spec: error clears on successful operation)
     if (this.errors.has(varId)) {
@@ -9,9 +9,12 @@ export type MessageType =
   | 'watch'
   | 'unwatch'
   | 'error'
+  | 'shutdown'
   | 'get'
   | 'getObjects'
-  | 'poll';
+  | 'poll'
+  | 'getRoots'
+  | 'getErrors';
 
 export interface Message {
   type: MessageType;
@@ -36,6 +39,7 @@ export interface UpdateMessage {
   varId: number;
   value?: unknown;
   properties?: Record<string, string>;
+  removeProperties?: string[];
 }
 
 export interface WatchMessage {
@@ -47,6 +51,13 @@ export interface ErrorMessage {
   varId?: number;
   code: string;        // One-word error code (e.g., "path-failure", "not-found", "unauthorized")
   description: string; // Human-readable error description
+  retryAfterMs?: number; // Server's jittered backoff hint (e.g., on shutdown)
+}
+
+// Spec: protocol.md - shutdown(reason, retryAfterMs)
+export interface ShutdownMessage {
+  reason: string;
+  retryAfterMs?: number; // When to start reconnecting
 }
 
 export interface GetMessage {
@@ -61,6 +72,25 @@ export interface PollMessage {
   wait?: string;
 }
 
+// Spec: protocol.md - getRoots() answers with root names mapped to variable IDs
+export interface RootsResponse {
+  roots: Record<string, number>;
+  meta?: number; // Root carrying viewdefs and flags
+}
+
+// Spec: protocol.md - getErrors() answers with the connection's recent errors, oldest first
+export interface ErrorRecord {
+  time: string;
+  type?: MessageType; // Message the error answered
+  varId?: number;
+  code?: string;
+  description: string;
+}
+
+export interface ErrorsResponse {
+  errors: ErrorRecord[];
+}
+
 export interface VariableData {
   id: number;
   value?: unknown;
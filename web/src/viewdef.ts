@@ -80,6 +80,14 @@ export function collectScripts(container: DocumentFragment | Element): HTMLScrip
   return Array.from(container.querySelectorAll('script')) as HTMLScriptElement[];
 }
 
+// CSP nonce for viewdef scripts, from variable 1's cspNonce property
+// Spec: viewdefs.md
+let scriptNonce = '';
+
+export function setScriptNonce(nonce: string): void {
+  scriptNonce = nonce;
+}
+
 // Activate script elements by replacing with new ones
 // Cloned scripts don't execute; creating new script elements triggers execution
 // Spec: viewdefs.md - Render process step 7
@@ -88,6 +96,9 @@ export function activateScripts(scripts: HTMLScriptElement[]): void {
     const newScript = document.createElement('script');
     newScript.type = 'text/javascript';
     newScript.textContent = original.textContent;
+    if (scriptNonce) {
+      newScript.nonce = scriptNonce;
+    }
     if (original.id) {
       newScript.id = original.id;
     }
@@ -11,11 +11,19 @@ export interface PendingView {
   render: () => boolean; // Returns true if rendered successfully
 }
 
+// Layout hints from a viewdef's TYPE.NAMESPACE.meta.json sidecar
+export interface ViewdefMeta {
+  width?: string;
+  mode?: 'modal' | 'inline';
+  icon?: string;
+}
+
 // Function to look up a View by element ID (via widget.view)
 export type ViewLookup = (elementId: string) => ViewLike | undefined;
 
 export class ViewdefStore {
   private viewdefs: Map<string, Viewdef> = new Map();
+  private meta: Map<string, ViewdefMeta> = new Map();
   private pendingViews: Map<string, PendingView> = new Map();
   private errorHandler?: (key: string, error: string) => void;
   private viewLookup?: ViewLookup;  // Set by BindingEngine for hot-reload
@@ -72,6 +80,24 @@ export class ViewdefStore {
     }
   }
 
+  // Process metadata from variable 1's viewdefMeta property
+  // meta is { "TYPE.NAMESPACE": { width?, mode?, icon? }, ... }
+  // Re-renders views whose viewdef is already loaded so they pick up the new hints
+  // CRC: crc-ViewdefStore.md - processMeta
+  processMeta(meta: Record<string, ViewdefMeta>): void {
+    for (const [key, value] of Object.entries(meta)) {
+      this.meta.set(key, value ?? {});
+      if (this.viewdefs.has(key)) {
+        this.rerenderViewsForKey(key);
+      }
+    }
+  }
+
+  // Get metadata for a viewdef key (empty object when the viewdef has none)
+  getMeta(key: string): ViewdefMeta {
+    return this.meta.get(key) ?? {};
+  }
+
   // Re-render all views using a specific viewdef key
   // Queries DOM for elements with ui-viewdef attribute matching the key
   // Uses widget.view.forceRender() to trigger re-render
@@ -185,5 +211,6 @@ export class ViewdefStore {
   // Clear all viewdefs (e.g., on reconnect)
   clear(): void {
     this.viewdefs.clear();
+    this.meta.clear();
   }
 }
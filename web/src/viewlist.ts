@@ -41,6 +41,20 @@ export class ViewList {
   private binding?: BindingEngine;
   private _scrollOnOutput = false;  // Pending scrollOnOutput to set on widget
 
+  // Windowed rendering: the backend sends only the items around the viewport
+  // Spec: viewdefs.md - Windowed ViewLists
+  private windowed = false;
+  private overscan = ViewList.DEFAULT_OVERSCAN;
+  private rowHeight = 0;                           // measured from the first rendered item
+  private windowViews: Map<number, View> = new Map(); // absolute index -> view
+  private graceTimers: Map<number, number> = new Map(); // index -> pending destroy
+  private viewport = '';                           // last reported viewport
+  private onScroll = () => this.reportViewport();
+
+  static readonly DEFAULT_OVERSCAN = 10;
+  static readonly DEFAULT_WINDOW = 30;  // rows asked for before a row height is known
+  static readonly GRACE_MS = 2000;      // how long views outside the window are kept
+
   // Path properties for wrapper configuration
   private pathConfig: ParsedViewListPath | null = null;
 
@@ -131,6 +145,17 @@ export class ViewList {
       this._scrollOnOutput = true;
       delete this.pathConfig.props['scrollOnOutput'];  // Don't send to backend
     }
+
+    // Extract windowed rendering options
+    // Spec: viewdefs.md - Windowed ViewLists
+    if (this.pathConfig.props['windowed'] !== undefined) {
+      this.windowed = this.pathConfig.props['windowed'] !== 'false';
+      delete this.pathConfig.props['windowed'];
+    }
+    if (this.pathConfig.props['overscan'] !== undefined) {
+      this.overscan = Number(this.pathConfig.props['overscan']) || 0;
+      delete this.pathConfig.props['overscan'];
+    }
   }
 
   // Get properties to set on the variable when created
@@ -141,6 +166,9 @@ export class ViewList {
     if (this.pathConfig.item) {
       props.item = this.pathConfig.item;
     }
+    if (this.windowed) {
+      Object.assign(props, this.viewportProperties(0, ViewList.DEFAULT_WINDOW - 1));
+    }
     return props;
   }
 
@@ -186,6 +214,11 @@ export class ViewList {
       this.update();
     });
 
+    // Report the viewport as the list scrolls
+    if (this.windowed) {
+      this.getElement()?.addEventListener('scroll', this.onScroll, { passive: true });
+    }
+
     // Initial update
     this.update();
   }
@@ -203,6 +236,10 @@ export class ViewList {
       this.clear();
       return;
     }
+    if (this.windowed) {
+      this.updateWindow(value.length, listVariable);
+      return;
+    }
 
     // Add views for new items
     while (this.itemViews.length < value.length) {
@@ -221,6 +258,90 @@ export class ViewList {
     this.notifyParentRendered();
   }
 
+  // Render the window the backend sent: views for its absolute indexes, padding
+  // standing in for the rows before and after it. Views that left the window are
+  // hidden and destroyed after a grace period, so scrolling back is cheap.
+  // Spec: viewdefs.md - Windowed ViewLists
+  private updateWindow(
+    count: number,
+    listVariable: { parentId?: number; properties: Record<string, string> }
+  ): void {
+    const start = Number(listVariable.properties.windowStart) || 0;
+    const total = Number(listVariable.properties.windowTotal) || count;
+    const end = start + count;
+    const listElement = this.getElement();
+
+    for (let index = start; index < end; index++) {
+      let view = this.windowViews.get(index);
+      if (!view) {
+        view = this.createItemView();
+        this.windowViews.set(index, view);
+        this.createItemVariable(view, index, listVariable);
+      }
+      this.cancelGrace(index);
+      const element = view.getElement();
+      if (element) {
+        element.hidden = false;
+        listElement?.appendChild(element); // keeps views in index order
+      }
+    }
+    for (const [index, view] of this.windowViews) {
+      if ((index < start || index >= end) && !this.graceTimers.has(index)) {
+        const element = view.getElement();
+        if (element) element.hidden = true;
+        this.graceTimers.set(index, window.setTimeout(() => this.destroyWindowView(index), ViewList.GRACE_MS));
+      }
+    }
+
+    if (!this.rowHeight) {
+      this.rowHeight = this.windowViews.get(start)?.getElement()?.offsetHeight ?? 0;
+    }
+    if (listElement && this.rowHeight) {
+      listElement.style.paddingTop = `${start * this.rowHeight}px`;
+      listElement.style.paddingBottom = `${Math.max(total - end, 0) * this.rowHeight}px`;
+    }
+    this.notifyParentRendered();
+    this.reportViewport();
+  }
+
+  // Tell the backend which rows are visible, if that changed
+  // Spec: viewdefs.md - Windowed ViewLists
+  private reportViewport(): void {
+    const element = this.getElement();
+    if (!element || this.variableId === null || !this.rowHeight) return;
+    const first = Math.floor(element.scrollTop / this.rowHeight);
+    const last = Math.ceil((element.scrollTop + element.clientHeight) / this.rowHeight);
+    const props = this.viewportProperties(first, last);
+    const viewport = JSON.stringify(props);
+    if (viewport !== this.viewport) {
+      this.viewport = viewport;
+      this.variableStore.update(this.variableId, undefined, props);
+    }
+  }
+
+  private viewportProperties(first: number, last: number): Record<string, string> {
+    return {
+      windowFirst: String(first),
+      windowLast: String(last),
+      windowOverscan: String(this.overscan),
+    };
+  }
+
+  private cancelGrace(index: number): void {
+    const timer = this.graceTimers.get(index);
+    if (timer !== undefined) {
+      clearTimeout(timer);
+      this.graceTimers.delete(index);
+    }
+  }
+
+  // Destroy a view whose grace period ended (its variable goes with it)
+  private destroyWindowView(index: number): void {
+    this.graceTimers.delete(index);
+    this.windowViews.get(index)?.destroy();
+    this.windowViews.delete(index);
+  }
+
   // Create a child variable for an item view at the given index
   // Spec: viewdefs.md - Namespace variable properties
   private createItemVariable(
@@ -291,11 +412,20 @@ export class ViewList {
       view.destroy();
     }
     this.itemViews = [];
+    for (const timer of this.graceTimers.values()) {
+      clearTimeout(timer);
+    }
+    this.graceTimers.clear();
+    for (const view of this.windowViews.values()) {
+      view.destroy();
+    }
+    this.windowViews.clear();
+    this.viewport = '';
   }
 
   // Get number of items
   getCount(): number {
-    return this.itemViews.length;
+    return this.windowed ? this.windowViews.size : this.itemViews.length;
   }
 
   // Get view element at index (returns first element of view)
@@ -316,6 +446,7 @@ export class ViewList {
       this.unwatch();
       this.unwatch = null;
     }
+    this.getElement()?.removeEventListener('scroll', this.onScroll);
     this.clear();
 
     // Destroy the associated variable (notifies backend)